@@ -31,8 +31,12 @@ flow/flow.pb.go: flow/flow.proto filters/filters.proto
 	sed -e 's/type FlowLayer struct {/\/\/ gendecoder\ntype FlowLayer struct {/' -i $@
 	sed -e 's/type TransportLayer struct {/\/\/ gendecoder\ntype TransportLayer struct {/' -i $@
 	sed -e 's/type ICMPLayer struct {/\/\/ gendecoder\ntype ICMPLayer struct {/' -i $@
+	sed -e 's/type ICMPOriginalFlow struct {/\/\/ gendecoder\ntype ICMPOriginalFlow struct {/' -i $@
 	sed -e 's/type IPMetric struct {/\/\/ gendecoder\ntype IPMetric struct {/' -i $@
 	sed -e 's/type TCPMetric struct {/\/\/ gendecoder\ntype TCPMetric struct {/' -i $@
+	sed -e 's/type NAT struct {/\/\/ gendecoder\ntype NAT struct {/' -i $@
+	sed -e 's/type Process struct {/\/\/ gendecoder\ntype Process struct {/' -i $@
+	sed -e 's/type DHCP struct {/\/\/ gendecoder\ntype DHCP struct {/' -i $@
 	# This is to allow calling go generate on flow/flow.pb.go
 	sed -e 's/DO NOT EDIT./DO NOT MODIFY/' -i $@
 	sed '1 i //go:generate go run github.com/skydive-project/skydive/scripts/gendecoder' -i $@
@@ -41,6 +45,13 @@ flow/flow.pb.go: flow/flow.proto filters/filters.proto
 flow/flow.pb_easyjson.go: flow/flow.pb.go
 	go run github.com/mailru/easyjson/easyjson -all $<
 
+api/grpc/skydive.pb.go: api/grpc/skydive.proto flow/flow.proto
+	go get github.com/gogo/protobuf/protoc-gen-gogofaster@v1.3.1
+	protoc -I. -Iflow/layers -I$${GOPATH}/pkg/mod/github.com/gogo/protobuf@v1.3.1 -I$${GOPATH}/pkg/mod/github.com/gogo/protobuf@v1.3.1/protobuf \
+		--plugin=$${GOPATH}/bin/protoc-gen-gogofaster \
+		--gogofaster_out plugins=grpc,Mgoogle/protobuf/wrappers.proto=github.com/gogo/protobuf/types:$$GOPATH/src $<
+	gofmt -s -w $@
+
 websocket/structmessage.pb.go: websocket/structmessage.proto
 	$(call PROTOC_GEN,$<)
 
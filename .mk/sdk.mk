@@ -0,0 +1,47 @@
+OPENAPI_GENERATOR_IMAGE?=openapitools/openapi-generator-cli:v4.3.1
+OPENAPI_GENERATOR?=docker run --rm -u $$(id -u):$$(id -g) -v $(CURDIR):/local -w /local $(OPENAPI_GENERATOR_IMAGE)
+SDK_DIR?=sdk
+# SDK packages need a plain x.y.z version, without the commit and tainted suffixes
+SDK_VERSION?=$(firstword $(subst -, ,$(VERSION)))
+SDK_GO_PACKAGE?=skydive
+SDK_PYTHON_PACKAGE?=skydive_sdk
+
+.PHONY: openapi
+openapi: $(SDK_DIR)/openapi.json
+
+$(SDK_DIR)/openapi.json: swagger
+	mkdir -p $(SDK_DIR)
+	tmp=$$(mktemp) && jq '.info.version = "$(SDK_VERSION)"' swagger.json > $$tmp && mv $$tmp $(SDK_DIR)/swagger.json
+	$(OPENAPI_GENERATOR) validate -i $(SDK_DIR)/swagger.json
+	$(OPENAPI_GENERATOR) generate -g openapi -i $(SDK_DIR)/swagger.json -o $(SDK_DIR)/openapi
+	$(OPENAPI_GENERATOR) generate -g openapi-yaml -i $(SDK_DIR)/swagger.json -o $(SDK_DIR)/openapi
+	cp $(SDK_DIR)/openapi/openapi.json $(SDK_DIR)/openapi.json
+	cp $(SDK_DIR)/openapi/openapi/openapi.yaml $(SDK_DIR)/openapi.yaml
+
+.PHONY: sdk.go
+sdk.go: $(SDK_DIR)/openapi.json
+	rm -rf $(SDK_DIR)/go
+	$(OPENAPI_GENERATOR) generate -g go -i $(SDK_DIR)/openapi.json -o $(SDK_DIR)/go \
+		--git-user-id skydive-project --git-repo-id skydive-sdk-go \
+		--additional-properties packageName=$(SDK_GO_PACKAGE),packageVersion=$(SDK_VERSION),enumClassPrefix=true
+
+.PHONY: sdk.python
+sdk.python: $(SDK_DIR)/openapi.json
+	rm -rf $(SDK_DIR)/python
+	$(OPENAPI_GENERATOR) generate -g python -i $(SDK_DIR)/openapi.json -o $(SDK_DIR)/python \
+		--git-user-id skydive-project --git-repo-id skydive-sdk-python \
+		--additional-properties packageName=$(SDK_PYTHON_PACKAGE),projectName=skydive-sdk,packageVersion=$(SDK_VERSION)
+
+.PHONY: sdk
+sdk: sdk.go sdk.python
+
+.PHONY: sdk.dist
+sdk.dist: sdk
+	mkdir -p ${DESTDIR}
+	tar -czf ${DESTDIR}/skydive-sdk-go-$(SDK_VERSION).tar.gz -C $(SDK_DIR) --transform="s|^go|skydive-sdk-go-$(SDK_VERSION)|" go
+	cd $(SDK_DIR)/python && python3 setup.py sdist -d ${DESTDIR}
+	cp $(SDK_DIR)/openapi.json ${DESTDIR}/skydive-openapi-$(SDK_VERSION).json
+
+.PHONY: sdk.clean
+sdk.clean:
+	rm -rf $(SDK_DIR)
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	api "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/api/types"
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/flow"
@@ -39,6 +40,11 @@ import (
 	"github.com/skydive-project/skydive/packetinjector"
 	"github.com/skydive-project/skydive/probe"
 	"github.com/skydive-project/skydive/topology"
+	"github.com/skydive-project/skydive/topology/probes/conntrack"
+	"github.com/skydive-project/skydive/topology/probes/firewall"
+	"github.com/skydive-project/skydive/topology/probes/netlink"
+	"github.com/skydive-project/skydive/topology/probes/socketinfo"
+	"github.com/skydive-project/skydive/tracing"
 	"github.com/skydive-project/skydive/ui"
 	"github.com/skydive-project/skydive/websocket"
 	ws "github.com/skydive-project/skydive/websocket"
@@ -50,6 +56,7 @@ type Agent struct {
 	pod                 *pod.Pod
 	graph               *graph.Graph
 	analyzerClientPool  *ws.StructClientPool
+	balancer            *analyzerBalancer
 	rootNode            *graph.Node
 	topologyProbeBundle *probe.Bundle
 	flowProbeBundle     *probe.Bundle
@@ -59,6 +66,7 @@ type Agent struct {
 	onDemandPIServer    *server.OnDemandServer
 	httpServer          *shttp.Server
 	tidMapper           *topology.TIDMapper
+	throttler           *resourceThrottler
 }
 
 // NewAnalyzerStructClientPool creates a new http WebSocket client Pool
@@ -98,6 +106,9 @@ type Status struct {
 	Analyzers      map[string]pod.ConnStatus
 	TopologyProbes map[string]interface{}
 	FlowProbes     []string
+	Health         *types.AgentHealth
+	// health and load of the connected analyzers by host
+	AnalyzersState map[string]AnalyzerState
 }
 
 // GetStatus returns the status of an agent
@@ -109,6 +120,8 @@ func (a *Agent) GetStatus() interface{} {
 		Analyzers:      podStatus.Hubs,
 		TopologyProbes: a.topologyProbeBundle.GetStatus(),
 		FlowProbes:     a.flowProbeBundle.EnabledProbes(),
+		Health:         a.GetHealth(),
+		AnalyzersState: a.balancer.GetStatus(),
 	}
 }
 
@@ -127,13 +140,17 @@ func (a *Agent) Start() {
 
 	// everything is ready, then initiate the websocket connection
 	go a.analyzerClientPool.ConnectAll()
+	a.balancer.Start()
+	a.throttler.Start()
 }
 
 // Stop agent services
 func (a *Agent) Stop() {
+	a.throttler.Stop()
 	a.onDemandPIServer.Stop()
 	a.onDemandProbeServer.Stop()
 	a.flowProbeBundle.Stop()
+	a.balancer.Stop()
 	a.analyzerClientPool.Stop()
 	a.topologyProbeBundle.Stop()
 	a.httpServer.Stop()
@@ -146,6 +163,8 @@ func (a *Agent) Stop() {
 	}
 
 	a.tidMapper.Stop()
+
+	tracing.Shutdown()
 }
 
 // NewAgent instantiates a new Agent aiming to launch probes (topology and flow)
@@ -158,6 +177,10 @@ func NewAgent() (*Agent, error) {
 	hostID := config.GetString("host_id")
 	service := common.Service{ID: hostID, Type: common.AgentService}
 
+	if err := config.InitTracing(service); err != nil {
+		return nil, err
+	}
+
 	g := graph.NewGraph(hostID, backend, service.Type)
 
 	tm := topology.NewTIDMapper(g)
@@ -191,6 +214,7 @@ func NewAgent() (*Agent, error) {
 	tr.AddTraversalExtension(ge.NewSocketsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewDescendantsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewNextHopTraversalExtension())
+	tr.AddTraversalExtension(ge.NewNeighborConflictsTraversalExtension())
 
 	rootNode, err := createRootNode(g)
 	if err != nil {
@@ -217,12 +241,14 @@ func NewAgent() (*Agent, error) {
 
 	opts := pod.Opts{
 		ServerOpts: websocket.ServerOpts{
-			WriteCompression: true,
+			Compression:      config.GetBool("http.ws.enable_compression"),
+			WriteCompression: config.GetBool("http.ws.enable_write_compression"),
 			QueueSize:        10000,
 			PingDelay:        2 * time.Second,
 			PongTimeout:      5 * time.Second,
 		},
-		Validator: validator,
+		Validator:     validator,
+		ReplayLogSize: config.GetInt("http.ws.replay_log_size"),
 	}
 
 	pod, err := pod.NewPod(apiServer, analyzerClientPool, g, apiAuthBackend, clusterAuthOptions, tr, opts)
@@ -239,7 +265,23 @@ func NewAgent() (*Agent, error) {
 	expireAfter := time.Duration(config.GetInt("flow.expire")) * time.Second
 
 	flowClientPool := client.NewFlowClientPool(analyzerClientPool, clusterAuthOptions)
-	flowTableAllocator := flow.NewTableAllocator(updateEvery, expireAfter, flowClientPool)
+
+	var flowSender flow.Sender = flowClientPool
+	if topologyProbeBundle.GetHandler("firewall") != nil {
+		flowSender = firewall.NewFlowAnnotator(g, flowSender)
+	}
+	if conntrackProbe, ok := topologyProbeBundle.GetHandler("conntrack").(*conntrack.Probe); ok {
+		flowSender = conntrackProbe.NewFlowAnnotator(flowSender)
+	}
+	if socketInfoProbe, ok := topologyProbeBundle.GetHandler("socketinfo").(*socketinfo.ProbeHandler); ok {
+		flowSender = socketInfoProbe.NewFlowAnnotator(flowSender)
+	}
+	if topologyProbeBundle.GetHandler("netlink") != nil {
+		flowSender = netlink.NewMemberCorrelator(g, flowSender)
+		flowSender = netlink.NewDHCPAnnotator(g, flowSender)
+		flowSender = netlink.NewMTUAnalyzer(g, flowSender)
+	}
+	flowTableAllocator := flow.NewTableAllocator(updateEvery, expireAfter, flowSender)
 
 	// exposes a flow server through the client connections
 	flow.NewWSTableServer(flowTableAllocator, analyzerClientPool)
@@ -271,7 +313,31 @@ func NewAgent() (*Agent, error) {
 		tidMapper:           tm,
 	}
 
+	// the analyzers aggregate the health of the agents in their status
+	analyzerClientPool.AddStructMessageHandler(agent, []string{types.HealthNamespace})
+
+	// clustered analyzers send their members so that the topology is
+	// forwarded to the one owning this agent
+	placement := newClusterPlacement(hostID, pod.Forwarder().Reelect)
+	analyzerClientPool.AddStructMessageHandler(placement, []string{types.ClusterNamespace})
+
+	agent.balancer = newAnalyzerBalancer(analyzerClientPool, placement, pod.Forwarder().Reelect,
+		time.Duration(config.GetInt("agent.failover.check_interval"))*time.Second,
+		time.Duration(config.GetInt("agent.failover.rebalance_interval"))*time.Second,
+		config.GetConfig().GetFloat64("agent.failover.rebalance_ratio"),
+		config.GetInt("agent.failover.max_failures"),
+		config.GetConfig().GetFloat64("agent.failover.max_cpu"))
+	pod.Forwarder().SetMasterSelector(agent.balancer.selectAnalyzer)
+
+	agent.throttler = newResourceThrottler(flowTableAllocator, topologyProbeBundle,
+		config.GetStringSlice("agent.resources.low_priority_probes"),
+		uint64(config.GetInt("agent.resources.max_rss"))*mb,
+		config.GetConfig().GetFloat64("agent.resources.max_cpu"),
+		time.Duration(config.GetInt("agent.resources.check_interval"))*time.Second)
+
 	api.RegisterStatusAPI(hserver, agent, apiAuthBackend)
+	api.RegisterDiagnosticsAPI(hserver, service, agent, apiAuthBackend)
+	api.RegisterLoggingAPI(hserver, apiAuthBackend)
 
 	return agent, nil
 }
@@ -0,0 +1,302 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package agent
+
+import (
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// loadRequestTimeout is the time an analyzer has to report its load
+const loadRequestTimeout = 2 * time.Second
+
+// AnalyzerState describes the health of an analyzer, as checked by the
+// agent, and the load it reported
+// swagger:model
+type AnalyzerState struct {
+	// Whether the analyzer answered the last checks
+	Healthy bool
+	// Number of consecutive failed checks
+	Failures int
+	// Load reported by the analyzer
+	Load *types.AnalyzerLoad `json:",omitempty"`
+	// Time of the last check
+	LastCheck time.Time
+}
+
+// analyzerBalancer elects the analyzer the topology is forwarded to. The
+// analyzers are periodically requested for their load, the ones failing
+// to answer being avoided. The agent sticks to its analyzer until it fails,
+// except when rebalancing, where it moves to a less loaded one.
+type analyzerBalancer struct {
+	sync.RWMutex
+	ws.DefaultSpeakerEventHandler
+	pool              *ws.StructClientPool
+	states            map[string]*AnalyzerState
+	placement         *clusterPlacement
+	reelect           func()
+	checkInterval     time.Duration
+	rebalanceInterval time.Duration
+	rebalanceRatio    float64
+	maxFailures       int
+	maxCPU            float64
+	rebalancing       int32
+	quit              chan bool
+	wg                sync.WaitGroup
+}
+
+func (b *analyzerBalancer) checkAnalyzer(speaker ws.Speaker) (*types.AnalyzerLoad, error) {
+	msg := ws.NewStructMessage(types.LoadNamespace, "LoadRequest", nil)
+
+	resp, err := speaker.(*ws.StructSpeaker).Request(msg, loadRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var load types.AnalyzerLoad
+	if err := json.Unmarshal(resp.Obj, &load); err != nil {
+		return nil, err
+	}
+
+	return &load, nil
+}
+
+// check requests the connected analyzers for their load, an analyzer
+// failing too many consecutive checks being considered as unhealthy
+func (b *analyzerBalancer) check() {
+	var wg sync.WaitGroup
+	for _, speaker := range b.pool.GetSpeakers() {
+		if !speaker.IsConnected() {
+			continue
+		}
+
+		wg.Add(1)
+		go func(speaker ws.Speaker) {
+			defer wg.Done()
+
+			load, err := b.checkAnalyzer(speaker)
+
+			host := speaker.GetRemoteHost()
+
+			b.Lock()
+			state, found := b.states[host]
+			if !found {
+				state = &AnalyzerState{}
+				b.states[host] = state
+			}
+			state.LastCheck = time.Now()
+
+			if err == nil {
+				state.Healthy, state.Failures, state.Load = true, 0, load
+			} else {
+				state.Failures++
+				if state.Healthy && state.Failures >= b.maxFailures {
+					logging.GetLogger().Warningf("Analyzer %s failed %d checks: %s", host, state.Failures, err)
+				}
+				state.Healthy = state.Failures < b.maxFailures
+			}
+			b.Unlock()
+		}(speaker)
+	}
+	wg.Wait()
+
+	b.reelect()
+}
+
+// rebalance elects the analyzer again, the agent moving to a less loaded
+// analyzer if its own one is too loaded
+func (b *analyzerBalancer) rebalance() {
+	atomic.StoreInt32(&b.rebalancing, 1)
+	b.reelect()
+	atomic.StoreInt32(&b.rebalancing, 0)
+}
+
+// available returns the connected and healthy analyzers which are not
+// overloaded. If there is none, the healthy ones, or else all the
+// connected ones, are returned.
+func (b *analyzerBalancer) available(pool ws.SpeakerPool) []ws.Speaker {
+	b.RLock()
+	defer b.RUnlock()
+
+	var connected, healthy, available []ws.Speaker
+	for _, speaker := range pool.GetSpeakers() {
+		if !speaker.IsConnected() {
+			continue
+		}
+		connected = append(connected, speaker)
+
+		// not checked yet
+		state, found := b.states[speaker.GetRemoteHost()]
+		if !found {
+			healthy = append(healthy, speaker)
+			available = append(available, speaker)
+			continue
+		}
+
+		if state.Healthy {
+			healthy = append(healthy, speaker)
+			if state.Load == nil || state.Load.CPU < b.maxCPU {
+				available = append(available, speaker)
+			}
+		}
+	}
+
+	if len(available) > 0 {
+		return available
+	}
+	if len(healthy) > 0 {
+		return healthy
+	}
+	return connected
+}
+
+func (b *analyzerBalancer) agents(speaker ws.Speaker) int {
+	if state, found := b.states[speaker.GetRemoteHost()]; found && state.Load != nil {
+		return state.Load.Agents
+	}
+	return 0
+}
+
+// selectAnalyzer elects the analyzer owning the agent if the analyzers are
+// clustered. Otherwise the current analyzer is kept while available, the
+// least loaded one being elected when it fails or when rebalancing.
+func (b *analyzerBalancer) selectAnalyzer(pool ws.SpeakerPool, master ws.Speaker) ws.Speaker {
+	available := b.available(pool)
+	if len(available) == 0 {
+		return nil
+	}
+
+	if b.placement != nil {
+		if owner := b.placement.owner(available); owner != nil {
+			return owner
+		}
+	}
+
+	b.RLock()
+	defer b.RUnlock()
+
+	least := available[rand.Intn(len(available))]
+	for _, speaker := range available {
+		if b.agents(speaker) < b.agents(least) {
+			least = speaker
+		}
+	}
+
+	for _, speaker := range available {
+		if speaker != master {
+			continue
+		}
+
+		if atomic.LoadInt32(&b.rebalancing) == 0 {
+			return master
+		}
+
+		// the agent is counted by its analyzer, moving only if it reduces
+		// the imbalance
+		current, target := b.agents(master), b.agents(least)
+		if current-target >= 2 && float64(current) > float64(target)*b.rebalanceRatio {
+			logging.GetLogger().Infof("Rebalancing from analyzer %s (%d agents) to %s (%d agents)",
+				master.GetRemoteHost(), current, least.GetRemoteHost(), target)
+			return least
+		}
+		return master
+	}
+
+	return least
+}
+
+// OnDisconnected forgets the state of the analyzer, checked again once
+// reconnected
+func (b *analyzerBalancer) OnDisconnected(c ws.Speaker) {
+	b.Lock()
+	delete(b.states, c.GetRemoteHost())
+	b.Unlock()
+}
+
+// GetStatus returns the states of the analyzers by host
+func (b *analyzerBalancer) GetStatus() map[string]AnalyzerState {
+	b.RLock()
+	defer b.RUnlock()
+
+	states := make(map[string]AnalyzerState)
+	for host, state := range b.states {
+		states[host] = *state
+	}
+	return states
+}
+
+func (b *analyzerBalancer) Start() {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+
+		check := time.NewTicker(b.checkInterval)
+		defer check.Stop()
+
+		// the agents connected at the same time do not rebalance together
+		var rebalance <-chan time.Time
+		if b.rebalanceInterval > 0 {
+			jitter := time.Duration(rand.Int63n(int64(b.rebalanceInterval) / 2))
+			ticker := time.NewTicker(b.rebalanceInterval + jitter)
+			defer ticker.Stop()
+			rebalance = ticker.C
+		}
+
+		for {
+			select {
+			case <-check.C:
+				b.check()
+			case <-rebalance:
+				b.rebalance()
+			case <-b.quit:
+				return
+			}
+		}
+	}()
+}
+
+func (b *analyzerBalancer) Stop() {
+	b.quit <- true
+	b.wg.Wait()
+}
+
+func newAnalyzerBalancer(pool *ws.StructClientPool, placement *clusterPlacement, reelect func(), checkInterval, rebalanceInterval time.Duration, rebalanceRatio float64, maxFailures int, maxCPU float64) *analyzerBalancer {
+	b := &analyzerBalancer{
+		pool:              pool,
+		states:            make(map[string]*AnalyzerState),
+		placement:         placement,
+		reelect:           reelect,
+		checkInterval:     checkInterval,
+		rebalanceInterval: rebalanceInterval,
+		rebalanceRatio:    rebalanceRatio,
+		maxFailures:       maxFailures,
+		maxCPU:            maxCPU,
+		quit:              make(chan bool),
+	}
+
+	pool.AddEventHandler(b)
+
+	return b
+}
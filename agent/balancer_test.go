@@ -0,0 +1,205 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package agent
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/api/types"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+type fakeAnalyzer struct {
+	ws.Speaker
+	host      string
+	connected bool
+}
+
+func (a *fakeAnalyzer) GetRemoteHost() string {
+	return a.host
+}
+
+func (a *fakeAnalyzer) IsConnected() bool {
+	return a.connected
+}
+
+type fakeAnalyzerPool struct {
+	ws.SpeakerPool
+	analyzers []ws.Speaker
+}
+
+func (p *fakeAnalyzerPool) GetSpeakers() []ws.Speaker {
+	return p.analyzers
+}
+
+func newTestBalancer(hosts ...string) (*analyzerBalancer, *fakeAnalyzerPool, map[string]*fakeAnalyzer) {
+	pool := &fakeAnalyzerPool{}
+	analyzers := make(map[string]*fakeAnalyzer)
+	for _, host := range hosts {
+		analyzer := &fakeAnalyzer{host: host, connected: true}
+		analyzers[host] = analyzer
+		pool.analyzers = append(pool.analyzers, analyzer)
+	}
+
+	b := &analyzerBalancer{
+		states:         make(map[string]*AnalyzerState),
+		reelect:        func() {},
+		rebalanceRatio: 1.5,
+		maxFailures:    3,
+		maxCPU:         90,
+	}
+	return b, pool, analyzers
+}
+
+func (b *analyzerBalancer) setState(host string, healthy bool, agents int, cpu float64) {
+	b.states[host] = &AnalyzerState{Healthy: healthy, Load: &types.AnalyzerLoad{Agents: agents, CPU: cpu}}
+}
+
+func hostsOf(speakers []ws.Speaker) map[string]bool {
+	hosts := make(map[string]bool)
+	for _, speaker := range speakers {
+		hosts[speaker.GetRemoteHost()] = true
+	}
+	return hosts
+}
+
+func TestBalancerAvailable(t *testing.T) {
+	b, pool, analyzers := newTestBalancer("a1", "a2", "a3", "a4")
+
+	analyzers["a4"].connected = false
+	b.setState("a2", false, 1, 10)
+	b.setState("a3", true, 1, 95)
+
+	// a1 is not checked yet, a2 is unhealthy and a3 overloaded
+	if hosts := hostsOf(b.available(pool)); len(hosts) != 1 || !hosts["a1"] {
+		t.Errorf("Only a1 should be available, got %v", hosts)
+	}
+
+	b.setState("a1", true, 1, 99)
+	if hosts := hostsOf(b.available(pool)); len(hosts) != 2 || !hosts["a1"] || !hosts["a3"] {
+		t.Errorf("The overloaded analyzers should be used when they are all overloaded, got %v", hosts)
+	}
+
+	b.setState("a1", false, 1, 10)
+	b.setState("a3", false, 1, 10)
+	if hosts := hostsOf(b.available(pool)); len(hosts) != 3 || hosts["a4"] {
+		t.Errorf("The connected analyzers should be used when they are all unhealthy, got %v", hosts)
+	}
+
+	analyzers["a1"].connected, analyzers["a2"].connected, analyzers["a3"].connected = false, false, false
+	if speakers := b.available(pool); len(speakers) != 0 {
+		t.Errorf("No analyzer should be available, got %v", hostsOf(speakers))
+	}
+}
+
+func TestBalancerFailover(t *testing.T) {
+	b, pool, analyzers := newTestBalancer("a1", "a2", "a3")
+
+	b.setState("a1", true, 10, 10)
+	b.setState("a2", true, 5, 10)
+	b.setState("a3", true, 2, 10)
+
+	if master := b.selectAnalyzer(pool, nil); master != analyzers["a3"] {
+		t.Errorf("The least loaded analyzer should be elected, got %s", master.GetRemoteHost())
+	}
+
+	// the agent sticks to its analyzer while it is available
+	if master := b.selectAnalyzer(pool, analyzers["a1"]); master != analyzers["a1"] {
+		t.Errorf("The current analyzer should be kept, got %s", master.GetRemoteHost())
+	}
+
+	b.states["a1"].Healthy = false
+	if master := b.selectAnalyzer(pool, analyzers["a1"]); master != analyzers["a3"] {
+		t.Errorf("The agent should fail over to the least loaded analyzer, got %s", master.GetRemoteHost())
+	}
+
+	b.states["a1"].Healthy = true
+	b.states["a1"].Load.CPU = 95
+	if master := b.selectAnalyzer(pool, analyzers["a1"]); master != analyzers["a3"] {
+		t.Errorf("The agent should leave an overloaded analyzer, got %s", master.GetRemoteHost())
+	}
+
+	b.OnDisconnected(analyzers["a1"])
+	if _, found := b.GetStatus()["a1"]; found {
+		t.Error("The state of a disconnected analyzer should be forgotten")
+	}
+}
+
+func TestBalancerRebalance(t *testing.T) {
+	b, pool, analyzers := newTestBalancer("a1", "a2")
+
+	tests := []struct {
+		current, target int
+		moves           bool
+	}{
+		{current: 10, target: 2, moves: true},
+		{current: 3, target: 2, moves: false},
+		{current: 12, target: 10, moves: false},
+		{current: 4, target: 0, moves: true},
+	}
+
+	for _, test := range tests {
+		b.setState("a1", true, test.current, 10)
+		b.setState("a2", true, test.target, 10)
+
+		if master := b.selectAnalyzer(pool, analyzers["a1"]); master != analyzers["a1"] {
+			t.Errorf("%d/%d: the agent should only move when rebalancing", test.current, test.target)
+		}
+
+		b.rebalancing = 1
+		master := b.selectAnalyzer(pool, analyzers["a1"])
+		b.rebalancing = 0
+
+		if moved := master == analyzers["a2"]; moved != test.moves {
+			t.Errorf("%d/%d: expected the agent to move: %v, got %s", test.current, test.target, test.moves, master.GetRemoteHost())
+		}
+	}
+}
+
+func TestBalancerPlacement(t *testing.T) {
+	b, pool, analyzers := newTestBalancer("a1", "a2", "a3")
+
+	members := &types.ClusterMembers{Members: []string{"a1", "a2", "a3"}, Replicas: 10}
+	b.placement = &clusterPlacement{host: "agent1", members: members, reelect: func() {}}
+
+	owner := members.Owner("agent1", []string{"a1", "a2", "a3"})
+	for host := range analyzers {
+		loaded := 1
+		if host == owner {
+			loaded = 100
+		}
+		b.setState(host, true, loaded, 10)
+	}
+
+	// the owner is elected whatever its load
+	if master := b.selectAnalyzer(pool, nil); master.GetRemoteHost() != owner {
+		t.Errorf("The owner %s should be elected, got %s", owner, master.GetRemoteHost())
+	}
+
+	var others []string
+	for host := range analyzers {
+		if host != owner {
+			others = append(others, host)
+		}
+	}
+
+	b.states[owner].Healthy = false
+	if master, next := b.selectAnalyzer(pool, nil), members.Owner("agent1", others); master.GetRemoteHost() != next {
+		t.Errorf("The next owner %s should be elected when %s fails, got %s", next, owner, master.GetRemoteHost())
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package agent
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// clusterPlacement places the agent on the analyzer owning it when the
+// analyzers are clustered. The topology is forwarded to this analyzer
+// instead of the least loaded one.
+type clusterPlacement struct {
+	sync.RWMutex
+	host    string
+	members *types.ClusterMembers
+	reelect func()
+}
+
+// owner returns the analyzer owning the agent among the candidates, nil
+// until the members are known or if the owner is not a candidate
+func (p *clusterPlacement) owner(candidates []ws.Speaker) ws.Speaker {
+	p.RLock()
+	members := p.members
+	p.RUnlock()
+
+	if members == nil {
+		return nil
+	}
+
+	var hosts []string
+	for _, speaker := range candidates {
+		hosts = append(hosts, speaker.GetRemoteHost())
+	}
+
+	owner := members.Owner(p.host, hosts)
+	for _, speaker := range candidates {
+		if speaker.GetRemoteHost() == owner {
+			return speaker
+		}
+	}
+
+	return nil
+}
+
+// OnStructMessage handles the members sent by the analyzers, the analyzer
+// owning the agent being elected again when they changed
+func (p *clusterPlacement) OnStructMessage(c ws.Speaker, msg *ws.StructMessage) {
+	if msg.Type != "Members" {
+		return
+	}
+
+	var members types.ClusterMembers
+	if err := json.Unmarshal(msg.Obj, &members); err != nil {
+		logging.GetLogger().Errorf("Unable to decode cluster members from %s: %s", c.GetRemoteHost(), err)
+		return
+	}
+
+	p.Lock()
+	if p.members != nil && reflect.DeepEqual(*p.members, members) {
+		p.Unlock()
+		return
+	}
+	p.members = &members
+	p.Unlock()
+
+	logging.GetLogger().Infof("Analyzers of the cluster: %v", members.Members)
+
+	p.reelect()
+}
+
+func newClusterPlacement(host string, reelect func()) *clusterPlacement {
+	return &clusterPlacement{host: host, reelect: reelect}
+}
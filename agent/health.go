@@ -0,0 +1,135 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package agent
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/flow/probes"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/probe"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// saturationRatio is the occupancy of the flow tables and of their packet
+// queues above which an issue is reported
+const saturationRatio = 0.9
+
+func (a *Agent) capturesHealth() (captures []*types.CaptureHealth) {
+	a.graph.RLock()
+	defer a.graph.RUnlock()
+
+	for _, node := range a.graph.GetNodes(graph.Metadata{}) {
+		metadata, ok := node.Metadata["Captures"].(*probes.Captures)
+		if !ok {
+			continue
+		}
+
+		tid, _ := node.GetFieldString("TID")
+		name, _ := node.GetFieldString("Name")
+		for _, capture := range *metadata {
+			captures = append(captures, &types.CaptureHealth{
+				ID:               capture.ID,
+				NodeTID:          tid,
+				NodeName:         name,
+				Type:             capture.Type,
+				State:            capture.State,
+				Error:            capture.Error,
+				PacketsReceived:  capture.PacketsReceived,
+				PacketsDropped:   capture.PacketsDropped,
+				PacketsIfDropped: capture.PacketsIfDropped,
+			})
+		}
+	}
+
+	return
+}
+
+// GetHealth returns the health of the agent. Issues are reported for the
+// lost analyzer connections, the probes not running, the captures in
+// error, the throttling of the agent and the flow tables that dropped
+// packets or are saturated
+func (a *Agent) GetHealth() *types.AgentHealth {
+	health := &types.AgentHealth{
+		Healthy:  true,
+		Time:     time.Now(),
+		Probes:   a.topologyProbeBundle.GetStatus(),
+		Captures: a.capturesHealth(),
+	}
+
+	hubs := a.pod.GetStatus().Hubs
+	for _, hub := range hubs {
+		if hub.State != nil && hub.State.Load() == common.RunningState {
+			health.ConnectedAnalyzers++
+		}
+	}
+	if len(hubs) > 0 && health.ConnectedAnalyzers == 0 {
+		health.AddIssue("Not connected to any analyzer")
+	}
+
+	for name, status := range health.Probes {
+		if a.throttler.IsPaused(name) {
+			continue
+		}
+		if status, ok := status.(*probe.ServiceStatus); ok && status.Status != common.RunningState {
+			health.AddIssue("Probe %s is not running", name)
+		}
+	}
+
+	for _, capture := range health.Captures {
+		if capture.Error != "" {
+			health.AddIssue("Capture %s on %s failed: %s", capture.ID, capture.NodeName, capture.Error)
+		}
+	}
+
+	if throttling := a.throttler.GetStatus(); throttling.Level > 0 {
+		health.Throttling = throttling
+		health.AddIssue("Agent throttled to level %d, packets sampled at 1/%d", throttling.Level, throttling.SamplingRate)
+	}
+
+	health.FlowTables = a.flowTableAllocator.Status()
+	for _, table := range health.FlowTables {
+		stats := table.Stats
+		if dropped := stats.PacketsDropped + stats.PacketsThrottled; dropped > 0 {
+			health.AddIssue("Flow table of capture %s dropped %d packets", table.CaptureID, dropped)
+		}
+		if dropped := stats.FlowDropped + stats.KernelFlowDropped; dropped > 0 {
+			health.AddIssue("Flow table of capture %s dropped %d flows", table.CaptureID, dropped)
+		}
+		if table.MaxFlows > 0 && float64(stats.FlowCount) >= saturationRatio*float64(table.MaxFlows) {
+			health.AddIssue("Flow table of capture %s is full, %d flows out of %d", table.CaptureID, stats.FlowCount, table.MaxFlows)
+		}
+		if table.QueueCapacity > 0 && float64(table.QueueLength) >= saturationRatio*float64(table.QueueCapacity) {
+			health.AddIssue("Packet queue of capture %s is full, %d packets out of %d", table.CaptureID, table.QueueLength, table.QueueCapacity)
+		}
+	}
+
+	return health
+}
+
+// OnStructMessage replies to the health requests of the analyzers
+func (a *Agent) OnStructMessage(c ws.Speaker, msg *ws.StructMessage) {
+	if msg.Type != "HealthRequest" {
+		return
+	}
+
+	c.SendMessage(msg.Reply(a.GetHealth(), "HealthReply", http.StatusOK))
+}
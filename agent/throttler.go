@@ -0,0 +1,250 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package agent
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/process"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/probe"
+)
+
+const (
+	// maxThrottleLevel is the highest degradation level, where the packets
+	// are sampled at 1/8 and the flows sent 8 times less often
+	maxThrottleLevel = 3
+
+	// pauseThrottleLevel is the level from which the low priority probes
+	// are paused
+	pauseThrottleLevel = 2
+
+	mb = 1024 * 1024
+
+	// recoverRatio is the ratio of the budgets below which the level is
+	// lowered, so that the agent does not oscillate around the budgets
+	recoverRatio = 0.8
+)
+
+// resourceThrottler checks the memory and the CPU used by the agent against
+// its budgets. Each check exceeding a budget raises the degradation level,
+// each check below the budgets by a margin lowers it. The flow tables sample
+// the packets and send the flows less often as the level rises, and the low
+// priority topology probes are paused from the second level.
+type resourceThrottler struct {
+	sync.RWMutex
+	usage             func() (uint64, float64, error)
+	allocator         *flow.TableAllocator
+	probes            *probe.Bundle
+	lowPriorityProbes []string
+	maxRSS            uint64
+	maxCPU            float64
+	interval          time.Duration
+	level             int
+	rss               uint64
+	cpu               float64
+	reasons           []string
+	paused            []string
+	quit              chan bool
+	wg                sync.WaitGroup
+}
+
+// processUsage returns the resident memory of the agent and its CPU usage
+// since the previous call, in percent of the host CPUs
+func processUsage() func() (uint64, float64, error) {
+	var p *process.Process
+	return func() (uint64, float64, error) {
+		if p == nil {
+			var err error
+			if p, err = process.NewProcess(int32(os.Getpid())); err != nil {
+				return 0, 0, err
+			}
+		}
+
+		memory, err := p.MemoryInfo()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		cpu, err := p.Percent(0)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		return memory.RSS, cpu / float64(runtime.NumCPU()), nil
+	}
+}
+
+func (t *resourceThrottler) check() {
+	rss, cpu, err := t.usage()
+	if err != nil {
+		logging.GetLogger().Errorf("Unable to retrieve the resources used by the agent: %s", err)
+		return
+	}
+
+	var reasons []string
+	if t.maxRSS > 0 && rss > t.maxRSS {
+		reasons = append(reasons, fmt.Sprintf("memory usage of %d MB above %d MB", rss/mb, t.maxRSS/mb))
+	}
+	if t.maxCPU > 0 && cpu > t.maxCPU {
+		reasons = append(reasons, fmt.Sprintf("CPU usage of %.1f%% above %.1f%%", cpu, t.maxCPU))
+	}
+
+	recovered := (t.maxRSS == 0 || float64(rss) < recoverRatio*float64(t.maxRSS)) &&
+		(t.maxCPU == 0 || cpu < recoverRatio*t.maxCPU)
+
+	level := t.level
+	if len(reasons) > 0 && level < maxThrottleLevel {
+		level++
+	} else if recovered && level > 0 {
+		level--
+	}
+
+	t.Lock()
+	t.rss, t.cpu, t.reasons = rss, cpu, reasons
+	t.Unlock()
+
+	if level != t.level {
+		t.apply(level)
+	}
+}
+
+// apply sets the degradation level, the throttling of the flow tables and
+// the state of the low priority probes
+func (t *resourceThrottler) apply(level int) {
+	if level > t.level {
+		logging.GetLogger().Warningf("Agent throttled to level %d: %v", level, t.reasons)
+	} else {
+		logging.GetLogger().Infof("Agent throttled to level %d", level)
+	}
+
+	factor := int64(1) << uint(level)
+	t.allocator.SetThrottling(flow.Throttling{SamplingRate: factor, UpdateFactor: factor})
+
+	var paused []string
+	for _, name := range t.lowPriorityProbes {
+		handler := t.probes.GetHandler(name)
+		if handler == nil {
+			continue
+		}
+
+		switch {
+		case level >= pauseThrottleLevel && t.level < pauseThrottleLevel:
+			logging.GetLogger().Infof("Pausing probe %s", name)
+			handler.Stop()
+		case level < pauseThrottleLevel && t.level >= pauseThrottleLevel:
+			logging.GetLogger().Infof("Resuming probe %s", name)
+			if err := handler.Start(); err != nil {
+				logging.GetLogger().Errorf("Unable to resume probe %s: %s", name, err)
+			}
+		}
+
+		if level >= pauseThrottleLevel {
+			paused = append(paused, name)
+		}
+	}
+
+	t.Lock()
+	t.level, t.paused = level, paused
+	t.Unlock()
+}
+
+// IsPaused returns whether a probe was paused by the throttling
+func (t *resourceThrottler) IsPaused(name string) bool {
+	t.RLock()
+	defer t.RUnlock()
+
+	for _, paused := range t.paused {
+		if paused == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GetStatus returns the resources used by the agent and its degradation
+func (t *resourceThrottler) GetStatus() *types.AgentThrottling {
+	t.RLock()
+	defer t.RUnlock()
+
+	factor := int64(1) << uint(t.level)
+	return &types.AgentThrottling{
+		Level:        t.level,
+		Reasons:      t.reasons,
+		RSS:          t.rss,
+		CPU:          t.cpu,
+		SamplingRate: factor,
+		UpdateFactor: factor,
+		PausedProbes: t.paused,
+	}
+}
+
+func (t *resourceThrottler) Start() {
+	if t.maxRSS == 0 && t.maxCPU == 0 {
+		return
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		// first measure, the CPU usage being computed between two calls
+		t.usage()
+
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				t.check()
+			case <-t.quit:
+				return
+			}
+		}
+	}()
+}
+
+func (t *resourceThrottler) Stop() {
+	if t.maxRSS == 0 && t.maxCPU == 0 {
+		return
+	}
+
+	t.quit <- true
+	t.wg.Wait()
+}
+
+func newResourceThrottler(allocator *flow.TableAllocator, probes *probe.Bundle, lowPriorityProbes []string, maxRSS uint64, maxCPU float64, interval time.Duration) *resourceThrottler {
+	return &resourceThrottler{
+		usage:             processUsage(),
+		allocator:         allocator,
+		probes:            probes,
+		lowPriorityProbes: lowPriorityProbes,
+		maxRSS:            maxRSS,
+		maxCPU:            maxCPU,
+		interval:          interval,
+		quit:              make(chan bool),
+	}
+}
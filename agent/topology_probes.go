@@ -28,7 +28,12 @@ import (
 	"github.com/skydive-project/skydive/probe"
 	tp "github.com/skydive-project/skydive/topology/probes"
 	"github.com/skydive-project/skydive/topology/probes/bess"
+	"github.com/skydive-project/skydive/topology/probes/bgp"
+	"github.com/skydive-project/skydive/topology/probes/cilium"
+	"github.com/skydive-project/skydive/topology/probes/conntrack"
+	"github.com/skydive-project/skydive/topology/probes/cri"
 	"github.com/skydive-project/skydive/topology/probes/docker"
+	"github.com/skydive-project/skydive/topology/probes/firewall"
 	"github.com/skydive-project/skydive/topology/probes/libvirt"
 	"github.com/skydive-project/skydive/topology/probes/lldp"
 	"github.com/skydive-project/skydive/topology/probes/lxd"
@@ -54,6 +59,10 @@ func registerStaticProbes() {
 	runc.Register()
 	libvirt.Register()
 	ovn.Register()
+	bgp.Register()
+	cilium.Register()
+	cri.Register()
+	firewall.Register()
 }
 
 // NewTopologyProbe creates a new topology probe
@@ -69,6 +78,8 @@ func NewTopologyProbe(name string, ctx tp.Context, bundle *probe.Bundle) (probe.
 		return lxd.NewProbe(ctx, bundle)
 	case "docker":
 		return docker.NewProbe(ctx, bundle)
+	case "podman":
+		return docker.NewPodmanProbe(ctx, bundle)
 	case "lldp":
 		return lldp.NewProbe(ctx, bundle)
 	case "neutron":
@@ -85,6 +96,18 @@ func NewTopologyProbe(name string, ctx tp.Context, bundle *probe.Bundle) (probe.
 		return vpp.NewProbe(ctx, bundle)
 	case "bess":
 		return bess.NewProbe(ctx, bundle)
+	case "bgp":
+		return bgp.NewProbe(ctx, bundle)
+	case "cilium":
+		return cilium.NewProbe(ctx, bundle)
+	case "containerd":
+		return cri.NewContainerdProbe(ctx, bundle)
+	case "crio":
+		return cri.NewCRIOProbe(ctx, bundle)
+	case "firewall":
+		return firewall.NewProbe(ctx, bundle)
+	case "conntrack":
+		return conntrack.NewProbe(ctx, bundle)
 	default:
 		return nil, fmt.Errorf("unsupported probe %s", name)
 	}
@@ -0,0 +1,211 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+)
+
+const defaultSensitivity = 3
+
+// baseline models the normal traffic of the flows returned by an alert
+// expression. It is kept in memory and learnt again when the analyzer restarts.
+type baseline struct {
+	*types.AlertAnomaly
+	training time.Duration
+	start    time.Time
+	samples  int64
+	mean     float64
+	m2       float64
+	peers    map[string]bool
+	ports    map[int64]bool
+}
+
+// AnomalyReason is the reason data of a triggered anomaly alert
+type AnomalyReason struct {
+	Volume   float64  `json:",omitempty"`
+	Mean     float64  `json:",omitempty"`
+	StdDev   float64  `json:",omitempty"`
+	NewPeers []string `json:",omitempty"`
+	NewPorts []int64  `json:",omitempty"`
+}
+
+// observation summarizes the flows of an evaluation
+type observation struct {
+	volume float64
+	peers  map[string]bool
+	ports  map[int64]bool
+}
+
+func newBaseline(a *types.AlertAnomaly) (*baseline, error) {
+	training, err := time.ParseDuration(a.Training)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid training window: %s", err)
+	}
+
+	return &baseline{
+		AlertAnomaly: a,
+		training:     training,
+		peers:        make(map[string]bool),
+		ports:        make(map[int64]bool),
+	}, nil
+}
+
+func lookupNumber(m map[string]interface{}, section, key string) (float64, bool) {
+	if s, ok := m[section].(map[string]interface{}); ok {
+		f, ok := s[key].(float64)
+		return f, ok
+	}
+	return 0, false
+}
+
+func lookupString(m map[string]interface{}, section, key string) (string, bool) {
+	if s, ok := m[section].(map[string]interface{}); ok {
+		str, ok := s[key].(string)
+		return str, ok && str != ""
+	}
+	return "", false
+}
+
+// addFlows adds to the observation the flows found in the JSON representation of a result
+func (o *observation) addFlows(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if _, ok := v["Network"]; !ok {
+			if _, ok := v["LastUpdateMetric"]; !ok {
+				for _, value := range v {
+					o.addFlows(value)
+				}
+				return
+			}
+		}
+
+		for _, key := range []string{"ABBytes", "BABytes"} {
+			if bytes, ok := lookupNumber(v, "LastUpdateMetric", key); ok {
+				o.volume += bytes
+			}
+		}
+		for _, key := range []string{"A", "B"} {
+			if peer, ok := lookupString(v, "Network", key); ok {
+				o.peers[peer] = true
+			}
+		}
+		// the B side of a flow is the one that was contacted
+		if port, ok := lookupNumber(v, "Transport", "B"); ok {
+			o.ports[int64(port)] = true
+		}
+	case []interface{}:
+		for _, value := range v {
+			o.addFlows(value)
+		}
+	}
+}
+
+func newObservation(data interface{}) *observation {
+	o := &observation{peers: make(map[string]bool), ports: make(map[int64]bool)}
+	if data == nil {
+		return o
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return o
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err == nil {
+		o.addFlows(v)
+	}
+	return o
+}
+
+// learnVolume updates the volume mean and variance using the Welford's algorithm
+func (b *baseline) learnVolume(volume float64) {
+	b.samples++
+	delta := volume - b.mean
+	b.mean += delta / float64(b.samples)
+	b.m2 += delta * (volume - b.mean)
+}
+
+func (b *baseline) stdDev() float64 {
+	if b.samples < 2 {
+		return 0
+	}
+	return math.Sqrt(b.m2 / float64(b.samples-1))
+}
+
+// observe adds the flows of an evaluation to the baseline and returns the
+// reason of the alert if they deviate from it
+func (b *baseline) observe(data interface{}, now time.Time) *AnomalyReason {
+	o := newObservation(data)
+
+	if b.start.IsZero() {
+		b.start = now
+	}
+
+	if now.Sub(b.start) < b.training {
+		b.learnVolume(o.volume)
+		for peer := range o.peers {
+			b.peers[peer] = true
+		}
+		for port := range o.ports {
+			b.ports[port] = true
+		}
+		return nil
+	}
+
+	reason := &AnomalyReason{}
+	for peer := range o.peers {
+		if !b.peers[peer] {
+			reason.NewPeers = append(reason.NewPeers, peer)
+			b.peers[peer] = true
+		}
+	}
+	sort.Strings(reason.NewPeers)
+
+	for port := range o.ports {
+		if !b.ports[port] {
+			reason.NewPorts = append(reason.NewPorts, port)
+			b.ports[port] = true
+		}
+	}
+	sort.Slice(reason.NewPorts, func(i, j int) bool { return reason.NewPorts[i] < reason.NewPorts[j] })
+
+	sensitivity := b.Sensitivity
+	if sensitivity == 0 {
+		sensitivity = defaultSensitivity
+	}
+
+	// spikes are not learnt so that they don't shift the baseline
+	if stdDev := b.stdDev(); stdDev > 0 && (o.volume-b.mean)/stdDev > sensitivity {
+		reason.Volume, reason.Mean, reason.StdDev = o.volume, b.mean, stdDev
+	} else {
+		b.learnVolume(o.volume)
+	}
+
+	if reason.Volume == 0 && len(reason.NewPeers) == 0 && len(reason.NewPorts) == 0 {
+		return nil
+	}
+	return reason
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+)
+
+func TestAnomaly(t *testing.T) {
+	b, err := newBaseline(&types.AlertAnomaly{Training: "10m", Sensitivity: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flow := func(a, b string, port int64, bytes float64) map[string]interface{} {
+		return map[string]interface{}{
+			"Network":          map[string]interface{}{"A": a, "B": b},
+			"Transport":        map[string]interface{}{"A": 45000, "B": port},
+			"LastUpdateMetric": map[string]interface{}{"ABBytes": bytes, "BABytes": bytes},
+		}
+	}
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		data := []interface{}{flow("10.0.0.1", "10.0.0.2", 80, float64(100+i%3))}
+		if reason := b.observe(data, now.Add(time.Duration(i)*time.Minute)); reason != nil {
+			t.Fatalf("No alert expected during training, got %+v", reason)
+		}
+	}
+
+	now = now.Add(10 * time.Minute)
+	if reason := b.observe([]interface{}{flow("10.0.0.1", "10.0.0.2", 80, 101)}, now); reason != nil {
+		t.Fatalf("No alert expected for a known flow, got %+v", reason)
+	}
+
+	reason := b.observe([]interface{}{flow("10.0.0.1", "10.0.0.3", 22, 101)}, now.Add(time.Minute))
+	if reason == nil || !reflect.DeepEqual(reason.NewPeers, []string{"10.0.0.3"}) || !reflect.DeepEqual(reason.NewPorts, []int64{22}) {
+		t.Fatalf("New peer and port expected, got %+v", reason)
+	}
+
+	if reason := b.observe([]interface{}{flow("10.0.0.1", "10.0.0.3", 22, 101)}, now.Add(2*time.Minute)); reason != nil {
+		t.Fatalf("Peer should have been learnt, got %+v", reason)
+	}
+
+	reason = b.observe([]interface{}{flow("10.0.0.1", "10.0.0.2", 80, 10000)}, now.Add(3*time.Minute))
+	if reason == nil || reason.Volume != 20000 {
+		t.Fatalf("Volume spike expected, got %+v", reason)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+)
+
+// maxBacktestEvaluations limits the number of evaluations of a backtest
+const maxBacktestEvaluations = 10000
+
+// contextExpression returns the Gremlin expression evaluated at the time of
+// the $at binding
+func contextExpression(expression string) (string, error) {
+	expression = strings.TrimSpace(expression)
+	if !strings.HasPrefix(expression, "G.") {
+		return "", errors.New("Only Gremlin expressions can be evaluated on the history")
+	}
+	if strings.Contains(expression, "Context(") || strings.Contains(expression, "At(") {
+		return "", errors.New("The expression can't specify its own time context")
+	}
+	return "G.Context($at)." + expression[2:], nil
+}
+
+// historicalAlert holds the expressions of an alert and of its conditions
+// rewritten to be evaluated on the history
+type historicalAlert struct {
+	*GremlinAlert
+	expressions map[*GremlinAlert]string
+}
+
+func newHistoricalAlert(ga *GremlinAlert) (*historicalAlert, error) {
+	ha := &historicalAlert{GremlinAlert: ga, expressions: make(map[*GremlinAlert]string)}
+
+	alerts := []*GremlinAlert{ga}
+	if ga.composite != nil {
+		alerts = nil
+		for _, c := range ga.composite.conditions {
+			alerts = append(alerts, c.GremlinAlert)
+		}
+	}
+
+	for _, al := range alerts {
+		expression, err := contextExpression(al.Expression)
+		if err != nil {
+			return nil, err
+		}
+		ha.expressions[al] = expression
+	}
+
+	return ha, nil
+}
+
+// at sets the time the alert is evaluated at
+func (ha *historicalAlert) at(t time.Time) error {
+	for al, expression := range ha.expressions {
+		ts, err := ha.gremlinParser.ParseWithBindings(expression, map[string]interface{}{"at": common.UnixMillis(t)})
+		if err != nil {
+			return err
+		}
+		al.traversalSequence = ts
+	}
+	return nil
+}
+
+// Backtest evaluates an alert on a past time range and returns when it
+// would have fired and been resolved
+func (a *Server) Backtest(params *types.AlertBacktestParams) (*types.AlertBacktestResult, error) {
+	if params.Alert == nil {
+		return nil, errors.New("No alert to evaluate")
+	}
+	if !params.From.Before(params.To) {
+		return nil, errors.New("The start of the time range has to be before its end")
+	}
+
+	trigger, data := parseTrigger(params.Alert.Trigger)
+	if trigger == "change" {
+		return nil, errors.New("Change alerts can't be evaluated on the history")
+	}
+
+	step := time.Minute
+	if params.Step != "" {
+		data = params.Step
+	} else if trigger != "duration" {
+		data = ""
+	}
+	if data != "" {
+		var err error
+		if step, err = time.ParseDuration(data); err != nil || step <= 0 {
+			return nil, fmt.Errorf("Invalid evaluation step '%s'", data)
+		}
+	}
+
+	if evaluations := params.To.Sub(params.From) / step; evaluations > maxBacktestEvaluations {
+		return nil, fmt.Errorf("Too many evaluations (%d), the maximum is %d", evaluations, maxBacktestEvaluations)
+	}
+
+	ga, err := NewGremlinAlert(params.Alert, a.Graph, a.gremlinParser)
+	if err != nil {
+		return nil, err
+	}
+
+	ha, err := newHistoricalAlert(ga)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &types.AlertBacktestResult{Events: []*types.AlertEvent{}}
+
+	var firing bool
+	for t := params.From; !t.After(params.To); t = t.Add(step) {
+		if err := ha.at(t); err != nil {
+			return nil, err
+		}
+
+		data, err := ga.evaluate(nil, nil, true)
+		if err != nil {
+			return nil, fmt.Errorf("Evaluation at %s failed: %s", t, err)
+		}
+		result.Evaluations++
+
+		reason, resolved := ga.check(data, t)
+		if reason != nil {
+			firing = true
+			result.Events = append(result.Events, &types.AlertEvent{Type: "fired", Time: t, ReasonData: reason})
+		} else if resolved && firing {
+			firing = false
+			result.Events = append(result.Events, &types.AlertEvent{Type: "resolved", Time: t})
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"testing"
+)
+
+func TestContextExpression(t *testing.T) {
+	expression, err := contextExpression(" G.V().Has('Type', 'netns').Count()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expression != "G.Context($at).V().Has('Type', 'netns').Count()" {
+		t.Errorf("Wrong expression: %s", expression)
+	}
+
+	for _, expression := range []string{
+		"G.At('-1h').V()",
+		"G.Context(1479899809, 3600).V()",
+		"Graph.V()",
+		"true",
+	} {
+		if _, err := contextExpression(expression); err == nil {
+			t.Errorf("Expression '%s' should be rejected", expression)
+		}
+	}
+}
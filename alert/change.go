@@ -0,0 +1,144 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+)
+
+// ChangeReason is the reason data of a topology change alert, describing the
+// change of a node or an edge matching the alert filter
+type ChangeReason struct {
+	// added, updated or deleted
+	Event string
+	// node or edge
+	Type    string
+	ID      graph.Identifier
+	Before  graph.Metadata         `json:",omitempty"`
+	After   graph.Metadata         `json:",omitempty"`
+	Changes []graph.MetadataChange `json:",omitempty"`
+	// Whether the element still matches the filter
+	Matching bool
+}
+
+// changeWatcher keeps a snapshot of the metadata of the elements matching the
+// filter of a change alert in order to report the previous values
+type changeWatcher struct {
+	matched map[graph.Identifier]graph.Metadata
+}
+
+// snapshot returns a deep copy of the metadata without the keys updated by
+// the metrics, as plain JSON values
+func snapshot(m graph.Metadata) graph.Metadata {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil
+	}
+
+	var s graph.Metadata
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil
+	}
+
+	for _, k := range ge.DiffIgnoredKeys {
+		delete(s, k)
+	}
+	return s
+}
+
+// matching returns the metadata of the nodes and edges returned by the alert
+// filter, indexed by ID
+func (ga *GremlinAlert) matching(lockGraph bool) (map[graph.Identifier]graph.Metadata, error) {
+	if ga.traversalSequence == nil {
+		return nil, errors.New("The expression of a change alert has to be a Gremlin query")
+	}
+
+	result, err := ga.traversalSequence.Exec(ga.graph, lockGraph)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make(map[graph.Identifier]graph.Metadata)
+	for _, value := range result.Values() {
+		switch e := value.(type) {
+		case *graph.Node:
+			matched[e.ID] = e.Metadata
+		case *graph.Edge:
+			matched[e.ID] = e.Metadata
+		}
+	}
+	return matched, nil
+}
+
+func newChangeWatcher(ga *GremlinAlert) (*changeWatcher, error) {
+	matched, err := ga.matching(true)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, m := range matched {
+		matched[id] = snapshot(m)
+	}
+
+	return &changeWatcher{matched: matched}, nil
+}
+
+// update records the event of an element and returns the reason of the
+// alert if the element matched the filter before or after the event
+func (cw *changeWatcher) update(ga *GremlinAlert, event, kind string, id graph.Identifier, m graph.Metadata) (*ChangeReason, error) {
+	before, matchedBefore := cw.matched[id]
+
+	if event == "deleted" {
+		if !matchedBefore {
+			return nil, nil
+		}
+		delete(cw.matched, id)
+		return &ChangeReason{Event: event, Type: kind, ID: id, Before: before}, nil
+	}
+
+	matched, err := ga.matching(false)
+	if err != nil {
+		return nil, err
+	}
+
+	_, matching := matched[id]
+	if !matching && !matchedBefore {
+		return nil, nil
+	}
+
+	after := snapshot(m)
+
+	var changes []graph.MetadataChange
+	if matchedBefore {
+		if changes = graph.DiffMetadata(before, after); len(changes) == 0 && matching {
+			return nil, nil
+		}
+	}
+
+	if matching {
+		cw.matched[id] = after
+	} else {
+		delete(cw.matched, id)
+	}
+
+	return &ChangeReason{Event: event, Type: kind, ID: id, Before: before, After: after, Changes: changes, Matching: matching}, nil
+}
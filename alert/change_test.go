@@ -0,0 +1,85 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+)
+
+func TestChangeWatcher(t *testing.T) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.UnknownService)
+
+	n1, _ := g.NewNode(graph.GenID(), graph.Metadata{"Type": "intf", "Name": "eth0", "MTU": 1500})
+
+	alert := &types.Alert{Expression: "G.V().Has('Type', 'intf')", Trigger: "change"}
+	ga, err := NewGremlinAlert(alert, g, traversal.NewGremlinTraversalParser())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cw, err := newChangeWatcher(ga)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g.AddMetadata(n1, "MTU", 9000)
+	reason, err := cw.update(ga, "updated", "node", n1.ID, n1.Metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []graph.MetadataChange{{Key: "MTU", From: float64(1500), To: float64(9000)}}
+	if reason == nil || !reason.Matching || !reflect.DeepEqual(reason.Changes, expected) {
+		t.Fatalf("MTU change expected, got %+v", reason)
+	}
+
+	if reason, _ := cw.update(ga, "updated", "node", n1.ID, n1.Metadata); reason != nil {
+		t.Errorf("No change expected, got %+v", reason)
+	}
+
+	n2, _ := g.NewNode(graph.GenID(), graph.Metadata{"Type": "host", "Name": "host1"})
+	if reason, _ := cw.update(ga, "added", "node", n2.ID, n2.Metadata); reason != nil {
+		t.Errorf("Node not matching the filter reported: %+v", reason)
+	}
+
+	g.AddMetadata(n1, "Type", "veth")
+	reason, _ = cw.update(ga, "updated", "node", n1.ID, n1.Metadata)
+	if reason == nil || reason.Matching || reason.Changes[0].Key != "Type" {
+		t.Fatalf("Node leaving the filter expected, got %+v", reason)
+	}
+
+	g.AddMetadata(n1, "Type", "intf")
+	if reason, _ = cw.update(ga, "updated", "node", n1.ID, n1.Metadata); reason == nil || !reason.Matching || reason.Changes != nil {
+		t.Fatalf("Node entering the filter expected, got %+v", reason)
+	}
+
+	g.DelNode(n1)
+	reason, _ = cw.update(ga, "deleted", "node", n1.ID, n1.Metadata)
+	if reason == nil || reason.Before["Name"] != "eth0" || reason.After != nil {
+		t.Fatalf("Node deletion expected, got %+v", reason)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"strings"
+	"time"
+
+	api "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	"github.com/skydive-project/skydive/js"
+)
+
+// condition keeps track of the last time a condition of a composite alert
+// was true
+type condition struct {
+	*GremlinAlert
+	name     string
+	lastTrue time.Time
+	data     interface{}
+}
+
+// composite combines the conditions of an alert with AND or OR, optionally
+// correlating them within a time window
+type composite struct {
+	conditions []*condition
+	or         bool
+	within     time.Duration
+}
+
+func newComposite(alert *types.Alert, g *graph.Graph, p *traversal.GremlinTraversalParser) (*composite, error) {
+	c := &composite{or: strings.ToUpper(alert.Combine) == "OR"}
+
+	if alert.Within != "" {
+		within, err := time.ParseDuration(alert.Within)
+		if err != nil {
+			return nil, err
+		}
+		c.within = within
+	}
+
+	for _, ac := range alert.Conditions {
+		ga, err := NewGremlinAlert(&types.Alert{Expression: ac.Expression}, g, p)
+		if err != nil {
+			return nil, err
+		}
+		c.conditions = append(c.conditions, &condition{GremlinAlert: ga, name: ac.Name})
+	}
+
+	return c, nil
+}
+
+// evaluate returns the data of the conditions, indexed by name, when
+// their combination is true
+func (c *composite) evaluate(server *api.Server, vm *js.Runtime, lockGraph bool, now time.Time) (interface{}, error) {
+	result := make(map[string]interface{})
+	for _, cond := range c.conditions {
+		data, err := cond.evaluate(server, vm, lockGraph)
+		if err != nil {
+			return nil, err
+		}
+
+		if data != nil {
+			cond.lastTrue, cond.data = now, data
+			result[cond.name] = data
+		}
+	}
+
+	switch {
+	case c.or:
+		if len(result) == 0 {
+			return nil, nil
+		}
+	case c.within == 0:
+		if len(result) != len(c.conditions) {
+			return nil, nil
+		}
+	default:
+		// all the conditions have to be true at least once within the
+		// window, with the data of their last evaluation being true
+		for _, cond := range c.conditions {
+			if cond.lastTrue.IsZero() || now.Sub(cond.lastTrue) > c.within {
+				return nil, nil
+			}
+			result[cond.name] = cond.data
+		}
+	}
+
+	return result, nil
+}
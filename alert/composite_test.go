@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+)
+
+func TestComposite(t *testing.T) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.UnknownService)
+
+	link, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "link", "State": "UP"})
+	route, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "route", "Rerouted": false})
+
+	newAlert := func(combine, within string) *composite {
+		alert := &types.Alert{
+			Conditions: []*types.AlertCondition{
+				{Name: "down", Expression: "G.V().Has('State', 'DOWN')"},
+				{Name: "rerouted", Expression: "G.V().Has('Rerouted', true)"},
+			},
+			Combine: combine,
+			Within:  within,
+		}
+
+		ga, err := NewGremlinAlert(alert, g, traversal.NewGremlinTraversalParser())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ga.composite
+	}
+
+	evaluate := func(c *composite, now time.Time) map[string]interface{} {
+		result, err := c.evaluate(nil, nil, true, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result == nil {
+			return nil
+		}
+		return result.(map[string]interface{})
+	}
+
+	and, or, within := newAlert("AND", ""), newAlert("OR", ""), newAlert("AND", "60s")
+
+	now := time.Now()
+	for _, c := range []*composite{and, or, within} {
+		if result := evaluate(c, now); result != nil {
+			t.Errorf("No condition should be true, got %v", result)
+		}
+	}
+
+	g.AddMetadata(link, "State", "DOWN")
+	if result := evaluate(and, now); result != nil {
+		t.Errorf("AND should be false with one condition, got %v", result)
+	}
+	if result := evaluate(or, now); len(result) != 1 || result["down"] == nil {
+		t.Errorf("OR should be true with one condition, got %v", result)
+	}
+	if result := evaluate(within, now); result != nil {
+		t.Errorf("Correlation should be false with one condition, got %v", result)
+	}
+
+	g.AddMetadata(link, "State", "UP")
+	g.AddMetadata(route, "Rerouted", true)
+	if result := evaluate(and, now.Add(30*time.Second)); result != nil {
+		t.Errorf("AND should be false with one condition, got %v", result)
+	}
+	if result := evaluate(within, now.Add(30*time.Second)); len(result) != 2 {
+		t.Errorf("Correlation should be true within the window, got %v", result)
+	}
+	if result := evaluate(within, now.Add(90*time.Second)); result != nil {
+		t.Errorf("Correlation should be false outside of the window, got %v", result)
+	}
+
+	g.AddMetadata(link, "State", "DOWN")
+	if result := evaluate(and, now.Add(90*time.Second)); len(result) != 2 {
+		t.Errorf("AND should be true with both conditions, got %v", result)
+	}
+}
@@ -0,0 +1,223 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/config"
+)
+
+const (
+	defaultTemplate    = `Skydive alert {{if .Name}}{{.Name}}{{else}}{{.UUID}}{{end}} triggered at {{.Timestamp}}{{with .Description}}: {{.}}{{end}}`
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	// PagerDuty rejects summaries longer than 1024 characters
+	pagerDutyMaxSummary = 1024
+)
+
+// notification holds the data available to the notification templates
+type notification struct {
+	UUID        string
+	Name        string
+	Description string
+	Timestamp   time.Time
+	ReasonData  interface{}
+}
+
+func parseTemplate(alert *types.Alert) (*template.Template, error) {
+	text := alert.Template
+	if text == "" {
+		text = defaultTemplate
+	}
+	return template.New(alert.UUID).Funcs(types.AlertTemplateFuncs).Parse(text)
+}
+
+func (ga *GremlinAlert) render(msg *Message) (string, error) {
+	var b bytes.Buffer
+	err := ga.template.Execute(&b, &notification{
+		UUID:        ga.UUID,
+		Name:        ga.Name,
+		Description: ga.Description,
+		Timestamp:   msg.Timestamp,
+		ReasonData:  msg.ReasonData,
+	})
+	return b.String(), err
+}
+
+func postJSON(url string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Close = true
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func notifySlack(webhook string, text string) error {
+	return postJSON(webhook, map[string]interface{}{
+		"text": text,
+		"blocks": []interface{}{
+			map[string]interface{}{
+				"type": "section",
+				"text": map[string]interface{}{"type": "mrkdwn", "text": text},
+			},
+		},
+	})
+}
+
+func notifyPagerDuty(routingKey string, severity string, msg *Message, text string) error {
+	if len(text) > pagerDutyMaxSummary {
+		text = text[:pagerDutyMaxSummary]
+	}
+
+	return postJSON(pagerDutyEventsURL, map[string]interface{}{
+		"routing_key":  routingKey,
+		"event_action": "trigger",
+		"dedup_key":    msg.UUID,
+		"payload": map[string]interface{}{
+			"summary":        text,
+			"source":         "skydive",
+			"severity":       severity,
+			"timestamp":      msg.Timestamp.Format(time.RFC3339),
+			"custom_details": msg.ReasonData,
+		},
+	})
+}
+
+func notifyEmail(recipients []string, subject string, text string) error {
+	address := config.GetString("analyzer.alert.smtp.address")
+	if address == "" {
+		return errors.New("no SMTP server configured, see analyzer.alert.smtp.address")
+	}
+
+	var auth smtp.Auth
+	if username := config.GetString("analyzer.alert.smtp.username"); username != "" {
+		host := strings.Split(address, ":")[0]
+		auth = smtp.PlainAuth("", username, config.GetString("analyzer.alert.smtp.password"), host)
+	}
+
+	from := config.GetString("analyzer.alert.smtp.from")
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(text)
+
+	return smtp.SendMail(address, auth, from, recipients, b.Bytes())
+}
+
+// parseNotifierAction sets up the Slack, PagerDuty or email notifier of the alert
+func (ga *GremlinAlert) parseNotifierAction(action string) (err error) {
+	switch {
+	case strings.HasPrefix(action, "slack+"):
+		ga.kind = actionSlack
+		ga.data = strings.TrimPrefix(action, "slack+")
+	case strings.HasPrefix(action, "pagerduty://"):
+		u, err := url.Parse(action)
+		if err != nil {
+			return err
+		}
+		if u.Host == "" {
+			return errors.New("PagerDuty routing key missing")
+		}
+
+		ga.kind = actionPagerDuty
+		ga.data = u.Host
+		ga.severity = u.Query().Get("severity")
+		switch ga.severity {
+		case "":
+			ga.severity = "error"
+		case "critical", "error", "warning", "info":
+		default:
+			return fmt.Errorf("Invalid PagerDuty severity: %s", ga.severity)
+		}
+	case strings.HasPrefix(action, "mailto:"):
+		u, err := url.Parse(action)
+		if err != nil {
+			return err
+		}
+
+		for _, recipient := range strings.Split(u.Opaque, ",") {
+			if recipient = strings.TrimSpace(recipient); recipient != "" {
+				ga.recipients = append(ga.recipients, recipient)
+			}
+		}
+		if len(ga.recipients) == 0 {
+			return errors.New("No email recipient")
+		}
+
+		ga.kind = actionEmail
+		if ga.data = u.Query().Get("subject"); ga.data == "" {
+			ga.data = "Skydive alert " + ga.Name
+		}
+	default:
+		return nil
+	}
+
+	ga.template, err = parseTemplate(ga.Alert)
+	return err
+}
+
+func (ga *GremlinAlert) notify(msg *Message) error {
+	text, err := ga.render(msg)
+	if err != nil {
+		return fmt.Errorf("Failed to render alert %s template: %s", ga.UUID, err)
+	}
+
+	switch ga.kind {
+	case actionSlack:
+		err = notifySlack(ga.data, text)
+	case actionPagerDuty:
+		err = notifyPagerDuty(ga.data, ga.severity, msg, text)
+	case actionEmail:
+		err = notifyEmail(ga.recipients, ga.data, text)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Failed to notify alert %s: %s", ga.UUID, err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+)
+
+func TestNotifierAction(t *testing.T) {
+	alert := &types.Alert{Name: "test", Action: "pagerduty://key?severity=warning"}
+	alert.UUID = "uuid"
+
+	ga, err := NewGremlinAlert(alert, nil, traversal.NewGremlinTraversalParser())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ga.kind != actionPagerDuty || ga.data != "key" || ga.severity != "warning" {
+		t.Errorf("Wrong PagerDuty notifier: %+v", ga)
+	}
+
+	alert.Action = "mailto:a@example.com,b@example.com?subject=Alert"
+	if ga, err = NewGremlinAlert(alert, nil, traversal.NewGremlinTraversalParser()); err != nil {
+		t.Fatal(err)
+	}
+	if ga.kind != actionEmail || len(ga.recipients) != 2 || ga.data != "Alert" {
+		t.Errorf("Wrong email notifier: %+v", ga)
+	}
+
+	alert.Action = "pagerduty://key?severity=unknown"
+	if _, err = NewGremlinAlert(alert, nil, traversal.NewGremlinTraversalParser()); err == nil {
+		t.Error("Should return an error on an invalid severity")
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	var text string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct{ Text string }
+		json.NewDecoder(r.Body).Decode(&payload)
+		text = payload.Text
+	}))
+	defer server.Close()
+
+	alert := &types.Alert{
+		Name:     "test",
+		Action:   "slack+" + server.URL,
+		Template: `{{.Name}} {{json .ReasonData}}`,
+	}
+
+	ga, err := NewGremlinAlert(alert, nil, traversal.NewGremlinTraversalParser())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &Message{UUID: "uuid", Timestamp: time.Now(), ReasonData: []string{"eth0"}}
+	if err := ga.trigger(msg, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(text, "test [") || !strings.Contains(text, `"eth0"`) {
+		t.Errorf("Wrong notification text: %s", text)
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"os/exec"
 	"reflect"
 	"strings"
+	"text/template"
 	"time"
 
 	api "github.com/skydive-project/skydive/api/server"
@@ -47,6 +48,9 @@ const (
 const (
 	actionWebHook = 1 + iota
 	actionScript
+	actionSlack
+	actionPagerDuty
+	actionEmail
 )
 
 // GremlinAlert represents an alert that will be triggered if its associated
@@ -55,13 +59,25 @@ type GremlinAlert struct {
 	*types.Alert
 	graph             *graph.Graph
 	lastEval          interface{}
+	firing            bool
 	kind              int
 	data              string
+	severity          string
+	recipients        []string
+	template          *template.Template
+	threshold         *threshold
+	baseline          *baseline
+	changes           *changeWatcher
+	composite         *composite
 	traversalSequence *traversal.GremlinTraversalSequence
 	gremlinParser     *traversal.GremlinTraversalParser
 }
 
 func (ga *GremlinAlert) evaluate(server *api.Server, vm *js.Runtime, lockGraph bool) (interface{}, error) {
+	if ga.composite != nil {
+		return ga.composite.evaluate(server, vm, lockGraph, time.Now())
+	}
+
 	// If the alert is a simple Gremlin query, avoid
 	// converting to JavaScript
 	if ga.traversalSequence != nil {
@@ -119,8 +135,10 @@ func (ga *GremlinAlert) evaluate(server *api.Server, vm *js.Runtime, lockGraph b
 	return nil, nil
 }
 
-func (ga *GremlinAlert) trigger(payload []byte) error {
+func (ga *GremlinAlert) trigger(msg *Message, payload []byte) error {
 	switch ga.kind {
+	case actionSlack, actionPagerDuty, actionEmail:
+		return ga.notify(msg)
 	case actionWebHook:
 		client := &http.Client{}
 
@@ -177,6 +195,32 @@ func NewGremlinAlert(alert *types.Alert, g *graph.Graph, p *traversal.GremlinTra
 	} else if strings.HasPrefix(alert.Action, "file://") {
 		ga.kind = actionScript
 		ga.data = alert.Action[7:]
+	} else if err := ga.parseNotifierAction(alert.Action); err != nil {
+		return nil, err
+	}
+
+	if alert.Threshold != nil {
+		th, err := newThreshold(alert.Threshold)
+		if err != nil {
+			return nil, err
+		}
+		ga.threshold = th
+	}
+
+	if len(alert.Conditions) > 0 {
+		c, err := newComposite(alert, g, p)
+		if err != nil {
+			return nil, err
+		}
+		ga.composite = c
+	}
+
+	if alert.Anomaly != nil {
+		b, err := newBaseline(alert.Anomaly)
+		if err != nil {
+			return nil, err
+		}
+		ga.baseline = b
 	}
 
 	return ga, nil
@@ -190,10 +234,11 @@ type Server struct {
 	common.MasterElection
 	Graph         *graph.Graph
 	Pool          ws.StructSpeakerPool
-	AlertHandler  api.Handler
+	AlertHandler  *api.AlertAPIHandler
 	apiServer     *api.Server
 	watcher       api.StoppableWatcher
 	graphAlerts   map[string]*GremlinAlert
+	changeAlerts  map[string]*GremlinAlert
 	alertTimers   map[string]chan bool
 	gremlinParser *traversal.GremlinTraversalParser
 	runtime       *js.Runtime
@@ -221,11 +266,18 @@ func (a *Server) triggerAlert(al *GremlinAlert, data interface{}) error {
 		return fmt.Errorf("Failed to marshal alert to JSON: %s", err)
 	}
 
-	go func() {
-		if err := al.trigger(payload); err != nil {
-			logging.GetLogger().Infof("Failed to trigger alert: %s", err)
-		}
-	}()
+	suppressed := a.acknowledged(al)
+	if suppressed {
+		logging.GetLogger().Infof("Alert %s is acknowledged, notification suppressed", al.UUID)
+	} else {
+		go func() {
+			if err := al.trigger(&msg, payload); err != nil {
+				logging.GetLogger().Infof("Failed to trigger alert: %s", err)
+			}
+		}()
+	}
+
+	a.recordTrigger(al, &msg, suppressed)
 
 	wsMsg := ws.NewStructMessage(Namespace, "Alert", msg)
 	a.Pool.BroadcastMessage(wsMsg)
@@ -234,31 +286,58 @@ func (a *Server) triggerAlert(al *GremlinAlert, data interface{}) error {
 	return nil
 }
 
-func (a *Server) evaluateAlert(al *GremlinAlert, lockGraph bool) error {
-	if !a.IsMaster() {
-		return nil
+// check returns the reason of the alert if it has to be triggered given the
+// result of its evaluation, or whether its condition is resolved
+func (ga *GremlinAlert) check(data interface{}, now time.Time) (reason interface{}, resolved bool) {
+	if ga.threshold != nil {
+		if reason := ga.threshold.check(data, now); reason != nil {
+			return reason, false
+		}
+		return nil, !ga.threshold.active
 	}
 
-	data, err := al.evaluate(a.apiServer, a.runtime, lockGraph)
-	if err != nil {
-		return err
+	if ga.baseline != nil {
+		if reason := ga.baseline.observe(data, now); reason != nil {
+			return reason, false
+		}
+		return nil, true
 	}
 
 	if data != nil {
 		// Gremlin query/Javascript expression returned datas.
 		// Alert must but sent if those datas differ from the one that trigger
 		// the previous alert.
-		equal := reflect.DeepEqual(reflect.ValueOf(data).Interface(), al.lastEval)
+		equal := reflect.DeepEqual(reflect.ValueOf(data).Interface(), ga.lastEval)
 		if !equal {
-			al.lastEval = data
-			return a.triggerAlert(al, data)
+			ga.lastEval = data
+			return data, false
 		}
-	} else {
-		// Gremlin query returned no datas, or Javascript expression was unsuccessful
-		// Reset the lastEval to be able to trigger the alert next time
-		al.lastEval = nil
+		return nil, false
 	}
 
+	// Gremlin query returned no datas, or Javascript expression was unsuccessful
+	// Reset the lastEval to be able to trigger the alert next time
+	ga.lastEval = nil
+	return nil, true
+}
+
+func (a *Server) evaluateAlert(al *GremlinAlert, lockGraph bool) error {
+	if !a.IsMaster() {
+		return nil
+	}
+
+	data, err := al.evaluate(a.apiServer, a.runtime, lockGraph)
+	if err != nil {
+		return err
+	}
+
+	reason, resolved := al.check(data, time.Now())
+	if reason != nil {
+		return a.triggerAlert(al, reason)
+	}
+	if resolved {
+		return a.resolveAlert(al)
+	}
 	return nil
 }
 
@@ -274,34 +353,62 @@ func (a *Server) evaluateAlerts(alerts map[string]*GremlinAlert, lockGraph bool)
 	}
 }
 
+// Evaluate the change alerts against the event of a node or an edge
+func (a *Server) evaluateChanges(event, kind string, id graph.Identifier, m graph.Metadata) {
+	a.RLock()
+	defer a.RUnlock()
+
+	for _, al := range a.changeAlerts {
+		// keep track of the changes on all the analyzers so that the
+		// previous values are known on master election
+		reason, err := al.changes.update(al, event, kind, id, m)
+		if err != nil {
+			logging.GetLogger().Warning(err)
+			continue
+		}
+
+		if reason != nil && a.IsMaster() {
+			if err := a.triggerAlert(al, reason); err != nil {
+				logging.GetLogger().Warning(err)
+			}
+		}
+	}
+}
+
 // OnNodeUpdated event
 func (a *Server) OnNodeUpdated(n *graph.Node) {
 	a.evaluateAlerts(a.graphAlerts, false)
+	a.evaluateChanges("updated", "node", n.ID, n.Metadata)
 }
 
 // OnNodeAdded event
 func (a *Server) OnNodeAdded(n *graph.Node) {
 	a.evaluateAlerts(a.graphAlerts, false)
+	a.evaluateChanges("added", "node", n.ID, n.Metadata)
 }
 
 // OnNodeDeleted event
 func (a *Server) OnNodeDeleted(n *graph.Node) {
 	a.evaluateAlerts(a.graphAlerts, false)
+	a.evaluateChanges("deleted", "node", n.ID, n.Metadata)
 }
 
 // OnEdgeAdded event
 func (a *Server) OnEdgeAdded(e *graph.Edge) {
 	a.evaluateAlerts(a.graphAlerts, false)
+	a.evaluateChanges("added", "edge", e.ID, e.Metadata)
 }
 
 // OnEdgeUpdated event
 func (a *Server) OnEdgeUpdated(e *graph.Edge) {
 	a.evaluateAlerts(a.graphAlerts, false)
+	a.evaluateChanges("updated", "edge", e.ID, e.Metadata)
 }
 
 // OnEdgeDeleted event
 func (a *Server) OnEdgeDeleted(e *graph.Edge) {
 	a.evaluateAlerts(a.graphAlerts, false)
+	a.evaluateChanges("deleted", "edge", e.ID, e.Metadata)
 }
 
 func parseTrigger(trigger string) (string, string) {
@@ -320,10 +427,28 @@ func (a *Server) registerAlert(apiAlert *types.Alert) error {
 
 	logging.GetLogger().Debugf("Registering new alert: %+v", alert)
 
-	a.evaluateAlert(alert, true)
+	// resume the state of an alert that was firing before a restart or a
+	// change of master
+	if state, err := a.AlertHandler.State(apiAlert.UUID); err == nil {
+		alert.firing = state.State == types.AlertFiring
+	}
 
 	trigger, data := parseTrigger(apiAlert.Trigger)
+	if trigger != "change" {
+		a.evaluateAlert(alert, true)
+	}
+
 	switch trigger {
+	case "change":
+		changes, err := newChangeWatcher(alert)
+		if err != nil {
+			return err
+		}
+		alert.changes = changes
+
+		a.Lock()
+		a.changeAlerts[apiAlert.UUID] = alert
+		a.Unlock()
 	case "duration":
 		duration, err := time.ParseDuration(data)
 		if err != nil {
@@ -371,6 +496,7 @@ func (a *Server) unregisterAlert(id string) {
 		delete(a.alertTimers, id)
 	} else {
 		delete(a.graphAlerts, id)
+		delete(a.changeAlerts, id)
 	}
 }
 
@@ -402,7 +528,7 @@ func (a *Server) Stop() {
 func NewServer(apiServer *api.Server, pool ws.StructSpeakerPool, graph *graph.Graph, parser *traversal.GremlinTraversalParser, etcdClient *etcd.Client) (*Server, error) {
 	election := etcdClient.NewElection("alert-server")
 
-	runtime, err := api.NewWorkflowRuntime(graph, parser, apiServer)
+	runtime, err := api.NewWorkflowRuntime(graph, parser, apiServer, "")
 	if err != nil {
 		return nil, err
 	}
@@ -410,9 +536,10 @@ func NewServer(apiServer *api.Server, pool ws.StructSpeakerPool, graph *graph.Gr
 	as := &Server{
 		MasterElection: election,
 		Pool:           pool,
-		AlertHandler:   apiServer.GetHandler("alert"),
+		AlertHandler:   apiServer.GetHandler("alert").(*api.AlertAPIHandler),
 		Graph:          graph,
 		graphAlerts:    make(map[string]*GremlinAlert),
+		changeAlerts:   make(map[string]*GremlinAlert),
 		alertTimers:    make(map[string]chan bool),
 		gremlinParser:  parser,
 		apiServer:      apiServer,
@@ -0,0 +1,99 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// acknowledged returns whether the notifications of the alert are suppressed
+func (a *Server) acknowledged(al *GremlinAlert) bool {
+	ack, err := a.AlertHandler.Ack(al.UUID)
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to get acknowledgement of alert %s: %s", al.UUID, err)
+	}
+	return ack != nil
+}
+
+// recordTrigger stores the firing state of the alert and appends the
+// trigger to its history
+func (a *Server) recordTrigger(al *GremlinAlert, msg *Message, suppressed bool) {
+	state, err := a.AlertHandler.State(al.UUID)
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to get state of alert %s: %s", al.UUID, err)
+		return
+	}
+
+	// change alerts report events and have no condition to be resolved
+	if al.changes == nil && state.State != types.AlertFiring {
+		state.State = types.AlertFiring
+		state.Since = msg.Timestamp
+	}
+	al.firing = al.changes == nil
+	state.LastTriggered = msg.Timestamp
+	state.Count++
+
+	if err := a.AlertHandler.SetState(al.UUID, state); err != nil {
+		logging.GetLogger().Errorf("Failed to set state of alert %s: %s", al.UUID, err)
+	}
+
+	event := &types.AlertEvent{Type: "fired", Time: msg.Timestamp, ReasonData: msg.ReasonData, Suppressed: suppressed}
+	if err := a.AlertHandler.AddEvent(al.UUID, event); err != nil {
+		logging.GetLogger().Errorf("Failed to record trigger of alert %s: %s", al.UUID, err)
+	}
+}
+
+// resolveAlert marks a firing alert as resolved, removing its
+// acknowledgement unless it is a silence
+func (a *Server) resolveAlert(al *GremlinAlert) error {
+	if !al.firing {
+		return nil
+	}
+	al.firing = false
+
+	now := time.Now().UTC()
+
+	state, err := a.AlertHandler.State(al.UUID)
+	if err != nil {
+		return err
+	}
+	state.State, state.Since = types.AlertResolved, now
+
+	if err := a.AlertHandler.SetState(al.UUID, state); err != nil {
+		return err
+	}
+
+	if ack, err := a.AlertHandler.Ack(al.UUID); err == nil && ack != nil && ack.Until == nil {
+		if err := a.AlertHandler.Unacknowledge(al.UUID); err != nil {
+			logging.GetLogger().Errorf("Failed to remove acknowledgement of alert %s: %s", al.UUID, err)
+		}
+	}
+
+	if err := a.AlertHandler.AddEvent(al.UUID, &types.AlertEvent{Type: "resolved", Time: now}); err != nil {
+		logging.GetLogger().Errorf("Failed to record resolution of alert %s: %s", al.UUID, err)
+	}
+
+	logging.GetLogger().Infof("Alert %s resolved", al.UUID)
+
+	a.Pool.BroadcastMessage(ws.NewStructMessage(Namespace, "AlertResolved", Message{UUID: al.UUID, Timestamp: now}))
+	return nil
+}
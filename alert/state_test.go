@@ -0,0 +1,208 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+
+	api "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/api/types"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+type fakeKeysAPI struct {
+	etcd.KeysAPI
+	values map[string]string
+	index  int
+}
+
+func (k *fakeKeysAPI) Set(ctx context.Context, key, value string, opts *etcd.SetOptions) (*etcd.Response, error) {
+	k.values[key] = value
+	return &etcd.Response{}, nil
+}
+
+func (k *fakeKeysAPI) CreateInOrder(ctx context.Context, dir, value string, opts *etcd.CreateInOrderOptions) (*etcd.Response, error) {
+	k.index++
+	k.values[fmt.Sprintf("%s/%020d", dir, k.index)] = value
+	return &etcd.Response{}, nil
+}
+
+func (k *fakeKeysAPI) Get(ctx context.Context, key string, opts *etcd.GetOptions) (*etcd.Response, error) {
+	if value, ok := k.values[key]; ok {
+		return &etcd.Response{Node: &etcd.Node{Key: key, Value: value}}, nil
+	}
+
+	node := &etcd.Node{Key: key, Dir: true}
+	for k, value := range k.values {
+		if strings.HasPrefix(k, key+"/") {
+			node.Nodes = append(node.Nodes, &etcd.Node{Key: k, Value: value})
+		}
+	}
+	if len(node.Nodes) == 0 {
+		return nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound}
+	}
+	sort.Slice(node.Nodes, func(i, j int) bool { return node.Nodes[i].Key < node.Nodes[j].Key })
+
+	return &etcd.Response{Node: node}, nil
+}
+
+func (k *fakeKeysAPI) Delete(ctx context.Context, key string, opts *etcd.DeleteOptions) (*etcd.Response, error) {
+	if _, ok := k.values[key]; !ok {
+		return nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound}
+	}
+	delete(k.values, key)
+	return &etcd.Response{}, nil
+}
+
+type fakePool struct {
+	ws.StructSpeakerPool
+	messages []ws.Message
+}
+
+func (p *fakePool) BroadcastMessage(m ws.Message) {
+	p.messages = append(p.messages, m)
+}
+
+func newStateTestServer() (*Server, *fakePool) {
+	kapi := &fakeKeysAPI{values: make(map[string]string)}
+	pool := &fakePool{}
+	return &Server{
+		AlertHandler: &api.AlertAPIHandler{BasicAPIHandler: api.BasicAPIHandler{EtcdKeyAPI: kapi}},
+		Pool:         pool,
+	}, pool
+}
+
+func historyTypes(t *testing.T, s *Server, id string) string {
+	events, err := s.AlertHandler.History(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, event := range events {
+		name := event.Type
+		if event.Suppressed {
+			name += "(suppressed)"
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestAlertStateLifecycle(t *testing.T) {
+	s, pool := newStateTestServer()
+	al := &GremlinAlert{Alert: &types.Alert{BasicResource: types.BasicResource{UUID: "alert1"}}}
+
+	t1 := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	s.recordTrigger(al, &Message{UUID: al.UUID, Timestamp: t1}, s.acknowledged(al))
+	s.recordTrigger(al, &Message{UUID: al.UUID, Timestamp: t1.Add(time.Minute)}, s.acknowledged(al))
+
+	state, err := s.AlertHandler.State(al.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.State != types.AlertFiring || !state.Since.Equal(t1) || !state.LastTriggered.Equal(t1.Add(time.Minute)) || state.Count != 2 {
+		t.Errorf("Expected a firing alert triggered twice since the first trigger, got %+v", state)
+	}
+	if !al.firing {
+		t.Error("The alert should be firing")
+	}
+
+	// an acknowledgement suppresses the notifications until the resolution
+	if err := s.AlertHandler.Acknowledge(al.UUID, &types.AlertAck{User: "admin", Time: t1}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !s.acknowledged(al) {
+		t.Fatal("The alert should be acknowledged")
+	}
+	s.recordTrigger(al, &Message{UUID: al.UUID, Timestamp: t1.Add(2 * time.Minute)}, s.acknowledged(al))
+
+	if err := s.resolveAlert(al); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := s.AlertHandler.State(al.UUID); state.State != types.AlertResolved || state.Count != 3 {
+		t.Errorf("Expected a resolved alert, got %+v", state)
+	}
+	if s.acknowledged(al) {
+		t.Error("The acknowledgement should be removed on resolution")
+	}
+	if len(pool.messages) != 1 {
+		t.Errorf("Expected the resolution to be broadcast, got %d messages", len(pool.messages))
+	}
+
+	// resolving an alert that is not firing does nothing
+	if err := s.resolveAlert(al); err != nil {
+		t.Fatal(err)
+	}
+	if history := historyTypes(t, s, al.UUID); history != "fired,fired,fired(suppressed),resolved" {
+		t.Errorf("Unexpected history: %s", history)
+	}
+}
+
+func TestAlertStateSilence(t *testing.T) {
+	s, _ := newStateTestServer()
+	al := &GremlinAlert{Alert: &types.Alert{BasicResource: types.BasicResource{UUID: "alert1"}}}
+
+	now := time.Now().UTC()
+	until := now.Add(time.Hour)
+	if err := s.AlertHandler.Acknowledge(al.UUID, &types.AlertAck{User: "admin", Time: now, Until: &until}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	s.recordTrigger(al, &Message{UUID: al.UUID, Timestamp: now}, s.acknowledged(al))
+	if err := s.resolveAlert(al); err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.acknowledged(al) {
+		t.Error("A silence should be kept after the resolution")
+	}
+	if history := historyTypes(t, s, al.UUID); history != "fired(suppressed),resolved" {
+		t.Errorf("Unexpected history: %s", history)
+	}
+}
+
+func TestAlertStateChanges(t *testing.T) {
+	s, pool := newStateTestServer()
+	al := &GremlinAlert{Alert: &types.Alert{BasicResource: types.BasicResource{UUID: "alert1"}}, changes: &changeWatcher{}}
+
+	now := time.Now().UTC()
+	s.recordTrigger(al, &Message{UUID: al.UUID, Timestamp: now}, false)
+
+	state, err := s.AlertHandler.State(al.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.State != types.AlertResolved || state.Count != 1 || !state.LastTriggered.Equal(now) {
+		t.Errorf("A change alert should report its events without firing, got %+v", state)
+	}
+
+	if err := s.resolveAlert(al); err != nil {
+		t.Fatal(err)
+	}
+	if len(pool.messages) != 0 {
+		t.Error("A change alert should not be resolved")
+	}
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+)
+
+// threshold keeps track of the state of a threshold alert between evaluations
+type threshold struct {
+	*types.AlertThreshold
+	forDuration time.Duration
+	cooldown    time.Duration
+	since       time.Time
+	lastTrigger time.Time
+	active      bool
+}
+
+// ThresholdReason is the reason data of a triggered threshold alert
+type ThresholdReason struct {
+	Value     float64
+	Threshold float64
+	Data      interface{}
+}
+
+func newThreshold(t *types.AlertThreshold) (th *threshold, err error) {
+	th = &threshold{AlertThreshold: t}
+	if t.For != "" {
+		if th.forDuration, err = time.ParseDuration(t.For); err != nil {
+			return nil, err
+		}
+	}
+	if t.Cooldown != "" {
+		if th.cooldown, err = time.ParseDuration(t.Cooldown); err != nil {
+			return nil, err
+		}
+	}
+	return th, nil
+}
+
+// lookupMax returns the largest number found for the given key
+func lookupMax(v interface{}, key string) (max float64, found bool) {
+	update := func(f float64, ok bool) {
+		if ok && (!found || f > max) {
+			max, found = f, true
+		}
+	}
+
+	switch v := v.(type) {
+	case float64:
+		update(v, key == "")
+	case map[string]interface{}:
+		for k, value := range v {
+			if f, ok := value.(float64); ok {
+				update(f, k == key)
+			} else {
+				update(lookupMax(value, key))
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			update(lookupMax(value, key))
+		}
+	}
+
+	return
+}
+
+// value returns the value of the field in the expression result
+func (th *threshold) value(data interface{}) (float64, bool) {
+	if data == nil {
+		return 0, false
+	}
+
+	// use the JSON representation of the result as the one of the
+	// Gremlin steps and the JavaScript values are well defined
+	b, err := json.Marshal(data)
+	if err != nil {
+		return 0, false
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return 0, false
+	}
+
+	if th.Operator == "<" {
+		// look for the smallest value
+		min, found := lookupMax(negate(v), th.Field)
+		return -min, found
+	}
+	return lookupMax(v, th.Field)
+}
+
+// negate returns a copy of the value with all the numbers negated
+func negate(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float64:
+		return -v
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			m[k] = negate(value)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, value := range v {
+			l[i] = negate(value)
+		}
+		return l
+	}
+	return v
+}
+
+func (th *threshold) exceeded(value float64) bool {
+	if th.Operator == "<" {
+		return value < th.Value
+	}
+	return value > th.Value
+}
+
+func (th *threshold) cleared(value float64) bool {
+	clear := th.Value
+	if th.Clear != nil {
+		clear = *th.Clear
+	}
+
+	if th.Operator == "<" {
+		return value >= clear
+	}
+	return value <= clear
+}
+
+// check returns the reason of the alert if it has to be triggered
+func (th *threshold) check(data interface{}, now time.Time) *ThresholdReason {
+	value, found := th.value(data)
+
+	if th.active {
+		if !found || th.cleared(value) {
+			th.active = false
+			th.since = time.Time{}
+		}
+		return nil
+	}
+
+	if !found || !th.exceeded(value) {
+		th.since = time.Time{}
+		return nil
+	}
+
+	if th.since.IsZero() {
+		th.since = now
+	}
+
+	if now.Sub(th.since) < th.forDuration || (!th.lastTrigger.IsZero() && now.Sub(th.lastTrigger) < th.cooldown) {
+		return nil
+	}
+
+	th.active = true
+	th.lastTrigger = now
+
+	return &ThresholdReason{Value: value, Threshold: th.Value, Data: data}
+}
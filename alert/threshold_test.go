@@ -0,0 +1,79 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+)
+
+func TestThreshold(t *testing.T) {
+	clear := 80.0
+	th, err := newThreshold(&types.AlertThreshold{Field: "ABBytes", Value: 100, Clear: &clear, For: "2m", Cooldown: "10m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := func(values ...float64) interface{} {
+		var metrics []interface{}
+		for _, v := range values {
+			metrics = append(metrics, map[string]interface{}{"ABBytes": v, "BABytes": 1000})
+		}
+		return map[string]interface{}{"flow": metrics}
+	}
+
+	now := time.Now()
+	steps := []struct {
+		after   time.Duration
+		data    interface{}
+		trigger bool
+	}{
+		{0, result(10, 120), false},
+		// exceeded for less than 2 minutes
+		{time.Minute, result(130), false},
+		{2 * time.Minute, result(130), true},
+		// still exceeded, already triggered
+		{3 * time.Minute, result(150), false},
+		// below the threshold but not cleared
+		{4 * time.Minute, result(90), false},
+		{6 * time.Minute, result(130), false},
+		{7 * time.Minute, result(70), false},
+		// cleared, exceeded again for 2 minutes but in the cooldown period
+		{8 * time.Minute, result(130), false},
+		{11 * time.Minute, result(130), false},
+		{13 * time.Minute, result(130), true},
+		{14 * time.Minute, nil, false},
+	}
+
+	for i, step := range steps {
+		reason := th.check(step.data, now.Add(step.after))
+		if (reason != nil) != step.trigger {
+			t.Fatalf("Step %d: expected trigger %v, got: %+v", i, step.trigger, reason)
+		}
+		if reason != nil && reason.Value != 130 {
+			t.Errorf("Step %d: wrong value %f", i, reason.Value)
+		}
+	}
+
+	th, _ = newThreshold(&types.AlertThreshold{Operator: "<", Value: 10})
+	if reason := th.check([]interface{}{20, 5, 30}, now); reason == nil || reason.Value != 5 {
+		t.Errorf("Should trigger on the smallest value, got: %+v", reason)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package analyzer
+
+import (
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/etcd"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// ClusterStatus describes the analyzers sharing the agents
+type ClusterStatus struct {
+	// Host IDs of the analyzers of the cluster
+	Members []string
+	// Host IDs of the connected agents placed on this analyzer
+	Agents []string
+}
+
+// cluster shares the agents between the analyzers registered in etcd.
+// The members are sent to the agents which place themselves on the
+// analyzer owning them in the hash ring, the agents being redistributed
+// when an analyzer joins or leaves the cluster.
+type cluster struct {
+	ws.DefaultSpeakerEventHandler
+	host     string
+	members  *etcd.Members
+	replicas int
+	pool     *ws.StructServer
+}
+
+func (c *cluster) clusterMembers() *types.ClusterMembers {
+	return &types.ClusterMembers{
+		Members:  c.members.GetMembers(),
+		Replicas: c.replicas,
+	}
+}
+
+func (c *cluster) membersMessage() *ws.StructMessage {
+	msg := ws.NewStructMessage(types.ClusterNamespace, "Members", c.clusterMembers())
+	msg.SetPriority(ws.HighPriority)
+	return msg
+}
+
+// OnMembersChanged sends the new members to all the agents
+func (c *cluster) OnMembersChanged(members []string) {
+	logging.GetLogger().Infof("Analyzers of the cluster: %v", members)
+	c.pool.BroadcastMessage(c.membersMessage())
+}
+
+// OnConnected sends the members to the new agent
+func (c *cluster) OnConnected(speaker ws.Speaker) {
+	speaker.SendMessage(c.membersMessage())
+}
+
+// GetStatus returns the members and the agents placed on this analyzer
+func (c *cluster) GetStatus() *ClusterStatus {
+	members := c.clusterMembers()
+	status := &ClusterStatus{Members: members.Members, Agents: []string{}}
+
+	for _, speaker := range c.pool.GetSpeakersByType(common.AgentService) {
+		host := speaker.GetRemoteHost()
+		if members.Owner(host, members.Members) == c.host {
+			status.Agents = append(status.Agents, host)
+		}
+	}
+
+	return status
+}
+
+func (c *cluster) Start() error {
+	return c.members.Start()
+}
+
+func (c *cluster) Stop() {
+	c.members.Stop()
+}
+
+func newCluster(host string, etcdClient *etcd.Client, replicas int, pool *ws.StructServer) *cluster {
+	c := &cluster{
+		host:     host,
+		members:  etcd.NewMembers(etcdClient, "cluster"),
+		replicas: replicas,
+		pool:     pool,
+	}
+
+	c.members.AddEventListener(c)
+	pool.AddEventHandler(c)
+
+	return c
+}
@@ -0,0 +1,396 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package analyzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/flow"
+	gc "github.com/skydive-project/skydive/graffiti/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	gws "github.com/skydive-project/skydive/graffiti/websocket"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// siteMetadataKey is the metadata key holding the site of the nodes and
+// edges forwarded to the global analyzer
+const siteMetadataKey = "Site"
+
+// federationPublisher forwards a summary of the topology of the site and
+// the selected flows to the global analyzer. The summary, the result of a
+// Gremlin SubGraph query, is computed periodically and only its changes
+// are sent once the global analyzer is synchronized.
+type federationPublisher struct {
+	sync.Mutex
+	ws.DefaultSpeakerEventHandler
+	graph          *graph.Graph
+	parser         *traversal.GremlinTraversalParser
+	site           string
+	origin         string
+	query          string
+	interval       time.Duration
+	flowFilter     *filters.Filter
+	topologyClient *ws.StructSpeaker
+	flowClient     *ws.Client
+	synced         bool
+	nodes          map[graph.Identifier]*graph.Node
+	edges          map[graph.Identifier]*graph.Edge
+	quit           chan bool
+	wg             sync.WaitGroup
+}
+
+// siteElements returns the copies of the elements of the summary, tagged
+// with the site and owned by this analyzer
+func (f *federationPublisher) siteElements() (map[graph.Identifier]*graph.Node, map[graph.Identifier]*graph.Edge, error) {
+	ts, err := f.parser.ParseWithBindings(f.query, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := ts.Exec(f.graph, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	summary, ok := res.(*traversal.GraphTraversal)
+	if !ok {
+		return nil, nil, fmt.Errorf("Summary query '%s' does not return a SubGraph", f.query)
+	}
+
+	tag := func(m graph.Metadata) graph.Metadata {
+		metadata := graph.Metadata{siteMetadataKey: f.site}
+		for k, v := range m {
+			metadata[k] = v
+		}
+		return metadata
+	}
+
+	nodes := make(map[graph.Identifier]*graph.Node)
+	edges := make(map[graph.Identifier]*graph.Edge)
+
+	summary.Graph.RLock()
+	defer summary.Graph.RUnlock()
+
+	for _, n := range summary.Graph.GetNodes(nil) {
+		node := *n
+		node.Metadata = tag(n.Metadata)
+		node.Origin = f.origin
+		nodes[n.ID] = &node
+	}
+
+	for _, e := range summary.Graph.GetEdges(nil) {
+		edge := *e
+		edge.Metadata = tag(e.Metadata)
+		edge.Origin = f.origin
+		edges[e.ID] = &edge
+	}
+
+	return nodes, edges, nil
+}
+
+func (f *federationPublisher) send(msgType string, obj interface{}) {
+	f.topologyClient.SendMessage(gws.NewStructMessage(msgType, obj))
+}
+
+// publish sends the whole summary if the global analyzer is not yet
+// synchronized, the changes since the last summary otherwise
+func (f *federationPublisher) publish() {
+	f.Lock()
+	defer f.Unlock()
+
+	if !f.topologyClient.IsConnected() {
+		return
+	}
+
+	nodes, edges, err := f.siteElements()
+	if err != nil {
+		logging.GetLogger().Errorf("Unable to summarize the topology of site %s: %s", f.site, err)
+		return
+	}
+
+	if !f.synced {
+		elements := &graph.Elements{}
+		for _, n := range nodes {
+			elements.Nodes = append(elements.Nodes, n)
+		}
+		for _, e := range edges {
+			elements.Edges = append(elements.Edges, e)
+		}
+		f.send(gws.SyncMsgType, &gws.SyncMsg{Elements: elements})
+		f.nodes, f.edges, f.synced = nodes, edges, true
+		return
+	}
+
+	for id, n := range nodes {
+		if previous, found := f.nodes[id]; !found {
+			f.send(gws.NodeAddedMsgType, n)
+		} else if previous.Revision != n.Revision {
+			f.send(gws.NodeUpdatedMsgType, n)
+		}
+	}
+
+	for id, e := range edges {
+		if previous, found := f.edges[id]; !found {
+			f.send(gws.EdgeAddedMsgType, e)
+		} else if previous.Revision != e.Revision {
+			f.send(gws.EdgeUpdatedMsgType, e)
+		}
+	}
+
+	for id, e := range f.edges {
+		if _, found := edges[id]; !found {
+			f.send(gws.EdgeDeletedMsgType, e)
+		}
+	}
+
+	for id, n := range f.nodes {
+		if _, found := nodes[id]; !found {
+			f.send(gws.NodeDeletedMsgType, n)
+		}
+	}
+
+	f.nodes, f.edges = nodes, edges
+}
+
+// OnConnected sends the whole summary to the global analyzer
+func (f *federationPublisher) OnConnected(c ws.Speaker) {
+	logging.GetLogger().Infof("Forwarding the topology of site %s to %s", f.site, c.GetURL())
+
+	f.Lock()
+	f.synced = false
+	f.Unlock()
+
+	f.publish()
+}
+
+// OnFlows forwards the selected flows to the global analyzer
+func (f *federationPublisher) OnFlows(flows []*flow.Flow) {
+	if f.flowFilter == nil || !f.flowClient.IsConnected() {
+		return
+	}
+
+	var msg flow.Message
+	for _, fl := range flows {
+		if f.flowFilter.Eval(fl) {
+			msg.Flows = append(msg.Flows, fl)
+		}
+	}
+
+	if len(msg.Flows) == 0 {
+		return
+	}
+
+	data, err := msg.Marshal()
+	if err != nil {
+		logging.GetLogger().Errorf("Unable to encode the flows of site %s: %s", f.site, err)
+		return
+	}
+
+	f.flowClient.SendRaw(data)
+}
+
+func (f *federationPublisher) Start() {
+	f.topologyClient.Start()
+	f.flowClient.Start()
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				f.publish()
+			case <-f.quit:
+				return
+			}
+		}
+	}()
+}
+
+func (f *federationPublisher) Stop() {
+	f.quit <- true
+	f.wg.Wait()
+
+	f.topologyClient.Stop()
+	f.flowClient.Stop()
+}
+
+// newFlowFilter returns a filter matching the flows having all the given
+// field values, nil if there is none
+func newFlowFilter(terms map[string]string) *filters.Filter {
+	if len(terms) == 0 {
+		return nil
+	}
+
+	var termFilters []*filters.Filter
+	for k, v := range terms {
+		termFilters = append(termFilters, filters.NewTermStringFilter(k, v))
+	}
+	return filters.NewAndFilter(termFilters...)
+}
+
+func newFederationPublisher(g *graph.Graph, parser *traversal.GremlinTraversalParser, host, site, global string, authOpts *shttp.AuthenticationOpts) (*federationPublisher, error) {
+	sa, err := common.ServiceAddressFromString(global)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid global analyzer address %s: %s", global, err)
+	}
+
+	query := config.GetString("analyzer.federation.topology")
+	if _, err := parser.ParseWithBindings(query, nil); err != nil {
+		return nil, fmt.Errorf("Invalid summary query '%s': %s", query, err)
+	}
+
+	// the global analyzer deletes the summary when the site disconnects
+	headers := http.Header{"X-Persistence-Policy": {string(gc.DeleteOnDisconnect)}}
+
+	topologyClient, err := config.NewWSClient(common.AnalyzerService, config.GetURL("ws", sa.Addr, sa.Port, "/ws/publisher"), ws.ClientOpts{AuthOpts: authOpts, Headers: headers})
+	if err != nil {
+		return nil, err
+	}
+
+	flowClient, err := config.NewWSClient(common.AnalyzerService, config.GetURL("ws", sa.Addr, sa.Port, "/ws/agent/flow"), ws.ClientOpts{AuthOpts: authOpts})
+	if err != nil {
+		return nil, err
+	}
+
+	f := &federationPublisher{
+		graph:          g,
+		parser:         parser,
+		site:           site,
+		origin:         common.AnalyzerService.String() + "." + host,
+		query:          query,
+		interval:       time.Duration(config.GetInt("analyzer.federation.interval")) * time.Second,
+		flowFilter:     newFlowFilter(config.GetStringMapString("analyzer.federation.flows")),
+		topologyClient: topologyClient.UpgradeToStructSpeaker(),
+		flowClient:     flowClient,
+		quit:           make(chan bool),
+	}
+
+	f.topologyClient.AddEventHandler(f)
+
+	return f, nil
+}
+
+// federationQuerier runs the federated queries of the global analyzer on
+// the topology API of the member sites
+type federationQuerier struct {
+	sites map[string]*shttp.RestClient
+}
+
+func (f *federationQuerier) querySite(client *shttp.RestClient, params *types.TopologyParams) (json.RawMessage, error) {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Request("POST", "topology", bytes.NewReader(body), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return data, nil
+	case http.StatusNoContent:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%s: %s", resp.Status, string(data))
+	}
+}
+
+// QuerySites runs the query on the given sites, or on all of them,
+// concurrently. The sites failing to answer are reported in the results.
+func (f *federationQuerier) QuerySites(query *types.FederatedQuery) ([]*types.SiteResult, error) {
+	sites := query.Sites
+	if len(sites) == 0 {
+		for site := range f.sites {
+			sites = append(sites, site)
+		}
+	}
+	sort.Strings(sites)
+
+	results := make([]*types.SiteResult, len(sites))
+	for i, site := range sites {
+		if _, found := f.sites[site]; !found {
+			return nil, fmt.Errorf("Unknown site %s", site)
+		}
+		results[i] = &types.SiteResult{Site: site}
+	}
+
+	params := &types.TopologyParams{GremlinQuery: query.GremlinQuery, Bindings: query.Bindings}
+
+	var wg sync.WaitGroup
+	for _, result := range results {
+		wg.Add(1)
+		go func(result *types.SiteResult) {
+			defer wg.Done()
+
+			data, err := f.querySite(f.sites[result.Site], params)
+			if err != nil {
+				result.Error = err.Error()
+				return
+			}
+			result.Result = data
+		}(result)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+func newFederationQuerier(sites map[string]string, authOpts *shttp.AuthenticationOpts) (*federationQuerier, error) {
+	tlsConfig, err := config.GetTLSClientConfig(true)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &federationQuerier{sites: make(map[string]*shttp.RestClient)}
+	for site, address := range sites {
+		sa, err := common.ServiceAddressFromString(address)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid address %s of site %s: %s", address, site, err)
+		}
+		f.sites[site] = shttp.NewRestClient(config.GetURL("http", sa.Addr, sa.Port, "/api/"), authOpts, tlsConfig)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package analyzer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	shttp "github.com/skydive-project/skydive/http"
+)
+
+func newSiteGraph(t *testing.T) *graph.Graph {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("site1", b, common.UnknownService)
+
+	host, _ := g.NewNode(graph.Identifier("host"), graph.Metadata{"Name": "site1", "Type": "host"})
+	bridge, _ := g.NewNode(graph.Identifier("bridge"), graph.Metadata{"Name": "br0", "Type": "bridge"})
+	intf, _ := g.NewNode(graph.Identifier("intf"), graph.Metadata{"Name": "eth0", "Type": "device"})
+	g.Link(host, bridge, graph.Metadata{"RelationType": "ownership"})
+	g.Link(bridge, intf, graph.Metadata{"RelationType": "layer2"})
+
+	return g
+}
+
+func TestFederationSummary(t *testing.T) {
+	g := newSiteGraph(t)
+
+	f := &federationPublisher{
+		graph:  g,
+		parser: traversal.NewGremlinTraversalParser(),
+		site:   "dc1",
+		origin: "analyzer.site1",
+		query:  "G.V().Has('Type', Within('host', 'bridge')).SubGraph()",
+	}
+
+	nodes, edges, err := f.siteElements()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodes) != 2 || nodes["host"] == nil || nodes["bridge"] == nil {
+		t.Fatalf("Expected the host and the bridge, got %v", nodes)
+	}
+	if len(edges) != 1 {
+		t.Fatalf("Only the edge between the host and the bridge should be part of the summary, got %v", edges)
+	}
+
+	for _, n := range nodes {
+		if site, _ := n.GetFieldString("Site"); site != "dc1" || n.Origin != "analyzer.site1" {
+			t.Errorf("The node %s should be tagged with the site, got %v from %s", n.ID, n.Metadata, n.Origin)
+		}
+	}
+	for _, e := range edges {
+		if site, _ := e.GetFieldString("Site"); site != "dc1" || e.Origin != "analyzer.site1" {
+			t.Errorf("The edge %s should be tagged with the site, got %v from %s", e.ID, e.Metadata, e.Origin)
+		}
+	}
+
+	// the nodes of the site are left untouched
+	g.RLock()
+	host := g.GetNode("host")
+	g.RUnlock()
+	if _, err := host.GetFieldString("Site"); err == nil {
+		t.Error("The metadata of the nodes of the site should not be modified")
+	}
+
+	f.query = "G.V().Has('Type', 'host')"
+	if _, _, err := f.siteElements(); err == nil {
+		t.Error("A summary query not returning a SubGraph should fail")
+	}
+}
+
+func TestFederationFlowFilter(t *testing.T) {
+	if newFlowFilter(nil) != nil {
+		t.Error("No flow should be forwarded without filter")
+	}
+
+	filter := newFlowFilter(map[string]string{"Application": "TCP", "NodeTID": "123"})
+
+	for _, test := range []struct {
+		flow     *flow.Flow
+		expected bool
+	}{
+		{&flow.Flow{Application: "TCP", NodeTID: "123"}, true},
+		{&flow.Flow{Application: "UDP", NodeTID: "123"}, false},
+		{&flow.Flow{Application: "TCP", NodeTID: "456"}, false},
+	} {
+		if filter.Eval(test.flow) != test.expected {
+			t.Errorf("Expected %v for the flow %s/%s", test.expected, test.flow.Application, test.flow.NodeTID)
+		}
+	}
+}
+
+func TestFederatedQuery(t *testing.T) {
+	var received types.TopologyParams
+	site := func(status int, body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" || r.URL.Path != "/api/topology" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&received)
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}))
+	}
+
+	dc1 := site(http.StatusOK, `[{"ID":"host"}]`)
+	defer dc1.Close()
+	dc2 := site(http.StatusInternalServerError, "backend unavailable")
+	defer dc2.Close()
+	dc3 := site(http.StatusNoContent, "")
+	defer dc3.Close()
+
+	f := &federationQuerier{sites: make(map[string]*shttp.RestClient)}
+	for name, server := range map[string]*httptest.Server{"dc1": dc1, "dc2": dc2, "dc3": dc3} {
+		u, _ := url.Parse(server.URL + "/api/")
+		f.sites[name] = shttp.NewRestClient(u, nil, nil)
+	}
+
+	query := &types.FederatedQuery{GremlinQuery: "G.V().Has('Name', $name)", Bindings: map[string]interface{}{"name": "eth0"}}
+	results, err := f.QuerySites(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 || results[0].Site != "dc1" || results[1].Site != "dc2" || results[2].Site != "dc3" {
+		t.Fatalf("Expected the results of all the sites, sorted, got %+v", results)
+	}
+	if string(results[0].Result) != `[{"ID":"host"}]` || results[0].Error != "" {
+		t.Errorf("Unexpected result of dc1: %+v", results[0])
+	}
+	if results[1].Result != nil || results[1].Error == "" {
+		t.Errorf("The failure of dc2 should be reported, got %+v", results[1])
+	}
+	if results[2].Result != nil || results[2].Error != "" {
+		t.Errorf("dc3 should return an empty result, got %+v", results[2])
+	}
+	if received.GremlinQuery != query.GremlinQuery || received.Bindings["name"] != "eth0" {
+		t.Errorf("The query should be sent as is, got %+v", received)
+	}
+
+	query.Sites = []string{"dc3"}
+	if results, err = f.QuerySites(query); err != nil || len(results) != 1 || results[0].Site != "dc3" {
+		t.Errorf("Only dc3 should be queried, got %+v (%v)", results, err)
+	}
+
+	query.Sites = []string{"dc4"}
+	if _, err = f.QuerySites(query); err == nil {
+		t.Error("Querying an unknown site should fail")
+	}
+}
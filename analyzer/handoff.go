@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package analyzer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// handoffState is the in-memory state an analyzer saves when it stops and
+// the next instance restores, so that a restart does not disturb its agents
+// and subscribers
+type handoffState struct {
+	Time time.Time
+	// replay log of the subscribers, which resume from their last sequence
+	ReplayLog *ws.ReplayLogState `json:",omitempty"`
+	// protobuf encoded flow.Message of the flows not yet handled
+	Flows []byte `json:",omitempty"`
+	// captures and packet injections registered on the agents
+	Captures   map[graph.Identifier]map[string]bool `json:",omitempty"`
+	Injections map[graph.Identifier]map[string]bool `json:",omitempty"`
+}
+
+// handoff saves and restores the state of the analyzer to and from a file
+type handoff struct {
+	path   string
+	maxAge time.Duration
+}
+
+func (h *handoff) save(state *handoffState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	// the state is written at once, a partially written file would be
+	// taken for a valid one
+	tmp := h.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, h.path)
+}
+
+// load returns the saved state, nil if there is none or if it is too old to
+// be relevant. The state is removed so that it is restored only once.
+func (h *handoff) load() (*handoffState, error) {
+	data, err := ioutil.ReadFile(h.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	os.Remove(h.path)
+
+	var state handoffState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	if age := time.Since(state.Time); age > h.maxAge {
+		logging.GetLogger().Infof("Ignoring the state saved %s ago in %s", age, h.path)
+		return nil, nil
+	}
+
+	return &state, nil
+}
+
+// handOff stops the flow server and saves the state of the analyzer
+func (s *Server) handOff() error {
+	state := &handoffState{
+		Time:       time.Now(),
+		Captures:   s.onDemandClient.RegisteredTasks(),
+		Injections: s.piClient.RegisteredTasks(),
+	}
+
+	if flows := s.flowServer.Drain(); len(flows) > 0 {
+		msg := flow.Message{Flows: flows}
+		data, err := msg.Marshal()
+		if err != nil {
+			return err
+		}
+		state.Flows = data
+	}
+
+	replayLog, err := s.hub.SubscriberEndpoint().ReplayLogState()
+	if err != nil {
+		return err
+	}
+	state.ReplayLog = replayLog
+
+	if err := s.handoff.save(state); err != nil {
+		return err
+	}
+
+	logging.GetLogger().Infof("State saved in %s", s.handoff.path)
+	return nil
+}
+
+// takeOver restores the state saved by the previous instance, returning the
+// flows it did not handle
+func (s *Server) takeOver() ([]*flow.Flow, error) {
+	state, err := s.handoff.load()
+	if err != nil || state == nil {
+		return nil, err
+	}
+
+	logging.GetLogger().Infof("Restoring the state saved in %s at %s", s.handoff.path, state.Time)
+
+	if state.ReplayLog != nil {
+		if err := s.hub.SubscriberEndpoint().RestoreReplayLog(state.ReplayLog); err != nil {
+			return nil, err
+		}
+	}
+
+	s.onDemandClient.RestoreRegisteredTasks(state.Captures)
+	s.piClient.RestoreRegisteredTasks(state.Injections)
+
+	var msg flow.Message
+	if err := msg.Unmarshal(state.Flows); err != nil {
+		return nil, err
+	}
+
+	return msg.Flows, nil
+}
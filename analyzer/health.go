@@ -0,0 +1,81 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package analyzer
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// healthRequestTimeout is the time an agent has to report its health
+const healthRequestTimeout = 2 * time.Second
+
+func (s *Server) requestAgentHealth(host string) *types.AgentHealth {
+	msg := ws.NewStructMessage(types.HealthNamespace, "HealthRequest", nil)
+
+	resp, err := s.hub.PodServer().Request(host, msg, healthRequestTimeout)
+
+	var health types.AgentHealth
+	if err == nil {
+		err = json.Unmarshal(resp.Obj, &health)
+	}
+
+	if err != nil {
+		health = types.AgentHealth{Time: time.Now()}
+		health.AddIssue("Failed to retrieve the health of the agent: %s", err)
+	}
+	return &health
+}
+
+// agentsHealth requests the connected agents for their health and returns
+// it along with the sorted hosts of the unhealthy agents
+func (s *Server) agentsHealth() (map[string]*types.AgentHealth, []string) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+
+	healths := make(map[string]*types.AgentHealth)
+	for _, speaker := range s.hub.PodServer().GetSpeakersByType(common.AgentService) {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+
+			health := s.requestAgentHealth(host)
+
+			lock.Lock()
+			healths[host] = health
+			lock.Unlock()
+		}(speaker.GetRemoteHost())
+	}
+	wg.Wait()
+
+	var unhealthy []string
+	for host, health := range healths {
+		if !health.Healthy {
+			unhealthy = append(unhealthy, host)
+		}
+	}
+	sort.Strings(unhealthy)
+
+	return healths, unhealthy
+}
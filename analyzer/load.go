@@ -0,0 +1,63 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package analyzer
+
+import (
+	"net/http"
+
+	"github.com/shirou/gopsutil/cpu"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// loadReporter replies to the load requests of the agents, used to check
+// the analyzer and to balance the agents
+type loadReporter struct {
+	pool *ws.StructServer
+}
+
+// GetLoad returns the load of the analyzer
+func (l *loadReporter) GetLoad() *types.AnalyzerLoad {
+	load := &types.AnalyzerLoad{
+		Agents: len(l.pool.GetSpeakersByType(common.AgentService)),
+	}
+
+	// usage since the previous call
+	if percents, err := cpu.Percent(0, false); err == nil && len(percents) > 0 {
+		load.CPU = percents[0]
+	}
+
+	return load
+}
+
+// OnStructMessage replies to the load requests
+func (l *loadReporter) OnStructMessage(c ws.Speaker, msg *ws.StructMessage) {
+	if msg.Type != "LoadRequest" {
+		return
+	}
+
+	c.SendMessage(msg.Reply(l.GetLoad(), "LoadReply", http.StatusOK))
+}
+
+func newLoadReporter(pool *ws.StructServer) *loadReporter {
+	l := &loadReporter{pool: pool}
+	pool.AddStructMessageHandler(l, []string{types.LoadNamespace})
+	return l
+}
@@ -26,8 +26,13 @@ import (
 	"github.com/skydive-project/skydive/plugin"
 	"github.com/skydive-project/skydive/probe"
 	"github.com/skydive-project/skydive/sflow"
+	"github.com/skydive-project/skydive/topology/probes/bgp"
+	"github.com/skydive-project/skydive/topology/probes/cilium"
+	"github.com/skydive-project/skydive/topology/probes/cri"
 	"github.com/skydive-project/skydive/topology/probes/docker"
 	"github.com/skydive-project/skydive/topology/probes/fabric"
+	"github.com/skydive-project/skydive/topology/probes/firewall"
+	"github.com/skydive-project/skydive/topology/probes/gnmi"
 	"github.com/skydive-project/skydive/topology/probes/istio"
 	"github.com/skydive-project/skydive/topology/probes/k8s"
 	"github.com/skydive-project/skydive/topology/probes/libvirt"
@@ -41,6 +46,8 @@ import (
 	"github.com/skydive-project/skydive/topology/probes/ovsdb"
 	"github.com/skydive-project/skydive/topology/probes/peering"
 	"github.com/skydive-project/skydive/topology/probes/runc"
+	"github.com/skydive-project/skydive/topology/probes/snmp"
+	"github.com/skydive-project/skydive/topology/probes/vsphere"
 )
 
 func registerStaticProbes() {
@@ -54,6 +61,13 @@ func registerStaticProbes() {
 	runc.Register()
 	libvirt.Register()
 	ovn.Register()
+	bgp.Register()
+	cilium.Register()
+	cri.Register()
+	firewall.Register()
+	vsphere.Register()
+	snmp.Register()
+	gnmi.Register()
 }
 
 func registerPluginProbes() error {
@@ -114,13 +128,20 @@ func NewTopologyProbeBundleFromConfig(g *graph.Graph) (*probe.Bundle, error) {
 		switch t {
 		case "ovn":
 			addr := config.GetString("analyzer.topology.ovn.address")
-			handler, err = ovn.NewProbe(g, addr)
+			sbAddr := config.GetString("analyzer.topology.ovn.sb_address")
+			handler, err = ovn.NewProbe(g, addr, sbAddr)
 		case "k8s":
 			handler, err = k8s.NewK8sProbe(g)
 		case "istio":
 			handler, err = istio.NewIstioProbe(g)
 		case "nsm":
 			handler, err = nsm.NewNsmProbe(g)
+		case "vsphere":
+			handler, err = vsphere.NewProbe(g)
+		case "snmp":
+			handler, err = snmp.NewProbe(g)
+		case "gnmi":
+			handler, err = gnmi.NewProbe(g)
 		default:
 			logging.GetLogger().Errorf("unknown probe type: %s", t)
 			continue
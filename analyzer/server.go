@@ -18,6 +18,7 @@
 package analyzer
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
@@ -25,12 +26,18 @@ import (
 
 	"github.com/skydive-project/dede/dede"
 	"github.com/skydive-project/skydive/alert"
+	"github.com/skydive-project/skydive/api/grpc"
 	api "github.com/skydive-project/skydive/api/server"
 	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/audit"
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/dependency"
+	"github.com/skydive-project/skydive/detection"
 	"github.com/skydive-project/skydive/etcd"
 	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/flow/encryption"
+	"github.com/skydive-project/skydive/flow/masking"
 	ondemand "github.com/skydive-project/skydive/flow/ondemand/client"
 	"github.com/skydive-project/skydive/flow/server"
 	"github.com/skydive-project/skydive/flow/storage"
@@ -39,14 +46,24 @@ import (
 	"github.com/skydive-project/skydive/graffiti/hub"
 	ge "github.com/skydive-project/skydive/gremlin/traversal"
 	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/ids"
+	"github.com/skydive-project/skydive/latency"
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/ondemand/client"
 	"github.com/skydive-project/skydive/packetinjector"
+	"github.com/skydive-project/skydive/pathcheck"
 	"github.com/skydive-project/skydive/probe"
+	"github.com/skydive-project/skydive/ratelimit"
 	"github.com/skydive-project/skydive/sflow"
+	"github.com/skydive-project/skydive/tagging"
+	"github.com/skydive-project/skydive/topn"
 	"github.com/skydive-project/skydive/topology"
 	usertopology "github.com/skydive-project/skydive/topology/enhancers"
+	"github.com/skydive-project/skydive/topology/probes/istio"
+	"github.com/skydive-project/skydive/topology/probes/k8s"
+	"github.com/skydive-project/skydive/tracing"
 	"github.com/skydive-project/skydive/ui"
+	"github.com/skydive-project/skydive/webhook"
 	"github.com/skydive-project/skydive/websocket"
 	ws "github.com/skydive-project/skydive/websocket"
 )
@@ -69,30 +86,53 @@ type Status struct {
 	Alerts      ElectionStatus
 	Captures    ElectionStatus
 	Probes      map[string]interface{}
+	// health of the connected agents and hosts of the ones reporting issues
+	AgentsHealth    map[string]*types.AgentHealth
+	UnhealthyAgents []string
+	Cluster         *ClusterStatus `json:",omitempty"`
+	Load            *types.AnalyzerLoad
+	RateLimit       *types.RateLimitStatus
+	Flows           *types.FlowServerStatus
 }
 
 // Server describes an Analyzer servers mechanism like http, websocket, topology, ondemand probes, ...
 type Server struct {
-	httpServer      *shttp.Server
-	uiServer        *ui.Server
-	hub             *hub.Hub
-	alertServer     *alert.Server
-	onDemandClient  *client.OnDemandClient
-	piClient        *client.OnDemandClient
-	topologyManager *usertopology.TopologyManager
-	flowServer      *server.FlowServer
-	probeBundle     *probe.Bundle
-	storage         storage.Storage
-	embeddedEtcd    *etcd.EmbeddedEtcd
-	etcdClient      *etcd.Client
-	wgServers       sync.WaitGroup
+	httpServer       *shttp.Server
+	uiServer         *ui.Server
+	hub              *hub.Hub
+	alertServer      *alert.Server
+	pathCheckServer  *pathcheck.Server
+	taggingServer    *tagging.Server
+	webhookServer    *webhook.Server
+	apiTokenAPI      *api.APITokenAPI
+	captureWatchers  []api.StoppableWatcher
+	limiter          *ratelimit.Limiter
+	latencyServer    *latency.Server
+	dependencyServer *dependency.Server
+	topNServer       *topn.Server
+	detectionServer  *detection.Server
+	grpcServer       *grpc.Server
+	onDemandClient   *client.OnDemandClient
+	piClient         *client.OnDemandClient
+	topologyManager  *usertopology.TopologyManager
+	flowServer       *server.FlowServer
+	probeBundle      *probe.Bundle
+	storage          storage.Storage
+	embeddedEtcd     *etcd.EmbeddedEtcd
+	etcdClient       *etcd.Client
+	cluster          *cluster
+	federation       *federationPublisher
+	loadReporter     *loadReporter
+	handoff          *handoff
+	wgServers        sync.WaitGroup
 }
 
 // GetStatus returns the status of an analyzer
 func (s *Server) GetStatus() interface{} {
 	hubStatus := s.hub.GetStatus()
+	agentsHealth, unhealthyAgents := s.agentsHealth()
 
-	return &Status{
+	status := &Status{
 		Agents:      hubStatus.Pods,
 		Peers:       hubStatus.Peers,
 		Publishers:  hubStatus.Publishers,
@@ -100,7 +140,19 @@ func (s *Server) GetStatus() interface{} {
 		Alerts:      ElectionStatus{IsMaster: s.alertServer.IsMaster()},
 		Captures:    ElectionStatus{IsMaster: s.onDemandClient.IsMaster()},
 		Probes:      s.probeBundle.GetStatus(),
+
+		AgentsHealth:    agentsHealth,
+		UnhealthyAgents: unhealthyAgents,
+		Load:            s.loadReporter.GetLoad(),
+		RateLimit:       s.limiter.GetStatus(),
+		Flows:           s.flowServer.GetStatus(),
+	}
+
+	if s.cluster != nil {
+		status.Cluster = s.cluster.GetStatus()
 	}
+
+	return status
 }
 
 // createStartupCapture creates capture based on preconfigured selected SubGraph
@@ -124,6 +176,16 @@ func (s *Server) Start() error {
 		s.storage.Start()
 	}
 
+	var flows []*flow.Flow
+	if s.handoff != nil {
+		var err error
+		if flows, err = s.takeOver(); err != nil {
+			logging.GetLogger().Errorf("Unable to restore the state of the previous instance: %s", err)
+		}
+	}
+
+	s.apiTokenAPI.Start()
+
 	if err := s.httpServer.Listen(); err != nil {
 		return err
 	}
@@ -133,8 +195,34 @@ func (s *Server) Start() error {
 	s.onDemandClient.Start()
 	s.piClient.Start()
 	s.alertServer.Start()
+	s.pathCheckServer.Start()
+	s.taggingServer.Start()
+	s.webhookServer.Start()
 	s.topologyManager.Start()
+	s.latencyServer.Start()
+	s.dependencyServer.Start()
+	s.topNServer.Start()
+	s.detectionServer.Start()
 	s.flowServer.Start()
+	if len(flows) > 0 {
+		s.flowServer.Inject(flows)
+	}
+
+	if s.cluster != nil {
+		if err := s.cluster.Start(); err != nil {
+			return err
+		}
+	}
+
+	if s.federation != nil {
+		s.federation.Start()
+	}
+
+	if s.grpcServer != nil {
+		if err := s.grpcServer.Start(); err != nil {
+			return err
+		}
+	}
 
 	s.wgServers.Add(1)
 	go func() {
@@ -148,13 +236,39 @@ func (s *Server) Start() error {
 // Stop the analyzer server
 func (s *Server) Stop() {
 	s.hub.Stop()
-	s.flowServer.Stop()
+	if s.grpcServer != nil {
+		s.grpcServer.Stop()
+	}
+	if s.handoff != nil {
+		if err := s.handOff(); err != nil {
+			logging.GetLogger().Errorf("Unable to save the state for the next instance: %s", err)
+		}
+	} else {
+		s.flowServer.Stop()
+	}
+	s.latencyServer.Stop()
+	s.dependencyServer.Stop()
+	s.topNServer.Stop()
+	s.detectionServer.Stop()
 	s.httpServer.Stop()
+	s.apiTokenAPI.Stop()
+	for _, watcher := range s.captureWatchers {
+		watcher.Stop()
+	}
 	s.probeBundle.Stop()
 	s.onDemandClient.Stop()
 	s.piClient.Stop()
 	s.alertServer.Stop()
+	s.pathCheckServer.Stop()
+	s.taggingServer.Stop()
+	s.webhookServer.Stop()
 	s.topologyManager.Stop()
+	if s.cluster != nil {
+		s.cluster.Stop()
+	}
+	if s.federation != nil {
+		s.federation.Stop()
+	}
 	s.etcdClient.Stop()
 	s.wgServers.Wait()
 	if s.embeddedEtcd != nil {
@@ -168,6 +282,8 @@ func (s *Server) Stop() {
 	}); ok {
 		tr.CloseIdleConnections()
 	}
+
+	tracing.Shutdown()
 }
 
 // NewServerFromConfig creates a new empty server
@@ -175,8 +291,12 @@ func NewServerFromConfig() (*Server, error) {
 	embedEtcd := config.GetBool("etcd.embedded")
 	host := config.GetString("host_id")
 
+	etcdTLS, err := config.GetTLSClientConfig(true)
+	if err != nil {
+		return nil, err
+	}
+
 	var embeddedEtcd *etcd.EmbeddedEtcd
-	var err error
 	if embedEtcd {
 		name := config.GetString("etcd.name")
 		dataDir := config.GetString("etcd.data_dir")
@@ -185,17 +305,25 @@ func NewServerFromConfig() (*Server, error) {
 		maxSnapFiles := uint(config.GetInt("etcd.max_snap_files"))
 		debug := config.GetBool("etcd.debug")
 		peers := config.GetStringMapString("etcd.peers")
+		tlsInfo, err := config.GetEtcdServerTLSInfo()
+		if err != nil {
+			return nil, err
+		}
 
-		if embeddedEtcd, err = etcd.NewEmbeddedEtcd(name, listen, peers, dataDir, maxWalFiles, maxSnapFiles, debug); err != nil {
+		if embeddedEtcd, err = etcd.NewEmbeddedEtcd(name, listen, peers, dataDir, maxWalFiles, maxSnapFiles, debug, tlsInfo, etcdTLS); err != nil {
 			return nil, err
 		}
 	}
 
 	service := common.Service{ID: host, Type: common.AnalyzerService}
 
+	if err := config.InitTracing(service); err != nil {
+		return nil, err
+	}
+
 	etcdServers := config.GetEtcdServerAddrs()
 	etcdTimeout := config.GetInt("etcd.client_timeout")
-	etcdClient, err := etcd.NewClient(service, etcdServers, time.Duration(etcdTimeout)*time.Second)
+	etcdClient, err := etcd.NewClient(service, etcdServers, time.Duration(etcdTimeout)*time.Second, etcdTLS)
 	if err != nil {
 		return nil, err
 	}
@@ -255,6 +383,21 @@ func NewServerFromConfig() (*Server, error) {
 		return nil, err
 	}
 
+	// service accounts authenticate with their API tokens on top of the
+	// API backend
+	apiTokenAPI := api.NewAPITokenAPI(etcdClient.KeysAPI)
+	apiAuthBackend = shttp.NewTokenAuthenticationBackend(apiAuthBackend, apiTokenAPI)
+
+	var auditor *audit.Auditor
+	if config.GetBool("analyzer.audit.enabled") {
+		ttl := time.Duration(config.GetInt("analyzer.audit.ttl")) * time.Second
+		auditor = audit.NewAuditor(etcdClient.KeysAPI, host, ttl, config.GetInt("analyzer.audit.max_payload"), config.GetBool("analyzer.audit.reads"))
+		apiAuthBackend = auditor.Wrap(apiAuthBackend)
+	}
+
+	limiter := ratelimit.NewLimiterFromConfig()
+	apiAuthBackend = limiter.Wrap(apiAuthBackend)
+
 	peers, err := config.GetAnalyzerServiceAddresses()
 	if err != nil {
 		return nil, fmt.Errorf("Unable to get the analyzers list: %s", err)
@@ -267,12 +410,14 @@ func NewServerFromConfig() (*Server, error) {
 
 	opts := hub.Opts{
 		ServerOpts: websocket.ServerOpts{
-			WriteCompression: true,
+			Compression:      config.GetBool("http.ws.enable_compression"),
+			WriteCompression: config.GetBool("http.ws.enable_write_compression"),
 			QueueSize:        10000,
 			PingDelay:        2 * time.Second,
 			PongTimeout:      5 * time.Second,
 		},
-		Validator: validator,
+		Validator:     validator,
+		ReplayLogSize: config.GetInt("http.ws.replay_log_size"),
 	}
 
 	clusterAuthOptions := ClusterAuthenticationOpts()
@@ -281,13 +426,32 @@ func NewServerFromConfig() (*Server, error) {
 		return nil, err
 	}
 
-	tableClient := flow.NewWSTableClient(hub.PodServer())
+	masker, err := masking.NewMaskerFromConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// the flows of the agents are masked as well when queried live
+	tableClient := masking.NewTableClient(flow.NewWSTableClient(hub.PodServer()), masker)
 
 	storage, err := newFlowBackendFromConfig(etcdClient)
 	if err != nil {
 		return nil, err
 	}
 
+	keyProvider, err := encryption.NewKeyProviderFromConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var encryptor *encryption.Encryptor
+	if keyProvider != nil {
+		encryptor = encryption.NewEncryptor(keyProvider, etcdClient.KeysAPI)
+		if storage != nil {
+			storage = encryption.NewStorage(storage, encryptor)
+		}
+	}
+
 	// declare all extension available through API and filtering
 	tr := traversal.NewGremlinTraversalParser()
 	tr.AddTraversalExtension(ge.NewMetricsTraversalExtension())
@@ -296,7 +460,11 @@ func NewServerFromConfig() (*Server, error) {
 	tr.AddTraversalExtension(ge.NewSocketsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewDescendantsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewNextHopTraversalExtension())
+	tr.AddTraversalExtension(ge.NewNeighborConflictsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewGroupTraversalExtension())
+	tr.AddTraversalExtension(ge.NewDiffTraversalExtension())
+	tr.AddTraversalExtension(ge.NewAggregationTraversalExtension())
+	tr.AddTraversalExtension(ge.NewPathsTraversalExtension())
 
 	probeBundle, err := NewTopologyProbeBundleFromConfig(g)
 	if err != nil {
@@ -306,6 +474,7 @@ func NewServerFromConfig() (*Server, error) {
 	// new flow subscriber endpoints
 	flowSubscriberWSServer := ws.NewStructServer(config.NewWSServer(hserver, "/ws/subscriber/flow", apiAuthBackend))
 	flowSubscriberEndpoint := server.NewFlowSubscriberEndpoint(flowSubscriberWSServer)
+	flowSubscriberEndpoint.RegisterSSEEndpoint(hserver, "/sse/subscriber/flow", apiAuthBackend, config.GetInt("http.ws.queue_size"))
 
 	apiServer, err := api.NewAPI(hserver, etcdClient.KeysAPI, service, apiAuthBackend)
 	if err != nil {
@@ -316,6 +485,10 @@ func NewServerFromConfig() (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	captureWatchers := []api.StoppableWatcher{captureAPIHandler.AsyncWatch(masker.OnCaptureEvent)}
+	if encryptor != nil {
+		captureWatchers = append(captureWatchers, captureAPIHandler.AsyncWatch(encryptor.OnCaptureEvent))
+	}
 
 	piAPIHandler, err := api.RegisterPacketInjectorAPI(g, apiServer, apiAuthBackend)
 	if err != nil {
@@ -324,6 +497,10 @@ func NewServerFromConfig() (*Server, error) {
 
 	piClient := packetinjector.NewOnDemandInjectionClient(g, piAPIHandler, hub.PodServer(), hub.SubscriberServer(), etcdClient)
 
+	if _, err := api.RegisterMetadataFieldAPI(apiServer, validator, persistent, apiAuthBackend); err != nil {
+		return nil, err
+	}
+
 	nodeAPIHandler, err := api.RegisterNodeRuleAPI(apiServer, g, apiAuthBackend)
 	if err != nil {
 		return nil, err
@@ -334,7 +511,7 @@ func NewServerFromConfig() (*Server, error) {
 	}
 	topologyManager := usertopology.NewTopologyManager(etcdClient, nodeAPIHandler, edgeAPIHandler, g)
 
-	if _, err = api.RegisterAlertAPI(apiServer, apiAuthBackend); err != nil {
+	if _, err = api.RegisterAlertAPI(apiServer, g, apiAuthBackend); err != nil {
 		return nil, err
 	}
 
@@ -342,40 +519,152 @@ func NewServerFromConfig() (*Server, error) {
 		return nil, err
 	}
 
+	if _, err := api.RegisterPathCheckAPI(apiServer, apiAuthBackend); err != nil {
+		return nil, err
+	}
+
+	if _, err := api.RegisterTaggingRuleAPI(apiServer, apiAuthBackend); err != nil {
+		return nil, err
+	}
+
+	if _, err := api.RegisterSavedQueryAPI(apiServer, g, tr, apiAuthBackend); err != nil {
+		return nil, err
+	}
+
+	if _, err := api.RegisterWebhookAPI(apiServer, apiAuthBackend); err != nil {
+		return nil, err
+	}
+
+	if err := api.RegisterAPITokenAPI(apiServer, apiTokenAPI, apiAuthBackend); err != nil {
+		return nil, err
+	}
+
+	if auditor != nil {
+		api.RegisterAuditAPI(hserver, auditor, apiAuthBackend)
+	}
+
+	api.RegisterApplyAPI(apiServer, apiAuthBackend)
+
 	onDemandClient := ondemand.NewOnDemandFlowProbeClient(g, captureAPIHandler, hub.PodServer(), hub.SubscriberServer(), etcdClient)
 
 	flowServer, err := server.NewFlowServer(hserver, g, storage, flowSubscriberEndpoint, probeBundle, clusterAuthBackend)
 	if err != nil {
 		return nil, err
 	}
+	flowServer.SetMasker(masker)
+
+	latencyServer := latency.NewServer(g, hub.SubscriberServer())
+	flowServer.AddListener(latencyServer)
+
+	dependencyServer := dependency.NewServer(g)
+	flowServer.AddListener(dependencyServer)
+
+	topNServer := topn.NewServer()
+	flowServer.AddListener(topNServer)
+
+	detectionServer := detection.NewServer(hub.SubscriberServer())
+	flowServer.AddListener(detectionServer)
+
+	policyVerifier := k8s.NewPolicyVerifier(hub.SubscriberServer())
+	flowServer.AddListener(policyVerifier)
+	flowServer.AddListener(istio.NewMeshVerifier(g))
+
+	correlationWindow := time.Duration(config.GetInt("analyzer.ids.correlation_window")) * time.Second
+	idsCorrelator := ids.NewCorrelator(g, tr, hub.SubscriberServer(), correlationWindow)
 
 	alertServer, err := alert.NewServer(apiServer, hub.SubscriberServer(), g, tr, etcdClient)
 	if err != nil {
 		return nil, err
 	}
 
+	pathCheckServer := pathcheck.NewServer(apiServer, hub.SubscriberServer(), g, tr, etcdClient)
+
+	taggingServer := tagging.NewServer(apiServer, g, tr, etcdClient)
+
+	webhookServer := webhook.NewServer(apiServer, etcdClient)
+
 	s := &Server{
-		httpServer:      hserver,
-		hub:             hub,
-		probeBundle:     probeBundle,
-		embeddedEtcd:    embeddedEtcd,
-		etcdClient:      etcdClient,
-		onDemandClient:  onDemandClient,
-		piClient:        piClient,
-		topologyManager: topologyManager,
-		storage:         storage,
-		flowServer:      flowServer,
-		alertServer:     alertServer,
+		httpServer:       hserver,
+		hub:              hub,
+		probeBundle:      probeBundle,
+		embeddedEtcd:     embeddedEtcd,
+		etcdClient:       etcdClient,
+		onDemandClient:   onDemandClient,
+		piClient:         piClient,
+		topologyManager:  topologyManager,
+		storage:          storage,
+		flowServer:       flowServer,
+		alertServer:      alertServer,
+		pathCheckServer:  pathCheckServer,
+		taggingServer:    taggingServer,
+		webhookServer:    webhookServer,
+		apiTokenAPI:      apiTokenAPI,
+		captureWatchers:  captureWatchers,
+		limiter:          limiter,
+		latencyServer:    latencyServer,
+		dependencyServer: dependencyServer,
+		topNServer:       topNServer,
+		detectionServer:  detectionServer,
+		loadReporter:     newLoadReporter(hub.PodServer()),
+	}
+
+	if path := config.GetString("analyzer.handoff.path"); path != "" {
+		s.handoff = &handoff{path: path, maxAge: time.Duration(config.GetInt("analyzer.handoff.max_age")) * time.Second}
+	}
+
+	if config.GetBool("analyzer.clustering.enabled") {
+		s.cluster = newCluster(host, etcdClient, config.GetInt("analyzer.clustering.replicas"), hub.PodServer())
+	}
+
+	// a site analyzer forwards a summary of its topology to the global one
+	if global := config.GetString("analyzer.federation.global"); global != "" {
+		site := config.GetString("analyzer.federation.site")
+		if site == "" {
+			return nil, errors.New("The site name is required to forward its topology to the global analyzer")
+		}
+
+		if s.federation, err = newFederationPublisher(g, tr, host, site, global, clusterAuthOptions); err != nil {
+			return nil, err
+		}
+		flowServer.AddListener(s.federation)
+	}
+
+	if addr := config.GetString("analyzer.grpc.listen"); addr != "" {
+		if s.grpcServer, err = grpc.NewServer(addr, g, tr, apiServer, apiAuthBackend, auditor, limiter); err != nil {
+			return nil, err
+		}
 	}
 
 	s.createStartupCapture(captureAPIHandler)
 
 	api.RegisterTopologyAPI(hserver, g, tr, apiAuthBackend)
+	api.RegisterSQLAPI(hserver, g, tr, apiAuthBackend)
+	api.RegisterBandwidthAPI(hserver, g, tr, apiAuthBackend)
+	if err := api.RegisterGraphQLAPI(hserver, g, tr, apiAuthBackend); err != nil {
+		return nil, err
+	}
+	api.RegisterJobAPI(hserver, g, tr, apiAuthBackend)
 	api.RegisterPcapAPI(hserver, storage, apiAuthBackend)
 	api.RegisterConfigAPI(hserver, apiAuthBackend)
 	api.RegisterStatusAPI(hserver, s, apiAuthBackend)
+	api.RegisterDiagnosticsAPI(hserver, service, s, apiAuthBackend)
+	api.RegisterLoggingAPI(hserver, apiAuthBackend)
+	api.RegisterLatencyAPI(hserver, latencyServer, apiAuthBackend)
+	api.RegisterDependencyAPI(hserver, dependencyServer, apiAuthBackend)
+	api.RegisterTopNAPI(hserver, topNServer, apiAuthBackend)
+	api.RegisterIDSAPI(hserver, idsCorrelator, apiAuthBackend)
+	api.RegisterAlertBacktestAPI(hserver, alertServer, apiAuthBackend)
+	api.RegisterPolicyVerificationAPI(hserver, policyVerifier, apiAuthBackend)
 	api.RegisterWorkflowCallAPI(hserver, apiAuthBackend, apiServer, g, tr)
 
+	if sites := config.GetStringMapString("analyzer.federation.sites"); len(sites) > 0 {
+		querier, err := newFederationQuerier(sites, clusterAuthOptions)
+		if err != nil {
+			return nil, err
+		}
+		api.RegisterFederationAPI(hserver, querier, apiAuthBackend)
+	}
+
 	if config.GetBool("analyzer.ssh_enabled") {
 		if err := dede.RegisterHandler("terminal", "/dede", hserver.Router); err != nil {
 			return nil, err
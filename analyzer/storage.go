@@ -19,6 +19,7 @@ package analyzer
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/etcd"
@@ -51,6 +52,17 @@ func NewESConfig(name ...string) es.Config {
 	return cfg
 }
 
+// newRetentionPolicy returns the graph history retention policy of the given backend
+func newRetentionPolicy(configPath string) graph.RetentionPolicy {
+	day := 24 * time.Hour
+
+	return graph.RetentionPolicy{
+		FullHistory: time.Duration(config.GetInt(configPath+".history_full_days")) * day,
+		MaxAge:      time.Duration(config.GetInt(configPath+".history_max_days")) * day,
+		Interval:    time.Duration(config.GetInt(configPath+".history_compaction_interval")) * time.Second,
+	}
+}
+
 func newGraphBackendFromConfig(etcdClient *etcd.Client) (graph.Backend, error) {
 	backend := config.GetString("analyzer.topology.backend")
 	configPath := "storage." + backend
@@ -90,7 +102,7 @@ func newGraphBackendFromConfig(etcdClient *etcd.Client) (graph.Backend, error) {
 				},
 			},
 		}
-		return graph.NewElasticSearchBackendFromConfig(cfg, dynamicTemplates, etcdClient)
+		return graph.NewElasticSearchBackendFromConfig(cfg, dynamicTemplates, newRetentionPolicy(configPath), etcdClient)
 	case "memory":
 		// cached memory will be used
 		return nil, nil
@@ -99,7 +111,7 @@ func newGraphBackendFromConfig(etcdClient *etcd.Client) (graph.Backend, error) {
 		database := config.GetString(configPath + ".database")
 		username := config.GetString(configPath + ".username")
 		password := config.GetString(configPath + ".password")
-		return graph.NewOrientDBBackend(addr, database, username, password, etcdClient)
+		return graph.NewOrientDBBackend(addr, database, username, password, newRetentionPolicy(configPath), etcdClient)
 	default:
 		return nil, fmt.Errorf("Topology backend driver '%s' not supported", driver)
 	}
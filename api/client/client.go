@@ -23,7 +23,10 @@ import (
 	"github.com/skydive-project/skydive/logging"
 )
 
-// NewCrudClientFromConfig creates a new REST client on /api
+// APIVersion is the version of the REST API the clients are written against
+const APIVersion = "v1"
+
+// NewCrudClientFromConfig creates a new REST client on the versioned API
 func NewCrudClientFromConfig(authOptions *shttp.AuthenticationOpts) (*shttp.CrudClient, error) {
 	tlsConfig, err := config.GetTLSClientConfig(true)
 	if err != nil {
@@ -36,7 +39,7 @@ func NewCrudClientFromConfig(authOptions *shttp.AuthenticationOpts) (*shttp.Crud
 		return nil, err
 	}
 
-	return shttp.NewCrudClient(config.GetURL("http", sa.Addr, sa.Port, "/api/"), authOptions, tlsConfig), nil
+	return shttp.NewCrudClient(config.GetURL("http", sa.Addr, sa.Port, "/api/"+APIVersion+"/"), authOptions, tlsConfig), nil
 }
 
 // NewRestClientFromConfig creates a new REST client
@@ -52,5 +55,5 @@ func NewRestClientFromConfig(authOptions *shttp.AuthenticationOpts) (*shttp.Rest
 		return nil, err
 	}
 
-	return shttp.NewRestClient(config.GetURL("http", sa.Addr, sa.Port, "/api/"), authOptions, tlsConfig), nil
+	return shttp.NewRestClient(config.GetURL("http", sa.Addr, sa.Port, "/api/"+APIVersion+"/"), authOptions, tlsConfig), nil
 }
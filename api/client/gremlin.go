@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 
 	"github.com/skydive-project/skydive/api/types"
 	"github.com/skydive-project/skydive/common"
@@ -42,13 +43,27 @@ type GremlinQueryHelper struct {
 
 // Request send a Gremlin request to the topology API
 func (g *GremlinQueryHelper) Request(query interface{}, header http.Header) (*http.Response, error) {
+	return g.RequestWithBindings(query, nil, header)
+}
+
+// RequestWithBindings send a Gremlin request to the topology API, the $name
+// parameters of the query being replaced by the values of the bindings
+func (g *GremlinQueryHelper) RequestWithBindings(query interface{}, bindings map[string]interface{}, header http.Header) (*http.Response, error) {
+	return g.RequestWithParams(&types.TopologyParams{
+		GremlinQuery: gremlin.NewQueryStringFromArgument(query).String(),
+		Bindings:     bindings,
+	}, header)
+}
+
+// RequestWithParams send a Gremlin request to the topology API along with
+// its bindings and the pagination of the result
+func (g *GremlinQueryHelper) RequestWithParams(params *types.TopologyParams, header http.Header) (*http.Response, error) {
 	client, err := NewRestClientFromConfig(g.authOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	gq := types.TopologyParams{GremlinQuery: gremlin.NewQueryStringFromArgument(query).String()}
-	s, err := json.Marshal(gq)
+	s, err := json.Marshal(params)
 	if err != nil {
 		return nil, err
 	}
@@ -60,7 +75,12 @@ func (g *GremlinQueryHelper) Request(query interface{}, header http.Header) (*ht
 
 // Query queries the topology API
 func (g *GremlinQueryHelper) Query(query interface{}) ([]byte, error) {
-	resp, err := g.Request(query, nil)
+	return g.QueryWithBindings(query, nil)
+}
+
+// QueryWithBindings queries the topology API with a parameterized query
+func (g *GremlinQueryHelper) QueryWithBindings(query interface{}, bindings map[string]interface{}) ([]byte, error) {
+	resp, err := g.RequestWithBindings(query, bindings, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -77,6 +97,31 @@ func (g *GremlinQueryHelper) Query(query interface{}) ([]byte, error) {
 	return data, nil
 }
 
+// QueryPage queries the topology API for a page of the result and returns it
+// along with the total number of items of the result
+func (g *GremlinQueryHelper) QueryPage(query interface{}, bindings map[string]interface{}, pagination types.Pagination) ([]byte, int, error) {
+	resp, err := g.RequestWithParams(&types.TopologyParams{
+		GremlinQuery: gremlin.NewQueryStringFromArgument(query).String(),
+		Bindings:     bindings,
+		Pagination:   pagination,
+	}, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("%s: %s", resp.Status, string(data))
+	}
+
+	total, _ := strconv.Atoi(resp.Header.Get("X-Total-Count"))
+	return data, total, nil
+}
+
 // GetInt64 parse the query result as int64
 func (g *GremlinQueryHelper) GetInt64(query interface{}) (int64, error) {
 	data, err := g.Query(query)
@@ -212,6 +257,26 @@ func (g *GremlinQueryHelper) GetFlowMetrics(query interface{}) (map[string][]*fl
 	return result[0], nil
 }
 
+// GetRawPackets returns the raw packets of the flows returned by a Gremlin
+// query ending with a RawPackets step, by flow UUID
+func (g *GremlinQueryHelper) GetRawPackets(query interface{}) (map[string][]*flow.RawPacket, error) {
+	data, err := g.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []map[string][]*flow.RawPacket
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+
+	if len(result) == 0 {
+		return nil, common.ErrNotFound
+	}
+
+	return result[0], nil
+}
+
 // GetFlowMetric from Gremlin query
 func (g *GremlinQueryHelper) GetFlowMetric(query interface{}) (*flow.FlowMetric, error) {
 	data, err := g.Query(query)
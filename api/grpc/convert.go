@@ -0,0 +1,192 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package grpc
+
+import (
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/flow"
+)
+
+func millisToTime(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+func timeToMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return common.UnixMillis(t)
+}
+
+// the start time of a capture is only set when its start is scheduled
+func startTimeFromMillis(ms int64) *time.Time {
+	if ms == 0 {
+		return nil
+	}
+	t := millisToTime(ms)
+	return &t
+}
+
+func startTimeToMillis(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return timeToMillis(*t)
+}
+
+func captureFromResource(c *types.Capture) *Capture {
+	return &Capture{
+		UUID:              c.UUID,
+		GremlinQuery:      c.GremlinQuery,
+		Selector:          c.Selector,
+		BPFFilter:         c.BPFFilter,
+		Name:              c.Name,
+		Description:       c.Description,
+		Type:              c.Type,
+		Count:             int64(c.Count),
+		Port:              int64(c.Port),
+		SamplingRate:      c.SamplingRate,
+		PollingInterval:   c.PollingInterval,
+		RawPacketLimit:    int64(c.RawPacketLimit),
+		HeaderSize:        int64(c.HeaderSize),
+		ExtraTCPMetric:    c.ExtraTCPMetric,
+		IPDefrag:          c.IPDefrag,
+		ReassembleTCP:     c.ReassembleTCP,
+		LayerKeyMode:      c.LayerKeyMode,
+		ExtraLayers:       c.ExtraLayers.Extract(),
+		Target:            c.Target,
+		TargetType:        c.TargetType,
+		StartTime:         startTimeToMillis(c.StartTime),
+		Duration:          c.Duration,
+		TTL:               c.TTL,
+		Masked:            c.Masked,
+		EncryptRawPackets: c.EncryptRawPackets,
+	}
+}
+
+func captureToResource(c *Capture) (*types.Capture, error) {
+	var extraLayers flow.ExtraLayers
+	if err := extraLayers.Parse(c.ExtraLayers...); err != nil {
+		return nil, err
+	}
+
+	capture := &types.Capture{
+		GremlinQuery:      c.GremlinQuery,
+		Selector:          c.Selector,
+		BPFFilter:         c.BPFFilter,
+		Name:              c.Name,
+		Description:       c.Description,
+		Type:              c.Type,
+		Port:              int(c.Port),
+		SamplingRate:      c.SamplingRate,
+		PollingInterval:   c.PollingInterval,
+		RawPacketLimit:    int(c.RawPacketLimit),
+		HeaderSize:        int(c.HeaderSize),
+		ExtraTCPMetric:    c.ExtraTCPMetric,
+		IPDefrag:          c.IPDefrag,
+		ReassembleTCP:     c.ReassembleTCP,
+		LayerKeyMode:      c.LayerKeyMode,
+		ExtraLayers:       extraLayers,
+		Target:            c.Target,
+		TargetType:        c.TargetType,
+		StartTime:         startTimeFromMillis(c.StartTime),
+		Duration:          c.Duration,
+		TTL:               c.TTL,
+		Masked:            c.Masked,
+		EncryptRawPackets: c.EncryptRawPackets,
+	}
+	capture.UUID = c.UUID
+
+	return capture, nil
+}
+
+func alertFromResource(a *types.Alert) *Alert {
+	alert := &Alert{
+		UUID:        a.UUID,
+		Name:        a.Name,
+		Description: a.Description,
+		Expression:  a.Expression,
+		Action:      a.Action,
+		Trigger:     a.Trigger,
+		Template:    a.Template,
+		Combine:     a.Combine,
+		Within:      a.Within,
+		CreateTime:  timeToMillis(a.CreateTime),
+	}
+
+	if t := a.Threshold; t != nil {
+		alert.Threshold = &AlertThreshold{
+			Field:    t.Field,
+			Operator: t.Operator,
+			Value:    t.Value,
+			Clear:    t.Clear,
+			For:      t.For,
+			Cooldown: t.Cooldown,
+		}
+	}
+
+	if an := a.Anomaly; an != nil {
+		alert.Anomaly = &AlertAnomaly{Training: an.Training, Sensitivity: an.Sensitivity}
+	}
+
+	for _, c := range a.Conditions {
+		alert.Conditions = append(alert.Conditions, &AlertCondition{Name: c.Name, Expression: c.Expression})
+	}
+
+	return alert
+}
+
+func alertToResource(a *Alert) *types.Alert {
+	alert := types.NewAlert()
+	alert.UUID = a.UUID
+	alert.Name = a.Name
+	alert.Description = a.Description
+	alert.Expression = a.Expression
+	alert.Action = a.Action
+	alert.Trigger = a.Trigger
+	alert.Template = a.Template
+	alert.Combine = a.Combine
+	alert.Within = a.Within
+
+	if t := a.Threshold; t != nil {
+		alert.Threshold = &types.AlertThreshold{
+			Field:    t.Field,
+			Operator: t.Operator,
+			Value:    t.Value,
+			Clear:    t.Clear,
+			For:      t.For,
+			Cooldown: t.Cooldown,
+		}
+	}
+
+	if an := a.Anomaly; an != nil {
+		alert.Anomaly = &types.AlertAnomaly{Training: an.Training, Sensitivity: an.Sensitivity}
+	}
+
+	for _, c := range a.Conditions {
+		alert.Conditions = append(alert.Conditions, &types.AlertCondition{Name: c.Name, Expression: c.Expression})
+	}
+
+	return alert
+}
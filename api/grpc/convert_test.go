@@ -0,0 +1,142 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package grpc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/flow"
+)
+
+func TestCaptureConversion(t *testing.T) {
+	var extraLayers flow.ExtraLayers
+	if err := extraLayers.Parse("DNS", "DHCPv4"); err != nil {
+		t.Fatal(err)
+	}
+
+	startTime := time.Unix(1500000000, 123000000)
+	capture := &types.Capture{
+		GremlinQuery:      "G.V().Has('Name', 'eth0')",
+		Selector:          "Type=device,Name in (eth0,eth1)",
+		BPFFilter:         "port 80",
+		Name:              "capture",
+		Description:       "web traffic",
+		Type:              "pcap",
+		Port:              6345,
+		SamplingRate:      10,
+		PollingInterval:   5,
+		RawPacketLimit:    10,
+		HeaderSize:        256,
+		ExtraTCPMetric:    true,
+		IPDefrag:          true,
+		ReassembleTCP:     true,
+		LayerKeyMode:      "L3",
+		ExtraLayers:       extraLayers,
+		Target:            "1.2.3.4:6345",
+		TargetType:        "netflowv5",
+		StartTime:         &startTime,
+		Duration:          60,
+		TTL:               3600,
+		Masked:            true,
+		EncryptRawPackets: true,
+	}
+	capture.UUID = "4bd2a6c8-4ea4-4cb3-9c1a-1d2b2d7a9d3f"
+
+	// the capture goes through the wire format
+	data, err := captureFromResource(capture).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var message Capture
+	if err := message.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+
+	converted, err := captureToResource(&message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(converted, capture) {
+		t.Errorf("capture changed by the conversion, expected %+v, got %+v", capture, converted)
+	}
+
+	if converted, err = captureToResource(&Capture{GremlinQuery: "G.V()"}); err != nil {
+		t.Fatal(err)
+	} else if converted.StartTime != nil {
+		t.Errorf("an unset start time should not be converted, got %s", converted.StartTime)
+	}
+
+	if _, err := captureToResource(&Capture{GremlinQuery: "G.V()", ExtraLayers: []string{"unknown"}}); err == nil {
+		t.Error("an unknown extra layer should be rejected")
+	}
+}
+
+func TestAlertConversion(t *testing.T) {
+	clear := 50.0
+	alert := &Alert{
+		UUID:        "8f3cc1b4-5bd2-4a3e-a5c8-3fd6f5f6c1a2",
+		Name:        "alert",
+		Description: "bandwidth alert",
+		Expression:  "G.V().Has('Name', 'eth0').Metrics().Aggregates()",
+		Action:      "http://localhost:8080/hook",
+		Trigger:     "duration:10s",
+		Template:    "{{.Name}}",
+		Combine:     "and",
+		Within:      "1m",
+		Threshold: &AlertThreshold{
+			Field:    "RxBytes",
+			Operator: ">",
+			Value:    100,
+			Clear:    &clear,
+			For:      "30s",
+			Cooldown: "5m",
+		},
+		Anomaly:    &AlertAnomaly{Training: "1h", Sensitivity: 3},
+		Conditions: []*AlertCondition{{Name: "up", Expression: "G.V().Has('State', 'UP')"}},
+	}
+
+	data, err := alert.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var message Alert
+	if err := message.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+
+	resource := alertToResource(&message)
+	if resource.CreateTime.IsZero() {
+		t.Error("the creation time of the alert should be set")
+	}
+
+	converted := alertFromResource(resource)
+	if converted.CreateTime != timeToMillis(resource.CreateTime) {
+		t.Errorf("expected creation time %d, got %d", timeToMillis(resource.CreateTime), converted.CreateTime)
+	}
+
+	converted.CreateTime = 0
+	if !reflect.DeepEqual(converted, alert) {
+		t.Errorf("alert changed by the conversion, expected %+v, got %+v", alert, converted)
+	}
+}
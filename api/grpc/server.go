@@ -0,0 +1,639 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+	etcd "github.com/coreos/etcd/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	api "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/audit"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	gcommon "github.com/skydive-project/skydive/graffiti/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	gws "github.com/skydive-project/skydive/graffiti/websocket"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/ratelimit"
+	"github.com/skydive-project/skydive/rbac"
+	"github.com/skydive-project/skydive/validator"
+)
+
+// maximum number of topology events queued for a watcher before
+// its stream is closed
+const maxWatchEvents = 10000
+
+type usernameKey struct{}
+
+// Server exposes the topology and flow queries, the captures and the
+// alerts of the analyzer over gRPC
+type Server struct {
+	addr        string
+	graph       *graph.Graph
+	parser      *traversal.GremlinTraversalParser
+	authBackend shttp.AuthenticationBackend
+	auditor     *audit.Auditor
+	limiter     *ratelimit.Limiter
+	server      *grpc.Server
+	wg          sync.WaitGroup
+}
+
+type topologyService struct {
+	*Server
+}
+
+type flowsService struct {
+	*Server
+}
+
+type resourceService struct {
+	*Server
+	handler api.Handler
+}
+
+type capturesService struct {
+	resourceService
+}
+
+type alertsService struct {
+	resourceService
+}
+
+// authenticate checks the credentials found in the metadata of a call, the
+// same way as the ones of an HTTP request, and returns a context holding the
+// name of the user
+func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
+	// not an API path, the calls are audited and limited by the interceptors
+	request := httptest.NewRequest("GET", "/", nil)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, key := range []string{"authorization", "x-auth-token"} {
+			if values := md.Get(key); len(values) > 0 {
+				request.Header.Set(key, values[0])
+			}
+		}
+	}
+
+	var username string
+	s.authBackend.Wrap(func(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+		username = r.Username
+	})(httptest.NewRecorder(), request)
+
+	if username == "" {
+		return nil, status.Error(codes.Unauthenticated, "Wrong credentials")
+	}
+
+	return context.WithValue(ctx, usernameKey{}, username), nil
+}
+
+func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.limiter != nil {
+		_, query := req.(*QueryParams)
+		release, err := s.limit(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	start := time.Now().UTC()
+	resp, err := handler(ctx, req)
+	if s.auditor != nil {
+		s.audit(ctx, start, info.FullMethod, req, err)
+	}
+	return resp, err
+}
+
+// limit applies the rate limit of the user, and the concurrent query quota
+// to the queries
+func (s *Server) limit(ctx context.Context, query bool) (func(), error) {
+	username, _ := ctx.Value(usernameKey{}).(string)
+	if ok, _ := s.limiter.Allow(username); !ok {
+		return nil, status.Errorf(codes.ResourceExhausted, "Rate limit exceeded for %s", username)
+	}
+
+	if !query {
+		return func() {}, nil
+	}
+
+	release, ok := s.limiter.Acquire(username)
+	if !ok {
+		return nil, status.Errorf(codes.ResourceExhausted, "Too many concurrent queries for %s", username)
+	}
+	return release, nil
+}
+
+// audit records the calls creating or deleting a resource, the queries
+// accessing the captured packets and, if enabled, the other reads
+func (s *Server) audit(ctx context.Context, start time.Time, method string, req interface{}, err error) {
+	var kind string
+	if strings.HasSuffix(method, "/Create") || strings.HasSuffix(method, "/Delete") {
+		kind = types.AuditMutation
+	} else if params, ok := req.(*QueryParams); ok && audit.IsRawPacketQuery(params.GremlinQuery) {
+		kind = types.AuditRawPackets
+	} else if s.auditor.RecordReads() {
+		kind = types.AuditRead
+	} else {
+		return
+	}
+
+	username, _ := ctx.Value(usernameKey{}).(string)
+	record := &types.AuditRecord{
+		Time:   start,
+		User:   username,
+		Kind:   kind,
+		Method: "GRPC",
+		Path:   method,
+		Status: int(status.Code(err)),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		record.RemoteAddr = p.Addr.String()
+	}
+	if body, err := json.Marshal(req); err == nil {
+		record.Payload, record.Truncated = s.auditor.Payload(body)
+	}
+
+	if err := s.auditor.Record(record); err != nil {
+		logging.GetLogger().Errorf("Unable to record %s in the audit trail: %s", method, err)
+	}
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (a *authenticatedStream) Context() context.Context {
+	return a.ctx
+}
+
+func (s *Server) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	if s.limiter != nil {
+		release, err := s.limit(ctx, strings.HasSuffix(info.FullMethod, "/Query"))
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+	return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+}
+
+func enforce(ctx context.Context, object, permission string) error {
+	username, _ := ctx.Value(usernameKey{}).(string)
+	if !rbac.Enforce(username, object, permission) {
+		return status.Errorf(codes.PermissionDenied, "Permission %s denied on %s", permission, object)
+	}
+	return nil
+}
+
+// scope returns the topology scope of the authenticated user, nil if not restricted
+func (s *Server) scope(ctx context.Context) (*gcommon.TopologyScope, error) {
+	username, _ := ctx.Value(usernameKey{}).(string)
+	scope, err := gcommon.NewTopologyScope(s.parser, username)
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return scope, nil
+}
+
+func (s *Server) query(ctx context.Context, params *QueryParams) (traversal.GraphTraversalStep, error) {
+	var bindings map[string]interface{}
+	if len(params.Bindings) != 0 {
+		if err := json.Unmarshal(params.Bindings, &bindings); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid bindings: %s", err)
+		}
+	}
+
+	ts, err := s.parser.ParseWithBindings(params.GremlinQuery, bindings)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	scope, err := s.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	g := s.graph
+	if scope != nil {
+		if g, err = scope.Graph(g, true); err != nil {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+	}
+
+	// the raw packets encrypted at rest are decrypted for the users allowed to
+	if username, _ := ctx.Value(usernameKey{}).(string); rbac.Enforce(username, "capture", "rawpackets") {
+		ctx = ge.WithRawPacketDecryption(ctx)
+	}
+
+	res, err := ts.ExecContext(ctx, g, true)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return res, nil
+}
+
+// Query returns the JSON encoded result of a Gremlin query
+func (t *topologyService) Query(ctx context.Context, params *QueryParams) (*QueryResult, error) {
+	if err := enforce(ctx, "topology", "read"); err != nil {
+		return nil, err
+	}
+
+	res, err := t.query(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := json.Marshal(res)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Error while encoding response: %s", err)
+	}
+
+	return &QueryResult{Result: result}, nil
+}
+
+// topologyWatcher queues the topology events of a Watch call
+type topologyWatcher struct {
+	events   chan *TopologyEvent
+	overflow chan struct{}
+	once     sync.Once
+}
+
+func newTopologyEvent(kind string, element interface{}) (*TopologyEvent, error) {
+	object, err := json.Marshal(element)
+	if err != nil {
+		return nil, err
+	}
+	return &TopologyEvent{Type: kind, Object: object}, nil
+}
+
+func (w *topologyWatcher) push(kind string, element interface{}) {
+	event, err := newTopologyEvent(kind, element)
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to encode topology event %s: %s", kind, err)
+		return
+	}
+
+	select {
+	case w.events <- event:
+	default:
+		w.once.Do(func() { close(w.overflow) })
+	}
+}
+
+// OnNodeAdded event
+func (w *topologyWatcher) OnNodeAdded(n *graph.Node) {
+	w.push(gws.NodeAddedMsgType, n)
+}
+
+// OnNodeUpdated event
+func (w *topologyWatcher) OnNodeUpdated(n *graph.Node) {
+	w.push(gws.NodeUpdatedMsgType, n)
+}
+
+// OnNodeDeleted event
+func (w *topologyWatcher) OnNodeDeleted(n *graph.Node) {
+	w.push(gws.NodeDeletedMsgType, n)
+}
+
+// OnEdgeAdded event
+func (w *topologyWatcher) OnEdgeAdded(e *graph.Edge) {
+	w.push(gws.EdgeAddedMsgType, e)
+}
+
+// OnEdgeUpdated event
+func (w *topologyWatcher) OnEdgeUpdated(e *graph.Edge) {
+	w.push(gws.EdgeUpdatedMsgType, e)
+}
+
+// OnEdgeDeleted event
+func (w *topologyWatcher) OnEdgeDeleted(e *graph.Edge) {
+	w.push(gws.EdgeDeletedMsgType, e)
+}
+
+// Watch streams the current nodes and edges of the topology as added
+// ones, followed by the changes of the topology. The stream is closed if
+// the client can't keep up with the changes.
+func (t *topologyService) Watch(_ *Empty, stream Topology_WatchServer) error {
+	if err := enforce(stream.Context(), "topology", "read"); err != nil {
+		return err
+	}
+
+	// the events are not filtered, only the unrestricted users can watch
+	if scope, err := t.scope(stream.Context()); err != nil {
+		return err
+	} else if scope != nil {
+		return status.Error(codes.PermissionDenied, "Topology watch is not available to users restricted to a topology scope")
+	}
+
+	watcher := &topologyWatcher{
+		events:   make(chan *TopologyEvent, maxWatchEvents),
+		overflow: make(chan struct{}),
+	}
+
+	// take the snapshot and register the watcher atomically so that no
+	// change gets lost in between
+	var snapshot []*TopologyEvent
+	t.graph.RLock()
+	for _, n := range t.graph.GetNodes(nil) {
+		if event, err := newTopologyEvent(gws.NodeAddedMsgType, n); err == nil {
+			snapshot = append(snapshot, event)
+		}
+	}
+	for _, e := range t.graph.GetEdges(nil) {
+		if event, err := newTopologyEvent(gws.EdgeAddedMsgType, e); err == nil {
+			snapshot = append(snapshot, event)
+		}
+	}
+	t.graph.AddEventListener(watcher)
+	t.graph.RUnlock()
+
+	defer t.graph.RemoveEventListener(watcher)
+
+	for _, event := range snapshot {
+		if err := stream.Send(event); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case event := <-watcher.events:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-watcher.overflow:
+			return status.Error(codes.ResourceExhausted, "Too many pending topology events")
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// Query streams the flows returned by a Gremlin query
+func (f *flowsService) Query(params *QueryParams, stream Flows_QueryServer) error {
+	if err := enforce(stream.Context(), "topology", "read"); err != nil {
+		return err
+	}
+
+	res, err := f.query(stream.Context(), params)
+	if err != nil {
+		return err
+	}
+
+	flowStep, ok := res.(*ge.FlowTraversalStep)
+	if !ok {
+		return status.Error(codes.InvalidArgument, "The query has to return flows")
+	}
+
+	for _, value := range flowStep.Values() {
+		if err := stream.Send(value.(*flow.Flow)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resourceError(err error) error {
+	switch {
+	case err == api.ErrDuplicatedResource:
+		return status.Error(codes.AlreadyExists, err.Error())
+	case etcd.IsKeyNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+}
+
+func (r *resourceService) list(ctx context.Context, send func(resource types.Resource) error) error {
+	if err := enforce(ctx, r.handler.Name(), "read"); err != nil {
+		return err
+	}
+
+	for _, resource := range r.handler.Index() {
+		r.handler.Decorate(resource)
+		if err := send(resource); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *resourceService) get(ctx context.Context, id *ResourceID) (types.Resource, error) {
+	if err := enforce(ctx, r.handler.Name(), "read"); err != nil {
+		return nil, err
+	}
+
+	resource, ok := r.handler.Get(id.UUID)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "%s %s not found", r.handler.Name(), id.UUID)
+	}
+	r.handler.Decorate(resource)
+
+	return resource, nil
+}
+
+func (r *resourceService) create(ctx context.Context, resource types.Resource) error {
+	if err := enforce(ctx, r.handler.Name(), "write"); err != nil {
+		return err
+	}
+
+	if err := validator.Validate(resource); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := r.handler.Create(resource, nil); err != nil {
+		return resourceError(err)
+	}
+
+	return nil
+}
+
+func (r *resourceService) delete(ctx context.Context, id *ResourceID) (*Empty, error) {
+	if err := enforce(ctx, r.handler.Name(), "write"); err != nil {
+		return nil, err
+	}
+
+	if err := r.handler.Delete(id.UUID); err != nil {
+		return nil, resourceError(err)
+	}
+
+	return &Empty{}, nil
+}
+
+// List streams the captures
+func (c *capturesService) List(_ *Empty, stream Captures_ListServer) error {
+	return c.list(stream.Context(), func(resource types.Resource) error {
+		return stream.Send(captureFromResource(resource.(*types.Capture)))
+	})
+}
+
+// Get returns a capture
+func (c *capturesService) Get(ctx context.Context, id *ResourceID) (*Capture, error) {
+	resource, err := c.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return captureFromResource(resource.(*types.Capture)), nil
+}
+
+// Create creates a capture
+func (c *capturesService) Create(ctx context.Context, capture *Capture) (*Capture, error) {
+	resource, err := captureToResource(capture)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := c.create(ctx, resource); err != nil {
+		return nil, err
+	}
+	return captureFromResource(resource), nil
+}
+
+// Delete deletes a capture
+func (c *capturesService) Delete(ctx context.Context, id *ResourceID) (*Empty, error) {
+	return c.delete(ctx, id)
+}
+
+// List streams the alerts
+func (a *alertsService) List(_ *Empty, stream Alerts_ListServer) error {
+	return a.list(stream.Context(), func(resource types.Resource) error {
+		return stream.Send(alertFromResource(resource.(*types.Alert)))
+	})
+}
+
+// Get returns an alert
+func (a *alertsService) Get(ctx context.Context, id *ResourceID) (*Alert, error) {
+	resource, err := a.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return alertFromResource(resource.(*types.Alert)), nil
+}
+
+// Create creates an alert
+func (a *alertsService) Create(ctx context.Context, alert *Alert) (*Alert, error) {
+	resource := alertToResource(alert)
+	if err := a.create(ctx, resource); err != nil {
+		return nil, err
+	}
+	return alertFromResource(resource), nil
+}
+
+// Delete deletes an alert
+func (a *alertsService) Delete(ctx context.Context, id *ResourceID) (*Empty, error) {
+	return a.delete(ctx, id)
+}
+
+// Start listens for gRPC connections
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	logging.GetLogger().Infof("gRPC API listening on %s", s.addr)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.server.Serve(listener); err != nil {
+			logging.GetLogger().Errorf("gRPC API stopped: %s", err)
+		}
+	}()
+
+	return nil
+}
+
+// Stop closes the gRPC connections
+func (s *Server) Stop() {
+	s.server.Stop()
+	s.wg.Wait()
+}
+
+// NewServer returns a gRPC server listening on the given address and
+// serving the topology, the flows and the captures and alerts handlers
+// of the API server. The calls are recorded by the auditor, if any.
+func NewServer(addr string, g *graph.Graph, parser *traversal.GremlinTraversalParser, apiServer *api.Server, authBackend shttp.AuthenticationBackend, auditor *audit.Auditor, limiter *ratelimit.Limiter) (*Server, error) {
+	s := &Server{
+		addr:        addr,
+		graph:       g,
+		parser:      parser,
+		authBackend: authBackend,
+		auditor:     auditor,
+		limiter:     limiter,
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(s.unaryInterceptor),
+		grpc.StreamInterceptor(s.streamInterceptor),
+	}
+
+	if config.IsTLSEnabled() {
+		tlsConfig, err := config.GetTLSServerConfig(true)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	s.register(grpc.NewServer(opts...), apiServer.GetHandler("capture"), apiServer.GetHandler("alert"))
+
+	return s, nil
+}
+
+// register serves the services on the given gRPC server, the captures and
+// the alerts being managed by the given handlers
+func (s *Server) register(server *grpc.Server, captures, alerts api.Handler) {
+	s.server = server
+
+	RegisterTopologyServer(server, &topologyService{Server: s})
+	RegisterFlowsServer(server, &flowsService{Server: s})
+	RegisterCapturesServer(server, &capturesService{resourceService{Server: s, handler: captures}})
+	RegisterAlertsServer(server, &alertsService{resourceService{Server: s, handler: alerts}})
+}
@@ -0,0 +1,279 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+
+	auth "github.com/abbot/go-http-auth"
+	etcd "github.com/coreos/etcd/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	api "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	shttp "github.com/skydive-project/skydive/http"
+)
+
+// fakeHandler keeps the resources in memory
+type fakeHandler struct {
+	sync.Mutex
+	name      string
+	new       func() types.Resource
+	resources map[string]types.Resource
+	ids       int
+}
+
+func newFakeHandler(name string, new func() types.Resource) *fakeHandler {
+	return &fakeHandler{name: name, new: new, resources: make(map[string]types.Resource)}
+}
+
+func (h *fakeHandler) Name() string {
+	return h.name
+}
+
+func (h *fakeHandler) New() types.Resource {
+	return h.new()
+}
+
+func (h *fakeHandler) Index() map[string]types.Resource {
+	h.Lock()
+	defer h.Unlock()
+
+	resources := make(map[string]types.Resource)
+	for id, resource := range h.resources {
+		resources[id] = resource
+	}
+	return resources
+}
+
+func (h *fakeHandler) Get(id string) (types.Resource, bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	resource, ok := h.resources[id]
+	return resource, ok
+}
+
+func (h *fakeHandler) Decorate(resource types.Resource) {
+}
+
+func (h *fakeHandler) Create(resource types.Resource, createOpts *api.CreateOptions) error {
+	h.Lock()
+	defer h.Unlock()
+
+	h.ids++
+	resource.SetID(fmt.Sprintf("%s-%d", h.name, h.ids))
+	h.resources[resource.ID()] = resource
+	return nil
+}
+
+func (h *fakeHandler) Delete(id string) error {
+	h.Lock()
+	defer h.Unlock()
+
+	if _, ok := h.resources[id]; !ok {
+		return etcd.Error{Code: etcd.ErrorCodeKeyNotFound, Message: "Key not found"}
+	}
+	delete(h.resources, id)
+	return nil
+}
+
+func (h *fakeHandler) AsyncWatch(f api.WatcherCallback) api.StoppableWatcher {
+	return nil
+}
+
+// anonymousBackend authenticates nobody
+type anonymousBackend struct {
+	*shttp.NoAuthenticationBackend
+}
+
+func (a *anonymousBackend) Wrap(wrapped auth.AuthenticatedHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wrapped(w, &auth.AuthenticatedRequest{Request: *r})
+	}
+}
+
+type testServer struct {
+	*Server
+	captures *fakeHandler
+	conn     *grpc.ClientConn
+}
+
+func (s *testServer) close() {
+	s.conn.Close()
+	s.server.Stop()
+}
+
+func newTestServer(t *testing.T, authBackend shttp.AuthenticationBackend) *testServer {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.UnknownService)
+	g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth0", "Type": "device"})
+	g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth1", "Type": "device"})
+
+	s := &Server{
+		graph:       g,
+		parser:      traversal.NewGremlinTraversalParser(),
+		authBackend: authBackend,
+	}
+
+	captures := newFakeHandler("capture", func() types.Resource { return &types.Capture{} })
+	alerts := newFakeHandler("alert", func() types.Resource { return types.NewAlert() })
+	s.register(grpc.NewServer(grpc.UnaryInterceptor(s.unaryInterceptor), grpc.StreamInterceptor(s.streamInterceptor)), captures, alerts)
+
+	listener := bufconn.Listen(1024 * 1024)
+	go s.server.Serve(listener)
+
+	dialer := func(context.Context, string) (net.Conn, error) {
+		return listener.Dial()
+	}
+	conn, err := grpc.Dial("bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testServer{Server: s, captures: captures, conn: conn}
+}
+
+func TestCapturesService(t *testing.T) {
+	s := newTestServer(t, shttp.NewNoAuthenticationBackend())
+	defer s.close()
+
+	client := NewCapturesClient(s.conn)
+	ctx := context.Background()
+
+	created, err := client.Create(ctx, &Capture{GremlinQuery: "G.V().Has('Name', 'eth0')", Name: "capture", TTL: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.UUID == "" || created.Name != "capture" || created.TTL != 60 {
+		t.Errorf("unexpected created capture: %+v", created)
+	}
+
+	capture, err := client.Get(ctx, &ResourceID{UUID: created.UUID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capture.GremlinQuery != created.GremlinQuery || capture.Name != created.Name {
+		t.Errorf("expected capture %+v, got %+v", created, capture)
+	}
+
+	stream, err := client.List(ctx, &Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed []*Capture
+	for {
+		capture, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		listed = append(listed, capture)
+	}
+	if len(listed) != 1 || listed[0].UUID != created.UUID {
+		t.Errorf("expected the created capture to be listed, got %+v", listed)
+	}
+
+	if _, err := client.Delete(ctx, &ResourceID{UUID: created.UUID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Get(ctx, &ResourceID{UUID: created.UUID}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected a not found error after deletion, got %v", err)
+	}
+
+	if _, err := client.Delete(ctx, &ResourceID{UUID: created.UUID}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected a not found error on a second deletion, got %v", err)
+	}
+
+	created, err = client.Create(ctx, &Capture{Selector: "Type=device", Name: "selector"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capture, err = client.Get(ctx, &ResourceID{UUID: created.UUID}); err != nil {
+		t.Fatal(err)
+	} else if capture.Selector != "Type=device" {
+		t.Errorf("expected the selector of the capture, got %+v", capture)
+	}
+
+	// neither a Gremlin query nor a selector
+	if _, err := client.Create(ctx, &Capture{Name: "invalid"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected an invalid argument error, got %v", err)
+	}
+}
+
+func TestTopologyQuery(t *testing.T) {
+	s := newTestServer(t, shttp.NewNoAuthenticationBackend())
+	defer s.close()
+
+	client := NewTopologyClient(s.conn)
+
+	result, err := client.Query(context.Background(), &QueryParams{GremlinQuery: "G.V().Has('Name', $name)", Bindings: []byte(`{"name": "eth0"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nodes []*graph.Node
+	if err := json.Unmarshal(result.Result, &nodes); err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 {
+		t.Fatalf("expected one node, got %s", string(result.Result))
+	}
+	if name, _ := nodes[0].GetFieldString("Name"); name != "eth0" {
+		t.Errorf("expected node eth0, got %s", name)
+	}
+
+	if _, err := client.Query(context.Background(), &QueryParams{GremlinQuery: "G.V().Unknown()"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected an invalid argument error, got %v", err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	s := newTestServer(t, &anonymousBackend{shttp.NewNoAuthenticationBackend()})
+	defer s.close()
+
+	if _, err := NewTopologyClient(s.conn).Query(context.Background(), &QueryParams{GremlinQuery: "G.V()"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected an unauthenticated error, got %v", err)
+	}
+
+	stream, err := NewCapturesClient(s.conn).List(context.Background(), &Empty{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected an unauthenticated error, got %v", err)
+	}
+}
@@ -21,10 +21,36 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
 	"time"
 
+	auth "github.com/abbot/go-http-auth"
+	etcd "github.com/coreos/etcd/client"
+	"github.com/gorilla/mux"
+	"github.com/robertkrimen/otto/parser"
+
 	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
 	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+	"github.com/skydive-project/skydive/validator"
+)
+
+// Etcd directories of the alert states, acknowledgements and history. They
+// are kept outside of the alert directory so that the alert watchers don't
+// get notified of their changes.
+const (
+	alertStateDir   = "/alert-state/"
+	alertAckDir     = "/alert-ack/"
+	alertHistoryDir = "/alert-history/"
 )
 
 // AlertResourceHandler aims to creates and manage a new Alert.
@@ -35,6 +61,8 @@ type AlertResourceHandler struct {
 // AlertAPIHandler aims to exposes the Alert API.
 type AlertAPIHandler struct {
 	BasicAPIHandler
+	Graph      *graph.Graph
+	historyTTL time.Duration
 }
 
 // New creates a new alert
@@ -49,14 +77,556 @@ func (a *AlertResourceHandler) Name() string {
 	return "alert"
 }
 
+func (a *AlertAPIHandler) getJSON(key string, value interface{}) (bool, error) {
+	resp, err := a.EtcdKeyAPI.Get(context.Background(), key, nil)
+	if err != nil {
+		if etcd.IsKeyNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, json.Unmarshal([]byte(resp.Node.Value), value)
+}
+
+func (a *AlertAPIHandler) setJSON(key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = a.EtcdKeyAPI.Set(context.Background(), key, string(data), &etcd.SetOptions{TTL: ttl})
+	return err
+}
+
+// Ack returns the acknowledgement of an alert, nil if it is not acknowledged
+func (a *AlertAPIHandler) Ack(id string) (*types.AlertAck, error) {
+	var ack types.AlertAck
+	found, err := a.getJSON(alertAckDir+id, &ack)
+	if !found || err != nil {
+		return nil, err
+	}
+	return &ack, nil
+}
+
+// Acknowledge acknowledges an alert. A non zero TTL silences the alert for
+// this duration.
+func (a *AlertAPIHandler) Acknowledge(id string, ack *types.AlertAck, ttl time.Duration) error {
+	return a.setJSON(alertAckDir+id, ack, ttl)
+}
+
+// Unacknowledge removes the acknowledgement of an alert
+func (a *AlertAPIHandler) Unacknowledge(id string) error {
+	if _, err := a.EtcdKeyAPI.Delete(context.Background(), alertAckDir+id, nil); err != nil && !etcd.IsKeyNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// State returns the state of an alert, an alert that never fired being resolved
+func (a *AlertAPIHandler) State(id string) (*types.AlertState, error) {
+	state := &types.AlertState{State: types.AlertResolved}
+	if _, err := a.getJSON(alertStateDir+id, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// SetState stores the state of an alert
+func (a *AlertAPIHandler) SetState(id string, state *types.AlertState) error {
+	return a.setJSON(alertStateDir+id, state, 0)
+}
+
+// AddEvent appends an event to the history of an alert
+func (a *AlertAPIHandler) AddEvent(id string, event *types.AlertEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = a.EtcdKeyAPI.CreateInOrder(context.Background(), alertHistoryDir+id, string(data), &etcd.CreateInOrderOptions{TTL: a.historyTTL})
+	return err
+}
+
+// History returns the events of an alert, the oldest first
+func (a *AlertAPIHandler) History(id string) ([]*types.AlertEvent, error) {
+	events := []*types.AlertEvent{}
+
+	resp, err := a.EtcdKeyAPI.Get(context.Background(), alertHistoryDir+id, &etcd.GetOptions{Sort: true})
+	if err != nil {
+		if etcd.IsKeyNotFound(err) {
+			return events, nil
+		}
+		return nil, err
+	}
+
+	for _, node := range resp.Node.Nodes {
+		var event types.AlertEvent
+		if err := json.Unmarshal([]byte(node.Value), &event); err != nil {
+			logging.GetLogger().Warningf("Invalid event in history of alert %s: %s", id, err)
+			continue
+		}
+		events = append(events, &event)
+	}
+
+	return events, nil
+}
+
+// Delete removes an alert along with its state. Its history is kept until it
+// expires.
+func (a *AlertAPIHandler) Delete(id string) error {
+	if err := a.BasicAPIHandler.Delete(id); err != nil {
+		return err
+	}
+
+	for _, key := range []string{alertStateDir + id, alertAckDir + id} {
+		if _, err := a.EtcdKeyAPI.Delete(context.Background(), key, nil); err != nil && !etcd.IsKeyNotFound(err) {
+			logging.GetLogger().Errorf("Failed to delete %s: %s", key, err)
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logging.GetLogger().Errorf("Error while writing response: %s", err)
+	}
+}
+
+func (a *AlertAPIHandler) alertID(w http.ResponseWriter, r *auth.AuthenticatedRequest, permission string) (string, bool) {
+	if !rbac.Enforce(r.Username, "alert", permission) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return "", false
+	}
+
+	id := mux.Vars(&r.Request)["ID"]
+	if _, found := a.Get(id); !found {
+		writeError(w, http.StatusNotFound, fmt.Errorf("Alert %s not found", id))
+		return "", false
+	}
+	return id, true
+}
+
+func (a *AlertAPIHandler) getState(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	id, ok := a.alertID(w, r, "read")
+	if !ok {
+		return
+	}
+
+	state, err := a.State(id)
+	if err == nil {
+		state.Ack, err = a.Ack(id)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, state)
+}
+
+func (a *AlertAPIHandler) getHistory(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	id, ok := a.alertID(w, r, "read")
+	if !ok {
+		return
+	}
+
+	events, err := a.History(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, events)
+}
+
+func (a *AlertAPIHandler) acknowledge(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	id, ok := a.alertID(w, r, "write")
+	if !ok {
+		return
+	}
+
+	var ack types.AlertAck
+	if err := json.NewDecoder(r.Body).Decode(&ack); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ack.User = r.Username
+	ack.Time = time.Now().UTC()
+	ack.Until = nil
+
+	event := &types.AlertEvent{Type: "acknowledged", Time: ack.Time, User: ack.User, Comment: ack.Comment}
+
+	var ttl time.Duration
+	if ack.Duration != "" {
+		var err error
+		if ttl, err = time.ParseDuration(ack.Duration); err != nil || ttl < time.Second {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid silence duration: %s", ack.Duration))
+			return
+		}
+
+		until := ack.Time.Add(ttl)
+		ack.Until = &until
+		event.Type = "silenced"
+	} else {
+		// an acknowledgement only lasts until the resolution of the alert
+		state, err := a.State(id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if state.State != types.AlertFiring {
+			writeError(w, http.StatusBadRequest, errors.New("Alert is not firing, use a duration to silence it"))
+			return
+		}
+	}
+
+	if err := a.Acknowledge(id, &ack, ttl); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := a.AddEvent(id, event); err != nil {
+		logging.GetLogger().Errorf("Failed to record acknowledgement of alert %s: %s", id, err)
+	}
+
+	writeJSON(w, &ack)
+}
+
+func (a *AlertAPIHandler) unacknowledge(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	id, ok := a.alertID(w, r, "write")
+	if !ok {
+		return
+	}
+
+	if err := a.Unacknowledge(id); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	event := &types.AlertEvent{Type: "unacknowledged", Time: time.Now().UTC(), User: r.Username}
+	if err := a.AddEvent(id, event); err != nil {
+		logging.GetLogger().Errorf("Failed to record acknowledgement of alert %s: %s", id, err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (a *AlertAPIHandler) registerEndpoints(s *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation GET /alert/{id}/state getAlertState
+	//
+	// Get the state of an alert
+	//
+	// ---
+	// summary: Get alert state
+	//
+	// tags:
+	// - Alerts
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     required: true
+	//     type: string
+	//
+	// responses:
+	//   200:
+	//     description: Alert state
+	//     schema:
+	//       $ref: '#/definitions/AlertState'
+	//
+	//   404:
+	//     description: Alert not found
+
+	// swagger:operation GET /alert/{id}/history getAlertHistory
+	//
+	// Get the history of an alert
+	//
+	// ---
+	// summary: Get alert history
+	//
+	// tags:
+	// - Alerts
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     required: true
+	//     type: string
+	//
+	// responses:
+	//   200:
+	//     description: Alert events, the oldest first
+	//     schema:
+	//       type: array
+	//       items:
+	//         $ref: '#/definitions/AlertEvent'
+	//
+	//   404:
+	//     description: Alert not found
+
+	// swagger:operation POST /alert/{id}/ack ackAlert
+	//
+	// Acknowledge an alert
+	//
+	// ---
+	// summary: Acknowledge or silence an alert
+	//
+	// description: |
+	//   Suppress the notifications of a firing alert until its resolution,
+	//   or for the given duration
+	//
+	// tags:
+	// - Alerts
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     required: true
+	//     type: string
+	//
+	//   - in: body
+	//     name: ack
+	//     schema:
+	//       $ref: '#/definitions/AlertAck'
+	//
+	// responses:
+	//   200:
+	//     description: Alert acknowledged
+	//     schema:
+	//       $ref: '#/definitions/AlertAck'
+	//
+	//   400:
+	//     description: Invalid duration or alert not firing
+	//
+	//   404:
+	//     description: Alert not found
+
+	// swagger:operation DELETE /alert/{id}/ack unackAlert
+	//
+	// Remove the acknowledgement of an alert
+	//
+	// ---
+	// summary: Remove alert acknowledgement
+	//
+	// tags:
+	// - Alerts
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     required: true
+	//     type: string
+	//
+	// responses:
+	//   200:
+	//     description: Acknowledgement removed
+	//
+	//   404:
+	//     description: Alert not found
+
+	routes := []shttp.Route{
+		{
+			Name:        "AlertState",
+			Method:      "GET",
+			Path:        "/api/alert/{ID}/state",
+			HandlerFunc: a.getState,
+		},
+		{
+			Name:        "AlertHistory",
+			Method:      "GET",
+			Path:        "/api/alert/{ID}/history",
+			HandlerFunc: a.getHistory,
+		},
+		{
+			Name:        "AlertAck",
+			Method:      "POST",
+			Path:        "/api/alert/{ID}/ack",
+			HandlerFunc: a.acknowledge,
+		},
+		{
+			Name:        "AlertUnack",
+			Method:      "DELETE",
+			Path:        "/api/alert/{ID}/ack",
+			HandlerFunc: a.unacknowledge,
+		},
+	}
+
+	s.RegisterRoutes(routes, authBackend)
+}
+
+// AlertBacktester is the interface to evaluate an alert on the history
+type AlertBacktester interface {
+	Backtest(params *types.AlertBacktestParams) (*types.AlertBacktestResult, error)
+}
+
+type alertBacktestAPI struct {
+	backtester AlertBacktester
+}
+
+func (a *alertBacktestAPI) backtest(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	// the alerts are evaluated on the history of the whole topology
+	if !rbac.Enforce(r.Username, "alert", "read") || isScoped(r.Username) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var params types.AlertBacktestParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if params.Alert != nil {
+		if err := validator.Validate(params.Alert); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	result, err := a.backtester.Backtest(&params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, result)
+}
+
+// RegisterAlertBacktestAPI registers the endpoint evaluating alerts on the history
+func RegisterAlertBacktestAPI(s *shttp.Server, backtester AlertBacktester, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation POST /alert/backtest backtestAlert
+	//
+	// Evaluate an alert on the history
+	//
+	// ---
+	// summary: Evaluate an alert on the history
+	//
+	// description: |
+	//   Evaluate the Gremlin expression of an alert at regular steps of a
+	//   past time range and return when it would have fired and been
+	//   resolved, using the topology and flows history
+	//
+	// tags:
+	// - Alerts
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - in: body
+	//     name: params
+	//     required: true
+	//     schema:
+	//       $ref: '#/definitions/AlertBacktestParams'
+	//
+	// responses:
+	//   200:
+	//     description: Backtest result
+	//     schema:
+	//       $ref: '#/definitions/AlertBacktestResult'
+	//
+	//   400:
+	//     description: Invalid alert or time range
+
+	a := &alertBacktestAPI{backtester: backtester}
+
+	routes := []shttp.Route{
+		{
+			Name:        "AlertBacktest",
+			Method:      "POST",
+			Path:        "/api/alert/backtest",
+			HandlerFunc: a.backtest,
+		},
+	}
+
+	s.RegisterRoutes(routes, authBackend)
+}
+
+// checkExpression parses a Gremlin or a JavaScript alert expression
+func (a *AlertAPIHandler) checkExpression(expression, field string, report *types.ValidationReport) {
+	if expression == "" {
+		return
+	}
+
+	if trimmed := strings.TrimSpace(expression); trimmed == "G" || strings.HasPrefix(trimmed, "G.") {
+		ts, err := validator.ParseGremlin(expression)
+		if err != nil {
+			report.AddError(field, "Not a valid Gremlin expression: %s", err)
+			return
+		}
+		checkFieldReferences(a.Graph, ts, field, report)
+		return
+	}
+
+	if _, err := parser.ParseFile(nil, "", expression, 0); err != nil {
+		report.AddError(field, "Not a valid JavaScript expression: %s", err)
+	}
+}
+
+// DryRun checks the Gremlin and JavaScript expressions of the alert
+func (a *AlertAPIHandler) DryRun(r types.Resource, report *types.ValidationReport) {
+	alert := r.(*types.Alert)
+
+	a.checkExpression(alert.Expression, "Expression", report)
+	for i, condition := range alert.Conditions {
+		if condition != nil {
+			a.checkExpression(condition.Expression, fmt.Sprintf("Conditions[%d].Expression", i), report)
+		}
+	}
+}
+
 // RegisterAlertAPI registers an Alert's API to a designated API Server
-func RegisterAlertAPI(apiServer *Server, authBackend shttp.AuthenticationBackend) (*AlertAPIHandler, error) {
+func RegisterAlertAPI(apiServer *Server, g *graph.Graph, authBackend shttp.AuthenticationBackend) (*AlertAPIHandler, error) {
 	alertAPIHandler := &AlertAPIHandler{
 		BasicAPIHandler: BasicAPIHandler{
 			ResourceHandler: &AlertResourceHandler{},
 			EtcdKeyAPI:      apiServer.EtcdKeyAPI,
 		},
+		Graph:      g,
+		historyTTL: time.Duration(config.GetInt("analyzer.alert.history_ttl")) * time.Second,
 	}
+
+	// registered first as the generic routes of the resource match any
+	// path starting with /api/alert/
+	alertAPIHandler.registerEndpoints(apiServer.HTTPServer, authBackend)
+
 	if err := apiServer.RegisterAPIHandler(alertAPIHandler, authBackend); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,428 @@
+//go:generate sh -c "go run github.com/gomatic/renderizer --name='API token' --resource=apitoken --type=APIToken --title='API token' --article=an swagger_operations.tmpl > apitoken_swagger.go"
+//go:generate sh -c "go run github.com/gomatic/renderizer --name='API token' --resource=apitoken --type=APIToken --title='API token' swagger_definitions.tmpl > apitoken_swagger.json"
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+	etcd "github.com/coreos/etcd/client"
+	"github.com/gorilla/mux"
+
+	"github.com/skydive-project/skydive/api/types"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// the last use of the tokens is written to etcd at this interval at most
+const apiTokenFlushInterval = time.Minute
+
+// the names of the tokens are reserved in this directory, holding the
+// identifiers of the tokens
+const apiTokenNamesPath = "/apitoken-names"
+
+// ErrAPITokenExpired is returned when authenticating with an expired token
+var ErrAPITokenExpired = errors.New("API token expired")
+
+// APITokenResourceHandler describes an API token resource handler
+type APITokenResourceHandler struct {
+	ResourceHandler
+}
+
+// APITokenAPI based on BasicAPIHandler. It keeps the digests of the tokens
+// in memory to validate the requests of the service accounts.
+type APITokenAPI struct {
+	sync.RWMutex
+	BasicAPIHandler
+	tokens   map[string]*types.APIToken
+	digests  map[string]string
+	lastUsed map[string]time.Time
+	watcher  StoppableWatcher
+	quit     chan bool
+	wg       sync.WaitGroup
+}
+
+// Name returns resource name "apitoken"
+func (h *APITokenResourceHandler) Name() string {
+	return "apitoken"
+}
+
+// New creates a new API token
+func (h *APITokenResourceHandler) New() types.Resource {
+	return &types.APIToken{}
+}
+
+func apiTokenDigest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateAPIToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return shttp.APITokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Decorate hides the digest of the token
+func (a *APITokenAPI) Decorate(resource types.Resource) {
+	resource.(*types.APIToken).Digest = ""
+}
+
+func apiTokenNamePath(name string) string {
+	return apiTokenNamesPath + "/" + name
+}
+
+// Create generates the token of a new service account. The token is
+// returned in the created resource, but only its digest is stored. The
+// token can only be bound to roles held by its creator.
+func (a *APITokenAPI) Create(resource types.Resource, createOpts *CreateOptions) error {
+	apiToken := resource.(*types.APIToken)
+
+	if createOpts == nil {
+		createOpts = &CreateOptions{}
+	}
+
+	if !rbac.HasRoles(createOpts.Username, apiToken.Roles) {
+		return ErrForbiddenResource
+	}
+
+	token, err := generateAPIToken()
+	if err != nil {
+		return err
+	}
+
+	apiToken.CreatedAt = time.Now().UTC()
+	apiToken.RotatedAt, apiToken.LastUsedAt = nil, nil
+	apiToken.Token, apiToken.Digest = "", apiTokenDigest(token)
+
+	// reserve the name first, expiring along with the token
+	namePath := apiTokenNamePath(apiToken.Name)
+	_, err = a.EtcdKeyAPI.Set(context.Background(), namePath, "", &etcd.SetOptions{PrevExist: etcd.PrevNoExist, TTL: createOpts.TTL})
+	if err, ok := err.(etcd.Error); ok && err.Code == etcd.ErrorCodeNodeExist {
+		return ErrDuplicatedResource
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := a.BasicAPIHandler.Create(apiToken, createOpts); err != nil {
+		a.EtcdKeyAPI.Delete(context.Background(), namePath, nil)
+		return err
+	}
+
+	if _, err := a.EtcdKeyAPI.Set(context.Background(), namePath, apiToken.ID(), &etcd.SetOptions{PrevExist: etcd.PrevExist, TTL: createOpts.TTL}); err != nil {
+		logging.GetLogger().Warningf("Unable to record the identifier of API token %s: %s", apiToken.Name, err)
+	}
+
+	apiToken.Token, apiToken.Digest = token, ""
+	return nil
+}
+
+// Delete an API token, releasing its name
+func (a *APITokenAPI) Delete(id string) error {
+	resource, found := a.Get(id)
+
+	if err := a.BasicAPIHandler.Delete(id); err != nil {
+		return err
+	}
+
+	if found {
+		a.EtcdKeyAPI.Delete(context.Background(), apiTokenNamePath(resource.(*types.APIToken).Name), &etcd.DeleteOptions{PrevValue: id})
+	}
+	return nil
+}
+
+// update applies a change to a stored token, keeping its TTL
+func (a *APITokenAPI) update(id string, change func(apiToken *types.APIToken)) (*types.APIToken, error) {
+	etcdPath := fmt.Sprintf("/%s/%s", a.Name(), id)
+
+	for {
+		resp, err := a.EtcdKeyAPI.Get(context.Background(), etcdPath, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var apiToken types.APIToken
+		if err := json.Unmarshal([]byte(resp.Node.Value), &apiToken); err != nil {
+			return nil, err
+		}
+		change(&apiToken)
+
+		data, err := json.Marshal(&apiToken)
+		if err != nil {
+			return nil, err
+		}
+
+		setOptions := &etcd.SetOptions{PrevIndex: resp.Node.ModifiedIndex}
+		if resp.Node.TTL > 0 {
+			setOptions.TTL = time.Duration(resp.Node.TTL) * time.Second
+		}
+
+		_, err = a.EtcdKeyAPI.Set(context.Background(), etcdPath, string(data), setOptions)
+		if err, ok := err.(etcd.Error); ok && err.Code == etcd.ErrorCodeTestFailed {
+			// modified in the meantime, by another analyzer for instance
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return &apiToken, nil
+	}
+}
+
+// ValidateToken returns the service account a token authenticates, its
+// roles being bound when the token is loaded
+func (a *APITokenAPI) ValidateToken(token string) (string, error) {
+	now := time.Now().UTC()
+
+	a.Lock()
+	apiToken, found := a.tokens[apiTokenDigest(token)]
+	if found && !apiToken.Expired(now) {
+		a.lastUsed[apiToken.ID()] = now
+	}
+	a.Unlock()
+
+	if !found {
+		return "", shttp.ErrWrongCredentials
+	}
+	if apiToken.Expired(now) {
+		return "", ErrAPITokenExpired
+	}
+
+	return apiToken.User(), nil
+}
+
+func (a *APITokenAPI) rotate(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "apitoken", "write") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := mux.Vars(&r.Request)["ID"]
+
+	// as for the creation, the token can only be rotated by a user holding
+	// all its roles
+	resource, found := a.Get(id)
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Errorf("API token %s not found", id))
+		return
+	}
+	if !rbac.HasRoles(r.Username, resource.(*types.APIToken).Roles) {
+		writeError(w, http.StatusForbidden, ErrForbiddenResource)
+		return
+	}
+
+	token, err := generateAPIToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	apiToken, err := a.update(id, func(apiToken *types.APIToken) {
+		now := time.Now().UTC()
+		apiToken.RotatedAt = &now
+		apiToken.Digest = apiTokenDigest(token)
+	})
+	if err != nil {
+		if err, ok := err.(etcd.Error); ok && err.Code == etcd.ErrorCodeKeyNotFound {
+			writeError(w, http.StatusNotFound, err)
+		} else {
+			writeError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	a.Decorate(apiToken)
+	apiToken.Token = token
+
+	writeJSON(w, apiToken)
+}
+
+func (a *APITokenAPI) onTokenEvent(action string, id string, resource types.Resource) {
+	a.Lock()
+	defer a.Unlock()
+
+	if digest, found := a.digests[id]; found {
+		delete(a.tokens, digest)
+		delete(a.digests, id)
+	}
+
+	switch action {
+	case "delete", "expire":
+		delete(a.lastUsed, id)
+		rbac.SetRolesForUser(resource.(*types.APIToken).User(), nil)
+	default:
+		apiToken := resource.(*types.APIToken)
+		a.tokens[apiToken.Digest] = apiToken
+		a.digests[id] = apiToken.Digest
+		rbac.SetRolesForUser(apiToken.User(), apiToken.Roles)
+	}
+}
+
+// bindRoles binds again the roles of the tokens, lost when the policy is
+// reloaded
+func (a *APITokenAPI) bindRoles() {
+	a.RLock()
+	defer a.RUnlock()
+
+	for _, apiToken := range a.tokens {
+		rbac.SetRolesForUser(apiToken.User(), apiToken.Roles)
+	}
+}
+
+func (a *APITokenAPI) flushLastUsed() {
+	a.Lock()
+	pending := a.lastUsed
+	a.lastUsed = make(map[string]time.Time)
+	a.Unlock()
+
+	for id, lastUsed := range pending {
+		lastUsed := lastUsed
+		_, err := a.update(id, func(apiToken *types.APIToken) {
+			if apiToken.LastUsedAt == nil || apiToken.LastUsedAt.Before(lastUsed) {
+				apiToken.LastUsedAt = &lastUsed
+			}
+		})
+		if err != nil {
+			logging.GetLogger().Debugf("Unable to record the last use of API token %s: %s", id, err)
+		}
+	}
+}
+
+// Start watching the tokens
+func (a *APITokenAPI) Start() {
+	a.watcher = a.AsyncWatch(a.onTokenEvent)
+	rbac.AddPolicyReloadHandler(a.bindRoles)
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+
+		ticker := time.NewTicker(apiTokenFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				a.flushLastUsed()
+			case <-a.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop watching the tokens, recording their last use
+func (a *APITokenAPI) Stop() {
+	a.watcher.Stop()
+	a.quit <- true
+	a.wg.Wait()
+
+	a.flushLastUsed()
+}
+
+func (a *APITokenAPI) registerEndpoints(s *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation POST /apitoken/{id}/rotate rotateAPIToken
+	//
+	// Rotate an API token
+	//
+	// ---
+	// summary: Rotate an API token
+	//
+	// description: |
+	//   Replace the token of a service account, the previous one being
+	//   immediately revoked
+	//
+	// tags:
+	// - API tokens
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     required: true
+	//     type: string
+	//
+	// responses:
+	//   200:
+	//     description: API token, with the new token
+	//     schema:
+	//       $ref: '#/definitions/APIToken'
+	//
+	//   403:
+	//     description: Roles of the API token not held by the user
+	//
+	//   404:
+	//     description: API token not found
+
+	routes := []shttp.Route{
+		{
+			Name:        "APITokenRotate",
+			Method:      "POST",
+			Path:        "/api/apitoken/{ID}/rotate",
+			HandlerFunc: a.rotate,
+		},
+	}
+
+	s.RegisterRoutes(routes, authBackend)
+}
+
+// NewAPITokenAPI returns a new API token handler. As the authentication
+// backends rely on it, it is created before the API server.
+func NewAPITokenAPI(kapi etcd.KeysAPI) *APITokenAPI {
+	return &APITokenAPI{
+		BasicAPIHandler: BasicAPIHandler{
+			ResourceHandler: &APITokenResourceHandler{},
+			EtcdKeyAPI:      kapi,
+		},
+		tokens:   make(map[string]*types.APIToken),
+		digests:  make(map[string]string),
+		lastUsed: make(map[string]time.Time),
+		quit:     make(chan bool),
+	}
+}
+
+// RegisterAPITokenAPI registers an API token api handler
+func RegisterAPITokenAPI(apiServer *Server, apiTokenAPI *APITokenAPI, authBackend shttp.AuthenticationBackend) error {
+	apiTokenAPI.registerEndpoints(apiServer.HTTPServer, authBackend)
+
+	return apiServer.RegisterAPIHandler(apiTokenAPI, authBackend)
+}
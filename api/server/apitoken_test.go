@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	etcd "github.com/coreos/etcd/client"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/graffiti/common/scopetest"
+)
+
+const apiTokenPolicy = `p, admin, apitoken, write, allow
+g, bob, admin
+p, operator, apitoken, write, allow
+g, carol, operator`
+
+// apiTokenKeysAPI stores the tokens as etcd would
+type apiTokenKeysAPI struct {
+	etcd.KeysAPI
+	values map[string]string
+	index  uint64
+}
+
+func (k *apiTokenKeysAPI) Get(ctx context.Context, key string, opts *etcd.GetOptions) (*etcd.Response, error) {
+	value, found := k.values[key]
+	if !found {
+		return nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound}
+	}
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: value, ModifiedIndex: k.index}}, nil
+}
+
+func (k *apiTokenKeysAPI) Set(ctx context.Context, key, value string, opts *etcd.SetOptions) (*etcd.Response, error) {
+	if opts != nil && opts.PrevIndex != 0 && opts.PrevIndex != k.index {
+		return nil, etcd.Error{Code: etcd.ErrorCodeTestFailed}
+	}
+	k.index++
+	k.values[key] = value
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: value, ModifiedIndex: k.index}}, nil
+}
+
+func TestAPITokenRotate(t *testing.T) {
+	scopetest.InitRBAC(t, apiTokenPolicy)
+
+	apiToken := &types.APIToken{Name: "ci", Roles: []string{"admin"}, Digest: apiTokenDigest("previous")}
+	apiToken.SetID("token")
+	data, _ := json.Marshal(apiToken)
+
+	kapi := &apiTokenKeysAPI{values: map[string]string{"/apitoken/token": string(data)}, index: 1}
+	a := NewAPITokenAPI(kapi)
+
+	rotate := func(user, id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.rotate(w, jobRequest(user, "POST", "/api/apitoken/"+id+"/rotate", id, ""))
+		return w
+	}
+
+	if w := rotate("carol", "token"); w.Code != http.StatusForbidden {
+		t.Errorf("carol does not hold the admin role and should not rotate the token, got %d", w.Code)
+	}
+	if kapi.values["/apitoken/token"] != string(data) {
+		t.Error("the token should not have been modified by a refused rotation")
+	}
+
+	if w := rotate("eve", "token"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("a user without role should be denied, got %d", w.Code)
+	}
+
+	if w := rotate("bob", "unknown"); w.Code != http.StatusNotFound {
+		t.Errorf("expected an unknown token not to be found, got %d", w.Code)
+	}
+
+	w := rotate("bob", "token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("bob should rotate the token, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var rotated types.APIToken
+	if err := json.Unmarshal(w.Body.Bytes(), &rotated); err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Token == "" || rotated.Digest != "" || rotated.RotatedAt == nil {
+		t.Errorf("expected the new token without its digest, got %+v", rotated)
+	}
+
+	var stored types.APIToken
+	if err := json.Unmarshal([]byte(kapi.values["/apitoken/token"]), &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Digest != apiTokenDigest(rotated.Token) {
+		t.Error("expected the digest of the new token to be stored")
+	}
+}
@@ -0,0 +1,443 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	auth "github.com/abbot/go-http-auth"
+	etcd "github.com/coreos/etcd/client"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/rbac"
+	"github.com/skydive-project/skydive/validator"
+)
+
+// ApplyRecordPath is the etcd directory where the hashes of the applied
+// objects are stored
+const ApplyRecordPath = "/apply"
+
+// ApplyAPI applies bundles describing the desired captures, alerts, rules
+// and packet injections
+type ApplyAPI struct {
+	sync.Mutex
+	apiServer *Server
+}
+
+// applyOp is a planned change with the object to create
+type applyOp struct {
+	change   *types.ApplyChange
+	resource types.Resource
+	hash     string
+	// whether the hash of an unchanged object has to be recorded
+	record bool
+}
+
+// applyPlan holds the changes of a kind of resource
+type applyPlan struct {
+	resource string
+	handler  Handler
+	ops      []*applyOp
+	// records of objects that no longer exist
+	stale []string
+}
+
+// resourceFields returns the JSON fields of an object, without its ID
+func resourceFields(resource types.Resource) (map[string]interface{}, error) {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "UUID")
+
+	return fields, nil
+}
+
+// hashFields returns a hash of the JSON fields of an object
+func hashFields(fields map[string]interface{}) (string, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// diffFields returns the sorted names of the fields that differ
+func diffFields(desired, current map[string]interface{}) (fields []string) {
+	for key, value := range desired {
+		if !reflect.DeepEqual(value, current[key]) {
+			fields = append(fields, key)
+		}
+	}
+	for key := range current {
+		if _, found := desired[key]; !found {
+			fields = append(fields, key)
+		}
+	}
+	sort.Strings(fields)
+	return
+}
+
+func (a *ApplyAPI) recordKey(resource, id string) string {
+	return fmt.Sprintf("%s/%s/%s", ApplyRecordPath, resource, id)
+}
+
+// records returns the hashes of the applied objects of a kind, by ID
+func (a *ApplyAPI) records(resource string) map[string]string {
+	records := make(map[string]string)
+
+	prefix := fmt.Sprintf("%s/%s/", ApplyRecordPath, resource)
+	resp, err := a.apiServer.EtcdKeyAPI.Get(context.Background(), prefix, &etcd.GetOptions{Recursive: true})
+	if err != nil {
+		return records
+	}
+
+	for _, node := range resp.Node.Nodes {
+		records[strings.TrimPrefix(node.Key, prefix)] = node.Value
+	}
+	return records
+}
+
+// plan computes the changes needed to get the desired objects of a kind.
+// An object whose hash was recorded by a previous apply is left untouched,
+// the others are replaced.
+func (a *ApplyAPI) plan(resource string, handler Handler, desired []types.Resource, prune bool) (*applyPlan, error) {
+	plan := &applyPlan{resource: resource, handler: handler}
+
+	existing := make(map[string][]types.Resource)
+	ids := make(map[string]bool)
+	for _, r := range handler.Index() {
+		name := types.ResourceName(r)
+		existing[name] = append(existing[name], r)
+		ids[r.ID()] = true
+	}
+
+	records := a.records(resource)
+	for id := range records {
+		if !ids[id] {
+			plan.stale = append(plan.stale, id)
+		}
+	}
+
+	kept := make(map[string]bool)
+	names := make(map[string]bool)
+	for _, r := range desired {
+		if reflect.ValueOf(r).IsNil() {
+			return nil, fmt.Errorf("Empty %s in the bundle", resource)
+		}
+
+		name := types.ResourceName(r)
+		if name == "" {
+			return nil, fmt.Errorf("Every %s of the bundle must have a name", resource)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("Duplicated %s name '%s'", resource, name)
+		}
+		names[name] = true
+
+		if err := validator.Validate(r); err != nil {
+			return nil, fmt.Errorf("Invalid %s '%s': %s", resource, name, err)
+		}
+
+		fields, err := resourceFields(r)
+		if err != nil {
+			return nil, err
+		}
+
+		hash, err := hashFields(fields)
+		if err != nil {
+			return nil, err
+		}
+
+		op := &applyOp{
+			change:   &types.ApplyChange{Resource: resource, Name: name, Action: types.ApplyCreate},
+			resource: r,
+			hash:     hash,
+		}
+
+		for _, current := range existing[name] {
+			if records[current.ID()] == hash {
+				op.change.Action = types.ApplyNone
+				op.change.ID = current.ID()
+				break
+			}
+		}
+
+		if op.change.Action == types.ApplyCreate && len(existing[name]) > 0 {
+			current := existing[name][0]
+
+			currentFields, err := resourceFields(current)
+			if err != nil {
+				return nil, err
+			}
+
+			// an object created by other means is adopted when it
+			// matches the bundle
+			if op.change.Fields = diffFields(fields, currentFields); len(op.change.Fields) == 0 {
+				op.change.Action = types.ApplyNone
+				op.change.ID = current.ID()
+				op.record = true
+			} else {
+				op.change.Action = types.ApplyUpdate
+				op.change.PreviousID = current.ID()
+			}
+		}
+
+		kept[op.change.ID] = true
+		kept[op.change.PreviousID] = true
+		plan.ops = append(plan.ops, op)
+	}
+
+	if prune {
+		var deleted []*applyOp
+		for name, resources := range existing {
+			for _, r := range resources {
+				if !kept[r.ID()] {
+					deleted = append(deleted, &applyOp{
+						change: &types.ApplyChange{Resource: resource, Name: name, Action: types.ApplyDelete, ID: r.ID()},
+					})
+				}
+			}
+		}
+		sort.Slice(deleted, func(i, j int) bool {
+			if deleted[i].change.Name != deleted[j].change.Name {
+				return deleted[i].change.Name < deleted[j].change.Name
+			}
+			return deleted[i].change.ID < deleted[j].change.ID
+		})
+
+		// deletions first so that a renamed object does not conflict
+		// with its previous version
+		plan.ops = append(deleted, plan.ops...)
+	}
+
+	return plan, nil
+}
+
+func (a *ApplyAPI) deleteObject(plan *applyPlan, id string) error {
+	if err := plan.handler.Delete(id); err != nil {
+		return err
+	}
+	a.apiServer.EtcdKeyAPI.Delete(context.Background(), a.recordKey(plan.resource, id), nil)
+	return nil
+}
+
+func (a *ApplyAPI) recordObject(plan *applyPlan, op *applyOp) error {
+	_, err := a.apiServer.EtcdKeyAPI.Set(context.Background(), a.recordKey(plan.resource, op.change.ID), op.hash, nil)
+	return err
+}
+
+func (a *ApplyAPI) createObject(plan *applyPlan, op *applyOp) error {
+	if err := plan.handler.Create(op.resource, nil); err != nil {
+		return err
+	}
+	op.change.ID = op.resource.ID()
+
+	return a.recordObject(plan, op)
+}
+
+// execute applies the changes of a plan. An updated object is deleted
+// before being created again, the handlers not supporting updates.
+func (a *ApplyAPI) execute(plan *applyPlan) {
+	for _, id := range plan.stale {
+		a.apiServer.EtcdKeyAPI.Delete(context.Background(), a.recordKey(plan.resource, id), nil)
+	}
+
+	for _, op := range plan.ops {
+		var err error
+		switch op.change.Action {
+		case types.ApplyCreate:
+			err = a.createObject(plan, op)
+		case types.ApplyUpdate:
+			if err = a.deleteObject(plan, op.change.PreviousID); err == nil {
+				err = a.createObject(plan, op)
+			}
+		case types.ApplyDelete:
+			err = a.deleteObject(plan, op.change.ID)
+		case types.ApplyNone:
+			if op.record {
+				err = a.recordObject(plan, op)
+			}
+		}
+
+		if err != nil {
+			op.change.Error = err.Error()
+		}
+	}
+}
+
+func (a *ApplyAPI) apply(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	var bundle types.ApplyBundle
+
+	var err error
+	if contentType := r.Header.Get("Content-Type"); contentType == "application/yaml" {
+		var content []byte
+		if content, err = ioutil.ReadAll(r.Body); err == nil {
+			err = yaml.Unmarshal(content, &bundle)
+		}
+	} else {
+		err = common.JSONDecode(r.Body, &bundle)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	query := r.URL.Query()
+	prune, dryRun := query.Get("prune") == "true", query.Get("dry_run") == "true"
+
+	resources := bundle.Resources()
+	for _, resource := range types.ApplyResources {
+		if _, found := resources[resource]; found && !rbac.Enforce(r.Username, resource, "write") {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	// plan all the changes first so that nothing is applied when
+	// the bundle is invalid
+	var plans []*applyPlan
+	for _, resource := range types.ApplyResources {
+		desired, found := resources[resource]
+		if !found {
+			continue
+		}
+
+		handler := a.apiServer.GetHandler(resource)
+		if handler == nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Resource %s not available", resource))
+			return
+		}
+
+		plan, err := a.plan(resource, handler, desired, prune)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		plans = append(plans, plan)
+	}
+
+	result := &types.ApplyResult{DryRun: dryRun, Changes: []*types.ApplyChange{}}
+	for _, plan := range plans {
+		if !dryRun {
+			a.execute(plan)
+		}
+		for _, op := range plan.ops {
+			result.Changes = append(result.Changes, op.change)
+		}
+	}
+
+	writeJSON(w, result)
+}
+
+func (a *ApplyAPI) registerEndpoints(s *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation POST /apply apply
+	//
+	// Apply a bundle
+	//
+	// ---
+	// summary: Apply a bundle describing the desired captures, alerts, rules and packet injections
+	//
+	// description: |
+	//   The objects are identified by their name. The objects that differ
+	//   from the bundle are replaced, and with prune, the objects of the kinds
+	//   listed in the bundle that are not part of it are deleted.
+	//
+	// tags:
+	// - Apply
+	//
+	// consumes:
+	// - application/json
+	// - application/yaml
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - name: bundle
+	//     in: body
+	//     required: true
+	//     schema:
+	//       $ref: '#/definitions/ApplyBundle'
+	//
+	//   - name: prune
+	//     in: query
+	//     description: delete the objects that are not part of the bundle
+	//     required: false
+	//     type: boolean
+	//
+	//   - name: dry_run
+	//     in: query
+	//     description: only return the changes to be made
+	//     required: false
+	//     type: boolean
+	//
+	// responses:
+	//   200:
+	//     description: Changes made, or to be made with dry_run
+	//     schema:
+	//       $ref: '#/definitions/ApplyResult'
+	//
+	//   400:
+	//     description: Invalid bundle
+
+	routes := []shttp.Route{
+		{
+			Name:        "Apply",
+			Method:      "POST",
+			Path:        "/api/apply",
+			HandlerFunc: a.apply,
+		},
+	}
+
+	s.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterApplyAPI registers the apply endpoint
+func RegisterApplyAPI(apiServer *Server, authBackend shttp.AuthenticationBackend) *ApplyAPI {
+	a := &ApplyAPI{apiServer: apiServer}
+	a.registerEndpoints(apiServer.HTTPServer, authBackend)
+	return a
+}
@@ -0,0 +1,266 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	etcd "github.com/coreos/etcd/client"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/graffiti/common/scopetest"
+)
+
+// applyKeysAPI stores the apply records
+type applyKeysAPI struct {
+	etcd.KeysAPI
+	values map[string]string
+}
+
+func (k *applyKeysAPI) Get(ctx context.Context, key string, opts *etcd.GetOptions) (*etcd.Response, error) {
+	node := &etcd.Node{Key: key, Dir: true}
+	for k, value := range k.values {
+		if strings.HasPrefix(k, key) {
+			node.Nodes = append(node.Nodes, &etcd.Node{Key: k, Value: value})
+		}
+	}
+	if len(node.Nodes) == 0 {
+		return nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound}
+	}
+	return &etcd.Response{Node: node}, nil
+}
+
+func (k *applyKeysAPI) Set(ctx context.Context, key, value string, opts *etcd.SetOptions) (*etcd.Response, error) {
+	k.values[key] = value
+	return &etcd.Response{}, nil
+}
+
+func (k *applyKeysAPI) Delete(ctx context.Context, key string, opts *etcd.DeleteOptions) (*etcd.Response, error) {
+	delete(k.values, key)
+	return &etcd.Response{}, nil
+}
+
+// applyHandler keeps the captures in memory
+type applyHandler struct {
+	Handler
+	captures map[string]types.Resource
+	lastID   int
+}
+
+func (h *applyHandler) Index() map[string]types.Resource {
+	captures := make(map[string]types.Resource)
+	for id, capture := range h.captures {
+		captures[id] = capture
+	}
+	return captures
+}
+
+func (h *applyHandler) Create(resource types.Resource, createOpts *CreateOptions) error {
+	h.lastID++
+	resource.SetID(fmt.Sprintf("capture%d", h.lastID))
+	h.captures[resource.ID()] = resource
+	return nil
+}
+
+func (h *applyHandler) Delete(id string) error {
+	if _, found := h.captures[id]; !found {
+		return errors.New("not found")
+	}
+	delete(h.captures, id)
+	return nil
+}
+
+func newTestApplyAPI() (*ApplyAPI, *applyHandler, *applyKeysAPI) {
+	kapi := &applyKeysAPI{values: make(map[string]string)}
+	handler := &applyHandler{captures: make(map[string]types.Resource)}
+	apiServer := &Server{EtcdKeyAPI: kapi, handlers: map[string]Handler{"capture": handler}}
+	return &ApplyAPI{apiServer: apiServer}, handler, kapi
+}
+
+func applyCaptures(t *testing.T, a *ApplyAPI, prune bool, captures ...*types.Capture) string {
+	var desired []types.Resource
+	for _, capture := range captures {
+		// a copy, as decoded from a bundle
+		c := *capture
+		desired = append(desired, &c)
+	}
+
+	plan, err := a.plan("capture", a.apiServer.GetHandler("capture"), desired, prune)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.execute(plan)
+
+	var changes []string
+	for _, op := range plan.ops {
+		change := op.change.Action + " " + op.change.Name
+		if len(op.change.Fields) > 0 {
+			change += " " + strings.Join(op.change.Fields, ",")
+		}
+		if op.change.Error != "" {
+			change += " " + op.change.Error
+		}
+		changes = append(changes, change)
+	}
+	return strings.Join(changes, "; ")
+}
+
+func captureNames(h *applyHandler) map[string]string {
+	names := make(map[string]string)
+	for _, resource := range h.captures {
+		capture := resource.(*types.Capture)
+		names[capture.Name] = capture.GremlinQuery
+	}
+	return names
+}
+
+func TestApplyPlan(t *testing.T) {
+	a, handler, kapi := newTestApplyAPI()
+
+	c1 := &types.Capture{Name: "c1", GremlinQuery: "G.V().Has('Name', 'eth0')"}
+	c2 := &types.Capture{Name: "c2", GremlinQuery: "G.V().Has('Name', 'eth1')"}
+
+	if changes := applyCaptures(t, a, false, c1, c2); changes != "create c1; create c2" {
+		t.Errorf("Unexpected changes: %s", changes)
+	}
+	if len(kapi.values) != 2 {
+		t.Errorf("The hashes of the created captures should be recorded, got %v", kapi.values)
+	}
+
+	if changes := applyCaptures(t, a, false, c1, c2); changes != "none c1; none c2" {
+		t.Errorf("Applying the same bundle should change nothing, got %s", changes)
+	}
+
+	c1.GremlinQuery = "G.V().Has('Name', 'eth2')"
+	if changes := applyCaptures(t, a, false, c1, c2); changes != "update c1 GremlinQuery; none c2" {
+		t.Errorf("Unexpected changes: %s", changes)
+	}
+	if names := captureNames(handler); len(names) != 2 || names["c1"] != c1.GremlinQuery {
+		t.Errorf("The updated capture should be replaced, got %v", names)
+	}
+
+	// the captures not in the bundle are only deleted when pruning
+	if changes := applyCaptures(t, a, false, c1); changes != "none c1" {
+		t.Errorf("Unexpected changes: %s", changes)
+	}
+	if changes := applyCaptures(t, a, true, c1); changes != "delete c2; none c1" {
+		t.Errorf("Unexpected changes: %s", changes)
+	}
+	if names := captureNames(handler); !reflect.DeepEqual(names, map[string]string{"c1": c1.GremlinQuery}) {
+		t.Errorf("c2 should be pruned, got %v", names)
+	}
+	if len(kapi.values) != 1 {
+		t.Errorf("The record of the deleted capture should be removed, got %v", kapi.values)
+	}
+}
+
+func TestApplyAdoption(t *testing.T) {
+	a, handler, kapi := newTestApplyAPI()
+
+	// captures created without apply
+	handler.Create(&types.Capture{Name: "c1", GremlinQuery: "G.V()"}, nil)
+	handler.Create(&types.Capture{Name: "c2", GremlinQuery: "G.V()"}, nil)
+
+	c1 := &types.Capture{Name: "c1", GremlinQuery: "G.V()"}
+	c2 := &types.Capture{Name: "c2", GremlinQuery: "G.V()", Description: "eth0 traffic"}
+	if changes := applyCaptures(t, a, false, c1, c2); changes != "none c1; update c2 Description" {
+		t.Errorf("Unexpected changes: %s", changes)
+	}
+	if _, found := kapi.values[ApplyRecordPath+"/capture/capture1"]; !found {
+		t.Errorf("The matching capture should be adopted, got %v", kapi.values)
+	}
+
+	// the records of the captures deleted by other means are removed
+	handler.Delete("capture1")
+	if changes := applyCaptures(t, a, false, c2); changes != "none c2" {
+		t.Errorf("Unexpected changes: %s", changes)
+	}
+	if _, found := kapi.values[ApplyRecordPath+"/capture/capture1"]; found {
+		t.Error("The stale record should be removed")
+	}
+}
+
+func TestApplyInvalidBundle(t *testing.T) {
+	a, handler, _ := newTestApplyAPI()
+
+	for _, desired := range [][]types.Resource{
+		{&types.Capture{GremlinQuery: "G.V()"}},
+		{&types.Capture{Name: "c1", GremlinQuery: "G.V()"}, &types.Capture{Name: "c1", GremlinQuery: "G.V()"}},
+		{&types.Capture{Name: "c1", GremlinQuery: "G.V("}},
+		{(*types.Capture)(nil)},
+	} {
+		if _, err := a.plan("capture", handler, desired, false); err == nil {
+			t.Errorf("The bundle %v should be rejected", desired)
+		}
+	}
+}
+
+func TestApplyEndpoint(t *testing.T) {
+	scopetest.InitRBAC(t, `p, admin, capture, write, allow
+g, bob, admin`)
+
+	a, handler, _ := newTestApplyAPI()
+
+	apply := func(user, query, body string) (*types.ApplyResult, int) {
+		w := httptest.NewRecorder()
+		r := authenticatedRequest(user, "POST", "/api/apply"+query, body)
+		r.Header.Set("Content-Type", "application/yaml")
+		a.apply(w, r)
+		if w.Code != http.StatusOK {
+			return nil, w.Code
+		}
+
+		var result types.ApplyResult
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		return &result, w.Code
+	}
+
+	bundle := `Captures:
+- Name: c1
+  GremlinQuery: G.V()
+`
+
+	if _, code := apply("alice", "", bundle); code != http.StatusMethodNotAllowed {
+		t.Errorf("alice can't write captures, got %d", code)
+	}
+
+	result, _ := apply("bob", "?dry_run=true", bundle)
+	if result == nil || !result.DryRun || len(result.Changes) != 1 || result.Changes[0].Action != types.ApplyCreate {
+		t.Errorf("Expected the creation to be planned, got %+v", result)
+	}
+	if len(handler.captures) != 0 {
+		t.Error("A dry run should not create any capture")
+	}
+
+	if result, _ = apply("bob", "", bundle); result == nil || result.DryRun || result.Changes[0].ID == "" {
+		t.Errorf("Expected the capture to be created, got %+v", result)
+	}
+	if len(handler.captures) != 1 {
+		t.Errorf("Expected one capture, got %d", len(handler.captures))
+	}
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+
+	"github.com/skydive-project/skydive/api/types"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// maximum number of records returned at once, the older ones being
+// fetched with until set to the time of the oldest record returned
+const maxAuditRecords = 1000
+
+// AuditTrail is the interface to search the audit records
+type AuditTrail interface {
+	Search(filter *types.AuditFilter) ([]*types.AuditRecord, error)
+}
+
+type auditAPI struct {
+	trail AuditTrail
+}
+
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().UTC().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (a *auditAPI) auditGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "audit", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := &types.AuditFilter{
+		User:  query.Get("user"),
+		Kind:  query.Get("kind"),
+		Limit: maxAuditRecords,
+	}
+
+	var err error
+	if filter.Since, err = parseAuditTime(query.Get("since")); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid since: %s", err))
+		return
+	}
+	if filter.Until, err = parseAuditTime(query.Get("until")); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid until: %s", err))
+		return
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 || filter.Limit > maxAuditRecords {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid limit: %s", limit))
+			return
+		}
+	}
+
+	records, err := a.trail.Search(filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, records)
+}
+
+func (a *auditAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation GET /audit getAudit
+	//
+	// Search the audit trail
+	//
+	// ---
+	// summary: Search the audit trail
+	//
+	// description: |
+	//   Return the mutating API calls, the queries accessing the captured
+	//   packets and the other reads, the oldest first. At most 1000 records
+	//   are returned, the previous ones being fetched with until set to the
+	//   time of the oldest record returned.
+	//
+	// tags:
+	// - Audit
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	// - name: user
+	//   in: query
+	//   description: user who made the calls
+	//   required: false
+	//   type: string
+	//
+	// - name: kind
+	//   in: query
+	//   description: mutation, rawpackets or read
+	//   required: false
+	//   type: string
+	//
+	// - name: since
+	//   in: query
+	//   description: RFC 3339 time or duration before now, ex: 24h
+	//   required: false
+	//   type: string
+	//
+	// - name: until
+	//   in: query
+	//   description: RFC 3339 time or duration before now
+	//   required: false
+	//   type: string
+	//
+	// - name: limit
+	//   in: query
+	//   description: maximum number of records, the most recent ones, 1000 by default
+	//   required: false
+	//   type: integer
+	//
+	// responses:
+	//   200:
+	//     description: Audit records
+	//     schema:
+	//       type: array
+	//       items:
+	//         $ref: '#/definitions/AuditRecord'
+	//
+	//   400:
+	//     description: Invalid filter
+
+	routes := []shttp.Route{
+		{
+			Name:        "AuditGet",
+			Method:      "GET",
+			Path:        "/api/audit",
+			HandlerFunc: a.auditGet,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterAuditAPI registers the audit trail API endpoint
+func RegisterAuditAPI(s *shttp.Server, trail AuditTrail, authBackend shttp.AuthenticationBackend) {
+	a := &auditAPI{
+		trail: trail,
+	}
+
+	a.registerEndpoints(s, authBackend)
+}
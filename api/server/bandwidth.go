@@ -0,0 +1,308 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/gorilla/mux"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+const (
+	bandwidthQuery         = "G.Context($at, $duration).V($id).Metrics().Aggregates($step)"
+	bandwidthDefaultRange  = time.Hour
+	bandwidthDefaultPoints = 1000
+)
+
+// bandwidthRollups are the periods the metrics are summed over, chosen so
+// that the points of a dashboard stay aligned from a refresh to another
+var bandwidthRollups = []time.Duration{
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+}
+
+// bandwidthFields are the interface metric fields returned as rates
+var bandwidthFields = []string{"RxBytes", "TxBytes", "RxPackets", "TxPackets"}
+
+// TimeSeries is a time series in the format of the Grafana JSON
+// datasources, each data point being a value and a timestamp in milliseconds
+// swagger:model TimeSeries
+type TimeSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// BandwidthAPI exposes the bandwidth and packet rate of the interfaces
+// computed from the metrics stored with the topology
+type BandwidthAPI struct {
+	graph  *graph.Graph
+	parser *traversal.GremlinTraversalParser
+}
+
+// bandwidthRollup returns the shortest rollup period not shorter than the
+// resolution and giving at most maxPoints points over the span
+func bandwidthRollup(span, resolution time.Duration, maxPoints int) time.Duration {
+	min := resolution
+	if perPoint := span / time.Duration(maxPoints); perPoint > min {
+		min = perPoint
+	}
+
+	for _, rollup := range bandwidthRollups {
+		if rollup >= min {
+			return rollup
+		}
+	}
+
+	day := bandwidthRollups[len(bandwidthRollups)-1]
+	return (min + day - 1) / day * day
+}
+
+// bandwidthRange aligns a time range on the rollup periods, the period of
+// the end of the range being included
+func bandwidthRange(from, to time.Time, rollup time.Duration) (time.Time, time.Time) {
+	return from.Truncate(rollup), to.Truncate(rollup).Add(rollup)
+}
+
+// bandwidthSeries returns the rates of the metrics summed per period. The
+// metrics are the differences between two readings of the interface
+// counters, a period where the counters were reset, the interface being
+// recreated for instance, having a negative sum and no point.
+func bandwidthSeries(step *ge.MetricsTraversalStep) []*TimeSeries {
+	series := make([]*TimeSeries, len(bandwidthFields))
+	for i, field := range bandwidthFields {
+		series[i] = &TimeSeries{Target: field + "/s", Datapoints: [][2]float64{}}
+	}
+
+	for _, value := range step.Values() {
+		for _, metrics := range value.(map[string][]common.Metric) {
+			for _, metric := range metrics {
+				duration := metric.GetLast() - metric.GetStart()
+				if duration <= 0 {
+					continue
+				}
+
+				for i, field := range bandwidthFields {
+					if v, err := metric.GetFieldInt64(field); err == nil && v >= 0 {
+						series[i].Datapoints = append(series[i].Datapoints, [2]float64{float64(v) * 1000 / float64(duration), float64(metric.GetStart())})
+					}
+				}
+			}
+		}
+	}
+
+	return series
+}
+
+func (b *BandwidthAPI) bandwidthGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	from, err := parseAuditTime(query.Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid from: %s", err))
+		return
+	}
+
+	to, err := parseAuditTime(query.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid to: %s", err))
+		return
+	}
+
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	if from.IsZero() {
+		from = to.Add(-bandwidthDefaultRange)
+	}
+	if !from.Before(to) {
+		writeError(w, http.StatusBadRequest, errors.New("The end of the time range is before its start"))
+		return
+	}
+
+	// the interface metrics are not updated more often than that
+	resolution := time.Duration(config.GetInt("agent.topology.netlink.metrics_update")) * time.Second
+	if value := query.Get("resolution"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid resolution: %s", err))
+			return
+		}
+		if d > resolution {
+			resolution = d
+		}
+	}
+
+	maxPoints := bandwidthDefaultPoints
+	if value := query.Get("maxDataPoints"); value != "" {
+		if maxPoints, err = strconv.Atoi(value); err != nil || maxPoints <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid maxDataPoints: %s", value))
+			return
+		}
+	}
+
+	rollup := bandwidthRollup(to.Sub(from), resolution, maxPoints)
+	from, to = bandwidthRange(from, to, rollup)
+
+	bindings := map[string]interface{}{
+		"at":       common.UnixMillis(to),
+		"duration": int64(to.Sub(from) / time.Second),
+		"id":       mux.Vars(&r.Request)["ID"],
+		"step":     int64(rollup / time.Second),
+	}
+
+	ts, err := b.parser.ParseWithBindings(bandwidthQuery, bindings)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	g, err := userGraph(b.graph, b.parser, r.Username)
+	if err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+
+	res, err := ts.ExecContext(r.Context(), g, true)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	step, ok := res.(*ge.MetricsTraversalStep)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("Unexpected metrics result %T", res))
+		return
+	}
+
+	w.Header().Set("X-Resolution", rollup.String())
+	writeJSON(w, bandwidthSeries(step))
+}
+
+func (b *BandwidthAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation GET /topology/bandwidth/{id} getBandwidth
+	//
+	// Get the bandwidth of an interface
+	//
+	// ---
+	// summary: Get the bandwidth of an interface
+	//
+	// description: |
+	//   Return the received and transmitted bytes and packets per second of
+	//   a node, computed from its metrics stored with the topology, in the
+	//   format of the Grafana JSON datasources. The metrics are summed over
+	//   periods of 10s, 30s, 1m, 5m, 15m, 1h, 6h or days, the shortest one
+	//   matching the resolution and the maximum number of points being
+	//   chosen and returned in the X-Resolution header. The periods where
+	//   the interface counters were reset have no point.
+	//
+	// tags:
+	// - topology
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	// - name: id
+	//   in: path
+	//   required: true
+	//   type: string
+	//
+	// - name: from
+	//   in: query
+	//   description: start of the time range, RFC3339 or duration before now, one hour before the end by default
+	//   required: false
+	//   type: string
+	//
+	// - name: to
+	//   in: query
+	//   description: end of the time range, RFC3339 or duration before now, now by default
+	//   required: false
+	//   type: string
+	//
+	// - name: resolution
+	//   in: query
+	//   description: minimum period between two points, ex 1m
+	//   required: false
+	//   type: string
+	//
+	// - name: maxDataPoints
+	//   in: query
+	//   description: maximum number of points per series, 1000 by default
+	//   required: false
+	//   type: integer
+	//
+	// responses:
+	//   200:
+	//     description: Time series
+	//     schema:
+	//       type: array
+	//       items:
+	//         $ref: '#/definitions/TimeSeries'
+	//
+	//   400:
+	//     description: invalid parameters or no topology history
+
+	routes := []shttp.Route{
+		{
+			Name:        "BandwidthGet",
+			Method:      "GET",
+			Path:        "/api/topology/bandwidth/{ID}",
+			HandlerFunc: b.bandwidthGet,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterBandwidthAPI registers the interface bandwidth endpoint
+func RegisterBandwidthAPI(r *shttp.Server, g *graph.Graph, parser *traversal.GremlinTraversalParser, authBackend shttp.AuthenticationBackend) {
+	b := &BandwidthAPI{
+		graph:  g,
+		parser: parser,
+	}
+
+	b.registerEndpoints(r, authBackend)
+}
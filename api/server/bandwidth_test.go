@@ -0,0 +1,117 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+	"github.com/skydive-project/skydive/topology"
+)
+
+func TestBandwidthRollup(t *testing.T) {
+	tests := []struct {
+		name       string
+		span       time.Duration
+		resolution time.Duration
+		maxPoints  int
+		rollup     time.Duration
+	}{
+		{name: "resolution", span: time.Hour, resolution: 5 * time.Second, maxPoints: 1000, rollup: 10 * time.Second},
+		{name: "rollup matching the resolution", span: time.Hour, resolution: time.Minute, maxPoints: 1000, rollup: time.Minute},
+		{name: "rollup above the resolution", span: time.Hour, resolution: 40 * time.Second, maxPoints: 1000, rollup: time.Minute},
+		{name: "points of an hour", span: time.Hour, resolution: 5 * time.Second, maxPoints: 100, rollup: time.Minute},
+		{name: "points of a week", span: 7 * 24 * time.Hour, resolution: 30 * time.Second, maxPoints: 1000, rollup: 15 * time.Minute},
+		{name: "points of a year", span: 365 * 24 * time.Hour, resolution: 30 * time.Second, maxPoints: 100, rollup: 4 * 24 * time.Hour},
+		{name: "resolution above a day", span: time.Hour, resolution: 36 * time.Hour, maxPoints: 1000, rollup: 48 * time.Hour},
+	}
+
+	for _, test := range tests {
+		if rollup := bandwidthRollup(test.span, test.resolution, test.maxPoints); rollup != test.rollup {
+			t.Errorf("%s: expected a rollup of %s, got %s", test.name, test.rollup, rollup)
+		}
+	}
+}
+
+func TestBandwidthRange(t *testing.T) {
+	from := time.Date(2019, 11, 4, 10, 2, 17, 0, time.UTC)
+	to := time.Date(2019, 11, 4, 11, 2, 17, 0, time.UTC)
+
+	alignedFrom, alignedTo := bandwidthRange(from, to, time.Minute)
+	if !alignedFrom.Equal(time.Date(2019, 11, 4, 10, 2, 0, 0, time.UTC)) || !alignedTo.Equal(time.Date(2019, 11, 4, 11, 3, 0, 0, time.UTC)) {
+		t.Errorf("Expected the range to be aligned on minutes, got %s - %s", alignedFrom, alignedTo)
+	}
+
+	// the same periods are returned from a refresh to another
+	refreshedFrom, refreshedTo := bandwidthRange(from.Add(20*time.Second), to.Add(20*time.Second), time.Minute)
+	if !refreshedFrom.Equal(alignedFrom) || !refreshedTo.Equal(alignedTo) {
+		t.Errorf("Expected the same periods after a refresh, got %s - %s", refreshedFrom, refreshedTo)
+	}
+
+	alignedFrom, alignedTo = bandwidthRange(from, to, 15*time.Minute)
+	if !alignedFrom.Equal(time.Date(2019, 11, 4, 10, 0, 0, 0, time.UTC)) || !alignedTo.Equal(time.Date(2019, 11, 4, 11, 15, 0, 0, time.UTC)) {
+		t.Errorf("Expected the range to be aligned on quarters, got %s - %s", alignedFrom, alignedTo)
+	}
+}
+
+func TestBandwidthSeries(t *testing.T) {
+	start := common.UnixMillis(time.Date(2019, 11, 4, 10, 0, 0, 0, time.UTC))
+
+	metrics := map[string][]common.Metric{
+		"eth0": {
+			&topology.InterfaceMetric{RxBytes: 60000, TxBytes: 6000, RxPackets: 600, TxPackets: 60, Start: start, Last: start + 60000},
+			// the counters were reset, the interface being recreated
+			&topology.InterfaceMetric{RxBytes: -1000000, TxBytes: 3000, RxPackets: -10000, TxPackets: 30, Start: start + 60000, Last: start + 120000},
+			&topology.InterfaceMetric{RxBytes: 120000, TxBytes: 12000, RxPackets: 1200, TxPackets: 120, Start: start + 120000, Last: start + 180000},
+			// no duration, no rate
+			&topology.InterfaceMetric{RxBytes: 1000, Start: start + 180000, Last: start + 180000},
+		},
+	}
+
+	series := bandwidthSeries(ge.NewMetricsTraversalStep(nil, metrics))
+	if len(series) != len(bandwidthFields) {
+		t.Fatalf("Expected a series per field, got %d", len(series))
+	}
+
+	expected := map[string][][2]float64{
+		"RxBytes/s":   {{1000, float64(start)}, {2000, float64(start + 120000)}},
+		"TxBytes/s":   {{100, float64(start)}, {50, float64(start + 60000)}, {200, float64(start + 120000)}},
+		"RxPackets/s": {{10, float64(start)}, {20, float64(start + 120000)}},
+		"TxPackets/s": {{1, float64(start)}, {0.5, float64(start + 60000)}, {2, float64(start + 120000)}},
+	}
+
+	for _, s := range series {
+		points, ok := expected[s.Target]
+		if !ok {
+			t.Errorf("Unexpected series %s", s.Target)
+			continue
+		}
+		if len(s.Datapoints) != len(points) {
+			t.Errorf("%s: expected %v, got %v", s.Target, points, s.Datapoints)
+			continue
+		}
+		for i := range points {
+			if s.Datapoints[i] != points[i] {
+				t.Errorf("%s: expected %v, got %v", s.Target, points, s.Datapoints)
+				break
+			}
+		}
+	}
+}
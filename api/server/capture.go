@@ -21,16 +21,25 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
 
 	"github.com/skydive-project/skydive/api/types"
 	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/flow"
 	"github.com/skydive-project/skydive/flow/probes"
 	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
 	ge "github.com/skydive-project/skydive/gremlin/traversal"
 	shttp "github.com/skydive-project/skydive/http"
 	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
 )
 
 // CaptureResourceHandler describes a capture ressouce handler
@@ -106,27 +115,115 @@ func (c *CaptureAPIHandler) Decorate(resource types.Resource) {
 func (c *CaptureAPIHandler) Create(r types.Resource, opts *CreateOptions) error {
 	capture := r.(*types.Capture)
 
-	// check capabilities
-	if capture.Type != "" {
-		if capture.BPFFilter != "" {
-			if !common.CheckProbeCapabilities(capture.Type, common.BPFCapability) {
-				return fmt.Errorf("%s capture doesn't support BPF filtering", capture.Type)
-			}
+	// the selector is stored normalized so that the captures created with
+	// the same selector can be deleted at once
+	if capture.Selector != "" {
+		selector, err := types.ParseLabelSelector(capture.Selector)
+		if err != nil {
+			return err
+		}
+		capture.Selector = selector.String()
+		capture.GremlinQuery = selector.GremlinQuery()
+	}
+
+	if err := checkCaptureCapabilities(capture); err != nil {
+		return err
+	}
+
+	if err := checkCaptureEncryption(capture); err != nil {
+		return err
+	}
+
+	expiration, err := captureExpiration(capture, time.Now())
+	if err != nil {
+		return err
+	}
+	if expiration > 0 {
+		if opts == nil {
+			opts = &CreateOptions{}
+		}
+		if opts.TTL == 0 || expiration < opts.TTL {
+			opts.TTL = expiration
 		}
-		if capture.RawPacketLimit != 0 {
-			if !common.CheckProbeCapabilities(capture.Type, common.RawPacketsCapability) {
-				return fmt.Errorf("%s capture doesn't support raw packet capture", capture.Type)
+	}
+
+	if c.isDuplicated(capture) {
+		return ErrDuplicatedResource
+	}
+
+	return c.BasicAPIHandler.Create(r, opts)
+}
+
+// captureExpiration returns the delay after which a capture resource
+// expires, either at the end of its time window or at the end of its TTL,
+// whichever comes first. Both count from the start time of the capture, or
+// from now if it starts immediately. 0 means that the capture does not expire.
+func captureExpiration(capture *types.Capture, now time.Time) (time.Duration, error) {
+	var expiration time.Duration
+	if capture.TTL > 0 {
+		expiration = time.Duration(capture.TTL) * time.Second
+		if capture.StartTime != nil {
+			expiration = capture.StartTime.Add(expiration).Sub(now)
+			if expiration < time.Second {
+				return 0, errors.New("capture time to live already elapsed")
 			}
 		}
-		if capture.ExtraTCPMetric {
-			if !common.CheckProbeCapabilities(capture.Type, common.ExtraTCPMetricCapability) {
-				return fmt.Errorf("%s capture doesn't support extra TCP metrics capture", capture.Type)
+	}
+
+	if capture.Duration > 0 {
+		end := time.Duration(capture.Duration) * time.Second
+		if capture.StartTime != nil {
+			end = capture.StartTime.Add(end).Sub(now)
+			if end < time.Second {
+				return 0, errors.New("capture time window already ended")
 			}
 		}
+		if expiration == 0 || end < expiration {
+			expiration = end
+		}
 	}
 
-	resources := c.Index()
-	for _, resource := range resources {
+	return expiration, nil
+}
+
+// checkCaptureCapabilities verifies the capture type supports the requested
+// features
+func checkCaptureCapabilities(capture *types.Capture) error {
+	if capture.Type == "" {
+		return nil
+	}
+
+	if capture.BPFFilter != "" {
+		if !common.CheckProbeCapabilities(capture.Type, common.BPFCapability) {
+			return fmt.Errorf("%s capture doesn't support BPF filtering", capture.Type)
+		}
+	}
+	if capture.RawPacketLimit != 0 {
+		if !common.CheckProbeCapabilities(capture.Type, common.RawPacketsCapability) {
+			return fmt.Errorf("%s capture doesn't support raw packet capture", capture.Type)
+		}
+	}
+	if capture.ExtraTCPMetric {
+		if !common.CheckProbeCapabilities(capture.Type, common.ExtraTCPMetricCapability) {
+			return fmt.Errorf("%s capture doesn't support extra TCP metrics capture", capture.Type)
+		}
+	}
+	return nil
+}
+
+// checkCaptureEncryption verifies the raw packets of the capture can be
+// encrypted when requested
+func checkCaptureEncryption(capture *types.Capture) error {
+	if capture.EncryptRawPackets && config.GetString("analyzer.flow.encryption.provider") == "" {
+		return errors.New("raw packet encryption is not configured on the analyzer")
+	}
+	return nil
+}
+
+// isDuplicated returns whether a capture of the same type already exists
+// on the same nodes
+func (c *CaptureAPIHandler) isDuplicated(capture *types.Capture) bool {
+	for _, resource := range c.Index() {
 		resource := resource.(*types.Capture)
 
 		sameGremlin := resource.GremlinQuery == capture.GremlinQuery
@@ -136,12 +233,160 @@ func (c *CaptureAPIHandler) Create(r types.Resource, opts *CreateOptions) error
 
 		if sameCaptureType && sameGremlin {
 			if !supportsMulti || sameBPFFilter {
-				return ErrDuplicatedResource
+				return true
 			}
 		}
 	}
+	return false
+}
 
-	return c.BasicAPIHandler.Create(r, opts)
+// DryRun checks the capabilities of the capture type, the duplicates and
+// the nodes matched by the Gremlin query
+func (c *CaptureAPIHandler) DryRun(r types.Resource, report *types.ValidationReport) {
+	capture := *r.(*types.Capture)
+
+	field := "GremlinQuery"
+	if capture.Selector != "" {
+		selector, err := types.ParseLabelSelector(capture.Selector)
+		if err != nil {
+			return
+		}
+		capture.GremlinQuery = selector.GremlinQuery()
+		field = "Selector"
+	}
+
+	if err := checkCaptureCapabilities(&capture); err != nil {
+		report.AddError("Type", "%s", err)
+	}
+
+	if err := checkCaptureEncryption(&capture); err != nil {
+		report.AddError("EncryptRawPackets", "%s", err)
+	}
+
+	if c.isDuplicated(&capture) {
+		report.AddError("", "%s", ErrDuplicatedResource)
+	}
+
+	ts, err := traversal.NewGremlinTraversalParser().Parse(strings.NewReader(capture.GremlinQuery))
+	if err != nil {
+		return
+	}
+
+	checkFieldReferences(c.Graph, ts, field, report)
+
+	c.Graph.RLock()
+	defer c.Graph.RUnlock()
+
+	res, err := ts.Exec(c.Graph, false)
+	if err != nil {
+		report.AddError(field, "Failed to execute the Gremlin query: %s", err)
+		return
+	}
+
+	for _, value := range res.Values() {
+		switch value := value.(type) {
+		case *graph.Node:
+			report.Matches++
+		case []*graph.Node:
+			report.Matches += len(value)
+		default:
+			report.AddError(field, "The Gremlin query has to return nodes")
+			return
+		}
+	}
+
+	if report.Matches == 0 {
+		report.AddWarning(field, "No node matches the Gremlin query")
+	}
+}
+
+// DeleteBySelector removes all the captures created with the given selector
+// and returns their IDs
+func (c *CaptureAPIHandler) DeleteBySelector(selector types.LabelSelector) ([]string, error) {
+	normalized := selector.String()
+
+	ids := []string{}
+	for id, resource := range c.Index() {
+		if resource.(*types.Capture).Selector != normalized {
+			continue
+		}
+		if err := c.Delete(id); err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (c *CaptureAPIHandler) deleteBySelector(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "capture", "write") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	selector, err := types.ParseLabelSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ids, err := c.DeleteBySelector(selector)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, ids)
+}
+
+func (c *CaptureAPIHandler) registerEndpoints(s *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation DELETE /capture deleteCapturesBySelector
+	//
+	// Delete the captures created with a label selector
+	//
+	// ---
+	// summary: Delete captures by selector
+	//
+	// tags:
+	// - Captures
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - name: selector
+	//     in: query
+	//     required: true
+	//     type: string
+	//
+	// responses:
+	//   200:
+	//     description: IDs of the deleted captures
+	//     schema:
+	//       type: array
+	//       items:
+	//         type: string
+	//
+	//   400:
+	//     description: Invalid selector
+
+	routes := []shttp.Route{
+		{
+			Name:        "CaptureDeleteBySelector",
+			Method:      "DELETE",
+			Path:        "/api/capture",
+			HandlerFunc: c.deleteBySelector,
+		},
+	}
+
+	s.RegisterRoutes(routes, authBackend)
 }
 
 // RegisterCaptureAPI registers an new resource, capture
@@ -156,5 +401,6 @@ func RegisterCaptureAPI(apiServer *Server, g *graph.Graph, authBackend shttp.Aut
 	if err := apiServer.RegisterAPIHandler(captureAPIHandler, authBackend); err != nil {
 		return nil, err
 	}
+	captureAPIHandler.registerEndpoints(apiServer.HTTPServer, authBackend)
 	return captureAPIHandler, nil
 }
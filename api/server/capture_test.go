@@ -0,0 +1,84 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+)
+
+func TestCaptureExpiration(t *testing.T) {
+	now := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	later, earlier := now.Add(time.Minute), now.Add(-time.Minute)
+
+	tests := []struct {
+		name       string
+		capture    types.Capture
+		expiration time.Duration
+		err        bool
+	}{
+		{name: "no limit"},
+		{name: "ttl", capture: types.Capture{TTL: 60}, expiration: time.Minute},
+		{name: "duration", capture: types.Capture{Duration: 30}, expiration: 30 * time.Second},
+		{name: "ttl before the end of the duration", capture: types.Capture{TTL: 10, Duration: 30}, expiration: 10 * time.Second},
+		{name: "duration before the ttl", capture: types.Capture{TTL: 60, Duration: 30}, expiration: 30 * time.Second},
+		{name: "scheduled", capture: types.Capture{StartTime: &later, Duration: 30}, expiration: 90 * time.Second},
+		{name: "scheduled without duration", capture: types.Capture{StartTime: &later}},
+		{name: "scheduled with ttl", capture: types.Capture{StartTime: &later, TTL: 60}, expiration: 2 * time.Minute},
+		{name: "ttl elapsed", capture: types.Capture{StartTime: &earlier, TTL: 30}, err: true},
+		{name: "window ended", capture: types.Capture{StartTime: &earlier, Duration: 30}, err: true},
+	}
+
+	for _, test := range tests {
+		expiration, err := captureExpiration(&test.capture, now)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: an error was expected", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		} else if expiration != test.expiration {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expiration, expiration)
+		}
+	}
+}
+
+func TestCaptureStartTime(t *testing.T) {
+	data, err := json.Marshal(&types.Capture{GremlinQuery: "G.V()"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "StartTime") {
+		t.Errorf("an unset start time should be omitted, got %s", data)
+	}
+
+	now := time.Now()
+	data, err = json.Marshal(&types.Capture{GremlinQuery: "G.V()", StartTime: &now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "StartTime") {
+		t.Errorf("the start time should be encoded, got %s", data)
+	}
+}
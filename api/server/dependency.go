@@ -0,0 +1,135 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// DependencyReporter is the interface to report the dependencies between
+// services observed from the flows
+type DependencyReporter interface {
+	GetDependencyMap(from, to time.Time) (interface{}, error)
+}
+
+type dependencyAPI struct {
+	reporter DependencyReporter
+}
+
+func (d *dependencyAPI) dependencyGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	// the dependencies are computed from the flows of the whole topology
+	if !rbac.Enforce(r.Username, "dependency", "read") || isScoped(r.Username) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, err := parseAuditTime(r.URL.Query().Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid from: %s", err))
+		return
+	}
+
+	to, err := parseAuditTime(r.URL.Query().Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid to: %s", err))
+		return
+	}
+
+	m, err := d.reporter.GetDependencyMap(from, to)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, m)
+}
+
+func (d *dependencyAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation GET /dependency getDependency
+	//
+	// Get the service dependency map
+	//
+	// ---
+	// summary: Get the service dependency map
+	//
+	// description: |
+	//   Return the groups of endpoints, Kubernetes services, virtual machines
+	//   or hosts, and the protocols and ports they used to talk to each other
+	//   according to the flows received during the time range.
+	//
+	// tags:
+	// - Dependency
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	// - name: from
+	//   in: query
+	//   description: start of the time range, RFC3339 or duration before now, ex 1h
+	//   required: false
+	//   type: string
+	//
+	// - name: to
+	//   in: query
+	//   description: end of the time range, RFC3339 or duration before now
+	//   required: false
+	//   type: string
+	//
+	// responses:
+	//   200:
+	//     description: Dependency map
+	//     schema:
+	//       $ref: '#/definitions/DependencyMap'
+	//
+	//   400:
+	//     description: invalid time range
+
+	routes := []shttp.Route{
+		{
+			Name:        "DependencyGet",
+			Method:      "GET",
+			Path:        "/api/dependency",
+			HandlerFunc: d.dependencyGet,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterDependencyAPI registers the service dependency map API endpoint
+func RegisterDependencyAPI(s *shttp.Server, r DependencyReporter, authBackend shttp.AuthenticationBackend) {
+	d := &dependencyAPI{
+		reporter: r,
+	}
+
+	d.registerEndpoints(s, authBackend)
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/graffiti/common/scopetest"
+)
+
+type fakeDependencyReporter struct{}
+
+func (fakeDependencyReporter) GetDependencyMap(from, to time.Time) (interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+func TestScopedDependency(t *testing.T) {
+	scopetest.InitRBAC(t, scopetest.TenantPolicy+`
+p, tenant, dependency, read, allow
+p, admin, dependency, read, allow`)
+
+	d := &dependencyAPI{reporter: fakeDependencyReporter{}}
+
+	for user, expected := range map[string]int{"alice": http.StatusMethodNotAllowed, "bob": http.StatusOK} {
+		w := httptest.NewRecorder()
+		d.dependencyGet(w, authenticatedRequest(user, "GET", "/api/dependency", ""))
+		if w.Code != expected {
+			t.Errorf("expected status %d for %s, got %d", expected, user, w.Code)
+		}
+	}
+}
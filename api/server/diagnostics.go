@@ -0,0 +1,357 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"strings"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+	"github.com/skydive-project/skydive/version"
+)
+
+// RuntimeStats describes the resources used by a process
+// swagger:model
+type RuntimeStats struct {
+	GoVersion     string
+	CPUs          int
+	Goroutines    int
+	CgoCalls      int64
+	HeapAlloc     uint64
+	HeapInuse     uint64
+	HeapIdle      uint64
+	HeapReleased  uint64
+	HeapObjects   uint64
+	StackInuse    uint64
+	Mallocs       uint64
+	Frees         uint64
+	Sys           uint64
+	NextGC        uint64
+	LastGC        time.Time
+	NumGC         uint32
+	PauseTotalNs  uint64
+	GCCPUFraction float64
+}
+
+// pprofPrefix is the path of the pprof endpoints
+const pprofPrefix = "/api/diagnostics/pprof/"
+
+// Diagnostics gathers the state of an agent or an analyzer, as attached
+// to the support bundles
+// swagger:model
+type Diagnostics struct {
+	// Server host ID
+	Host string
+	// Service type
+	Service string
+	// Skydive version
+	Version string
+	// Time of the diagnostics
+	Time time.Time
+	// Time the process was started at
+	StartTime time.Time
+	// Status of the service, as returned by the status API
+	Status interface{}
+	// Configuration, the secrets being redacted. Only returned
+	// to the users allowed to read the configuration
+	Config map[string]interface{} `json:",omitempty"`
+	// Last log lines. Only returned to the users allowed to read
+	// the configuration, as the logs may reveal it
+	Logs []string `json:",omitempty"`
+	// Resources used by the process
+	Runtime RuntimeStats
+}
+
+var startTime = time.Now()
+
+type diagnosticsAPI struct {
+	service  common.Service
+	reporter StatusReporter
+}
+
+func getRuntimeStats() RuntimeStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	return RuntimeStats{
+		GoVersion:     runtime.Version(),
+		CPUs:          runtime.NumCPU(),
+		Goroutines:    runtime.NumGoroutine(),
+		CgoCalls:      runtime.NumCgoCall(),
+		HeapAlloc:     m.HeapAlloc,
+		HeapInuse:     m.HeapInuse,
+		HeapIdle:      m.HeapIdle,
+		HeapReleased:  m.HeapReleased,
+		HeapObjects:   m.HeapObjects,
+		StackInuse:    m.StackInuse,
+		Mallocs:       m.Mallocs,
+		Frees:         m.Frees,
+		Sys:           m.Sys,
+		NextGC:        m.NextGC,
+		LastGC:        time.Unix(0, int64(m.LastGC)),
+		NumGC:         m.NumGC,
+		PauseTotalNs:  m.PauseTotalNs,
+		GCCPUFraction: m.GCCPUFraction,
+	}
+}
+
+func (d *diagnosticsAPI) diagnosticsGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "status", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	diagnostics := &Diagnostics{
+		Host:      d.service.ID,
+		Service:   string(d.service.Type),
+		Version:   version.Version,
+		Time:      time.Now(),
+		StartTime: startTime,
+		Status:    d.reporter.GetStatus(),
+		Runtime:   getRuntimeStats(),
+	}
+
+	if rbac.Enforce(r.Username, "config", "read") {
+		diagnostics.Config = config.GetRedactedSettings()
+		diagnostics.Logs = logging.RecentLogs()
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(diagnostics); err != nil {
+		logging.GetLogger().Warningf("Error while writing response: %s", err)
+	}
+}
+
+func (d *diagnosticsAPI) runtimeGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "profiling", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(getRuntimeStats()); err != nil {
+		logging.GetLogger().Warningf("Error while writing response: %s", err)
+	}
+}
+
+func (d *diagnosticsAPI) goroutinesGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "profiling", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := rpprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		logging.GetLogger().Warningf("Error while writing response: %s", err)
+	}
+}
+
+// pprofGet serves the net/http/pprof handlers, the profile names being
+// the ones of the standard /debug/pprof/ endpoints
+func (d *diagnosticsAPI) pprofGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "profiling", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch name := strings.TrimPrefix(r.URL.Path, pprofPrefix); name {
+	case "":
+		// the index only lists the profiles of the /debug/pprof/ path
+		r.URL.Path = "/debug/pprof/"
+		pprof.Index(w, &r.Request)
+	case "cmdline":
+		pprof.Cmdline(w, &r.Request)
+	case "profile":
+		pprof.Profile(w, &r.Request)
+	case "symbol":
+		pprof.Symbol(w, &r.Request)
+	case "trace":
+		pprof.Trace(w, &r.Request)
+	default:
+		if rpprof.Lookup(name) == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		pprof.Handler(name).ServeHTTP(w, &r.Request)
+	}
+}
+
+func (d *diagnosticsAPI) registerProfilingEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation GET /diagnostics/runtime getRuntimeStats
+	//
+	// Get runtime statistics
+	//
+	// ---
+	// summary: Get the memory, garbage collector and goroutine statistics
+	//
+	// tags:
+	// - Status
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// responses:
+	//   200:
+	//     description: Runtime statistics
+	//     schema:
+	//       $ref: '#/definitions/RuntimeStats'
+
+	// swagger:operation GET /diagnostics/goroutines getGoroutines
+	//
+	// Get goroutines
+	//
+	// ---
+	// summary: Get the stack traces of all the goroutines
+	//
+	// tags:
+	// - Status
+	//
+	// produces:
+	// - text/plain
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// responses:
+	//   200:
+	//     description: Goroutine dump
+
+	// swagger:operation GET /diagnostics/pprof/{profile} getProfile
+	//
+	// Get a profile
+	//
+	// ---
+	// summary: Get a pprof profile, to be read with go tool pprof
+	//
+	// tags:
+	// - Status
+	//
+	// produces:
+	// - application/octet-stream
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	// - name: profile
+	//   in: path
+	//   required: true
+	//   type: string
+	//   description: heap, goroutine, allocs, block, mutex, threadcreate, profile or trace
+	//
+	// responses:
+	//   200:
+	//     description: Profile
+	//   404:
+	//     description: Unknown profile
+
+	routes := []shttp.Route{
+		{
+			Name:        "RuntimeStatsGet",
+			Method:      "GET",
+			Path:        "/api/diagnostics/runtime",
+			HandlerFunc: d.runtimeGet,
+		},
+		{
+			Name:        "GoroutinesGet",
+			Method:      "GET",
+			Path:        "/api/diagnostics/goroutines",
+			HandlerFunc: d.goroutinesGet,
+		},
+		{
+			Name:        "ProfileGet",
+			Method:      "GET",
+			Path:        shttp.PathPrefix(pprofPrefix),
+			HandlerFunc: d.pprofGet,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+func (d *diagnosticsAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation GET /diagnostics getDiagnostics
+	//
+	// Get diagnostics
+	//
+	// ---
+	// summary: Get the diagnostics included in support bundles
+	//
+	// tags:
+	// - Status
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// responses:
+	//   200:
+	//     description: Diagnostics
+	//     schema:
+	//       $ref: '#/definitions/Diagnostics'
+
+	routes := []shttp.Route{
+		{
+			Name:        "DiagnosticsGet",
+			Method:      "GET",
+			Path:        "/api/diagnostics",
+			HandlerFunc: d.diagnosticsGet,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterDiagnosticsAPI registers the diagnostics API endpoint
+func RegisterDiagnosticsAPI(s *shttp.Server, service common.Service, r StatusReporter, authBackend shttp.AuthenticationBackend) {
+	d := &diagnosticsAPI{
+		service:  service,
+		reporter: r,
+	}
+
+	d.registerEndpoints(s, authBackend)
+
+	// the profiling endpoints are only exposed when enabled, profiles
+	// being costly to compute
+	if config.GetBool(string(service.Type) + ".diagnostics.profiling") {
+		d.registerProfilingEndpoints(s, authBackend)
+	}
+}
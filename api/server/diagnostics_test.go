@@ -0,0 +1,76 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/common/scopetest"
+	"github.com/skydive-project/skydive/logging"
+)
+
+const diagnosticsPolicy = `p, admin, status, read, allow
+p, admin, config, read, allow
+g, bob, admin
+p, guest, status, read, allow
+g, carol, guest`
+
+type fakeStatusReporter struct{}
+
+func (f *fakeStatusReporter) GetStatus() interface{} {
+	return map[string]string{"State": "running"}
+}
+
+func TestDiagnosticsLogs(t *testing.T) {
+	scopetest.InitRBAC(t, diagnosticsPolicy)
+
+	backend := logging.NewRecentBackend(10)
+	backend.(io.Writer).Write([]byte("connecting with password secret\n"))
+
+	d := &diagnosticsAPI{
+		service:  common.Service{ID: "testhost", Type: common.AnalyzerService},
+		reporter: &fakeStatusReporter{},
+	}
+
+	diagnostics := func(user string) map[string]interface{} {
+		w := httptest.NewRecorder()
+		d.diagnosticsGet(w, authenticatedRequest(user, "GET", "/api/diagnostics", ""))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Unexpected status %d", w.Code)
+		}
+
+		var diagnostics map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &diagnostics); err != nil {
+			t.Fatal(err)
+		}
+		return diagnostics
+	}
+
+	if res := diagnostics("carol"); res["Logs"] != nil || res["Config"] != nil {
+		t.Errorf("carol is not allowed to read the configuration nor the logs, got %+v", res)
+	}
+
+	if logs, _ := diagnostics("bob")["Logs"].([]interface{}); len(logs) != 1 {
+		t.Errorf("bob should get the recent logs, got %+v", logs)
+	}
+}
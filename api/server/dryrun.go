@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"sort"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	"github.com/skydive-project/skydive/validator"
+)
+
+// DryRunHandler is implemented by the handlers checking their resources
+// against the live topology in dry-run mode
+type DryRunHandler interface {
+	DryRun(resource types.Resource, report *types.ValidationReport)
+}
+
+// dryRun validates a resource without creating it
+func dryRun(handler Handler, resource types.Resource) *types.ValidationReport {
+	report := &types.ValidationReport{}
+
+	errs := validator.ValidateFields(resource)
+	fields := make([]string, 0, len(errs))
+	for field := range errs {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		for _, err := range errs[field] {
+			report.AddError(field, "%s", err)
+		}
+	}
+
+	if h, ok := handler.(DryRunHandler); ok {
+		h.DryRun(resource, report)
+	}
+
+	report.Valid = len(report.Errors) == 0
+	return report
+}
+
+// fieldReferences returns the keys the nodes and edges are filtered on by
+// a query. It stops at the first step of an extension, like Flows, as the
+// next steps filter other kinds of objects.
+func fieldReferences(seq *traversal.GremlinTraversalSequence) (keys []string) {
+	for _, step := range seq.Steps() {
+		params := step.Context().Params
+
+		switch step.(type) {
+		case *traversal.GremlinTraversalStepHas, *traversal.GremlinTraversalStepHasEither:
+			for i := 0; i < len(params); i += 2 {
+				if key, ok := params[i].(string); ok {
+					keys = append(keys, key)
+				}
+			}
+		case *traversal.GremlinTraversalStepHasKey, *traversal.GremlinTraversalStepHasNot:
+			if len(params) > 0 {
+				if key, ok := params[0].(string); ok {
+					keys = append(keys, key)
+				}
+			}
+		case *traversal.GremlinTraversalStepG, *traversal.GremlinTraversalStepV, *traversal.GremlinTraversalStepE,
+			*traversal.GremlinTraversalStepContext, *traversal.GremlinTraversalStepOut, *traversal.GremlinTraversalStepIn,
+			*traversal.GremlinTraversalStepBoth, *traversal.GremlinTraversalStepOutV, *traversal.GremlinTraversalStepInV,
+			*traversal.GremlinTraversalStepBothV, *traversal.GremlinTraversalStepOutE, *traversal.GremlinTraversalStepInE,
+			*traversal.GremlinTraversalStepBothE, *traversal.GremlinTraversalStepDedup, *traversal.GremlinTraversalStepRange,
+			*traversal.GremlinTraversalStepLimit, *traversal.GremlinTraversalStepSort, *traversal.GremlinTraversalStepAs:
+		default:
+			return
+		}
+	}
+	return
+}
+
+// checkFieldReferences warns about the fields a query filters on that no
+// node or edge of the graph has
+func checkFieldReferences(g *graph.Graph, seq *traversal.GremlinTraversalSequence, field string, report *types.ValidationReport) {
+	keys := fieldReferences(seq)
+	if len(keys) == 0 {
+		return
+	}
+
+	known := make(map[string]bool)
+
+	g.RLock()
+	for _, node := range g.GetNodes(nil) {
+		for _, key := range node.GetFieldKeys() {
+			known[key] = true
+		}
+	}
+	for _, edge := range g.GetEdges(nil) {
+		for _, key := range edge.GetFieldKeys() {
+			known[key] = true
+		}
+	}
+	g.RUnlock()
+
+	for _, key := range keys {
+		if !known[key] {
+			report.AddWarning(field, "No node or edge has a '%s' field", key)
+			known[key] = true
+		}
+	}
+}
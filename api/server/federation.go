@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/skydive-project/skydive/api/types"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+	"github.com/skydive-project/skydive/validator"
+)
+
+// FederatedQuerier is the interface to run a Gremlin query on the sites of
+// a federation
+type FederatedQuerier interface {
+	QuerySites(query *types.FederatedQuery) ([]*types.SiteResult, error)
+}
+
+type federationAPI struct {
+	querier FederatedQuerier
+}
+
+func (f *federationAPI) federatedTopologySearch(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	// the sites are queried with the cluster credentials, not the user ones
+	if !rbac.Enforce(r.Username, "topology", "read") || isScoped(r.Username) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var query types.FederatedQuery
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validator.Validate(query); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	results, err := f.querier.QuerySites(&query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		logging.GetLogger().Warningf("Error while writing response: %s", err)
+	}
+}
+
+func (f *federationAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation POST /federation/topology searchFederatedTopology
+	//
+	// Search the topology of the federated sites
+	//
+	// ---
+	// summary: Search the topology of the federated sites
+	//
+	// tags:
+	// - topology
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - in: body
+	//     name: query
+	//     required: true
+	//     schema:
+	//       $ref: '#/definitions/FederatedQuery'
+	//
+	// responses:
+	//   200:
+	//     description: Results of the sites
+	//     schema:
+	//       type: array
+	//       items:
+	//         $ref: '#/definitions/SiteResult'
+	//
+	//   400:
+	//     description: invalid query or unknown site
+
+	routes := []shttp.Route{
+		{
+			Name:        "FederatedTopologySearch",
+			Method:      "POST",
+			Path:        "/api/federation/topology",
+			HandlerFunc: f.federatedTopologySearch,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterFederationAPI registers the federated query API endpoint
+func RegisterFederationAPI(s *shttp.Server, q FederatedQuerier, authBackend shttp.AuthenticationBackend) {
+	f := &federationAPI{
+		querier: q,
+	}
+
+	f.registerEndpoints(s, authBackend)
+}
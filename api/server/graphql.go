@@ -0,0 +1,777 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	auth "github.com/abbot/go-http-auth"
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// GraphQL schema of the topology and the flows. Times are expressed in
+// milliseconds and 64 bits integers as floats.
+const graphQLSchema = `
+schema {
+	query: Query
+}
+
+# Any JSON value
+scalar JSON
+
+type Query {
+	# Nodes returned by a Gremlin query, G.V() by default
+	nodes(gremlin: String): [Node!]!
+	node(id: ID!): Node
+	# Edges returned by a Gremlin query, G.E() by default
+	edges(gremlin: String): [Edge!]!
+	# Flows returned by a Gremlin query, G.Flows() by default
+	flows(gremlin: String): [Flow!]!
+}
+
+type Node {
+	id: ID!
+	host: String!
+	origin: String!
+	createdAt: Float!
+	updatedAt: Float!
+	name: String
+	type: String
+	# All the metadata or the value of a key, e.g. Captures.State
+	metadata(key: String): JSON
+	edges(relationType: String): [Edge!]!
+	parents(relationType: String): [Node!]!
+	children(relationType: String): [Node!]!
+	flows: [Flow!]!
+}
+
+type Edge {
+	id: ID!
+	host: String!
+	origin: String!
+	createdAt: Float!
+	updatedAt: Float!
+	relationType: String
+	metadata(key: String): JSON
+	parent: Node
+	child: Node
+}
+
+type FlowLayer {
+	protocol: String!
+	a: String!
+	b: String!
+	id: Float!
+}
+
+type TransportLayer {
+	protocol: String!
+	a: Float!
+	b: Float!
+	id: Float!
+}
+
+type FlowMetric {
+	abPackets: Float!
+	abBytes: Float!
+	baPackets: Float!
+	baBytes: Float!
+	start: Float!
+	last: Float!
+	rtt: Float!
+}
+
+type Flow {
+	uuid: ID!
+	layersPath: String!
+	application: String!
+	trackingID: String!
+	l3TrackingID: String!
+	parentUUID: String!
+	captureID: String!
+	nodeTID: String!
+	start: Float!
+	last: Float!
+	link: FlowLayer
+	network: FlowLayer
+	transport: TransportLayer
+	metric: FlowMetric
+	lastUpdateMetric: FlowMetric
+	# Node on which the flow was captured
+	node: Node
+	# Any other field of the flow, e.g. TCPMetric.ABSynStart
+	field(key: String!): JSON
+}
+`
+
+const (
+	// nesting depth of the fields of a query, limiting the relationships
+	// walked by a single request
+	graphQLMaxDepth = 10
+	// number of resolvers of a request running in parallel
+	graphQLMaxParallelism = 10
+)
+
+// GraphQLAPI exposes the topology and the flows through GraphQL
+type GraphQLAPI struct {
+	graph  *graph.Graph
+	parser *traversal.GremlinTraversalParser
+	schema *graphql.Schema
+}
+
+// graphQLJSON is the JSON scalar of the schema. The value is encoded when
+// resolved, while the graph is locked.
+type graphQLJSON struct {
+	raw json.RawMessage
+}
+
+func (graphQLJSON) ImplementsGraphQLType(name string) bool {
+	return name == "JSON"
+}
+
+func (j *graphQLJSON) UnmarshalGraphQL(input interface{}) (err error) {
+	j.raw, err = json.Marshal(input)
+	return
+}
+
+func (j graphQLJSON) MarshalJSON() ([]byte, error) {
+	return j.raw, nil
+}
+
+func newGraphQLJSON(value interface{}) (*graphQLJSON, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return &graphQLJSON{raw: raw}, nil
+}
+
+type queryResolver struct {
+	api *GraphQLAPI
+}
+
+type nodeResolver struct {
+	api   *GraphQLAPI
+	node  *graph.Node
+	batch *flowBatch
+}
+
+// flowBatch looks up at once the flows of the nodes resolved together, a
+// list of nodes for instance, instead of one query per node
+type flowBatch struct {
+	once  sync.Once
+	nodes []*graph.Node
+	flows map[string][]*flowResolver
+	err   error
+}
+
+type edgeResolver struct {
+	api  *GraphQLAPI
+	edge *graph.Edge
+}
+
+type flowResolver struct {
+	api  *GraphQLAPI
+	flow *flow.Flow
+}
+
+type flowLayerResolver struct {
+	layer *flow.FlowLayer
+}
+
+type transportLayerResolver struct {
+	layer *flow.TransportLayer
+}
+
+type flowMetricResolver struct {
+	metric *flow.FlowMetric
+}
+
+type gremlinArgs struct {
+	Gremlin *string
+}
+
+type keyArgs struct {
+	Key *string
+}
+
+type relationTypeArgs struct {
+	RelationType *string
+}
+
+func (g *GraphQLAPI) query(query string, bindings map[string]interface{}) (traversal.GraphTraversalStep, error) {
+	ts, err := g.parser.ParseWithBindings(query, bindings)
+	if err != nil {
+		return nil, err
+	}
+	return ts.Exec(g.graph, true)
+}
+
+func (g *GraphQLAPI) newNodeResolver(node *graph.Node) *nodeResolver {
+	return &nodeResolver{api: g, node: node, batch: &flowBatch{nodes: []*graph.Node{node}}}
+}
+
+func (g *GraphQLAPI) newNodeResolvers(nodes []*graph.Node) []*nodeResolver {
+	batch := &flowBatch{nodes: nodes}
+
+	resolvers := make([]*nodeResolver, len(nodes))
+	for i, node := range nodes {
+		resolvers[i] = &nodeResolver{api: g, node: node, batch: batch}
+	}
+	return resolvers
+}
+
+func (g *GraphQLAPI) newEdgeResolvers(edges []*graph.Edge) []*edgeResolver {
+	resolvers := make([]*edgeResolver, len(edges))
+	for i, edge := range edges {
+		resolvers[i] = &edgeResolver{api: g, edge: edge}
+	}
+	return resolvers
+}
+
+func (g *GraphQLAPI) flows(query string, bindings map[string]interface{}) ([]*flowResolver, error) {
+	res, err := g.query(query, bindings)
+	if err != nil {
+		return nil, err
+	}
+
+	flowStep, ok := res.(*ge.FlowTraversalStep)
+	if !ok {
+		return nil, errors.New("Query didn't return flows")
+	}
+
+	var resolvers []*flowResolver
+	for _, value := range flowStep.Values() {
+		resolvers = append(resolvers, &flowResolver{api: g, flow: value.(*flow.Flow)})
+	}
+	return resolvers, nil
+}
+
+// batchFlows returns the flows of the given nodes, indexed by node TID
+func (g *GraphQLAPI) batchFlows(nodes []*graph.Node) (map[string][]*flowResolver, error) {
+	var placeholders []string
+	bindings := make(map[string]interface{})
+
+	g.graph.RLock()
+	for _, node := range nodes {
+		if tid, _ := node.GetFieldString("TID"); tid != "" {
+			name := fmt.Sprintf("tid%d", len(placeholders))
+			placeholders = append(placeholders, "$"+name)
+			bindings[name] = tid
+		}
+	}
+	g.graph.RUnlock()
+
+	flows := make(map[string][]*flowResolver)
+	if len(placeholders) == 0 {
+		return flows, nil
+	}
+
+	query := fmt.Sprintf("G.V().Has('TID', Within(%s)).Flows()", strings.Join(placeholders, ", "))
+	resolvers, err := g.flows(query, bindings)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, resolver := range resolvers {
+		flows[resolver.flow.NodeTID] = append(flows[resolver.flow.NodeTID], resolver)
+	}
+	return flows, nil
+}
+
+// metadata returns the metadata of a graph element, or the value of one
+// of its keys
+func (g *GraphQLAPI) metadata(m graph.Metadata, key *string) (*graphQLJSON, error) {
+	g.graph.RLock()
+	defer g.graph.RUnlock()
+
+	if key == nil {
+		return newGraphQLJSON(m)
+	}
+
+	value, err := m.GetField(*key)
+	if err != nil {
+		return nil, nil
+	}
+	return newGraphQLJSON(value)
+}
+
+func (g *GraphQLAPI) fieldString(e interface {
+	GetFieldString(string) (string, error)
+}, key string) *string {
+	g.graph.RLock()
+	defer g.graph.RUnlock()
+
+	if value, err := e.GetFieldString(key); err == nil {
+		return &value
+	}
+	return nil
+}
+
+func gremlinOrDefault(gremlin *string, defaultQuery string) string {
+	if gremlin == nil || *gremlin == "" {
+		return defaultQuery
+	}
+	return *gremlin
+}
+
+func relationTypeMatcher(relationType *string) graph.ElementMatcher {
+	if relationType == nil {
+		return nil
+	}
+	return graph.Metadata{"RelationType": *relationType}
+}
+
+func (q *queryResolver) Nodes(args gremlinArgs) ([]*nodeResolver, error) {
+	res, err := q.api.query(gremlinOrDefault(args.Gremlin, "G.V()"), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeStep, ok := res.(*traversal.GraphTraversalV)
+	if !ok {
+		return nil, errors.New("Query didn't return nodes")
+	}
+	return q.api.newNodeResolvers(nodeStep.GetNodes()), nil
+}
+
+func (q *queryResolver) Node(args struct{ ID graphql.ID }) *nodeResolver {
+	q.api.graph.RLock()
+	defer q.api.graph.RUnlock()
+
+	if node := q.api.graph.GetNode(graph.Identifier(args.ID)); node != nil {
+		return q.api.newNodeResolver(node)
+	}
+	return nil
+}
+
+func (q *queryResolver) Edges(args gremlinArgs) ([]*edgeResolver, error) {
+	res, err := q.api.query(gremlinOrDefault(args.Gremlin, "G.E()"), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	edgeStep, ok := res.(*traversal.GraphTraversalE)
+	if !ok {
+		return nil, errors.New("Query didn't return edges")
+	}
+
+	var edges []*graph.Edge
+	for _, value := range edgeStep.Values() {
+		edges = append(edges, value.(*graph.Edge))
+	}
+	return q.api.newEdgeResolvers(edges), nil
+}
+
+func (q *queryResolver) Flows(args gremlinArgs) ([]*flowResolver, error) {
+	return q.api.flows(gremlinOrDefault(args.Gremlin, "G.Flows()"), nil)
+}
+
+func (n *nodeResolver) ID() graphql.ID {
+	return graphql.ID(n.node.ID)
+}
+
+func (n *nodeResolver) Host() string {
+	return n.node.Host
+}
+
+func (n *nodeResolver) Origin() string {
+	return n.node.Origin
+}
+
+func (n *nodeResolver) CreatedAt() float64 {
+	return float64(n.node.CreatedAt.Unix())
+}
+
+func (n *nodeResolver) UpdatedAt() float64 {
+	return float64(n.node.UpdatedAt.Unix())
+}
+
+func (n *nodeResolver) Name() *string {
+	return n.api.fieldString(n.node, "Name")
+}
+
+func (n *nodeResolver) Type() *string {
+	return n.api.fieldString(n.node, "Type")
+}
+
+func (n *nodeResolver) Metadata(args keyArgs) (*graphQLJSON, error) {
+	return n.api.metadata(n.node.Metadata, args.Key)
+}
+
+func (n *nodeResolver) Edges(args relationTypeArgs) []*edgeResolver {
+	n.api.graph.RLock()
+	defer n.api.graph.RUnlock()
+
+	return n.api.newEdgeResolvers(n.api.graph.GetNodeEdges(n.node, relationTypeMatcher(args.RelationType)))
+}
+
+func (n *nodeResolver) Parents(args relationTypeArgs) []*nodeResolver {
+	n.api.graph.RLock()
+	defer n.api.graph.RUnlock()
+
+	return n.api.newNodeResolvers(n.api.graph.LookupParents(n.node, nil, relationTypeMatcher(args.RelationType)))
+}
+
+func (n *nodeResolver) Children(args relationTypeArgs) []*nodeResolver {
+	n.api.graph.RLock()
+	defer n.api.graph.RUnlock()
+
+	return n.api.newNodeResolvers(n.api.graph.LookupChildren(n.node, nil, relationTypeMatcher(args.RelationType)))
+}
+
+func (n *nodeResolver) Flows() ([]*flowResolver, error) {
+	n.batch.once.Do(func() {
+		n.batch.flows, n.batch.err = n.api.batchFlows(n.batch.nodes)
+	})
+	if n.batch.err != nil {
+		return nil, n.batch.err
+	}
+
+	tid := n.api.fieldString(n.node, "TID")
+	if tid == nil {
+		return nil, nil
+	}
+	return n.batch.flows[*tid], nil
+}
+
+func (e *edgeResolver) ID() graphql.ID {
+	return graphql.ID(e.edge.ID)
+}
+
+func (e *edgeResolver) Host() string {
+	return e.edge.Host
+}
+
+func (e *edgeResolver) Origin() string {
+	return e.edge.Origin
+}
+
+func (e *edgeResolver) CreatedAt() float64 {
+	return float64(e.edge.CreatedAt.Unix())
+}
+
+func (e *edgeResolver) UpdatedAt() float64 {
+	return float64(e.edge.UpdatedAt.Unix())
+}
+
+func (e *edgeResolver) RelationType() *string {
+	return e.api.fieldString(e.edge, "RelationType")
+}
+
+func (e *edgeResolver) Metadata(args keyArgs) (*graphQLJSON, error) {
+	return e.api.metadata(e.edge.Metadata, args.Key)
+}
+
+func (e *edgeResolver) node(id graph.Identifier) *nodeResolver {
+	e.api.graph.RLock()
+	defer e.api.graph.RUnlock()
+
+	if node := e.api.graph.GetNode(id); node != nil {
+		return e.api.newNodeResolver(node)
+	}
+	return nil
+}
+
+func (e *edgeResolver) Parent() *nodeResolver {
+	return e.node(e.edge.Parent)
+}
+
+func (e *edgeResolver) Child() *nodeResolver {
+	return e.node(e.edge.Child)
+}
+
+func (f *flowResolver) UUID() graphql.ID {
+	return graphql.ID(f.flow.UUID)
+}
+
+func (f *flowResolver) LayersPath() string {
+	return f.flow.LayersPath
+}
+
+func (f *flowResolver) Application() string {
+	return f.flow.Application
+}
+
+func (f *flowResolver) TrackingID() string {
+	return f.flow.TrackingID
+}
+
+func (f *flowResolver) L3TrackingID() string {
+	return f.flow.L3TrackingID
+}
+
+func (f *flowResolver) ParentUUID() string {
+	return f.flow.ParentUUID
+}
+
+func (f *flowResolver) CaptureID() string {
+	return f.flow.CaptureID
+}
+
+func (f *flowResolver) NodeTID() string {
+	return f.flow.NodeTID
+}
+
+func (f *flowResolver) Start() float64 {
+	return float64(f.flow.Start)
+}
+
+func (f *flowResolver) Last() float64 {
+	return float64(f.flow.Last)
+}
+
+func (f *flowResolver) Link() *flowLayerResolver {
+	if f.flow.Link == nil {
+		return nil
+	}
+	return &flowLayerResolver{layer: f.flow.Link}
+}
+
+func (f *flowResolver) Network() *flowLayerResolver {
+	if f.flow.Network == nil {
+		return nil
+	}
+	return &flowLayerResolver{layer: f.flow.Network}
+}
+
+func (f *flowResolver) Transport() *transportLayerResolver {
+	if f.flow.Transport == nil {
+		return nil
+	}
+	return &transportLayerResolver{layer: f.flow.Transport}
+}
+
+func (f *flowResolver) Metric() *flowMetricResolver {
+	if f.flow.Metric == nil {
+		return nil
+	}
+	return &flowMetricResolver{metric: f.flow.Metric}
+}
+
+func (f *flowResolver) LastUpdateMetric() *flowMetricResolver {
+	if f.flow.LastUpdateMetric == nil {
+		return nil
+	}
+	return &flowMetricResolver{metric: f.flow.LastUpdateMetric}
+}
+
+func (f *flowResolver) Node() *nodeResolver {
+	if f.flow.NodeTID == "" {
+		return nil
+	}
+
+	f.api.graph.RLock()
+	defer f.api.graph.RUnlock()
+
+	if node := f.api.graph.LookupFirstNode(graph.Metadata{"TID": f.flow.NodeTID}); node != nil {
+		return f.api.newNodeResolver(node)
+	}
+	return nil
+}
+
+func (f *flowResolver) Field(args struct{ Key string }) (*graphQLJSON, error) {
+	value, err := f.flow.GetField(args.Key)
+	if err != nil {
+		return nil, nil
+	}
+	return newGraphQLJSON(value)
+}
+
+func (l *flowLayerResolver) Protocol() string {
+	return l.layer.Protocol.String()
+}
+
+func (l *flowLayerResolver) A() string {
+	return l.layer.A
+}
+
+func (l *flowLayerResolver) B() string {
+	return l.layer.B
+}
+
+func (l *flowLayerResolver) ID() float64 {
+	return float64(l.layer.ID)
+}
+
+func (l *transportLayerResolver) Protocol() string {
+	return l.layer.Protocol.String()
+}
+
+func (l *transportLayerResolver) A() float64 {
+	return float64(l.layer.A)
+}
+
+func (l *transportLayerResolver) B() float64 {
+	return float64(l.layer.B)
+}
+
+func (l *transportLayerResolver) ID() float64 {
+	return float64(l.layer.ID)
+}
+
+func (m *flowMetricResolver) ABPackets() float64 {
+	return float64(m.metric.ABPackets)
+}
+
+func (m *flowMetricResolver) ABBytes() float64 {
+	return float64(m.metric.ABBytes)
+}
+
+func (m *flowMetricResolver) BAPackets() float64 {
+	return float64(m.metric.BAPackets)
+}
+
+func (m *flowMetricResolver) BABytes() float64 {
+	return float64(m.metric.BABytes)
+}
+
+func (m *flowMetricResolver) Start() float64 {
+	return float64(m.metric.Start)
+}
+
+func (m *flowMetricResolver) Last() float64 {
+	return float64(m.metric.Last)
+}
+
+func (m *flowMetricResolver) RTT() float64 {
+	return float64(m.metric.RTT)
+}
+
+func (g *GraphQLAPI) graphQLQuery(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	// the resolvers walk the whole graph, not available to scoped users
+	if !rbac.Enforce(r.Username, "topology", "read") || isScoped(r.Username) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var params types.GraphQLParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response := g.schema.Exec(r.Context(), params.Query, params.OperationName, params.Variables)
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(response); err != nil {
+		writeError(w, http.StatusNotAcceptable, fmt.Errorf("Error while encoding response: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b.Bytes()); err != nil {
+		logging.GetLogger().Errorf("Error while writing response: %s", err)
+	}
+}
+
+func (g *GraphQLAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation POST /graphql graphQLQuery
+	//
+	// Query the topology and the flows using GraphQL
+	//
+	// ---
+	// summary: Query the topology and the flows using GraphQL
+	//
+	// description: |
+	//   Nodes, edges and flows are selected with Gremlin queries and their
+	//   relationships resolved on demand, for instance
+	//   { nodes(gremlin: "G.V().Has('Type', 'netns')") { name children { name } flows { application } } }
+	//
+	// tags:
+	// - GraphQL
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - in: body
+	//     name: params
+	//     required: true
+	//     schema:
+	//       $ref: '#/definitions/GraphQLParams'
+	//
+	// responses:
+	//   200:
+	//     description: Query result, with the errors if any
+	//
+	//   400:
+	//     description: Invalid request
+
+	routes := []shttp.Route{
+		{
+			Name:        "GraphQLQuery",
+			Method:      "POST",
+			Path:        "/api/graphql",
+			HandlerFunc: g.graphQLQuery,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+func newGraphQLAPI(g *graph.Graph, parser *traversal.GremlinTraversalParser) (*GraphQLAPI, error) {
+	api := &GraphQLAPI{
+		graph:  g,
+		parser: parser,
+	}
+
+	schema, err := graphql.ParseSchema(graphQLSchema, &queryResolver{api: api},
+		graphql.MaxDepth(graphQLMaxDepth), graphql.MaxParallelism(graphQLMaxParallelism))
+	if err != nil {
+		return nil, err
+	}
+	api.schema = schema
+
+	return api, nil
+}
+
+// RegisterGraphQLAPI registers the GraphQL endpoint
+func RegisterGraphQLAPI(r *shttp.Server, g *graph.Graph, parser *traversal.GremlinTraversalParser, authBackend shttp.AuthenticationBackend) error {
+	api, err := newGraphQLAPI(g, parser)
+	if err != nil {
+		return err
+	}
+
+	api.registerEndpoints(r, authBackend)
+
+	return nil
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// fakeFlowTableClient returns the flows of the requested nodes and counts
+// the lookups
+type fakeFlowTableClient struct {
+	flows   []*flow.Flow
+	lookups int
+}
+
+func (tc *fakeFlowTableClient) LookupFlows(flowSearchQuery filters.SearchQuery) (*flow.FlowSet, error) {
+	tc.lookups++
+	return &flow.FlowSet{Flows: tc.flows}, nil
+}
+
+func (tc *fakeFlowTableClient) LookupFlowsByNodes(hnmap topology.HostNodeTIDMap, flowSearchQuery filters.SearchQuery) (*flow.FlowSet, error) {
+	tc.lookups++
+
+	tids := make(map[string]bool)
+	for _, nodeTIDs := range hnmap {
+		for _, tid := range nodeTIDs {
+			tids[tid] = true
+		}
+	}
+
+	flowset := &flow.FlowSet{}
+	for _, fl := range tc.flows {
+		if tids[fl.NodeTID] {
+			flowset.Flows = append(flowset.Flows, fl)
+		}
+	}
+	return flowset, nil
+}
+
+func newTestGraphQLAPI(t *testing.T) (*GraphQLAPI, *fakeFlowTableClient) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.UnknownService)
+
+	host, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "host1", "Type": "host"})
+	eth0, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth0", "Type": "device", "TID": "tid0"})
+	eth1, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth1", "Type": "device", "TID": "tid1"})
+	topology.AddOwnershipLink(g, host, eth0, nil)
+	topology.AddOwnershipLink(g, host, eth1, nil)
+
+	tc := &fakeFlowTableClient{
+		flows: []*flow.Flow{
+			{UUID: "flow1", NodeTID: "tid0"},
+			{UUID: "flow2", NodeTID: "tid0"},
+			{UUID: "flow3", NodeTID: "tid1"},
+		},
+	}
+
+	parser := traversal.NewGremlinTraversalParser()
+	parser.AddTraversalExtension(ge.NewFlowTraversalExtension(tc, nil))
+
+	api, err := newGraphQLAPI(g, parser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api, tc
+}
+
+func TestGraphQLNodeFlows(t *testing.T) {
+	api, tc := newTestGraphQLAPI(t)
+
+	response := api.schema.Exec(context.Background(), `{ nodes(gremlin: "G.V().Has('Type', 'host')") { children { name flows { uuid } } } }`, "", nil)
+	if len(response.Errors) != 0 {
+		t.Fatalf("unexpected errors: %v", response.Errors)
+	}
+
+	var data struct {
+		Nodes []struct {
+			Children []struct {
+				Name  string
+				Flows []struct{ UUID string }
+			}
+		}
+	}
+	if err := json.Unmarshal(response.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data.Nodes) != 1 || len(data.Nodes[0].Children) != 2 {
+		t.Fatalf("expected one host with two interfaces, got %s", string(response.Data))
+	}
+
+	expected := map[string]int{"eth0": 2, "eth1": 1}
+	for _, child := range data.Nodes[0].Children {
+		if len(child.Flows) != expected[child.Name] {
+			t.Errorf("expected %d flows for %s, got %v", expected[child.Name], child.Name, child.Flows)
+		}
+	}
+
+	// the flows of the interfaces are looked up at once
+	if tc.lookups != 1 {
+		t.Errorf("expected a single flow lookup, got %d", tc.lookups)
+	}
+}
+
+func TestGraphQLMaxDepth(t *testing.T) {
+	api, _ := newTestGraphQLAPI(t)
+
+	query := "{ nodes { " + strings.Repeat("children { ", graphQLMaxDepth) + "name" + strings.Repeat(" }", graphQLMaxDepth) + " } }"
+	if response := api.schema.Exec(context.Background(), query, "", nil); len(response.Errors) == 0 {
+		t.Error("a query deeper than the limit should be rejected")
+	}
+
+	query = "{ nodes { " + strings.Repeat("children { ", graphQLMaxDepth-2) + "name" + strings.Repeat(" }", graphQLMaxDepth-2) + " } }"
+	if response := api.schema.Exec(context.Background(), query, "", nil); len(response.Errors) != 0 {
+		t.Errorf("unexpected errors: %v", response.Errors)
+	}
+}
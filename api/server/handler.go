@@ -48,6 +48,8 @@ type Handler interface {
 // CreateOptions describes the available options when creating a resource
 type CreateOptions struct {
 	TTL time.Duration
+	// Username of the user creating the resource
+	Username string
 }
 
 // ResourceHandler aims to creates new resource of an API
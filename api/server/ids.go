@@ -0,0 +1,120 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	auth "github.com/abbot/go-http-auth"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// IDSCorrelator is the interface to correlate IDS alerts with the flows and
+// the topology
+type IDSCorrelator interface {
+	CorrelateSuricata(r io.Reader) (interface{}, error)
+}
+
+type idsAPI struct {
+	correlator IDSCorrelator
+}
+
+func (i *idsAPI) suricata(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "ids", "write") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	correlations, err := i.correlator.CorrelateSuricata(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(correlations); err != nil {
+		logging.GetLogger().Warningf("Error while writing response: %s", err)
+	}
+}
+
+func (i *idsAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation POST /ids/suricata suricataAlerts
+	//
+	// Correlate Suricata alerts
+	//
+	// ---
+	// summary: Correlate Suricata alerts
+	//
+	// description: |
+	//   Ingest Suricata EVE JSON events, one per line, and correlate the
+	//   alerts with the flows by 5-tuple and time, and with the nodes having
+	//   captured these flows or owning the IP addresses. The IDS metadata of
+	//   the nodes is updated with a summary of their alerts.
+	//
+	// tags:
+	// - IDS
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - in: body
+	//     name: events
+	//     required: true
+	//     schema:
+	//       type: string
+	//
+	// responses:
+	//   200:
+	//     description: Alerts with the UUIDs of their flows and the IDs of their nodes
+	//
+	//   400:
+	//     description: Invalid events
+
+	routes := []shttp.Route{
+		{
+			Name:        "IDSSuricata",
+			Method:      "POST",
+			Path:        "/api/ids/suricata",
+			HandlerFunc: i.suricata,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterIDSAPI registers the IDS alerts ingestion endpoints
+func RegisterIDSAPI(r *shttp.Server, correlator IDSCorrelator, authBackend shttp.AuthenticationBackend) {
+	i := &idsAPI{
+		correlator: correlator,
+	}
+
+	i.registerEndpoints(r, authBackend)
+}
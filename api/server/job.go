@@ -0,0 +1,502 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/gorilla/mux"
+	uuid "github.com/nu7hatch/gouuid"
+	cache "github.com/pmylund/go-cache"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/audit"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+	"github.com/skydive-project/skydive/validator"
+)
+
+type jobEntry struct {
+	job        types.Job
+	result     []byte
+	rawPackets bool
+}
+
+// JobAPI runs the topology and flow queries asynchronously. The jobs are kept
+// in memory by the analyzer they were submitted to, along with their result,
+// until they expire.
+type JobAPI struct {
+	common.RWMutex
+	graph     *graph.Graph
+	parser    *traversal.GremlinTraversalParser
+	jobs      *cache.Cache
+	slots     chan struct{}
+	resultTTL time.Duration
+}
+
+// execute runs the query of a job, returning its encoded result and whether
+// the result is raw packets
+func (j *JobAPI) execute(params *types.TopologyParams, user string) ([]byte, int, bool, error) {
+	ts, err := j.parser.ParseWithBindings(params.GremlinQuery, params.Bindings)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	g, err := userGraph(j.graph, j.parser, user)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	res, err := ts.ExecContext(queryContext(context.Background(), user), g, true)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	_, rawPackets := res.(*ge.RawPacketsTraversalStep)
+
+	if params.Pagination.IsSet() {
+		data, total, err := encodePage(res, &params.Pagination)
+		return data, total, rawPackets, err
+	}
+
+	data, err := json.Marshal(res)
+	return data, 0, rawPackets, err
+}
+
+func (j *JobAPI) run(id string, entry *jobEntry) {
+	// wait for a free slot
+	j.slots <- struct{}{}
+	defer func() { <-j.slots }()
+
+	// the job may have been deleted while waiting
+	if _, found := j.jobs.Get(id); !found {
+		return
+	}
+
+	j.Lock()
+	startedAt := time.Now().UTC()
+	entry.job.State = types.JobRunning
+	entry.job.StartedAt = &startedAt
+	params, user := entry.job.Query, entry.job.User
+	j.Unlock()
+
+	result, total, rawPackets, err := j.execute(&params, user)
+
+	j.Lock()
+	completedAt := time.Now().UTC()
+	expiresAt := completedAt.Add(j.resultTTL)
+	entry.job.CompletedAt, entry.job.ExpiresAt = &completedAt, &expiresAt
+	if err != nil {
+		entry.job.State = types.JobFailed
+		entry.job.Error = err.Error()
+	} else {
+		entry.job.State = types.JobCompleted
+		entry.job.ResultSize = len(result)
+		entry.job.Total = total
+		entry.result = result
+		entry.rawPackets = rawPackets
+	}
+	state := entry.job.State
+	j.Unlock()
+
+	logging.GetLogger().Debugf("Job %s %s in %s", id, state, completedAt.Sub(startedAt))
+
+	// the job expires once its result is available, unless already deleted
+	if _, found := j.jobs.Get(id); found {
+		j.jobs.Set(id, entry, j.resultTTL)
+	}
+}
+
+// getEntry returns a job of the user
+func (j *JobAPI) getEntry(w http.ResponseWriter, r *auth.AuthenticatedRequest) (*jobEntry, bool) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	id := mux.Vars(&r.Request)["ID"]
+	if item, found := j.jobs.Get(id); found {
+		if entry := item.(*jobEntry); entry.job.User == r.Username {
+			return entry, true
+		}
+	}
+
+	writeError(w, http.StatusNotFound, fmt.Errorf("Job %s not found", id))
+	return nil, false
+}
+
+func (j *JobAPI) submit(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var params types.TopologyParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := validator.Validate(params); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if params.GremlinQuery == "" {
+		writeError(w, http.StatusBadRequest, errors.New("Empty query"))
+		return
+	}
+
+	// report the invalid queries right away
+	if _, err := j.parser.ParseWithBindings(params.GremlinQuery, params.Bindings); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, _ := uuid.NewV4()
+	id := u.String()
+	entry := &jobEntry{
+		job: types.Job{
+			ID:        id,
+			Query:     params,
+			State:     types.JobPending,
+			User:      r.Username,
+			CreatedAt: time.Now().UTC(),
+		},
+	}
+	j.jobs.Set(id, entry, cache.NoExpiration)
+
+	go j.run(id, entry)
+
+	j.RLock()
+	job := entry.job
+	j.RUnlock()
+
+	w.Header().Set("Location", "/api/job/"+id)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		logging.GetLogger().Errorf("Error while writing response: %s", err)
+	}
+}
+
+func (j *JobAPI) index(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobs := []types.Job{}
+
+	j.RLock()
+	for _, item := range j.jobs.Items() {
+		if entry := item.Object.(*jobEntry); entry.job.User == r.Username {
+			jobs = append(jobs, entry.job)
+		}
+	}
+	j.RUnlock()
+
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].CreatedAt.Before(jobs[k].CreatedAt)
+	})
+
+	writeJSON(w, jobs)
+}
+
+func (j *JobAPI) get(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	entry, ok := j.getEntry(w, r)
+	if !ok {
+		return
+	}
+
+	j.RLock()
+	job := entry.job
+	j.RUnlock()
+
+	writeJSON(w, job)
+}
+
+func (j *JobAPI) getResult(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	entry, ok := j.getEntry(w, r)
+	if !ok {
+		return
+	}
+
+	j.RLock()
+	job, result, rawPackets := entry.job, entry.result, entry.rawPackets
+	j.RUnlock()
+
+	switch job.State {
+	case types.JobCompleted:
+	case types.JobFailed:
+		writeError(w, http.StatusUnprocessableEntity, fmt.Errorf("Job failed: %s", job.Error))
+		return
+	default:
+		writeError(w, http.StatusConflict, fmt.Errorf("Job %s", job.State))
+		return
+	}
+
+	// the packets are accessed when the result is read
+	if rawPackets {
+		audit.MarkRawPacketAccess(&r.Request)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if job.Total != 0 {
+		w.Header().Set("X-Total-Count", fmt.Sprintf("%d", job.Total))
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(result); err != nil {
+		logging.GetLogger().Errorf("Error while writing response: %s", err)
+	}
+}
+
+func (j *JobAPI) delete(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	entry, ok := j.getEntry(w, r)
+	if !ok {
+		return
+	}
+
+	// a running query can't be interrupted, its result is dropped
+	j.jobs.Delete(entry.job.ID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (j *JobAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation POST /job submitJob
+	//
+	// Submit a topology or flow query to be run asynchronously
+	//
+	// ---
+	// summary: Submit a query job
+	//
+	// tags:
+	// - Jobs
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - in: body
+	//     name: params
+	//     required: true
+	//     schema:
+	//       $ref: '#/definitions/TopologyParams'
+	//
+	// responses:
+	//   202:
+	//     description: job submitted
+	//     schema:
+	//       $ref: '#/definitions/Job'
+	//
+	//   400:
+	//     description: invalid query
+
+	// swagger:operation GET /job listJobs
+	//
+	// List the jobs of the user
+	//
+	// ---
+	// summary: List jobs
+	//
+	// tags:
+	// - Jobs
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// responses:
+	//   200:
+	//     description: jobs
+	//     schema:
+	//       type: array
+	//       items:
+	//         $ref: '#/definitions/Job'
+
+	// swagger:operation GET /job/{id} getJob
+	//
+	// Get the state of a job
+	//
+	// ---
+	// summary: Get job
+	//
+	// tags:
+	// - Jobs
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     required: true
+	//     type: string
+	//
+	// responses:
+	//   200:
+	//     description: job
+	//     schema:
+	//       $ref: '#/definitions/Job'
+	//
+	//   404:
+	//     description: job not found or expired
+
+	// swagger:operation GET /job/{id}/result getJobResult
+	//
+	// Download the result of a completed job
+	//
+	// ---
+	// summary: Get job result
+	//
+	// tags:
+	// - Jobs
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     required: true
+	//     type: string
+	//
+	// responses:
+	//   200:
+	//     description: query result
+	//     schema:
+	//       $ref: '#/definitions/AnyValue'
+	//
+	//   404:
+	//     description: job not found or expired
+	//
+	//   409:
+	//     description: job not completed yet
+	//
+	//   422:
+	//     description: job failed
+
+	// swagger:operation DELETE /job/{id} deleteJob
+	//
+	// Delete a job and its result
+	//
+	// ---
+	// summary: Delete job
+	//
+	// tags:
+	// - Jobs
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     required: true
+	//     type: string
+	//
+	// responses:
+	//   200:
+	//     description: job deleted
+	//
+	//   404:
+	//     description: job not found or expired
+
+	routes := []shttp.Route{
+		{
+			Name:        "JobSubmit",
+			Method:      "POST",
+			Path:        "/api/job",
+			HandlerFunc: j.submit,
+		},
+		{
+			Name:        "JobIndex",
+			Method:      "GET",
+			Path:        "/api/job",
+			HandlerFunc: j.index,
+		},
+		{
+			Name:        "JobShow",
+			Method:      "GET",
+			Path:        "/api/job/{ID}",
+			HandlerFunc: j.get,
+		},
+		{
+			Name:        "JobResult",
+			Method:      "GET",
+			Path:        "/api/job/{ID}/result",
+			HandlerFunc: j.getResult,
+		},
+		{
+			Name:        "JobDelete",
+			Method:      "DELETE",
+			Path:        "/api/job/{ID}",
+			HandlerFunc: j.delete,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterJobAPI registers the asynchronous query API
+func RegisterJobAPI(r *shttp.Server, g *graph.Graph, parser *traversal.GremlinTraversalParser, authBackend shttp.AuthenticationBackend) {
+	maxRunning := config.GetInt("analyzer.job.max_running")
+	if maxRunning <= 0 {
+		maxRunning = 1
+	}
+	resultTTL := time.Duration(config.GetInt("analyzer.job.result_ttl")) * time.Second
+
+	j := &JobAPI{
+		graph:     g,
+		parser:    parser,
+		jobs:      cache.New(resultTTL, time.Minute),
+		slots:     make(chan struct{}, maxRunning),
+		resultTTL: resultTTL,
+	}
+
+	j.registerEndpoints(r, authBackend)
+}
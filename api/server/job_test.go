@@ -0,0 +1,211 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/gorilla/mux"
+	cache "github.com/pmylund/go-cache"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/graffiti/common/scopetest"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+)
+
+func newTestJobAPI(t *testing.T, maxRunning int) *JobAPI {
+	g, _, _ := scopetest.NewTenantGraph(t)
+	return &JobAPI{
+		graph:     g,
+		parser:    traversal.NewGremlinTraversalParser(),
+		jobs:      cache.New(time.Minute, time.Minute),
+		slots:     make(chan struct{}, maxRunning),
+		resultTTL: time.Minute,
+	}
+}
+
+func jobRequest(user, method, path, id, body string) *auth.AuthenticatedRequest {
+	r := authenticatedRequest(user, method, path, body)
+	if id != "" {
+		r.Request = *mux.SetURLVars(&r.Request, map[string]string{"ID": id})
+	}
+	return r
+}
+
+func submitJob(t *testing.T, j *JobAPI, user, query string) *types.Job {
+	w := httptest.NewRecorder()
+	j.submit(w, jobRequest(user, "POST", "/api/job", "", `{"GremlinQuery":"`+query+`"}`))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	var job types.Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	if w.Header().Get("Location") != "/api/job/"+job.ID {
+		t.Errorf("Unexpected location %s", w.Header().Get("Location"))
+	}
+	return &job
+}
+
+func getJob(t *testing.T, j *JobAPI, user, id string) (*types.Job, int) {
+	w := httptest.NewRecorder()
+	j.get(w, jobRequest(user, "GET", "/api/job/"+id, id, ""))
+	if w.Code != http.StatusOK {
+		return nil, w.Code
+	}
+
+	var job types.Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	return &job, w.Code
+}
+
+func waitJob(t *testing.T, j *JobAPI, user, id string) *types.Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, _ := getJob(t, j, user, id)
+		if job != nil && (job.State == types.JobCompleted || job.State == types.JobFailed) {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Job %s not done: %+v", id, job)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJobResult(t *testing.T) {
+	scopetest.InitRBAC(t, scopetest.TenantPolicy)
+	j := newTestJobAPI(t, 2)
+
+	bobJob := submitJob(t, j, "bob", "G.V()")
+	aliceJob := submitJob(t, j, "alice", "G.V()")
+	if bobJob.State != types.JobPending || bobJob.User != "bob" {
+		t.Errorf("Expected a pending job of bob, got %+v", bobJob)
+	}
+
+	for user, id := range map[string]string{"bob": bobJob.ID, "alice": aliceJob.ID} {
+		job := waitJob(t, j, user, id)
+		if job.State != types.JobCompleted || job.StartedAt == nil || job.CompletedAt == nil || job.ExpiresAt == nil {
+			t.Errorf("Expected a completed job, got %+v", job)
+		}
+	}
+
+	result := func(user, id string) []interface{} {
+		w := httptest.NewRecorder()
+		j.getResult(w, jobRequest(user, "GET", "/api/job/"+id+"/result", id, ""))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Unexpected status %d: %s", w.Code, w.Body.String())
+		}
+
+		var nodes []interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &nodes); err != nil {
+			t.Fatal(err)
+		}
+		return nodes
+	}
+
+	if nodes := result("bob", bobJob.ID); len(nodes) != 2 {
+		t.Errorf("bob should get the whole topology, got %d nodes", len(nodes))
+	}
+	if nodes := result("alice", aliceJob.ID); len(nodes) != 1 {
+		t.Errorf("alice should only get the nodes of her scope, got %d nodes", len(nodes))
+	}
+
+	// the jobs are private to their user
+	if _, code := getJob(t, j, "alice", bobJob.ID); code != http.StatusNotFound {
+		t.Errorf("alice should not see the job of bob, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	j.index(w, jobRequest("bob", "GET", "/api/job", "", ""))
+	var jobs []types.Job
+	if err := json.Unmarshal(w.Body.Bytes(), &jobs); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != bobJob.ID {
+		t.Errorf("bob should only list his job, got %+v", jobs)
+	}
+}
+
+func TestJobErrors(t *testing.T) {
+	scopetest.InitRBAC(t, scopetest.TenantPolicy)
+	j := newTestJobAPI(t, 1)
+
+	w := httptest.NewRecorder()
+	j.submit(w, jobRequest("bob", "POST", "/api/job", "", `{"GremlinQuery":"G.V().Foo("}`))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("An invalid query should be rejected, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	j.submit(w, jobRequest("eve", "POST", "/api/job", "", `{"GremlinQuery":"G.V()"}`))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("A user without role should be denied, got %d", w.Code)
+	}
+
+	// the memory backend has no history
+	job := waitJob(t, j, "bob", submitJob(t, j, "bob", "G.At('-1m').V()").ID)
+	if job.State != types.JobFailed || job.Error == "" {
+		t.Errorf("Expected a failed job, got %+v", job)
+	}
+
+	w = httptest.NewRecorder()
+	j.getResult(w, jobRequest("bob", "GET", "/api/job/"+job.ID+"/result", job.ID, ""))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("The result of a failed job should not be available, got %d", w.Code)
+	}
+}
+
+func TestJobPending(t *testing.T) {
+	scopetest.InitRBAC(t, scopetest.TenantPolicy)
+	j := newTestJobAPI(t, 1)
+
+	// all the slots are taken
+	j.slots <- struct{}{}
+
+	job := submitJob(t, j, "bob", "G.V()")
+
+	w := httptest.NewRecorder()
+	j.getResult(w, jobRequest("bob", "GET", "/api/job/"+job.ID+"/result", job.ID, ""))
+	if w.Code != http.StatusConflict {
+		t.Errorf("The result of a pending job should not be available, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	j.delete(w, jobRequest("bob", "DELETE", "/api/job/"+job.ID, job.ID, ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status %d", w.Code)
+	}
+
+	// the deleted job is dropped once a slot is free
+	<-j.slots
+	time.Sleep(50 * time.Millisecond)
+
+	if _, code := getJob(t, j, "bob", job.ID); code != http.StatusNotFound {
+		t.Errorf("The job should be deleted, got %d", code)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	auth "github.com/abbot/go-http-auth"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// LatencyReporter is the interface to report the latency between groups of nodes
+type LatencyReporter interface {
+	GetLatencyMatrix(groupBy string) (interface{}, error)
+}
+
+type latencyAPI struct {
+	reporter LatencyReporter
+}
+
+func (l *latencyAPI) latencyGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	// the latencies are computed between the nodes of the whole topology
+	if !rbac.Enforce(r.Username, "latency", "read") || isScoped(r.Username) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	groupBy := r.URL.Query().Get("groupby")
+	if groupBy == "" {
+		groupBy = "host"
+	}
+
+	matrix, err := l.reporter.GetLatencyMatrix(groupBy)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(matrix); err != nil {
+		logging.GetLogger().Warningf("Error while writing response: %s", err)
+	}
+}
+
+func (l *latencyAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation GET /latency getLatency
+	//
+	// Get the latency matrix
+	//
+	// ---
+	// summary: Get the latency matrix
+	//
+	// tags:
+	// - Latency
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	// - name: groupby
+	//   in: query
+	//   description: group of nodes, either host, namespace or az
+	//   required: false
+	//   type: string
+	//
+	// responses:
+	//   200:
+	//     description: Latency matrix
+	//     schema:
+	//       $ref: '#/definitions/LatencyMatrix'
+	//
+	//   400:
+	//     description: unknown group
+
+	routes := []shttp.Route{
+		{
+			Name:        "LatencyGet",
+			Method:      "GET",
+			Path:        "/api/latency",
+			HandlerFunc: l.latencyGet,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterLatencyAPI registers the latency API endpoint
+func RegisterLatencyAPI(s *shttp.Server, r LatencyReporter, authBackend shttp.AuthenticationBackend) {
+	l := &latencyAPI{
+		reporter: r,
+	}
+
+	l.registerEndpoints(s, authBackend)
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	auth "github.com/abbot/go-http-auth"
+
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+func loggingGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "logging", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, logging.GetLevels())
+}
+
+func loggingPut(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "logging", "write") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var levels logging.Levels
+	if err := json.NewDecoder(r.Body).Decode(&levels); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := logging.SetLevels(&levels); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logging.GetLogger().Infof("Logging levels changed by %s", r.Username)
+
+	writeJSON(w, logging.GetLevels())
+}
+
+// RegisterLoggingAPI registers the endpoints changing the logging levels
+// at runtime
+func RegisterLoggingAPI(s *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation GET /logging getLogging
+	//
+	// Get the logging levels
+	//
+	// ---
+	// summary: Get the logging levels
+	//
+	// tags:
+	// - Status
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// responses:
+	//   200:
+	//     description: Logging levels
+	//     schema:
+	//       $ref: '#/definitions/Levels'
+
+	// swagger:operation PUT /logging setLogging
+	//
+	// Set the logging levels
+	//
+	// ---
+	// summary: Set the logging levels
+	//
+	// description: |
+	//   Set the level of all the backends, when specified, and override it
+	//   for some modules, ex: {"Modules": {"flow/server": "DEBUG"}}. An empty
+	//   module level removes the override.
+	//
+	// tags:
+	// - Status
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - in: body
+	//     name: levels
+	//     required: true
+	//     schema:
+	//       $ref: '#/definitions/Levels'
+	//
+	// responses:
+	//   200:
+	//     description: Resulting logging levels
+	//     schema:
+	//       $ref: '#/definitions/Levels'
+	//
+	//   400:
+	//     description: Invalid level
+
+	routes := []shttp.Route{
+		{
+			Name:        "LoggingGet",
+			Method:      "GET",
+			Path:        "/api/logging",
+			HandlerFunc: loggingGet,
+		},
+		{
+			Name:        "LoggingPut",
+			Method:      "PUT",
+			Path:        "/api/logging",
+			HandlerFunc: loggingPut,
+		},
+	}
+
+	s.RegisterRoutes(routes, authBackend)
+}
@@ -0,0 +1,104 @@
+//go:generate sh -c "go run github.com/gomatic/renderizer --name='metadata field' --resource=metadatafield --type=MetadataField --title='Metadata field' --article=a swagger_operations.tmpl > metadatafield_swagger.go"
+//go:generate sh -c "go run github.com/gomatic/renderizer --name='metadata field' --resource=metadatafield --type=MetadataField --title='Metadata field' swagger_definitions.tmpl > metadatafield_swagger.json"
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"sync"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// MetadataFieldResourceHandler describes a metadata field resource handler
+type MetadataFieldResourceHandler struct {
+	ResourceHandler
+}
+
+// MetadataFieldAPI based on BasicAPIHandler
+type MetadataFieldAPI struct {
+	sync.RWMutex
+	BasicAPIHandler
+	validator *topology.SchemaValidator
+	indexer   graph.MetadataFieldIndexer
+	fields    map[string]topology.MetadataField
+}
+
+// Name returns resource name "metadatafield"
+func (mfh *MetadataFieldResourceHandler) Name() string {
+	return "metadatafield"
+}
+
+// New creates a new metadata field
+func (mfh *MetadataFieldResourceHandler) New() types.Resource {
+	return &types.MetadataField{}
+}
+
+func (mfa *MetadataFieldAPI) onAPIWatcherEvent(action string, id string, resource types.Resource) {
+	mfa.Lock()
+	switch action {
+	case "init", "create", "set", "update":
+		field := resource.(*types.MetadataField).MetadataField
+		mfa.fields[id] = field
+
+		if mfa.indexer != nil {
+			if err := mfa.indexer.IndexMetadataField(field.Name, field.Type, field.Index); err != nil {
+				logging.GetLogger().Errorf("Failed to index metadata field %s: %s", field.Name, err)
+			}
+		}
+	case "expire", "delete":
+		delete(mfa.fields, id)
+	}
+
+	fields := make([]topology.MetadataField, 0, len(mfa.fields))
+	for _, field := range mfa.fields {
+		fields = append(fields, field)
+	}
+	mfa.Unlock()
+
+	mfa.validator.SetMetadataFields(fields)
+}
+
+// RegisterMetadataFieldAPI registers a metadata field API. The declared fields
+// are enforced by the validator and indexed by the backend when it supports it.
+func RegisterMetadataFieldAPI(apiServer *Server, validator *topology.SchemaValidator, backend graph.Backend, authBackend shttp.AuthenticationBackend) (*MetadataFieldAPI, error) {
+	mfa := &MetadataFieldAPI{
+		BasicAPIHandler: BasicAPIHandler{
+			ResourceHandler: &MetadataFieldResourceHandler{},
+			EtcdKeyAPI:      apiServer.EtcdKeyAPI,
+		},
+		validator: validator,
+		fields:    make(map[string]topology.MetadataField),
+	}
+	if indexer, ok := backend.(graph.MetadataFieldIndexer); ok {
+		mfa.indexer = indexer
+	}
+
+	if err := apiServer.RegisterAPIHandler(mfa, authBackend); err != nil {
+		return nil, err
+	}
+
+	mfa.AsyncWatch(mfa.onAPIWatcherEvent)
+
+	return mfa, nil
+}
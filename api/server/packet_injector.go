@@ -24,11 +24,13 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 
 	"github.com/skydive-project/skydive/topology"
 
 	"github.com/skydive-project/skydive/api/types"
 	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
 	ge "github.com/skydive-project/skydive/gremlin/traversal"
 	shttp "github.com/skydive-project/skydive/http"
 )
@@ -122,6 +124,28 @@ func (pi *PacketInjectorAPI) validateRequest(ppr *types.PacketInjection) error {
 	return nil
 }
 
+// DryRun checks the source and the destination of the injection
+func (pi *PacketInjectorAPI) DryRun(r types.Resource, report *types.ValidationReport) {
+	ppr := r.(*types.PacketInjection)
+
+	for _, node := range []struct{ field, query string }{{"Src", ppr.Src}, {"Dst", ppr.Dst}} {
+		if node.query == "" {
+			continue
+		}
+
+		ts, err := traversal.NewGremlinTraversalParser().Parse(strings.NewReader(node.query))
+		if err != nil {
+			report.AddError(node.field, "Not a valid Gremlin expression: %s", err)
+			continue
+		}
+		checkFieldReferences(pi.Graph, ts, node.field, report)
+	}
+
+	if err := pi.validateRequest(ppr); err != nil {
+		report.AddError("", "%s", err)
+	}
+}
+
 func (pi *PacketInjectorAPI) getNode(gremlinQuery string) *graph.Node {
 	res, err := ge.TopologyGremlinQuery(pi.Graph, gremlinQuery)
 	if err != nil {
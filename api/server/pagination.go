@@ -0,0 +1,160 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+)
+
+// sortValues sorts the nodes, edges or flows of a query result the same way
+// the Sort step does, the type of the field being the one of the first item
+func sortValues(values []interface{}, sortBy string, sortOrder common.SortOrder) error {
+	getters := make([]common.Getter, len(values))
+	for i, value := range values {
+		getter, ok := value.(common.Getter)
+		if !ok {
+			return fmt.Errorf("Items of type %T can't be sorted", value)
+		}
+		getters[i] = getter
+	}
+
+	if len(getters) == 0 {
+		return nil
+	}
+
+	var less func(i, j int) bool
+	if _, err := getters[0].GetFieldInt64(sortBy); err == nil {
+		less = func(i, j int) bool {
+			i1, _ := getters[i].GetFieldInt64(sortBy)
+			i2, _ := getters[j].GetFieldInt64(sortBy)
+			return i1 < i2
+		}
+	} else {
+		less = func(i, j int) bool {
+			s1, _ := getters[i].GetFieldString(sortBy)
+			s2, _ := getters[j].GetFieldString(sortBy)
+			return s1 < s2
+		}
+	}
+
+	indexes := make([]int, len(values))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		if sortOrder == common.SortDescending {
+			return less(indexes[j], indexes[i])
+		}
+		return less(indexes[i], indexes[j])
+	})
+
+	sorted := make([]interface{}, len(values))
+	for i, index := range indexes {
+		sorted[i] = values[index]
+	}
+	copy(values, sorted)
+
+	return nil
+}
+
+// projectValue returns the given fields of the JSON representation of a value
+func projectValue(value interface{}, fields []string) (map[string]interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var item map[string]interface{}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, fmt.Errorf("Items of type %T have no fields", value)
+	}
+
+	projected := make(map[string]interface{})
+	for _, field := range fields {
+		if v, err := common.GetMapField(item, field); err == nil {
+			common.SetMapField(projected, field, v)
+		}
+	}
+	return projected, nil
+}
+
+// paginate sorts the values of a query result, returns the requested page
+// and keeps only the requested fields of its items
+func paginate(values []interface{}, p *types.Pagination) ([]interface{}, error) {
+	values = append([]interface{}(nil), values...)
+
+	if p.SortBy != "" {
+		if err := sortValues(values, p.SortBy, common.SortOrder(p.SortOrder)); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.Offset >= len(values) {
+		values = values[:0]
+	} else {
+		values = values[p.Offset:]
+	}
+	if p.Limit > 0 && p.Limit < len(values) {
+		values = values[:p.Limit]
+	}
+
+	if len(p.Fields) > 0 {
+		for i, value := range values {
+			projected, err := projectValue(value, p.Fields)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = projected
+		}
+	}
+
+	return values, nil
+}
+
+// encodePage returns the JSON encoding of the requested page of a query
+// result along with the total number of items of the result
+func encodePage(res traversal.GraphTraversalStep, p *types.Pagination) ([]byte, int, error) {
+	values := res.Values()
+
+	// nodes and edges are read while sorting and encoding them
+	var gt *traversal.GraphTraversal
+	switch res := res.(type) {
+	case *traversal.GraphTraversalV:
+		gt = res.GraphTraversal
+	case *traversal.GraphTraversalE:
+		gt = res.GraphTraversal
+	}
+	if gt != nil {
+		gt.RLock()
+		defer gt.RUnlock()
+	}
+
+	page, err := paginate(values, p)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	data, err := json.Marshal(page)
+	return data, len(values), err
+}
@@ -0,0 +1,89 @@
+//go:generate sh -c "go run github.com/gomatic/renderizer --name='path check' --resource=pathcheck --type=PathCheck --title='Path check' --article=a swagger_operations.tmpl > pathcheck_swagger.go"
+//go:generate sh -c "go run github.com/gomatic/renderizer --name='path check' --resource=pathcheck --type=PathCheck --title='Path check' swagger_definitions.tmpl > pathcheck_swagger.json"
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/skydive-project/skydive/api/types"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// PathCheckReportPath is the etcd directory where the path check reports are stored
+const PathCheckReportPath = "/pathcheckreport"
+
+// PathCheckResourceHandler describes a path check resource handler
+type PathCheckResourceHandler struct {
+	ResourceHandler
+}
+
+// PathCheckAPIHandler based on BasicAPIHandler
+type PathCheckAPIHandler struct {
+	BasicAPIHandler
+}
+
+// Name returns resource name "pathcheck"
+func (p *PathCheckResourceHandler) Name() string {
+	return "pathcheck"
+}
+
+// New creates a new path check
+func (p *PathCheckResourceHandler) New() types.Resource {
+	return &types.PathCheck{
+		Type:     types.PITypeICMP4,
+		Interval: 30,
+	}
+}
+
+// Decorate populates the path check with its last report
+func (p *PathCheckAPIHandler) Decorate(resource types.Resource) {
+	check := resource.(*types.PathCheck)
+
+	resp, err := p.EtcdKeyAPI.Get(context.Background(), fmt.Sprintf("%s/%s", PathCheckReportPath, check.UUID), nil)
+	if err != nil {
+		return
+	}
+
+	var report types.PathCheckReport
+	if err := json.Unmarshal([]byte(resp.Node.Value), &report); err != nil {
+		logging.GetLogger().Warningf("Failed to unmarshal report of path check %s: %s", check.UUID, err)
+		return
+	}
+
+	check.Report = &report
+}
+
+// RegisterPathCheckAPI registers a path check API to a designated API Server
+func RegisterPathCheckAPI(apiServer *Server, authBackend shttp.AuthenticationBackend) (*PathCheckAPIHandler, error) {
+	pathCheckAPIHandler := &PathCheckAPIHandler{
+		BasicAPIHandler: BasicAPIHandler{
+			ResourceHandler: &PathCheckResourceHandler{},
+			EtcdKeyAPI:      apiServer.EtcdKeyAPI,
+		},
+	}
+	if err := apiServer.RegisterAPIHandler(pathCheckAPIHandler, authBackend); err != nil {
+		return nil, err
+	}
+	return pathCheckAPIHandler, nil
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	auth "github.com/abbot/go-http-auth"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// PolicyVerificationReporter is the interface to report the verification of the network policies
+type PolicyVerificationReporter interface {
+	GetVerification() (interface{}, error)
+}
+
+type policyVerificationAPI struct {
+	reporter PolicyVerificationReporter
+}
+
+func (p *policyVerificationAPI) verificationGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	// the policies are verified against the flows of the whole topology
+	if !rbac.Enforce(r.Username, "policyverification", "read") || isScoped(r.Username) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	verification, err := p.reporter.GetVerification()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(verification); err != nil {
+		logging.GetLogger().Warningf("Error while writing response: %s", err)
+	}
+}
+
+func (p *policyVerificationAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation GET /networkpolicy/verification getPolicyVerification
+	//
+	// Get the verification of the flows against the Kubernetes network policies
+	//
+	// ---
+	// summary: Get the network policy verification
+	//
+	// tags:
+	// - Network Policies
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// responses:
+	//   200:
+	//     description: Network policy verification
+	//     schema:
+	//       $ref: '#/definitions/NetworkPolicyVerification'
+	//
+	//   503:
+	//     description: network policies not monitored
+
+	routes := []shttp.Route{
+		{
+			Name:        "PolicyVerificationGet",
+			Method:      "GET",
+			Path:        "/api/networkpolicy/verification",
+			HandlerFunc: p.verificationGet,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterPolicyVerificationAPI registers the network policy verification API endpoint
+func RegisterPolicyVerificationAPI(s *shttp.Server, r PolicyVerificationReporter, authBackend shttp.AuthenticationBackend) {
+	p := &policyVerificationAPI{
+		reporter: r,
+	}
+
+	p.registerEndpoints(s, authBackend)
+}
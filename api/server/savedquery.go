@@ -0,0 +1,212 @@
+//go:generate sh -c "go run github.com/gomatic/renderizer --name='saved query' --resource=savedquery --type=SavedQuery --title='Saved query' --article=a swagger_operations.tmpl > savedquery_swagger.go"
+//go:generate sh -c "go run github.com/gomatic/renderizer --name='saved query' --resource=savedquery --type=SavedQuery --title='Saved query' swagger_definitions.tmpl > savedquery_swagger.json"
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/gorilla/mux"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// SavedQueryResourceHandler describes a saved query resource handler
+type SavedQueryResourceHandler struct {
+	ResourceHandler
+}
+
+// SavedQueryAPI based on BasicAPIHandler
+type SavedQueryAPI struct {
+	BasicAPIHandler
+	graph  *graph.Graph
+	parser *traversal.GremlinTraversalParser
+}
+
+// Name returns resource name "savedquery"
+func (sqh *SavedQueryResourceHandler) Name() string {
+	return "savedquery"
+}
+
+// New creates a new saved query
+func (sqh *SavedQueryResourceHandler) New() types.Resource {
+	return &types.SavedQuery{}
+}
+
+// lookupSavedQuery returns the saved query having the given ID or name
+func lookupSavedQuery(handler Handler, idOrName string) (*types.SavedQuery, error) {
+	if resource, ok := handler.Get(idOrName); ok {
+		return resource.(*types.SavedQuery), nil
+	}
+
+	for _, resource := range handler.Index() {
+		if query := resource.(*types.SavedQuery); query.Name == idOrName {
+			return query, nil
+		}
+	}
+
+	return nil, fmt.Errorf("No saved query found with ID or name: %s", idOrName)
+}
+
+// executeSavedQuery executes a saved query with the given parameter values
+func executeSavedQuery(ctx context.Context, g *graph.Graph, parser *traversal.GremlinTraversalParser, query *types.SavedQuery, values map[string]interface{}) (traversal.GraphTraversalStep, error) {
+	ts, err := parser.ParseWithBindings(query.Query, query.Bindings(values))
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.ExecContext(ctx, g, true)
+}
+
+func (sqa *SavedQueryAPI) execute(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "savedquery", "read") || !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var call types.SavedQueryCall
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&call); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	query, err := lookupSavedQuery(sqa, mux.Vars(&r.Request)["ID"])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	g, err := userGraph(sqa.graph, sqa.parser, r.Username)
+	if err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+
+	res, err := executeSavedQuery(queryContext(r.Context(), r.Username), g, sqa.parser, query, call.Bindings)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	markRawPacketAccess(r, res)
+
+	// use a buffer to render the result in order to limit the lock time
+	// if the client is slow
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(res); err != nil {
+		writeError(w, http.StatusNotAcceptable, fmt.Errorf("Error while encoding response: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b.Bytes()); err != nil {
+		logging.GetLogger().Errorf("Error while writing response: %s", err)
+	}
+}
+
+func (sqa *SavedQueryAPI) registerEndpoints(s *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation POST /savedquery/{id}/execute executeSavedQuery
+	//
+	// Execute a saved query
+	//
+	// ---
+	// summary: Execute a saved query
+	//
+	// tags:
+	// - Saved queries
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID or name of the saved query
+	//     required: true
+	//     type: string
+	//
+	//   - name: call
+	//     in: body
+	//     required: false
+	//     schema:
+	//       $ref: '#/definitions/SavedQueryCall'
+	//
+	// responses:
+	//   200:
+	//     description: Query result
+	//     schema:
+	//       $ref: '#/definitions/AnyValue'
+	//
+	//   400:
+	//     description: Invalid query or parameters
+	//
+	//   404:
+	//     description: Saved query not found
+
+	routes := []shttp.Route{
+		{
+			Name:        "SavedQueryExecute",
+			Method:      "POST",
+			Path:        "/api/savedquery/{ID}/execute",
+			HandlerFunc: sqa.execute,
+		},
+	}
+
+	s.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterSavedQueryAPI registers a new saved query api handler
+func RegisterSavedQueryAPI(apiServer *Server, g *graph.Graph, parser *traversal.GremlinTraversalParser, authBackend shttp.AuthenticationBackend) (*SavedQueryAPI, error) {
+	sqa := &SavedQueryAPI{
+		BasicAPIHandler: BasicAPIHandler{
+			ResourceHandler: &SavedQueryResourceHandler{},
+			EtcdKeyAPI:      apiServer.EtcdKeyAPI,
+		},
+		graph:  g,
+		parser: parser,
+	}
+	if err := apiServer.RegisterAPIHandler(sqa, authBackend); err != nil {
+		return nil, err
+	}
+
+	sqa.registerEndpoints(apiServer.HTTPServer, authBackend)
+
+	return sqa, nil
+}
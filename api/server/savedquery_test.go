@@ -0,0 +1,173 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	etcd "github.com/coreos/etcd/client"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/graffiti/common/scopetest"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+)
+
+const savedQueryPolicy = scopetest.TenantPolicy + `
+p, tenant, savedquery, read, allow
+p, admin, savedquery, read, allow
+p, viewer, topology, read, allow
+g, carol, viewer`
+
+// savedQueryKeysAPI serves saved queries as if they were stored in etcd
+type savedQueryKeysAPI struct {
+	etcd.KeysAPI
+	queries []*types.SavedQuery
+}
+
+func (k *savedQueryKeysAPI) Get(ctx context.Context, key string, opts *etcd.GetOptions) (*etcd.Response, error) {
+	dir := &etcd.Node{Key: key, Dir: true}
+	for _, query := range k.queries {
+		data, _ := json.Marshal(query)
+		node := &etcd.Node{Key: "/savedquery/" + query.ID(), Value: string(data)}
+		if node.Key == key {
+			return &etcd.Response{Node: node}, nil
+		}
+		dir.Nodes = append(dir.Nodes, node)
+	}
+	if key != "/savedquery/" {
+		return nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound}
+	}
+	return &etcd.Response{Node: dir}, nil
+}
+
+func newTestSavedQueryAPI(t *testing.T, queries ...*types.SavedQuery) *SavedQueryAPI {
+	g, _, _ := scopetest.NewTenantGraph(t)
+	return &SavedQueryAPI{
+		BasicAPIHandler: BasicAPIHandler{
+			ResourceHandler: &SavedQueryResourceHandler{},
+			EtcdKeyAPI:      &savedQueryKeysAPI{queries: queries},
+		},
+		graph:  g,
+		parser: traversal.NewGremlinTraversalParser(),
+	}
+}
+
+func TestSavedQueryBindings(t *testing.T) {
+	query := &types.SavedQuery{
+		Name:  "interfaces",
+		Query: "G.V().Has('Type', $type, 'MTU', $mtu)",
+		Parameters: []types.SavedQueryParameter{
+			{Name: "type", Default: "device"},
+			{Name: "mtu"},
+		},
+	}
+
+	if err := query.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	bindings := query.Bindings(nil)
+	if len(bindings) != 1 || bindings["type"] != "device" {
+		t.Errorf("Only the defaults should be bound, got %v", bindings)
+	}
+
+	bindings = query.Bindings(map[string]interface{}{"type": "veth", "mtu": 1500})
+	if len(bindings) != 2 || bindings["type"] != "veth" || bindings["mtu"] != 1500 {
+		t.Errorf("The given values should override the defaults, got %v", bindings)
+	}
+
+	for _, parameters := range [][]types.SavedQueryParameter{
+		{{Name: "1type"}},
+		{{Name: "type name"}},
+		{{Name: "type"}, {Name: "type"}},
+	} {
+		query.Parameters = parameters
+		if err := query.Validate(); err == nil {
+			t.Errorf("The parameters %v should be rejected", parameters)
+		}
+	}
+}
+
+func TestSavedQueryExecute(t *testing.T) {
+	scopetest.InitRBAC(t, savedQueryPolicy)
+
+	byName := &types.SavedQuery{
+		Name:       "by-name",
+		Query:      "G.V().Has('Name', $name)",
+		Parameters: []types.SavedQueryParameter{{Name: "name", Default: "a1"}},
+	}
+	byName.SetID("id1")
+
+	broken := &types.SavedQuery{Name: "broken", Query: "G.V().Has('Name', $other)"}
+	broken.SetID("id2")
+
+	api := newTestSavedQueryAPI(t, byName, broken)
+
+	execute := func(user, idOrName, body string) (int, []string) {
+		w := httptest.NewRecorder()
+		api.execute(w, jobRequest(user, "POST", "/api/savedquery/"+idOrName+"/execute", idOrName, body))
+		if w.Code != http.StatusOK {
+			return w.Code, nil
+		}
+
+		var nodes []struct{ Metadata map[string]interface{} }
+		if err := json.Unmarshal(w.Body.Bytes(), &nodes); err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, node := range nodes {
+			names = append(names, node.Metadata["Name"].(string))
+		}
+		return w.Code, names
+	}
+
+	if code, names := execute("bob", "by-name", ""); code != http.StatusOK || strings.Join(names, ",") != "a1" {
+		t.Errorf("The default value should be used, got %d %v", code, names)
+	}
+
+	if code, names := execute("bob", "id1", `{"Bindings": {"name": "b1"}}`); code != http.StatusOK || strings.Join(names, ",") != "b1" {
+		t.Errorf("The given value should be used, got %d %v", code, names)
+	}
+
+	// the query runs on the topology the user is allowed to see
+	if code, names := execute("alice", "by-name", `{"Bindings": {"name": "b1"}}`); code != http.StatusOK || len(names) != 0 {
+		t.Errorf("b1 is out of the scope of alice, got %d %v", code, names)
+	}
+
+	if code, _ := execute("carol", "by-name", ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("carol can't read the saved queries, got %d", code)
+	}
+
+	if code, _ := execute("bob", "unknown", ""); code != http.StatusNotFound {
+		t.Errorf("Expected a 404 for an unknown query, got %d", code)
+	}
+
+	if code, _ := execute("bob", "broken", ""); code != http.StatusBadRequest {
+		t.Errorf("Expected a 400 for an unbound parameter, got %d", code)
+	}
+
+	if code, _ := execute("bob", "by-name", `{"Bindings": `); code != http.StatusBadRequest {
+		t.Errorf("Expected a 400 for an invalid call, got %d", code)
+	}
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"context"
+
+	gcommon "github.com/skydive-project/skydive/graffiti/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// userGraph returns the part of the graph a user can access according to
+// the topology scopes of its roles
+func userGraph(g *graph.Graph, parser *traversal.GremlinTraversalParser, user string) (*graph.Graph, error) {
+	scope, err := gcommon.NewTopologyScope(parser, user)
+	if err != nil || scope == nil {
+		return g, err
+	}
+
+	return scope.Graph(g, true)
+}
+
+// isScoped returns whether the access of a user to the topology is restricted
+func isScoped(user string) bool {
+	return len(rbac.GetUserScopes(user, "topology")) > 0
+}
+
+// queryContext returns the context of the queries of a user, the raw packets
+// encrypted at rest being decrypted for the users allowed to
+func queryContext(ctx context.Context, user string) context.Context {
+	if rbac.Enforce(user, "capture", "rawpackets") {
+		return ge.WithRawPacketDecryption(ctx)
+	}
+	return ctx
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	auth "github.com/abbot/go-http-auth"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/graffiti/common/scopetest"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+)
+
+func authenticatedRequest(user, method, path, body string) *auth.AuthenticatedRequest {
+	return &auth.AuthenticatedRequest{
+		Request:  *httptest.NewRequest(method, path, bytes.NewBufferString(body)),
+		Username: user,
+	}
+}
+
+func TestScopedTopologySearch(t *testing.T) {
+	scopetest.InitRBAC(t, scopetest.TenantPolicy)
+
+	g, _, _ := scopetest.NewTenantGraph(t)
+	api := &TopologyAPI{graph: g, gremlinParser: traversal.NewGremlinTraversalParser()}
+
+	search := func(user string) []map[string]interface{} {
+		w := httptest.NewRecorder()
+		api.topologySearch(w, authenticatedRequest(user, "POST", "/api/topology", `{"GremlinQuery":"G.V()"}`))
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d for %s: %s", w.Code, user, w.Body.String())
+		}
+
+		var nodes []map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &nodes); err != nil {
+			t.Fatal(err)
+		}
+		return nodes
+	}
+
+	if nodes := search("bob"); len(nodes) != 2 {
+		t.Errorf("bob should see the whole topology, got %d nodes", len(nodes))
+	}
+
+	nodes := search("alice")
+	if len(nodes) != 1 {
+		t.Fatalf("alice should only see the nodes of her scope, got %d nodes", len(nodes))
+	}
+	if metadata, _ := nodes[0]["Metadata"].(map[string]interface{}); metadata["Tenant"] != "a" {
+		t.Errorf("alice should only see the nodes of tenant a, got %v", nodes[0])
+	}
+
+	w := httptest.NewRecorder()
+	api.topologySearch(w, authenticatedRequest("eve", "POST", "/api/topology", `{"GremlinQuery":"G.V()"}`))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("a user without role should be denied, got %d", w.Code)
+	}
+}
+
+func TestUserGraph(t *testing.T) {
+	scopetest.InitRBAC(t, scopetest.TenantPolicy)
+
+	g, _, _ := scopetest.NewTenantGraph(t)
+	parser := traversal.NewGremlinTraversalParser()
+
+	for user, expected := range map[string]int{"alice": 1, "bob": 2} {
+		scoped, err := userGraph(g, parser, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if nodes := scoped.GetNodes(nil); len(nodes) != expected {
+			t.Errorf("%s should see %d nodes, got %d", user, expected, len(nodes))
+		}
+	}
+}
+
+type fakeAlertBacktester struct{}
+
+func (fakeAlertBacktester) Backtest(params *types.AlertBacktestParams) (*types.AlertBacktestResult, error) {
+	return &types.AlertBacktestResult{}, nil
+}
+
+type fakeLatencyReporter struct{}
+
+func (fakeLatencyReporter) GetLatencyMatrix(groupBy string) (interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+type fakePolicyVerificationReporter struct{}
+
+func (fakePolicyVerificationReporter) GetVerification() (interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+func TestScopedReports(t *testing.T) {
+	scopetest.InitRBAC(t, scopetest.TenantPolicy+`
+p, tenant, alert, read, allow
+p, admin, alert, read, allow
+p, tenant, latency, read, allow
+p, admin, latency, read, allow
+p, tenant, policyverification, read, allow
+p, admin, policyverification, read, allow`)
+
+	backtest := &alertBacktestAPI{backtester: fakeAlertBacktester{}}
+	latency := &latencyAPI{reporter: fakeLatencyReporter{}}
+	verification := &policyVerificationAPI{reporter: fakePolicyVerificationReporter{}}
+
+	handlers := map[string]func(w http.ResponseWriter, user string){
+		"backtest": func(w http.ResponseWriter, user string) {
+			backtest.backtest(w, authenticatedRequest(user, "POST", "/api/alert/backtest", `{}`))
+		},
+		"latency": func(w http.ResponseWriter, user string) {
+			latency.latencyGet(w, authenticatedRequest(user, "GET", "/api/latency", ""))
+		},
+		"verification": func(w http.ResponseWriter, user string) {
+			verification.verificationGet(w, authenticatedRequest(user, "GET", "/api/networkpolicy/verification", ""))
+		},
+	}
+
+	for name, handler := range handlers {
+		for user, expected := range map[string]int{"alice": http.StatusMethodNotAllowed, "bob": http.StatusOK} {
+			w := httptest.NewRecorder()
+			handler(w, user)
+			if w.Code != expected {
+				t.Errorf("%s: expected status %d for %s, got %d", name, expected, user, w.Code)
+			}
+		}
+	}
+}
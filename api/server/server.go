@@ -21,7 +21,7 @@
 //
 //     Schemes: http, https
 //     Host: localhost:8082
-//     BasePath: /api
+//     BasePath: /api/v1
 //     Version: 0.26.0
 //     License: Apache http://opensource.org/licenses/Apache-2.0
 //     Contact: Skydive mailing list <skydive-dev@redhat.com>
@@ -62,6 +62,9 @@ import (
 // ErrDuplicatedResource is returned when a resource is duplicated
 var ErrDuplicatedResource = errors.New("Duplicated resource")
 
+// ErrForbiddenResource is returned when a user is not allowed to create a resource
+var ErrForbiddenResource = errors.New("Forbidden resource")
+
 // Server object are created once for each ServiceType (agent or analyzer)
 type Server struct {
 	HTTPServer *shttp.Server
@@ -76,6 +79,8 @@ type Info struct {
 	Host string
 	// API version
 	Version string
+	// Versions of the REST API, the last one being the current one
+	APIVersions []string
 	// Service type
 	Service string
 }
@@ -175,12 +180,28 @@ func (a *Server) RegisterAPIHandler(handler Handler, authBackend shttp.Authentic
 					return
 				}
 
+				if r.URL.Query().Get("dry_run") == "true" {
+					report := dryRun(handler, resource)
+
+					status := http.StatusOK
+					if !report.Valid {
+						status = http.StatusUnprocessableEntity
+					}
+
+					w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+					w.WriteHeader(status)
+					if err := json.NewEncoder(w).Encode(report); err != nil {
+						logging.GetLogger().Criticalf("Failed to validate %s: %s", name, err)
+					}
+					return
+				}
+
 				if err := validator.Validate(resource); err != nil {
 					writeError(w, http.StatusBadRequest, err)
 					return
 				}
 
-				var createOpts CreateOptions
+				createOpts := CreateOptions{Username: r.Username}
 				if ttlHeader := r.Header.Get("X-Resource-TTL"); ttlHeader != "" {
 					if createOpts.TTL, err = time.ParseDuration(ttlHeader); err != nil {
 						writeError(w, http.StatusBadRequest, fmt.Errorf("invalid ttl: %s", err))
@@ -191,6 +212,9 @@ func (a *Server) RegisterAPIHandler(handler Handler, authBackend shttp.Authentic
 				if err := handler.Create(resource, &createOpts); err == ErrDuplicatedResource {
 					writeError(w, http.StatusConflict, err)
 					return
+				} else if err == ErrForbiddenResource {
+					writeError(w, http.StatusForbidden, err)
+					return
 				} else if err != nil {
 					writeError(w, http.StatusBadRequest, err)
 					return
@@ -285,6 +309,10 @@ func (a *Server) addAPIRootRoute(service common.Service, authBackend shttp.Authe
 		Host:    service.ID,
 	}
 
+	for _, version := range APIVersions {
+		info.APIVersions = append(info.APIVersions, version.Name)
+	}
+
 	routes := []shttp.Route{
 		{
 			Name:   "Skydive API",
@@ -399,6 +427,7 @@ func NewAPI(server *shttp.Server, kapi etcd.KeysAPI, service common.Service, aut
 		handlers:   make(map[string]Handler),
 	}
 
+	apiServer.addAPIVersionRoutes()
 	apiServer.addAPIRootRoute(service, authBackend)
 	apiServer.addLoginRoute(authBackend)
 
@@ -0,0 +1,176 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	auth "github.com/abbot/go-http-auth"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	"github.com/skydive-project/skydive/gremlin/sql"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// SQLAPI exposes a read only SQL interface over the flows
+type SQLAPI struct {
+	graph  *graph.Graph
+	parser *traversal.GremlinTraversalParser
+}
+
+func (s *SQLAPI) query(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var params types.SQLParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	query, err := sql.Parse(params.Query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ts, err := s.parser.ParseWithBindings(query.Gremlin(params.At, params.Duration).String(), query.Bindings)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	g, err := userGraph(s.graph, s.parser, r.Username)
+	if err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+
+	res, err := ts.ExecContext(r.Context(), g, true)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	flows, ok := res.(*ge.FlowTraversalStep)
+	if !ok {
+		writeError(w, http.StatusBadRequest, errors.New("Query didn't return flows"))
+		return
+	}
+
+	result := types.SQLResult{Columns: query.Columns, Rows: [][]interface{}{}}
+	for _, value := range flows.Values() {
+		f := value.(*flow.Flow)
+
+		row := make([]interface{}, len(query.Columns))
+		for i, column := range query.Columns {
+			if field, err := f.GetField(column); err == nil {
+				row[i] = field
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(result); err != nil {
+		writeError(w, http.StatusNotAcceptable, fmt.Errorf("Error while encoding response: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b.Bytes()); err != nil {
+		logging.GetLogger().Errorf("Error while writing response: %s", err)
+	}
+}
+
+func (s *SQLAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation POST /sql sqlQuery
+	//
+	// Query the flows using SQL
+	//
+	// ---
+	// summary: Query the flows using SQL
+	//
+	// description: |
+	//   Read only subset of SQL on the flows table, for instance
+	//   SELECT Network.A, Metric.ABBytes FROM flows WHERE Application = 'TCP'
+	//   ORDER BY Metric.ABBytes DESC LIMIT 10
+	//
+	// tags:
+	// - SQL
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - in: body
+	//     name: params
+	//     required: true
+	//     schema:
+	//       $ref: '#/definitions/SQLParams'
+	//
+	// responses:
+	//   200:
+	//     description: Query result
+	//     schema:
+	//       $ref: '#/definitions/SQLResult'
+	//
+	//   400:
+	//     description: Invalid query
+
+	routes := []shttp.Route{
+		{
+			Name:        "SQLQuery",
+			Method:      "POST",
+			Path:        "/api/sql",
+			HandlerFunc: s.query,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterSQLAPI registers the SQL query endpoint
+func RegisterSQLAPI(r *shttp.Server, g *graph.Graph, parser *traversal.GremlinTraversalParser, authBackend shttp.AuthenticationBackend) {
+	s := &SQLAPI{
+		graph:  g,
+		parser: parser,
+	}
+
+	s.registerEndpoints(r, authBackend)
+}
@@ -0,0 +1,61 @@
+//go:generate sh -c "go run github.com/gomatic/renderizer --name='tagging rule' --resource=taggingrule --type=TaggingRule --title='Tagging rule' --article=a swagger_operations.tmpl > taggingrule_swagger.go"
+//go:generate sh -c "go run github.com/gomatic/renderizer --name='tagging rule' --resource=taggingrule --type=TaggingRule --title='Tagging rule' swagger_definitions.tmpl > taggingrule_swagger.json"
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"github.com/skydive-project/skydive/api/types"
+	shttp "github.com/skydive-project/skydive/http"
+)
+
+// TaggingRuleResourceHandler describes a tagging rule resource handler
+type TaggingRuleResourceHandler struct {
+	ResourceHandler
+}
+
+// TaggingRuleAPI based on BasicAPIHandler
+type TaggingRuleAPI struct {
+	BasicAPIHandler
+}
+
+// Name returns resource name "taggingrule"
+func (trh *TaggingRuleResourceHandler) Name() string {
+	return "taggingrule"
+}
+
+// New creates a new tagging rule
+func (trh *TaggingRuleResourceHandler) New() types.Resource {
+	return &types.TaggingRule{}
+}
+
+// RegisterTaggingRuleAPI registers a new tagging rule api handler
+func RegisterTaggingRuleAPI(apiServer *Server, authBackend shttp.AuthenticationBackend) (*TaggingRuleAPI, error) {
+	tra := &TaggingRuleAPI{
+		BasicAPIHandler: BasicAPIHandler{
+			ResourceHandler: &TaggingRuleResourceHandler{},
+			EtcdKeyAPI:      apiServer.EtcdKeyAPI,
+		},
+	}
+	if err := apiServer.RegisterAPIHandler(tra, authBackend); err != nil {
+		return nil, err
+	}
+
+	return tra, nil
+}
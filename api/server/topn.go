@@ -0,0 +1,240 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/skydive-project/skydive/config"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+const topNKeepAlive = 30 * time.Second
+
+// TopNReporter is the interface to report the top talkers of the flows
+type TopNReporter interface {
+	GetTopN(groupBy, by string, n int) (interface{}, error)
+	SubscribeTopN(groupBy, by string, n int, stream *shttp.SSEStream) (func(), error)
+}
+
+type topNAPI struct {
+	reporter TopNReporter
+}
+
+// topNParams returns the kind of group, the ranking and the number of
+// talkers requested
+func topNParams(r *auth.AuthenticatedRequest) (groupBy, by string, n int, err error) {
+	query := r.URL.Query()
+
+	if groupBy = query.Get("groupby"); groupBy == "" {
+		groupBy = "host"
+	}
+	if by = query.Get("by"); by == "" {
+		by = "bytes"
+	}
+
+	n = 10
+	if value := query.Get("n"); value != "" {
+		if n, err = strconv.Atoi(value); err != nil {
+			return "", "", 0, fmt.Errorf("Invalid n: %s", value)
+		}
+	}
+
+	return
+}
+
+func (t *topNAPI) topNGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	// the talkers are ranked among the flows of the whole topology
+	if !rbac.Enforce(r.Username, "topn", "read") || isScoped(r.Username) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	groupBy, by, n, err := topNParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	top, err := t.reporter.GetTopN(groupBy, by, n)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, top)
+}
+
+func (t *topNAPI) topNStream(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topn", "read") || isScoped(r.Username) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	groupBy, by, n, err := topNParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	stream := shttp.NewSSEStream(config.GetInt("http.ws.queue_size"))
+
+	unsubscribe, err := t.reporter.SubscribeTopN(groupBy, by, n, stream)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer unsubscribe()
+
+	if err := stream.Serve(w, &r.Request, topNKeepAlive); err != nil {
+		logging.GetLogger().Errorf("Top talkers stream of %s closed: %s", r.RemoteAddr, err)
+	}
+}
+
+func (t *topNAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	// swagger:operation GET /topn getTopN
+	//
+	// Get the top talkers
+	//
+	// ---
+	// summary: Get the top talkers
+	//
+	// description: |
+	//   Return the groups of flows having exchanged the most bytes or packets
+	//   over the sliding window of the analyzer.
+	//
+	// tags:
+	// - TopN
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	// - name: groupby
+	//   in: query
+	//   description: group of flows, either host, pair, application or port
+	//   required: false
+	//   type: string
+	//
+	// - name: by
+	//   in: query
+	//   description: ranking, either bytes or packets
+	//   required: false
+	//   type: string
+	//
+	// - name: n
+	//   in: query
+	//   description: number of talkers, 10 by default
+	//   required: false
+	//   type: integer
+	//
+	// responses:
+	//   200:
+	//     description: Top talkers
+	//     schema:
+	//       $ref: '#/definitions/TopN'
+	//
+	//   400:
+	//     description: invalid parameters
+
+	// swagger:operation GET /topn/stream streamTopN
+	//
+	// Stream the top talkers
+	//
+	// ---
+	// summary: Stream the top talkers
+	//
+	// description: |
+	//   Send the top talkers as server-sent events named topn, at every
+	//   update of the ranking.
+	//
+	// tags:
+	// - TopN
+	//
+	// produces:
+	// - text/event-stream
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	// - name: groupby
+	//   in: query
+	//   description: group of flows, either host, pair, application or port
+	//   required: false
+	//   type: string
+	//
+	// - name: by
+	//   in: query
+	//   description: ranking, either bytes or packets
+	//   required: false
+	//   type: string
+	//
+	// - name: n
+	//   in: query
+	//   description: number of talkers, 10 by default
+	//   required: false
+	//   type: integer
+	//
+	// responses:
+	//   200:
+	//     description: Stream of top talkers
+	//
+	//   400:
+	//     description: invalid parameters
+
+	routes := []shttp.Route{
+		{
+			Name:        "TopNGet",
+			Method:      "GET",
+			Path:        "/api/topn",
+			HandlerFunc: t.topNGet,
+		},
+		{
+			Name:        "TopNStream",
+			Method:      "GET",
+			Path:        "/api/topn/stream",
+			HandlerFunc: t.topNStream,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterTopNAPI registers the top talkers API endpoints
+func RegisterTopNAPI(s *shttp.Server, r TopNReporter, authBackend shttp.AuthenticationBackend) {
+	t := &topNAPI{
+		reporter: r,
+	}
+
+	t.registerEndpoints(s, authBackend)
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/skydive-project/skydive/graffiti/common/scopetest"
+	shttp "github.com/skydive-project/skydive/http"
+)
+
+type fakeTopNReporter struct{}
+
+func (fakeTopNReporter) GetTopN(groupBy, by string, n int) (interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+func (fakeTopNReporter) SubscribeTopN(groupBy, by string, n int, stream *shttp.SSEStream) (func(), error) {
+	return func() {}, nil
+}
+
+func TestScopedTopN(t *testing.T) {
+	scopetest.InitRBAC(t, scopetest.TenantPolicy+`
+p, tenant, topn, read, allow
+p, admin, topn, read, allow`)
+
+	api := &topNAPI{reporter: fakeTopNReporter{}}
+
+	for user, expected := range map[string]int{"alice": http.StatusMethodNotAllowed, "bob": http.StatusOK} {
+		w := httptest.NewRecorder()
+		api.topNGet(w, authenticatedRequest(user, "GET", "/api/topn", ""))
+		if w.Code != expected {
+			t.Errorf("expected status %d for %s, got %d", expected, user, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	api.topNStream(w, authenticatedRequest("alice", "GET", "/api/topn/stream", ""))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("the stream should be denied to alice, got %d", w.Code)
+	}
+}
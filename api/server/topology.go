@@ -20,15 +20,22 @@ package server
 import (
 	"bytes"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	auth "github.com/abbot/go-http-auth"
 	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/audit"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/flow"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/graffiti/graph/traversal"
@@ -36,9 +43,12 @@ import (
 	shttp "github.com/skydive-project/skydive/http"
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/rbac"
+	"github.com/skydive-project/skydive/tracing"
 	"github.com/skydive-project/skydive/validator"
 )
 
+const topologySnapshotVersion = 1
+
 // TopologyAPI exposes the topology query API
 type TopologyAPI struct {
 	graph         *graph.Graph
@@ -99,12 +109,118 @@ func (t *TopologyAPI) graphToDot(w io.Writer, g *graph.Graph) {
 	w.Write([]byte("}"))
 }
 
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+// graphMLMetadata returns the first level metadata as GraphML data, values that
+// are not string are JSON encoded. Keys are registered per element type.
+func graphMLMetadata(m graph.Metadata, prefix string, keys map[string]string) (data []graphMLData) {
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		value, ok := m[k].(string)
+		if !ok {
+			b, err := json.Marshal(m[k])
+			if err != nil {
+				continue
+			}
+			value = string(b)
+		}
+
+		id := prefix + "_" + k
+		keys[id] = k
+		data = append(data, graphMLData{Key: id, Value: value})
+	}
+
+	return
+}
+
+func (t *TopologyAPI) graphToGraphML(w io.Writer, g *graph.Graph) error {
+	g.RLock()
+	defer g.RUnlock()
+
+	doc := &graphML{XMLNS: "http://graphml.graphdrawing.org/xmlns"}
+	doc.Graph.ID = g.GetHost()
+	doc.Graph.EdgeDefault = "directed"
+
+	nodeKeys, edgeKeys := make(map[string]string), make(map[string]string)
+	for _, n := range g.GetNodes(nil) {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: string(n.ID), Data: graphMLMetadata(n.Metadata, "n", nodeKeys)})
+	}
+
+	for _, e := range g.GetEdges(nil) {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:     string(e.ID),
+			Source: string(e.Parent),
+			Target: string(e.Child),
+			Data:   graphMLMetadata(e.Metadata, "e", edgeKeys),
+		})
+	}
+
+	for element, keys := range map[string]map[string]string{"node": nodeKeys, "edge": edgeKeys} {
+		for id, name := range keys {
+			doc.Keys = append(doc.Keys, graphMLKey{ID: id, For: element, Name: name, Type: "string"})
+		}
+	}
+	sort.Slice(doc.Keys, func(i, j int) bool { return doc.Keys[i].ID < doc.Keys[j].ID })
+
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(doc)
+}
+
 func (t *TopologyAPI) topologyIndex(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
 	if !rbac.Enforce(r.Username, "topology", "read") {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
+	g, err := userGraph(t.graph, t.gremlinParser, r.Username)
+	if err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+
 	// use a buffer to render the result in order to limit the lock time
 	// if the client is slow
 	var b bytes.Buffer
@@ -112,17 +228,23 @@ func (t *TopologyAPI) topologyIndex(w http.ResponseWriter, r *auth.Authenticated
 	w.WriteHeader(http.StatusOK)
 	if strings.Contains(r.Header.Get("Accept"), "vnd.graphviz") {
 		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=UTF-8")
-		t.graphToDot(&b, t.graph)
+		t.graphToDot(&b, g)
+	} else if strings.Contains(r.Header.Get("Accept"), "graphml") {
+		w.Header().Set("Content-Type", "application/graphml+xml; charset=UTF-8")
+		if err := t.graphToGraphML(&b, g); err != nil {
+			writeError(w, http.StatusNotAcceptable, fmt.Errorf("Error while encoding response: %s", err))
+			return
+		}
 	} else {
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
-		t.graph.RLock()
-		if err := json.NewEncoder(&b).Encode(t.graph); err != nil {
-			t.graph.RUnlock()
+		g.RLock()
+		if err := json.NewEncoder(&b).Encode(g); err != nil {
+			g.RUnlock()
 			writeError(w, http.StatusNotAcceptable, fmt.Errorf("Error while encoding response: %s", err))
 			return
 		}
-		t.graph.RUnlock()
+		g.RUnlock()
 	}
 
 	if _, err := w.Write(b.Bytes()); err != nil {
@@ -154,18 +276,28 @@ func (t *TopologyAPI) topologySearch(w http.ResponseWriter, r *auth.Authenticate
 		return
 	}
 
-	ts, err := t.gremlinParser.Parse(strings.NewReader(resource.GremlinQuery))
+	ts, err := t.gremlinParser.ParseWithBindings(resource.GremlinQuery, resource.Bindings)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	res, err := ts.Exec(t.graph, true)
+	g, err := userGraph(t.graph, t.gremlinParser, r.Username)
+	if err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+
+	tracing.Annotate(r.Context(), tracing.String("gremlin.query", resource.GremlinQuery))
+
+	res, err := ts.ExecContext(queryContext(r.Context(), r.Username), g, true)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
 
+	markRawPacketAccess(r, res)
+
 	// use a buffer to render the result in order to limit the lock time
 	// if the client is slow
 	var b bytes.Buffer
@@ -179,6 +311,19 @@ func (t *TopologyAPI) topologySearch(w http.ResponseWriter, r *auth.Authenticate
 			writeError(w, http.StatusNotAcceptable, errors.New("Only graph can be outputted as dot"))
 			return
 		}
+	} else if strings.Contains(r.Header.Get("Accept"), "graphml") {
+		graphTraversal, ok := res.(*traversal.GraphTraversal)
+		if !ok {
+			writeError(w, http.StatusNotAcceptable, errors.New("Only graph can be outputted as GraphML"))
+			return
+		}
+
+		if err := t.graphToGraphML(&b, graphTraversal.Graph); err != nil {
+			writeError(w, http.StatusNotAcceptable, fmt.Errorf("Error while encoding response: %s", err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/graphml+xml; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
 	} else if strings.Contains(r.Header.Get("Accept"), "vnd.tcpdump.pcap") {
 		if rawPacketsTraversal, ok := res.(*ge.RawPacketsTraversalStep); ok {
 			values := rawPacketsTraversal.Values()
@@ -203,6 +348,16 @@ func (t *TopologyAPI) topologySearch(w http.ResponseWriter, r *auth.Authenticate
 			writeError(w, http.StatusNotAcceptable, errors.New("Only RawPackets step result can be outputted as pcap"))
 			return
 		}
+	} else if resource.Pagination.IsSet() {
+		page, total, err := encodePage(res, &resource.Pagination)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		b.Write(page)
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		w.WriteHeader(http.StatusOK)
 	} else {
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 		w.WriteHeader(http.StatusOK)
@@ -218,6 +373,253 @@ func (t *TopologyAPI) topologySearch(w http.ResponseWriter, r *auth.Authenticate
 	}
 }
 
+func (t *TopologyAPI) topologySnapshot(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	snapshot := &types.TopologySnapshot{
+		Version:   topologySnapshotVersion,
+		Host:      t.graph.GetHost(),
+		CreatedAt: common.UnixMillis(time.Now()),
+	}
+
+	query := r.URL.Query()
+
+	var history *graph.Graph
+	if value := query.Get("history"); value != "" {
+		withHistory, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid history parameter: %s", err))
+			return
+		}
+
+		if withHistory {
+			var since int64
+			if value := query.Get("since"); value != "" {
+				if since, err = strconv.ParseInt(value, 10, 64); err != nil {
+					writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid since parameter: %s", err))
+					return
+				}
+			}
+
+			context := graph.Context{TimeSlice: common.NewTimeSlice(since, snapshot.CreatedAt)}
+			if history, err = t.graph.CloneWithContext(context); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+
+			if history, err = userGraph(history, t.gremlinParser, r.Username); err != nil {
+				writeError(w, http.StatusForbidden, err)
+				return
+			}
+		}
+	}
+
+	g, err := userGraph(t.graph, t.gremlinParser, r.Username)
+	if err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+
+	// use a buffer to render the result in order to limit the lock time
+	// if the client is slow
+	var b bytes.Buffer
+
+	g.RLock()
+	elements := g.Elements()
+	snapshot.Nodes, snapshot.Edges = elements.Nodes, elements.Edges
+	if history != nil {
+		snapshot.History = history.Elements()
+	}
+
+	if err := json.NewEncoder(&b).Encode(snapshot); err != nil {
+		g.RUnlock()
+		writeError(w, http.StatusNotAcceptable, fmt.Errorf("Error while encoding response: %s", err))
+		return
+	}
+	g.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"topology-%d.json\"", snapshot.CreatedAt))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b.Bytes()); err != nil {
+		logging.GetLogger().Errorf("Error while writing response: %s", err)
+	}
+}
+
+func (t *TopologyAPI) topologyRestore(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	// a snapshot may hold elements out of the scope of the user
+	if !rbac.Enforce(r.Username, "topology", "write") || isScoped(r.Username) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var replace bool
+	if value := r.URL.Query().Get("replace"); value != "" {
+		var err error
+		if replace, err = strconv.ParseBool(value); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid replace parameter: %s", err))
+			return
+		}
+	}
+
+	var snapshot types.TopologySnapshot
+	if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if snapshot.Version != topologySnapshotVersion {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Unsupported snapshot version %d", snapshot.Version))
+		return
+	}
+
+	report := t.restoreSnapshot(&snapshot, replace)
+
+	logging.GetLogger().Infof("Topology snapshot of %s restored: %d nodes, %d edges, %d skipped", snapshot.Host, report.Nodes, report.Edges, report.Skipped)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logging.GetLogger().Errorf("Error while writing response: %s", err)
+	}
+}
+
+// restoreSnapshot injects the live elements of a snapshot into the graph.
+// Elements already known get their metadata replaced. The history part of
+// a snapshot is only meant for offline analysis and is not restored.
+func (t *TopologyAPI) restoreSnapshot(snapshot *types.TopologySnapshot, replace bool) *types.TopologyRestoreReport {
+	report := &types.TopologyRestoreReport{}
+
+	t.graph.Lock()
+	defer t.graph.Unlock()
+
+	if replace {
+		if err := t.graph.DelNodes(nil); err != nil {
+			logging.GetLogger().Errorf("Failed to flush the topology before restoring: %s", err)
+		}
+	}
+
+	for _, node := range snapshot.Nodes {
+		var err error
+		if existing := t.graph.GetNode(node.ID); existing != nil {
+			err = t.graph.SetMetadata(existing, node.Metadata)
+		} else {
+			err = t.graph.AddNode(node)
+		}
+
+		if err != nil {
+			logging.GetLogger().Warningf("Failed to restore node %s: %s", node.ID, err)
+			report.Skipped++
+			continue
+		}
+		report.Nodes++
+	}
+
+	for _, edge := range snapshot.Edges {
+		var err error
+		if existing := t.graph.GetEdge(edge.ID); existing != nil {
+			err = t.graph.SetMetadata(existing, edge.Metadata)
+		} else {
+			err = t.graph.AddEdge(edge)
+		}
+
+		if err != nil {
+			logging.GetLogger().Warningf("Failed to restore edge %s: %s", edge.ID, err)
+			report.Skipped++
+			continue
+		}
+		report.Edges++
+	}
+
+	return report
+}
+
+func (t *TopologyAPI) graphAt(at int64) (*graph.Graph, error) {
+	if at == 0 {
+		return t.graph, nil
+	}
+	return t.graph.CloneWithContext(graph.Context{TimePoint: true, TimeSlice: common.NewTimeSlice(at, at)})
+}
+
+func (t *TopologyAPI) topologyDiff(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var params types.TopologyDiffParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validator.Validate(params); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var matcher graph.ElementMatcher
+	if len(params.Filter) > 0 {
+		var kv []interface{}
+		for k, v := range params.Filter {
+			kv = append(kv, k, v)
+		}
+
+		filter, err := traversal.ParamsToFilter(filters.BoolFilterOp_AND, kv...)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		matcher = graph.NewElementFilter(filter)
+	}
+
+	from, err := t.graphAt(params.From)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	to, err := t.graphAt(params.To)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if from, err = userGraph(from, t.gremlinParser, r.Username); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+
+	if to, err = userGraph(to, t.gremlinParser, r.Username); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+
+	// use a buffer to render the result in order to limit the lock time
+	// if the client is slow
+	var b bytes.Buffer
+
+	ignored := append(append([]string{}, ge.DiffIgnoredKeys...), params.Ignore...)
+
+	t.graph.RLock()
+	diff := graph.ComputeDiff(from, to, matcher, ignored...)
+	if err := json.NewEncoder(&b).Encode(diff); err != nil {
+		t.graph.RUnlock()
+		writeError(w, http.StatusNotAcceptable, fmt.Errorf("Error while encoding response: %s", err))
+		return
+	}
+	t.graph.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b.Bytes()); err != nil {
+		logging.GetLogger().Errorf("Error while writing response: %s", err)
+	}
+}
+
 func (t *TopologyAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
 	// swagger:operation GET /topology getTopology
 	//
@@ -235,6 +637,7 @@ func (t *TopologyAPI) registerEndpoints(r *shttp.Server, authBackend shttp.Authe
 	// produces:
 	// - application/json
 	// - text/vnd.graphviz
+	// - application/graphml+xml
 	//
 	// schemes:
 	// - http
@@ -262,6 +665,7 @@ func (t *TopologyAPI) registerEndpoints(r *shttp.Server, authBackend shttp.Authe
 	// produces:
 	// - application/json
 	// - text/vnd.graphviz
+	// - application/graphml+xml
 	// - application/vnd.tcpdump.pcap
 	//
 	// schemes:
@@ -280,9 +684,125 @@ func (t *TopologyAPI) registerEndpoints(r *shttp.Server, authBackend shttp.Authe
 	//     description: query result
 	//     schema:
 	//       $ref: '#/definitions/AnyValue'
+	//     headers:
+	//       X-Total-Count:
+	//         type: integer
+	//         description: number of items of the result, when paginated
 	//   204:
 	//     description: empty query
 
+	// swagger:operation GET /topology/snapshot getTopologySnapshot
+	//
+	// Export the whole topology
+	//
+	// ---
+	// summary: Export the topology as a snapshot file
+	//
+	// tags:
+	// - topology
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - in: query
+	//     name: history
+	//     type: boolean
+	//     description: include all the revisions of the elements
+	//   - in: query
+	//     name: since
+	//     type: integer
+	//     description: start of the history in milliseconds
+	//
+	// responses:
+	//   200:
+	//     description: topology snapshot
+	//     schema:
+	//       $ref: '#/definitions/TopologySnapshot'
+	//   400:
+	//     description: invalid parameters or history not supported
+
+	// swagger:operation POST /topology/snapshot restoreTopologySnapshot
+	//
+	// Restore a topology snapshot
+	//
+	// The live nodes and edges of the snapshot are injected into the
+	// topology, the history part is ignored.
+	//
+	// ---
+	// summary: Restore a topology snapshot
+	//
+	// tags:
+	// - topology
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - in: query
+	//     name: replace
+	//     type: boolean
+	//     description: remove the current topology before restoring
+	//   - in: body
+	//     name: snapshot
+	//     required: true
+	//     schema:
+	//       $ref: '#/definitions/TopologySnapshot'
+	//
+	// responses:
+	//   200:
+	//     description: restoration report
+	//     schema:
+	//       $ref: '#/definitions/TopologyRestoreReport'
+	//   400:
+	//     description: invalid snapshot
+
+	// swagger:operation POST /topology/diff diffTopology
+	//
+	// Compute the changes of the topology between two points in time
+	//
+	// ---
+	// summary: Diff topology
+	//
+	// tags:
+	// - topology
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - application/json
+	//
+	// schemes:
+	// - http
+	// - https
+	//
+	// parameters:
+	//   - in: body
+	//     name: params
+	//     required: true
+	//     schema:
+	//       $ref: '#/definitions/TopologyDiffParams'
+	//
+	// responses:
+	//   200:
+	//     description: nodes and edges added, removed and updated
+	//     schema:
+	//       type: object
+	//   400:
+	//     description: invalid parameters or history not supported
+
 	routes := []shttp.Route{
 		{
 			Name:        "TopologiesIndex",
@@ -296,11 +816,37 @@ func (t *TopologyAPI) registerEndpoints(r *shttp.Server, authBackend shttp.Authe
 			Path:        "/api/topology",
 			HandlerFunc: t.topologySearch,
 		},
+		{
+			Name:        "TopologyDiff",
+			Method:      "POST",
+			Path:        "/api/topology/diff",
+			HandlerFunc: t.topologyDiff,
+		},
+		{
+			Name:        "TopologySnapshot",
+			Method:      "GET",
+			Path:        "/api/topology/snapshot",
+			HandlerFunc: t.topologySnapshot,
+		},
+		{
+			Name:        "TopologyRestore",
+			Method:      "POST",
+			Path:        "/api/topology/snapshot",
+			HandlerFunc: t.topologyRestore,
+		},
 	}
 
 	r.RegisterRoutes(routes, authBackend)
 }
 
+// markRawPacketAccess flags the request for the audit trail when the result
+// of its query is raw packets
+func markRawPacketAccess(r *auth.AuthenticatedRequest, res traversal.GraphTraversalStep) {
+	if _, ok := res.(*ge.RawPacketsTraversalStep); ok {
+		audit.MarkRawPacketAccess(&r.Request)
+	}
+}
+
 // RegisterTopologyAPI registers a new topology query API
 func RegisterTopologyAPI(r *shttp.Server, g *graph.Graph, parser *traversal.GremlinTraversalParser, authBackend shttp.AuthenticationBackend) {
 	t := &TopologyAPI{
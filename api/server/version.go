@@ -0,0 +1,183 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	apiVersionHeader   = "X-Skydive-API-Version"
+	apiMediaTypePrefix = "application/vnd.skydive."
+	apiMediaTypeSuffix = "+json"
+	apiPath            = "/api"
+	apiPathPrefix      = "/api/"
+)
+
+// APIVersion describes a version of the REST API. Versions are served
+// under /api/<name>, unversioned paths being an alias of the current one.
+type APIVersion struct {
+	Name string
+	// Deprecated versions are still served, with Deprecation and Sunset
+	// headers pointing the clients to the current version
+	Deprecated bool
+	Sunset     time.Time
+}
+
+// APIVersions lists the versions of the API that are served, the last one
+// being the current one
+var APIVersions = []*APIVersion{
+	{Name: "v1"},
+}
+
+type apiVersionKey struct{}
+
+// CurrentAPIVersion returns the version served on the unversioned paths
+func CurrentAPIVersion() *APIVersion {
+	return APIVersions[len(APIVersions)-1]
+}
+
+// LookupAPIVersion returns the version with the given name
+func LookupAPIVersion(name string) *APIVersion {
+	for _, version := range APIVersions {
+		if version.Name == name {
+			return version
+		}
+	}
+	return nil
+}
+
+// RequestAPIVersion returns the API version negotiated for a request, so
+// that handlers can adapt their payloads when the schema changes
+func RequestAPIVersion(r *http.Request) *APIVersion {
+	if version, ok := r.Context().Value(apiVersionKey{}).(*APIVersion); ok {
+		return version
+	}
+	return CurrentAPIVersion()
+}
+
+// acceptedAPIVersion returns the version requested with a media type like
+// application/vnd.skydive.v1+json in the Accept header, if any
+func acceptedAPIVersion(r *http.Request) (string, bool) {
+	for _, accept := range r.Header["Accept"] {
+		for _, mediaType := range strings.Split(accept, ",") {
+			mediaType = strings.TrimSpace(strings.SplitN(mediaType, ";", 2)[0])
+			if strings.HasPrefix(mediaType, apiMediaTypePrefix) && strings.HasSuffix(mediaType, apiMediaTypeSuffix) {
+				return strings.TrimSuffix(strings.TrimPrefix(mediaType, apiMediaTypePrefix), apiMediaTypeSuffix), true
+			}
+		}
+	}
+	return "", false
+}
+
+// versionedPath splits a path like /api/v1/capture into its version
+// and its unversioned path /api/capture
+func versionedPath(path string) (*APIVersion, string) {
+	if !strings.HasPrefix(path, apiPathPrefix) {
+		return nil, ""
+	}
+
+	name := strings.SplitN(path[len(apiPathPrefix):], "/", 2)[0]
+	version := LookupAPIVersion(name)
+	if version == nil {
+		return nil, ""
+	}
+
+	return version, apiPath + path[len(apiPathPrefix)+len(name):]
+}
+
+func negotiateAPIVersion(r *http.Request) (*APIVersion, error) {
+	version, _ := versionedPath(r.URL.Path)
+
+	name, ok := acceptedAPIVersion(r)
+	switch {
+	case !ok && version == nil:
+		return CurrentAPIVersion(), nil
+	case !ok:
+		return version, nil
+	case version != nil && version.Name != name:
+		return nil, fmt.Errorf("Requested API version %s does not match the %s path", name, version.Name)
+	}
+
+	if version = LookupAPIVersion(name); version == nil {
+		return nil, fmt.Errorf("Unsupported API version %s", name)
+	}
+	return version, nil
+}
+
+func setAPIVersionHeaders(w http.ResponseWriter, version *APIVersion) {
+	w.Header().Set(apiVersionHeader, version.Name)
+
+	if version.Deprecated {
+		w.Header().Set("Deprecation", "true")
+		if !version.Sunset.IsZero() {
+			w.Header().Set("Sunset", version.Sunset.UTC().Format(http.TimeFormat))
+		}
+		w.Header().Add("Link", fmt.Sprintf(`<%s/%s>; rel="successor-version"`, apiPath, CurrentAPIVersion().Name))
+	}
+}
+
+// apiVersionMiddleware negotiates the version of the API requests, using
+// either the path or the Accept header, and stores it in their context
+func apiVersionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(apiVersionKey{}).(*APIVersion); ok ||
+			(r.URL.Path != apiPath && !strings.HasPrefix(r.URL.Path, apiPathPrefix)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		version, err := negotiateAPIVersion(r)
+		if err != nil {
+			writeError(w, http.StatusNotAcceptable, err)
+			return
+		}
+		setAPIVersionHeaders(w, version)
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version)))
+	})
+}
+
+// serveVersioned dispatches a request on a versioned path to the route of
+// the unversioned one
+func (a *Server) serveVersioned(w http.ResponseWriter, r *http.Request) {
+	_, path := versionedPath(r.URL.Path)
+
+	u := *r.URL
+	u.Path, u.RawPath = path, ""
+
+	unversioned := r.WithContext(r.Context())
+	unversioned.URL = &u
+
+	a.HTTPServer.Router.ServeHTTP(w, unversioned)
+}
+
+func (a *Server) addAPIVersionRoutes() {
+	router := a.HTTPServer.Router
+	router.Use(apiVersionMiddleware)
+
+	for _, version := range APIVersions {
+		prefix := apiPathPrefix + version.Name
+		router.Path(prefix).HandlerFunc(a.serveVersioned)
+		router.PathPrefix(prefix + "/").HandlerFunc(a.serveVersioned)
+	}
+}
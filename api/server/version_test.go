@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	shttp "github.com/skydive-project/skydive/http"
+)
+
+func newVersionTestServer() *Server {
+	router := mux.NewRouter()
+	a := &Server{HTTPServer: &shttp.Server{Router: router}}
+
+	router.HandleFunc("/api/capture", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", RequestAPIVersion(r).Name, r.URL.RequestURI())
+	})
+	router.HandleFunc("/statics/index.html", func(w http.ResponseWriter, r *http.Request) {})
+	a.addAPIVersionRoutes()
+
+	return a
+}
+
+func versionRequest(a *Server, path, accept string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", path, nil)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	a.HTTPServer.Router.ServeHTTP(w, r)
+	return w
+}
+
+func TestAPIVersionNegotiation(t *testing.T) {
+	a := newVersionTestServer()
+
+	tests := []struct {
+		path   string
+		accept string
+		status int
+		body   string
+	}{
+		{path: "/api/capture", status: http.StatusOK, body: "v1 /api/capture"},
+		{path: "/api/v1/capture", status: http.StatusOK, body: "v1 /api/capture"},
+		{path: "/api/v1/capture?id=1", status: http.StatusOK, body: "v1 /api/capture?id=1"},
+		{path: "/api/capture", accept: "application/vnd.skydive.v1+json", status: http.StatusOK, body: "v1 /api/capture"},
+		{path: "/api/v1/capture", accept: "text/html, application/vnd.skydive.v1+json; q=0.9", status: http.StatusOK, body: "v1 /api/capture"},
+		{path: "/api/capture", accept: "application/json", status: http.StatusOK, body: "v1 /api/capture"},
+		{path: "/api/capture", accept: "application/vnd.skydive.v9+json", status: http.StatusNotAcceptable},
+		{path: "/api/v1/capture", accept: "application/vnd.skydive.v2+json", status: http.StatusNotAcceptable},
+	}
+
+	for _, test := range tests {
+		w := versionRequest(a, test.path, test.accept)
+		if w.Code != test.status {
+			t.Errorf("%s (Accept: %s): expected status %d, got %d", test.path, test.accept, test.status, w.Code)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		if body := w.Body.String(); body != test.body {
+			t.Errorf("%s (Accept: %s): expected %q, got %q", test.path, test.accept, test.body, body)
+		}
+		if version := w.Header().Get(apiVersionHeader); version != "v1" {
+			t.Errorf("%s: expected the v1 version header, got %q", test.path, version)
+		}
+		if w.Header().Get("Deprecation") != "" {
+			t.Errorf("%s: the current version should not be deprecated", test.path)
+		}
+	}
+
+	if w := versionRequest(a, "/statics/index.html", ""); w.Header().Get(apiVersionHeader) != "" {
+		t.Error("Only the API requests should be versioned")
+	}
+}
+
+func TestAPIVersionDeprecation(t *testing.T) {
+	sunset := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	versions := APIVersions
+	APIVersions = []*APIVersion{
+		{Name: "v1", Deprecated: true, Sunset: sunset},
+		{Name: "v2"},
+	}
+	defer func() { APIVersions = versions }()
+
+	a := newVersionTestServer()
+
+	for _, w := range []*httptest.ResponseRecorder{
+		versionRequest(a, "/api/v1/capture", ""),
+		versionRequest(a, "/api/capture", "application/vnd.skydive.v1+json"),
+	} {
+		if w.Code != http.StatusOK || w.Body.String() != "v1 /api/capture" {
+			t.Fatalf("The deprecated version should still be served, got %d %q", w.Code, w.Body.String())
+		}
+		if w.Header().Get(apiVersionHeader) != "v1" || w.Header().Get("Deprecation") != "true" {
+			t.Errorf("Expected the deprecation of v1, got %v", w.Header())
+		}
+		if sunset := w.Header().Get("Sunset"); sunset != "Mon, 01 Jun 2020 00:00:00 GMT" {
+			t.Errorf("Unexpected sunset header: %s", sunset)
+		}
+		if link := w.Header().Get("Link"); link != `</api/v2>; rel="successor-version"` {
+			t.Errorf("Unexpected link header: %s", link)
+		}
+	}
+
+	w := versionRequest(a, "/api/capture", "")
+	if w.Body.String() != "v2 /api/capture" || w.Header().Get(apiVersionHeader) != "v2" {
+		t.Errorf("The unversioned path should be served by the current version, got %q", w.Body.String())
+	}
+	if w.Header().Get("Deprecation") != "" || w.Header().Get("Link") != "" {
+		t.Errorf("The current version should not be deprecated, got %v", w.Header())
+	}
+}
@@ -0,0 +1,66 @@
+//go:generate sh -c "go run github.com/gomatic/renderizer --name=webhook --resource=webhook --type=Webhook --title=Webhook --article=a swagger_operations.tmpl > webhook_swagger.go"
+//go:generate sh -c "go run github.com/gomatic/renderizer --name=webhook --resource=webhook --type=Webhook --title=Webhook swagger_definitions.tmpl > webhook_swagger.json"
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"github.com/skydive-project/skydive/api/types"
+	shttp "github.com/skydive-project/skydive/http"
+)
+
+// WebhookResourceHandler describes a webhook resource handler
+type WebhookResourceHandler struct {
+	ResourceHandler
+}
+
+// WebhookAPI based on BasicAPIHandler
+type WebhookAPI struct {
+	BasicAPIHandler
+}
+
+// Name returns resource name "webhook"
+func (wrh *WebhookResourceHandler) Name() string {
+	return "webhook"
+}
+
+// New creates a new webhook
+func (wrh *WebhookResourceHandler) New() types.Resource {
+	return &types.Webhook{}
+}
+
+// Decorate hides the secret of the webhook
+func (wa *WebhookAPI) Decorate(resource types.Resource) {
+	resource.(*types.Webhook).Secret = ""
+}
+
+// RegisterWebhookAPI registers a new webhook api handler
+func RegisterWebhookAPI(apiServer *Server, authBackend shttp.AuthenticationBackend) (*WebhookAPI, error) {
+	wa := &WebhookAPI{
+		BasicAPIHandler: BasicAPIHandler{
+			ResourceHandler: &WebhookResourceHandler{},
+			EtcdKeyAPI:      apiServer.EtcdKeyAPI,
+		},
+	}
+	if err := apiServer.RegisterAPIHandler(wa, authBackend); err != nil {
+		return nil, err
+	}
+
+	return wa, nil
+}
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/gorilla/mux"
 	"github.com/skydive-project/skydive/js"
@@ -33,12 +34,32 @@ import (
 	shttp "github.com/skydive-project/skydive/http"
 )
 
-// WorkflowCallAPIHandler based on BasicAPIHandler
+// WorkflowCallAPIHandler based on BasicAPIHandler. The workflows are
+// executed in a runtime per user, restricted to the topology scope of
+// the user.
 type WorkflowCallAPIHandler struct {
+	sync.Mutex
 	apiServer *Server
 	graph     *graph.Graph
 	parser    *traversal.GremlinTraversalParser
-	runtime   *js.Runtime
+	runtimes  map[string]*js.Runtime
+}
+
+func (wc *WorkflowCallAPIHandler) getRuntime(user string) (*js.Runtime, error) {
+	wc.Lock()
+	defer wc.Unlock()
+
+	if runtime, found := wc.runtimes[user]; found {
+		return runtime, nil
+	}
+
+	runtime, err := NewWorkflowRuntime(wc.graph, wc.parser, wc.apiServer, user)
+	if err != nil {
+		return nil, err
+	}
+	wc.runtimes[user] = runtime
+
+	return runtime, nil
 }
 
 func (wc *WorkflowCallAPIHandler) executeWorkflow(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
@@ -62,7 +83,13 @@ func (wc *WorkflowCallAPIHandler) executeWorkflow(w http.ResponseWriter, r *auth
 		return
 	}
 
-	ottoResult, err := wc.runtime.ExecFunction(workflow.Source, wfCall.Params...)
+	runtime, err := wc.getRuntime(r.Username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ottoResult, err := runtime.ExecFunction(workflow.Source, wfCall.Params...)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		return
@@ -145,16 +172,11 @@ func (wc *WorkflowCallAPIHandler) registerEndPoints(s *shttp.Server, authBackend
 
 // RegisterWorkflowCallAPI registers a new workflow  call api handler
 func RegisterWorkflowCallAPI(s *shttp.Server, authBackend shttp.AuthenticationBackend, apiServer *Server, g *graph.Graph, tr *traversal.GremlinTraversalParser) error {
-	runtime, err := NewWorkflowRuntime(g, tr, apiServer)
-	if err != nil {
-		return err
-	}
-
 	workflowCallAPIHandler := &WorkflowCallAPIHandler{
 		apiServer: apiServer,
 		graph:     g,
 		parser:    tr,
-		runtime:   runtime,
+		runtimes:  make(map[string]*js.Runtime),
 	}
 	workflowCallAPIHandler.registerEndPoints(s, authBackend)
 
@@ -18,6 +18,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -30,21 +31,31 @@ import (
 	"github.com/skydive-project/skydive/graffiti/graph/traversal"
 )
 
-// NewWorkflowRuntime returns a new Workflow runtime
-func NewWorkflowRuntime(g *graph.Graph, tr *traversal.GremlinTraversalParser, server *Server) (*js.Runtime, error) {
+// NewWorkflowRuntime returns a new Workflow runtime. The Gremlin queries are
+// evaluated on the part of the graph in the topology scope of the user, the
+// whole graph without user.
+func NewWorkflowRuntime(g *graph.Graph, tr *traversal.GremlinTraversalParser, server *Server, user string) (*js.Runtime, error) {
 	runtime, err := js.NewRuntime()
 	if err != nil {
 		return nil, err
 	}
 	runtime.Start()
 
-	queryGremlin := func(query string) otto.Value {
-		ts, err := tr.Parse(strings.NewReader(query))
+	queryGremlin := func(query string, bindings map[string]interface{}) otto.Value {
+		ts, err := tr.ParseWithBindings(query, bindings)
 		if err != nil {
 			return runtime.MakeCustomError("ParseError", err.Error())
 		}
 
-		result, err := ts.Exec(g, false)
+		scoped, ctx := g, context.Background()
+		if user != "" {
+			if scoped, err = userGraph(g, tr, user); err != nil {
+				return runtime.MakeCustomError("ScopeError", err.Error())
+			}
+			ctx = queryContext(ctx, user)
+		}
+
+		result, err := ts.ExecContext(ctx, scoped, false)
 		if err != nil {
 			return runtime.MakeCustomError("ExecuteError", err.Error())
 		}
@@ -65,7 +76,36 @@ func NewWorkflowRuntime(g *graph.Graph, tr *traversal.GremlinTraversalParser, se
 
 		query := call.Argument(0).String()
 
-		return queryGremlin(query)
+		return queryGremlin(query, nil)
+	})
+
+	runtime.Set("SavedQuery", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) < 1 || !call.Argument(0).IsString() {
+			return runtime.MakeCustomError("MissingQueryArgument", "SavedQuery requires the name of the query")
+		}
+
+		handler := server.GetHandler("savedquery")
+		if handler == nil {
+			return runtime.MakeCustomError("NotFound", "Saved queries are not available")
+		}
+
+		query, err := lookupSavedQuery(handler, call.Argument(0).String())
+		if err != nil {
+			return runtime.MakeCustomError("NotFound", err.Error())
+		}
+
+		var values map[string]interface{}
+		if len(call.ArgumentList) > 1 && call.Argument(1).IsObject() {
+			exported, err := call.Argument(1).Export()
+			if err != nil {
+				return runtime.MakeCustomError("WrongArgument", err.Error())
+			}
+			if values, _ = exported.(map[string]interface{}); values == nil {
+				return runtime.MakeCustomError("WrongArgument", "SavedQuery parameters have to be an object")
+			}
+		}
+
+		return queryGremlin(query.Query, query.Bindings(values))
 	})
 
 	runtime.Set("request", func(call otto.FunctionCall) otto.Value {
@@ -90,7 +130,7 @@ func NewWorkflowRuntime(g *graph.Graph, tr *traversal.GremlinTraversalParser, se
 				return runtime.MakeCustomError("WrongArgument", fmt.Sprintf("Invalid query %s", string(data)))
 			}
 
-			return queryGremlin(query.GremlinQuery)
+			return queryGremlin(query.GremlinQuery, query.Bindings)
 		}
 
 		// This a CRUD call
@@ -105,7 +145,7 @@ func NewWorkflowRuntime(g *graph.Graph, tr *traversal.GremlinTraversalParser, se
 			if err := json.Unmarshal([]byte(data), res); err != nil {
 				return runtime.MakeCustomError("UnmarshalError", err.Error())
 			}
-			if err := handler.Create(res, nil); err != nil {
+			if err := handler.Create(res, &CreateOptions{Username: user}); err != nil {
 				return runtime.MakeCustomError("CreateError", err.Error())
 			}
 			b, _ := json.Marshal(res)
@@ -0,0 +1,54 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package types
+
+import (
+	"github.com/skydive-project/skydive/common"
+)
+
+// ClusterNamespace is the websocket namespace used by the analyzers of a
+// cluster to send the members to the agents
+const ClusterNamespace = "Cluster"
+
+// ClusterMembers describes the analyzers sharing the agents, each agent
+// being placed on one of them by consistent hashing of its host ID
+// swagger:model
+type ClusterMembers struct {
+	// Host IDs of the analyzers
+	Members []string
+	// Number of times each analyzer is placed on the hash ring
+	Replicas int
+}
+
+// Owner returns the analyzer owning the given agent among the given
+// analyzers, an empty string if none of them is a member
+func (c *ClusterMembers) Owner(agent string, analyzers []string) string {
+	available := make(map[string]bool)
+	for _, analyzer := range analyzers {
+		available[analyzer] = true
+	}
+
+	var members []string
+	for _, member := range c.Members {
+		if available[member] {
+			members = append(members, member)
+		}
+	}
+
+	return common.NewHashRing(members, c.Replicas).Owner(agent)
+}
@@ -0,0 +1,44 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package types
+
+import (
+	"encoding/json"
+)
+
+// FederatedQuery is a Gremlin query sent by the global analyzer to the
+// analyzers of the member sites
+// swagger:model
+type FederatedQuery struct {
+	// Gremlin query, run as is on each site
+	GremlinQuery string `json:"GremlinQuery" valid:"nonzero"`
+	// Values of the $name parameters of the query
+	Bindings map[string]interface{} `json:"Bindings,omitempty"`
+	// Sites to query, all of them if empty
+	Sites []string `json:"Sites,omitempty"`
+}
+
+// SiteResult is the result of a federated query on one site
+// swagger:model
+type SiteResult struct {
+	Site string
+	// Result of the Gremlin query, as returned by the topology API of the site
+	Result json.RawMessage `json:",omitempty"`
+	// Error returned by the site, if any
+	Error string `json:",omitempty"`
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package types
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/skydive-project/skydive/flow"
+)
+
+// HealthNamespace is the websocket namespace of the health requests sent
+// by the analyzers to the agents
+const HealthNamespace = "Health"
+
+// CaptureHealth describes the state of a capture running on a node
+// swagger:model
+type CaptureHealth struct {
+	// Capture ID
+	ID string
+	// TID of the captured node
+	NodeTID string
+	// Name of the captured node
+	NodeName string
+	// Capture type
+	Type string
+	// Capture state
+	State string
+	// Error of the capture
+	Error string `json:",omitempty"`
+	// Number of packets received since the capture started
+	PacketsReceived int64
+	// Number of packets dropped since the capture started
+	PacketsDropped int64
+	// Number of packets dropped by the interface since the capture started
+	PacketsIfDropped int64
+}
+
+// AgentHealth describes the health of an agent, along with the state of
+// its probes, captures and flow tables
+// swagger:model
+type AgentHealth struct {
+	// Whether no issue was found
+	Healthy bool
+	// Issues found
+	Issues []string `json:",omitempty"`
+	// Time of the check
+	Time time.Time
+	// Number of analyzers the agent is connected to
+	ConnectedAnalyzers int
+	// Status of the topology probes by name
+	Probes map[string]interface{}
+	// Captures running on the agent
+	Captures []*CaptureHealth
+	// Flow tables of the captures
+	FlowTables []*flow.TableStatus
+	// Degradation applied as the agent exceeds its resource budgets
+	Throttling *AgentThrottling `json:",omitempty"`
+}
+
+// AgentThrottling describes the resources used by an agent and the
+// degradation applied when it exceeds its budgets
+// swagger:model
+type AgentThrottling struct {
+	// Degradation level, 0 meaning not throttled
+	Level int
+	// Budgets exceeded at the last check
+	Reasons []string `json:",omitempty"`
+	// Resident memory in bytes
+	RSS uint64
+	// CPU usage in percent of the host CPUs
+	CPU float64
+	// Only one packet out of SamplingRate is processed by the flow tables
+	SamplingRate int64
+	// The flows are sent UpdateFactor times less often
+	UpdateFactor int64
+	// Low priority probes paused
+	PausedProbes []string `json:",omitempty"`
+}
+
+// AddIssue records an issue, the agent becoming unhealthy
+func (h *AgentHealth) AddIssue(format string, args ...interface{}) {
+	h.Issues = append(h.Issues, fmt.Sprintf(format, args...))
+	h.Healthy = false
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package types
+
+// LoadNamespace is the websocket namespace of the load requests sent by the
+// agents to the analyzers
+const LoadNamespace = "Load"
+
+// AnalyzerLoad describes the load of an analyzer, as reported to the agents
+// swagger:model
+type AnalyzerLoad struct {
+	// Number of connected agents
+	Agents int
+	// CPU usage of the host in percent
+	CPU float64
+}
+
+// FlowServerStatus describes the flows received by an analyzer from the agents
+// swagger:model
+type FlowServerStatus struct {
+	// Number of flow updates received
+	Received int64
+	// Number of flow updates dropped as the flow buffer was full
+	Dropped int64
+	// Number of flow updates stored and sent to the subscribers
+	Handled int64
+}
+
+// RateLimitUsage describes how a user is limited by the rate limits and quotas
+// swagger:model
+type RateLimitUsage struct {
+	// Number of requests rejected as exceeding the request rate
+	Throttled int64
+	// Number of queries rejected as exceeding the concurrent query quota
+	QuotaExceeded int64
+	// Number of queries being executed
+	ActiveQueries int
+}
+
+// RateLimitStatus describes the rate limiting of the API of an analyzer
+// swagger:model
+type RateLimitStatus struct {
+	RateLimitUsage
+	// Usage of the users having been limited or running queries
+	Users map[string]*RateLimitUsage
+}
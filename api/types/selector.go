@@ -0,0 +1,261 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package types
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/gremlin"
+)
+
+// Label selector operators
+const (
+	SelectorEqual     = "="
+	SelectorNotEqual  = "!="
+	SelectorIn        = "in"
+	SelectorNotIn     = "notin"
+	SelectorExists    = "exists"
+	SelectorNotExists = "!"
+)
+
+var (
+	selectorKeyRegexp   = regexp.MustCompile(`^[A-Za-z0-9_./-]+$`)
+	selectorValueRegexp = regexp.MustCompile(`^[A-Za-z0-9_.:/@-]*$`)
+	selectorSetRegexp   = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+)
+
+// SelectorRequirement is a condition on a metadata key
+type SelectorRequirement struct {
+	Key      string
+	Operator string
+	Values   []string
+}
+
+// LabelSelector selects the nodes meeting all its requirements, the
+// requirements being written as Manager=k8s,K8s.Namespace in (prod,staging).
+// Supported requirements are key=value, key!=value, key in (values),
+// key notin (values), key to check a key exists and !key for the opposite.
+type LabelSelector []SelectorRequirement
+
+// splitSelector splits a selector on the commas out of the value sets
+func splitSelector(s string) (terms []string, err error) {
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth < 0 {
+				return nil, errors.New("Unbalanced parenthesis")
+			}
+		case ',':
+			if depth == 0 {
+				terms = append(terms, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, errors.New("Unbalanced parenthesis")
+	}
+	return append(terms, s[start:]), nil
+}
+
+func parseSelectorRequirement(term string) (r SelectorRequirement, err error) {
+	switch {
+	case strings.HasPrefix(term, "!") && !strings.Contains(term, "="):
+		r = SelectorRequirement{Key: strings.TrimSpace(term[1:]), Operator: SelectorNotExists}
+	case selectorSetRegexp.MatchString(term):
+		match := selectorSetRegexp.FindStringSubmatch(term)
+		r = SelectorRequirement{Key: match[1], Operator: match[2]}
+		for _, value := range strings.Split(match[3], ",") {
+			r.Values = append(r.Values, strings.TrimSpace(value))
+		}
+	case strings.Contains(term, "!="):
+		kv := strings.SplitN(term, "!=", 2)
+		r = SelectorRequirement{Key: strings.TrimSpace(kv[0]), Operator: SelectorNotEqual, Values: []string{strings.TrimSpace(kv[1])}}
+	case strings.Contains(term, "="):
+		kv := strings.SplitN(term, "=", 2)
+		r = SelectorRequirement{Key: strings.TrimSpace(kv[0]), Operator: SelectorEqual, Values: []string{strings.TrimSpace(strings.TrimPrefix(kv[1], "="))}}
+	default:
+		r = SelectorRequirement{Key: term, Operator: SelectorExists}
+	}
+
+	if !selectorKeyRegexp.MatchString(r.Key) {
+		return r, fmt.Errorf("Invalid key '%s'", r.Key)
+	}
+	for _, value := range r.Values {
+		if !selectorValueRegexp.MatchString(value) {
+			return r, fmt.Errorf("Invalid value '%s' for key '%s'", value, r.Key)
+		}
+	}
+	sort.Strings(r.Values)
+
+	return r, nil
+}
+
+// ParseLabelSelector parses a label selector
+func ParseLabelSelector(s string) (LabelSelector, error) {
+	terms, err := splitSelector(s)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid selector: %s", err)
+	}
+
+	var selector LabelSelector
+	for _, term := range terms {
+		if term = strings.TrimSpace(term); term == "" {
+			continue
+		}
+
+		r, err := parseSelectorRequirement(term)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid selector: %s", err)
+		}
+		selector = append(selector, r)
+	}
+
+	if len(selector) == 0 {
+		return nil, errors.New("Empty selector")
+	}
+
+	sort.SliceStable(selector, func(i, j int) bool {
+		return selector[i].Key < selector[j].Key
+	})
+
+	return selector, nil
+}
+
+// String returns the normalized form of the selector, the requirements
+// being sorted by key
+func (l LabelSelector) String() string {
+	terms := make([]string, len(l))
+	for i, r := range l {
+		switch r.Operator {
+		case SelectorExists:
+			terms[i] = r.Key
+		case SelectorNotExists:
+			terms[i] = "!" + r.Key
+		case SelectorIn, SelectorNotIn:
+			terms[i] = fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(r.Values, ","))
+		default:
+			terms[i] = r.Key + r.Operator + r.Values[0]
+		}
+	}
+	return strings.Join(terms, ",")
+}
+
+func selectorValues(values []string) []interface{} {
+	list := make([]interface{}, len(values))
+	for i, value := range values {
+		list[i] = value
+	}
+	return list
+}
+
+// GremlinQuery returns the Gremlin query of the nodes matching the selector
+func (l LabelSelector) GremlinQuery() string {
+	var has []interface{}
+	for _, r := range l {
+		switch r.Operator {
+		case SelectorEqual:
+			has = append(has, r.Key, r.Values[0])
+		case SelectorNotEqual:
+			has = append(has, r.Key, gremlin.Nee(r.Values[0]))
+		case SelectorIn:
+			has = append(has, r.Key, gremlin.Within(selectorValues(r.Values)...))
+		case SelectorNotIn:
+			has = append(has, r.Key, gremlin.Without(selectorValues(r.Values)...))
+		}
+	}
+
+	query := gremlin.G.V()
+	if len(has) > 0 {
+		query = query.Has(has...)
+	}
+	for _, r := range l {
+		switch r.Operator {
+		case SelectorExists:
+			query = query.HasKey(r.Key)
+		case SelectorNotExists:
+			query = query.HasNot(r.Key)
+		}
+	}
+	return query.String()
+}
+
+func selectorFieldValues(g common.Getter, key string) ([]string, bool) {
+	field, err := g.GetField(key)
+	if err != nil {
+		return nil, false
+	}
+
+	switch field := field.(type) {
+	case []string:
+		return field, true
+	case []interface{}:
+		values := make([]string, len(field))
+		for i, value := range field {
+			values[i] = fmt.Sprintf("%v", value)
+		}
+		return values, true
+	default:
+		return []string{fmt.Sprintf("%v", field)}, true
+	}
+}
+
+func containsAny(values []string, candidates []string) bool {
+	for _, value := range values {
+		for _, candidate := range candidates {
+			if value == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Match returns whether a graph element meets the requirements of the
+// selector. As with Gremlin, a requirement on a list field is met when
+// one of its values is.
+func (l LabelSelector) Match(g common.Getter) bool {
+	for _, r := range l {
+		values, found := selectorFieldValues(g, r.Key)
+
+		var match bool
+		switch r.Operator {
+		case SelectorEqual, SelectorIn:
+			match = found && containsAny(values, r.Values)
+		case SelectorNotEqual, SelectorNotIn:
+			match = !found || !containsAny(values, r.Values)
+		case SelectorExists:
+			match = found
+		case SelectorNotExists:
+			match = !found
+		}
+
+		if !match {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package types
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		expected string
+		query    string
+	}{
+		{
+			selector: "Manager=k8s, K8s.Namespace in (prod, staging)",
+			expected: "K8s.Namespace in (prod,staging),Manager=k8s",
+			query:    `G.V().Has("K8s.Namespace", Within("prod", "staging"), "Manager", "k8s")`,
+		},
+		{
+			selector: "Type!=veth,!Foo,Bar",
+			expected: "Bar,!Foo,Type!=veth",
+			query:    `G.V().Has("Type", Nee("veth")).HasKey("Bar").HasNot("Foo")`,
+		},
+		{
+			selector: "Name==eth0,State notin (DOWN)",
+			expected: "Name=eth0,State notin (DOWN)",
+			query:    `G.V().Has("Name", "eth0", "State", Without("DOWN"))`,
+		},
+	}
+
+	for _, test := range tests {
+		selector, err := ParseLabelSelector(test.selector)
+		if err != nil {
+			t.Fatalf("Unable to parse %s: %s", test.selector, err)
+		}
+		if s := selector.String(); s != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, s)
+		}
+		if q := selector.GremlinQuery(); q != test.query {
+			t.Errorf("Expected query %s, got %s", test.query, q)
+		}
+	}
+
+	for _, selector := range []string{"", "Name in (eth0", "Name=eth 0", "Na me"} {
+		if _, err := ParseLabelSelector(selector); err == nil {
+			t.Errorf("Selector '%s' should be invalid", selector)
+		}
+	}
+}
+
+func TestLabelSelectorMatch(t *testing.T) {
+	selector, err := ParseLabelSelector("Manager=k8s,K8s.Namespace in (prod,staging),Type!=veth,!Orphan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		metadata graph.Metadata
+		match    bool
+	}{
+		{graph.Metadata{"Manager": "k8s", "K8s": map[string]interface{}{"Namespace": "prod"}, "Type": "device"}, true},
+		{graph.Metadata{"Manager": "k8s", "K8s": map[string]interface{}{"Namespace": "staging"}}, true},
+		{graph.Metadata{"Manager": "k8s", "K8s": map[string]interface{}{"Namespace": "dev"}}, false},
+		{graph.Metadata{"Manager": "k8s", "K8s": map[string]interface{}{"Namespace": "prod"}, "Type": "veth"}, false},
+		{graph.Metadata{"Manager": "k8s", "K8s": map[string]interface{}{"Namespace": "prod"}, "Orphan": true}, false},
+		{graph.Metadata{"Manager": "docker"}, false},
+	}
+
+	for i, test := range tests {
+		n := graph.CreateNode(graph.GenID(), test.metadata, graph.TimeUTC(), "", "")
+		if match := selector.Match(n); match != test.match {
+			t.Errorf("Test %d: expected match to be %v", i, test.match)
+		}
+	}
+}
@@ -23,7 +23,12 @@
 package types
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/skydive-project/skydive/flow"
@@ -77,20 +82,178 @@ type Alert struct {
 	// Alert description
 	Description string `json:",omitempty" yaml:"Description"`
 	// Gremlin or JavaScript expression evaluated to trigger the alarm
-	Expression string `json:",omitempty" valid:"nonzero" yaml:"Expression"`
+	Expression string `json:",omitempty" yaml:"Expression"`
 	// Action to execute when the alert is triggered.
-	// Can be either an empty string, or a URL (use 'file://' for local scripts)
-	Action string `json:",omitempty" valid:"regexp=^(|http://|https://|file://).*$" yaml:"Action"`
-	// Event that triggers the alert evaluation
-	Trigger    string `json:",omitempty" valid:"regexp=^(graph|duration:.+|)$" yaml:"Trigger"`
+	// Can be either an empty string, or a URL (use 'file://' for local scripts).
+	// Notifications are sent using 'slack+https://' with a Slack webhook URL,
+	// 'pagerduty://<routing key>?severity=<severity>' or
+	// 'mailto:<address>,<address>?subject=<subject>'
+	Action string `json:",omitempty" valid:"regexp=^(|http://|https://|file://|slack[+]https://|pagerduty://|mailto:).*$" yaml:"Action"`
+	// Event that triggers the alert evaluation. With 'change', the expression
+	// is a Gremlin filter and the alert is triggered for every change of the
+	// matching nodes and edges.
+	Trigger string `json:",omitempty" valid:"regexp=^(graph|change|duration:.+|)$" yaml:"Trigger"`
+	// Go template of the Slack, PagerDuty and email notifications
+	Template string `json:",omitempty" yaml:"Template"`
+	// Numeric threshold the expression result is compared to
+	Threshold *AlertThreshold `json:",omitempty" yaml:"Threshold"`
+	// Anomaly detection on the flows returned by the expression
+	Anomaly *AlertAnomaly `json:",omitempty" yaml:"Anomaly"`
+	// Conditions combined to trigger the alarm, instead of the expression
+	Conditions []*AlertCondition `json:",omitempty" yaml:"Conditions"`
+	// Combination of the conditions, AND or OR
+	Combine string `json:",omitempty" valid:"regexp=^(AND|OR|and|or|)$" yaml:"Combine"`
+	// Maximum delay between the conditions becoming true when combined
+	// with AND, e.g. 60s. All the conditions have to be true at the same
+	// time when not set.
+	Within     string `json:",omitempty" yaml:"Within"`
 	CreateTime time.Time
 }
 
+// AlertCondition describes a condition of a composite alert
+// swagger:model
+type AlertCondition struct {
+	// Condition name, used as key of the reason data
+	Name string `valid:"nonzero" yaml:"Name"`
+	// Gremlin or JavaScript expression, the condition being true when it
+	// returns a non empty result
+	Expression string `valid:"nonzero" yaml:"Expression"`
+}
+
+// AlertAnomaly describes an alert learning a baseline of the flows returned
+// by its expression during a training window. Once trained, the alert is
+// triggered on volume spikes and when new peers or ports show up.
+// swagger:model
+type AlertAnomaly struct {
+	// Duration of the training window, e.g. 24h
+	Training string `yaml:"Training"`
+	// Number of standard deviations above the mean volume considered as a spike, 3 by default
+	Sensitivity float64 `json:",omitempty" yaml:"Sensitivity"`
+}
+
+// Validate verifies the training window and the sensitivity
+func (a *AlertAnomaly) Validate() error {
+	if _, err := time.ParseDuration(a.Training); err != nil {
+		return fmt.Errorf("Invalid training window: %s", err)
+	}
+	if a.Sensitivity < 0 {
+		return errors.New("Sensitivity can't be negative")
+	}
+	return nil
+}
+
+// AlertThreshold describes a threshold over a numeric field of the result of
+// an alert expression. Once triggered, the alert is cleared when the value
+// crosses back the Clear value, avoiding to trigger it again on every
+// evaluation while the value oscillates around the threshold.
+// swagger:model
+type AlertThreshold struct {
+	// Field of the expression result compared to the threshold, the largest
+	// value of the field is used. Empty if the expression returns a number.
+	Field string `json:",omitempty" yaml:"Field"`
+	// Comparison operator, either > (default) or <
+	Operator string `json:",omitempty" valid:"regexp=^(>|<|)$" yaml:"Operator"`
+	// Threshold value
+	Value float64 `yaml:"Value"`
+	// Value to cross back for the alert to be cleared, defaults to Value
+	Clear *float64 `json:",omitempty" yaml:"Clear"`
+	// Duration the threshold has to be exceeded before triggering, e.g. 2m
+	For string `json:",omitempty" yaml:"For"`
+	// Minimum delay between two triggers of the alert
+	Cooldown string `json:",omitempty" yaml:"Cooldown"`
+}
+
+// Validate verifies the threshold durations and the Clear value
+func (t *AlertThreshold) Validate() error {
+	for _, d := range []string{t.For, t.Cooldown} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return err
+		}
+	}
+
+	if t.Clear != nil {
+		if t.Operator == "<" && *t.Clear < t.Value || t.Operator != "<" && *t.Clear > t.Value {
+			return errors.New("Clear value has to be on the other side of the threshold")
+		}
+	}
+
+	return nil
+}
+
 // GetName returns the resource name
 func (a *Alert) GetName() string {
 	return "Alert"
 }
 
+// Validate verifies the notification template, the threshold, the anomaly
+// detection and the conditions of the alert
+func (a *Alert) Validate() error {
+	if _, err := template.New("alert").Funcs(AlertTemplateFuncs).Parse(a.Template); err != nil {
+		return fmt.Errorf("Invalid template: %s", err)
+	}
+	if err := a.validateConditions(); err != nil {
+		return err
+	}
+	if a.Threshold != nil && a.Anomaly != nil {
+		return errors.New("An alert can't have both a threshold and an anomaly detection")
+	}
+	if a.Threshold != nil {
+		return a.Threshold.Validate()
+	}
+	if a.Anomaly != nil {
+		return a.Anomaly.Validate()
+	}
+	return nil
+}
+
+func (a *Alert) validateConditions() error {
+	if len(a.Conditions) == 0 {
+		if a.Expression == "" {
+			return errors.New("An alert requires an expression or conditions")
+		}
+		return nil
+	}
+
+	if a.Expression != "" {
+		return errors.New("An alert can't have both an expression and conditions")
+	}
+	if a.Threshold != nil || a.Anomaly != nil || strings.HasPrefix(a.Trigger, "change") {
+		return errors.New("Conditions can't be used with a threshold, an anomaly detection or a change trigger")
+	}
+
+	names := make(map[string]bool)
+	for _, c := range a.Conditions {
+		if c == nil {
+			return errors.New("Invalid nil condition")
+		}
+		if names[c.Name] {
+			return fmt.Errorf("Duplicated condition name '%s'", c.Name)
+		}
+		names[c.Name] = true
+	}
+
+	if a.Within != "" {
+		if strings.ToUpper(a.Combine) == "OR" {
+			return errors.New("A delay between conditions can only be used with AND")
+		}
+		if _, err := time.ParseDuration(a.Within); err != nil {
+			return fmt.Errorf("Invalid delay between conditions: %s", err)
+		}
+	}
+	return nil
+}
+
+// AlertTemplateFuncs are the functions available in alert templates
+var AlertTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.MarshalIndent(v, "", "  ")
+		return string(b), err
+	},
+}
+
 // NewAlert creates a New empty Alert, only CreateTime is set.
 func NewAlert() *Alert {
 	return &Alert{
@@ -98,19 +261,94 @@ func NewAlert() *Alert {
 	}
 }
 
+// Alert states
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertState describes the current state of an alert
+// swagger:model
+type AlertState struct {
+	// firing or resolved
+	State string
+	// Time of the last state change
+	Since time.Time
+	// Time of the last trigger of the alert
+	LastTriggered time.Time `json:",omitempty"`
+	// Number of times the alert was triggered
+	Count int64
+	// Acknowledgement of the alert, if any
+	Ack *AlertAck `json:",omitempty"`
+}
+
+// AlertAck describes the acknowledgement of an alert. The notifications of an
+// acknowledged alert are suppressed until it is resolved, or until the end of
+// the duration when one is given.
+// swagger:model
+type AlertAck struct {
+	// User that acknowledged the alert
+	User string `json:",omitempty"`
+	// Comment of the acknowledgement
+	Comment string `json:",omitempty"`
+	// Silence the alert for this duration, even after its resolution
+	Duration string `json:",omitempty"`
+	// Time of the acknowledgement
+	Time time.Time
+	// End of the silence
+	Until *time.Time `json:",omitempty"`
+}
+
+// AlertEvent describes an entry of the history of an alert
+// swagger:model
+type AlertEvent struct {
+	// fired, resolved, acknowledged, silenced or unacknowledged
+	Type string
+	Time time.Time
+	// User at the origin of the event
+	User    string `json:",omitempty"`
+	Comment string `json:",omitempty"`
+	// Data that triggered the alert
+	ReasonData interface{} `json:",omitempty"`
+	// Whether the notifications were suppressed by an acknowledgement
+	Suppressed bool `json:",omitempty"`
+}
+
+// AlertBacktestParams describes the evaluation of an alert on a past time
+// range of the topology and flows history
+// swagger:model
+type AlertBacktestParams struct {
+	Alert *Alert
+	From  time.Time
+	To    time.Time
+	// Delay between two evaluations, the one of the 'duration' trigger or
+	// 1m by default
+	Step string `json:",omitempty"`
+}
+
+// AlertBacktestResult describes when an alert would have fired
+// swagger:model
+type AlertBacktestResult struct {
+	// Number of evaluations of the alert
+	Evaluations int64
+	// fired and resolved events
+	Events []*AlertEvent
+}
+
 // Capture object
 //
 // Captures provide a way to capture network traffic on the nodes
-// matching a Gremlin expression.
+// matching a Gremlin expression or a label selector over their metadata.
 //
 // easyjson:json
 // swagger:model Capture
 type Capture struct {
 	// swagger:allOf
 	BasicResource `yaml:",inline"`
-	// Gremlin Query
-	// required: true
-	GremlinQuery string `json:"GremlinQuery,omitempty" valid:"isGremlinExpr" yaml:"GremlinQuery"`
+	// Gremlin Query, derived from the selector when one is given
+	GremlinQuery string `json:"GremlinQuery,omitempty" valid:"isGremlinOrEmpty" yaml:"GremlinQuery"`
+	// Label selector over the node metadata, ex: Manager=k8s,K8s.Namespace in (prod,staging)
+	Selector string `json:"Selector,omitempty" yaml:"Selector"`
 	// BPF filter
 	BPFFilter string `json:"BPFFilter,omitempty" valid:"isBPFFilter" yaml:"BPFFilter"`
 	// Capture name
@@ -140,12 +378,26 @@ type Capture struct {
 	ReassembleTCP bool `json:"ReassembleTCP" yaml:"ReassembleTCP"`
 	// First layer used by flow key calculation, L2 or L3
 	LayerKeyMode string `json:"LayerKeyMode,omitempty" valid:"isValidLayerKeyMode" yaml:"LayerKeyMode"`
-	// List of extra layers to be added to the flow, available: DNS|DHCPv4|VRRP
+	// List of extra layers to be added to the flow, available: DNS|DHCPv4|DHCPv6|VRRP
 	ExtraLayers flow.ExtraLayers `json:"ExtraLayers,omitempty" yaml:"ExtraLayers"`
 	// sFlow/NetFlow target, if empty the agent will be used
 	Target string `json:"Target,omitempty" valid:"isValidAddress" yaml:"Target"`
 	// target type (netflowv5, erspanv1), ignored in case of sFlow/NetFlow capture
 	TargetType string `json:"TargetType,omitempty" yaml:"TargetType"`
+	// Time at which the capture starts, if not set the capture starts immediately
+	StartTime *time.Time `json:",omitempty" yaml:"StartTime"`
+	// Duration of the capture in seconds starting from StartTime, 0: no limit
+	Duration int64 `json:"Duration,omitempty" valid:"min=0" yaml:"Duration"`
+	// Time to live of the capture in seconds, the capture is deleted once expired, 0: no expiration
+	TTL int64 `json:"TTL,omitempty" valid:"min=0" yaml:"TTL"`
+	// Mask the flows of the capture (addresses, payload and raw packets) as configured on the analyzer
+	Masked bool `json:"Masked,omitempty" yaml:"Masked"`
+	// Encrypt the raw packets of the capture before they are stored
+	EncryptRawPackets bool `json:"EncryptRawPackets,omitempty" yaml:"EncryptRawPackets"`
+	// Interval in seconds between the metric updates of the flows, 0: flow.update of the agent
+	UpdateInterval int64 `json:"UpdateInterval,omitempty" valid:"min=0" yaml:"UpdateInterval"`
+	// Inactivity timeout in seconds after which the flows expire, 0: flow.expire of the agent
+	ExpireTimeout int64 `json:"ExpireTimeout,omitempty" valid:"min=0" yaml:"ExpireTimeout"`
 }
 
 // GetName returns the resource name
@@ -153,6 +405,26 @@ func (c *Capture) GetName() string {
 	return "Capture"
 }
 
+// Validate verifies the capture has either a Gremlin query or a selector
+func (c *Capture) Validate() error {
+	if c.Selector == "" {
+		if c.GremlinQuery == "" {
+			return errors.New("A Gremlin query or a selector is required")
+		}
+		return nil
+	}
+
+	selector, err := ParseLabelSelector(c.Selector)
+	if err != nil {
+		return err
+	}
+	if c.GremlinQuery != "" && c.GremlinQuery != selector.GremlinQuery() {
+		return errors.New("A capture can't have both a Gremlin query and a selector")
+	}
+
+	return nil
+}
+
 // NewCapture creates a new capture
 func NewCapture(query string, bpfFilter string) *Capture {
 	return &Capture{
@@ -164,6 +436,8 @@ func NewCapture(query string, bpfFilter string) *Capture {
 // EdgeRule object
 //
 // Edge rules allow the dynamic creation of links between nodes of the graph.
+// The created edges are owned by the "user" Manager and are recreated
+// if deleted, as long as the rule exists.
 //
 // easyjson:json
 // swagger:model
@@ -195,9 +469,33 @@ func (e *EdgeRule) Validate() error {
 	return schemaValidator.ValidateEdge(edge)
 }
 
+// MetadataField object
+//
+// Metadata fields declare the type of custom metadata keys. Nodes and edges
+// written by the publishers are validated against them and the storage
+// backends index them according to their type.
+//
+// easyjson:json
+// swagger:model
+type MetadataField struct {
+	// swagger:allOf
+	BasicResource `yaml:",inline"`
+	// swagger:allOf
+	topology.MetadataField `yaml:",inline"`
+	// Metadata field description
+	Description string `yaml:"Description"`
+}
+
+// GetName returns the resource name
+func (m *MetadataField) GetName() string {
+	return "MetadataField"
+}
+
 // NodeRule object
 //
-// Node rules allow the dynamic creation of nodes in the graph.
+// Node rules allow the dynamic creation of nodes in the graph, such as
+// external devices or logical zones. The created nodes are owned by the
+// "user" Manager and are recreated if deleted, as long as the rule exists.
 //
 // easyjson:json
 // swagger:model
@@ -281,6 +579,13 @@ type PacketInjection struct {
 	StartTime        time.Time
 	Pcap             []byte `yaml:"Pcap"`
 	TTL              uint8  `yaml:"TTL"`
+	Rate             uint64 `yaml:"Rate"`
+	Duration         uint64 `yaml:"Duration"`
+	PayloadLengthMin int64  `yaml:"PayloadLengthMin"`
+	PayloadLengthMax int64  `yaml:"PayloadLengthMax"`
+	TCPHandshake     bool   `yaml:"TCPHandshake"`
+	// Injection name, identifying the injection in the applied bundles
+	Name string `json:",omitempty" yaml:"Name"`
 }
 
 // GetName returns the resource name
@@ -305,14 +610,677 @@ func (pi *PacketInjection) Validate() error {
 	if pi.Mode != "" && pi.Mode != PIModeUniqPerNode && pi.Mode != PIModeRandom {
 		return errors.New("given mode is not supported")
 	}
+
+	if pi.Rate != 0 && pi.Interval != 0 {
+		return errors.New("rate and interval can not be used together")
+	}
+
+	if pi.Duration != 0 && pi.Rate == 0 && pi.Interval == 0 {
+		return errors.New("a duration requires a rate or an interval")
+	}
+
+	if pi.PayloadLengthMin < 0 || pi.PayloadLengthMax < pi.PayloadLengthMin {
+		return errors.New("invalid payload length range")
+	}
+
+	if pi.TCPHandshake && pi.Type != PITypeTCP4 && pi.Type != PITypeTCP6 {
+		return errors.New("TCP handshake emulation requires a TCP packet type")
+	}
 	return nil
 }
 
+// PathCheck object
+//
+// Path checks periodically inject trace packets between two nodes
+// and report on which nodes of the path they were captured.
+//
+// easyjson:json
+// swagger:model PathCheck
+type PathCheck struct {
+	// swagger:allOf
+	BasicResource `yaml:",inline"`
+	// Path check name
+	Name string `json:",omitempty" yaml:"Name"`
+	// Path check description
+	Description string `json:",omitempty" yaml:"Description"`
+	// Gremlin expression of the source node
+	Src string `json:",omitempty" valid:"isGremlinExpr" yaml:"Src"`
+	// Gremlin expression of the destination node
+	Dst string `json:",omitempty" valid:"isGremlinExpr" yaml:"Dst"`
+	// Type of the trace packets, either icmp4 or icmp6
+	Type string `json:",omitempty" valid:"regexp=^(icmp4|icmp6)$" yaml:"Type"`
+	// Interval in seconds between two checks
+	Interval int64 `json:",omitempty" yaml:"Interval"`
+	// Action to execute when the path changes.
+	// Can be either an empty string or a URL
+	Action string `json:",omitempty" valid:"regexp=^(|http://|https://).*$" yaml:"Action"`
+	// Report of the last check
+	Report *PathCheckReport `json:",omitempty" yaml:"-"`
+}
+
+// GetName returns the resource name
+func (p *PathCheck) GetName() string {
+	return "PathCheck"
+}
+
+// Validate verifies the path check parameters
+func (p *PathCheck) Validate() error {
+	if p.Interval < 0 {
+		return errors.New("interval can not be negative")
+	}
+	return nil
+}
+
+// PathCheckReport describes the result of a path check
+// easyjson:json
+// swagger:model
+type PathCheckReport struct {
+	// Time of the check
+	Timestamp time.Time
+	// ICMP identifier used to mark the trace packets
+	Marker int64
+	// Whether the trace packets were captured on the destination node
+	Reachable bool
+	// Whether the captured path differs from the previous check
+	Changed bool
+	// Nodes of the path from the source to the destination
+	Hops []*PathCheckHop
+}
+
+// PathCheckHop describes a node of a checked path
+// easyjson:json
+// swagger:model
+type PathCheckHop struct {
+	// TID of the node
+	NodeTID string
+	// Name of the node
+	Name string `json:",omitempty"`
+	// Whether the trace packets were captured on this node
+	Captured bool
+	// Latency in milliseconds since the first capture of the trace packets
+	Latency int64
+}
+
+// TaggingRule object
+//
+// Tagging rules set tags and labels on the nodes and edges returned by
+// a Gremlin expression. The expression is evaluated on every graph update
+// and the tags and labels are removed from the elements that no longer match.
+//
+// easyjson:json
+// swagger:model
+type TaggingRule struct {
+	// swagger:allOf
+	BasicResource `yaml:",inline"`
+	// Tagging rule name
+	Name string `yaml:"Name"`
+	// Tagging rule description
+	Description string `yaml:"Description"`
+	// Gremlin expression of the nodes or edges to tag
+	Query string `valid:"isGremlinExpr" yaml:"Query"`
+	// Tags added to the Tags metadata of the elements
+	Tags []string `yaml:"Tags"`
+	// Labels added to the Labels metadata of the elements
+	Labels map[string]string `yaml:"Labels"`
+}
+
+// GetName returns the resource name
+func (t *TaggingRule) GetName() string {
+	return "TaggingRule"
+}
+
+// Validate verifies the tagging rule has an action
+func (t *TaggingRule) Validate() error {
+	if len(t.Tags) == 0 && len(t.Labels) == 0 {
+		return errors.New("Tags or Labels must be specified")
+	}
+	for _, tag := range t.Tags {
+		if tag == "" {
+			return errors.New("Tags can not be empty")
+		}
+	}
+	return nil
+}
+
+// SavedQueryParameter describes a $name parameter of a saved query
+// swagger:model
+type SavedQueryParameter struct {
+	// Parameter name, referenced as $name in the query
+	Name string `valid:"nonzero" yaml:"Name"`
+	// Parameter description
+	Description string `yaml:"Description"`
+	// Value used when the parameter is not given
+	Default interface{} `yaml:"Default"`
+}
+
+// SavedQuery object
+//
+// Saved queries are named Gremlin queries that can be shared between users
+// and executed by name with values for their parameters.
+//
+// easyjson:json
+// swagger:model
+type SavedQuery struct {
+	// swagger:allOf
+	BasicResource `yaml:",inline"`
+	// Saved query name
+	Name string `valid:"nonzero" yaml:"Name"`
+	// Saved query description
+	Description string `yaml:"Description"`
+	// Gremlin query, with $name parameters
+	Query string `valid:"nonzero" yaml:"Query"`
+	// Parameters of the query
+	Parameters []SavedQueryParameter `yaml:"Parameters"`
+}
+
+// GetName returns the resource name
+func (q *SavedQuery) GetName() string {
+	return "SavedQuery"
+}
+
+// Validate verifies the parameters of the saved query
+func (q *SavedQuery) Validate() error {
+	names := make(map[string]bool)
+	for _, param := range q.Parameters {
+		if !savedQueryParameterRegexp.MatchString(param.Name) {
+			return fmt.Errorf("Invalid parameter name '%s'", param.Name)
+		}
+		if names[param.Name] {
+			return fmt.Errorf("Parameter '%s' declared twice", param.Name)
+		}
+		names[param.Name] = true
+	}
+	return nil
+}
+
+// Bindings returns the values of the query parameters, the given values
+// overriding the defaults
+func (q *SavedQuery) Bindings(values map[string]interface{}) map[string]interface{} {
+	bindings := make(map[string]interface{})
+	for _, param := range q.Parameters {
+		if param.Default != nil {
+			bindings[param.Name] = param.Default
+		}
+	}
+	for name, value := range values {
+		bindings[name] = value
+	}
+	return bindings
+}
+
+var savedQueryParameterRegexp = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9_]*$")
+
+// SavedQueryCall describes the execution of a saved query
+// swagger:model
+type SavedQueryCall struct {
+	// Values of the query parameters
+	Bindings map[string]interface{}
+}
+
+// Webhook resources and events
+var (
+	WebhookResources = []string{"alert", "capture", "edgerule", "noderule"}
+	WebhookEvents    = []string{"created", "updated", "deleted"}
+)
+
+// Webhook object
+//
+// Webhooks subscribe a URL to the creation, the update and the deletion of
+// the captures, alerts, node rules and edge rules. A WebhookEvent is POSTed
+// to the URL for each change.
+//
+// easyjson:json
+// swagger:model
+type Webhook struct {
+	// swagger:allOf
+	BasicResource `yaml:",inline"`
+	// Webhook name
+	Name string `json:",omitempty" yaml:"Name"`
+	// Webhook description
+	Description string `json:",omitempty" yaml:"Description"`
+	// URL the events are POSTed to
+	URL string `valid:"regexp=^(http://|https://).+$" yaml:"URL"`
+	// Resources to watch: alert, capture, edgerule or noderule, all if empty
+	Resources []string `json:",omitempty" yaml:"Resources"`
+	// Events to send: created, updated or deleted, all if empty
+	Events []string `json:",omitempty" yaml:"Events"`
+	// Secret used to sign the events, the HMAC-SHA256 of the body being
+	// sent in the X-Skydive-Signature header
+	Secret string `json:",omitempty" yaml:"Secret"`
+}
+
+// GetName returns the resource name
+func (w *Webhook) GetName() string {
+	return "Webhook"
+}
+
+// Validate verifies the resources and the events of the webhook
+func (w *Webhook) Validate() error {
+	for _, resource := range w.Resources {
+		if !containsAny([]string{resource}, WebhookResources) {
+			return fmt.Errorf("Invalid resource '%s', must be one of %s", resource, strings.Join(WebhookResources, ", "))
+		}
+	}
+	for _, event := range w.Events {
+		if !containsAny([]string{event}, WebhookEvents) {
+			return fmt.Errorf("Invalid event '%s', must be one of %s", event, strings.Join(WebhookEvents, ", "))
+		}
+	}
+	return nil
+}
+
+// Match returns whether the webhook subscribed to an event on a resource
+func (w *Webhook) Match(resource, event string) bool {
+	return (len(w.Resources) == 0 || containsAny([]string{resource}, w.Resources)) &&
+		(len(w.Events) == 0 || containsAny([]string{event}, w.Events))
+}
+
+// WebhookEvent describes a change of a resource sent to a webhook
+// swagger:model
+type WebhookEvent struct {
+	// Unique identifier of the delivery
+	ID string
+	// ID of the webhook
+	Webhook string
+	// Time of the change
+	Timestamp time.Time
+	// Kind of the resource: alert, capture, edgerule or noderule
+	Resource string
+	// created, updated or deleted
+	Event string
+	// ID of the resource
+	ResourceID string
+	// Resource after the change, or before its deletion
+	Object interface{}
+}
+
+// APIToken object
+//
+// API tokens authenticate automation as a service account, bound to its
+// own roles, so that scripts don't have to embed the password of a user.
+// The token is only returned when created or rotated, the analyzers only
+// keeping its SHA-256 digest.
+//
+// easyjson:json
+// swagger:model
+type APIToken struct {
+	// swagger:allOf
+	BasicResource `yaml:",inline"`
+	// Name of the service account, unique
+	Name string `valid:"nonzero" yaml:"Name"`
+	// Token description
+	Description string `json:",omitempty" yaml:"Description"`
+	// Roles bound to the service account
+	Roles []string `yaml:"Roles"`
+	// Expiration time, the token never expires if not set
+	ExpiresAt *time.Time `json:",omitempty" yaml:"ExpiresAt"`
+	// Creation time
+	CreatedAt time.Time `yaml:"-"`
+	// Time of the last rotation
+	RotatedAt *time.Time `json:",omitempty" yaml:"-"`
+	// Time the token was last used, updated every minute at most
+	LastUsedAt *time.Time `json:",omitempty" yaml:"-"`
+	// Token to authenticate with, only returned when created or rotated
+	Token string `json:",omitempty" yaml:"-"`
+	// SHA-256 digest of the token
+	Digest string `json:",omitempty" yaml:"-"`
+}
+
+// GetName returns the resource name
+func (t *APIToken) GetName() string {
+	return "APIToken"
+}
+
+// Validate verifies the service account name and the roles of the token
+func (t *APIToken) Validate() error {
+	if !apiTokenNameRegexp.MatchString(t.Name) {
+		return fmt.Errorf("Invalid service account name '%s'", t.Name)
+	}
+	if len(t.Roles) == 0 {
+		return errors.New("At least one role has to be bound to the token")
+	}
+	return nil
+}
+
+// User returns the user the requests authenticated with the token are
+// made on behalf of
+func (t *APIToken) User() string {
+	return "serviceaccount:" + t.Name
+}
+
+// Expired returns whether the token expired at the given time
+func (t *APIToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+var apiTokenNameRegexp = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9_.-]*$")
+
+// Kinds of the audit records
+const (
+	// AuditMutation is an API call creating, changing or deleting an object
+	AuditMutation = "mutation"
+	// AuditRawPackets is a query accessing the captured packets
+	AuditRawPackets = "rawpackets"
+	// AuditRead is any other API call, recorded if the reads are audited
+	AuditRead = "read"
+)
+
+// AuditRecord describes an API call recorded in the audit trail
+// swagger:model
+type AuditRecord struct {
+	// Time of the call
+	Time time.Time
+	// Analyzer that served the call
+	Host string
+	// User who made the call
+	User string
+	// mutation, rawpackets or read
+	Kind string
+	// HTTP method, or GRPC
+	Method string
+	// Path of the HTTP request or gRPC method
+	Path string
+	// Address of the client
+	RemoteAddr string `json:",omitempty"`
+	// HTTP status or gRPC code of the response
+	Status int
+	// Body of the request, the secrets being masked
+	Payload string `json:",omitempty"`
+	// Whether the payload was truncated
+	Truncated bool `json:",omitempty"`
+}
+
+// AuditFilter selects audit records, the fields being optional
+type AuditFilter struct {
+	User  string
+	Kind  string
+	Since time.Time
+	Until time.Time
+	// Maximum number of records, the most recent ones being returned
+	Limit int
+}
+
+// Match returns whether a record is selected by the filter
+func (f *AuditFilter) Match(record *AuditRecord) bool {
+	return (f.User == "" || record.User == f.User) &&
+		(f.Kind == "" || record.Kind == f.Kind) &&
+		(f.Since.IsZero() || !record.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || record.Time.Before(f.Until))
+}
+
+// ApplyBundle describes the desired captures, alerts, rules and packet
+// injections, identified by their name. Only the kinds listed in the
+// bundle are pruned, an empty list pruning all the objects of its kind.
+// swagger:model
+type ApplyBundle struct {
+	Captures         []*Capture         `yaml:"Captures"`
+	Alerts           []*Alert           `yaml:"Alerts"`
+	NodeRules        []*NodeRule        `yaml:"NodeRules"`
+	EdgeRules        []*EdgeRule        `yaml:"EdgeRules"`
+	PacketInjections []*PacketInjection `yaml:"PacketInjections"`
+}
+
+// ApplyResources lists the resources of a bundle, in the order they are applied
+var ApplyResources = []string{"capture", "alert", "noderule", "edgerule", "injectpacket"}
+
+// Resources returns the objects of the kinds listed in the bundle, indexed
+// by resource name
+func (b *ApplyBundle) Resources() map[string][]Resource {
+	resources := make(map[string][]Resource)
+	if b.Captures != nil {
+		resources["capture"] = []Resource{}
+		for _, capture := range b.Captures {
+			resources["capture"] = append(resources["capture"], capture)
+		}
+	}
+	if b.Alerts != nil {
+		resources["alert"] = []Resource{}
+		for _, alert := range b.Alerts {
+			resources["alert"] = append(resources["alert"], alert)
+		}
+	}
+	if b.NodeRules != nil {
+		resources["noderule"] = []Resource{}
+		for _, rule := range b.NodeRules {
+			resources["noderule"] = append(resources["noderule"], rule)
+		}
+	}
+	if b.EdgeRules != nil {
+		resources["edgerule"] = []Resource{}
+		for _, rule := range b.EdgeRules {
+			resources["edgerule"] = append(resources["edgerule"], rule)
+		}
+	}
+	if b.PacketInjections != nil {
+		resources["injectpacket"] = []Resource{}
+		for _, injection := range b.PacketInjections {
+			resources["injectpacket"] = append(resources["injectpacket"], injection)
+		}
+	}
+	return resources
+}
+
+// ResourceName returns the name of a capture, an alert, a rule or a packet
+// injection
+func ResourceName(resource Resource) string {
+	switch r := resource.(type) {
+	case *Capture:
+		return r.Name
+	case *Alert:
+		return r.Name
+	case *NodeRule:
+		return r.Name
+	case *EdgeRule:
+		return r.Name
+	case *PacketInjection:
+		return r.Name
+	}
+	return ""
+}
+
+// Apply actions
+const (
+	ApplyCreate = "create"
+	ApplyUpdate = "update"
+	ApplyDelete = "delete"
+	ApplyNone   = "none"
+)
+
+// ApplyChange describes the change of an object made by an apply
+// swagger:model
+type ApplyChange struct {
+	// Resource name: capture, alert, noderule, edgerule or injectpacket
+	Resource string
+	// Name of the object
+	Name string
+	// create, update, delete or none
+	Action string
+	// ID of the object, the one of the new object for an update
+	ID string `json:",omitempty"`
+	// ID of the object replaced by an update
+	PreviousID string `json:",omitempty"`
+	// Fields changed by an update
+	Fields []string `json:",omitempty"`
+	// Error that occurred while applying the change
+	Error string `json:",omitempty"`
+}
+
+// ApplyResult describes the changes made, or to be made in dry-run mode,
+// by an apply
+// swagger:model
+type ApplyResult struct {
+	DryRun  bool
+	Changes []*ApplyChange
+}
+
+// ValidationIssue describes an error or a warning of a validation
+// swagger:model
+type ValidationIssue struct {
+	// Field of the resource the issue is about, empty for the resource itself
+	Field string `json:",omitempty"`
+	// Description of the issue
+	Message string
+}
+
+// ValidationReport describes the validation of a resource in dry-run mode,
+// its Gremlin expressions being checked against the live topology
+// swagger:model
+type ValidationReport struct {
+	// Whether the resource would be created
+	Valid bool
+	// Errors preventing the creation of the resource
+	Errors []ValidationIssue `json:",omitempty"`
+	// Warnings about the resource, ex: fields unknown in the topology
+	Warnings []ValidationIssue `json:",omitempty"`
+	// Number of nodes currently matched by the Gremlin expression of a capture
+	Matches int `json:",omitempty"`
+}
+
+// AddError adds an error about a field
+func (r *ValidationReport) AddError(field, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, ValidationIssue{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// AddWarning adds a warning about a field
+func (r *ValidationReport) AddWarning(field, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, ValidationIssue{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
 // TopologyParams topology query parameters
 // easyjson:json
 // swagger:model
 type TopologyParams struct {
 	GremlinQuery string `json:"GremlinQuery,omitempty" valid:"isGremlinExpr" yaml:"GremlinQuery"`
+	// Values of the $name parameters of the query
+	Bindings map[string]interface{} `json:"Bindings,omitempty" yaml:"Bindings"`
+	// swagger:allOf
+	Pagination `yaml:",inline"`
+}
+
+// Pagination describes the sorting, the page and the fields of the items of
+// a list result. The total number of items is returned in the X-Total-Count
+// header of the response.
+// swagger:model
+type Pagination struct {
+	// Maximum number of items returned, 0: no limit
+	Limit int `json:"Limit,omitempty" valid:"min=0" yaml:"Limit"`
+	// Number of items skipped
+	Offset int `json:"Offset,omitempty" valid:"min=0" yaml:"Offset"`
+	// Field the items are sorted by, named as with the Sort step, ex: Name, Metric.ABBytes
+	SortBy string `json:"SortBy,omitempty" yaml:"SortBy"`
+	// Sort order, ASC (default) or DESC
+	SortOrder string `json:"SortOrder,omitempty" valid:"regexp=^(ASC|DESC|)$" yaml:"SortOrder"`
+	// JSON fields of the items to return, ex: ID, Metadata.Name, Network.A
+	Fields []string `json:"Fields,omitempty" yaml:"Fields"`
+}
+
+// IsSet returns whether a pagination, a sort or a projection is requested
+func (p *Pagination) IsSet() bool {
+	return p.Limit != 0 || p.Offset != 0 || p.SortBy != "" || len(p.Fields) != 0
+}
+
+// Job states
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// Job describes a topology or flow query run asynchronously. The result of
+// the query can be downloaded once the job is completed, until it expires.
+// swagger:model
+type Job struct {
+	ID string
+	// Query of the job, with its bindings and pagination
+	Query TopologyParams
+	// pending, running, completed or failed
+	State string
+	// User that submitted the job
+	User string `json:",omitempty"`
+	// Error of a failed job
+	Error string `json:",omitempty"`
+	// Size in bytes of the result
+	ResultSize int `json:",omitempty"`
+	// Number of items of a paginated result
+	Total int `json:",omitempty"`
+	// Time of the submission of the job
+	CreatedAt   time.Time
+	StartedAt   *time.Time `json:",omitempty"`
+	CompletedAt *time.Time `json:",omitempty"`
+	// Time at which the job and its result are removed
+	ExpiresAt *time.Time `json:",omitempty"`
+}
+
+// GraphQLParams GraphQL request, as sent by the GraphQL clients
+// swagger:model
+type GraphQLParams struct {
+	// GraphQL query
+	Query string `json:"query" yaml:"query"`
+	// Operation to execute when the query holds several ones
+	OperationName string `json:"operationName,omitempty" yaml:"operationName"`
+	// Values of the variables of the query
+	Variables map[string]interface{} `json:"variables,omitempty" yaml:"variables"`
+}
+
+// SQLParams SQL query parameters
+// swagger:model
+type SQLParams struct {
+	// SELECT statement on the flows table
+	Query string `json:"Query" yaml:"Query"`
+	// Time context of the query, as accepted by the Gremlin Context step
+	At string `json:"At,omitempty" yaml:"At"`
+	// Duration of the time context
+	Duration string `json:"Duration,omitempty" yaml:"Duration"`
+}
+
+// SQLResult result of a SQL query, one row per flow
+// swagger:model
+type SQLResult struct {
+	Columns []string        `json:"Columns"`
+	Rows    [][]interface{} `json:"Rows"`
+}
+
+// TopologyDiffParams topology diff parameters
+// swagger:model
+type TopologyDiffParams struct {
+	// Start of the comparison, in milliseconds
+	From int64 `valid:"nonzero"`
+	// End of the comparison in milliseconds, now if not specified
+	To int64
+	// Metadata the nodes have to match, e.g. {"Host": "node1"}
+	Filter map[string]interface{}
+	// Metadata keys whose changes are not reported, in addition to the metrics
+	Ignore []string
+}
+
+// TopologySnapshot describes a dump of the whole topology that can be
+// restored into another instance
+// swagger:model
+type TopologySnapshot struct {
+	// Snapshot format version
+	Version int
+	// Host that produced the snapshot
+	Host string
+	// Snapshot creation time in milliseconds
+	CreatedAt int64
+	// Nodes of the live topology
+	Nodes []*graph.Node
+	// Edges of the live topology
+	Edges []*graph.Edge
+	// All the revisions of the elements, only when requested
+	History *graph.Elements `json:",omitempty"`
+}
+
+// TopologyRestoreReport describes the outcome of a snapshot restoration
+// swagger:model
+type TopologyRestoreReport struct {
+	// Number of nodes restored
+	Nodes int
+	// Number of edges restored
+	Edges int
+	// Number of elements that could not be restored
+	Skipped int
 }
 
 // WorkflowChoice describes one value within a choice
@@ -0,0 +1,42 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package types
+
+import "testing"
+
+func TestPacketInjectionValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		pi    PacketInjection
+		valid bool
+	}{
+		{"count", PacketInjection{Type: PITypeICMP4, Count: 5}, true},
+		{"duration with rate", PacketInjection{Type: PITypeUDP4, Duration: 10, Rate: 100}, true},
+		{"duration with interval", PacketInjection{Type: PITypeUDP4, Duration: 10, Interval: 100}, true},
+		{"duration alone", PacketInjection{Type: PITypeUDP4, Duration: 10}, false},
+		{"rate and interval", PacketInjection{Type: PITypeUDP4, Rate: 100, Interval: 100}, false},
+		{"handshake", PacketInjection{Type: PITypeTCP6, TCPHandshake: true}, true},
+		{"handshake without TCP", PacketInjection{Type: PITypeUDP4, TCPHandshake: true}, false},
+	}
+
+	for _, test := range tests {
+		if err := test.pi.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: expected valid=%v, got error %v", test.name, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/logging"
+)
+
+const auditDir = "/audit"
+
+// the records are grouped in directories per hour, so that searches only
+// read the periods they select and that whole periods expire at once
+const (
+	bucketPeriod = time.Hour
+	bucketFormat = "2006010215"
+)
+
+// value replacing the secrets found in the payloads
+const maskedValue = "*****"
+
+// keys of the payloads holding secrets, compared case insensitively
+var secretKeys = map[string]bool{
+	"password": true,
+	"secret":   true,
+	"token":    true,
+}
+
+var rawPacketsRegexp = regexp.MustCompile(`(?i)\brawpackets\s*\(`)
+
+// IsRawPacketQuery returns whether a Gremlin query accesses the captured
+// packets
+func IsRawPacketQuery(query string) bool {
+	return rawPacketsRegexp.MatchString(query)
+}
+
+// Auditor records the mutating API calls, the queries accessing the
+// captured packets and optionally the other reads. The records are kept in
+// etcd until they expire.
+type Auditor struct {
+	sync.Mutex
+	kapi       etcd.KeysAPI
+	host       string
+	ttl        time.Duration
+	maxPayload int
+	reads      bool
+	bucket     string
+}
+
+func bucketKey(t time.Time) string {
+	return auditDir + "/" + t.UTC().Format(bucketFormat)
+}
+
+func maskSecrets(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for k, v := range value {
+			if secretKeys[strings.ToLower(k)] {
+				if s, ok := v.(string); !ok || s != "" {
+					value[k] = maskedValue
+				}
+			} else {
+				value[k] = maskSecrets(v)
+			}
+		}
+	case []interface{}:
+		for i, v := range value {
+			value[i] = maskSecrets(v)
+		}
+	}
+	return value
+}
+
+// Payload returns the payload to record for a request body, its secrets
+// being masked, and whether it was truncated
+func (a *Auditor) Payload(body []byte) (string, bool) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err == nil {
+		if masked, err := json.Marshal(maskSecrets(value)); err == nil {
+			body = masked
+		}
+	}
+
+	if len(body) > a.maxPayload {
+		return string(body[:a.maxPayload]), true
+	}
+	return string(body), false
+}
+
+// RecordReads returns whether the reads not accessing the captured packets
+// are recorded
+func (a *Auditor) RecordReads() bool {
+	return a.reads
+}
+
+// Record adds a record to the audit trail
+func (a *Auditor) Record(record *types.AuditRecord) error {
+	record.Host = a.host
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+
+	logging.GetLogger().Infof("Audit: %s %s %s by %s, status %d", record.Kind, record.Method, record.Path, record.User, record.Status)
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	bucket := bucketKey(record.Time)
+	if err := a.createBucket(bucket); err != nil {
+		return err
+	}
+
+	_, err = a.kapi.CreateInOrder(context.Background(), bucket, string(data), &etcd.CreateInOrderOptions{TTL: a.ttl})
+	return err
+}
+
+// createBucket creates the directory of a period, expiring with the last
+// records it may hold. The directory may have been created by another
+// analyzer already.
+func (a *Auditor) createBucket(bucket string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.bucket == bucket {
+		return nil
+	}
+
+	opts := &etcd.SetOptions{Dir: true, TTL: a.ttl + bucketPeriod, PrevExist: etcd.PrevNoExist}
+	if _, err := a.kapi.Set(context.Background(), bucket, "", opts); err != nil {
+		if err, ok := err.(etcd.Error); !ok || err.Code != etcd.ErrorCodeNodeExist {
+			return err
+		}
+	}
+	a.bucket = bucket
+
+	return nil
+}
+
+// buckets returns the start time of the periods overlapping the filter,
+// the most recent first
+func (a *Auditor) buckets(filter *types.AuditFilter) ([]time.Time, error) {
+	resp, err := a.kapi.Get(context.Background(), auditDir, &etcd.GetOptions{Sort: true})
+	if err != nil {
+		if etcd.IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var buckets []time.Time
+	for _, node := range resp.Node.Nodes {
+		if !node.Dir {
+			continue
+		}
+
+		start, err := time.ParseInLocation(bucketFormat, strings.TrimPrefix(node.Key, auditDir+"/"), time.UTC)
+		if err != nil {
+			logging.GetLogger().Warningf("Invalid audit directory %s", node.Key)
+			continue
+		}
+
+		if !filter.Since.IsZero() && !start.Add(bucketPeriod).After(filter.Since) {
+			continue
+		}
+		if !filter.Until.IsZero() && !start.Before(filter.Until) {
+			continue
+		}
+		buckets = append(buckets, start)
+	}
+
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].After(buckets[j]) })
+
+	return buckets, nil
+}
+
+// bucketRecords returns the records of a period selected by a filter, the
+// oldest first
+func (a *Auditor) bucketRecords(start time.Time, filter *types.AuditFilter) ([]*types.AuditRecord, error) {
+	resp, err := a.kapi.Get(context.Background(), bucketKey(start), &etcd.GetOptions{Sort: true})
+	if err != nil {
+		if etcd.IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var records []*types.AuditRecord
+	for _, node := range resp.Node.Nodes {
+		var record types.AuditRecord
+		if err := json.Unmarshal([]byte(node.Value), &record); err != nil {
+			logging.GetLogger().Warningf("Invalid audit record %s: %s", node.Key, err)
+			continue
+		}
+
+		if filter.Match(&record) {
+			records = append(records, &record)
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+
+	return records, nil
+}
+
+// Search returns the records selected by a filter, the oldest first. The
+// periods are read from the most recent one, until the limit of the filter
+// is reached.
+func (a *Auditor) Search(filter *types.AuditFilter) ([]*types.AuditRecord, error) {
+	buckets, err := a.buckets(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []*types.AuditRecord{}
+	for _, start := range buckets {
+		bucketRecords, err := a.bucketRecords(start, filter)
+		if err != nil {
+			return nil, err
+		}
+		records = append(bucketRecords, records...)
+
+		if filter.Limit > 0 && len(records) >= filter.Limit {
+			records = records[len(records)-filter.Limit:]
+			break
+		}
+	}
+
+	return records, nil
+}
+
+// NewAuditor returns an auditor keeping the records for the given
+// retention delay, the payloads being truncated to maxPayload bytes. The
+// reads not accessing the captured packets are recorded if reads is set.
+func NewAuditor(kapi etcd.KeysAPI, host string, ttl time.Duration, maxPayload int, reads bool) *Auditor {
+	return &Auditor{
+		kapi:       kapi,
+		host:       host,
+		ttl:        ttl,
+		maxPayload: maxPayload,
+		reads:      reads,
+	}
+}
@@ -0,0 +1,290 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+	etcd "github.com/coreos/etcd/client"
+	"github.com/gorilla/mux"
+
+	"github.com/skydive-project/skydive/api/types"
+	shttp "github.com/skydive-project/skydive/http"
+)
+
+type fakeKeysAPI struct {
+	etcd.KeysAPI
+	dirs   map[string][]string
+	values []string
+	gets   int
+}
+
+func (k *fakeKeysAPI) Set(ctx context.Context, key, value string, opts *etcd.SetOptions) (*etcd.Response, error) {
+	if k.dirs == nil {
+		k.dirs = make(map[string][]string)
+	}
+	if _, ok := k.dirs[key]; ok {
+		return nil, etcd.Error{Code: etcd.ErrorCodeNodeExist}
+	}
+	k.dirs[key] = nil
+	return &etcd.Response{}, nil
+}
+
+func (k *fakeKeysAPI) CreateInOrder(ctx context.Context, dir, value string, opts *etcd.CreateInOrderOptions) (*etcd.Response, error) {
+	if _, ok := k.dirs[dir]; !ok {
+		return nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound}
+	}
+	k.dirs[dir] = append(k.dirs[dir], value)
+	k.values = append(k.values, value)
+	return &etcd.Response{}, nil
+}
+
+func (k *fakeKeysAPI) Get(ctx context.Context, key string, opts *etcd.GetOptions) (*etcd.Response, error) {
+	k.gets++
+
+	node := &etcd.Node{Key: key, Dir: true}
+	if key == auditDir {
+		for dir := range k.dirs {
+			node.Nodes = append(node.Nodes, &etcd.Node{Key: dir, Dir: true})
+		}
+		sort.Slice(node.Nodes, func(i, j int) bool { return node.Nodes[i].Key < node.Nodes[j].Key })
+	} else if values, ok := k.dirs[key]; ok {
+		for i, value := range values {
+			node.Nodes = append(node.Nodes, &etcd.Node{Key: fmt.Sprintf("%s/%020d", key, i), Value: value})
+		}
+	} else {
+		return nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound}
+	}
+
+	return &etcd.Response{Node: node}, nil
+}
+
+func (k *fakeKeysAPI) records(t *testing.T) []*types.AuditRecord {
+	var records []*types.AuditRecord
+	for _, value := range k.values {
+		var record types.AuditRecord
+		if err := json.Unmarshal([]byte(value), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, &record)
+	}
+	k.values = nil
+	return records
+}
+
+func newRouter(auditor *Auditor) *mux.Router {
+	backend := auditor.Wrap(shttp.NewNoAuthenticationBackend())
+
+	// as the API handlers, mark the request once the decoded query is known
+	// to return raw packets
+	handler := func(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		var params struct{ GremlinQuery string }
+		json.Unmarshal(body, &params)
+		if strings.HasSuffix(r.URL.Path, "/execute") || IsRawPacketQuery(params.GremlinQuery) {
+			MarkRawPacketAccess(&r.Request)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}
+
+	router := mux.NewRouter()
+	router.Methods("GET").Path("/api/capture").Name("CaptureIndex").Handler(backend.Wrap(handler))
+	router.Methods("GET").Path("/api/topology").Name("TopologyGet").Handler(backend.Wrap(handler))
+	router.Methods("POST").Path("/api/ids/suricata").Name("IDSSuricata").Handler(backend.Wrap(handler))
+	router.Methods("POST").Path("/api/capture").Name("CaptureInsert").Handler(backend.Wrap(handler))
+	router.Methods("POST").Path("/api/topology").Name("TopologiesSearch").Handler(backend.Wrap(handler))
+	router.Methods("POST").Path("/api/savedquery/{ID}/execute").Name("SavedQueryExecute").Handler(backend.Wrap(handler))
+	return router
+}
+
+func TestAuditHandler(t *testing.T) {
+	kapi := &fakeKeysAPI{}
+	router := newRouter(NewAuditor(kapi, "analyzer1", time.Hour, 1024, false))
+
+	request := func(method, path, body string) string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return w.Body.String()
+	}
+
+	capture := `{"GremlinQuery":"G.V()","Secret":"s3cr3t"}`
+	if body := request("POST", "/api/capture", capture); body != capture {
+		t.Errorf("The handler should get the whole body, got %s", body)
+	}
+
+	records := kapi.records(t)
+	if len(records) != 1 {
+		t.Fatalf("Expected one record, got %d", len(records))
+	}
+	record := records[0]
+	if record.Kind != types.AuditMutation || record.User != "admin" || record.Host != "analyzer1" || record.Status != http.StatusCreated {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+	if strings.Contains(record.Payload, "s3cr3t") || !strings.Contains(record.Payload, maskedValue) {
+		t.Errorf("The secret should be masked, got %s", record.Payload)
+	}
+
+	request("GET", "/api/capture", "")
+	request("POST", "/api/capture?dry_run=true", capture)
+	request("POST", "/api/topology", `{"GremlinQuery":"G.V().Flows()"}`)
+	if records := kapi.records(t); len(records) != 0 {
+		t.Errorf("Reads, dry runs and queries should not be recorded, got %+v", records[0])
+	}
+
+	request("POST", "/api/topology", `{"GremlinQuery":"G.V().Flows().rawpackets ()"}`)
+	request("POST", "/api/savedquery/packets/execute", "")
+	request("POST", "/api/topology", `{"GremlinQuery":"G.V().Flows().\u0052awPackets()"}`)
+	request("POST", "/api/topology", `{"Padding":"`+strings.Repeat("x", 2048)+`","GremlinQuery":"G.V().Flows().RawPackets()"}`)
+	records = kapi.records(t)
+	if len(records) != 4 {
+		t.Fatalf("Raw packet queries should be recorded, got %d records", len(records))
+	}
+	for _, record := range records {
+		if record.Kind != types.AuditRawPackets {
+			t.Errorf("Expected a raw packet record, got %+v", record)
+		}
+	}
+}
+
+func TestAuditReads(t *testing.T) {
+	kapi := &fakeKeysAPI{}
+	router := newRouter(NewAuditor(kapi, "analyzer1", time.Hour, 1024, true))
+
+	request := func(method, path, body string) {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+	}
+
+	request("GET", "/api/capture", "")
+	request("POST", "/api/topology", `{"GremlinQuery":"G.V()"}`)
+	request("POST", "/api/capture?dry_run=true", `{"GremlinQuery":"G.V()"}`)
+	request("POST", "/api/topology", `{"GremlinQuery":"G.V().Flows().RawPackets()"}`)
+	request("POST", "/api/ids/suricata", `{"event_type":"alert"}`)
+	request("OPTIONS", "/api/capture", "")
+
+	records := kapi.records(t)
+	expected := []string{types.AuditRead, types.AuditRead, types.AuditRead, types.AuditRawPackets}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records, got %d", len(expected), len(records))
+	}
+	for i, record := range records {
+		if record.Kind != expected[i] {
+			t.Errorf("Expected a %s record for %s %s, got %s", expected[i], record.Method, record.Path, record.Kind)
+		}
+	}
+	if records[0].Method != "GET" || records[0].Path != "/api/capture" || records[0].User != "admin" {
+		t.Errorf("Unexpected record: %+v", records[0])
+	}
+}
+
+func TestAuditSearch(t *testing.T) {
+	kapi := &fakeKeysAPI{}
+	auditor := NewAuditor(kapi, "analyzer1", time.Hour, 1024, false)
+
+	start := time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		user := "admin"
+		if i%2 == 1 {
+			user = "guest"
+		}
+		record := &types.AuditRecord{Time: start.Add(time.Duration(i) * 30 * time.Minute), User: user, Kind: types.AuditMutation}
+		if err := auditor.Record(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(kapi.dirs) != 3 {
+		t.Fatalf("The records should be grouped per hour, got %d directories", len(kapi.dirs))
+	}
+	if _, ok := kapi.dirs["/audit/2019050111"]; !ok {
+		t.Errorf("Expected a directory per hour, got %v", kapi.dirs)
+	}
+
+	search := func(filter *types.AuditFilter) []int {
+		records, err := auditor.Search(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var minutes []int
+		for _, record := range records {
+			minutes = append(minutes, int(record.Time.Sub(start)/time.Minute))
+		}
+		return minutes
+	}
+
+	if minutes := search(&types.AuditFilter{}); fmt.Sprint(minutes) != "[0 30 60 90 120 150]" {
+		t.Errorf("Expected all the records, the oldest first, got %v", minutes)
+	}
+
+	if minutes := search(&types.AuditFilter{User: "guest"}); fmt.Sprint(minutes) != "[30 90 150]" {
+		t.Errorf("Expected the records of guest, got %v", minutes)
+	}
+
+	kapi.gets = 0
+	if minutes := search(&types.AuditFilter{Limit: 2}); fmt.Sprint(minutes) != "[120 150]" {
+		t.Errorf("Expected the 2 most recent records, got %v", minutes)
+	}
+	if kapi.gets != 2 {
+		t.Errorf("Only the last hour should be read, got %d reads", kapi.gets)
+	}
+
+	kapi.gets = 0
+	filter := &types.AuditFilter{Since: start.Add(70 * time.Minute), Until: start.Add(120 * time.Minute)}
+	if minutes := search(filter); fmt.Sprint(minutes) != "[90]" {
+		t.Errorf("Expected the records of the period, got %v", minutes)
+	}
+	if kapi.gets != 2 {
+		t.Errorf("Only the hours of the period should be read, got %d reads", kapi.gets)
+	}
+
+	// pages fetched with until set to the oldest record of the previous page
+	if minutes := search(&types.AuditFilter{Until: start.Add(120 * time.Minute), Limit: 3}); fmt.Sprint(minutes) != "[30 60 90]" {
+		t.Errorf("Expected the previous page, got %v", minutes)
+	}
+}
+
+func TestAuditPayload(t *testing.T) {
+	auditor := NewAuditor(&fakeKeysAPI{}, "analyzer1", time.Hour, 16, false)
+
+	payload, truncated := auditor.Payload([]byte(`{"Users":[{"Name":"ci","Password":"pass"}]}`))
+	if !truncated || len(payload) != 16 {
+		t.Errorf("The payload should be truncated, got %s", payload)
+	}
+
+	auditor.maxPayload = 1024
+	payload, truncated = auditor.Payload([]byte(`{"Users":[{"Name":"ci","Password":"pass"}]}`))
+	if truncated || payload != `{"Users":[{"Name":"ci","Password":"*****"}]}` {
+		t.Errorf("The password should be masked, got %s", payload)
+	}
+
+	if payload, _ := auditor.Payload([]byte("Name: ci")); payload != "Name: ci" {
+		t.Errorf("Non JSON payloads should be kept as is, got %s", payload)
+	}
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+	gcontext "github.com/gorilla/context"
+	"github.com/gorilla/mux"
+
+	"github.com/skydive-project/skydive/api/types"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+)
+
+type rawPacketsKey struct{}
+
+// routes that are recorded as reads even if not using the GET method
+var queryRoutes = map[string]bool{
+	"AlertBacktest":           true,
+	"FederatedTopologySearch": true,
+	"GraphQLQuery":            true,
+	"JobSubmit":               true,
+	"JobDelete":               true,
+	"SavedQueryExecute":       true,
+	"SQLQuery":                true,
+	"TopologiesSearch":        true,
+	"TopologyDiff":            true,
+}
+
+// routes that are never recorded, the IDS events being pushed by the
+// sensors
+var unauditedRoutes = map[string]bool{
+	"IDSSuricata": true,
+}
+
+// MarkRawPacketAccess flags a request as accessing the captured packets.
+// The handlers mark the request once the result of a query is known to be
+// raw packets, the payload being never inspected by the auditor.
+func MarkRawPacketAccess(r *http.Request) {
+	gcontext.Set(r, rawPacketsKey{}, true)
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// readBody returns the beginning of the body of a request, leaving the
+// body untouched for the handler
+func (a *Auditor) readBody(r *http.Request) []byte {
+	if r.Body == nil {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, int64(a.maxPayload)+1))
+	if err != nil {
+		logging.GetLogger().Warningf("Unable to read the body of %s %s for the audit trail: %s", r.Method, r.URL.Path, err)
+	}
+	r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+
+	return body
+}
+
+func (a *Auditor) handler(wrapped auth.AuthenticatedHandlerFunc) auth.AuthenticatedHandlerFunc {
+	return func(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+		if r.Method == "OPTIONS" || !strings.HasPrefix(r.URL.Path, "/api/") {
+			wrapped(w, r)
+			return
+		}
+
+		var routeName string
+		if route := mux.CurrentRoute(&r.Request); route != nil {
+			routeName = route.GetName()
+		}
+		if unauditedRoutes[routeName] {
+			wrapped(w, r)
+			return
+		}
+
+		var kind string
+		switch {
+		case r.Method == "GET" || r.Method == "HEAD":
+		case queryRoutes[routeName]:
+		case r.URL.Query().Get("dry_run") == "true":
+		default:
+			kind = types.AuditMutation
+		}
+
+		now := time.Now().UTC()
+		body := a.readBody(&r.Request)
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		wrapped(sw, r)
+
+		if kind == "" {
+			if gcontext.Get(&r.Request, rawPacketsKey{}) != nil {
+				kind = types.AuditRawPackets
+			} else if a.reads {
+				kind = types.AuditRead
+			} else {
+				return
+			}
+		}
+
+		record := &types.AuditRecord{
+			Time:       now,
+			User:       r.Username,
+			Kind:       kind,
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			RemoteAddr: r.RemoteAddr,
+			Status:     sw.status,
+		}
+		record.Payload, record.Truncated = a.Payload(body)
+
+		if err := a.Record(record); err != nil {
+			logging.GetLogger().Errorf("Unable to record %s %s in the audit trail: %s", r.Method, r.URL.Path, err)
+		}
+	}
+}
+
+type authenticationBackend struct {
+	shttp.AuthenticationBackend
+	auditor *Auditor
+}
+
+// Wrap an HTTP handler with authentication, the calls being recorded once
+// authenticated
+func (b *authenticationBackend) Wrap(wrapped auth.AuthenticatedHandlerFunc) http.HandlerFunc {
+	return b.AuthenticationBackend.Wrap(b.auditor.handler(wrapped))
+}
+
+// Wrap returns an authentication backend recording the API calls
+// authenticated by the given backend
+func (a *Auditor) Wrap(backend shttp.AuthenticationBackend) shttp.AuthenticationBackend {
+	return &authenticationBackend{AuthenticationBackend: backend, auditor: a}
+}
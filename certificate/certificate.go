@@ -0,0 +1,223 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package certificate provides the certificates used by the TLS connections
+// and keeps them up to date when they are rotated.
+package certificate
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+// ErrNoCertificate is returned when the source has no certificate yet
+var ErrNoCertificate = errors.New("No certificate available")
+
+// ErrNoServerName is returned when the host name of a server can't be
+// verified, the client configuration not being bound to a server name
+var ErrNoServerName = errors.New("No server name to verify")
+
+// client configurations built by ClientConfig, indexed by configuration,
+// so that their copies for a server verify its name
+var clientSources sync.Map
+
+type clientSource struct {
+	src  Source
+	opts Opts
+}
+
+// Source provides the certificate of the local service and the pool of
+// the certificate authorities used to verify the peers. Both may change
+// over time, the TLS configurations built on a source always use the
+// latest ones.
+type Source interface {
+	Certificate() (*tls.Certificate, error)
+	Roots() *x509.CertPool
+	Stop()
+}
+
+// Opts describes how the peers are authenticated
+type Opts struct {
+	// RequireClientCert makes the servers reject the clients without a valid certificate
+	RequireClientCert bool
+	// TrustDomain, when set, authenticates the peers by their SPIFFE ID
+	// instead of their host name
+	TrustDomain string
+}
+
+// ServerConfig returns a TLS server configuration using the certificate
+// and the authorities of the source at the time of each handshake
+func ServerConfig(src Source, opts Opts) *tls.Config {
+	cfg := &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return src.Certificate()
+		},
+	}
+	common.SetupTLSServerParams(cfg)
+
+	if opts.RequireClientCert {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if opts.TrustDomain != "" {
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			if len(verifiedChains) == 0 {
+				return nil
+			}
+			return verifyTrustDomain(verifiedChains[0][0], opts.TrustDomain)
+		}
+	}
+
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := cfg.Clone()
+		c.GetConfigForClient = nil
+		c.ClientCAs = src.Roots()
+		return c, nil
+	}
+
+	return cfg
+}
+
+// verifier returns the function checking the chain of a server against
+// the current authorities of the source. With a trust domain, the SPIFFE ID
+// of the server is checked, otherwise its host name is compared to the
+// server name of the given configuration.
+func (c *clientSource) verifier(cfg *tls.Config) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return ErrNoCertificate
+		}
+
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		verifyOpts := x509.VerifyOptions{
+			Roots:         c.src.Roots(),
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		if c.opts.TrustDomain == "" {
+			if cfg.ServerName == "" {
+				return ErrNoServerName
+			}
+			verifyOpts.DNSName = cfg.ServerName
+		}
+
+		if _, err := certs[0].Verify(verifyOpts); err != nil {
+			return err
+		}
+
+		if c.opts.TrustDomain != "" {
+			return verifyTrustDomain(certs[0], c.opts.TrustDomain)
+		}
+		return nil
+	}
+}
+
+// ClientConfig returns a TLS client configuration presenting the current
+// certificate of the source. The server chain is verified against the
+// current authorities of the source. With a trust domain its SPIFFE ID is
+// checked, otherwise its host name, the configuration having to be bound
+// to the server with ServerName or WithServerName.
+func ClientConfig(src Source, opts Opts) *tls.Config {
+	cfg := &tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return src.Certificate()
+		},
+	}
+
+	// the standard verification would use the authorities of the source
+	// at the time the configuration is built
+	c := &clientSource{src: src, opts: opts}
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyPeerCertificate = c.verifier(cfg)
+	clientSources.Store(cfg, c)
+
+	return cfg
+}
+
+// WithServerName returns a copy of a client configuration for the given
+// server, its server name being set if not already. The TLS dialers use it
+// so that the configurations built by ClientConfig verify the server they
+// connect to.
+func WithServerName(cfg *tls.Config, serverName string) *tls.Config {
+	if cfg == nil {
+		return nil
+	}
+
+	c := cfg.Clone()
+	if c.ServerName == "" {
+		c.ServerName = serverName
+	}
+	if src, ok := clientSources.Load(cfg); ok {
+		c.VerifyPeerCertificate = src.(*clientSource).verifier(c)
+	}
+	return c
+}
+
+// DialTLS returns a function dialing TLS connections with a copy of the
+// client configuration for each server, to be used by the HTTP transports
+func DialTLS(dialer *net.Dialer, cfg *tls.Config) func(network, addr string) (net.Conn, error) {
+	return func(network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		return tls.DialWithDialer(dialer, network, addr, WithServerName(cfg, host))
+	}
+}
+
+// SpiffeID returns the SPIFFE ID of a certificate, found in its URI SANs
+func SpiffeID(cert *x509.Certificate) (*url.URL, error) {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri, nil
+		}
+	}
+	return nil, fmt.Errorf("No SPIFFE ID in certificate '%s'", cert.Subject)
+}
+
+func verifyTrustDomain(cert *x509.Certificate, trustDomain string) error {
+	id, err := SpiffeID(cert)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(id.Host, trustDomain) {
+		return fmt.Errorf("SPIFFE ID '%s' is not part of the trust domain '%s'", id, trustDomain)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package certificate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClientConfigRotatedAuthority(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skydive-certificate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	ca, caKey := generateCertificate(t, "ca", nil, nil)
+	writeCertificate(t, dir, "ca", ca, nil)
+	server, serverKey := generateCertificate(t, "server", ca, caKey)
+	writeCertificate(t, dir, "server", server, serverKey)
+	client, clientKey := generateCertificate(t, "client", ca, caKey)
+	writeCertificate(t, dir, "client", client, clientKey)
+
+	clientSource, err := NewFileSource(path("client.crt"), path("client.key"), path("ca.crt"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientSource.Stop()
+
+	clientConfig := WithServerName(ClientConfig(clientSource, Opts{}), "127.0.0.1")
+
+	serverSource, err := NewFileSource(path("server.crt"), path("server.key"), path("ca.crt"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handshake(ServerConfig(serverSource, Opts{}), clientConfig); err != nil {
+		t.Fatalf("Handshake failed: %s", err)
+	}
+
+	// the server moves to a new authority, trusted by the client once its
+	// authority file is rotated
+	newCA, newCAKey := generateCertificate(t, "newca", nil, nil)
+	newServer, newServerKey := generateCertificate(t, "server", newCA, newCAKey)
+	writeCertificate(t, dir, "newserver", newServer, newServerKey)
+	writeCertificate(t, dir, "clientca", ca, nil)
+
+	newServerSource, err := NewFileSource(path("newserver.crt"), path("newserver.key"), path("clientca.crt"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newServerConfig := ServerConfig(newServerSource, Opts{})
+
+	if err := handshake(newServerConfig, clientConfig); err == nil {
+		t.Fatal("Handshake should fail with a server from an unknown authority")
+	}
+
+	writeCertificate(t, dir, "ca", newCA, nil)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path("ca.crt"), later, later)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := handshake(newServerConfig, clientConfig)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Rotated authority not used: %s", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientConfigServerName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skydive-certificate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	ca, caKey := generateCertificate(t, "ca", nil, nil)
+	writeCertificate(t, dir, "ca", ca, nil)
+	server, serverKey := generateCertificate(t, "server", ca, caKey)
+	writeCertificate(t, dir, "server", server, serverKey)
+
+	src, err := NewFileSource(path("server.crt"), path("server.key"), path("ca.crt"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := ServerConfig(src, Opts{})
+	clientConfig := ClientConfig(src, Opts{})
+
+	if err := handshake(serverConfig, clientConfig); err == nil {
+		t.Error("Handshake should fail without server name to verify")
+	}
+
+	if err := handshake(serverConfig, WithServerName(clientConfig, "skydive.example.org")); err == nil {
+		t.Error("Handshake should fail with a server name not matching the certificate")
+	}
+
+	if err := handshake(serverConfig, WithServerName(clientConfig, "127.0.0.1")); err != nil {
+		t.Errorf("Handshake failed: %s", err)
+	}
+
+	// copies not made by WithServerName verify the name of the original
+	if err := handshake(serverConfig, clientConfig.Clone()); err == nil {
+		t.Error("Handshake should fail with a copy of a configuration without server name")
+	}
+}
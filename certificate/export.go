@@ -0,0 +1,142 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package certificate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/logging"
+)
+
+// PEMSource is a source able to encode its certificate, its key and its
+// authorities in PEM, for the components only reading files
+type PEMSource interface {
+	Source
+	PEM() (cert, key, ca []byte, err error)
+}
+
+// FileExport writes the certificate, the key and the authorities of a
+// source to PEM files, rewritten when they change. The embedded etcd
+// loads them on each handshake.
+type FileExport struct {
+	src      PEMSource
+	CertFile string
+	KeyFile  string
+	CAFile   string
+	cert     []byte
+	ca       []byte
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// writeFile replaces a file by renaming a temporary one, so that it is
+// never read half written
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (e *FileExport) write() (bool, error) {
+	cert, key, ca, err := e.src.PEM()
+	if err != nil {
+		return false, err
+	}
+
+	if bytes.Equal(cert, e.cert) && bytes.Equal(ca, e.ca) {
+		return false, nil
+	}
+
+	// the authorities first, so that the peers of the new certificate are
+	// trusted as soon as it is used
+	files := []struct {
+		path string
+		data []byte
+	}{{e.CAFile, ca}, {e.KeyFile, key}, {e.CertFile, cert}}
+	for _, file := range files {
+		if err := writeFile(file.path, file.data); err != nil {
+			return false, err
+		}
+	}
+	e.cert, e.ca = cert, ca
+
+	return true, nil
+}
+
+func (e *FileExport) run(interval time.Duration) {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if written, err := e.write(); err != nil {
+				logging.GetLogger().Errorf("Failed to export certificate to %s: %s", e.CertFile, err)
+			} else if written {
+				logging.GetLogger().Infof("Certificate exported to %s", e.CertFile)
+			}
+		case <-e.quit:
+			return
+		}
+	}
+}
+
+// Stop rewriting the files
+func (e *FileExport) Stop() {
+	if e.quit != nil {
+		close(e.quit)
+		e.wg.Wait()
+	}
+}
+
+// NewFileExport writes the certificate of a source to the cert.pem,
+// key.pem and ca.pem files of the given directory, checking for rotated
+// certificates at the given interval, 0 to disable the rewriting
+func NewFileExport(src PEMSource, dir string, interval time.Duration) (*FileExport, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	e := &FileExport{
+		src:      src,
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+		CAFile:   filepath.Join(dir, "ca.pem"),
+	}
+
+	if _, err := e.write(); err != nil {
+		return nil, err
+	}
+
+	if interval > 0 {
+		e.quit = make(chan struct{})
+		e.wg.Add(1)
+		go e.run(interval)
+	}
+
+	return e, nil
+}
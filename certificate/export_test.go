@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package certificate
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakePEMSource struct {
+	sync.Mutex
+	cert, key, ca []byte
+}
+
+func (s *fakePEMSource) Certificate() (*tls.Certificate, error) { return nil, ErrNoCertificate }
+func (s *fakePEMSource) Roots() *x509.CertPool                  { return nil }
+func (s *fakePEMSource) Stop()                                  {}
+
+func (s *fakePEMSource) PEM() ([]byte, []byte, []byte, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.cert, s.key, s.ca, nil
+}
+
+func (s *fakePEMSource) rotate(cert, key []byte) {
+	s.Lock()
+	s.cert, s.key = cert, key
+	s.Unlock()
+}
+
+func TestFileExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skydive-certificate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := &fakePEMSource{cert: []byte("cert1"), key: []byte("key1"), ca: []byte("ca")}
+	export, err := NewFileExport(src, filepath.Join(dir, "tls"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer export.Stop()
+
+	check := func(path, expected string) bool {
+		data, err := ioutil.ReadFile(path)
+		return err == nil && string(data) == expected
+	}
+
+	if !check(export.CertFile, "cert1") || !check(export.KeyFile, "key1") || !check(export.CAFile, "ca") {
+		t.Fatal("The certificate should be written on creation")
+	}
+
+	if fi, err := os.Stat(export.KeyFile); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("The key should only be readable by its owner, got %v", fi.Mode())
+	}
+
+	src.rotate([]byte("cert2"), []byte("key2"))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !check(export.CertFile, "cert2") || !check(export.KeyFile, "key2") {
+		if time.Now().After(deadline) {
+			t.Fatal("The rotated certificate should be written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
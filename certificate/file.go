@@ -0,0 +1,170 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package certificate
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// FileSource loads a certificate, its key and the certificate authorities
+// from PEM files. The files are checked periodically and reloaded when one
+// of them is modified.
+type FileSource struct {
+	sync.RWMutex
+	certFile string
+	keyFile  string
+	caFile   string
+	cert     *tls.Certificate
+	roots    *x509.CertPool
+	modTimes map[string]time.Time
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Certificate returns the last certificate loaded
+func (s *FileSource) Certificate() (*tls.Certificate, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.cert == nil {
+		return nil, ErrNoCertificate
+	}
+	return s.cert, nil
+}
+
+// Roots returns the last certificate authorities loaded
+func (s *FileSource) Roots() *x509.CertPool {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.roots
+}
+
+func (s *FileSource) files() []string {
+	files := []string{s.certFile, s.keyFile}
+	if s.caFile != "" {
+		files = append(files, s.caFile)
+	}
+	return files
+}
+
+func (s *FileSource) changed() (map[string]time.Time, bool, error) {
+	modTimes := make(map[string]time.Time)
+	changed := false
+	for _, file := range s.files() {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return nil, false, err
+		}
+		modTimes[file] = fi.ModTime()
+		if !fi.ModTime().Equal(s.modTimes[file]) {
+			changed = true
+		}
+	}
+	return modTimes, changed, nil
+}
+
+func (s *FileSource) load() error {
+	modTimes, changed, err := s.changed()
+	if err != nil || !changed {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return fmt.Errorf("Can't read X509 key pair : cert '%s' key '%s' : %s", s.certFile, s.keyFile, err)
+	}
+
+	var roots *x509.CertPool
+	if s.caFile != "" {
+		if roots, err = common.SetupTLSLoadCA(s.caFile); err != nil {
+			return err
+		}
+	}
+
+	s.Lock()
+	s.cert, s.roots, s.modTimes = &cert, roots, modTimes
+	s.Unlock()
+
+	return nil
+}
+
+func (s *FileSource) run(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// the modification times are only recorded on success so that
+			// a half written certificate will be loaded again on next tick
+			s.RLock()
+			previous := s.cert
+			s.RUnlock()
+
+			if err := s.load(); err != nil {
+				logging.GetLogger().Errorf("Failed to reload certificate, keeping the current one: %s", err)
+			} else if s.cert != previous {
+				logging.GetLogger().Infof("Certificate %s reloaded", s.certFile)
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// Stop watching the files
+func (s *FileSource) Stop() {
+	if s.quit != nil {
+		close(s.quit)
+		s.wg.Wait()
+	}
+}
+
+// NewFileSource returns a source loading the certificate from the given
+// files and checking for modifications at the given interval, 0 to disable
+// the reloading. caFile can be empty to use the system authorities.
+func NewFileSource(certFile, keyFile, caFile string, interval time.Duration) (*FileSource, error) {
+	s := &FileSource{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	if interval > 0 {
+		s.quit = make(chan struct{})
+		s.wg.Add(1)
+		go s.run(interval)
+	}
+
+	return s, nil
+}
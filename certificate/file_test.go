@@ -0,0 +1,196 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package certificate
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func generateCertificate(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+func writeCertificate(t *testing.T, dir, name string, cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	pemCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".crt"), pemCert, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if key == nil {
+		return
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".key"), pemKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func handshake(serverConfig, clientConfig *tls.Config) error {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer conn.Close()
+		errCh <- conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), clientConfig)
+	if err != nil {
+		return err
+	}
+	// the server only verifies the client certificate after the client
+	// has completed its handshake, make a round trip to get the result
+	conn.Write([]byte{0})
+	conn.Close()
+
+	return <-errCh
+}
+
+func TestFileSourceRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skydive-certificate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, caKey := generateCertificate(t, "ca", nil, nil)
+	writeCertificate(t, dir, "ca", ca, nil)
+
+	server, serverKey := generateCertificate(t, "server", ca, caKey)
+	writeCertificate(t, dir, "server", server, serverKey)
+
+	client, clientKey := generateCertificate(t, "client", ca, caKey)
+	writeCertificate(t, dir, "client", client, clientKey)
+
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	serverSource, err := NewFileSource(path("server.crt"), path("server.key"), path("ca.crt"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverSource.Stop()
+
+	clientSource, err := NewFileSource(path("client.crt"), path("client.key"), path("ca.crt"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientSource.Stop()
+
+	opts := Opts{RequireClientCert: true}
+	serverConfig := ServerConfig(serverSource, opts)
+	clientConfig := ClientConfig(clientSource, opts)
+	clientConfig.ServerName = "127.0.0.1"
+
+	if err := handshake(serverConfig, clientConfig); err != nil {
+		t.Fatalf("Mutual TLS handshake failed: %s", err)
+	}
+
+	// rotate the client certificate with one signed by an unknown authority
+	other, otherKey := generateCertificate(t, "other", nil, nil)
+	rogue, rogueKey := generateCertificate(t, "client", other, otherKey)
+	writeCertificate(t, dir, "client", rogue, rogueKey)
+
+	// make sure the modification time changes on coarse grained filesystems
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path("client.crt"), later, later)
+	os.Chtimes(path("client.key"), later, later)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cert, err := clientSource.Certificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(cert.Certificate[0], rogue.Raw) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Rotated certificate not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := handshake(serverConfig, clientConfig); err == nil {
+		t.Fatal("Handshake should fail with a certificate from an unknown authority")
+	}
+}
+
+func TestFileSourceMissingFile(t *testing.T) {
+	if _, err := NewFileSource("/nonexistent.crt", "/nonexistent.key", "", 0); err == nil {
+		t.Fatal("Should fail without certificate files")
+	}
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package certificate
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/skydive-project/skydive/logging"
+)
+
+const (
+	fetchX509SVIDMethod = "/SpiffeWorkloadAPI/FetchX509SVID"
+	workloadHeader      = "workload.spiffe.io"
+	retryDelay          = 5 * time.Second
+)
+
+// WorkloadSource fetches the X509-SVID of the service and the trust
+// bundles from the SPIFFE Workload API, as served by the SPIRE agent. The
+// API streams a new SVID each time it is rotated.
+type WorkloadSource struct {
+	sync.RWMutex
+	conn   *grpc.ClientConn
+	cert   *tls.Certificate
+	roots  *x509.CertPool
+	pem    [3][]byte
+	id     string
+	ready  chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Certificate returns the last X509-SVID received
+func (s *WorkloadSource) Certificate() (*tls.Certificate, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.cert == nil {
+		return nil, ErrNoCertificate
+	}
+	return s.cert, nil
+}
+
+// Roots returns the last trust bundles received
+func (s *WorkloadSource) Roots() *x509.CertPool {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.roots
+}
+
+// PEM returns the last X509-SVID, its key and the trust bundles received,
+// encoded in PEM
+func (s *WorkloadSource) PEM() (cert, key, ca []byte, err error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.cert == nil {
+		return nil, nil, nil, ErrNoCertificate
+	}
+	return s.pem[0], s.pem[1], s.pem[2], nil
+}
+
+func (s *WorkloadSource) update(resp *X509SVIDResponse) error {
+	if len(resp.Svids) == 0 {
+		return errors.New("No X509-SVID in Workload API response")
+	}
+
+	// the first SVID is the default identity of the workload
+	svid := resp.Svids[0]
+
+	certs, err := x509.ParseCertificates(svid.X509SVID)
+	if err != nil || len(certs) == 0 {
+		return fmt.Errorf("Failed to parse X509-SVID '%s': %v", svid.SpiffeID, err)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(svid.X509SVIDKey)
+	if err != nil {
+		return fmt.Errorf("Failed to parse X509-SVID key '%s': %s", svid.SpiffeID, err)
+	}
+
+	cert := &tls.Certificate{PrivateKey: key, Leaf: certs[0]}
+	var certPEM []byte
+	for _, c := range certs {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: svid.X509SVIDKey})
+
+	bundles := [][]byte{svid.Bundle}
+	for _, bundle := range resp.FederatedBundles {
+		bundles = append(bundles, bundle)
+	}
+
+	roots := x509.NewCertPool()
+	var caPEM []byte
+	for _, bundle := range bundles {
+		cas, err := x509.ParseCertificates(bundle)
+		if err != nil {
+			return fmt.Errorf("Failed to parse trust bundle: %s", err)
+		}
+		for _, ca := range cas {
+			roots.AddCert(ca)
+			caPEM = append(caPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})...)
+		}
+	}
+
+	s.Lock()
+	s.cert, s.roots, s.id = cert, roots, svid.SpiffeID
+	s.pem = [3][]byte{certPEM, keyPEM, caPEM}
+	s.Unlock()
+
+	return nil
+}
+
+func (s *WorkloadSource) fetch(ctx context.Context) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, workloadHeader, "true")
+
+	stream, err := s.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, fetchX509SVIDMethod)
+	if err != nil {
+		return err
+	}
+
+	if err := stream.SendMsg(&X509SVIDRequest{}); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	for {
+		var resp X509SVIDResponse
+		if err := stream.RecvMsg(&resp); err != nil {
+			return err
+		}
+
+		if err := s.update(&resp); err != nil {
+			logging.GetLogger().Errorf("Ignoring X509-SVID update, keeping the current one: %s", err)
+			continue
+		}
+		logging.GetLogger().Infof("X509-SVID %s received from the Workload API", s.id)
+
+		select {
+		case <-s.ready:
+		default:
+			close(s.ready)
+		}
+	}
+}
+
+func (s *WorkloadSource) run(ctx context.Context) {
+	defer s.wg.Done()
+
+	for {
+		err := s.fetch(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+			logging.GetLogger().Errorf("Workload API stream closed, retrying: %s", err)
+		}
+	}
+}
+
+// Stop fetching the SVIDs
+func (s *WorkloadSource) Stop() {
+	s.cancel()
+	s.wg.Wait()
+	s.conn.Close()
+}
+
+// NewWorkloadSource returns a source fetching the SVIDs from the Workload
+// API listening on the given unix socket. It waits for the first SVID up to
+// the given timeout.
+func NewWorkloadSource(socket string, timeout time.Duration) (*WorkloadSource, error) {
+	dialer := func(ctx context.Context, addr string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", addr)
+	}
+
+	conn, err := grpc.Dial(strings.TrimPrefix(socket, "unix://"), grpc.WithInsecure(), grpc.WithContextDialer(dialer))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to the Workload API %s: %s", socket, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &WorkloadSource{
+		conn:   conn,
+		ready:  make(chan struct{}),
+		cancel: cancel,
+	}
+
+	s.wg.Add(1)
+	go s.run(ctx)
+
+	select {
+	case <-s.ready:
+		return s, nil
+	case <-time.After(timeout):
+		s.Stop()
+		return nil, fmt.Errorf("No X509-SVID received from the Workload API %s after %s", socket, timeout)
+	}
+}
@@ -18,7 +18,14 @@
 package client
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/skydive-project/skydive/api/client"
 	"github.com/skydive-project/skydive/api/types"
@@ -34,6 +41,29 @@ var (
 	alertExpression  string
 	alertAction      string
 	alertTrigger     string
+	alertTemplate    string
+
+	alertThreshold          float64
+	alertThresholdField     string
+	alertThresholdOperator  string
+	alertThresholdClear     float64
+	alertThresholdFor       string
+	alertThresholdCooldown  string
+	alertAnomalyTraining    string
+	alertAnomalySensitivity float64
+
+	alertConditions []string
+	alertCombine    string
+	alertWithin     string
+
+	alertDryRun bool
+
+	alertBacktestFrom string
+	alertBacktestTo   string
+	alertBacktestStep string
+
+	alertAckComment  string
+	alertAckDuration string
 )
 
 // AlertCmd skydive alert root command
@@ -44,6 +74,66 @@ var AlertCmd = &cobra.Command{
 	SilenceUsage: false,
 }
 
+// newAlertFromFlags returns the alert described by the command flags
+func newAlertFromFlags(cmd *cobra.Command) *types.Alert {
+	alert := types.NewAlert()
+	alert.Name = alertName
+	alert.Description = alertDescription
+	alert.Expression = alertExpression
+	alert.Trigger = alertTrigger
+	alert.Action = alertAction
+	alert.Template = alertTemplate
+
+	if cmd.Flags().Changed("threshold") {
+		alert.Threshold = &types.AlertThreshold{
+			Field:    alertThresholdField,
+			Operator: alertThresholdOperator,
+			Value:    alertThreshold,
+			For:      alertThresholdFor,
+			Cooldown: alertThresholdCooldown,
+		}
+		if cmd.Flags().Changed("threshold-clear") {
+			alert.Threshold.Clear = &alertThresholdClear
+		}
+	}
+
+	if alertAnomalyTraining != "" {
+		alert.Anomaly = &types.AlertAnomaly{
+			Training:    alertAnomalyTraining,
+			Sensitivity: alertAnomalySensitivity,
+		}
+	}
+
+	for _, c := range alertConditions {
+		i := strings.Index(c, "=")
+		if i <= 0 {
+			exitOnError(fmt.Errorf("Invalid condition '%s', expected name=expression", c))
+		}
+		alert.Conditions = append(alert.Conditions, &types.AlertCondition{Name: c[:i], Expression: c[i+1:]})
+	}
+	alert.Combine = alertCombine
+	alert.Within = alertWithin
+
+	// in dry-run mode, the analyzer reports all the errors at once
+	if alertDryRun {
+		return alert
+	}
+
+	if err := validator.Validate(alert); err != nil {
+		exitOnError(err)
+	}
+
+	return alert
+}
+
+// parseBacktestTime parses a RFC3339 time or a duration before now
+func parseBacktestTime(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(strings.TrimPrefix(s, "-")); err == nil {
+		return time.Now().UTC().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
 // AlertCreate skydive alert creates command
 var AlertCreate = &cobra.Command{
 	Use:   "create",
@@ -55,21 +145,59 @@ var AlertCreate = &cobra.Command{
 			exitOnError(err)
 		}
 
-		alert := types.NewAlert()
-		alert.Name = alertName
-		alert.Description = alertDescription
-		alert.Expression = alertExpression
-		alert.Trigger = alertTrigger
-		alert.Action = alertAction
+		alert := newAlertFromFlags(cmd)
+		if alertDryRun {
+			dryRun(client, "alert", &alert)
+			return
+		}
 
-		if err := validator.Validate(alert); err != nil {
+		if err := client.Create("alert", &alert, nil); err != nil {
 			exitOnError(err)
 		}
+		printOutput(&alert)
+	},
+}
 
-		if err := client.Create("alert", &alert, nil); err != nil {
+// AlertBacktest skydive alert backtest command
+var AlertBacktest = &cobra.Command{
+	Use:   "backtest",
+	Short: "Evaluate alert on the history",
+	Long:  "Evaluate an alert on a past time range and display when it would have fired",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
 			exitOnError(err)
 		}
-		printJSON(&alert)
+
+		params := &types.AlertBacktestParams{Alert: newAlertFromFlags(cmd), Step: alertBacktestStep}
+		if params.From, err = parseBacktestTime(alertBacktestFrom); err != nil {
+			exitOnError(fmt.Errorf("Invalid start time: %s", err))
+		}
+		if params.To, err = parseBacktestTime(alertBacktestTo); err != nil {
+			exitOnError(fmt.Errorf("Invalid end time: %s", err))
+		}
+
+		var result types.AlertBacktestResult
+		s, err := json.Marshal(params)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		resp, err := client.Request("POST", "alert/backtest", bytes.NewReader(s), nil)
+		if err != nil {
+			exitOnError(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			data, _ := ioutil.ReadAll(resp.Body)
+			exitOnError(fmt.Errorf("%s: %s", resp.Status, string(data)))
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			exitOnError(err)
+		}
+		printOutput(&result)
 	},
 }
 
@@ -87,7 +215,7 @@ var AlertList = &cobra.Command{
 		if err := client.List("alert", &alerts); err != nil {
 			exitOnError(err)
 		}
-		printJSON(alerts)
+		printOutput(alerts)
 	},
 }
 
@@ -112,7 +240,7 @@ var AlertGet = &cobra.Command{
 		if err := client.Get("alert", args[0], &alert); err != nil {
 			exitOnError(err)
 		}
-		printJSON(&alert)
+		printOutput(&alert)
 	},
 }
 
@@ -141,12 +269,122 @@ var AlertDelete = &cobra.Command{
 	},
 }
 
+// AlertState skydive alert state command
+var AlertState = &cobra.Command{
+	Use:   "state [alert]",
+	Short: "Display alert state",
+	Long:  "Display whether the alert is firing or resolved, and its acknowledgement",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var state types.AlertState
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.Get("alert", args[0]+"/state", &state); err != nil {
+			exitOnError(err)
+		}
+		printOutput(&state)
+	},
+}
+
+// AlertHistory skydive alert history command
+var AlertHistory = &cobra.Command{
+	Use:   "history [alert]",
+	Short: "Display alert history",
+	Long:  "Display the triggers, resolutions and acknowledgements of the alert",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var events []types.AlertEvent
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.Get("alert", args[0]+"/history", &events); err != nil {
+			exitOnError(err)
+		}
+		printOutput(events)
+	},
+}
+
+// AlertAck skydive alert ack command
+var AlertAck = &cobra.Command{
+	Use:   "ack [alert]",
+	Short: "Acknowledge alert",
+	Long:  "Suppress the notifications of the alert until its resolution, or for a duration",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		ack := &types.AlertAck{Comment: alertAckComment, Duration: alertAckDuration}
+		if err := client.Create("alert/"+args[0]+"/ack", ack, nil); err != nil {
+			exitOnError(err)
+		}
+		printOutput(ack)
+	},
+}
+
+// AlertUnack skydive alert unack command
+var AlertUnack = &cobra.Command{
+	Use:   "unack [alert]",
+	Short: "Remove alert acknowledgement",
+	Long:  "Remove alert acknowledgement",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.Delete("alert", args[0]+"/ack"); err != nil {
+			exitOnError(err)
+		}
+	},
+}
+
 func addAlertFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&alertName, "name", "", "", "alert name")
 	cmd.Flags().StringVarP(&alertDescription, "description", "", "", "description of the alert")
-	cmd.Flags().StringVarP(&alertTrigger, "trigger", "", "graph", "event that triggers the alert evaluation")
+	cmd.Flags().StringVarP(&alertTrigger, "trigger", "", "graph", "event that triggers the alert evaluation: graph, change or duration:<interval>")
 	cmd.Flags().StringVarP(&alertExpression, "expression", "", "", "Gremlin or JavaScript expression evaluated to trigger the alarm")
 	cmd.Flags().StringVarP(&alertAction, "action", "", "", "can be either an empty string, or a URL (use 'file://' for local scripts)")
+	cmd.Flags().StringVarP(&alertTemplate, "template", "", "", "template of the Slack, PagerDuty and email notifications")
+	cmd.Flags().Float64VarP(&alertThreshold, "threshold", "", 0, "trigger the alert when the expression result crosses this value")
+	cmd.Flags().StringVarP(&alertThresholdField, "threshold-field", "", "", "field of the expression result compared to the threshold")
+	cmd.Flags().StringVarP(&alertThresholdOperator, "threshold-operator", "", ">", "threshold comparison operator, > or <")
+	cmd.Flags().Float64VarP(&alertThresholdClear, "threshold-clear", "", 0, "value to cross back to clear the alert, defaults to the threshold")
+	cmd.Flags().StringVarP(&alertThresholdFor, "threshold-for", "", "", "duration the threshold has to be crossed before triggering")
+	cmd.Flags().StringVarP(&alertThresholdCooldown, "threshold-cooldown", "", "", "minimum delay between two triggers of the alert")
+	cmd.Flags().StringVarP(&alertAnomalyTraining, "anomaly-training", "", "", "learn a baseline of the returned flows during this window and alert on deviations")
+	cmd.Flags().Float64VarP(&alertAnomalySensitivity, "anomaly-sensitivity", "", 3, "number of standard deviations above the baseline volume considered as a spike")
+	cmd.Flags().StringArrayVarP(&alertConditions, "condition", "", []string{}, "condition of a composite alert, as name=expression, can be repeated")
+	cmd.Flags().StringVarP(&alertCombine, "combine", "", "", "combination of the conditions, AND (default) or OR")
+	cmd.Flags().StringVarP(&alertWithin, "within", "", "", "maximum delay between the conditions becoming true, with AND")
 }
 
 func init() {
@@ -154,6 +392,21 @@ func init() {
 	AlertCmd.AddCommand(AlertGet)
 	AlertCmd.AddCommand(AlertCreate)
 	AlertCmd.AddCommand(AlertDelete)
+	AlertCmd.AddCommand(AlertState)
+	AlertCmd.AddCommand(AlertHistory)
+	AlertCmd.AddCommand(AlertAck)
+	AlertCmd.AddCommand(AlertUnack)
+	AlertCmd.AddCommand(AlertBacktest)
 
 	addAlertFlags(AlertCreate)
+	addAlertFlags(AlertBacktest)
+
+	AlertCreate.Flags().BoolVarP(&alertDryRun, "dry-run", "", false, "validate the alert against the topology without creating it")
+
+	AlertBacktest.Flags().StringVarP(&alertBacktestFrom, "from", "", "-24h", "start of the time range, RFC3339 time or duration before now")
+	AlertBacktest.Flags().StringVarP(&alertBacktestTo, "to", "", "0s", "end of the time range, RFC3339 time or duration before now")
+	AlertBacktest.Flags().StringVarP(&alertBacktestStep, "step", "", "", "delay between two evaluations, the one of the duration trigger or 1m by default")
+
+	AlertAck.Flags().StringVarP(&alertAckComment, "comment", "", "", "comment of the acknowledgement")
+	AlertAck.Flags().StringVarP(&alertAckDuration, "duration", "", "", "silence the alert for this duration, even after its resolution")
 }
@@ -0,0 +1,201 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/skydive-project/skydive/api/client"
+	api "github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/validator"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	apiTokenRoles   []string
+	apiTokenExpires string
+)
+
+// APITokenCmd skydive apitoken root command
+var APITokenCmd = &cobra.Command{
+	Use:          "apitoken",
+	Short:        "Manage the API tokens of the service accounts",
+	Long:         "Manage the API tokens of the service accounts",
+	SilenceUsage: false,
+}
+
+// APITokenCreate skydive apitoken create command
+var APITokenCreate = &cobra.Command{
+	Use:          "create",
+	Short:        "create",
+	Long:         "Create a service account and its API token, only displayed once",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		apiToken := &api.APIToken{
+			Name:        name,
+			Description: description,
+			Roles:       apiTokenRoles,
+		}
+
+		if apiTokenExpires != "" {
+			d, err := time.ParseDuration(apiTokenExpires)
+			if err != nil {
+				exitOnError(fmt.Errorf("Invalid expiration delay: %s", err))
+			}
+			expiresAt := time.Now().UTC().Add(d)
+			apiToken.ExpiresAt = &expiresAt
+		}
+
+		if err = validator.Validate(apiToken); err != nil {
+			exitOnError(fmt.Errorf("Error while validating API token: %s", err))
+		}
+
+		if err = client.Create("apitoken", &apiToken, nil); err != nil {
+			exitOnError(err)
+		}
+
+		printOutput(apiToken)
+	},
+}
+
+// APITokenRotate skydive apitoken rotate command
+var APITokenRotate = &cobra.Command{
+	Use:          "rotate [apitoken]",
+	Short:        "Replace the token of a service account",
+	Long:         "Replace the token of a service account, revoking the previous one",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		var apiToken api.APIToken
+		if err := client.Create("apitoken/"+args[0]+"/rotate", &apiToken, nil); err != nil {
+			exitOnError(err)
+		}
+		printOutput(&apiToken)
+	},
+}
+
+// APITokenGet skydive apitoken get command
+var APITokenGet = &cobra.Command{
+	Use:          "get",
+	Short:        "get",
+	Long:         "get",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var apiToken api.APIToken
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+		if err := client.Get("apitoken", args[0], &apiToken); err != nil {
+			exitOnError(err)
+		}
+		printOutput(&apiToken)
+	},
+}
+
+// APITokenList skydive apitoken list command
+var APITokenList = &cobra.Command{
+	Use:          "list",
+	Short:        "list",
+	Long:         "list",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var apiTokens map[string]api.APIToken
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.List("apitoken", &apiTokens); err != nil {
+			exitOnError(err)
+		}
+		printOutput(apiTokens)
+	},
+}
+
+// APITokenDelete skydive apitoken delete command
+var APITokenDelete = &cobra.Command{
+	Use:          "delete",
+	Short:        "delete",
+	Long:         "Delete API tokens, revoking them",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		for _, id := range args {
+			if err := client.Delete("apitoken", id); err != nil {
+				logging.GetLogger().Error(err.Error())
+			}
+		}
+	},
+}
+
+func init() {
+	APITokenCmd.AddCommand(APITokenCreate)
+	APITokenCmd.AddCommand(APITokenRotate)
+	APITokenCmd.AddCommand(APITokenList)
+	APITokenCmd.AddCommand(APITokenGet)
+	APITokenCmd.AddCommand(APITokenDelete)
+
+	APITokenCreate.Flags().StringVarP(&name, "name", "", "", "service account name")
+	APITokenCreate.Flags().StringVarP(&description, "description", "", "", "token description")
+	APITokenCreate.Flags().StringSliceVarP(&apiTokenRoles, "roles", "", nil, "roles bound to the service account")
+	APITokenCreate.Flags().StringVarP(&apiTokenExpires, "expires", "", "", "delay after which the token expires, ex: 720h, never if not specified")
+}
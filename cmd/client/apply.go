@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/skydive-project/skydive/api/client"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	bundleFile  string
+	applyPrune  bool
+	applyDryRun bool
+)
+
+// ApplyCmd skydive apply command
+var ApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Apply a bundle of captures, alerts, rules and packet injections",
+	Long:  "Apply a YAML bundle describing the desired captures, alerts, node rules, edge rules and packet injections, identified by their name",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewRestClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		content, err := ioutil.ReadFile(bundleFile)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		var bundle types.ApplyBundle
+		if err := yaml.Unmarshal(content, &bundle); err != nil {
+			exitOnError(fmt.Errorf("Failed to parse %s: %s", bundleFile, err))
+		}
+
+		s, err := json.Marshal(&bundle)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		query := url.Values{}
+		query.Set("prune", strconv.FormatBool(applyPrune))
+		query.Set("dry_run", strconv.FormatBool(applyDryRun))
+
+		resp, err := client.Request("POST", "apply?"+query.Encode(), bytes.NewReader(s), nil)
+		if err != nil {
+			exitOnError(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			content, _ := ioutil.ReadAll(resp.Body)
+			exitOnError(fmt.Errorf("Failed to apply %s: %s", bundleFile, string(content)))
+		}
+
+		var result types.ApplyResult
+		if err := common.JSONDecode(resp.Body, &result); err != nil {
+			exitOnError(err)
+		}
+
+		printOutput(result)
+
+		for _, change := range result.Changes {
+			if change.Error != "" {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	ApplyCmd.Flags().StringVarP(&bundleFile, "file", "f", "", "Bundle file")
+	ApplyCmd.Flags().BoolVarP(&applyPrune, "prune", "", false, "Delete the objects of the kinds listed in the bundle that are not part of it")
+	ApplyCmd.Flags().BoolVarP(&applyDryRun, "dry-run", "", false, "Only display the changes to be made")
+	ApplyCmd.MarkFlagRequired("file")
+}
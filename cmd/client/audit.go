@@ -0,0 +1,89 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/skydive-project/skydive/api/client"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditUser  string
+	auditKind  string
+	auditSince string
+	auditUntil string
+	auditLimit int
+)
+
+// AuditCmd skydive audit command, searching the audit trail
+var AuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Search the audit trail",
+	Long:  "Display the API calls changing objects, the queries accessing the captured packets and the other reads",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		params := url.Values{}
+		for name, value := range map[string]string{"user": auditUser, "kind": auditKind, "since": auditSince, "until": auditUntil} {
+			if value != "" {
+				params.Set(name, value)
+			}
+		}
+		if auditLimit > 0 {
+			params.Set("limit", strconv.Itoa(auditLimit))
+		}
+
+		resp, err := client.Request("GET", "audit?"+params.Encode(), nil, nil)
+		if err != nil {
+			exitOnError(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			data, _ := ioutil.ReadAll(resp.Body)
+			exitOnError(fmt.Errorf("Failed to search the audit trail, %s: %s", resp.Status, data))
+		}
+
+		var records []*types.AuditRecord
+		if err := common.JSONDecode(resp.Body, &records); err != nil {
+			exitOnError(err)
+		}
+
+		printOutput(records)
+	},
+}
+
+func init() {
+	AuditCmd.Flags().StringVarP(&auditUser, "user", "", "", "user who made the calls")
+	AuditCmd.Flags().StringVarP(&auditKind, "kind", "", "", "kind of the records: mutation, rawpackets or read")
+	AuditCmd.Flags().StringVarP(&auditSince, "since", "", "", "RFC 3339 time or duration before now, ex: 24h")
+	AuditCmd.Flags().StringVarP(&auditUntil, "until", "", "", "RFC 3339 time or duration before now")
+	AuditCmd.Flags().IntVarP(&auditLimit, "limit", "", 0, "maximum number of records, the most recent ones, 1000 at most")
+}
@@ -18,16 +18,22 @@
 package client
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/skydive-project/skydive/api/client"
 	api "github.com/skydive-project/skydive/api/types"
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/flow"
-	"github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/gremlin"
+	shttp "github.com/skydive-project/skydive/http"
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/validator"
 	"github.com/spf13/cobra"
@@ -39,7 +45,15 @@ var (
 	captureDescription string
 	captureType        string
 	captureTTL         uint64
+	captureLifetime    int64
+	captureStartTime   string
+	captureDuration    int64
+	updateInterval     int64
+	expireTimeout      int64
 	nodeTID            string
+	captureHost        string
+	captureInterface   string
+	captureSelector    string
 	port               int
 	samplingRate       uint32
 	pollingInterval    uint32
@@ -48,10 +62,13 @@ var (
 	extraTCPMetric     bool
 	ipDefrag           bool
 	reassembleTCP      bool
+	captureMasked      bool
+	encryptRawPackets  bool
 	layerKeyMode       string
 	extraLayers        []string
 	target             string
 	targetType         string
+	captureDryRun      bool
 )
 
 // CaptureCmd skydive capture root command
@@ -68,12 +85,28 @@ var CaptureCreate = &cobra.Command{
 	Short: "Create capture",
 	Long:  "Create capture",
 	PreRun: func(cmd *cobra.Command, args []string) {
+		if captureHost != "" && captureInterface == "" {
+			exitOnError(errors.New("Option --host requires --interface"))
+		}
+		if captureInterface != "" {
+			if nodeTID != "" || gremlinQuery != "" {
+				exitOnError(errors.New("Option --interface is exclusive with --node and --gremlin"))
+			}
+			tid, err := resolveInterface(captureHost, captureInterface)
+			if err != nil {
+				exitOnError(err)
+			}
+			nodeTID = tid
+		}
 		if nodeTID != "" {
 			if gremlinQuery != "" {
 				exitOnError(errors.New("Options --node and --gremlin are exclusive"))
 			}
 			gremlinQuery = fmt.Sprintf("g.V().Has('TID', '%s')", nodeTID)
 		}
+		if captureSelector != "" && gremlinQuery != "" {
+			exitOnError(errors.New("Option --selector is exclusive with --node and --gremlin"))
+		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
@@ -87,6 +120,7 @@ var CaptureCreate = &cobra.Command{
 		}
 
 		capture := api.NewCapture(gremlinQuery, bpfFilter)
+		capture.Selector = captureSelector
 		capture.Name = captureName
 		capture.Description = captureDescription
 		capture.Type = captureType
@@ -102,14 +136,33 @@ var CaptureCreate = &cobra.Command{
 		capture.ExtraLayers = layers
 		capture.Target = target
 		capture.TargetType = targetType
+		capture.Duration = captureDuration
+		capture.TTL = captureLifetime
+		capture.Masked = captureMasked
+		capture.EncryptRawPackets = encryptRawPackets
+		capture.UpdateInterval = updateInterval
+		capture.ExpireTimeout = expireTimeout
+
+		if captureStartTime != "" {
+			startTime, err := time.Parse(time.RFC3339, captureStartTime)
+			if err != nil {
+				exitOnError(fmt.Errorf("Invalid start time: %s", err))
+			}
+			capture.StartTime = &startTime
+		}
+
+		if captureDryRun {
+			dryRun(client, "capture", &capture)
+			return
+		}
 
 		if err := validator.Validate(capture); err != nil {
 			exitOnError(err)
 		}
 
-		var createOpts *http.CreateOptions
+		var createOpts *shttp.CreateOptions
 		if captureTTL != 0 {
-			createOpts = &http.CreateOptions{
+			createOpts = &shttp.CreateOptions{
 				TTL: time.Duration(captureTTL) * time.Millisecond,
 			}
 		}
@@ -117,7 +170,7 @@ var CaptureCreate = &cobra.Command{
 		if err := client.Create("capture", &capture, createOpts); err != nil {
 			exitOnError(err)
 		}
-		printJSON(&capture)
+		printOutput(&capture)
 	},
 }
 
@@ -136,7 +189,7 @@ var CaptureList = &cobra.Command{
 		if err := client.List("capture", &captures); err != nil {
 			exitOnError(err)
 		}
-		printJSON(captures)
+		printOutput(captures)
 	},
 }
 
@@ -161,7 +214,7 @@ var CaptureGet = &cobra.Command{
 		if err := client.Get("capture", args[0], &capture); err != nil {
 			exitOnError(err)
 		}
-		printJSON(&capture)
+		printOutput(&capture)
 	},
 }
 
@@ -169,9 +222,9 @@ var CaptureGet = &cobra.Command{
 var CaptureDelete = &cobra.Command{
 	Use:   "delete [capture]",
 	Short: "Delete capture",
-	Long:  "Delete capture",
+	Long:  "Delete captures by ID or all the captures created with a selector",
 	PreRun: func(cmd *cobra.Command, args []string) {
-		if len(args) == 0 {
+		if len(args) == 0 && captureSelector == "" || len(args) != 0 && captureSelector != "" {
 			cmd.Usage()
 			os.Exit(1)
 		}
@@ -182,6 +235,26 @@ var CaptureDelete = &cobra.Command{
 			exitOnError(err)
 		}
 
+		if captureSelector != "" {
+			resp, err := client.Request("DELETE", "capture?selector="+url.QueryEscape(captureSelector), nil, nil)
+			if err != nil {
+				exitOnError(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				data, _ := ioutil.ReadAll(resp.Body)
+				exitOnError(fmt.Errorf("%s: %s", resp.Status, string(data)))
+			}
+
+			var ids []string
+			if err := json.NewDecoder(resp.Body).Decode(&ids); err != nil {
+				exitOnError(err)
+			}
+			printOutput(ids)
+			return
+		}
+
 		for _, id := range args {
 			if err := client.Delete("capture", id); err != nil {
 				logging.GetLogger().Error(err)
@@ -190,10 +263,47 @@ var CaptureDelete = &cobra.Command{
 	},
 }
 
+// resolveInterface returns the TID of the interface with the given name,
+// on the given host if not empty. An error listing the candidates is
+// returned when the name is ambiguous
+func resolveInterface(host, name string) (string, error) {
+	query := gremlin.G.V().Has("Name", name)
+	if host != "" {
+		query = query.Has("Host", host)
+	}
+	query = query.HasKey("TID")
+
+	nodes, err := client.NewGremlinQueryHelper(&AuthenticationOpts).GetNodes(query)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(nodes) {
+	case 0:
+		if host != "" {
+			return "", fmt.Errorf("No interface %s found on host %s", name, host)
+		}
+		return "", fmt.Errorf("No interface %s found", name)
+	case 1:
+		return nodes[0].Metadata.GetFieldString("TID")
+	}
+
+	var candidates []string
+	for _, node := range nodes {
+		tid, _ := node.Metadata.GetFieldString("TID")
+		typ, _ := node.Metadata.GetFieldString("Type")
+		candidates = append(candidates, fmt.Sprintf("%s (host: %s, type: %s, TID: %s)", name, node.Host, typ, tid))
+	}
+	return "", fmt.Errorf("Interface %s is ambiguous, use --host or --node with one of:\n  %s", name, strings.Join(candidates, "\n  "))
+}
+
 func addCaptureFlags(cmd *cobra.Command) {
 	helpText := fmt.Sprintf("Allowed capture types: %v", common.ProbeTypes)
 	cmd.Flags().StringVarP(&gremlinQuery, "gremlin", "", "", "Gremlin Query")
 	cmd.Flags().StringVarP(&nodeTID, "node", "", "", "node TID")
+	cmd.Flags().StringVarP(&captureInterface, "interface", "", "", "name of the interface to capture on, resolved to its node TID")
+	cmd.Flags().StringVarP(&captureHost, "host", "", "", "host of the interface given with --interface")
+	cmd.Flags().StringVarP(&captureSelector, "selector", "", "", "label selector over the node metadata, ex: Manager=k8s,K8s.Namespace in (prod,staging)")
 	cmd.Flags().StringVarP(&bpfFilter, "bpf", "", "", "BPF filter")
 	cmd.Flags().StringVarP(&captureName, "name", "", "", "capture name")
 	cmd.Flags().StringVarP(&captureDescription, "description", "", "", "capture description")
@@ -211,6 +321,13 @@ func addCaptureFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&target, "target", "", "", "sFlow/NetFlow target, if empty the agent will be used")
 	cmd.Flags().StringVarP(&targetType, "target-type", "", "", "target type (netflowv5, erspanv1), ignored in case of sFlow/NetFlow capture")
 	cmd.Flags().Uint64VarP(&captureTTL, "ttl", "", 0, "capture duration in milliseconds")
+	cmd.Flags().Int64VarP(&captureLifetime, "lifetime", "", 0, "time to live of the capture in seconds from its start time, the capture being deleted once expired, 0 no expiration, default: 0")
+	cmd.Flags().StringVarP(&captureStartTime, "start-time", "", "", "capture start time, RFC3339 format, default: now")
+	cmd.Flags().Int64VarP(&captureDuration, "duration", "", 0, "duration of the capture in seconds from its start time, 0 no limit, default: 0")
+	cmd.Flags().BoolVarP(&captureMasked, "masked", "", false, "mask the flows of the capture as configured on the analyzer, default: false")
+	cmd.Flags().BoolVarP(&encryptRawPackets, "encrypt-rawpackets", "", false, "encrypt the raw packets of the capture before they are stored, default: false")
+	cmd.Flags().Int64VarP(&updateInterval, "update-interval", "", 0, "interval in seconds between the metric updates of the flows, 0 flow.update of the agents, default: 0")
+	cmd.Flags().Int64VarP(&expireTimeout, "expire-timeout", "", 0, "inactivity timeout in seconds after which the flows expire, 0 flow.expire of the agents, default: 0")
 }
 
 func init() {
@@ -220,4 +337,7 @@ func init() {
 	CaptureCmd.AddCommand(CaptureDelete)
 
 	addCaptureFlags(CaptureCreate)
+	CaptureCreate.Flags().BoolVarP(&captureDryRun, "dry-run", "", false, "validate the capture against the topology without creating it")
+
+	CaptureDelete.Flags().StringVarP(&captureSelector, "selector", "", "", "delete all the captures created with this selector")
 }
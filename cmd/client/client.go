@@ -35,6 +35,9 @@ var ClientCmd = &cobra.Command{
 	SilenceUsage: true,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		cmd.Root().PersistentPreRun(cmd.Root(), args)
+		if err := checkOutputMode(); err != nil {
+			exitOnError(err)
+		}
 		if analyzerAddr != "" {
 			config.Set("analyzers", analyzerAddr)
 		} else {
@@ -46,16 +49,29 @@ var ClientCmd = &cobra.Command{
 // RegisterClientCommands registers the 'client' CLI subcommands
 func RegisterClientCommands(cmd *cobra.Command) {
 	cmd.AddCommand(AlertCmd)
+	cmd.AddCommand(ApplyCmd)
 	cmd.AddCommand(CaptureCmd)
+	cmd.AddCommand(FlowCmd)
+	cmd.AddCommand(JobCmd)
+	cmd.AddCommand(LoggingCmd)
 	cmd.AddCommand(PacketInjectorCmd)
+	cmd.AddCommand(PathCmd)
 	cmd.AddCommand(PcapCmd)
 	cmd.AddCommand(QueryCmd)
 	cmd.AddCommand(ShellCmd)
 	cmd.AddCommand(StatusCmd)
+	cmd.AddCommand(SupportBundleCmd)
 	cmd.AddCommand(TopologyCmd)
 	cmd.AddCommand(WorkflowCmd)
 	cmd.AddCommand(NodeRuleCmd)
 	cmd.AddCommand(EdgeRuleCmd)
+	cmd.AddCommand(MetadataFieldCmd)
+	cmd.AddCommand(TaggingRuleCmd)
+	cmd.AddCommand(WebhookCmd)
+	cmd.AddCommand(APITokenCmd)
+	cmd.AddCommand(AuditCmd)
+	cmd.AddCommand(SavedQueryCmd)
+	cmd.AddCommand(SQLCmd)
 }
 
 func exitOnError(err error) {
@@ -66,7 +82,10 @@ func exitOnError(err error) {
 func init() {
 	ClientCmd.PersistentFlags().StringVarP(&AuthenticationOpts.Username, "username", "", os.Getenv("SKYDIVE_USERNAME"), "username auth parameter")
 	ClientCmd.PersistentFlags().StringVarP(&AuthenticationOpts.Password, "password", "", os.Getenv("SKYDIVE_PASSWORD"), "password auth parameter")
+	ClientCmd.PersistentFlags().StringVarP(&AuthenticationOpts.Token, "token", "", os.Getenv("SKYDIVE_TOKEN"), "API token of a service account")
 	ClientCmd.PersistentFlags().StringVarP(&analyzerAddr, "analyzer", "", os.Getenv("SKYDIVE_ANALYZER"), "analyzer address")
+	ClientCmd.PersistentFlags().StringVarP(&outputMode, "output", "o", outputJSON, "output format (json, yaml, table or csv)")
+	ClientCmd.PersistentFlags().StringSliceVarP(&outputFields, "field", "", []string{}, "fields of the results to output, ex: UUID,Metadata.Name")
 
 	RegisterClientCommands(ClientCmd)
 }
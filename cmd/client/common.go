@@ -18,12 +18,10 @@
 package client
 
 import (
-	"encoding/json"
-	"fmt"
 	"os"
 
+	"github.com/skydive-project/skydive/api/types"
 	shttp "github.com/skydive-project/skydive/http"
-	"github.com/skydive-project/skydive/logging"
 )
 
 // AuthenticationOpts Authentication options
@@ -31,11 +29,16 @@ var (
 	AuthenticationOpts shttp.AuthenticationOpts
 )
 
-func printJSON(obj interface{}) {
-	s, err := json.MarshalIndent(obj, "", "  ")
-	if err != nil {
-		logging.GetLogger().Error(err)
+// dryRun asks the analyzer to validate a resource without creating it,
+// prints the report and exits with a non zero code if it is invalid
+func dryRun(client *shttp.CrudClient, resource string, value interface{}) {
+	var report types.ValidationReport
+	if err := client.Validate(resource, value, &report); err != nil {
+		exitOnError(err)
+	}
+	printOutput(&report)
+
+	if !report.Valid {
 		os.Exit(1)
 	}
-	fmt.Println(string(s))
 }
@@ -85,7 +85,7 @@ var EdgeRuleCreate = &cobra.Command{
 			exitOnError(err)
 		}
 
-		printJSON(edge)
+		printOutput(edge)
 	},
 }
 
@@ -112,7 +112,7 @@ var EdgeRuleGet = &cobra.Command{
 		if err := client.Get("edgerule", args[0], &edge); err != nil {
 			exitOnError(err)
 		}
-		printJSON(&edge)
+		printOutput(&edge)
 	},
 }
 
@@ -133,7 +133,7 @@ var EdgeRuleList = &cobra.Command{
 		if err := client.List("edgerule", &edges); err != nil {
 			exitOnError(err)
 		}
-		printJSON(edges)
+		printOutput(edges)
 	},
 }
 
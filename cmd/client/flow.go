@@ -0,0 +1,213 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/websocket"
+)
+
+var (
+	flowFilter  string
+	flowCapture string
+	flowFormat  string
+	flowCount   int
+)
+
+// FlowCmd skydive flow root command
+var FlowCmd = &cobra.Command{
+	Use:          "flow",
+	Short:        "Watch flows",
+	Long:         "Watch flows",
+	SilenceUsage: false,
+}
+
+// flowTailer prints the flows received from the flow subscriber endpoint
+type flowTailer struct {
+	selector types.LabelSelector
+	json     bool
+	count    int
+	printed  int
+	done     chan struct{}
+}
+
+func flowEndpoint(l *flow.FlowLayer) string {
+	if l == nil {
+		return ""
+	}
+	return l.A + " > " + l.B
+}
+
+// formatFlow returns a tcpdump like one line description of a flow
+func formatFlow(f *flow.Flow) string {
+	var b strings.Builder
+
+	b.WriteString(time.Unix(0, f.Last*int64(time.Millisecond)).Format("15:04:05.000"))
+	b.WriteString(" " + f.Application)
+
+	switch {
+	case f.Network != nil && f.Transport != nil:
+		fmt.Fprintf(&b, " %s.%d > %s.%d", f.Network.A, f.Transport.A, f.Network.B, f.Transport.B)
+	case f.Network != nil:
+		b.WriteString(" " + flowEndpoint(f.Network))
+	case f.Link != nil:
+		b.WriteString(" " + flowEndpoint(f.Link))
+	}
+
+	if f.ICMP != nil {
+		fmt.Fprintf(&b, " %s code %d", f.ICMP.Type, f.ICMP.Code)
+		if f.ICMP.MTU != 0 {
+			fmt.Fprintf(&b, " mtu %d", f.ICMP.MTU)
+		}
+		if o := f.ICMP.Original; o != nil {
+			if o.Network != nil && o.Transport != nil {
+				fmt.Fprintf(&b, " for %s %s.%d > %s.%d", o.Transport.Protocol, o.Network.A, o.Transport.A, o.Network.B, o.Transport.B)
+			} else {
+				b.WriteString(" for " + flowEndpoint(o.Network))
+			}
+		}
+	}
+
+	if d := f.DHCP; d != nil {
+		fmt.Fprintf(&b, " %s %s", d.MessageType, d.ClientMAC)
+		if d.OfferedIP != "" {
+			fmt.Fprintf(&b, " got %s from %s lease %ds", d.OfferedIP, d.ServerIP, d.LeaseTime)
+		}
+	}
+
+	if m := f.Metric; m != nil {
+		fmt.Fprintf(&b, ", packets %d/%d, bytes %d/%d", m.ABPackets, m.BAPackets, m.ABBytes, m.BABytes)
+	}
+
+	if f.FinishType != flow.FlowFinishType_NOT_FINISHED {
+		fmt.Fprintf(&b, ", %s", f.FinishType)
+	}
+
+	fmt.Fprintf(&b, ", node %s", f.NodeTID)
+
+	return b.String()
+}
+
+// OnStructMessage websocket.SpeakerStructMessageHandler interface
+func (t *flowTailer) OnStructMessage(c websocket.Speaker, m *websocket.StructMessage) {
+	if m.Type != "store" || (t.count > 0 && t.printed >= t.count) {
+		return
+	}
+
+	var flows []*flow.Flow
+	if err := json.Unmarshal(m.Obj, &flows); err != nil {
+		logging.GetLogger().Errorf("Unable to decode flows: %s", err)
+		return
+	}
+
+	for _, f := range flows {
+		if !t.selector.Match(f) {
+			continue
+		}
+
+		if t.json {
+			b, err := json.Marshal(f)
+			if err != nil {
+				logging.GetLogger().Errorf("Unable to encode flow %s: %s", f.UUID, err)
+				continue
+			}
+			fmt.Println(string(b))
+		} else {
+			fmt.Println(formatFlow(f))
+		}
+
+		if t.printed++; t.count > 0 && t.printed == t.count {
+			close(t.done)
+			return
+		}
+	}
+}
+
+// FlowTail skydive flow tail command
+var FlowTail = &cobra.Command{
+	Use:   "tail",
+	Short: "Print the flows live",
+	Long:  "Print the flows live, as they are updated by the agents",
+	Run: func(cmd *cobra.Command, args []string) {
+		if flowFormat != "line" && flowFormat != "json" {
+			exitOnError(fmt.Errorf("Invalid output format '%s', expected line or json", flowFormat))
+		}
+
+		selector, err := types.ParseLabelSelector(flowFilter)
+		if err != nil {
+			exitOnError(fmt.Errorf("Invalid filter: %s", err))
+		}
+
+		sa, err := config.GetOneAnalyzerServiceAddress()
+		if err != nil {
+			exitOnError(err)
+		}
+
+		namespace := "flow"
+		if flowCapture != "" {
+			namespace += "/" + flowCapture
+		}
+
+		url := config.GetURL("ws", sa.Addr, sa.Port, "/ws/subscriber/flow")
+		opts := websocket.ClientOpts{
+			AuthOpts: &AuthenticationOpts,
+			Protocol: websocket.JSONProtocol,
+			Headers:  http.Header{"X-Websocket-Namespace": {namespace}},
+		}
+		client, err := config.NewWSClient(common.UnknownService, url, opts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		tailer := &flowTailer{
+			selector: selector,
+			json:     flowFormat == "json",
+			count:    flowCount,
+			done:     make(chan struct{}),
+		}
+
+		speaker := client.UpgradeToStructSpeaker()
+		speaker.AddStructMessageHandler(tailer, []string{namespace})
+
+		client.Start()
+		defer client.Stop()
+
+		<-tailer.done
+	},
+}
+
+func init() {
+	FlowCmd.AddCommand(FlowTail)
+
+	FlowTail.Flags().StringVarP(&flowFilter, "filter", "", "", "selector over the flow fields, ex: Network.A=192.168.0.1,Transport.B in (80,443)")
+	FlowTail.Flags().StringVarP(&flowCapture, "capture", "", "", "only print the flows of this capture ID")
+	FlowTail.Flags().StringVarP(&flowFormat, "format", "", "line", "output format, line or json")
+	FlowTail.Flags().IntVarP(&flowCount, "count", "c", 0, "exit after this number of flows, 0 no limit")
+}
@@ -0,0 +1,320 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/peterh/liner"
+
+	"github.com/skydive-project/skydive/api/client"
+	"github.com/skydive-project/skydive/api/types"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+)
+
+const promptGremlin = "gremlin> "
+
+// gremlinSteps are the steps completed after a dot, the ones of the
+// analyzer traversal extensions included
+var gremlinSteps = []string{
+	"V", "E", "Has", "HasKey", "HasNot", "HasEither", "Out", "In", "Both",
+	"OutV", "InV", "BothV", "OutE", "InE", "BothE", "Dedup", "ShortestPathTo",
+	"Count", "Range", "Limit", "Sort", "Values", "Keys", "Sum", "SubGraph",
+	"As", "Select", "Context", "At", "Metrics", "Flows", "Hops", "Nodes",
+	"CaptureNode", "Aggregates", "BPF", "RawPackets", "Sockets", "GroupBy",
+	"MoreThan", "Descendants", "Nexthop", "ShortestPath", "KShortestPaths",
+	"AllPaths", "Rate", "Window", "Percentile", "Diff",
+}
+
+// gremlinPredicates are the words completed as step arguments
+var gremlinPredicates = []string{
+	"Within", "Without", "Regex", "Ne", "Nee", "Lt", "Gt", "Lte", "Gte",
+	"Inside", "Between", "Ipv4Range", "Metadata", "NOW", "FOREVER", "ASC",
+	"DESC", "true", "false",
+}
+
+// gremlinSession is an interactive session issuing Gremlin queries, with
+// completion of the steps and of the metadata keys known by the analyzer
+type gremlinSession struct {
+	rl          *liner.State
+	crudClient  *shttp.CrudClient
+	queryHelper *client.GremlinQueryHelper
+	keys        []string
+	pageSize    int
+	historyFile string
+}
+
+func completeWords(words []string, prefix string, caseSensitive bool) (completions []string) {
+	for _, word := range words {
+		if strings.HasPrefix(word, prefix) || (!caseSensitive && strings.HasPrefix(strings.ToLower(word), strings.ToLower(prefix))) {
+			completions = append(completions, word)
+		}
+	}
+	return
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// completeWord completes the metadata keys inside quoted strings, the
+// steps after a dot and the predicates elsewhere
+func (s *gremlinSession) completeWord(line string, pos int) (string, []string, string) {
+	head, tail := line[:pos], line[pos:]
+
+	if i := strings.LastIndexAny(head, `'"`); i != -1 && strings.Count(head, head[i:i+1])%2 == 1 {
+		return head[:i+1], completeWords(s.keys, head[i+1:], true), tail
+	}
+
+	start := pos
+	for start > 0 && isIdentChar(head[start-1]) {
+		start--
+	}
+
+	var words []string
+	switch {
+	case start == 0:
+		words = []string{"G"}
+	case head[start-1] == '.':
+		words = gremlinSteps
+	default:
+		words = gremlinPredicates
+	}
+	return head[:start], completeWords(words, head[start:], false), tail
+}
+
+// refreshKeys retrieves the metadata keys of the nodes of the graph along
+// with the fields declared in the metadata schema of the analyzer
+func (s *gremlinSession) refreshKeys() error {
+	seen := make(map[string]bool)
+
+	var fields map[string]types.MetadataField
+	if err := s.crudClient.List("metadatafield", &fields); err != nil {
+		logging.GetLogger().Debugf("Failed to list metadata fields: %s", err)
+	}
+	for _, field := range fields {
+		seen[field.Name] = true
+	}
+
+	data, err := s.queryHelper.Query("G.V().Keys()")
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		seen[key] = true
+	}
+
+	s.keys = make([]string, 0, len(seen))
+	for key := range seen {
+		s.keys = append(s.keys, key)
+	}
+	sort.Strings(s.keys)
+
+	return nil
+}
+
+func (s *gremlinSession) loadHistory() error {
+	home, err := homeDir()
+	if err != nil {
+		return fmt.Errorf("Failed to retrieve home directory: %s", err)
+	}
+	s.historyFile = filepath.Join(home, "gremlin_history")
+
+	f, err := os.Open(s.historyFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	_, err = s.rl.ReadHistory(f)
+	return err
+}
+
+func (s *gremlinSession) saveHistory() error {
+	if err := os.MkdirAll(filepath.Dir(s.historyFile), 0750); err != nil {
+		return err
+	}
+
+	f, err := os.Create(s.historyFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = s.rl.WriteHistory(f)
+	return err
+}
+
+// page prints the result of a query, pausing every page size items
+func (s *gremlinSession) page(data []byte) error {
+	value, err := decodeOutput(data)
+	if err != nil {
+		return err
+	}
+
+	rows := outputRows(value)
+	columns := outputColumns(rows)
+	pageSize := s.pageSize
+	if pageSize <= 0 {
+		pageSize = len(rows)
+	}
+
+	for offset := 0; offset < len(rows); offset += pageSize {
+		end := offset + pageSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		out, err := renderOutput(rows[offset:end], columns)
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(out)
+
+		if end < len(rows) {
+			answer, err := s.rl.Prompt(fmt.Sprintf("-- %d/%d items, Enter for more, q to stop -- ", end, len(rows)))
+			if err != nil || strings.HasPrefix(answer, "q") {
+				break
+			}
+		}
+	}
+
+	fmt.Printf("%d items\n", len(rows))
+	return nil
+}
+
+// command runs the session commands, prefixed with a colon
+func (s *gremlinSession) command(in string) (quit bool, err error) {
+	args := strings.Fields(in)
+	switch args[0] {
+	case ":quit", ":q":
+		return true, nil
+	case ":keys":
+		if err := s.refreshKeys(); err != nil {
+			return false, err
+		}
+		fmt.Printf("%d metadata keys\n", len(s.keys))
+	case ":page":
+		if len(args) != 2 {
+			fmt.Printf("page size: %d\n", s.pageSize)
+			break
+		}
+		size, err := strconv.Atoi(args[1])
+		if err != nil || size < 0 {
+			return false, fmt.Errorf("Invalid page size: %s", args[1])
+		}
+		s.pageSize = size
+	case ":help":
+		fmt.Println(":keys       reload the metadata keys used for completion")
+		fmt.Println(":page [n]   show or set the number of items per page, 0 to disable paging")
+		fmt.Println(":quit       leave the shell")
+	default:
+		return false, fmt.Errorf("Unknown command %s, see :help", args[0])
+	}
+	return false, nil
+}
+
+func (s *gremlinSession) prompt() error {
+	for {
+		in, err := s.rl.Prompt(promptGremlin)
+		if err == liner.ErrPromptAborted {
+			fmt.Println("(^D to quit)")
+			continue
+		} else if err == io.EOF {
+			fmt.Println()
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		in = strings.TrimSpace(in)
+		if in == "" {
+			continue
+		}
+		s.rl.AppendHistory(in)
+
+		if strings.HasPrefix(in, ":") {
+			quit, err := s.command(in)
+			if err != nil {
+				fmt.Println(err)
+			}
+			if quit {
+				return nil
+			}
+			continue
+		}
+
+		data, err := s.queryHelper.Query(in)
+		if err == nil {
+			err = s.page(data)
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// newGremlinSession creates a Gremlin session, completion being disabled
+// if the metadata keys can not be retrieved
+func newGremlinSession(pageSize int) (*gremlinSession, error) {
+	crudClient, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &gremlinSession{
+		rl:          liner.NewLiner(),
+		crudClient:  crudClient,
+		queryHelper: client.NewGremlinQueryHelper(&AuthenticationOpts),
+		pageSize:    pageSize,
+	}
+	s.rl.SetCtrlCAborts(true)
+	s.rl.SetWordCompleter(s.completeWord)
+
+	if err := s.refreshKeys(); err != nil {
+		logging.GetLogger().Warningf("Failed to retrieve the metadata keys: %s", err)
+	}
+
+	if err := s.loadHistory(); err != nil {
+		s.rl.Close()
+		return nil, fmt.Errorf("while reading history: %s", err)
+	}
+
+	return s, nil
+}
+
+// Close the session
+func (s *gremlinSession) Close() error {
+	return s.rl.Close()
+}
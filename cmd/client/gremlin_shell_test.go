@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGremlinCompletion(t *testing.T) {
+	s := &gremlinSession{keys: []string{"MTU", "Name", "Namespace", "Type"}}
+
+	tests := []struct {
+		line        string
+		pos         int
+		head        string
+		completions []string
+		tail        string
+	}{
+		{line: "g", pos: 1, completions: []string{"G"}},
+		{line: "G.V().Ha", pos: 8, head: "G.V().", completions: []string{"Has", "HasKey", "HasNot", "HasEither"}},
+		{line: "G.V().ou", pos: 8, head: "G.V().", completions: []string{"Out", "OutV", "OutE"}},
+		{line: "G.V().Ou.Count()", pos: 8, head: "G.V().", completions: []string{"Out", "OutV", "OutE"}, tail: ".Count()"},
+		{line: "G.V().Has('Na", pos: 13, head: "G.V().Has('", completions: []string{"Name", "Namespace"}},
+		{line: "G.V().Has('na", pos: 13, head: "G.V().Has('"},
+		{line: "G.V().Has('Name', 'eth0', \"T", pos: 28, head: "G.V().Has('Name', 'eth0', \"", completions: []string{"Type"}},
+		{line: "G.V().Has('Type', Wi", pos: 20, head: "G.V().Has('Type', ", completions: []string{"Within", "Without"}},
+	}
+
+	for _, test := range tests {
+		head, completions, tail := s.completeWord(test.line, test.pos)
+		if head != test.head || tail != test.tail || !reflect.DeepEqual(completions, test.completions) {
+			t.Errorf("%s: expected %q %v %q, got %q %v %q", test.line, test.head, test.completions, test.tail, head, completions, tail)
+		}
+	}
+}
+
+func TestGremlinCommands(t *testing.T) {
+	s := &gremlinSession{pageSize: 50}
+
+	if quit, err := s.command(":page 20"); quit || err != nil || s.pageSize != 20 {
+		t.Errorf("The page size should be set, got %d (%v)", s.pageSize, err)
+	}
+
+	if _, err := s.command(":page 0"); err != nil || s.pageSize != 0 {
+		t.Errorf("Paging should be disabled, got %d (%v)", s.pageSize, err)
+	}
+
+	for _, in := range []string{":page -1", ":page ten", ":unknown"} {
+		if _, err := s.command(in); err == nil {
+			t.Errorf("%s should fail", in)
+		}
+	}
+	if s.pageSize != 0 {
+		t.Errorf("An invalid page size should be ignored, got %d", s.pageSize)
+	}
+
+	for _, in := range []string{":quit", ":q"} {
+		if quit, err := s.command(in); !quit || err != nil {
+			t.Errorf("%s should leave the shell", in)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skydive-project/skydive/api/client"
+	"github.com/skydive-project/skydive/api/types"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+)
+
+var (
+	jobPage types.Pagination
+	jobWait bool
+)
+
+// JobCmd skydive job root command
+var JobCmd = &cobra.Command{
+	Use:          "job",
+	Short:        "Manage asynchronous query jobs",
+	Long:         "Manage asynchronous query jobs",
+	SilenceUsage: false,
+}
+
+func requireJobArgs(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+}
+
+func getJobResult(client *shttp.CrudClient, id string) ([]byte, error) {
+	resp, err := client.Request("GET", "job/"+id+"/result", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, string(data))
+	}
+	return data, nil
+}
+
+func printJobResult(client *shttp.CrudClient, id string) {
+	data, err := getJobResult(client, id)
+	if err != nil {
+		exitOnError(err)
+	}
+
+	printRawOutput(data)
+}
+
+// JobSubmit skydive job submit command
+var JobSubmit = &cobra.Command{
+	Use:    "submit [gremlin]",
+	Short:  "Submit a Gremlin query to be run asynchronously",
+	Long:   "Submit a Gremlin query to be run asynchronously",
+	PreRun: requireJobArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		bindings, err := parseBindings(queryBindings)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		s, err := json.Marshal(&types.TopologyParams{
+			GremlinQuery: args[0],
+			Bindings:     bindings,
+			Pagination:   jobPage,
+		})
+		if err != nil {
+			exitOnError(err)
+		}
+
+		resp, err := client.Request("POST", "job", bytes.NewReader(s), nil)
+		if err != nil {
+			exitOnError(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusAccepted {
+			data, _ := ioutil.ReadAll(resp.Body)
+			exitOnError(fmt.Errorf("%s: %s", resp.Status, string(data)))
+		}
+
+		var job types.Job
+		if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+			exitOnError(err)
+		}
+
+		if !jobWait {
+			printOutput(&job)
+			return
+		}
+
+		for job.State == types.JobPending || job.State == types.JobRunning {
+			time.Sleep(time.Second)
+			if err := client.Get("job", job.ID, &job); err != nil {
+				exitOnError(err)
+			}
+		}
+		if job.State == types.JobFailed {
+			exitOnError(fmt.Errorf("Job %s failed: %s", job.ID, job.Error))
+		}
+
+		printJobResult(client, job.ID)
+	},
+}
+
+// JobList skydive job list command
+var JobList = &cobra.Command{
+	Use:   "list",
+	Short: "List jobs",
+	Long:  "List jobs",
+	Run: func(cmd *cobra.Command, args []string) {
+		var jobs []types.Job
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.List("job", &jobs); err != nil {
+			exitOnError(err)
+		}
+		printOutput(jobs)
+	},
+}
+
+// JobGet skydive job get command
+var JobGet = &cobra.Command{
+	Use:    "get [job]",
+	Short:  "Display job",
+	Long:   "Display job",
+	PreRun: requireJobArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var job types.Job
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.Get("job", args[0], &job); err != nil {
+			exitOnError(err)
+		}
+		printOutput(&job)
+	},
+}
+
+// JobResult skydive job result command
+var JobResult = &cobra.Command{
+	Use:    "result [job]",
+	Short:  "Display the result of a completed job",
+	Long:   "Display the result of a completed job",
+	PreRun: requireJobArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		printJobResult(client, args[0])
+	},
+}
+
+// JobDelete skydive job delete command
+var JobDelete = &cobra.Command{
+	Use:    "delete [job]",
+	Short:  "Delete job",
+	Long:   "Delete job",
+	PreRun: requireJobArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		for _, id := range args {
+			if err := client.Delete("job", id); err != nil {
+				logging.GetLogger().Error(err)
+			}
+		}
+	},
+}
+
+func init() {
+	JobCmd.AddCommand(JobSubmit)
+	JobCmd.AddCommand(JobList)
+	JobCmd.AddCommand(JobGet)
+	JobCmd.AddCommand(JobResult)
+	JobCmd.AddCommand(JobDelete)
+
+	JobSubmit.Flags().StringArrayVarP(&queryBindings, "bind", "", []string{}, "Value of a $name query parameter, as name=value")
+	JobSubmit.Flags().IntVarP(&jobPage.Limit, "limit", "", 0, "Maximum number of items returned, 0: no limit")
+	JobSubmit.Flags().IntVarP(&jobPage.Offset, "offset", "", 0, "Number of items skipped")
+	JobSubmit.Flags().StringVarP(&jobPage.SortBy, "sort-by", "", "", "Field the items are sorted by")
+	JobSubmit.Flags().StringVarP(&jobPage.SortOrder, "sort-order", "", "", "Sort order, ASC or DESC")
+	JobSubmit.Flags().StringSliceVarP(&jobPage.Fields, "fields", "", []string{}, "JSON fields of the items to return, ex: ID,Metadata.Name")
+	JobSubmit.Flags().BoolVarP(&jobWait, "wait", "", false, "Wait for the job to complete and display its result")
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/skydive-project/skydive/api/client"
+	"github.com/skydive-project/skydive/common"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	loggingAgent   string
+	loggingLevel   string
+	loggingModules []string
+)
+
+// LoggingCmd implements the skydive 'logging' command that shows or
+// changes the logging levels of an analyzer or an agent
+var LoggingCmd = &cobra.Command{
+	Use:   "logging",
+	Short: "Show or change the logging levels",
+	Long:  "Show the logging levels of an analyzer or an agent, or change them with --level and --module",
+	Example: `skydive client logging --module flow/server=DEBUG
+skydive client logging --agent 192.168.0.10:8081 --module flow/server=`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var restClient *shttp.RestClient
+		var err error
+		if loggingAgent != "" {
+			restClient, err = newAgentRestClient(loggingAgent)
+		} else {
+			restClient, err = client.NewRestClientFromConfig(&AuthenticationOpts)
+		}
+		if err != nil {
+			exitOnError(err)
+		}
+
+		method := "GET"
+		var body io.Reader
+		if loggingLevel != "" || len(loggingModules) > 0 {
+			levels := logging.Levels{Level: loggingLevel, Modules: make(map[string]string)}
+			for _, module := range loggingModules {
+				kv := strings.SplitN(module, "=", 2)
+				if len(kv) != 2 {
+					exitOnError(fmt.Errorf("Invalid module level %s, expected module=LEVEL", module))
+				}
+				levels.Modules[kv[0]] = kv[1]
+			}
+
+			data, err := json.Marshal(&levels)
+			if err != nil {
+				exitOnError(err)
+			}
+			method, body = "PUT", bytes.NewBuffer(data)
+		}
+
+		resp, err := restClient.Request(method, "logging", body, nil)
+		if err != nil {
+			exitOnError(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			data, _ := ioutil.ReadAll(resp.Body)
+			exitOnError(fmt.Errorf("Failed to %s logging levels, %s: %s", strings.ToLower(method), resp.Status, data))
+		}
+
+		var levels logging.Levels
+		if err := common.JSONDecode(resp.Body, &levels); err != nil {
+			exitOnError(err)
+		}
+
+		printOutput(&levels)
+	},
+}
+
+func init() {
+	LoggingCmd.Flags().StringVarP(&loggingAgent, "agent", "", "", "API address of an agent, ex: 192.168.0.10:8081, the analyzer being used otherwise")
+	LoggingCmd.Flags().StringVarP(&loggingLevel, "level", "", "", "level of all the backends: CRITICAL, ERROR, WARNING, NOTICE, INFO or DEBUG")
+	LoggingCmd.Flags().StringSliceVarP(&loggingModules, "module", "", []string{}, "level of a module, ex: flow/server=DEBUG, an empty level removing the override")
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/skydive-project/skydive/api/client"
+	api "github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+	"github.com/skydive-project/skydive/validator"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	fieldType     string
+	fieldTypes    []string
+	fieldRequired bool
+	fieldIndex    string
+)
+
+// MetadataFieldCmd skydive metadata field root command
+var MetadataFieldCmd = &cobra.Command{
+	Use:          "metadata-field",
+	Short:        "metadata-field",
+	Long:         "metadata-field",
+	SilenceUsage: false,
+}
+
+// MetadataFieldCreate skydive metadata field create command
+var MetadataFieldCreate = &cobra.Command{
+	Use:          "create",
+	Short:        "create",
+	Long:         "create",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		field := &api.MetadataField{
+			MetadataField: topology.MetadataField{
+				Name:     name,
+				Type:     fieldType,
+				Types:    fieldTypes,
+				Required: fieldRequired,
+				Index:    fieldIndex,
+			},
+			Description: description,
+		}
+
+		if err = validator.Validate(field); err != nil {
+			exitOnError(fmt.Errorf("Error while validating metadata field: %s", err))
+		}
+
+		if err = client.Create("metadatafield", &field, nil); err != nil {
+			exitOnError(err)
+		}
+
+		printOutput(field)
+	},
+}
+
+// MetadataFieldGet skydive metadata field get command
+var MetadataFieldGet = &cobra.Command{
+	Use:          "get",
+	Short:        "get",
+	Long:         "get",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var field api.MetadataField
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+		if err := client.Get("metadatafield", args[0], &field); err != nil {
+			exitOnError(err)
+		}
+		printOutput(&field)
+	},
+}
+
+// MetadataFieldList skydive metadata field list command
+var MetadataFieldList = &cobra.Command{
+	Use:          "list",
+	Short:        "list",
+	Long:         "list",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var fields map[string]api.MetadataField
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.List("metadatafield", &fields); err != nil {
+			exitOnError(err)
+		}
+		printOutput(fields)
+	},
+}
+
+// MetadataFieldDelete skydive metadata field delete command
+var MetadataFieldDelete = &cobra.Command{
+	Use:          "delete",
+	Short:        "delete",
+	Long:         "delete",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		for _, id := range args {
+			if err := client.Delete("metadatafield", id); err != nil {
+				logging.GetLogger().Error(err.Error())
+			}
+		}
+	},
+}
+
+func init() {
+	MetadataFieldCmd.AddCommand(MetadataFieldCreate)
+	MetadataFieldCmd.AddCommand(MetadataFieldList)
+	MetadataFieldCmd.AddCommand(MetadataFieldGet)
+	MetadataFieldCmd.AddCommand(MetadataFieldDelete)
+
+	MetadataFieldCreate.Flags().StringVarP(&name, "name", "", "", "metadata key, dot separated for nested keys")
+	MetadataFieldCreate.Flags().StringVarP(&description, "description", "", "", "field description")
+	MetadataFieldCreate.Flags().StringVarP(&fieldType, "type", "", "string", "field type: string, integer, number, boolean, object or array")
+	MetadataFieldCreate.Flags().StringSliceVarP(&fieldTypes, "element-types", "", nil, "node types or edge relation types the field applies to")
+	MetadataFieldCreate.Flags().BoolVarP(&fieldRequired, "required", "", false, "whether the field is required")
+	MetadataFieldCreate.Flags().StringVarP(&fieldIndex, "index", "", "", "indexing hint: keyword, text or none")
+}
@@ -93,7 +93,7 @@ var NodeRuleCreate = &cobra.Command{
 			exitOnError(err)
 		}
 
-		printJSON(node)
+		printOutput(node)
 	},
 }
 
@@ -122,7 +122,7 @@ var NodeRuleGet = &cobra.Command{
 			logging.GetLogger().Error(err.Error())
 			os.Exit(1)
 		}
-		printJSON(&node)
+		printOutput(&node)
 	},
 }
 
@@ -145,7 +145,7 @@ var NodeRuleList = &cobra.Command{
 			logging.GetLogger().Error(err.Error())
 			os.Exit(1)
 		}
-		printJSON(nodes)
+		printOutput(nodes)
 	},
 }
 
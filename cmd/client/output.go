@@ -0,0 +1,333 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Output formats of the --output flag
+const (
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputTable = "table"
+	outputCSV   = "csv"
+)
+
+var (
+	outputMode   string
+	outputFields []string
+)
+
+func checkOutputMode() error {
+	switch outputMode {
+	case outputJSON, outputYAML, outputTable, outputCSV:
+		return nil
+	}
+	return fmt.Errorf("Invalid output format '%s', expected json, yaml, table or csv", outputMode)
+}
+
+// normalizeOutput converts a value to its JSON representation made of maps,
+// slices and scalars, integers being kept as such
+func normalizeOutput(obj interface{}) (interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	return decodeOutput(data)
+}
+
+func decodeOutput(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return convertNumbers(value), nil
+}
+
+func convertNumbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	case map[string]interface{}:
+		for k, v := range value {
+			value[k] = convertNumbers(v)
+		}
+	case []interface{}:
+		for i, v := range value {
+			value[i] = convertNumbers(v)
+		}
+	}
+	return value
+}
+
+// lookupField returns the value of a dotted field path like Metadata.Name,
+// list items being selected by their index
+func lookupField(value interface{}, path string) (interface{}, bool) {
+	if m, ok := value.(map[string]interface{}); ok {
+		if v, found := m[path]; found {
+			return v, true
+		}
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var found bool
+			if value, found = v[key]; !found {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// isCollection returns whether a value is a map of objects, as returned
+// when listing resources by ID
+func isCollection(value interface{}) bool {
+	m, ok := value.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		return false
+	}
+	for _, v := range m {
+		if _, ok := v.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// outputRows returns the items of a value, each being rendered as a row
+func outputRows(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		if !isCollection(v) {
+			break
+		}
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		rows := make([]interface{}, len(keys))
+		for i, k := range keys {
+			rows[i] = v[k]
+		}
+		return rows
+	}
+	return []interface{}{value}
+}
+
+// outputColumns returns the sorted keys of the rows holding scalar values
+func outputColumns(rows []interface{}) []string {
+	keys := make(map[string]bool)
+	for _, row := range rows {
+		if m, ok := row.(map[string]interface{}); ok {
+			for k, v := range m {
+				switch v.(type) {
+				case map[string]interface{}, []interface{}:
+				default:
+					keys[k] = true
+				}
+			}
+		}
+	}
+
+	columns := make([]string, 0, len(keys))
+	for k := range keys {
+		columns = append(columns, k)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+func formatCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64, float64, bool:
+		return fmt.Sprintf("%v", v)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// projectFields keeps only the selected fields of the items of a value
+func projectFields(value interface{}, fields []string) interface{} {
+	project := func(item interface{}) interface{} {
+		projected := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			if v, found := lookupField(item, field); found {
+				projected[field] = v
+			}
+		}
+		return projected
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = project(item)
+		}
+		return items
+	case map[string]interface{}:
+		if isCollection(v) {
+			items := make(map[string]interface{}, len(v))
+			for k, item := range v {
+				items[k] = project(item)
+			}
+			return items
+		}
+	}
+	return project(value)
+}
+
+func renderRecords(value interface{}, columns []string) [][]string {
+	rows := outputRows(value)
+	if len(columns) == 0 {
+		columns = outputColumns(rows)
+	}
+
+	records := [][]string{columns}
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			if v, found := lookupField(row, column); found {
+				record[i] = formatCell(v)
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// renderOutput renders a normalized value in the selected output format,
+// the columns of the table and CSV formats defaulting to the scalar fields
+func renderOutput(value interface{}, columns []string) ([]byte, error) {
+	if len(outputFields) > 0 {
+		columns = outputFields
+	}
+
+	var b bytes.Buffer
+	switch outputMode {
+	case outputYAML:
+		if len(outputFields) > 0 {
+			value = projectFields(value, outputFields)
+		}
+		return yaml.Marshal(value)
+	case outputTable:
+		w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+		for _, record := range renderRecords(value, columns) {
+			fmt.Fprintln(w, strings.Join(record, "\t"))
+		}
+		w.Flush()
+	case outputCSV:
+		w := csv.NewWriter(&b)
+		w.WriteAll(renderRecords(value, columns))
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+	default:
+		if len(outputFields) > 0 {
+			value = projectFields(value, outputFields)
+		}
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), nil
+}
+
+func writeOutput(value interface{}, columns []string) {
+	data, err := renderOutput(value, columns)
+	if err != nil {
+		exitOnError(err)
+	}
+	os.Stdout.Write(data)
+}
+
+// printOutput prints an object in the format selected with --output
+func printOutput(obj interface{}) {
+	// keep the field order of the structures in the default mode
+	if outputMode == outputJSON && len(outputFields) == 0 {
+		s, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			exitOnError(err)
+		}
+		fmt.Println(string(s))
+		return
+	}
+
+	value, err := normalizeOutput(obj)
+	if err != nil {
+		exitOnError(err)
+	}
+	writeOutput(value, nil)
+}
+
+// printRawOutput prints a JSON document returned by the API in the format
+// selected with --output
+func printRawOutput(data []byte) {
+	if outputMode == outputJSON && len(outputFields) == 0 {
+		var out bytes.Buffer
+		json.Indent(&out, data, "", "\t")
+		out.WriteTo(os.Stdout)
+		return
+	}
+
+	value, err := decodeOutput(data)
+	if err != nil {
+		exitOnError(err)
+	}
+	writeOutput(value, nil)
+}
@@ -34,6 +34,8 @@ import (
 var (
 	srcNode string
 	dstNode string
+
+	injectionDryRun bool
 )
 
 // PacketInjectorCmd skydive inject-packet root command
@@ -63,6 +65,7 @@ var PacketInjectionCreate = &cobra.Command{
 		}
 
 		packet := &api.PacketInjection{
+			Name:             name,
 			Src:              srcNode,
 			Dst:              dstNode,
 			SrcPort:          request.SrcPort,
@@ -76,6 +79,11 @@ var PacketInjectionCreate = &cobra.Command{
 			Mode:             request.Mode,
 			IncrementPayload: request.IncrementPayload,
 			TTL:              request.TTL,
+			Rate:             request.Rate,
+			Duration:         request.Duration,
+			PayloadLengthMin: request.PayloadLengthMin,
+			PayloadLengthMax: request.PayloadLengthMax,
+			TCPHandshake:     request.TCPHandshake,
 		}
 
 		if request.SrcIP != nil {
@@ -94,12 +102,22 @@ var PacketInjectionCreate = &cobra.Command{
 			packet.DstMAC = request.DstMAC.String()
 		}
 
+		if injectionDryRun {
+			dryRun(crudClient, "injectpacket", packet)
+			return
+		}
+
 		if err = validator.Validate(packet); err != nil {
 			exitOnError(err)
 		}
 
 		ttl := 5 * time.Second
-		if packet.Interval != 0 {
+		switch {
+		case packet.Duration != 0:
+			ttl = time.Duration(packet.Duration)*time.Second + 5*time.Second
+		case packet.Rate != 0:
+			ttl = time.Duration(packet.Count)*time.Second/time.Duration(packet.Rate) + 5*time.Second
+		case packet.Interval != 0:
 			ttl = time.Duration(packet.Interval*packet.Count)*time.Millisecond + 5*time.Second
 		}
 		createOpts := &http.CreateOptions{TTL: ttl}
@@ -108,7 +126,7 @@ var PacketInjectionCreate = &cobra.Command{
 			exitOnError(err)
 		}
 
-		printJSON(packet)
+		printOutput(packet)
 	},
 }
 
@@ -133,7 +151,7 @@ var PacketInjectionGet = &cobra.Command{
 		if err := client.Get("injectpacket", args[0], &injection); err != nil {
 			exitOnError(err)
 		}
-		printJSON(&injection)
+		printOutput(&injection)
 	},
 }
 
@@ -152,7 +170,7 @@ var PacketInjectionList = &cobra.Command{
 		if err := client.List("injectpacket", &injections); err != nil {
 			exitOnError(err)
 		}
-		printJSON(injections)
+		printOutput(injections)
 	},
 }
 
@@ -189,5 +207,7 @@ func init() {
 
 	PacketInjectionCreate.Flags().StringVarP(&srcNode, "src", "", "", "source node gremlin expression (mandatory)")
 	PacketInjectionCreate.Flags().StringVarP(&dstNode, "dst", "", "", "destination node gremlin expression")
+	PacketInjectionCreate.Flags().StringVarP(&name, "name", "", "", "injection name")
+	PacketInjectionCreate.Flags().BoolVarP(&injectionDryRun, "dry-run", "", false, "validate the injection against the topology without creating it")
 	injector.AddInjectPacketInjectFlags(PacketInjectionCreate)
 }
@@ -0,0 +1,324 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skydive-project/skydive/api/client"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/gremlin"
+)
+
+var (
+	pathRelationType string
+	pathSince        time.Duration
+	pathFormat       string
+)
+
+// pathHop describes a node of the path between two endpoints along with
+// the flows recently captured on it
+type pathHop struct {
+	TID      string
+	Name     string
+	Type     string
+	Host     string
+	Captures []string
+	Flows    int
+	Packets  int64
+	Bytes    int64
+	NAT      []string `json:",omitempty"`
+}
+
+// pathEndpointQuery returns the query of the nodes matching an endpoint,
+// given as a Gremlin expression, an IP address, a TID or a node name
+func pathEndpointQuery(endpoint string) gremlin.QueryString {
+	var query gremlin.QueryString
+	switch {
+	case strings.HasPrefix(endpoint, "G.") || strings.HasPrefix(endpoint, "g."):
+		query = gremlin.QueryString(endpoint)
+	case net.ParseIP(endpoint) != nil:
+		key := "IPV4"
+		if net.ParseIP(endpoint).To4() == nil {
+			key = "IPV6"
+		}
+		query = gremlin.G.V().Has(key, gremlin.Regex("^"+regexp.QuoteMeta(endpoint)+"/.*"))
+	default:
+		query = gremlin.G.V().HasEither("TID", endpoint, "Name", endpoint)
+	}
+
+	return query.HasKey("TID")
+}
+
+// resolvePathEndpoint returns the node matching an endpoint
+func resolvePathEndpoint(queryHelper *client.GremlinQueryHelper, endpoint string) (*graph.Node, error) {
+	nodes, err := queryHelper.GetNodes(pathEndpointQuery(endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(nodes) {
+	case 0:
+		return nil, fmt.Errorf("No node found for %s", endpoint)
+	case 1:
+		return nodes[0], nil
+	}
+
+	var candidates []string
+	for _, node := range nodes {
+		tid, _ := node.Metadata.GetFieldString("TID")
+		name, _ := node.Metadata.GetFieldString("Name")
+		candidates = append(candidates, fmt.Sprintf("%s (host: %s, TID: %s)", name, node.Host, tid))
+	}
+	return nil, fmt.Errorf("%s matches several nodes, use a TID or a Gremlin expression, candidates:\n  %s", endpoint, strings.Join(candidates, "\n  "))
+}
+
+// nodeAddresses returns the IP addresses of a node, without their prefix length
+func nodeAddresses(node *graph.Node) (addresses []string) {
+	for _, key := range []string{"IPV4", "IPV6"} {
+		cidrs, _ := node.GetFieldStringList(key)
+		for _, cidr := range cidrs {
+			addresses = append(addresses, strings.SplitN(cidr, "/", 2)[0])
+		}
+	}
+	return
+}
+
+// nodeCaptures returns the IDs and states of the captures running on a
+// node, as reported in its Captures metadata
+func nodeCaptures(node *graph.Node) (captures []string) {
+	value, err := node.GetField("Captures")
+	if err != nil {
+		return nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+
+	var metadata []struct {
+		ID    string
+		Type  string
+		State string
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil
+	}
+
+	for _, capture := range metadata {
+		captures = append(captures, fmt.Sprintf("%s:%s:%s", capture.ID, capture.Type, capture.State))
+	}
+	return
+}
+
+func formatNAT(nat *flow.NAT) string {
+	var kinds []string
+	if nat.SNAT {
+		kinds = append(kinds, "SNAT")
+	}
+	if nat.DNAT {
+		kinds = append(kinds, "DNAT")
+	}
+	return fmt.Sprintf("%s %s:%d>%s:%d => %s:%d>%s:%d", strings.Join(kinds, "+"),
+		nat.OriginalA, nat.OriginalPortA, nat.OriginalB, nat.OriginalPortB,
+		nat.TranslatedA, nat.TranslatedPortA, nat.TranslatedB, nat.TranslatedPortB)
+}
+
+// pathHops returns the hops of a path, with the captures running on them
+// and the totals of the flows captured on them
+func pathHops(path []*graph.Node, flows []*flow.Flow) []*pathHop {
+	hops := make([]*pathHop, len(path))
+	byTID := make(map[string]*pathHop)
+	for i, node := range path {
+		hop := &pathHop{Host: node.Host, Captures: nodeCaptures(node)}
+		hop.TID, _ = node.GetFieldString("TID")
+		hop.Name, _ = node.GetFieldString("Name")
+		hop.Type, _ = node.GetFieldString("Type")
+
+		hops[i], byTID[hop.TID] = hop, hop
+	}
+
+	for _, f := range flows {
+		hop, found := byTID[f.NodeTID]
+		if !found {
+			continue
+		}
+		hop.Flows++
+		if f.Metric != nil {
+			hop.Packets += f.Metric.ABPackets + f.Metric.BAPackets
+			hop.Bytes += f.Metric.ABBytes + f.Metric.BABytes
+		}
+		if f.NAT != nil {
+			hop.NAT = append(hop.NAT, formatNAT(f.NAT))
+		}
+	}
+
+	return hops
+}
+
+// pathFlows returns the recent flows of the path nodes between the given
+// addresses. The addresses translated by the NAT mappings of the flows are
+// followed, so that the flows captured after a translation are returned too
+func pathFlows(queryHelper *client.GremlinQueryHelper, tids []interface{}, addresses []string) ([]*flow.Flow, error) {
+	known := make(map[string]bool)
+	for _, address := range addresses {
+		known[address] = true
+	}
+
+	var flows []*flow.Flow
+	for len(addresses) > 0 {
+		values := make([]interface{}, len(addresses))
+		for i, address := range addresses {
+			values[i] = address
+		}
+
+		query := gremlin.G
+		if pathSince > 0 {
+			query = query.Context(time.Now(), int64(pathSince.Seconds()))
+		}
+		query = query.V().Has("TID", gremlin.Within(tids...)).Flows().Has("Network", gremlin.Within(values...)).Dedup()
+
+		found, err := queryHelper.GetFlows(query)
+		if err != nil {
+			return nil, err
+		}
+
+		addresses = nil
+		for _, f := range found {
+			if f.NAT == nil {
+				continue
+			}
+			for _, address := range []string{f.NAT.OriginalA, f.NAT.OriginalB, f.NAT.TranslatedA, f.NAT.TranslatedB} {
+				if address != "" && !known[address] {
+					known[address] = true
+					addresses = append(addresses, address)
+				}
+			}
+		}
+
+		flows = append(flows, found...)
+	}
+
+	return flows, nil
+}
+
+// PathCmd skydive path command
+var PathCmd = &cobra.Command{
+	Use:   "path <src> <dst>",
+	Short: "Print the path between two endpoints",
+	Long: "Print hop by hop the shortest path between two endpoints, given as IP addresses, node names, TIDs or Gremlin expressions, " +
+		"with the captures running on each hop and the flows recently captured between the endpoints",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+		if pathFormat != "text" && pathFormat != "json" {
+			exitOnError(fmt.Errorf("Invalid format %s, expected text or json", pathFormat))
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		queryHelper := client.NewGremlinQueryHelper(&AuthenticationOpts)
+
+		src, err := resolvePathEndpoint(queryHelper, args[0])
+		if err != nil {
+			exitOnError(err)
+		}
+		dst, err := resolvePathEndpoint(queryHelper, args[1])
+		if err != nil {
+			exitOnError(err)
+		}
+
+		srcTID, _ := src.GetFieldString("TID")
+		dstTID, _ := dst.GetFieldString("TID")
+
+		query := gremlin.G.V().Has("TID", srcTID)
+		if pathRelationType != "" {
+			query = query.ShortestPathTo(gremlin.Metadata("TID", dstTID), gremlin.Metadata("RelationType", pathRelationType))
+		} else {
+			query = query.ShortestPathTo(gremlin.Metadata("TID", dstTID))
+		}
+
+		data, err := queryHelper.Query(query)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		var paths [][]*graph.Node
+		if err := json.Unmarshal(data, &paths); err != nil {
+			exitOnError(err)
+		}
+		if len(paths) == 0 || len(paths[0]) == 0 {
+			exitOnError(errors.New("No path found between the endpoints"))
+		}
+
+		tids := make([]interface{}, len(paths[0]))
+		for i, node := range paths[0] {
+			tids[i], _ = node.GetFieldString("TID")
+		}
+
+		var addresses []string
+		for _, endpoint := range args {
+			if net.ParseIP(endpoint) != nil {
+				addresses = append(addresses, endpoint)
+			}
+		}
+		addresses = append(addresses, nodeAddresses(src)...)
+		addresses = append(addresses, nodeAddresses(dst)...)
+
+		flows, err := pathFlows(queryHelper, tids, addresses)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		hops := pathHops(paths[0], flows)
+		if pathFormat == "json" {
+			printOutput(hops)
+			return
+		}
+
+		for i, hop := range hops {
+			captures := "no capture"
+			if len(hop.Captures) > 0 {
+				captures = "captures: " + strings.Join(hop.Captures, ", ")
+			}
+			fmt.Printf("%2d  %s (%s, host: %s, TID: %s)  %s  flows: %d, packets: %d, bytes: %d\n",
+				i+1, hop.Name, hop.Type, hop.Host, hop.TID, captures, hop.Flows, hop.Packets, hop.Bytes)
+			for _, nat := range hop.NAT {
+				fmt.Printf("      %s\n", nat)
+			}
+		}
+	},
+}
+
+func init() {
+	PathCmd.Flags().StringVarP(&pathRelationType, "relation-type", "", "layer2", "relation type of the edges followed by the path, all the edges if empty")
+	PathCmd.Flags().DurationVarP(&pathSince, "since", "", 0, "time window of the flows, ex: 5m, the live flows if not set")
+	PathCmd.Flags().StringVarP(&pathFormat, "format", "", "text", "output format, text or json")
+}
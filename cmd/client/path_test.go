@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+func TestPathEndpointQuery(t *testing.T) {
+	tests := map[string]string{
+		"10.0.0.1":                  `G.V().Has("IPV4", Regex("^10\\.0\\.0\\.1/.*")).HasKey("TID")`,
+		"fe80::1":                   `G.V().Has("IPV6", Regex("^fe80::1/.*")).HasKey("TID")`,
+		"eth0":                      `G.V().HasEither("TID", "eth0", "Name", "eth0").HasKey("TID")`,
+		"G.V().Has('Name', 'eth0')": `G.V().Has('Name', 'eth0').HasKey("TID")`,
+	}
+
+	for endpoint, expected := range tests {
+		if query := pathEndpointQuery(endpoint).String(); query != expected {
+			t.Errorf("%s: expected %s, got %s", endpoint, expected, query)
+		}
+	}
+}
+
+func decodePath(t *testing.T, data string) (path []*graph.Node) {
+	if err := json.Unmarshal([]byte(data), &path); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestPathHops(t *testing.T) {
+	path := decodePath(t, `[
+		{"ID": "n1", "Host": "host1", "Metadata": {"TID": "t1", "Name": "eth0", "Type": "device",
+			"IPV4": ["10.0.0.1/24"], "IPV6": ["fe80::1/64"],
+			"Captures": [{"ID": "c1", "Type": "pcap", "State": "active"}]}},
+		{"ID": "n2", "Host": "host1", "Metadata": {"TID": "t2", "Name": "br0", "Type": "bridge"}},
+		{"ID": "n3", "Host": "host2", "Metadata": {"TID": "t3", "Name": "eth1", "Type": "device"}}
+	]`)
+
+	if addresses := nodeAddresses(path[0]); !reflect.DeepEqual(addresses, []string{"10.0.0.1", "fe80::1"}) {
+		t.Errorf("Unexpected addresses: %v", addresses)
+	}
+
+	nat := &flow.NAT{
+		SNAT: true, DNAT: true,
+		OriginalA: "10.0.0.1", OriginalPortA: 3456, OriginalB: "172.16.0.1", OriginalPortB: 80,
+		TranslatedA: "192.168.0.1", TranslatedPortA: 4567, TranslatedB: "10.0.1.2", TranslatedPortB: 8080,
+	}
+
+	flows := []*flow.Flow{
+		{NodeTID: "t1", Metric: &flow.FlowMetric{ABPackets: 1, BAPackets: 2, ABBytes: 100, BABytes: 200}},
+		{NodeTID: "t1", Metric: &flow.FlowMetric{ABPackets: 3, ABBytes: 300}},
+		{NodeTID: "t3", NAT: nat},
+		{NodeTID: "t4", Metric: &flow.FlowMetric{ABPackets: 5, ABBytes: 500}},
+	}
+
+	hops := pathHops(path, flows)
+
+	expected := []*pathHop{
+		{TID: "t1", Name: "eth0", Type: "device", Host: "host1", Captures: []string{"c1:pcap:active"}, Flows: 2, Packets: 6, Bytes: 600},
+		{TID: "t2", Name: "br0", Type: "bridge", Host: "host1"},
+		{TID: "t3", Name: "eth1", Type: "device", Host: "host2", Flows: 1,
+			NAT: []string{"SNAT+DNAT 10.0.0.1:3456>172.16.0.1:80 => 192.168.0.1:4567>10.0.1.2:8080"}},
+	}
+
+	if !reflect.DeepEqual(hops, expected) {
+		for i := range hops {
+			t.Logf("hop %d: %+v", i, hops[i])
+		}
+		t.Error("Unexpected hops")
+	}
+}
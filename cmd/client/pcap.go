@@ -18,12 +18,18 @@
 package client
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"sort"
 
 	"github.com/skydive-project/skydive/api/client"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/gremlin"
 	"github.com/skydive-project/skydive/logging"
 
 	"github.com/spf13/cobra"
@@ -31,6 +37,14 @@ import (
 
 var (
 	pcapTrace string
+
+	pcapFile    string
+	pcapFlows   []string
+	pcapCapture string
+	pcapNode    string
+	pcapFrom    string
+	pcapTo      string
+	pcapBPF     string
 )
 
 // PcapCmd skydive pcap root command
@@ -71,6 +85,123 @@ var PcapCmd = &cobra.Command{
 	},
 }
 
+// rawPacketsQuery returns the Gremlin query of the raw packets selected
+// by the download flags
+func rawPacketsQuery() (gremlin.QueryString, error) {
+	query := gremlin.G
+
+	if pcapFrom != "" {
+		from, err := parseBacktestTime(pcapFrom)
+		if err != nil {
+			return "", fmt.Errorf("Invalid start time: %s", err)
+		}
+		to, err := parseBacktestTime(pcapTo)
+		if err != nil {
+			return "", fmt.Errorf("Invalid end time: %s", err)
+		}
+		if !from.Before(to) {
+			return "", errors.New("The start time has to be before the end time")
+		}
+		query = query.Context(to, int64(to.Sub(from).Seconds()))
+	}
+
+	if pcapNode != "" {
+		query = query.V().Has("TID", pcapNode)
+	}
+	query = query.Flows()
+
+	if len(pcapFlows) > 0 {
+		uuids := make([]interface{}, len(pcapFlows))
+		for i, uuid := range pcapFlows {
+			uuids[i] = uuid
+		}
+		query = query.Has("UUID", gremlin.Within(uuids...))
+	}
+	if pcapCapture != "" {
+		query = query.Has("CaptureID", pcapCapture)
+	}
+
+	query = query.RawPackets()
+	if pcapBPF != "" {
+		query = query.BPF(pcapBPF)
+	}
+
+	return query, nil
+}
+
+// writePcap writes the raw packets of all the flows, ordered by time, as
+// the flows may have been captured on different agents
+func writePcap(w io.Writer, rawPackets map[string][]*flow.RawPacket) (int, error) {
+	var packets []*flow.RawPacket
+	for _, fr := range rawPackets {
+		packets = append(packets, fr...)
+	}
+
+	sort.SliceStable(packets, func(i, j int) bool {
+		if packets[i].Timestamp != packets[j].Timestamp {
+			return packets[i].Timestamp < packets[j].Timestamp
+		}
+		return packets[i].Index < packets[j].Index
+	})
+
+	if err := flow.NewPcapWriter(w).WriteRawPackets(packets); err != nil {
+		return 0, err
+	}
+	return len(packets), nil
+}
+
+// PcapDownload skydive pcap download command
+var PcapDownload = &cobra.Command{
+	Use:   "download",
+	Short: "Download raw packets as a PCAP file",
+	Long:  "Download the raw packets of flows, captures or nodes, over a time range, as a PCAP file",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(pcapFlows) == 0 && pcapCapture == "" && pcapNode == "" {
+			exitOnError(errors.New("At least one of --flow, --capture or --node has to be specified"))
+		}
+		if cmd.Flags().Changed("to") && pcapFrom == "" {
+			exitOnError(errors.New("Option --to requires --from"))
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		query, err := rawPacketsQuery()
+		if err != nil {
+			exitOnError(err)
+		}
+
+		queryHelper := client.NewGremlinQueryHelper(&AuthenticationOpts)
+		rawPackets, err := queryHelper.GetRawPackets(query)
+		if err == common.ErrNotFound || (err == nil && len(rawPackets) == 0) {
+			exitOnError(errors.New("No raw packet found, check that the captures keep raw packets with --rawpacket-limit"))
+		} else if err != nil {
+			exitOnError(err)
+		}
+
+		out := os.Stdout
+		if pcapFile != "-" {
+			if out, err = os.Create(pcapFile); err != nil {
+				exitOnError(err)
+			}
+			defer out.Close()
+		}
+
+		count, err := writePcap(out, rawPackets)
+		if err != nil {
+			exitOnError(err)
+		}
+		fmt.Fprintf(os.Stderr, "%d packets of %d flows written to %s\n", count, len(rawPackets), pcapFile)
+	},
+}
+
 func init() {
 	PcapCmd.Flags().StringVarP(&pcapTrace, "trace", "t", "", "PCAP trace file to read")
+
+	PcapDownload.Flags().StringVarP(&pcapFile, "write", "w", "skydive.pcap", "PCAP file to write, - for the standard output")
+	PcapDownload.Flags().StringSliceVarP(&pcapFlows, "flow", "", []string{}, "UUIDs of the flows")
+	PcapDownload.Flags().StringVarP(&pcapCapture, "capture", "", "", "ID of the capture")
+	PcapDownload.Flags().StringVarP(&pcapNode, "node", "", "", "TID of the node the flows were captured on")
+	PcapDownload.Flags().StringVarP(&pcapFrom, "from", "", "", "start of the time range, RFC3339 time or duration before now, live flows if not set")
+	PcapDownload.Flags().StringVarP(&pcapTo, "to", "", "0s", "end of the time range, RFC3339 time or duration before now")
+	PcapDownload.Flags().StringVarP(&pcapBPF, "bpf", "", "", "BPF filter of the packets")
+	PcapCmd.AddCommand(PcapDownload)
 }
@@ -19,19 +19,48 @@ package client
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/skydive-project/skydive/api/client"
+	"github.com/skydive-project/skydive/api/types"
 	"github.com/skydive-project/skydive/logging"
 )
 
+var (
+	queryBindings []string
+	queryPage     types.Pagination
+)
+
+// parseBindings returns the values of the name=value bindings, values
+// being decoded as JSON when possible and taken as strings otherwise
+func parseBindings(args []string) (map[string]interface{}, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+
+	bindings := make(map[string]interface{}, len(args))
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("Bindings have to be given as name=value, got: %s", arg)
+		}
+
+		var value interface{}
+		if err := json.Unmarshal([]byte(kv[1]), &value); err != nil {
+			value = kv[1]
+		}
+		bindings[strings.TrimPrefix(kv[0], "$")] = value
+	}
+	return bindings, nil
+}
+
 // QueryCmd skydive topology query command
 var QueryCmd = &cobra.Command{
 	Use:   "query [gremlin]",
@@ -47,20 +76,33 @@ var QueryCmd = &cobra.Command{
 		gremlinQuery = args[0]
 		queryHelper := client.NewGremlinQueryHelper(&AuthenticationOpts)
 
+		bindings, err := parseBindings(queryBindings)
+		if err != nil {
+			exitOnError(err)
+		}
+
 		switch outputFormat {
 		case "json":
-			data, err := queryHelper.Query(gremlinQuery)
-			if err != nil {
+			var data []byte
+			if queryPage.IsSet() {
+				var total int
+				if data, total, err = queryHelper.QueryPage(gremlinQuery, bindings, queryPage); err != nil {
+					exitOnError(err)
+				}
+				fmt.Fprintf(os.Stderr, "%d items\n", total)
+			} else if data, err = queryHelper.QueryWithBindings(gremlinQuery, bindings); err != nil {
 				exitOnError(err)
 			}
 
-			var out bytes.Buffer
-			json.Indent(&out, data, "", "\t")
-			out.WriteTo(os.Stdout)
-		case "dot":
+			printRawOutput(data)
+		case "dot", "graphml":
 			header := make(http.Header)
-			header.Set("Accept", "vnd.graphviz")
-			resp, err := queryHelper.Request(gremlinQuery, header)
+			if outputFormat == "dot" {
+				header.Set("Accept", "vnd.graphviz")
+			} else {
+				header.Set("Accept", "application/graphml+xml")
+			}
+			resp, err := queryHelper.RequestWithBindings(gremlinQuery, bindings, header)
 			if err != nil {
 				exitOnError(err)
 			}
@@ -74,7 +116,7 @@ var QueryCmd = &cobra.Command{
 		case "pcap":
 			header := make(http.Header)
 			header.Set("Accept", "vnd.tcpdump.pcap")
-			resp, err := queryHelper.Request(gremlinQuery, header)
+			resp, err := queryHelper.RequestWithBindings(gremlinQuery, bindings, header)
 			if err != nil {
 				exitOnError(err)
 			}
@@ -94,5 +136,11 @@ var QueryCmd = &cobra.Command{
 }
 
 func init() {
-	QueryCmd.Flags().StringVarP(&outputFormat, "format", "", "json", "Output format (json, dot or pcap)")
+	QueryCmd.Flags().StringVarP(&outputFormat, "format", "", "json", "Output format (json, dot, graphml or pcap)")
+	QueryCmd.Flags().StringArrayVarP(&queryBindings, "bind", "", []string{}, "Value of a $name query parameter, as name=value")
+	QueryCmd.Flags().IntVarP(&queryPage.Limit, "limit", "", 0, "Maximum number of items returned, 0: no limit")
+	QueryCmd.Flags().IntVarP(&queryPage.Offset, "offset", "", 0, "Number of items skipped")
+	QueryCmd.Flags().StringVarP(&queryPage.SortBy, "sort-by", "", "", "Field the items are sorted by")
+	QueryCmd.Flags().StringVarP(&queryPage.SortOrder, "sort-order", "", "", "Sort order, ASC or DESC")
+	QueryCmd.Flags().StringSliceVarP(&queryPage.Fields, "fields", "", []string{}, "JSON fields of the items to return, ex: ID,Metadata.Name")
 }
@@ -0,0 +1,231 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/skydive-project/skydive/api/client"
+	api "github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/validator"
+
+	"github.com/spf13/cobra"
+)
+
+var queryParameters []string
+
+// SavedQueryCmd skydive saved query root command
+var SavedQueryCmd = &cobra.Command{
+	Use:          "saved-query",
+	Short:        "saved-query",
+	Long:         "saved-query",
+	SilenceUsage: false,
+}
+
+// SavedQueryCreate skydive saved query create command
+var SavedQueryCreate = &cobra.Command{
+	Use:          "create",
+	Short:        "create",
+	Long:         "create",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		defaults, err := parseBindings(queryParameters)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		savedQuery := &api.SavedQuery{
+			Name:        name,
+			Description: description,
+			Query:       query,
+		}
+		for paramName, value := range defaults {
+			param := api.SavedQueryParameter{Name: paramName}
+			if value != "" {
+				param.Default = value
+			}
+			savedQuery.Parameters = append(savedQuery.Parameters, param)
+		}
+		sort.Slice(savedQuery.Parameters, func(i, j int) bool {
+			return savedQuery.Parameters[i].Name < savedQuery.Parameters[j].Name
+		})
+
+		if err = validator.Validate(savedQuery); err != nil {
+			exitOnError(fmt.Errorf("Error while validating saved query: %s", err))
+		}
+
+		if err = client.Create("savedquery", &savedQuery, nil); err != nil {
+			exitOnError(err)
+		}
+
+		printOutput(savedQuery)
+	},
+}
+
+// SavedQueryGet skydive saved query get command
+var SavedQueryGet = &cobra.Command{
+	Use:          "get",
+	Short:        "get",
+	Long:         "get",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var savedQuery api.SavedQuery
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+		if err := client.Get("savedquery", args[0], &savedQuery); err != nil {
+			exitOnError(err)
+		}
+		printOutput(&savedQuery)
+	},
+}
+
+// SavedQueryList skydive saved query list command
+var SavedQueryList = &cobra.Command{
+	Use:          "list",
+	Short:        "list",
+	Long:         "list",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var savedQueries map[string]api.SavedQuery
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.List("savedquery", &savedQueries); err != nil {
+			exitOnError(err)
+		}
+		printOutput(savedQueries)
+	},
+}
+
+// SavedQueryDelete skydive saved query delete command
+var SavedQueryDelete = &cobra.Command{
+	Use:          "delete",
+	Short:        "delete",
+	Long:         "delete",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		for _, id := range args {
+			if err := client.Delete("savedquery", id); err != nil {
+				logging.GetLogger().Error(err.Error())
+			}
+		}
+	},
+}
+
+// SavedQueryExecute skydive saved query execute command
+var SavedQueryExecute = &cobra.Command{
+	Use:          "execute [id or name]",
+	Short:        "execute",
+	Long:         "execute a saved query by ID or name",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewRestClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		bindings, err := parseBindings(queryBindings)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		s, err := json.Marshal(&api.SavedQueryCall{Bindings: bindings})
+		if err != nil {
+			exitOnError(err)
+		}
+
+		resp, err := client.Request("POST", "savedquery/"+args[0]+"/execute", bytes.NewReader(s), nil)
+		if err != nil {
+			exitOnError(err)
+		}
+		defer resp.Body.Close()
+
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			exitOnError(fmt.Errorf("%s: %s", resp.Status, string(data)))
+		}
+
+		printRawOutput(data)
+	},
+}
+
+func init() {
+	SavedQueryCmd.AddCommand(SavedQueryCreate)
+	SavedQueryCmd.AddCommand(SavedQueryList)
+	SavedQueryCmd.AddCommand(SavedQueryGet)
+	SavedQueryCmd.AddCommand(SavedQueryDelete)
+	SavedQueryCmd.AddCommand(SavedQueryExecute)
+
+	SavedQueryCreate.Flags().StringVarP(&name, "name", "", "", "query name")
+	SavedQueryCreate.Flags().StringVarP(&description, "description", "", "", "query description")
+	SavedQueryCreate.Flags().StringVarP(&query, "query", "", "", "gremlin query, with $name parameters")
+	SavedQueryCreate.Flags().StringArrayVarP(&queryParameters, "parameter", "", []string{}, "query parameter with its default value, as name=value. No default when value is empty")
+
+	SavedQueryExecute.Flags().StringArrayVarP(&queryBindings, "bind", "", []string{}, "Value of a $name query parameter, as name=value")
+}
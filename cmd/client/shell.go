@@ -34,7 +34,9 @@ import (
 )
 
 var (
-	shellScript string
+	shellScript   string
+	shellGremlin  bool
+	shellPageSize int
 
 	// ErrContinue parser error continue input
 	ErrContinue = errors.New("<continue input>")
@@ -208,6 +210,23 @@ var ShellCmd = &cobra.Command{
 	Long:         "Skydive Shell Command Line Interface, yet another shell",
 	SilenceUsage: false,
 	Run: func(cmd *cobra.Command, args []string) {
+		if shellGremlin {
+			s, err := newGremlinSession(shellPageSize)
+			if err != nil {
+				exitOnError(fmt.Errorf("Error while creating session: %s", err))
+			}
+			defer s.Close()
+
+			if err := s.prompt(); err != nil {
+				logging.GetLogger().Error(err)
+			}
+
+			if err := s.saveHistory(); err != nil {
+				logging.GetLogger().Errorf("Error while saving history: %s", err)
+			}
+			return
+		}
+
 		s, err := NewSession()
 		if err != nil {
 			logging.GetLogger().Errorf("Error while creating session: %s", err)
@@ -232,4 +251,6 @@ var ShellCmd = &cobra.Command{
 
 func init() {
 	ShellCmd.Flags().StringVarP(&shellScript, "script", "", "", "path to a JavaScript to execute")
+	ShellCmd.Flags().BoolVarP(&shellGremlin, "gremlin", "", false, "Gremlin shell mode, with completion of the steps and metadata keys")
+	ShellCmd.Flags().IntVarP(&shellPageSize, "page-size", "", 20, "number of query result items per page in Gremlin mode, 0 to disable paging")
 }
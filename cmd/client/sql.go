@@ -0,0 +1,153 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/skydive-project/skydive/api/client"
+	api "github.com/skydive-project/skydive/api/types"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	sqlAt       string
+	sqlDuration string
+	sqlFormat   string
+)
+
+// SQLCmd skydive sql command
+var SQLCmd = &cobra.Command{
+	Use:   "sql [query]",
+	Short: "Query flows using SQL",
+	Long:  "Query flows using a SELECT statement on the flows table",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 || args[0] == "" {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewRestClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		s, err := json.Marshal(&api.SQLParams{Query: args[0], At: sqlAt, Duration: sqlDuration})
+		if err != nil {
+			exitOnError(err)
+		}
+
+		resp, err := client.Request("POST", "sql", bytes.NewReader(s), nil)
+		if err != nil {
+			exitOnError(err)
+		}
+		defer resp.Body.Close()
+
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			exitOnError(fmt.Errorf("%s: %s", resp.Status, string(data)))
+		}
+
+		// the --output and --field flags take precedence over --format
+		if outputMode != outputJSON || len(outputFields) > 0 {
+			rows, columns, err := sqlRows(data)
+			if err != nil {
+				exitOnError(err)
+			}
+			writeOutput(rows, columns)
+			return
+		}
+
+		switch sqlFormat {
+		case "json":
+			var out bytes.Buffer
+			json.Indent(&out, data, "", "\t")
+			out.WriteTo(os.Stdout)
+		case "csv":
+			var result api.SQLResult
+			if err := json.Unmarshal(data, &result); err != nil {
+				exitOnError(err)
+			}
+
+			w := csv.NewWriter(os.Stdout)
+			w.Write(result.Columns)
+			for _, row := range result.Rows {
+				record := make([]string, len(row))
+				for i, value := range row {
+					if value != nil {
+						record[i] = fmt.Sprintf("%v", value)
+					}
+				}
+				w.Write(record)
+			}
+			w.Flush()
+		default:
+			exitOnError(fmt.Errorf("Invalid output format %s", sqlFormat))
+		}
+	},
+}
+
+// sqlRows returns the rows of a SQL result as objects keyed by column
+func sqlRows(data []byte) ([]interface{}, []string, error) {
+	value, err := decodeOutput(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, _ := value.(map[string]interface{})
+	values, _ := result["Columns"].([]interface{})
+
+	columns := make([]string, len(values))
+	for i, column := range values {
+		columns[i] = formatCell(column)
+	}
+
+	rows, _ := result["Rows"].([]interface{})
+	items := make([]interface{}, len(rows))
+	for i, row := range rows {
+		values, _ := row.([]interface{})
+		item := make(map[string]interface{}, len(columns))
+		for j, column := range columns {
+			if j < len(values) {
+				item[column] = values[j]
+			}
+		}
+		items[i] = item
+	}
+
+	return items, columns, nil
+}
+
+func init() {
+	SQLCmd.Flags().StringVarP(&sqlAt, "at", "", "", "time context of the query, e.g. -1m")
+	SQLCmd.Flags().StringVarP(&sqlDuration, "duration", "", "", "duration of the time context, e.g. 5m")
+	SQLCmd.Flags().StringVarP(&sqlFormat, "format", "", "json", "Output format (json or csv)")
+}
@@ -57,6 +57,6 @@ var StatusCmd = &cobra.Command{
 			exitOnError(err)
 		}
 
-		printJSON(&status)
+		printOutput(&status)
 	},
 }
@@ -0,0 +1,241 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skydive-project/skydive/api/client"
+	"github.com/skydive-project/skydive/config"
+	shttp "github.com/skydive-project/skydive/http"
+)
+
+var (
+	supportFile     string
+	supportAgents   []string
+	supportTopology bool
+)
+
+// bundleWriter writes the files of a support bundle to a gzipped tarball,
+// the failures to retrieve some of them being recorded in the bundle
+type bundleWriter struct {
+	tw       *tar.Writer
+	prefix   string
+	failures []string
+}
+
+func (b *bundleWriter) add(name string, data []byte) error {
+	header := &tar.Header{
+		Name:    b.prefix + "/" + name,
+		Mode:    0640,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := b.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := b.tw.Write(data)
+	return err
+}
+
+func (b *bundleWriter) fail(name string, err error) {
+	b.failures = append(b.failures, fmt.Sprintf("%s: %s", name, err))
+	fmt.Fprintf(os.Stderr, "Failed to retrieve %s: %s\n", name, err)
+}
+
+// fetch adds the JSON resource of a component API to the bundle and
+// returns it, nil being returned if it could not be retrieved
+func (b *bundleWriter) fetch(restClient *shttp.RestClient, resource, name string) []byte {
+	resp, err := restClient.Request("GET", resource, nil, nil)
+	if err != nil {
+		b.fail(name, err)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		b.fail(name, err)
+		return nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		b.fail(name, fmt.Errorf("%s: %s", resp.Status, data))
+		return nil
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err == nil {
+		data = out.Bytes()
+	}
+
+	if err := b.add(name, data); err != nil {
+		exitOnError(err)
+	}
+	return data
+}
+
+// addDiagnostics adds the diagnostics of a component to the bundle, its
+// recent logs being also extracted to a log file
+func (b *bundleWriter) addDiagnostics(restClient *shttp.RestClient, dir string) map[string]interface{} {
+	data := b.fetch(restClient, "diagnostics", dir+"/diagnostics.json")
+	if data == nil {
+		return nil
+	}
+
+	var diagnostics map[string]interface{}
+	if err := json.Unmarshal(data, &diagnostics); err != nil {
+		b.fail(dir+"/diagnostics.json", err)
+		return nil
+	}
+
+	var logs bytes.Buffer
+	if lines, ok := diagnostics["Logs"].([]interface{}); ok {
+		for _, line := range lines {
+			fmt.Fprintln(&logs, line)
+		}
+	}
+	if err := b.add(dir+"/skydive.log", logs.Bytes()); err != nil {
+		exitOnError(err)
+	}
+
+	return diagnostics
+}
+
+// newAgentRestClient returns a REST client on the API of the agent
+// listening on the given address
+func newAgentRestClient(addr string) (*shttp.RestClient, error) {
+	host, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid port %s", p)
+	}
+
+	tlsConfig, err := config.GetTLSClientConfig(true)
+	if err != nil {
+		return nil, err
+	}
+
+	return shttp.NewRestClient(config.GetURL("http", host, port, "/api/"+client.APIVersion+"/"), &AuthenticationOpts, tlsConfig), nil
+}
+
+// connectedAgents returns the hosts of the agents listed in the status of
+// an analyzer
+func connectedAgents(diagnostics map[string]interface{}) (agents []string) {
+	status, _ := diagnostics["Status"].(map[string]interface{})
+	connected, _ := status["Agents"].(map[string]interface{})
+	for host := range connected {
+		agents = append(agents, host)
+	}
+	sort.Strings(agents)
+	return
+}
+
+// SupportBundleCmd skydive support-bundle command
+var SupportBundleCmd = &cobra.Command{
+	Use:   "support-bundle",
+	Short: "Create a support bundle",
+	Long: "Gather the status, configuration with redacted secrets, recent logs and runtime statistics of the analyzer " +
+		"and of the given agents, along with a topology snapshot, into a tarball to attach to bug reports",
+	Run: func(cmd *cobra.Command, args []string) {
+		restClient, err := client.NewRestClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if supportFile == "" {
+			supportFile = fmt.Sprintf("skydive-support-%s.tar.gz", time.Now().Format("20060102-150405"))
+		}
+
+		f, err := os.Create(supportFile)
+		if err != nil {
+			exitOnError(err)
+		}
+		defer f.Close()
+
+		gw := gzip.NewWriter(f)
+		b := &bundleWriter{
+			tw:     tar.NewWriter(gw),
+			prefix: strings.TrimSuffix(strings.TrimSuffix(filepath.Base(supportFile), ".gz"), ".tar"),
+		}
+
+		diagnostics := b.addDiagnostics(restClient, "analyzer")
+		b.fetch(restClient, "capture", "analyzer/captures.json")
+
+		if supportTopology {
+			queryHelper := client.NewGremlinQueryHelper(&AuthenticationOpts)
+			if data, err := queryHelper.Query("G"); err != nil {
+				b.fail("topology.json", err)
+			} else if err := b.add("topology.json", data); err != nil {
+				exitOnError(err)
+			}
+		}
+
+		for _, addr := range supportAgents {
+			agentClient, err := newAgentRestClient(addr)
+			if err != nil {
+				exitOnError(fmt.Errorf("Invalid agent address %s: %s", addr, err))
+			}
+			b.addDiagnostics(agentClient, "agents/"+strings.Replace(addr, ":", "_", -1))
+		}
+
+		if agents := connectedAgents(diagnostics); len(supportAgents) == 0 && len(agents) > 0 {
+			fmt.Fprintf(os.Stderr, "%d agents connected (%s), use --agent to include their diagnostics\n", len(agents), strings.Join(agents, ", "))
+		}
+
+		if len(b.failures) > 0 {
+			if err := b.add("failures.txt", []byte(strings.Join(b.failures, "\n")+"\n")); err != nil {
+				exitOnError(err)
+			}
+		}
+
+		if err := b.tw.Close(); err != nil {
+			exitOnError(err)
+		}
+		if err := gw.Close(); err != nil {
+			exitOnError(err)
+		}
+
+		fmt.Fprintf(os.Stderr, "Support bundle written to %s\n", supportFile)
+	},
+}
+
+func init() {
+	SupportBundleCmd.Flags().StringVarP(&supportFile, "file", "f", "", "path of the bundle, default: skydive-support-<time>.tar.gz")
+	SupportBundleCmd.Flags().StringSliceVarP(&supportAgents, "agent", "", []string{}, "API address of an agent to include, ex: 192.168.0.10:8081")
+	SupportBundleCmd.Flags().BoolVarP(&supportTopology, "topology", "", true, "include a topology snapshot")
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/skydive-project/skydive/api/client"
+	api "github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	usertopology "github.com/skydive-project/skydive/topology/enhancers"
+	"github.com/skydive-project/skydive/validator"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	tags   []string
+	labels string
+)
+
+// TaggingRuleCmd skydive tagging rule root command
+var TaggingRuleCmd = &cobra.Command{
+	Use:          "tagging-rule",
+	Short:        "tagging-rule",
+	Long:         "tagging-rule",
+	SilenceUsage: false,
+}
+
+// TaggingRuleCreate skydive tagging rule create command
+var TaggingRuleCreate = &cobra.Command{
+	Use:          "create",
+	Short:        "create",
+	Long:         "create",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		m, err := usertopology.DefToMetadata(labels, graph.Metadata{})
+		if err != nil {
+			exitOnError(err)
+		}
+
+		rule := &api.TaggingRule{
+			Name:        name,
+			Description: description,
+			Query:       query,
+			Tags:        tags,
+			Labels:      make(map[string]string),
+		}
+		for k, v := range m {
+			rule.Labels[k] = fmt.Sprintf("%v", v)
+		}
+
+		if err = validator.Validate(rule); err != nil {
+			exitOnError(fmt.Errorf("Error while validating tagging rule: %s", err))
+		}
+
+		if err = client.Create("taggingrule", &rule, nil); err != nil {
+			exitOnError(err)
+		}
+
+		printOutput(rule)
+	},
+}
+
+// TaggingRuleGet skydive tagging rule get command
+var TaggingRuleGet = &cobra.Command{
+	Use:          "get",
+	Short:        "get",
+	Long:         "get",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var rule api.TaggingRule
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+		if err := client.Get("taggingrule", args[0], &rule); err != nil {
+			exitOnError(err)
+		}
+		printOutput(&rule)
+	},
+}
+
+// TaggingRuleList skydive tagging rule list command
+var TaggingRuleList = &cobra.Command{
+	Use:          "list",
+	Short:        "list",
+	Long:         "list",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var rules map[string]api.TaggingRule
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.List("taggingrule", &rules); err != nil {
+			exitOnError(err)
+		}
+		printOutput(rules)
+	},
+}
+
+// TaggingRuleDelete skydive tagging rule delete command
+var TaggingRuleDelete = &cobra.Command{
+	Use:          "delete",
+	Short:        "delete",
+	Long:         "delete",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		for _, id := range args {
+			if err := client.Delete("taggingrule", id); err != nil {
+				logging.GetLogger().Error(err.Error())
+			}
+		}
+	},
+}
+
+func init() {
+	TaggingRuleCmd.AddCommand(TaggingRuleCreate)
+	TaggingRuleCmd.AddCommand(TaggingRuleList)
+	TaggingRuleCmd.AddCommand(TaggingRuleGet)
+	TaggingRuleCmd.AddCommand(TaggingRuleDelete)
+
+	TaggingRuleCreate.Flags().StringVarP(&name, "name", "", "", "rule name")
+	TaggingRuleCreate.Flags().StringVarP(&description, "description", "", "", "rule description")
+	TaggingRuleCreate.Flags().StringVarP(&query, "query", "", "", "gremlin query of the nodes or edges to tag")
+	TaggingRuleCreate.Flags().StringSliceVarP(&tags, "tags", "", nil, "tags to add to the elements")
+	TaggingRuleCreate.Flags().StringVarP(&labels, "labels", "", "", "labels to set on the elements, key value pairs. 'k1=v1, k2=v2'")
+}
@@ -21,15 +21,23 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/skydive-project/skydive/api/client"
+	"github.com/skydive-project/skydive/api/types"
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/config"
 	gcommon "github.com/skydive-project/skydive/graffiti/common"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	gws "github.com/skydive-project/skydive/graffiti/websocket"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/websocket"
 	"github.com/spf13/cobra"
 )
@@ -38,6 +46,13 @@ var (
 	gremlinQuery string
 	outputFormat string
 	filename     string
+
+	snapshotFile    string
+	snapshotHistory bool
+	snapshotSince   int64
+	restoreReplace  bool
+
+	watchIgnored []string
 )
 
 // TopologyCmd skydive topology root command
@@ -128,9 +143,297 @@ var TopologyExport = &cobra.Command{
 	},
 }
 
+// TopologySnapshot skydive topology snapshot command
+var TopologySnapshot = &cobra.Command{
+	Use:   "snapshot",
+	Short: "save a snapshot of the topology",
+	Long:  "save a snapshot of the whole topology, optionally with its history, to a file",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewRestClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		query := url.Values{}
+		if snapshotHistory {
+			query.Set("history", "true")
+			query.Set("since", strconv.FormatInt(snapshotSince, 10))
+		}
+
+		resp, err := client.Request("GET", "topology/snapshot?"+query.Encode(), nil, nil)
+		if err != nil {
+			exitOnError(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			content, _ := ioutil.ReadAll(resp.Body)
+			exitOnError(fmt.Errorf("Failed to get topology snapshot: %s", string(content)))
+		}
+
+		file, err := os.Create(snapshotFile)
+		if err != nil {
+			exitOnError(err)
+		}
+		defer file.Close()
+
+		if _, err := io.Copy(file, resp.Body); err != nil {
+			exitOnError(err)
+		}
+
+		fmt.Printf("Topology snapshot saved to %s\n", snapshotFile)
+	},
+}
+
+// TopologyRestore skydive topology restore command
+var TopologyRestore = &cobra.Command{
+	Use:   "restore",
+	Short: "restore a snapshot of the topology",
+	Long:  "restore a snapshot of the topology previously saved with the snapshot command",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewRestClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		file, err := os.Open(snapshotFile)
+		if err != nil {
+			exitOnError(err)
+		}
+		defer file.Close()
+
+		query := url.Values{}
+		query.Set("replace", strconv.FormatBool(restoreReplace))
+
+		resp, err := client.Request("POST", "topology/snapshot?"+query.Encode(), file, nil)
+		if err != nil {
+			exitOnError(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			content, _ := ioutil.ReadAll(resp.Body)
+			exitOnError(fmt.Errorf("Failed to restore %s: %s", snapshotFile, string(content)))
+		}
+
+		var report types.TopologyRestoreReport
+		if err := common.JSONDecode(resp.Body, &report); err != nil {
+			exitOnError(err)
+		}
+
+		printOutput(report)
+	},
+}
+
+// topologyWatcher prints the changes of the elements of the graph
+// matching a Gremlin filter, as received from the subscriber endpoint
+type topologyWatcher struct {
+	websocket.DefaultSpeakerEventHandler
+	filter  string
+	ignored []string
+	synced  bool
+	nodes   map[graph.Identifier]*graph.Node
+	edges   map[graph.Identifier]*graph.Edge
+}
+
+func formatMetadataValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+func (t *topologyWatcher) printChange(sign, kind string, id graph.Identifier, description string, changes []graph.MetadataChange) {
+	fmt.Printf("%s %s %s %s %s\n", time.Now().Format("15:04:05"), sign, kind, id, description)
+	for _, change := range changes {
+		switch {
+		case change.From == nil:
+			fmt.Printf("    + %s: %s\n", change.Key, formatMetadataValue(change.To))
+		case change.To == nil:
+			fmt.Printf("    - %s: %s\n", change.Key, formatMetadataValue(change.From))
+		default:
+			fmt.Printf("    ~ %s: %s -> %s\n", change.Key, formatMetadataValue(change.From), formatMetadataValue(change.To))
+		}
+	}
+}
+
+func nodeDescription(n *graph.Node) string {
+	name, _ := n.GetFieldString("Name")
+	typ, _ := n.GetFieldString("Type")
+	return fmt.Sprintf("(%s, %s)", name, typ)
+}
+
+func edgeDescription(e *graph.Edge) string {
+	relationType, _ := e.GetFieldString("RelationType")
+	return fmt.Sprintf("(%s) %s -> %s", relationType, e.Parent, e.Child)
+}
+
+func (t *topologyWatcher) setNode(n *graph.Node) {
+	old, found := t.nodes[n.ID]
+	t.nodes[n.ID] = n
+
+	switch {
+	case !found:
+		t.printChange("+", "node", n.ID, nodeDescription(n), nil)
+	default:
+		if changes := graph.DiffMetadata(old.Metadata, n.Metadata, t.ignored...); len(changes) > 0 {
+			t.printChange("~", "node", n.ID, nodeDescription(n), changes)
+		}
+	}
+}
+
+func (t *topologyWatcher) delNode(n *graph.Node) {
+	if _, found := t.nodes[n.ID]; found {
+		delete(t.nodes, n.ID)
+		t.printChange("-", "node", n.ID, nodeDescription(n), nil)
+	}
+}
+
+func (t *topologyWatcher) setEdge(e *graph.Edge) {
+	old, found := t.edges[e.ID]
+	t.edges[e.ID] = e
+
+	switch {
+	case !found:
+		t.printChange("+", "edge", e.ID, edgeDescription(e), nil)
+	default:
+		if changes := graph.DiffMetadata(old.Metadata, e.Metadata, t.ignored...); len(changes) > 0 {
+			t.printChange("~", "edge", e.ID, edgeDescription(e), changes)
+		}
+	}
+}
+
+func (t *topologyWatcher) delEdge(e *graph.Edge) {
+	if _, found := t.edges[e.ID]; found {
+		delete(t.edges, e.ID)
+		t.printChange("-", "edge", e.ID, edgeDescription(e), nil)
+	}
+}
+
+// sync handles the state of the graph received on each connection. The first
+// one is only counted, the next ones being compared to the current state as
+// the changes that occurred while disconnected were not received.
+func (t *topologyWatcher) sync(elements *graph.Elements) {
+	if !t.synced {
+		for _, n := range elements.Nodes {
+			t.nodes[n.ID] = n
+		}
+		for _, e := range elements.Edges {
+			t.edges[e.ID] = e
+		}
+		t.synced = true
+
+		fmt.Fprintf(os.Stderr, "Watching %d nodes and %d edges\n", len(t.nodes), len(t.edges))
+		return
+	}
+
+	nodes, edges := make(map[graph.Identifier]bool), make(map[graph.Identifier]bool)
+	for _, n := range elements.Nodes {
+		nodes[n.ID] = true
+		t.setNode(n)
+	}
+	for _, e := range elements.Edges {
+		edges[e.ID] = true
+		t.setEdge(e)
+	}
+
+	for id, e := range t.edges {
+		if !edges[id] {
+			t.delEdge(e)
+		}
+	}
+	for id, n := range t.nodes {
+		if !nodes[id] {
+			t.delNode(n)
+		}
+	}
+}
+
+// OnConnected websocket.SpeakerEventHandler interface
+func (t *topologyWatcher) OnConnected(c websocket.Speaker) {
+	msg := gws.NewStructMessage(gws.SyncRequestMsgType, gws.SyncRequestMsg{GremlinFilter: &t.filter})
+	if err := c.SendMessage(msg); err != nil {
+		logging.GetLogger().Errorf("Failed to send the synchronization request: %s", err)
+	}
+}
+
+// OnStructMessage websocket.SpeakerStructMessageHandler interface
+func (t *topologyWatcher) OnStructMessage(c websocket.Speaker, m *websocket.StructMessage) {
+	if m.Status != http.StatusOK {
+		exitOnError(fmt.Errorf("Failed to watch the topology: %s", m.Obj))
+	}
+
+	msgType, obj, err := gws.UnmarshalMessage(m)
+	if err != nil {
+		logging.GetLogger().Errorf("Unable to parse the %s message: %s", m.Type, err)
+		return
+	}
+
+	switch msgType {
+	case gws.SyncReplyMsgType:
+		t.sync(obj.(*gws.SyncMsg).Elements)
+	case gws.NodeAddedMsgType, gws.NodeUpdatedMsgType:
+		t.setNode(obj.(*graph.Node))
+	case gws.NodeDeletedMsgType:
+		t.delNode(obj.(*graph.Node))
+	case gws.EdgeAddedMsgType, gws.EdgeUpdatedMsgType:
+		t.setEdge(obj.(*graph.Edge))
+	case gws.EdgeDeletedMsgType:
+		t.delEdge(obj.(*graph.Edge))
+	}
+}
+
+// TopologyWatch skydive topology watch command
+var TopologyWatch = &cobra.Command{
+	Use:   "watch",
+	Short: "watch topology changes",
+	Long:  "Print the nodes and edges matching a Gremlin filter as they are added, updated or deleted",
+	Run: func(cmd *cobra.Command, args []string) {
+		sa, err := config.GetOneAnalyzerServiceAddress()
+		if err != nil {
+			exitOnError(err)
+		}
+
+		url := config.GetURL("ws", sa.Addr, sa.Port, "/ws/subscriber")
+		opts := websocket.ClientOpts{AuthOpts: &AuthenticationOpts, Protocol: websocket.JSONProtocol}
+		client, err := config.NewWSClient(common.UnknownService, url, opts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		watcher := &topologyWatcher{
+			filter:  gremlinQuery,
+			ignored: watchIgnored,
+			nodes:   make(map[graph.Identifier]*graph.Node),
+			edges:   make(map[graph.Identifier]*graph.Edge),
+		}
+
+		speaker := client.UpgradeToStructSpeaker()
+		speaker.AddEventHandler(watcher)
+		speaker.AddStructMessageHandler(watcher, []string{gws.Namespace})
+
+		client.Start()
+		select {}
+	},
+}
+
 func init() {
 	TopologyCmd.AddCommand(TopologyExport)
 
+	TopologyWatch.Flags().StringVarP(&gremlinQuery, "gremlin", "", "G", "Gremlin filter returning the watched graph, ex: G.V().Has('Type', 'veth').SubGraph()")
+	TopologyWatch.Flags().StringSliceVarP(&watchIgnored, "ignore", "", ge.DiffIgnoredKeys, "metadata keys whose changes are not printed")
+	TopologyCmd.AddCommand(TopologyWatch)
+
+	TopologySnapshot.Flags().StringVarP(&snapshotFile, "file", "", "snapshot.json", "Output file")
+	TopologySnapshot.Flags().BoolVarP(&snapshotHistory, "history", "", false, "Include the history of the topology")
+	TopologySnapshot.Flags().Int64VarP(&snapshotSince, "since", "", 0, "Start of the history, in milliseconds")
+	TopologyCmd.AddCommand(TopologySnapshot)
+
+	TopologyRestore.Flags().StringVarP(&snapshotFile, "file", "", "snapshot.json", "Input file")
+	TopologyRestore.Flags().BoolVarP(&restoreReplace, "replace", "", false, "Remove the current topology before restoring")
+	TopologyCmd.AddCommand(TopologyRestore)
+
 	TopologyImport.Flags().StringVarP(&filename, "file", "", "graph.json", "Input file")
 	TopologyCmd.AddCommand(TopologyImport)
 
@@ -0,0 +1,170 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/skydive-project/skydive/api/client"
+	api "github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/validator"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	webhookURL       string
+	webhookResources []string
+	webhookEvents    []string
+	webhookSecret    string
+)
+
+// WebhookCmd skydive webhook root command
+var WebhookCmd = &cobra.Command{
+	Use:          "webhook",
+	Short:        "webhook",
+	Long:         "webhook",
+	SilenceUsage: false,
+}
+
+// WebhookCreate skydive webhook create command
+var WebhookCreate = &cobra.Command{
+	Use:          "create",
+	Short:        "create",
+	Long:         "create",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		webhook := &api.Webhook{
+			Name:        name,
+			Description: description,
+			URL:         webhookURL,
+			Resources:   webhookResources,
+			Events:      webhookEvents,
+			Secret:      webhookSecret,
+		}
+
+		if err = validator.Validate(webhook); err != nil {
+			exitOnError(fmt.Errorf("Error while validating webhook: %s", err))
+		}
+
+		if err = client.Create("webhook", &webhook, nil); err != nil {
+			exitOnError(err)
+		}
+
+		webhook.Secret = ""
+		printOutput(webhook)
+	},
+}
+
+// WebhookGet skydive webhook get command
+var WebhookGet = &cobra.Command{
+	Use:          "get",
+	Short:        "get",
+	Long:         "get",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var webhook api.Webhook
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+		if err := client.Get("webhook", args[0], &webhook); err != nil {
+			exitOnError(err)
+		}
+		printOutput(&webhook)
+	},
+}
+
+// WebhookList skydive webhook list command
+var WebhookList = &cobra.Command{
+	Use:          "list",
+	Short:        "list",
+	Long:         "list",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var webhooks map[string]api.Webhook
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.List("webhook", &webhooks); err != nil {
+			exitOnError(err)
+		}
+		printOutput(webhooks)
+	},
+}
+
+// WebhookDelete skydive webhook delete command
+var WebhookDelete = &cobra.Command{
+	Use:          "delete",
+	Short:        "delete",
+	Long:         "delete",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		for _, id := range args {
+			if err := client.Delete("webhook", id); err != nil {
+				logging.GetLogger().Error(err.Error())
+			}
+		}
+	},
+}
+
+func init() {
+	WebhookCmd.AddCommand(WebhookCreate)
+	WebhookCmd.AddCommand(WebhookList)
+	WebhookCmd.AddCommand(WebhookGet)
+	WebhookCmd.AddCommand(WebhookDelete)
+
+	WebhookCreate.Flags().StringVarP(&name, "name", "", "", "webhook name")
+	WebhookCreate.Flags().StringVarP(&description, "description", "", "", "webhook description")
+	WebhookCreate.Flags().StringVarP(&webhookURL, "url", "", "", "URL the events are POSTed to")
+	WebhookCreate.Flags().StringSliceVarP(&webhookResources, "resources", "", nil, "resources to watch: alert, capture, edgerule or noderule, all if not specified")
+	WebhookCreate.Flags().StringSliceVarP(&webhookEvents, "events", "", nil, "events to send: created, updated or deleted, all if not specified")
+	WebhookCreate.Flags().StringVarP(&webhookSecret, "secret", "", "", "secret used to sign the events")
+}
@@ -89,7 +89,7 @@ var WorkflowCreate = &cobra.Command{
 		if err := client.Create("workflow", &workflow, nil); err != nil {
 			exitOnError(err)
 		}
-		printJSON(workflow)
+		printOutput(workflow)
 	},
 }
 
@@ -135,7 +135,7 @@ var WorkflowList = &cobra.Command{
 		if err := client.List("workflow", &workflows); err != nil {
 			exitOnError(err)
 		}
-		printJSON(workflows)
+		printOutput(workflows)
 	},
 }
 
@@ -182,7 +182,7 @@ var WorkflowCall = &cobra.Command{
 			exitOnError(err)
 		}
 
-		printJSON(result)
+		printOutput(result)
 	},
 }
 
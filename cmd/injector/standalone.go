@@ -49,6 +49,11 @@ var (
 	mode             string
 	incrementPayload int64
 	ttl              uint8
+	rate             uint64
+	duration         uint64
+	payloadLengthMin int64
+	payloadLengthMax int64
+	tcpHandshake     bool
 )
 
 // AddInjectPacketInjectFlags add the command line flags for a packet injection
@@ -68,6 +73,11 @@ func AddInjectPacketInjectFlags(cmd *cobra.Command) {
 	cmd.Flags().Uint64VarP(&count, "count", "", 1, "number of packets to be generated")
 	cmd.Flags().Uint64VarP(&interval, "interval", "", 0, "wait interval milliseconds between sending each packet")
 	cmd.Flags().Uint8VarP(&ttl, "ttl", "", 64, "IP time-to-live header")
+	cmd.Flags().Uint64VarP(&rate, "rate", "", 0, "number of packets per second to be generated, can't be used with interval")
+	cmd.Flags().Uint64VarP(&duration, "duration", "", 0, "duration in seconds of the injection, count is ignored when set, requires a rate or an interval")
+	cmd.Flags().Int64VarP(&payloadLengthMin, "payload-length-min", "", 0, "minimum length of the random payload of each packet")
+	cmd.Flags().Int64VarP(&payloadLengthMax, "payload-length-max", "", 0, "maximum length of the random payload of each packet")
+	cmd.Flags().BoolVarP(&tcpHandshake, "tcp-handshake", "", false, "emulate a TCP connection, three-way handshake and termination, for TCP packets")
 }
 
 // GetPacketInjectRequest returns a packet injection request parsed from the command line flags
@@ -115,6 +125,11 @@ func GetPacketInjectRequest() (*pi.PacketInjectionRequest, error) {
 		Payload:          payload,
 		Pcap:             pcapContent,
 		TTL:              ttl,
+		Rate:             rate,
+		Duration:         duration,
+		PayloadLengthMin: payloadLengthMin,
+		PayloadLengthMax: payloadLengthMax,
+		TCPHandshake:     tcpHandshake,
 	}
 
 	if err := validator.Validate(request); err != nil {
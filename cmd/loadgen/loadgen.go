@@ -0,0 +1,225 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/skydive-project/skydive/api/client"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	flowclient "github.com/skydive-project/skydive/flow/client"
+	"github.com/skydive-project/skydive/flow/loadgen"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	authenticationOpts shttp.AuthenticationOpts
+	analyzerAddr       string
+	protocol           string
+	settle             time.Duration
+	options            loadgen.Options
+)
+
+// analyzerStatus is the part of the analyzer status reporting the flows received
+type analyzerStatus struct {
+	Flows *types.FlowServerStatus
+}
+
+func getFlowServerStatus() (*types.FlowServerStatus, error) {
+	restClient, err := client.NewRestClientFromConfig(&authenticationOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := restClient.Request("GET", "status", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to get status: %s", resp.Status)
+	}
+
+	var status analyzerStatus
+	if err := common.JSONDecode(resp.Body, &status); err != nil {
+		return nil, err
+	}
+	if status.Flows == nil {
+		return nil, errors.New("the analyzer doesn't report the flows received")
+	}
+	return status.Flows, nil
+}
+
+func newConnection(sa common.ServiceAddress) (flowclient.FlowClientConn, error) {
+	switch protocol {
+	case "udp":
+		return flowclient.NewFlowClientUDPConn(common.NormalizeAddrForURL(sa.Addr), sa.Port)
+	case "websocket":
+		endpoint := config.GetURL("ws", common.NormalizeAddrForURL(sa.Addr), sa.Port, "/ws/agent/flow")
+		return flowclient.NewFlowClientWebSocketConn(endpoint, &authenticationOpts)
+	default:
+		return nil, fmt.Errorf("Invalid protocol %s", protocol)
+	}
+}
+
+// waitConnected waits for the WebSocket connection to be established, the
+// flows sent before being lost
+func waitConnected(conn flowclient.FlowClientConn) error {
+	wsConn, ok := conn.(*flowclient.FlowClientWebSocketConn)
+	if !ok {
+		return nil
+	}
+
+	return common.Retry(func() error {
+		if !wsConn.IsConnected() {
+			return errors.New("not connected")
+		}
+		return nil
+	}, 50, 100*time.Millisecond)
+}
+
+func printReport(report *loadgen.Report, before, after *types.FlowServerStatus) {
+	fmt.Printf("Duration:     %s\n", report.Elapsed.Round(time.Millisecond))
+	fmt.Printf("Flow updates: %d sent (%d new flows, %d updates), %d errors\n", report.Sent, report.Created, report.Updated, report.Errors)
+	if report.LastError != nil {
+		fmt.Printf("Last error:   %s\n", report.LastError)
+	}
+	fmt.Printf("Messages:     %d, %d bytes\n", report.Messages, report.Bytes)
+	fmt.Printf("Throughput:   %.0f flow updates/s, %.2f MB/s\n", report.Throughput(), float64(report.Bytes)/report.Elapsed.Seconds()/1e6)
+
+	if before == nil || after == nil {
+		return
+	}
+
+	// the counters of the analyzer include the flows of the other agents
+	received := after.Received - before.Received
+	dropped := after.Dropped - before.Dropped
+	handled := after.Handled - before.Handled
+	lost := report.Sent - received
+
+	fmt.Printf("Analyzer:     %d received, %d dropped, %d handled\n", received, dropped, handled)
+	if report.Sent > 0 {
+		fmt.Printf("Drop rate:    %.2f%% lost in transit, %.2f%% dropped by the analyzer\n",
+			100*float64(common.MaxInt64(lost, 0))/float64(report.Sent), 100*float64(dropped)/float64(report.Sent))
+	}
+}
+
+// LoadGenCmd describes the skydive loadgen command
+var LoadGenCmd = &cobra.Command{
+	Use:          "loadgen",
+	Short:        "Skydive flow load generator",
+	Long:         "Send synthesized flows to an analyzer and report the achieved throughput and drop rates",
+	SilenceUsage: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if analyzerAddr != "" {
+			config.Set("analyzers", analyzerAddr)
+		} else {
+			config.SetDefault("analyzers", []string{"localhost:8082"})
+		}
+		protocol = strings.ToLower(protocol)
+
+		sa, err := config.GetOneAnalyzerServiceAddress()
+		if err != nil {
+			logging.GetLogger().Error(err)
+			os.Exit(1)
+		}
+
+		conn, err := newConnection(sa)
+		if err != nil {
+			logging.GetLogger().Error(err)
+			os.Exit(1)
+		}
+
+		if err := conn.Connect(); err != nil {
+			logging.GetLogger().Errorf("Failed to connect to %s:%d: %s", sa.Addr, sa.Port, err)
+			os.Exit(1)
+		}
+		defer conn.Close()
+
+		if err := waitConnected(conn); err != nil {
+			logging.GetLogger().Errorf("Failed to connect to %s:%d: %s", sa.Addr, sa.Port, err)
+			os.Exit(1)
+		}
+
+		generator, err := loadgen.NewGenerator(conn, options)
+		if err != nil {
+			logging.GetLogger().Error(err)
+			os.Exit(1)
+		}
+
+		// the drop rates are computed from the counters of the analyzer,
+		// only the throughput is reported if they can't be retrieved
+		before, err := getFlowServerStatus()
+		if err != nil {
+			logging.GetLogger().Warningf("Unable to retrieve the flows received by the analyzer: %s", err)
+		}
+
+		quit := make(chan struct{})
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-ch
+			close(quit)
+		}()
+
+		logging.GetLogger().Infof("Sending flows to %s:%d over %s", sa.Addr, sa.Port, protocol)
+		report := generator.Run(quit)
+
+		var after *types.FlowServerStatus
+		if before != nil {
+			// leave time to the analyzer to handle the flows queued
+			time.Sleep(settle)
+			if after, err = getFlowServerStatus(); err != nil {
+				logging.GetLogger().Warningf("Unable to retrieve the flows received by the analyzer: %s", err)
+			}
+		}
+
+		printReport(report, before, after)
+	},
+}
+
+func init() {
+	LoadGenCmd.Flags().StringVarP(&authenticationOpts.Username, "username", "", os.Getenv("SKYDIVE_USERNAME"), "username auth parameter")
+	LoadGenCmd.Flags().StringVarP(&authenticationOpts.Password, "password", "", os.Getenv("SKYDIVE_PASSWORD"), "password auth parameter")
+	LoadGenCmd.Flags().StringVarP(&analyzerAddr, "analyzer", "", os.Getenv("SKYDIVE_ANALYZER"), "analyzer address")
+	LoadGenCmd.Flags().StringVarP(&protocol, "protocol", "", "udp", "protocol used to send the flows, udp or websocket")
+
+	LoadGenCmd.Flags().IntVarP(&options.Flows, "flows", "", 1000, "number of flows updated concurrently")
+	LoadGenCmd.Flags().Float64VarP(&options.UpdateRatio, "update-ratio", "", 0.9, "ratio of the flow updates for already known flows, the others creating new flows")
+	LoadGenCmd.Flags().IntVarP(&options.RawPackets, "raw-packets", "", 0, "number of raw packets sent with each flow update")
+	LoadGenCmd.Flags().IntVarP(&options.PacketSize, "packet-size", "", 128, "size of the raw packets")
+	LoadGenCmd.Flags().IntVarP(&options.Rate, "rate", "", 0, "number of flow updates sent per second, 0 for no limit")
+	LoadGenCmd.Flags().IntVarP(&options.BulkSize, "bulk-size", "", 1, "number of flow updates per message")
+	LoadGenCmd.Flags().DurationVarP(&options.Duration, "duration", "", 30*time.Second, "duration of the generation, 0 to run until interrupted")
+	LoadGenCmd.Flags().StringVarP(&options.NodeTID, "node-tid", "", "", "TID of the node the flows are reported for")
+	LoadGenCmd.Flags().StringVarP(&options.CaptureID, "capture-id", "", "", "ID of the capture the flows are reported for")
+	LoadGenCmd.Flags().DurationVarP(&settle, "settle", "", 2*time.Second, "time left to the analyzer to handle the flows before retrieving its counters")
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/skydive-project/skydive/cmd/completion"
 	"github.com/skydive-project/skydive/cmd/config"
 	"github.com/skydive-project/skydive/cmd/injector"
+	"github.com/skydive-project/skydive/cmd/loadgen"
 	"github.com/skydive-project/skydive/cmd/seed"
 	"github.com/skydive-project/skydive/cmd/version"
 	"github.com/skydive-project/skydive/logging"
@@ -73,6 +74,7 @@ func init() {
 		RootCmd.AddCommand(seed.SeedCmd)
 		RootCmd.AddCommand(version.VersionCmd)
 		RootCmd.AddCommand(injector.InjectPacketCmd)
+		RootCmd.AddCommand(loadgen.LoadGenCmd)
 
 		if allinone.AllInOneCmd != nil {
 			RootCmd.AddCommand(allinone.AllInOneCmd)
@@ -0,0 +1,84 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package common
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// HashRing implements a consistent hashing ring, each member being placed
+// several times on the ring to get an even distribution of the keys. When a
+// member is removed only the keys it owned are moved to other members.
+type HashRing struct {
+	replicas int
+	hashes   []uint32
+	owners   map[uint32]string
+}
+
+func (r *HashRing) hash(s string) uint32 {
+	return crc32.ChecksumIEEE([]byte(s))
+}
+
+// Owner returns the member owning the given key, an empty string if the
+// ring has no member
+func (r *HashRing) Owner(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+
+	h := r.hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+
+	return r.owners[r.hashes[i]]
+}
+
+// NewHashRing returns a ring with the given members, each of them placed
+// replicas times on the ring
+func NewHashRing(members []string, replicas int) *HashRing {
+	if replicas <= 0 {
+		replicas = 1
+	}
+
+	r := &HashRing{
+		replicas: replicas,
+		owners:   make(map[uint32]string),
+	}
+
+	// sorted so that a hash collision always gives the same owner
+	sorted := append([]string{}, members...)
+	sort.Strings(sorted)
+
+	for _, member := range sorted {
+		for i := 0; i < replicas; i++ {
+			h := r.hash(strconv.Itoa(i) + "/" + member)
+			if _, found := r.owners[h]; found {
+				continue
+			}
+			r.owners[h] = member
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+
+	return r
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package common
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHashRing(t *testing.T) {
+	if owner := NewHashRing(nil, 100).Owner("agent"); owner != "" {
+		t.Errorf("Expected no owner with an empty ring, got: %s", owner)
+	}
+
+	members := []string{"analyzer1", "analyzer2", "analyzer3"}
+	ring := NewHashRing(members, 100)
+
+	owners := make(map[string]string)
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("agent%d", i)
+		owners[key] = ring.Owner(key)
+		counts[owners[key]]++
+	}
+
+	for _, member := range members {
+		if counts[member] < 500 {
+			t.Errorf("Keys not evenly distributed: %v", counts)
+		}
+	}
+
+	// the order of the members doesn't matter
+	if reversed := NewHashRing([]string{"analyzer3", "analyzer2", "analyzer1"}, 100); reversed.Owner("agent42") != owners["agent42"] {
+		t.Error("Expected the same owner whatever the order of the members")
+	}
+
+	// only the keys of the removed member should move
+	ring = NewHashRing([]string{"analyzer1", "analyzer3"}, 100)
+	for key, owner := range owners {
+		newOwner := ring.Owner(key)
+		if owner != "analyzer2" && newOwner != owner {
+			t.Errorf("Key %s moved from %s to %s", key, owner, newOwner)
+		}
+		if newOwner == "analyzer2" {
+			t.Errorf("Key %s still owned by the removed member", key)
+		}
+	}
+}
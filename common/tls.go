@@ -57,6 +57,14 @@ func SetupTLSServerConfig(certPEM string, keyPEM string) (*tls.Config, error) {
 		return nil, err
 	}
 
+	SetupTLSServerParams(cfgTLS)
+
+	return cfgTLS, nil
+}
+
+// SetupTLSServerParams sets the protocol version, client authentication,
+// curves and cipher suites used by the servers
+func SetupTLSServerParams(cfgTLS *tls.Config) {
 	cfgTLS.MinVersion = tls.VersionTLS12
 	cfgTLS.ClientAuth = tls.VerifyClientCertIfGiven //tls.NoClientCert // tls.RequireAndVerifyClientCert
 	cfgTLS.CurvePreferences = []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256}
@@ -67,6 +75,4 @@ func SetupTLSServerConfig(certPEM string, keyPEM string) (*tls.Config, error) {
 		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
 		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
 	}
-
-	return cfgTLS, nil
 }
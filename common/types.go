@@ -471,6 +471,88 @@ func IPV4CIDRToRegex(cidr string) (string, error) {
 	return "^" + regex + `(\/[0-9]?[0-9])?$`, nil
 }
 
+// hexGroupToRegex returns a regex matching the textual representation of
+// the IPv6 groups whose first bits are equal to the ones of value
+func hexGroupToRegex(value int, bits int) string {
+	last := value | (1<<uint(16-bits) - 1)
+
+	var regex string
+	for shift := uint(len(strconv.FormatInt(int64(value), 16))-1) * 4; ; shift -= 4 {
+		first, end := (value>>shift)&0xf, (last>>shift)&0xf
+		switch {
+		case first == end:
+			regex += strconv.FormatInt(int64(first), 16)
+		case first == 0 && end == 0xf:
+			regex += "[0-9a-f]"
+		default:
+			regex += "["
+			for i := first; i <= end; i++ {
+				regex += strconv.FormatInt(int64(i), 16)
+			}
+			regex += "]"
+		}
+
+		if shift == 0 {
+			break
+		}
+	}
+
+	return regex
+}
+
+// IPV6CIDRToRegex returns a regex matching IPs belonging to a given cidr.
+// As zero groups can be compressed, the network part of the cidr can not
+// contain any zero group.
+func IPV6CIDRToRegex(cidr string) (string, error) {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+
+	if ipnet.IP.To4() != nil {
+		return "", fmt.Errorf("%s is not an IPv6 range", cidr)
+	}
+
+	ones, _ := ipnet.Mask.Size()
+	if ones == 0 {
+		return `^[0-9a-f:]+(\/[0-9]{1,3})?$`, nil
+	}
+
+	var groups []string
+	for i := 0; i < ones; i += 16 {
+		value := int(ipnet.IP[i/8])<<8 | int(ipnet.IP[i/8+1])
+		if value == 0 {
+			return "", fmt.Errorf("Network part of %s can't contain a zero group", cidr)
+		}
+
+		bits := ones - i
+		if bits > 16 {
+			bits = 16
+		}
+		groups = append(groups, hexGroupToRegex(value, bits))
+	}
+
+	regex := strings.Join(groups, ":")
+	if len(groups) < 8 {
+		regex += ":[0-9a-f:]+"
+	}
+
+	return "^" + regex + `(\/[0-9]{1,3})?$`, nil
+}
+
+// CIDRToRegex returns a regex matching IPs belonging to a given IPv4 or IPv6 cidr
+func CIDRToRegex(cidr string) (string, error) {
+	ip, _, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+
+	if ip.To4() != nil {
+		return IPV4CIDRToRegex(cidr)
+	}
+	return IPV6CIDRToRegex(cidr)
+}
+
 // IsIPv6 returns whether is a IPV6 addresses or not
 func IsIPv6(addr string) bool {
 	ip := net.ParseIP(addr)
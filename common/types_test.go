@@ -263,6 +263,33 @@ type structB struct {
 	S string
 }
 
+func TestIPV6Range(t *testing.T) {
+	expr, err := CIDRToRegex("2001:db8:100::/40")
+	if err != nil {
+		t.Fatal(err)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ip := range []string{"2001:db8:100::1", "2001:db8:1ff:1::/64", "2001:db8:1a0:0:1:2:3:4"} {
+		if !re.MatchString(ip) {
+			t.Errorf("%s not matching the rexp %s", ip, expr)
+		}
+	}
+
+	for _, ip := range []string{"2001:db8::1", "2001:db8:200::1", "2001:db9:100::1"} {
+		if re.MatchString(ip) {
+			t.Errorf("%s matches the rexp %s", ip, expr)
+		}
+	}
+
+	if _, err := CIDRToRegex("2001:db8::/48"); err == nil {
+		t.Error("Should return an error as the network part contains a zero group")
+	}
+}
+
 type structA struct {
 	Sub *structB
 }
@@ -23,6 +23,7 @@ import (
 	"math/rand"
 	"net/url"
 	"os"
+	"regexp"
 	"strings"
 
 	"github.com/spf13/pflag"
@@ -37,6 +38,10 @@ import (
 // ErrNoAnalyzerSpecified error no analyzer section is specified in the configuration file
 var ErrNoAnalyzerSpecified = errors.New("No analyzer specified in the configuration file")
 
+// secretKey matches the configuration keys holding secrets, the users of
+// the basic authentication backends being declared with their password
+var secretKey = regexp.MustCompile(`(?i)(password|secret|token|credential|users)`)
+
 var (
 	cfg           *SkydiveConfig
 	relocationMap = map[string][]string{
@@ -97,6 +102,15 @@ func init() {
 
 	cfg.SetDefault("agent.auth.api.backend", "noauth")
 	cfg.SetDefault("agent.capture.stats_update", 1)
+	cfg.SetDefault("agent.capture.max_captures", 0)
+	cfg.SetDefault("agent.capture.max_packets_per_second", 0)
+	cfg.SetDefault("agent.capture.max_raw_packets", 0)
+	cfg.SetDefault("agent.diagnostics.profiling", false)
+	cfg.SetDefault("agent.failover.check_interval", 10)
+	cfg.SetDefault("agent.failover.max_cpu", 90)
+	cfg.SetDefault("agent.failover.max_failures", 3)
+	cfg.SetDefault("agent.failover.rebalance_interval", 300)
+	cfg.SetDefault("agent.failover.rebalance_ratio", 1.2)
 	cfg.SetDefault("agent.flow.probes", []string{"gopacket", "pcapsocket"})
 	cfg.SetDefault("agent.flow.netflow.bind_address", "127.0.0.1")
 	cfg.SetDefault("agent.flow.netflow.port_min", 6365)
@@ -109,11 +123,18 @@ func init() {
 	cfg.SetDefault("agent.flow.sflow.port_min", 6345)
 	cfg.SetDefault("agent.flow.sflow.port_max", 6355)
 	cfg.SetDefault("agent.listen", "127.0.0.1:8081")
+	cfg.SetDefault("agent.resources.check_interval", 10)
+	cfg.SetDefault("agent.resources.low_priority_probes", []string{})
+	cfg.SetDefault("agent.resources.max_cpu", 0)
+	cfg.SetDefault("agent.resources.max_rss", 0)
 	cfg.SetDefault("agent.topology.probes", []string{"ovsdb"})
 	cfg.SetDefault("agent.topology.docker.url", "unix:///var/run/docker.sock")
 	cfg.SetDefault("agent.topology.docker.netns.run_path", "/var/run/docker/netns")
+	cfg.SetDefault("agent.topology.podman.url", "unix:///run/podman/podman.sock")
+	cfg.SetDefault("agent.topology.podman.rootless", true)
 	cfg.SetDefault("agent.topology.netlink.metrics_update", 30)
 	cfg.SetDefault("agent.topology.netns.run_path", "/var/run/netns")
+	cfg.SetDefault("agent.topology.netns.reconcile_interval", 30)
 	cfg.SetDefault("agent.topology.neutron.domain_name", "Default")
 	cfg.SetDefault("agent.topology.neutron.endpoint_type", "public")
 	cfg.SetDefault("agent.topology.neutron.ssl_insecure", false)
@@ -125,18 +146,89 @@ func init() {
 	cfg.SetDefault("agent.topology.vpp.connect", "")
 	cfg.SetDefault("agent.topology.bess.host", "127.0.0.1")
 	cfg.SetDefault("agent.topology.bess.port", 10514)
-
+	cfg.SetDefault("agent.topology.bgp.bird_socket", "/var/run/bird/bird.ctl")
+	cfg.SetDefault("agent.topology.bgp.daemon", "auto")
+	cfg.SetDefault("agent.topology.bgp.gobgp_host", "127.0.0.1")
+	cfg.SetDefault("agent.topology.bgp.gobgp_port", 50051)
+	cfg.SetDefault("agent.topology.bgp.poll_interval", 10)
+	cfg.SetDefault("agent.topology.cilium.socket", "/var/run/cilium/cilium.sock")
+	cfg.SetDefault("agent.topology.cilium.poll_interval", 10)
+	cfg.SetDefault("agent.topology.containerd.endpoint", "unix:///run/containerd/containerd.sock")
+	cfg.SetDefault("agent.topology.containerd.poll_interval", 10)
+	cfg.SetDefault("agent.topology.crio.endpoint", "unix:///var/run/crio/crio.sock")
+	cfg.SetDefault("agent.topology.crio.poll_interval", 10)
+	cfg.SetDefault("agent.topology.firewall.backend", "auto")
+	cfg.SetDefault("agent.topology.firewall.poll_interval", 30)
+	cfg.SetDefault("agent.topology.conntrack.poll_interval", 5)
+
+	cfg.SetDefault("analyzer.alert.history_ttl", 604800)
+	cfg.SetDefault("analyzer.audit.enabled", true)
+	cfg.SetDefault("analyzer.audit.ttl", 2592000)
+	cfg.SetDefault("analyzer.audit.max_payload", 65536)
+	cfg.SetDefault("analyzer.audit.reads", true)
 	cfg.SetDefault("analyzer.auth.cluster.backend", "noauth")
 	cfg.SetDefault("analyzer.auth.api.backend", "noauth")
+	cfg.SetDefault("analyzer.clustering.enabled", false)
+	cfg.SetDefault("analyzer.clustering.replicas", 100)
+	cfg.SetDefault("analyzer.detection.exfiltration.bytes", 100*1024*1024)
+	cfg.SetDefault("analyzer.detection.exfiltration.ratio", 10)
+	cfg.SetDefault("analyzer.detection.port_scan.ports", 100)
+	cfg.SetDefault("analyzer.detection.syn_flood.min_flows", 100)
+	cfg.SetDefault("analyzer.detection.syn_flood.ratio", 0.8)
+	cfg.SetDefault("analyzer.detection.window", 60)
+	cfg.SetDefault("analyzer.diagnostics.profiling", false)
+	cfg.SetDefault("analyzer.federation.interval", 10)
+	cfg.SetDefault("analyzer.federation.topology", "G.V().Has('Type', Within('host', 'netns', 'bridge', 'ovsbridge')).SubGraph()")
+	cfg.SetDefault("analyzer.dependency.period", 60)
+	cfg.SetDefault("analyzer.dependency.retention", 86400)
 	cfg.SetDefault("analyzer.flow.backend", "memory")
+	cfg.SetDefault("analyzer.flow.bulk_insert.adaptive", true)
+	cfg.SetDefault("analyzer.flow.bulk_insert.max_size", 1000)
+	cfg.SetDefault("analyzer.flow.bulk_insert.min_delay", 1)
+	cfg.SetDefault("analyzer.flow.bulk_insert.min_size", 10)
+	cfg.SetDefault("analyzer.flow.bulk_insert.target_latency", 500)
 	cfg.SetDefault("analyzer.flow.max_buffer_size", 100000)
+	cfg.SetDefault("analyzer.flow.encryption.vault.mount", "transit")
+	cfg.SetDefault("analyzer.flow.masking.all_captures", false)
+	cfg.SetDefault("analyzer.flow.masking.drop_payload", true)
+	cfg.SetDefault("analyzer.flow.masking.hash_mac", true)
+	cfg.SetDefault("analyzer.flow.masking.ipv4_prefix", 24)
+	cfg.SetDefault("analyzer.flow.masking.ipv6_prefix", 48)
+	cfg.SetDefault("analyzer.flow.shards", 0)
+	cfg.SetDefault("analyzer.grpc.listen", "")
+	cfg.SetDefault("analyzer.handoff.max_age", 300)
+	cfg.SetDefault("analyzer.ids.correlation_window", 30)
+	cfg.SetDefault("analyzer.job.max_running", 4)
+	cfg.SetDefault("analyzer.job.result_ttl", 3600)
+	cfg.SetDefault("analyzer.latency.window", 60)
+	cfg.SetDefault("analyzer.rate_limit.burst", 100)
+	cfg.SetDefault("analyzer.rate_limit.max_concurrent_queries", 8)
+	cfg.SetDefault("analyzer.rate_limit.requests_per_second", 50)
+	cfg.SetDefault("analyzer.latency.min_samples", 10)
+	cfg.SetDefault("analyzer.latency.regression_ratio", 0.5)
 	cfg.SetDefault("analyzer.listen", "127.0.0.1:8082")
 	cfg.SetDefault("analyzer.replication.debug", false)
+	cfg.SetDefault("analyzer.topn.interval", 5)
+	cfg.SetDefault("analyzer.topn.window", 60)
 	cfg.SetDefault("analyzer.topology.backend", "memory")
 	cfg.SetDefault("analyzer.topology.probes", []string{})
 	cfg.SetDefault("analyzer.topology.k8s.config_file", "/etc/skydive/kubeconfig")
 	cfg.SetDefault("analyzer.topology.ovn.address", "unix:///var/run/openvswitch/ovnnb_db.sock")
+	cfg.SetDefault("analyzer.topology.ovn.sb_address", "unix:///var/run/openvswitch/ovnsb_db.sock")
 	cfg.SetDefault("analyzer.topology.istio.config_file", "/etc/skydive/kubeconfig")
+	cfg.SetDefault("analyzer.topology.vsphere.url", "https://localhost/sdk")
+	cfg.SetDefault("analyzer.topology.vsphere.insecure", false)
+	cfg.SetDefault("analyzer.topology.vsphere.poll_interval", 60)
+	cfg.SetDefault("analyzer.topology.snmp.community", "public")
+	cfg.SetDefault("analyzer.topology.snmp.version", "2c")
+	cfg.SetDefault("analyzer.topology.snmp.timeout", 5)
+	cfg.SetDefault("analyzer.topology.snmp.poll_interval", 60)
+	cfg.SetDefault("analyzer.topology.gnmi.tls", true)
+	cfg.SetDefault("analyzer.topology.gnmi.insecure", false)
+	cfg.SetDefault("analyzer.topology.gnmi.sample_interval", 10)
+	cfg.SetDefault("analyzer.webhook.max_retries", 3)
+	cfg.SetDefault("analyzer.webhook.queue_size", 1000)
+	cfg.SetDefault("analyzer.webhook.timeout", 5)
 
 	cfg.SetDefault("auth.basic.type", "basic") // defined for backward compatibility
 	cfg.SetDefault("auth.keystone.tenant_name", "admin")
@@ -166,6 +258,8 @@ func init() {
 	cfg.SetDefault("http.ws.ping_delay", 2)
 	cfg.SetDefault("http.ws.pong_timeout", 5)
 	cfg.SetDefault("http.ws.queue_size", 10000)
+	cfg.SetDefault("http.ws.replay_log_size", 10000)
+	cfg.SetDefault("http.ws.enable_compression", true)
 	cfg.SetDefault("http.ws.enable_write_compression", true)
 
 	cfg.SetDefault("logging.backends", []string{"stderr"})
@@ -173,6 +267,7 @@ func init() {
 	cfg.SetDefault("logging.encoder", "")
 	cfg.SetDefault("logging.file.path", "/var/log/skydive.log")
 	cfg.SetDefault("logging.level", "INFO")
+	cfg.SetDefault("logging.recent.size", 1000)
 	cfg.SetDefault("logging.syslog.tag", "skydive")
 
 	cfg.SetDefault("opencontrail.host", "localhost")
@@ -185,7 +280,7 @@ func init() {
 	cfg.SetDefault("ovs.enable_stats", false)
 
 	cfg.SetDefault("rbac.model.request_definition", []string{"sub, obj, act"})
-	cfg.SetDefault("rbac.model.policy_definition", []string{"sub, obj, act, eft"})
+	cfg.SetDefault("rbac.model.policy_definition", []string{"sub, obj, act, eft", "sub, obj, scope"})
 	cfg.SetDefault("rbac.model.role_definition", []string{"_, _"})
 	cfg.SetDefault("rbac.model.policy_effect", []string{"some(where (p_eft == allow)) && !some(where (p_eft == deny))"})
 	cfg.SetDefault("rbac.model.matchers", []string{"g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act"})
@@ -203,6 +298,15 @@ func init() {
 	cfg.SetDefault("storage.orientdb.username", "root")              // defined for backward compatibility and to set defaults
 	cfg.SetDefault("storage.orientdb.password", "root")              // defined for backward compatibility and to set defaults
 
+	cfg.SetDefault("tls.reload_interval", 60)
+	cfg.SetDefault("tls.require_client_cert", false)
+	cfg.SetDefault("tls.spiffe.timeout", 30)
+
+	cfg.SetDefault("tracing.enabled", false)
+	cfg.SetDefault("tracing.endpoint", "localhost:4318")
+	cfg.SetDefault("tracing.insecure", false)
+	cfg.SetDefault("tracing.sample_ratio", 1.0)
+
 	cfg.SetDefault("ui", map[string]interface{}{})
 
 	replacer := strings.NewReplacer(".", "_", "-", "_")
@@ -241,6 +345,67 @@ func checkConfig() error {
 		return err
 	}
 
+	if err := checkPositiveInt("tls.reload_interval"); err != nil {
+		return err
+	}
+
+	if err := checkStrictPositiveInt("analyzer.audit.ttl"); err != nil {
+		return err
+	}
+
+	if err := checkPositiveInt("analyzer.audit.max_payload"); err != nil {
+		return err
+	}
+
+	if err := checkPositiveInt("analyzer.rate_limit.max_concurrent_queries"); err != nil {
+		return err
+	}
+
+	if err := checkStrictPositiveInt("agent.resources.check_interval"); err != nil {
+		return err
+	}
+
+	if err := checkPositiveInt("agent.resources.max_rss"); err != nil {
+		return err
+	}
+
+	if err := checkStrictPositiveInt("analyzer.flow.bulk_insert.min_size"); err != nil {
+		return err
+	}
+
+	if err := checkStrictPositiveInt("analyzer.flow.bulk_insert.min_delay"); err != nil {
+		return err
+	}
+
+	if err := checkStrictPositiveInt("analyzer.flow.bulk_insert.target_latency"); err != nil {
+		return err
+	}
+
+	if err := checkPositiveInt("analyzer.flow.shards"); err != nil {
+		return err
+	}
+
+	if err := checkStrictPositiveInt("analyzer.dependency.period"); err != nil {
+		return err
+	}
+
+	if err := checkStrictPositiveInt("analyzer.dependency.retention"); err != nil {
+		return err
+	}
+
+	if err := checkStrictPositiveInt("analyzer.topn.interval"); err != nil {
+		return err
+	}
+
+	if ratio := cfg.GetFloat64("tracing.sample_ratio"); ratio < 0 || ratio > 1 {
+		return fmt.Errorf("invalid value for tracing.sample_ratio (%f)", ratio)
+	}
+
+	// flows sent over UDP can't be authenticated
+	if cfg.GetBool("tls.require_client_cert") && strings.ToLower(cfg.GetString("flow.protocol")) == "udp" {
+		return errors.New("flow.protocol must be set to websocket when tls.require_client_cert is enabled")
+	}
+
 	return checkPositiveInt("etcd.max_snap_files")
 }
 
@@ -397,10 +562,15 @@ func (c *SkydiveConfig) GetEtcdServerAddrs() []string {
 		}
 	}
 
+	scheme := "http"
+	if c.IsTLSEnabled() {
+		scheme = "https"
+	}
+
 	if address, err := c.GetOneAnalyzerServiceAddress(); err == nil {
-		return []string{fmt.Sprintf("http://%s:%d", address.Addr, port)}
+		return []string{fmt.Sprintf("%s://%s:%d", scheme, address.Addr, port)}
 	}
-	return []string{fmt.Sprintf("http://127.0.0.1:%d", port)}
+	return []string{fmt.Sprintf("%s://127.0.0.1:%d", scheme, port)}
 }
 
 // IsTLSEnabled returns true is the client / server certificates are set
@@ -409,7 +579,12 @@ func IsTLSEnabled() bool {
 }
 
 // IsTLSEnabled returns true is the client / server certificates are set
+// or fetched from the SPIFFE Workload API
 func (c *SkydiveConfig) IsTLSEnabled() bool {
+	return c.isTLSFilesSet() || c.GetString("tls.spiffe.socket") != ""
+}
+
+func (c *SkydiveConfig) isTLSFilesSet() bool {
 	client := c.GetString("tls.client_cert")
 	clientKey := c.GetString("tls.client_key")
 	server := c.GetString("tls.server_cert")
@@ -527,6 +702,40 @@ func (c *SkydiveConfig) GetStringMapString(key string) map[string]string {
 	return c.Viper.GetStringMapString(realKey(key))
 }
 
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if secretKey.MatchString(key) && value != nil && value != "" {
+				redacted[key] = "<redacted>"
+			} else {
+				redacted[key] = redact(value)
+			}
+		}
+		return redacted
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprintf("%v", key)] = value
+		}
+		return redact(m)
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, value := range v {
+			redacted[i] = redact(value)
+		}
+		return redacted
+	}
+	return value
+}
+
+// GetRedactedSettings returns all the settings, the non empty values of
+// the keys holding secrets, such as passwords or tokens, being redacted
+func GetRedactedSettings() map[string]interface{} {
+	return redact(cfg.AllSettings()).(map[string]interface{})
+}
+
 // BindPFlag binds a command line flag to a configuration value
 func BindPFlag(key string, flag *pflag.Flag) error {
 	return cfg.BindPFlag(key, flag)
@@ -82,3 +82,45 @@ openstack:
 		t.Fatal("Relocation with default failed")
 	}
 }
+
+func TestRedactedSettings(t *testing.T) {
+	cfg.SetConfigType("yaml")
+
+	var yamlv1 = []byte(`
+analyzer:
+  auth:
+    cluster:
+      username: admin
+      password: secret
+auth:
+  basic:
+    type: basic
+    users:
+      admin: secret
+etcd:
+  servers:
+    - http://etcd:2379
+  client_token: ""
+`)
+
+	cfg.ReadConfig(bytes.NewBuffer(yamlv1))
+	settings := GetRedactedSettings()
+
+	cluster := settings["analyzer"].(map[string]interface{})["auth"].(map[string]interface{})["cluster"].(map[string]interface{})
+	if cluster["username"] != "admin" || cluster["password"] != "<redacted>" {
+		t.Fatalf("Cluster password should be redacted, got: %v", cluster)
+	}
+
+	basic := settings["auth"].(map[string]interface{})["basic"].(map[string]interface{})
+	if basic["type"] != "basic" || basic["users"] != "<redacted>" {
+		t.Fatalf("Basic users should be redacted, got: %v", basic)
+	}
+
+	etcd := settings["etcd"].(map[string]interface{})
+	if etcd["client_token"] != "" {
+		t.Fatalf("Empty token should be kept, got: %v", etcd)
+	}
+	if servers := etcd["servers"].([]interface{}); len(servers) != 1 || servers[0] != "http://etcd:2379" {
+		t.Fatalf("Servers should be kept, got: %v", etcd)
+	}
+}
@@ -70,5 +70,20 @@ func InitLogging() error {
 		loggers = append(loggers, logging.NewLoggerConfig(backend, logLevel, encoder))
 	}
 
-	return logging.InitLogging(id, color, loggers)
+	// keep the last lines for the diagnostics API
+	if size := cfg.GetInt("logging.recent.size"); size > 0 {
+		loggers = append(loggers, logging.NewLoggerConfig(logging.NewRecentBackend(size), defaultLogLevel, defaultEncoder))
+	}
+
+	if err := logging.InitLogging(id, color, loggers); err != nil {
+		return err
+	}
+
+	for module, level := range cfg.GetStringMapString("logging.modules") {
+		if err := logging.SetModuleLevel(module, level); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -19,30 +19,94 @@ package config
 
 import (
 	"crypto/tls"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
 
-	"github.com/skydive-project/skydive/common"
+	"github.com/coreos/etcd/pkg/transport"
+
+	"github.com/skydive-project/skydive/certificate"
+	"github.com/skydive-project/skydive/logging"
+)
+
+var (
+	certSourcesLock sync.Mutex
+	certSources     = make(map[string]certificate.Source)
+	etcdFileExport  *certificate.FileExport
 )
 
+// getCertificateSource returns the source of the certificate identified
+// by the given key, created on first use and then shared by all the TLS
+// configurations so that they all see the rotated certificates. The files
+// are ignored when the SPIFFE Workload API is used.
+func getCertificateSource(key, certPEM, keyPEM, caPEM string) (certificate.Source, error) {
+	certSourcesLock.Lock()
+	defer certSourcesLock.Unlock()
+
+	socket := GetString("tls.spiffe.socket")
+	if socket != "" {
+		key = "spiffe"
+	}
+
+	if src, found := certSources[key]; found {
+		return src, nil
+	}
+
+	var src certificate.Source
+	var err error
+	if socket != "" {
+		timeout := time.Duration(GetInt("tls.spiffe.timeout")) * time.Second
+		src, err = certificate.NewWorkloadSource(socket, timeout)
+	} else {
+		interval := time.Duration(GetInt("tls.reload_interval")) * time.Second
+		src, err = certificate.NewFileSource(certPEM, keyPEM, caPEM, interval)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	certSources[key] = src
+	return src, nil
+}
+
+func getCertificateOpts(src certificate.Source) certificate.Opts {
+	opts := certificate.Opts{RequireClientCert: GetBool("tls.require_client_cert")}
+
+	if GetString("tls.spiffe.socket") != "" {
+		opts.TrustDomain = GetString("tls.spiffe.trust_domain")
+		if opts.TrustDomain == "" {
+			// default to the trust domain of our own SVID
+			if cert, err := src.Certificate(); err == nil {
+				if id, err := certificate.SpiffeID(cert.Leaf); err == nil {
+					opts.TrustDomain = id.Host
+				}
+			}
+		}
+	}
+
+	return opts
+}
+
 // GetTLSClientConfig returns TLS config to be used by client
 func GetTLSClientConfig(setupRootCA bool) (*tls.Config, error) {
 	certPEM := GetString("tls.client_cert")
 	keyPEM := GetString("tls.client_key")
-	var tlsConfig *tls.Config
-	if certPEM != "" && keyPEM != "" {
-		var err error
-		tlsConfig, err = common.SetupTLSClientConfig(certPEM, keyPEM)
-		if err != nil {
-			return nil, err
-		}
-		if setupRootCA {
-			rootCaPEM := GetString("tls.ca_cert")
-			tlsConfig.RootCAs, err = common.SetupTLSLoadCA(rootCaPEM)
-			if err != nil {
-				return nil, err
-			}
-		}
+	if (certPEM == "" || keyPEM == "") && GetString("tls.spiffe.socket") == "" {
+		return nil, nil
 	}
-	return tlsConfig, nil
+
+	var rootCaPEM string
+	if setupRootCA {
+		rootCaPEM = GetString("tls.ca_cert")
+	}
+
+	src, err := getCertificateSource("client:"+rootCaPEM, certPEM, keyPEM, rootCaPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return certificate.ClientConfig(src, getCertificateOpts(src)), nil
 }
 
 // GetTLSServerConfig returns TLS config to be used by server
@@ -50,16 +114,76 @@ func GetTLSServerConfig(setupRootCA bool) (*tls.Config, error) {
 	certPEM := GetString("tls.server_cert")
 	keyPEM := GetString("tls.server_key")
 
-	tlsConfig, err := common.SetupTLSServerConfig(certPEM, keyPEM)
+	var rootCaPEM string
+	if setupRootCA {
+		rootCaPEM = GetString("tls.ca_cert")
+	}
+
+	src, err := getCertificateSource("server:"+rootCaPEM, certPEM, keyPEM, rootCaPEM)
 	if err != nil {
 		return nil, err
 	}
-	if setupRootCA {
-		rootCaPEM := GetString("tls.ca_cert")
-		tlsConfig.ClientCAs, err = common.SetupTLSLoadCA(rootCaPEM)
+
+	return certificate.ServerConfig(src, getCertificateOpts(src)), nil
+}
+
+// getEtcdFileExport returns the files the X509-SVIDs are written to for
+// the embedded etcd, in the tls directory of its data directory
+func getEtcdFileExport() (*certificate.FileExport, error) {
+	src, err := getCertificateSource("spiffe", "", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	certSourcesLock.Lock()
+	defer certSourcesLock.Unlock()
+
+	if etcdFileExport != nil {
+		return etcdFileExport, nil
+	}
+
+	pemSource, ok := src.(certificate.PEMSource)
+	if !ok {
+		return nil, fmt.Errorf("Certificate source %T can't be exported to files", src)
+	}
+
+	dir := filepath.Join(GetString("etcd.data_dir"), "tls")
+	interval := time.Duration(GetInt("tls.reload_interval")) * time.Second
+	if etcdFileExport, err = certificate.NewFileExport(pemSource, dir, interval); err != nil {
+		return nil, err
+	}
+
+	logging.GetLogger().Infof("X509-SVIDs exported to %s for the embedded etcd", dir)
+	return etcdFileExport, nil
+}
+
+// GetEtcdServerTLSInfo returns the TLS settings of the embedded etcd, empty
+// when TLS is not enabled. etcd loads the certificate files on each
+// handshake, so the rotated certificates are used without restart. The
+// X509-SVIDs of the SPIFFE Workload API are written to files for etcd.
+func GetEtcdServerTLSInfo() (transport.TLSInfo, error) {
+	if GetString("tls.spiffe.socket") != "" {
+		export, err := getEtcdFileExport()
 		if err != nil {
-			return nil, err
+			return transport.TLSInfo{}, err
 		}
+
+		return transport.TLSInfo{
+			CertFile:       export.CertFile,
+			KeyFile:        export.KeyFile,
+			TrustedCAFile:  export.CAFile,
+			ClientCertAuth: GetBool("tls.require_client_cert"),
+		}, nil
 	}
-	return tlsConfig, nil
+
+	if !cfg.isTLSFilesSet() {
+		return transport.TLSInfo{}, nil
+	}
+
+	return transport.TLSInfo{
+		CertFile:       GetString("tls.server_cert"),
+		KeyFile:        GetString("tls.server_key"),
+		TrustedCAFile:  GetString("tls.ca_cert"),
+		ClientCertAuth: GetBool("tls.require_client_cert"),
+	}, nil
 }
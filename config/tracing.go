@@ -0,0 +1,38 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package config
+
+import (
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/tracing"
+)
+
+// InitTracing sets up the export of the spans of a service based on the
+// section "tracing" of the configuration file
+func InitTracing(service common.Service) error {
+	if !GetBool("tracing.enabled") {
+		return nil
+	}
+
+	return tracing.Init(service, tracing.Options{
+		Endpoint:    GetString("tracing.endpoint"),
+		Insecure:    GetBool("tracing.insecure"),
+		Headers:     GetStringMapString("tracing.headers"),
+		SampleRatio: cfg.GetFloat64("tracing.sample_ratio"),
+	})
+}
@@ -32,6 +32,7 @@ func NewWSClient(clientType common.ServiceType, url *url.URL, opts websocket.Cli
 
 	// override some of the options with config value
 	opts.QueueSize = GetInt("http.ws.queue_size")
+	opts.Compression = GetBool("http.ws.enable_compression")
 	opts.WriteCompression = GetBool("http.ws.enable_write_compression")
 	tlsConfig, err := GetTLSClientConfig(true)
 	if err != nil {
@@ -47,6 +48,7 @@ func NewWSServer(server *shttp.Server, endpoint string, authBackend shttp.Authen
 	pingDelay := time.Duration(GetInt("http.ws.ping_delay")) * time.Second
 
 	opts := websocket.ServerOpts{
+		Compression:      GetBool("http.ws.enable_compression"),
 		WriteCompression: GetBool("http.ws.enable_write_compression"),
 		QueueSize:        GetInt("http.ws.queue_size"),
 		PingDelay:        pingDelay,
@@ -0,0 +1,201 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package dependency
+
+import (
+	"sort"
+)
+
+const (
+	// ServiceGroup is a Kubernetes service, grouping the endpoints of its
+	// pods and its cluster IP
+	ServiceGroup = "service"
+	// PodGroup is a Kubernetes pod not selected by any service
+	PodGroup = "pod"
+	// VMGroup is a libvirt domain, identified by the MAC addresses of its
+	// interfaces
+	VMGroup = "vm"
+	// HostGroup is a host, grouping the addresses of its interfaces and
+	// network namespaces
+	HostGroup = "host"
+	// IPGroup is an address that could not be resolved to any node
+	IPGroup = "ip"
+)
+
+// Group describes a set of endpoints acting as a single service
+type Group struct {
+	ID   string
+	Kind string
+	Name string
+	Host string `json:",omitempty"`
+}
+
+// Dependency describes the traffic from a client group to a port of a
+// server group. Timestamps are in milliseconds.
+type Dependency struct {
+	Client   string
+	Server   string
+	Protocol string
+	Port     int64 `json:",omitempty"`
+	Flows    int64
+	Packets  int64
+	Bytes    int64
+	First    int64
+	Last     int64
+}
+
+// Map describes the dependencies between groups over a time range
+// swagger:model DependencyMap
+type Map struct {
+	Start        int64
+	Last         int64
+	Groups       []*Group
+	Dependencies []*Dependency
+}
+
+type dependencyKey struct {
+	client, server, protocol string
+	port                     int64
+}
+
+// bucket holds the dependencies observed during an aggregation period
+type bucket struct {
+	start        int64
+	last         int64
+	groups       map[string]*Group
+	dependencies map[dependencyKey]*Dependency
+}
+
+// add accounts the packets and bytes of a flow update, newFlow telling
+// whether the flow was not reported before
+func (b *bucket) add(client, server *Group, protocol string, port int64, newFlow bool, packets, bytes, ts int64) {
+	b.groups[client.ID] = client
+	b.groups[server.ID] = server
+
+	key := dependencyKey{client: client.ID, server: server.ID, protocol: protocol, port: port}
+
+	d, found := b.dependencies[key]
+	if !found {
+		d = &Dependency{
+			Client:   client.ID,
+			Server:   server.ID,
+			Protocol: protocol,
+			Port:     port,
+			First:    ts,
+		}
+		b.dependencies[key] = d
+	}
+
+	if newFlow {
+		d.Flows++
+	}
+	d.Packets += packets
+	d.Bytes += bytes
+	if ts < d.First {
+		d.First = ts
+	}
+	if ts > d.Last {
+		d.Last = ts
+	}
+}
+
+func (b *bucket) overlaps(from, to int64) bool {
+	return (from == 0 || b.last >= from) && (to == 0 || b.start <= to)
+}
+
+// merge returns the map of the dependencies of the buckets overlapping the
+// given range, a zero bound meaning no bound
+func merge(buckets []*bucket, from, to int64) *Map {
+	m := &Map{}
+
+	groups := make(map[string]*Group)
+	dependencies := make(map[dependencyKey]*Dependency)
+
+	for _, b := range buckets {
+		if !b.overlaps(from, to) {
+			continue
+		}
+
+		if m.Start == 0 || b.start < m.Start {
+			m.Start = b.start
+		}
+		if b.last > m.Last {
+			m.Last = b.last
+		}
+
+		for id, group := range b.groups {
+			groups[id] = group
+		}
+
+		for key, d := range b.dependencies {
+			merged, found := dependencies[key]
+			if !found {
+				c := *d
+				dependencies[key] = &c
+				continue
+			}
+
+			merged.Flows += d.Flows
+			merged.Packets += d.Packets
+			merged.Bytes += d.Bytes
+			if d.First < merged.First {
+				merged.First = d.First
+			}
+			if d.Last > merged.Last {
+				merged.Last = d.Last
+			}
+		}
+	}
+
+	m.Groups = make([]*Group, 0, len(groups))
+	for _, group := range groups {
+		m.Groups = append(m.Groups, group)
+	}
+	sort.Slice(m.Groups, func(i, j int) bool {
+		return m.Groups[i].ID < m.Groups[j].ID
+	})
+
+	m.Dependencies = make([]*Dependency, 0, len(dependencies))
+	for _, d := range dependencies {
+		m.Dependencies = append(m.Dependencies, d)
+	}
+	sort.Slice(m.Dependencies, func(i, j int) bool {
+		a, b := m.Dependencies[i], m.Dependencies[j]
+		if a.Client != b.Client {
+			return a.Client < b.Client
+		}
+		if a.Server != b.Server {
+			return a.Server < b.Server
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		return a.Port < b.Port
+	})
+
+	return m
+}
+
+func newBucket(start int64) *bucket {
+	return &bucket{
+		start:        start,
+		last:         start,
+		groups:       make(map[string]*Group),
+		dependencies: make(map[dependencyKey]*Dependency),
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package dependency
+
+import (
+	"testing"
+)
+
+func TestMergeBuckets(t *testing.T) {
+	frontend := &Group{ID: "service/default/frontend", Kind: ServiceGroup, Name: "default/frontend"}
+	backend := &Group{ID: "service/default/backend", Kind: ServiceGroup, Name: "default/backend"}
+	db := &Group{ID: "vm/host1/db", Kind: VMGroup, Name: "db", Host: "host1"}
+
+	b1 := newBucket(1000)
+	b1.add(frontend, backend, "TCP", 8080, true, 10, 1000, 1100)
+	b1.add(frontend, backend, "TCP", 8080, true, 5, 500, 1200)
+	b1.last = 2000
+
+	b2 := newBucket(2000)
+	b2.add(frontend, backend, "TCP", 8080, false, 2, 200, 2500)
+	b2.add(backend, db, "TCP", 5432, true, 4, 400, 2600)
+	b2.last = 3000
+
+	buckets := []*bucket{b1, b2}
+
+	m := merge(buckets, 0, 0)
+	if m.Start != 1000 || m.Last != 3000 {
+		t.Fatalf("Wrong time range: %d-%d", m.Start, m.Last)
+	}
+
+	if len(m.Groups) != 3 || len(m.Dependencies) != 2 {
+		t.Fatalf("Expected 3 groups and 2 dependencies, got: %+v %+v", m.Groups, m.Dependencies)
+	}
+
+	d := m.Dependencies[1]
+	if d.Client != frontend.ID || d.Server != backend.ID || d.Port != 8080 {
+		t.Fatalf("Wrong dependency: %+v", d)
+	}
+
+	if d.Flows != 2 || d.Packets != 17 || d.Bytes != 1700 || d.First != 1100 || d.Last != 2500 {
+		t.Fatalf("Wrong dependency statistics: %+v", d)
+	}
+
+	// the merged dependencies must not alter the buckets
+	if b1.dependencies[dependencyKey{client: frontend.ID, server: backend.ID, protocol: "TCP", port: 8080}].Packets != 15 {
+		t.Fatal("Bucket modified by the merge")
+	}
+
+	m = merge(buckets, 500, 1500)
+	if len(m.Groups) != 2 || len(m.Dependencies) != 1 || m.Dependencies[0].Packets != 15 {
+		t.Fatalf("Expected the dependencies of the first bucket only, got: %+v", m.Dependencies)
+	}
+
+	m = merge(buckets, 5000, 0)
+	if len(m.Groups) != 0 || len(m.Dependencies) != 0 {
+		t.Fatalf("Expected no dependency, got: %+v", m.Dependencies)
+	}
+}
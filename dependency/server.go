@@ -0,0 +1,286 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package dependency
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/topology/probes/k8s"
+)
+
+// trackedFlow records the capture point whose updates are accounted for a
+// flow, the same flow being reported by every capture point on its path
+type trackedFlow struct {
+	uuid string
+	seen int64
+}
+
+// Server aggregates the flows received by the analyzer into a dependency
+// map between services, virtual machines and hosts
+type Server struct {
+	sync.RWMutex
+	Graph     *graph.Graph
+	period    time.Duration
+	retention time.Duration
+	current   *bucket
+	history   []*bucket
+	addresses map[string]*Group
+	macs      map[string]*Group
+	tracked   map[string]*trackedFlow
+	quit      chan bool
+	wg        sync.WaitGroup
+}
+
+func hostGroup(host string) *Group {
+	return &Group{ID: HostGroup + "/" + host, Kind: HostGroup, Name: host, Host: host}
+}
+
+func k8sGroup(kind string, node *graph.Node) *Group {
+	namespace, _ := node.GetFieldString("K8s.Namespace")
+	name, _ := node.GetFieldString("Name")
+	return &Group{ID: kind + "/" + namespace + "/" + name, Kind: kind, Name: namespace + "/" + name}
+}
+
+// refreshEndpoints maps the IP addresses and the MAC addresses of the
+// graph to their groups, the most specific group winning
+func (s *Server) refreshEndpoints() {
+	addresses := make(map[string]*Group)
+	macs := make(map[string]*Group)
+
+	s.Graph.RLock()
+
+	for _, node := range s.Graph.GetNodes(nil) {
+		if node.Host == "" {
+			continue
+		}
+
+		for _, field := range []string{"IPV4", "IPV6"} {
+			addrs, _ := node.GetFieldStringList(field)
+			for _, addr := range addrs {
+				addresses[strings.SplitN(addr, "/", 2)[0]] = hostGroup(node.Host)
+			}
+		}
+
+		if domain, _ := node.GetFieldString("Libvirt.Domain"); domain != "" {
+			if mac, _ := node.GetFieldString("PeerIntfMAC"); mac != "" {
+				macs[strings.ToLower(mac)] = &Group{ID: VMGroup + "/" + node.Host + "/" + domain, Kind: VMGroup, Name: domain, Host: node.Host}
+			}
+		}
+	}
+
+	for _, pod := range s.Graph.GetNodes(graph.Metadata{"Manager": k8s.Manager, "Type": "pod"}) {
+		// pods of the host network share the addresses of their host
+		if hostNetwork, _ := pod.GetFieldBool("K8s.Extra.Spec.HostNetwork"); hostNetwork {
+			continue
+		}
+		if ip, _ := pod.GetFieldString("K8s.IP"); ip != "" {
+			addresses[ip] = k8sGroup(PodGroup, pod)
+		}
+	}
+
+	for _, service := range s.Graph.GetNodes(graph.Metadata{"Manager": k8s.Manager, "Type": "service"}) {
+		group := k8sGroup(ServiceGroup, service)
+
+		if ip, _ := service.GetFieldString("K8s.ClusterIP"); ip != "" && ip != "None" {
+			addresses[ip] = group
+		}
+
+		for _, pod := range s.Graph.LookupChildren(service, graph.Metadata{"Type": "pod"}, graph.Metadata{"RelationType": "service"}) {
+			ip, _ := pod.GetFieldString("K8s.IP")
+
+			current, found := addresses[ip]
+			if !found {
+				continue
+			}
+
+			// a pod selected by several services is consistently accounted
+			// to the first one
+			if current.Kind == PodGroup || current.Kind == ServiceGroup && group.ID < current.ID {
+				addresses[ip] = group
+			}
+		}
+	}
+
+	s.Graph.RUnlock()
+
+	s.Lock()
+	s.addresses = addresses
+	s.macs = macs
+	s.Unlock()
+}
+
+// resolve returns the group of an endpoint, by IP address then by MAC
+// address for the virtual machines whose addresses are unknown to the graph
+func (s *Server) resolve(ip, mac string) *Group {
+	if group, found := s.addresses[ip]; found {
+		return group
+	}
+	if group, found := s.macs[strings.ToLower(mac)]; found {
+		return group
+	}
+	return &Group{ID: IPGroup + "/" + ip, Kind: IPGroup, Name: ip}
+}
+
+// OnFlows accounts the flow updates into the current bucket
+func (s *Server) OnFlows(flows []*flow.Flow) {
+	now := common.UnixMillis(time.Now())
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, f := range flows {
+		metric := f.LastUpdateMetric
+		if metric == nil {
+			metric = f.Metric
+		}
+		if f.Network == nil || metric == nil {
+			continue
+		}
+
+		t, found := s.tracked[f.TrackingID]
+		if !found {
+			t = &trackedFlow{uuid: f.UUID}
+			s.tracked[f.TrackingID] = t
+		} else if t.uuid != f.UUID {
+			continue
+		}
+		t.seen = now
+
+		var macA, macB string
+		if f.Link != nil {
+			macA, macB = f.Link.A, f.Link.B
+		}
+		client, server := s.resolve(f.Network.A, macA), s.resolve(f.Network.B, macB)
+
+		protocol, port := f.Application, int64(0)
+		if f.Transport != nil {
+			protocol, port = f.Transport.Protocol.String(), f.Transport.B
+
+			// the first packet captured is a reply when the capture started
+			// in the middle of a connection
+			if f.Transport.A < 1024 && f.Transport.B >= 1024 {
+				client, server, port = server, client, f.Transport.A
+			}
+		}
+
+		s.current.add(client, server, protocol, port, !found, metric.ABPackets+metric.BAPackets, metric.ABBytes+metric.BABytes, f.Last)
+
+		if f.FinishType != flow.FlowFinishType_NOT_FINISHED {
+			delete(s.tracked, f.TrackingID)
+		}
+	}
+}
+
+// rotate closes the current bucket and drops the ones out of the retention
+func (s *Server) rotate() {
+	now := time.Now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.current.last = common.UnixMillis(now)
+	s.history = append(s.history, s.current)
+	s.current = newBucket(s.current.last)
+
+	expire := common.UnixMillis(now.Add(-s.retention))
+	for len(s.history) > 0 && s.history[0].last < expire {
+		s.history = s.history[1:]
+	}
+
+	// flows may expire on the agents without being reported as finished
+	unseen := common.UnixMillis(now.Add(-10 * s.period))
+	for id, t := range s.tracked {
+		if t.seen < unseen {
+			delete(s.tracked, id)
+		}
+	}
+}
+
+// GetDependencyMap returns the dependencies observed between the given
+// times, a zero time meaning no bound
+func (s *Server) GetDependencyMap(from, to time.Time) (interface{}, error) {
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return nil, errors.New("The end of the time range is before its start")
+	}
+
+	var start, last int64
+	if !from.IsZero() {
+		start = common.UnixMillis(from)
+	}
+	if !to.IsZero() {
+		last = common.UnixMillis(to)
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	current := *s.current
+	current.last = common.UnixMillis(time.Now())
+
+	return merge(append(s.history[:len(s.history):len(s.history)], &current), start, last), nil
+}
+
+// Start the dependency server
+func (s *Server) Start() {
+	s.refreshEndpoints()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.period)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.rotate()
+				s.refreshEndpoints()
+			case <-s.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the dependency server
+func (s *Server) Stop() {
+	s.quit <- true
+	s.wg.Wait()
+}
+
+// NewServer creates a new dependency server
+func NewServer(g *graph.Graph) *Server {
+	return &Server{
+		Graph:     g,
+		period:    time.Duration(config.GetInt("analyzer.dependency.period")) * time.Second,
+		retention: time.Duration(config.GetInt("analyzer.dependency.retention")) * time.Second,
+		current:   newBucket(common.UnixMillis(time.Now())),
+		addresses: make(map[string]*Group),
+		macs:      make(map[string]*Group),
+		tracked:   make(map[string]*trackedFlow),
+		quit:      make(chan bool),
+	}
+}
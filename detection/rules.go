@@ -0,0 +1,208 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package detection
+
+import (
+	"sort"
+
+	"github.com/skydive-project/skydive/flow"
+)
+
+// Rule names
+const (
+	PortScan     = "portscan"
+	SynFlood     = "synflood"
+	Exfiltration = "exfiltration"
+)
+
+// maxFlows limits the number of flows attached to a detection
+const maxFlows = 20
+
+// Detection describes a suspicious traffic pattern found in the flows of
+// an aggregation window
+type Detection struct {
+	Rule      string
+	Source    string `json:",omitempty"`
+	Target    string `json:",omitempty"`
+	Value     float64
+	Threshold float64
+	Flows     []*flow.Flow
+}
+
+// Rules holds the thresholds of the detection rules
+type Rules struct {
+	// Number of distinct destination ports contacted by a host
+	PortScanPorts int
+	// Minimum number of TCP connection attempts to a host
+	SynFloodMinFlows int
+	// Ratio of connection attempts without answer
+	SynFloodRatio float64
+	// Minimum number of bytes sent by the initiator of a flow
+	ExfiltrationBytes int64
+	// Minimum ratio between the bytes sent and received by the initiator
+	ExfiltrationRatio float64
+}
+
+// sample returns at most maxFlows flows, the largest first
+func sample(flows []*flow.Flow) []*flow.Flow {
+	sort.Slice(flows, func(i, j int) bool {
+		return flows[i].Metric.ABBytes+flows[i].Metric.BABytes > flows[j].Metric.ABBytes+flows[j].Metric.BABytes
+	})
+	if len(flows) > maxFlows {
+		flows = flows[:maxFlows]
+	}
+	return flows
+}
+
+func isTCP(f *flow.Flow) bool {
+	return f.Network != nil && f.Transport != nil && f.Transport.Protocol == flow.FlowProtocol_TCP && f.Metric != nil
+}
+
+// unanswered returns whether the connection attempt of the flow got no
+// answer, using the SYN timestamps when the TCP metrics are captured
+func unanswered(f *flow.Flow) bool {
+	if f.TCPMetric != nil && f.TCPMetric.ABSynStart != 0 {
+		return f.TCPMetric.BASynStart == 0
+	}
+	return f.Metric.ABPackets > 0 && f.Metric.BAPackets == 0
+}
+
+// portScans reports the hosts contacting too many distinct ports
+func (r *Rules) portScans(flows []*flow.Flow) (detections []*Detection) {
+	type portKey struct {
+		dst  string
+		port int64
+	}
+
+	ports := make(map[string]map[portKey]bool)
+	sources := make(map[string][]*flow.Flow)
+	for _, f := range flows {
+		if f.Network == nil || f.Transport == nil || f.Metric == nil {
+			continue
+		}
+
+		src := f.Network.A
+		if ports[src] == nil {
+			ports[src] = make(map[portKey]bool)
+		}
+		ports[src][portKey{dst: f.Network.B, port: f.Transport.B}] = true
+		sources[src] = append(sources[src], f)
+	}
+
+	for src, contacted := range ports {
+		if len(contacted) > r.PortScanPorts {
+			detections = append(detections, &Detection{
+				Rule:      PortScan,
+				Source:    src,
+				Value:     float64(len(contacted)),
+				Threshold: float64(r.PortScanPorts),
+				Flows:     sample(sources[src]),
+			})
+		}
+	}
+	return
+}
+
+// synFloods reports the hosts receiving too many connection attempts left
+// without answer
+func (r *Rules) synFloods(flows []*flow.Flow) (detections []*Detection) {
+	attempts := make(map[string][]*flow.Flow)
+	for _, f := range flows {
+		if isTCP(f) {
+			attempts[f.Network.B] = append(attempts[f.Network.B], f)
+		}
+	}
+
+	for dst, flows := range attempts {
+		if len(flows) < r.SynFloodMinFlows {
+			continue
+		}
+
+		var pending []*flow.Flow
+		for _, f := range flows {
+			if unanswered(f) {
+				pending = append(pending, f)
+			}
+		}
+
+		if ratio := float64(len(pending)) / float64(len(flows)); ratio >= r.SynFloodRatio {
+			detections = append(detections, &Detection{
+				Rule:      SynFlood,
+				Target:    dst,
+				Value:     ratio,
+				Threshold: r.SynFloodRatio,
+				Flows:     sample(pending),
+			})
+		}
+	}
+	return
+}
+
+// exfiltrations reports the large transfers sent by the initiator of a
+// connection while receiving few data back
+func (r *Rules) exfiltrations(flows []*flow.Flow) (detections []*Detection) {
+	type pairKey struct {
+		src, dst string
+	}
+
+	sent := make(map[pairKey]int64)
+	received := make(map[pairKey]int64)
+	pairs := make(map[pairKey][]*flow.Flow)
+	for _, f := range flows {
+		if f.Network == nil || f.Metric == nil {
+			continue
+		}
+
+		key := pairKey{src: f.Network.A, dst: f.Network.B}
+		sent[key] += f.Metric.ABBytes
+		received[key] += f.Metric.BABytes
+		pairs[key] = append(pairs[key], f)
+	}
+
+	for key, bytes := range sent {
+		if bytes < r.ExfiltrationBytes || float64(bytes) < float64(received[key])*r.ExfiltrationRatio {
+			continue
+		}
+
+		detections = append(detections, &Detection{
+			Rule:      Exfiltration,
+			Source:    key.src,
+			Target:    key.dst,
+			Value:     float64(bytes),
+			Threshold: float64(r.ExfiltrationBytes),
+			Flows:     sample(pairs[key]),
+		})
+	}
+	return
+}
+
+// Detect applies the rules to the flows of a window
+func (r *Rules) Detect(flows []*flow.Flow) []*Detection {
+	var detections []*Detection
+	detections = append(detections, r.portScans(flows)...)
+	detections = append(detections, r.synFloods(flows)...)
+	detections = append(detections, r.exfiltrations(flows)...)
+
+	sort.SliceStable(detections, func(i, j int) bool {
+		if detections[i].Rule != detections[j].Rule {
+			return detections[i].Rule < detections[j].Rule
+		}
+		return detections[i].Source+detections[i].Target < detections[j].Source+detections[j].Target
+	})
+	return detections
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package detection
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/skydive-project/skydive/flow"
+)
+
+func newFlow(a, b string, port int64, metric *flow.FlowMetric) *flow.Flow {
+	return &flow.Flow{
+		TrackingID: fmt.Sprintf("%s-%s-%d", a, b, port),
+		Network:    &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV4, A: a, B: b},
+		Transport:  &flow.TransportLayer{Protocol: flow.FlowProtocol_TCP, A: 45000, B: port},
+		Metric:     metric,
+	}
+}
+
+func TestDetect(t *testing.T) {
+	rules := &Rules{
+		PortScanPorts:     10,
+		SynFloodMinFlows:  5,
+		SynFloodRatio:     0.8,
+		ExfiltrationBytes: 1000,
+		ExfiltrationRatio: 10,
+	}
+
+	var flows []*flow.Flow
+	for port := int64(1); port <= 20; port++ {
+		flows = append(flows, newFlow("10.0.0.1", "10.0.0.2", port, &flow.FlowMetric{ABPackets: 1, ABBytes: 60, BAPackets: 1, BABytes: 60}))
+	}
+	for i := 0; i < 10; i++ {
+		flows = append(flows, newFlow(fmt.Sprintf("192.168.0.%d", i), "10.0.0.3", 80, &flow.FlowMetric{ABPackets: 1, ABBytes: 60}))
+	}
+	flows = append(flows, newFlow("10.0.0.4", "8.8.8.8", 443, &flow.FlowMetric{ABPackets: 100, ABBytes: 100000, BAPackets: 50, BABytes: 3000}))
+	flows = append(flows, newFlow("10.0.0.5", "8.8.8.8", 443, &flow.FlowMetric{ABPackets: 100, ABBytes: 100000, BAPackets: 100, BABytes: 50000}))
+
+	detections := rules.Detect(flows)
+	if len(detections) != 3 {
+		t.Fatalf("3 detections expected, got %d: %+v", len(detections), detections)
+	}
+
+	if d := detections[0]; d.Rule != Exfiltration || d.Source != "10.0.0.4" || d.Target != "8.8.8.8" || len(d.Flows) != 1 {
+		t.Errorf("Exfiltration from 10.0.0.4 expected, got %+v", d)
+	}
+
+	if d := detections[1]; d.Rule != PortScan || d.Source != "10.0.0.1" || d.Value != 20 || len(d.Flows) != maxFlows {
+		t.Errorf("Port scan from 10.0.0.1 expected, got %+v", d)
+	}
+
+	if d := detections[2]; d.Rule != SynFlood || d.Target != "10.0.0.3" || d.Value != 1 {
+		t.Errorf("SYN flood to 10.0.0.3 expected, got %+v", d)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package detection
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/alert"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// Server applies the detection rules to the flows received by the analyzer
+// and raises an alert for each detection
+type Server struct {
+	sync.Mutex
+	Pool   ws.StructSpeakerPool
+	rules  *Rules
+	window time.Duration
+	flows  map[string]*flow.Flow
+	quit   chan bool
+	wg     sync.WaitGroup
+}
+
+// OnFlows adds the flows to the current window
+func (s *Server) OnFlows(flows []*flow.Flow) {
+	s.Lock()
+	defer s.Unlock()
+
+	// the same flow is reported by every capture point and at every
+	// update, only its last state is kept. The flows being released to
+	// the pool once handled, a copy is kept.
+	for _, f := range flows {
+		c := *f
+		s.flows[f.TrackingID] = &c
+	}
+}
+
+func (s *Server) rotate() {
+	s.Lock()
+	flows := make([]*flow.Flow, 0, len(s.flows))
+	for _, f := range s.flows {
+		flows = append(flows, f)
+	}
+	s.flows = make(map[string]*flow.Flow)
+	s.Unlock()
+
+	now := time.Now().UTC()
+	for _, d := range s.rules.Detect(flows) {
+		logging.GetLogger().Infof("Detection of %s from '%s' to '%s': %g (threshold %g)", d.Rule, d.Source, d.Target, d.Value, d.Threshold)
+
+		msg := alert.Message{
+			UUID:       fmt.Sprintf("detection/%s/%s/%s", d.Rule, d.Source, d.Target),
+			Timestamp:  now,
+			ReasonData: d,
+		}
+		s.Pool.BroadcastMessage(ws.NewStructMessage(alert.Namespace, "Alert", msg))
+	}
+}
+
+// Start the detection server
+func (s *Server) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.window)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.rotate()
+			case <-s.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the detection server
+func (s *Server) Stop() {
+	s.quit <- true
+	s.wg.Wait()
+}
+
+// NewServer creates a new detection server
+func NewServer(pool ws.StructSpeakerPool) *Server {
+	cfg := config.GetConfig()
+
+	return &Server{
+		Pool: pool,
+		rules: &Rules{
+			PortScanPorts:     cfg.GetInt("analyzer.detection.port_scan.ports"),
+			SynFloodMinFlows:  cfg.GetInt("analyzer.detection.syn_flood.min_flows"),
+			SynFloodRatio:     cfg.GetFloat64("analyzer.detection.syn_flood.ratio"),
+			ExfiltrationBytes: cfg.GetInt64("analyzer.detection.exfiltration.bytes"),
+			ExfiltrationRatio: cfg.GetFloat64("analyzer.detection.exfiltration.ratio"),
+		},
+		window: time.Duration(cfg.GetInt("analyzer.detection.window")) * time.Second,
+		flows:  make(map[string]*flow.Flow),
+		quit:   make(chan bool),
+	}
+}
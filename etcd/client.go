@@ -19,20 +19,25 @@ package etcd
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
+	"net/http"
 	"strconv"
 	"time"
 
 	etcd "github.com/coreos/etcd/client"
 
+	"github.com/skydive-project/skydive/certificate"
 	"github.com/skydive-project/skydive/common"
 )
 
 // Client describes a ETCD configuration client
 type Client struct {
-	service common.Service
-	client  *etcd.Client
-	KeysAPI etcd.KeysAPI
+	service   common.Service
+	client    *etcd.Client
+	transport etcd.CancelableTransport
+	KeysAPI   etcd.KeysAPI
 }
 
 // GetInt64 returns an int64 value from the configuration key
@@ -52,7 +57,7 @@ func (client *Client) SetInt64(key string, value int64) error {
 
 // Stop the client
 func (client *Client) Stop() {
-	if tr, ok := etcd.DefaultTransport.(interface {
+	if tr, ok := client.transport.(interface {
 		CloseIdleConnections()
 	}); ok {
 		tr.CloseIdleConnections()
@@ -64,11 +69,32 @@ func (client *Client) NewElection(name string) common.MasterElection {
 	return NewMasterElector(client, name)
 }
 
+// NewTransport returns the transport used to reach the ETCD servers, using
+// the given TLS configuration if not nil
+func NewTransport(tlsConfig *tls.Config) etcd.CancelableTransport {
+	if tlsConfig == nil {
+		return etcd.DefaultTransport
+	}
+
+	// same settings as the default etcd transport
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		Dial:                dialer.Dial,
+		DialTLS:             certificate.DialTLS(dialer, tlsConfig),
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+}
+
 // NewClient creates a new ETCD client connection to ETCD servers
-func NewClient(service common.Service, etcdServers []string, clientTimeout time.Duration) (*Client, error) {
+func NewClient(service common.Service, etcdServers []string, clientTimeout time.Duration, tlsConfig *tls.Config) (*Client, error) {
+	transport := NewTransport(tlsConfig)
 	cfg := etcd.Config{
 		Endpoints:               etcdServers,
-		Transport:               etcd.DefaultTransport,
+		Transport:               transport,
 		HeaderTimeoutPerRequest: clientTimeout,
 	}
 
@@ -80,8 +106,9 @@ func NewClient(service common.Service, etcdServers []string, clientTimeout time.
 	kapi := etcd.NewKeysAPI(client)
 
 	return &Client{
-		service: service,
-		client:  &client,
-		KeysAPI: kapi,
+		service:   service,
+		client:    &client,
+		transport: transport,
+		KeysAPI:   kapi,
 	}, nil
 }
@@ -0,0 +1,189 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package etcd
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// membersTTL is the time after which a member not refreshing its key is
+// considered as gone
+const membersTTL = 10 * time.Second
+
+// MembersListener is the interface to be implemented by the listeners of the
+// group membership changes
+type MembersListener interface {
+	OnMembersChanged(members []string)
+}
+
+// Members maintains the list of the members of a group. Each member
+// registers itself with a key expiring if not refreshed, the other members
+// watching the keys of the group.
+type Members struct {
+	common.RWMutex
+	EtcdKeyAPI etcd.KeysAPI
+	Host       string
+	path       string
+	members    []string
+	listeners  []MembersListener
+	cancel     context.CancelFunc
+	state      common.ServiceState
+	wg         sync.WaitGroup
+}
+
+func (m *Members) register() error {
+	_, err := m.EtcdKeyAPI.Set(context.Background(), path.Join(m.path, m.Host), m.Host, &etcd.SetOptions{TTL: membersTTL})
+	return err
+}
+
+func (m *Members) refresh(ctx context.Context) {
+	defer m.wg.Done()
+
+	tick := time.NewTicker(membersTTL / 3)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			if err := m.register(); err != nil {
+				logging.GetLogger().Errorf("Failed to refresh the membership of %s in %s: %s", m.Host, m.path, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// update reads the registered members and notifies the listeners if they changed
+func (m *Members) update() error {
+	resp, err := m.EtcdKeyAPI.Get(context.Background(), m.path, &etcd.GetOptions{Recursive: true})
+	if err != nil {
+		return err
+	}
+
+	var members []string
+	for _, node := range resp.Node.Nodes {
+		members = append(members, path.Base(node.Key))
+	}
+	sort.Strings(members)
+
+	m.Lock()
+	changed := !reflect.DeepEqual(m.members, members)
+	m.members = members
+	m.Unlock()
+
+	if changed {
+		logging.GetLogger().Infof("Members of %s: %v", m.path, members)
+		for _, listener := range m.listeners {
+			listener.OnMembersChanged(members)
+		}
+	}
+
+	return nil
+}
+
+func (m *Members) watch(ctx context.Context) {
+	defer m.wg.Done()
+
+	watcher := m.EtcdKeyAPI.Watcher(m.path, &etcd.WatcherOptions{Recursive: true})
+	for {
+		resp, err := watcher.Next(ctx)
+		if err != nil {
+			if err == context.Canceled {
+				return
+			}
+
+			logging.GetLogger().Errorf("Error while watching etcd: %s", err)
+
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		// skip the refreshes of the already registered members
+		if resp.Action == "set" && resp.PrevNode != nil {
+			continue
+		}
+
+		if err := m.update(); err != nil {
+			logging.GetLogger().Errorf("Failed to get the members of %s: %s", m.path, err)
+		}
+	}
+}
+
+// GetMembers returns the sorted list of the members
+func (m *Members) GetMembers() []string {
+	m.RLock()
+	defer m.RUnlock()
+
+	return append([]string{}, m.members...)
+}
+
+// Start registers the member and starts watching the group
+func (m *Members) Start() error {
+	if err := m.register(); err != nil {
+		return err
+	}
+
+	if err := m.update(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+
+	m.wg.Add(2)
+	go m.refresh(ctx)
+	go m.watch(ctx)
+
+	m.state.Store(common.RunningState)
+	return nil
+}
+
+// Stop leaves the group
+func (m *Members) Stop() {
+	if m.state.CompareAndSwap(common.RunningState, common.StoppingState) {
+		m.cancel()
+		m.wg.Wait()
+
+		m.EtcdKeyAPI.Delete(context.Background(), path.Join(m.path, m.Host), &etcd.DeleteOptions{PrevValue: m.Host})
+	}
+}
+
+// AddEventListener registers a new listener
+func (m *Members) AddEventListener(listener MembersListener) {
+	m.listeners = append(m.listeners, listener)
+}
+
+// NewMembers returns the membership of the given group for the service
+func NewMembers(etcdClient *Client, group string) *Members {
+	return &Members{
+		EtcdKeyAPI: etcdClient.KeysAPI,
+		Host:       etcdClient.service.ID,
+		path:       "/members-" + etcdClient.service.Type.String() + "-" + group,
+	}
+}
@@ -19,6 +19,7 @@ package etcd
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log"
@@ -29,6 +30,7 @@ import (
 	"github.com/coreos/etcd/client"
 	"github.com/coreos/etcd/embed"
 	"github.com/coreos/etcd/pkg/osutil"
+	"github.com/coreos/etcd/pkg/transport"
 	"github.com/coreos/etcd/pkg/types"
 
 	"github.com/skydive-project/skydive/common"
@@ -46,8 +48,10 @@ type EmbeddedEtcd struct {
 	etcd   *embed.Etcd
 }
 
-// NewEmbeddedEtcd creates a new embedded ETCD server
-func NewEmbeddedEtcd(name string, listen string, peers map[string]string, dataDir string, maxWalFiles, maxSnapFiles uint, debug bool) (*EmbeddedEtcd, error) {
+// NewEmbeddedEtcd creates a new embedded ETCD server. When tlsInfo is not
+// empty, the clients and the peers are served over TLS and clientTLS is
+// used to check that the server is ready.
+func NewEmbeddedEtcd(name string, listen string, peers map[string]string, dataDir string, maxWalFiles, maxSnapFiles uint, debug bool, tlsInfo transport.TLSInfo, clientTLS *tls.Config) (*EmbeddedEtcd, error) {
 	sa, err := common.ServiceAddressFromString(listen)
 	if err != nil {
 		return nil, err
@@ -61,18 +65,25 @@ func NewEmbeddedEtcd(name string, listen string, peers map[string]string, dataDi
 	cfg.MaxWalFiles = maxWalFiles
 	cfg.MaxSnapFiles = maxSnapFiles
 
+	scheme := "http"
+	if !tlsInfo.Empty() {
+		scheme = "https"
+		cfg.ClientTLSInfo = tlsInfo
+		cfg.PeerTLSInfo = tlsInfo
+	}
+
 	var listenClientURLs types.URLs
 	var listenPeerURLs types.URLs
 	if sa.Addr == "0.0.0.0" || sa.Addr == "::" {
-		if listenClientURLs, err = interfaceURLs(sa.Port); err != nil {
+		if listenClientURLs, err = interfaceURLs(scheme, sa.Port); err != nil {
 			return nil, err
 		}
-		if listenPeerURLs, err = interfaceURLs(sa.Port + 1); err != nil {
+		if listenPeerURLs, err = interfaceURLs(scheme, sa.Port+1); err != nil {
 			return nil, err
 		}
 	} else {
-		listenClientURLs, _ = types.NewURLs([]string{fmt.Sprintf("http://%s:%d", sa.Addr, sa.Port)})
-		listenPeerURLs, _ = types.NewURLs([]string{fmt.Sprintf("http://%s:%d", sa.Addr, sa.Port+1)})
+		listenClientURLs, _ = types.NewURLs([]string{fmt.Sprintf("%s://%s:%d", scheme, sa.Addr, sa.Port)})
+		listenPeerURLs, _ = types.NewURLs([]string{fmt.Sprintf("%s://%s:%d", scheme, sa.Addr, sa.Port+1)})
 	}
 
 	cfg.LCUrls = listenClientURLs
@@ -93,7 +104,7 @@ func NewEmbeddedEtcd(name string, listen string, peers map[string]string, dataDi
 	}
 
 	if advertisePeerUrls == nil {
-		advertisePeerUrls, _ = types.NewURLs([]string{fmt.Sprintf("http://localhost:%d", sa.Port+1)})
+		advertisePeerUrls, _ = types.NewURLs([]string{fmt.Sprintf("%s://localhost:%d", scheme, sa.Port+1)})
 		cfg.InitialCluster = types.URLsMap{name: advertisePeerUrls}.String()
 	}
 
@@ -119,7 +130,7 @@ func NewEmbeddedEtcd(name string, listen string, peers map[string]string, dataDi
 
 	clientConfig := client.Config{
 		Endpoints:               listenClientURLs.StringSlice(),
-		Transport:               client.DefaultTransport,
+		Transport:               NewTransport(clientTLS),
 		HeaderTimeoutPerRequest: time.Second,
 	}
 	etcdClient, err := client.New(clientConfig)
@@ -153,7 +164,7 @@ func (se *EmbeddedEtcd) Stop() error {
 }
 
 // Generate all publishable URLs for a given HTTP port.
-func interfaceURLs(port int) (types.URLs, error) {
+func interfaceURLs(scheme string, port int) (types.URLs, error) {
 	allAddrs, err := net.InterfaceAddrs()
 	if err != nil {
 		return []url.URL{}, err
@@ -172,7 +183,7 @@ func interfaceURLs(port int) (types.URLs, error) {
 		}
 
 		u := url.URL{
-			Scheme: "http",
+			Scheme: scheme,
 			Host:   tcp.String(),
 		}
 		allURLs = append(allURLs, u)
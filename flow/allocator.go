@@ -31,6 +31,7 @@ type TableAllocator struct {
 	expireAfter time.Duration
 	sender      Sender
 	tables      map[*Table]bool
+	throttling  Throttling
 }
 
 // ExpireAfter returns the expiration duration
@@ -56,17 +57,42 @@ func (a *TableAllocator) QueryTable(tq *TableQuery) *TableReply {
 	return reply
 }
 
+// Status returns the status of the allocated tables
+func (a *TableAllocator) Status() []*TableStatus {
+	a.RLock()
+	defer a.RUnlock()
+
+	status := make([]*TableStatus, 0, len(a.tables))
+	for table := range a.tables {
+		status = append(status, table.Status())
+	}
+	return status
+}
+
 // Alloc instantiate/allocate a new table
 func (a *TableAllocator) Alloc(uuids UUIDs, opts TableOpts) *Table {
 	a.Lock()
 	defer a.Unlock()
 
 	t := NewTable(a.updateEvery, a.expireAfter, a.sender, uuids, opts)
+	t.SetThrottling(a.throttling)
 	a.tables[t] = true
 
 	return t
 }
 
+// SetThrottling applies the throttling to the allocated tables and to the
+// ones allocated afterwards
+func (a *TableAllocator) SetThrottling(throttling Throttling) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.throttling = throttling
+	for table := range a.tables {
+		table.SetThrottling(throttling)
+	}
+}
+
 // Release release/destroy a flow table
 func (a *TableAllocator) Release(t *Table) {
 	a.Lock()
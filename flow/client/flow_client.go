@@ -122,6 +122,11 @@ func (c *FlowClientWebSocketConn) Send(data []byte) error {
 	return nil
 }
 
+// IsConnected returns whether the WebSocket connection is established
+func (c *FlowClientWebSocketConn) IsConnected() bool {
+	return c.wsClient != nil && c.wsClient.IsConnected()
+}
+
 // NewFlowClientWebSocketConn returns a new WebSocket flow client
 func NewFlowClientWebSocketConn(url *url.URL, authOpts *shttp.AuthenticationOpts) (*FlowClientWebSocketConn, error) {
 	return &FlowClientWebSocketConn{url: url, authOpts: authOpts}, nil
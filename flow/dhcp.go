@@ -0,0 +1,230 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// dhcpRecord returns the DHCP record of the flow, starting a new one when
+// the packet belongs to another transaction
+func (f *Flow) dhcpRecord(version int64, transactionID string) *DHCP {
+	if f.DHCP == nil || f.DHCP.Version != version || f.DHCP.TransactionID != transactionID {
+		f.DHCP = &DHCP{Version: version, TransactionID: transactionID}
+	}
+	return f.DHCP
+}
+
+func ipString(ip net.IP) string {
+	if ip == nil || ip.IsUnspecified() {
+		return ""
+	}
+	return ip.String()
+}
+
+// packetSource returns the source address of the network layer of the packet
+func packetSource(packet *Packet) net.IP {
+	if networkLayer := packet.NetworkLayer(); networkLayer != nil {
+		return net.IP(networkLayer.NetworkFlow().Src().Raw())
+	}
+	return nil
+}
+
+func (f *Flow) updateDHCPv4(d *layers.DHCPv4, packet *Packet) {
+	r := f.dhcpRecord(4, fmt.Sprintf("0x%08x", d.Xid))
+
+	msgType := layers.DHCPMsgTypeUnspecified
+	for _, o := range d.Options {
+		switch o.Type {
+		case layers.DHCPOptMessageType:
+			if len(o.Data) == 1 {
+				msgType = layers.DHCPMsgType(o.Data[0])
+			}
+		case layers.DHCPOptServerID:
+			if len(o.Data) == net.IPv4len {
+				r.ServerIP = net.IP(o.Data).String()
+			}
+		case layers.DHCPOptLeaseTime:
+			if len(o.Data) == 4 {
+				r.LeaseTime = int64(binary.BigEndian.Uint32(o.Data))
+			}
+		case layers.DHCPOptRequestIP:
+			if len(o.Data) == net.IPv4len {
+				r.RequestedIP = net.IP(o.Data).String()
+			}
+		case layers.DHCPOptHostname:
+			r.Hostname = string(o.Data)
+		}
+	}
+
+	if msgType != layers.DHCPMsgTypeUnspecified {
+		r.MessageType = msgType.String()
+	} else {
+		// plain BOOTP
+		r.MessageType = "Boot" + d.Operation.String()
+	}
+
+	if d.HardwareType == layers.LinkTypeEthernet && len(d.ClientHWAddr) == 6 {
+		r.ClientMAC = d.ClientHWAddr.String()
+	}
+	if ip := ipString(d.ClientIP); ip != "" {
+		r.ClientIP = ip
+	}
+	if ip := ipString(d.YourClientIP); ip != "" {
+		r.OfferedIP = ip
+	}
+	if ip := ipString(d.RelayAgentIP); ip != "" {
+		r.RelayAgentIP = ip
+	}
+	if r.ServerIP == "" && d.Operation == layers.DHCPOpReply {
+		r.ServerIP = ipString(packetSource(packet))
+	}
+}
+
+func dhcpv6MsgType(t layers.DHCPv6MsgType) string {
+	// gopacket misspells it
+	if t == layers.DHCPv6MsgTypeAdverstise {
+		return "Advertise"
+	}
+	return t.String()
+}
+
+// dhcpv6FQDN decodes the domain name of a client FQDN option, RFC 4704
+func dhcpv6FQDN(data []byte) string {
+	if len(data) < 1 {
+		return ""
+	}
+
+	var labels []string
+	for data = data[1:]; len(data) > 0 && int(data[0]) < len(data); data = data[data[0]+1:] {
+		if data[0] == 0 {
+			break
+		}
+		labels = append(labels, string(data[1:data[0]+1]))
+	}
+	return strings.Join(labels, ".")
+}
+
+// updateDHCPv6IANA reads the address and the valid lifetime of an IA_NA
+// option, RFC 8415 section 21.4
+func (r *DHCP) updateDHCPv6IANA(data []byte, fromServer bool) {
+	if len(data) < 12 {
+		return
+	}
+
+	for data = data[12:]; len(data) >= 4; {
+		code := layers.DHCPv6Opt(binary.BigEndian.Uint16(data[0:2]))
+		length := int(binary.BigEndian.Uint16(data[2:4]))
+		if len(data) < 4+length {
+			return
+		}
+
+		if value := data[4 : 4+length]; code == layers.DHCPv6OptIAAddr && length >= 24 {
+			address := net.IP(value[:net.IPv6len]).String()
+			if fromServer {
+				r.OfferedIP = address
+				r.LeaseTime = int64(binary.BigEndian.Uint32(value[20:24]))
+			} else {
+				r.RequestedIP = address
+			}
+		}
+		data = data[4+length:]
+	}
+}
+
+func (f *Flow) updateDHCPv6(d *layers.DHCPv6, packet *Packet) {
+	var relayAgentIP string
+	fromServer := d.MsgType == layers.DHCPv6MsgTypeRelayReply
+
+	// unwrap the message relayed to or from the client
+	for d.MsgType == layers.DHCPv6MsgTypeRelayForward || d.MsgType == layers.DHCPv6MsgTypeRelayReply {
+		if relayAgentIP == "" {
+			relayAgentIP = ipString(d.LinkAddr)
+		}
+
+		var relayed *layers.DHCPv6
+		for _, o := range d.Options {
+			if o.Code == layers.DHCPv6OptRelayMessage {
+				relayed = &layers.DHCPv6{}
+				if err := relayed.DecodeFromBytes(o.Data, gopacket.NilDecodeFeedback); err != nil {
+					return
+				}
+				break
+			}
+		}
+		if relayed == nil {
+			return
+		}
+		d = relayed
+	}
+
+	r := f.dhcpRecord(6, hex.EncodeToString(d.TransactionID))
+	r.MessageType = dhcpv6MsgType(d.MsgType)
+	if relayAgentIP != "" {
+		r.RelayAgentIP = relayAgentIP
+	}
+
+	switch d.MsgType {
+	case layers.DHCPv6MsgTypeAdverstise, layers.DHCPv6MsgTypeReply, layers.DHCPv6MsgTypeReconfigure:
+		fromServer = true
+	}
+	if fromServer {
+		r.ServerIP = ipString(packetSource(packet))
+	}
+
+	for _, o := range d.Options {
+		switch o.Code {
+		case layers.DHCPv6OptClientID:
+			duid := &layers.DHCPv6DUID{}
+			if err := duid.DecodeFromBytes(o.Data); err != nil {
+				continue
+			}
+			if (duid.Type == layers.DHCPv6DUIDTypeLLT || duid.Type == layers.DHCPv6DUIDTypeLL) && len(duid.LinkLayerAddress) == 6 {
+				r.ClientMAC = duid.LinkLayerAddress.String()
+			}
+		case layers.DHCPv6OptIANA:
+			r.updateDHCPv6IANA(o.Data, fromServer)
+		case layers.DHCPv6OptClientFQDN:
+			r.Hostname = dhcpv6FQDN(o.Data)
+		}
+	}
+}
+
+// updateDHCPLayer updates the DHCP record of the flow with the DHCP or
+// DHCPv6 message carried by the packet
+func (f *Flow) updateDHCPLayer(packet *Packet, opts *Opts) {
+	if (opts.ExtraLayers & DHCPv4Layer) != 0 {
+		if layer := packet.Layer(layers.LayerTypeDHCPv4); layer != nil {
+			f.updateDHCPv4(layer.(*layers.DHCPv4), packet)
+			return
+		}
+	}
+
+	if (opts.ExtraLayers & DHCPv6Layer) != 0 {
+		if layer := packet.Layer(layers.LayerTypeDHCPv6); layer != nil {
+			f.updateDHCPv6(layer.(*layers.DHCPv6), packet)
+		}
+	}
+}
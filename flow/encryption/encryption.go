@@ -0,0 +1,242 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"sync"
+
+	etcd "github.com/coreos/etcd/client"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/flow"
+)
+
+const keyPrefix = "/rawpacketkey/"
+
+// magic prefixes the data of the encrypted raw packets, followed by the
+// length of the capture ID, the capture ID, the nonce and the ciphertext
+var magic = []byte("\x00SKYRPE\x01")
+
+// ErrInvalidData is returned when the data of an encrypted raw packet is malformed
+var ErrInvalidData = errors.New("invalid encrypted raw packet")
+
+// IsEncrypted returns whether raw packet data is encrypted
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// Encryptor encrypts the raw packets of the captures flagged for encryption
+// with a data key per capture. The data keys are stored in etcd, wrapped by
+// the key provider, so that all the analyzers share them.
+type Encryptor struct {
+	sync.RWMutex
+	provider KeyProvider
+	kapi     etcd.KeysAPI
+	keys     map[string]cipher.AEAD
+	captures map[string]bool
+}
+
+// IsFlagged returns whether the raw packets of a capture are encrypted
+func (e *Encryptor) IsFlagged(captureID string) bool {
+	e.RLock()
+	defer e.RUnlock()
+	return e.captures[captureID]
+}
+
+// OnCaptureEvent keeps track of the captures flagged for encryption, to be
+// registered as a watcher of the capture API
+func (e *Encryptor) OnCaptureEvent(action string, id string, resource types.Resource) {
+	e.Lock()
+	defer e.Unlock()
+
+	// the flag is never cleared as the flows of the capture may still be
+	// buffered when it is updated or deleted, their packets having to be
+	// encrypted once flushed. The data key is kept as well so that the
+	// stored packets can still be decrypted.
+	switch action {
+	case "init", "create", "set", "update":
+		if resource.(*types.Capture).EncryptRawPackets {
+			e.captures[id] = true
+		}
+	}
+}
+
+func (e *Encryptor) readKey(captureID string) (cipher.AEAD, error) {
+	resp, err := e.kapi.Get(context.Background(), keyPrefix+captureID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(resp.Node.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := e.provider.UnwrapKey(wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	return newGCM(key)
+}
+
+func (e *Encryptor) createKey(captureID string) (cipher.AEAD, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := e.provider.WrapKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	value := base64.StdEncoding.EncodeToString(wrapped)
+	if _, err := e.kapi.Set(context.Background(), keyPrefix+captureID, value, &etcd.SetOptions{PrevExist: etcd.PrevNoExist}); err != nil {
+		// another analyzer created the key first
+		if err, ok := err.(etcd.Error); ok && err.Code == etcd.ErrorCodeNodeExist {
+			return e.readKey(captureID)
+		}
+		return nil, err
+	}
+
+	return newGCM(key)
+}
+
+// key returns the data key of a capture, creating it if requested
+func (e *Encryptor) key(captureID string, create bool) (cipher.AEAD, error) {
+	e.RLock()
+	aead, ok := e.keys[captureID]
+	e.RUnlock()
+	if ok {
+		return aead, nil
+	}
+
+	aead, err := e.readKey(captureID)
+	if etcd.IsKeyNotFound(err) && create {
+		aead, err = e.createKey(captureID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e.Lock()
+	e.keys[captureID] = aead
+	e.Unlock()
+
+	return aead, nil
+}
+
+// Encrypt returns encrypted copies of the raw packets of a capture
+func (e *Encryptor) Encrypt(captureID string, packets []*flow.RawPacket) ([]*flow.RawPacket, error) {
+	if len(captureID) > 255 {
+		return nil, errors.New("capture ID too long")
+	}
+
+	aead, err := e.key(captureID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := make([]*flow.RawPacket, len(packets))
+	for i, packet := range packets {
+		header := make([]byte, 0, len(magic)+1+len(captureID)+aead.NonceSize())
+		header = append(header, magic...)
+		header = append(header, byte(len(captureID)))
+		header = append(header, captureID...)
+
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, err
+		}
+
+		// the header is authenticated so that a packet can't be moved
+		// to another capture
+		data := aead.Seal(append(header, nonce...), nonce, packet.Data, header)
+
+		encrypted[i] = &flow.RawPacket{
+			Timestamp: packet.Timestamp,
+			Index:     packet.Index,
+			Data:      data,
+			LinkType:  packet.LinkType,
+		}
+	}
+
+	return encrypted, nil
+}
+
+func (e *Encryptor) decrypt(data []byte) ([]byte, error) {
+	offset := len(magic) + 1
+	if len(data) < offset {
+		return nil, ErrInvalidData
+	}
+
+	idLen := int(data[len(magic)])
+	if len(data) < offset+idLen {
+		return nil, ErrInvalidData
+	}
+	captureID := string(data[offset : offset+idLen])
+	header := data[:offset+idLen]
+
+	aead, err := e.key(captureID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := data[len(header):]
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrInvalidData
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], header)
+}
+
+// DecryptRawPackets decrypts in place the encrypted raw packets, the other
+// ones are left untouched
+func (e *Encryptor) DecryptRawPackets(packets []*flow.RawPacket) error {
+	for _, packet := range packets {
+		if !IsEncrypted(packet.Data) {
+			continue
+		}
+
+		data, err := e.decrypt(packet.Data)
+		if err != nil {
+			return err
+		}
+		packet.Data = data
+	}
+
+	return nil
+}
+
+// NewEncryptor returns a new raw packet encryptor
+func NewEncryptor(provider KeyProvider, kapi etcd.KeysAPI) *Encryptor {
+	return &Encryptor{
+		provider: provider,
+		kapi:     kapi,
+		keys:     make(map[string]cipher.AEAD),
+		captures: make(map[string]bool),
+	}
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"testing"
+
+	etcd "github.com/coreos/etcd/client"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/flow/storage"
+)
+
+type fakeKeysAPI struct {
+	etcd.KeysAPI
+	values map[string]string
+}
+
+func (k *fakeKeysAPI) Get(ctx context.Context, key string, opts *etcd.GetOptions) (*etcd.Response, error) {
+	value, ok := k.values[key]
+	if !ok {
+		return nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound}
+	}
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: value}}, nil
+}
+
+func (k *fakeKeysAPI) Set(ctx context.Context, key, value string, opts *etcd.SetOptions) (*etcd.Response, error) {
+	if _, ok := k.values[key]; ok && opts != nil && opts.PrevExist == etcd.PrevNoExist {
+		return nil, etcd.Error{Code: etcd.ErrorCodeNodeExist}
+	}
+	k.values[key] = value
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: value}}, nil
+}
+
+type fakeStorage struct {
+	storage.Storage
+	flows []*flow.Flow
+}
+
+func (s *fakeStorage) StoreFlows(flows []*flow.Flow) error {
+	s.flows = flows
+	return nil
+}
+
+func newTestEncryptor(t *testing.T, kapi etcd.KeysAPI) *Encryptor {
+	provider, err := NewLocalKeyProvider(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x42}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewEncryptor(provider, kapi)
+}
+
+func TestEncryptRawPackets(t *testing.T) {
+	kapi := &fakeKeysAPI{values: make(map[string]string)}
+	encryptor := newTestEncryptor(t, kapi)
+	encryptor.OnCaptureEvent("create", "encrypted", &types.Capture{EncryptRawPackets: true})
+
+	clear := []byte{0x01, 0x02, 0x03, 0x04}
+	flows := []*flow.Flow{
+		{UUID: "1", CaptureID: "encrypted", LastRawPackets: []*flow.RawPacket{{Index: 1, Data: clear}}},
+		{UUID: "2", CaptureID: "other", LastRawPackets: []*flow.RawPacket{{Index: 1, Data: clear}}},
+	}
+
+	backend := &fakeStorage{}
+	if err := NewStorage(backend, encryptor).StoreFlows(flows); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := backend.flows[0].LastRawPackets[0]
+	if !IsEncrypted(stored.Data) || bytes.Contains(stored.Data, clear) {
+		t.Errorf("Raw packet of a flagged capture stored in clear: %v", stored.Data)
+	}
+	if !bytes.Equal(flows[0].LastRawPackets[0].Data, clear) {
+		t.Error("The flows sent to the subscribers should not be encrypted")
+	}
+	if !bytes.Equal(backend.flows[1].LastRawPackets[0].Data, clear) {
+		t.Error("Raw packet of a capture not flagged should not be encrypted")
+	}
+
+	if _, ok := kapi.values[keyPrefix+"encrypted"]; !ok {
+		t.Fatal("Data key of the capture not stored")
+	}
+
+	// another analyzer, sharing the key provider and etcd, decrypts the packets
+	other := newTestEncryptor(t, kapi)
+	if err := other.DecryptRawPackets([]*flow.RawPacket{stored}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored.Data, clear) {
+		t.Errorf("Unexpected decrypted data: %v", stored.Data)
+	}
+}
+
+func TestEncryptAfterCaptureDeleted(t *testing.T) {
+	encryptor := newTestEncryptor(t, &fakeKeysAPI{values: make(map[string]string)})
+	encryptor.OnCaptureEvent("create", "encrypted", &types.Capture{EncryptRawPackets: true})
+
+	// the flows still buffered are flushed once the capture is gone
+	encryptor.OnCaptureEvent("delete", "encrypted", &types.Capture{EncryptRawPackets: true})
+	encryptor.OnCaptureEvent("update", "encrypted", &types.Capture{})
+
+	clear := []byte{0x01, 0x02, 0x03, 0x04}
+	backend := &fakeStorage{}
+	flows := []*flow.Flow{{UUID: "1", CaptureID: "encrypted", LastRawPackets: []*flow.RawPacket{{Index: 1, Data: clear}}}}
+	if err := NewStorage(backend, encryptor).StoreFlows(flows); err != nil {
+		t.Fatal(err)
+	}
+
+	if stored := backend.flows[0].LastRawPackets[0]; !IsEncrypted(stored.Data) {
+		t.Errorf("Raw packet of a deleted flagged capture stored in clear: %v", stored.Data)
+	}
+}
+
+func TestTamperedRawPacket(t *testing.T) {
+	encryptor := newTestEncryptor(t, &fakeKeysAPI{values: make(map[string]string)})
+
+	packets, err := encryptor.Encrypt("capture", []*flow.RawPacket{{Data: []byte{0x01, 0x02}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packets[0].Data[len(packets[0].Data)-1] ^= 0xff
+	if err := encryptor.DecryptRawPackets(packets); err == nil {
+		t.Error("A tampered raw packet should not be decrypted")
+	}
+
+	if err := encryptor.DecryptRawPackets([]*flow.RawPacket{{Data: magic}}); err != ErrInvalidData {
+		t.Errorf("Expected an invalid data error, got: %v", err)
+	}
+}
+
+func TestLocalKeyProvider(t *testing.T) {
+	if _, err := NewLocalKeyProvider(base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("A key shorter than 32 bytes should be refused")
+	}
+}
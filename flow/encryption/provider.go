@@ -0,0 +1,206 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/skydive-project/skydive/config"
+)
+
+// KeyProvider wraps the data keys of the captures with a key encryption key
+// that never leaves the provider
+type KeyProvider interface {
+	WrapKey(key []byte) ([]byte, error)
+	UnwrapKey(wrapped []byte) ([]byte, error)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// LocalKeyProvider wraps the data keys with a local AES-256 key
+type LocalKeyProvider struct {
+	aead cipher.AEAD
+}
+
+// WrapKey encrypts a data key
+func (p *LocalKeyProvider) WrapKey(key []byte) ([]byte, error) {
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return p.aead.Seal(nonce, nonce, key, nil), nil
+}
+
+// UnwrapKey decrypts a data key
+func (p *LocalKeyProvider) UnwrapKey(wrapped []byte) ([]byte, error) {
+	size := p.aead.NonceSize()
+	if len(wrapped) < size {
+		return nil, errors.New("wrapped key too short")
+	}
+	return p.aead.Open(nil, wrapped[:size], wrapped[size:], nil)
+}
+
+// NewLocalKeyProvider returns a key provider using a base64 encoded AES-256 key
+func NewLocalKeyProvider(key string) (*LocalKeyProvider, error) {
+	kek, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key encryption key: %s", err)
+	}
+	if len(kek) != 32 {
+		return nil, fmt.Errorf("invalid key encryption key length %d, 32 bytes expected", len(kek))
+	}
+
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalKeyProvider{aead: aead}, nil
+}
+
+// VaultKeyProvider wraps the data keys with the transit secrets engine of
+// HashiCorp Vault
+type VaultKeyProvider struct {
+	client  *http.Client
+	address string
+	mount   string
+	key     string
+	token   string
+}
+
+func (p *VaultKeyProvider) request(operation string, body, reply interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/%s/%s", p.address, p.mount, operation, p.key)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("vault %s failed (%d): %s", operation, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(reply)
+}
+
+// WrapKey encrypts a data key
+func (p *VaultKeyProvider) WrapKey(key []byte) ([]byte, error) {
+	var reply struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+
+	body := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(key)}
+	if err := p.request("encrypt", body, &reply); err != nil {
+		return nil, err
+	}
+
+	return []byte(reply.Data.Ciphertext), nil
+}
+
+// UnwrapKey decrypts a data key
+func (p *VaultKeyProvider) UnwrapKey(wrapped []byte) ([]byte, error) {
+	var reply struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+
+	body := map[string]string{"ciphertext": string(wrapped)}
+	if err := p.request("decrypt", body, &reply); err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.DecodeString(reply.Data.Plaintext)
+}
+
+// NewVaultKeyProvider returns a key provider using the given transit key of a Vault server
+func NewVaultKeyProvider(address, mount, key, token string) (*VaultKeyProvider, error) {
+	if address == "" || key == "" {
+		return nil, errors.New("vault address and key name are required")
+	}
+
+	return &VaultKeyProvider{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		address: strings.TrimSuffix(address, "/"),
+		mount:   mount,
+		key:     key,
+		token:   token,
+	}, nil
+}
+
+// NewKeyProviderFromConfig returns the key provider configured for the
+// analyzer, nil if raw packet encryption is not configured
+func NewKeyProviderFromConfig() (KeyProvider, error) {
+	switch provider := config.GetString("analyzer.flow.encryption.provider"); provider {
+	case "":
+		return nil, nil
+	case "local":
+		key, err := ioutil.ReadFile(config.GetString("analyzer.flow.encryption.local.key_file"))
+		if err != nil {
+			return nil, err
+		}
+		return NewLocalKeyProvider(string(key))
+	case "vault":
+		token := config.GetString("analyzer.flow.encryption.vault.token")
+		if token == "" {
+			token = os.Getenv("VAULT_TOKEN")
+		}
+		return NewVaultKeyProvider(
+			config.GetString("analyzer.flow.encryption.vault.address"),
+			config.GetString("analyzer.flow.encryption.vault.mount"),
+			config.GetString("analyzer.flow.encryption.vault.key"),
+			token,
+		)
+	default:
+		return nil, fmt.Errorf("Raw packet encryption provider '%s' not supported", provider)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package encryption
+
+import (
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/flow/storage"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// Storage encrypts the raw packets of the flagged captures before handing
+// the flows to the underlying storage. The raw packets are returned still
+// encrypted by the searches, the RawPackets step decrypting them for the
+// users allowed to.
+type Storage struct {
+	storage.Storage
+	encryptor *Encryptor
+}
+
+// writer encrypts the raw packets of the flagged captures before handing the
+// flows to a writer of the underlying storage
+type writer struct {
+	storage.Writer
+	encryptor *Encryptor
+}
+
+// StoreFlows stores the flows, the raw packets of the flagged captures being
+// encrypted
+func (w *writer) StoreFlows(flows []*flow.Flow) error {
+	return w.Writer.StoreFlows(encryptFlows(w.encryptor, flows))
+}
+
+// NewWriter returns a writer encrypting the raw packets, on top of a writer of
+// the underlying storage
+func (s *Storage) NewWriter() (storage.Writer, error) {
+	return &writer{Writer: storage.NewWriter(s.Storage), encryptor: s.encryptor}, nil
+}
+
+// StoreFlows stores the flows, the raw packets of the flagged captures being
+// encrypted. The flows themselves are left untouched as they are also sent
+// to the subscribers.
+func (s *Storage) StoreFlows(flows []*flow.Flow) error {
+	return s.Storage.StoreFlows(encryptFlows(s.encryptor, flows))
+}
+
+// DecryptRawPackets decrypts in place the raw packets returned by the
+// searches, for the users allowed to read them in clear
+func (s *Storage) DecryptRawPackets(packets []*flow.RawPacket) error {
+	return s.encryptor.DecryptRawPackets(packets)
+}
+
+// encryptFlows returns the flows with the raw packets of the flagged captures
+// encrypted, the encrypted flows being copies
+func encryptFlows(encryptor *Encryptor, flows []*flow.Flow) []*flow.Flow {
+	stored := flows
+	copied := false
+
+	for i, f := range flows {
+		if len(f.LastRawPackets) == 0 || !encryptor.IsFlagged(f.CaptureID) {
+			continue
+		}
+
+		if !copied {
+			stored = make([]*flow.Flow, len(flows))
+			copy(stored, flows)
+			copied = true
+		}
+
+		clone := *f
+		packets, err := encryptor.Encrypt(f.CaptureID, f.LastRawPackets)
+		if err != nil {
+			// the packets are never stored in clear
+			logging.GetLogger().Errorf("Dropping the raw packets of flow %s, unable to encrypt them: %s", f.UUID, err)
+			packets = nil
+		}
+		clone.LastRawPackets = packets
+		stored[i] = &clone
+	}
+
+	return stored
+}
+
+// NewStorage returns a storage encrypting the raw packets of the flagged captures
+func NewStorage(s storage.Storage, encryptor *Encryptor) *Storage {
+	return &Storage{Storage: s, encryptor: encryptor}
+}
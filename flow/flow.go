@@ -106,6 +106,8 @@ const (
 	DNSLayer ExtraLayers = 2
 	// DHCPv4Layer extra layer
 	DHCPv4Layer ExtraLayers = 4
+	// DHCPv6Layer extra layer
+	DHCPv6Layer ExtraLayers = 8
 	// ALLLayer all extra layers
 	ALLLayer ExtraLayers = 255
 )
@@ -114,6 +116,7 @@ var extraLayersMap = map[string]ExtraLayers{
 	"VRRP":   VRRPLayer,
 	"DNS":    DNSLayer,
 	"DHCPv4": DHCPv4Layer,
+	"DHCPv6": DHCPv6Layer,
 }
 
 // Parse set the ExtraLayers struct with the given list of protocol strings
@@ -591,6 +594,7 @@ func (f *Flow) initFromPacket(key, l2Key, l3Key uint64, packet *Packet, parentUU
 	// no network layer then no transport layer
 	if err := f.newNetworkLayer(packet); err == nil {
 		f.newTransportLayer(packet, opts)
+		f.newICMPOriginalFlow(packet, opts)
 	}
 
 	// add optional application layer
@@ -627,6 +631,7 @@ func (f *Flow) Update(packet *Packet, opts *Opts) {
 	}
 
 	f.updateRTT(packet)
+	f.updateMaxPacketLength(packet)
 
 	// depends on options
 	if f.TCPMetric != nil {
@@ -637,6 +642,9 @@ func (f *Flow) Update(packet *Packet, opts *Opts) {
 			f.updateDNSLayer(layer, packet.GoPacket.Metadata().CaptureInfo.Timestamp)
 		}
 	}
+	if (opts.ExtraLayers & (DHCPv4Layer | DHCPv6Layer)) != 0 {
+		f.updateDHCPLayer(packet, opts)
+	}
 }
 
 func (f *Flow) newLinkLayer(packet *Packet) error {
@@ -909,6 +917,26 @@ func (f *Flow) updateMetricsWithNetworkLayer(packet *Packet, length int64) error
 	return ErrLayerNotFound
 }
 
+// updateMaxPacketLength keeps track of the largest IP packet of the flow,
+// the reassembled packets not having been seen as such on the wire
+func (f *Flow) updateMaxPacketLength(packet *Packet) {
+	if packet.IPMetric != nil && packet.IPMetric.Fragments > 0 {
+		return
+	}
+
+	var length int64
+	ipv4Packet, ipv6Packet := f.getNetworkLayer(packet)
+	if ipv4Packet != nil {
+		length = int64(ipv4Packet.Length)
+	} else if ipv6Packet != nil {
+		length = int64(ipv6Packet.Length) + 40
+	}
+
+	if length > f.MaxPacketLength {
+		f.MaxPacketLength = length
+	}
+}
+
 func (f *Flow) updateTCPMetrics(packet *Packet) error {
 	// capture content of SYN packets
 	// bypass if not TCP
@@ -1261,6 +1289,10 @@ func (f *Flow) GetFieldString(field string) (string, error) {
 		return f.Application, nil
 	case "CaptureID":
 		return f.CaptureID, nil
+	case "DropRule":
+		return f.DropRule, nil
+	case "MemberNodeTID":
+		return f.MemberNodeTID, nil
 	}
 
 	// sub field
@@ -1285,6 +1317,22 @@ func (f *Flow) GetFieldString(field string) (string, error) {
 		if f.Transport != nil {
 			return f.Transport.GetFieldString(fields[1])
 		}
+	case "NAT":
+		if f.NAT != nil {
+			return f.NAT.GetFieldString(fields[1])
+		}
+	case "ProcessA":
+		if f.ProcessA != nil {
+			return f.ProcessA.GetFieldString(fields[1])
+		}
+	case "ProcessB":
+		if f.ProcessB != nil {
+			return f.ProcessB.GetFieldString(fields[1])
+		}
+	case "DHCP":
+		if f.DHCP != nil {
+			return f.DHCP.GetFieldString(fields[1])
+		}
 	}
 
 	// check extra layers
@@ -1299,6 +1347,9 @@ func (f *Flow) GetFieldString(field string) (string, error) {
 
 // GetFieldBool returns the value of a boolean flow field
 func (f *Flow) GetFieldBool(field string) (bool, error) {
+	if fields := strings.Split(field, "."); len(fields) == 2 && fields[0] == "NAT" && f.NAT != nil {
+		return f.NAT.GetFieldBool(fields[1])
+	}
 	return false, common.ErrFieldNotFound
 }
 
@@ -1309,6 +1360,8 @@ func (f *Flow) GetFieldInt64(field string) (_ int64, err error) {
 		return f.Last, nil
 	case "Start":
 		return f.Start, nil
+	case "MaxPacketLength":
+		return f.MaxPacketLength, nil
 	}
 
 	fields := strings.Split(field, ".")
@@ -1349,6 +1402,22 @@ func (f *Flow) GetFieldInt64(field string) (_ int64, err error) {
 		if f.Transport != nil {
 			return f.Transport.GetFieldInt64(fields[1])
 		}
+	case "NAT":
+		if f.NAT != nil {
+			return f.NAT.GetFieldInt64(fields[1])
+		}
+	case "ProcessA":
+		if f.ProcessA != nil {
+			return f.ProcessA.GetFieldInt64(fields[1])
+		}
+	case "ProcessB":
+		if f.ProcessB != nil {
+			return f.ProcessB.GetFieldInt64(fields[1])
+		}
+	case "DHCP":
+		if f.DHCP != nil {
+			return f.DHCP.GetFieldInt64(fields[1])
+		}
 	case "RawPacketsCaptured":
 		return f.RawPacketsCaptured, nil
 	}
@@ -1382,6 +1451,14 @@ func (f *Flow) getFieldInterface(field string) (_ interface{}, err error) {
 		return f.ICMP, nil
 	case "Transport":
 		return f.Transport, nil
+	case "NAT":
+		return f.NAT, nil
+	case "ProcessA":
+		return f.ProcessA, nil
+	case "ProcessB":
+		return f.ProcessB, nil
+	case "DHCP":
+		return f.DHCP, nil
 	}
 
 	// check extra layers
@@ -1404,6 +1481,10 @@ func (f *Flow) GetField(field string) (interface{}, error) {
 		return i, nil
 	}
 
+	if b, err := f.GetFieldBool(field); err == nil {
+		return b, nil
+	}
+
 	return f.GetFieldString(field)
 }
 
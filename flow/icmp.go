@@ -17,7 +17,16 @@
 
 package flow
 
-import "github.com/google/gopacket/layers"
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/pierrec/xxHash/xxHash64"
+)
 
 // ICMPv4TypeToFlowICMPType converts an ICMP type to a Flow ICMPType
 func ICMPv4TypeToFlowICMPType(kind uint8) ICMPType {
@@ -70,3 +79,193 @@ func ICMPv6TypeToFlowICMPType(kind uint8) ICMPType {
 
 	return ICMPType_UNKNOWN
 }
+
+// IsError returns whether the ICMP message reports an error about a packet
+// it quotes, the quoted packet being the one that triggered the error
+func (i *ICMPLayer) IsError() bool {
+	switch i.Type {
+	case ICMPType_DESTINATION_UNREACHABLE, ICMPType_TIME_EXCEEDED, ICMPType_PACKET_TOO_BIG,
+		ICMPType_PARAMETER_PROBLEM, ICMPType_REDIRECT, ICMPType_SOURCE_QUENCH:
+		return true
+	}
+	return false
+}
+
+// quotedPacket holds the flows of the packet quoted by an ICMP error
+type quotedPacket struct {
+	network     gopacket.Flow
+	transport   *gopacket.Flow
+	application *gopacket.Flow
+	original    *ICMPOriginalFlow
+}
+
+// skip the IPv6 extension headers to reach the upper layer protocol
+func skipIPv6Extensions(nextHeader layers.IPProtocol, data []byte) (layers.IPProtocol, []byte) {
+	for {
+		switch nextHeader {
+		case layers.IPProtocolIPv6HopByHop, layers.IPProtocolIPv6Routing, layers.IPProtocolIPv6Destination:
+			if len(data) < 2 || len(data) < (int(data[1])+1)*8 {
+				return layers.IPProtocolNoNextHeader, nil
+			}
+			nextHeader, data = layers.IPProtocol(data[0]), data[(int(data[1])+1)*8:]
+		case layers.IPProtocolIPv6Fragment:
+			if len(data) < 8 {
+				return layers.IPProtocolNoNextHeader, nil
+			}
+			nextHeader, data = layers.IPProtocol(data[0]), data[8:]
+		default:
+			return nextHeader, data
+		}
+	}
+}
+
+// decodeQuotedPacket decodes the headers of the packet quoted by an ICMP
+// error. Only the headers are decoded as routers are only required to quote
+// the first 8 bytes following the IP header.
+func decodeQuotedPacket(data []byte, ipv6 bool) *quotedPacket {
+	var protocol layers.IPProtocol
+	qp := &quotedPacket{original: &ICMPOriginalFlow{}}
+
+	if ipv6 {
+		if len(data) < 40 || data[0]>>4 != 6 {
+			return nil
+		}
+		src, dst := net.IP(data[8:24]), net.IP(data[24:40])
+		qp.network = gopacket.NewFlow(layers.EndpointIPv6, src, dst)
+		qp.original.Network = &FlowLayer{Protocol: FlowProtocol_IPV6, A: src.String(), B: dst.String()}
+		protocol, data = skipIPv6Extensions(layers.IPProtocol(data[6]), data[40:])
+	} else {
+		if len(data) < 20 || data[0]>>4 != 4 {
+			return nil
+		}
+		ihl := int(data[0]&0x0f) * 4
+		if ihl < 20 || len(data) < ihl {
+			return nil
+		}
+		src, dst := net.IP(data[12:16]), net.IP(data[16:20])
+		qp.network = gopacket.NewFlow(layers.EndpointIPv4, src, dst)
+		qp.original.Network = &FlowLayer{Protocol: FlowProtocol_IPV4, A: src.String(), B: dst.String()}
+		protocol, data = layers.IPProtocol(data[9]), data[ihl:]
+	}
+
+	if len(data) < 4 {
+		return qp
+	}
+
+	var endpointType gopacket.EndpointType
+	switch protocol {
+	case layers.IPProtocolTCP:
+		endpointType = layers.EndpointTCPPort
+		qp.original.Transport = &TransportLayer{Protocol: FlowProtocol_TCP}
+	case layers.IPProtocolUDP:
+		endpointType = layers.EndpointUDPPort
+		qp.original.Transport = &TransportLayer{Protocol: FlowProtocol_UDP}
+	case layers.IPProtocolSCTP:
+		endpointType = layers.EndpointSCTPPort
+		qp.original.Transport = &TransportLayer{Protocol: FlowProtocol_SCTP}
+	case layers.IPProtocolICMPv4, layers.IPProtocolICMPv6:
+		// same value as the one given by Packet.ApplicationFlow
+		var value uint32
+		if protocol == layers.IPProtocolICMPv4 {
+			if len(data) < 8 {
+				return qp
+			}
+			t := ICMPv4TypeToFlowICMPType(data[0])
+			value = uint32(t)<<24 | uint32(data[1])<<16 | uint32(binary.BigEndian.Uint16(data[4:6]))
+		} else if data[0] == layers.ICMPv6TypeEchoRequest || data[0] == layers.ICMPv6TypeEchoReply {
+			if len(data) < 8 {
+				return qp
+			}
+			value = uint32(ICMPType_ECHO)<<24 | uint32(binary.BigEndian.Uint16(data[4:6]))
+		} else {
+			value = uint32(ICMPv6TypeToFlowICMPType(data[0]))<<24 | uint32(data[1])<<16
+		}
+
+		value32 := make([]byte, 4)
+		binary.BigEndian.PutUint32(value32, value)
+		af := gopacket.NewFlow(0, value32, nil)
+		qp.application = &af
+		return qp
+	default:
+		return qp
+	}
+
+	tf := gopacket.NewFlow(endpointType, data[0:2], data[2:4])
+	qp.transport = &tf
+	qp.original.Transport.A = int64(binary.BigEndian.Uint16(data[0:2]))
+	qp.original.Transport.B = int64(binary.BigEndian.Uint16(data[2:4]))
+
+	return qp
+}
+
+// l3Key returns the layer 3 key of the quoted packet, computed as Packet.Keys
+// does. The swap is decided by the caller as in L2 mode it depends on the
+// link layer of the original packet.
+func (qp *quotedPacket) l3Key(swap bool) uint64 {
+	hasher := xxHash64.New(0)
+	hashFlow(qp.network, hasher, swap)
+	if qp.transport != nil {
+		hashFlow(*qp.transport, hasher, swap)
+	}
+	if qp.application != nil {
+		src, dst := qp.application.Endpoints()
+		hashFlow(*qp.application, hasher, bytes.Compare(src.Raw(), dst.Raw()) > 0)
+	}
+	return hasher.Sum64()
+}
+
+// networkSwap returns whether the quoted packet goes from B to A
+func (qp *quotedPacket) networkSwap() bool {
+	src, dst := qp.network.Endpoints()
+	cmp := bytes.Compare(src.Raw(), dst.Raw())
+	if cmp == 0 && qp.transport != nil {
+		src, dst := qp.transport.Endpoints()
+		return bytes.Compare(src.Raw(), dst.Raw()) > 0
+	}
+	return cmp > 0
+}
+
+// newICMPOriginalFlow describes the flow the packet quoted by an ICMP error
+// belongs to. Its L3TrackingID is the one the original flow got, so that
+// the error can be correlated with the flow that triggered it.
+func (f *Flow) newICMPOriginalFlow(packet *Packet, opts *Opts) {
+	if f.ICMP == nil || !f.ICMP.IsError() {
+		return
+	}
+
+	var qp *quotedPacket
+	if layer := packet.Layer(layers.LayerTypeICMPv4); layer != nil {
+		icmp := layer.(*layers.ICMPv4)
+		if icmp.TypeCode == layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeFragmentationNeeded) {
+			// RFC 1191, the next hop MTU is stored in the sequence field
+			f.ICMP.MTU = uint32(icmp.Seq)
+		}
+		qp = decodeQuotedPacket(icmp.Payload, false)
+	} else if layer := packet.Layer(layers.LayerTypeICMPv6); layer != nil {
+		// 4 unused bytes, or the MTU for packet too big, precede the quoted packet
+		if payload := layer.(*layers.ICMPv6).Payload; len(payload) > 4 {
+			if f.ICMP.Type == ICMPType_PACKET_TOO_BIG {
+				f.ICMP.MTU = binary.BigEndian.Uint32(payload[:4])
+			}
+			qp = decodeQuotedPacket(payload[4:], true)
+		}
+	}
+	if qp == nil {
+		return
+	}
+
+	swapFromNetwork := true
+	if l2Layer := packet.LinkLayer(); opts.LayerKeyMode == L2KeyMode && l2Layer != nil {
+		// the original packet went the other way round
+		src, dst := l2Layer.LinkFlow().Endpoints()
+		if cmp := bytes.Compare(dst.Raw(), src.Raw()); cmp != 0 {
+			swapFromNetwork = false
+			qp.original.L3TrackingID = strconv.FormatUint(qp.l3Key(cmp > 0), 16)
+		}
+	}
+	if swapFromNetwork {
+		qp.original.L3TrackingID = strconv.FormatUint(qp.l3Key(qp.networkSwap()), 16)
+	}
+
+	f.ICMP.Original = qp.original
+}
@@ -0,0 +1,315 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/flow/client"
+)
+
+// Options describes the flows to generate
+type Options struct {
+	// number of flows being updated concurrently
+	Flows int
+	// ratio of the flow updates sent for an already known flow, the
+	// others creating new flows which replace the oldest ones
+	UpdateRatio float64
+	// number of raw packets sent with each flow update
+	RawPackets int
+	// size of the raw packets
+	PacketSize int
+	// number of flow updates per second, 0 meaning no limit
+	Rate int
+	// number of flow updates per message
+	BulkSize int
+	// duration of the generation, 0 meaning until stopped
+	Duration time.Duration
+	// node and capture the flows are reported for
+	NodeTID   string
+	CaptureID string
+}
+
+// Report describes the load generated
+type Report struct {
+	// number of flow updates sent, creating and updating a flow
+	Sent    int64
+	Created int64
+	Updated int64
+	// number of messages and bytes sent
+	Messages int64
+	Bytes    int64
+	// number of messages which could not be sent and the last error
+	Errors    int64
+	LastError error
+	Elapsed   time.Duration
+}
+
+// Throughput returns the number of flow updates sent per second
+func (r *Report) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Sent) / r.Elapsed.Seconds()
+}
+
+// Generator sends synthesized flows to an analyzer
+type Generator struct {
+	conn   client.FlowClientConn
+	opts   Options
+	rand   *rand.Rand
+	flows  []*flow.Flow
+	oldest int
+	report Report
+}
+
+func (g *Generator) randomMAC() string {
+	mac := make(net.HardwareAddr, 6)
+	g.rand.Read(mac)
+	// locally administered unicast address
+	mac[0] = (mac[0] | 0x02) & 0xfe
+	return mac.String()
+}
+
+func (g *Generator) randomIP() string {
+	return net.IPv4(10, byte(g.rand.Intn(256)), byte(g.rand.Intn(256)), byte(1+g.rand.Intn(254))).String()
+}
+
+func (g *Generator) newFlow(now int64) *flow.Flow {
+	protocol, transport := flow.FlowProtocol_TCP, "TCP"
+	if g.rand.Intn(4) == 0 {
+		protocol, transport = flow.FlowProtocol_UDP, "UDP"
+	}
+
+	return &flow.Flow{
+		UUID:        fmt.Sprintf("%016x", g.rand.Uint64()),
+		TrackingID:  fmt.Sprintf("%016x", g.rand.Uint64()),
+		LayersPath:  "Ethernet/IPv4/" + transport,
+		Application: transport,
+		Link: &flow.FlowLayer{
+			Protocol: flow.FlowProtocol_ETHERNET,
+			A:        g.randomMAC(),
+			B:        g.randomMAC(),
+		},
+		Network: &flow.FlowLayer{
+			Protocol: flow.FlowProtocol_IPV4,
+			A:        g.randomIP(),
+			B:        g.randomIP(),
+		},
+		// ports without application layer decoder, the random payload of
+		// the raw packets being decoded as such otherwise
+		Transport: &flow.TransportLayer{
+			Protocol: protocol,
+			A:        int64(49152 + g.rand.Intn(16384)),
+			B:        int64([]int{22, 80, 3306, 5432, 6379, 8080}[g.rand.Intn(6)]),
+		},
+		Metric:    &flow.FlowMetric{Start: now, Last: now},
+		Start:     now,
+		Last:      now,
+		NodeTID:   g.opts.NodeTID,
+		CaptureID: g.opts.CaptureID,
+	}
+}
+
+// rawPacket returns a packet of the flow, its headers being valid so that
+// it can be decoded once stored
+func (g *Generator) rawPacket(f *flow.Flow, now int64) *flow.RawPacket {
+	srcMAC, _ := net.ParseMAC(f.Link.A)
+	dstMAC, _ := net.ParseMAC(f.Link.B)
+	eth := &layers.Ethernet{SrcMAC: srcMAC, DstMAC: dstMAC, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, TTL: 64, SrcIP: net.ParseIP(f.Network.A), DstIP: net.ParseIP(f.Network.B)}
+
+	var transport gopacket.SerializableLayer
+	if f.Transport.Protocol == flow.FlowProtocol_UDP {
+		ip.Protocol = layers.IPProtocolUDP
+		transport = &layers.UDP{SrcPort: layers.UDPPort(f.Transport.A), DstPort: layers.UDPPort(f.Transport.B)}
+	} else {
+		ip.Protocol = layers.IPProtocolTCP
+		transport = &layers.TCP{SrcPort: layers.TCPPort(f.Transport.A), DstPort: layers.TCPPort(f.Transport.B), ACK: true, Window: 1024}
+	}
+
+	// 54 bytes of Ethernet, IPv4 and TCP headers
+	payload := make([]byte, g.opts.PacketSize-54)
+	g.rand.Read(payload)
+
+	buffer := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	gopacket.SerializeLayers(buffer, opts, eth, ip, transport, gopacket.Payload(payload))
+
+	return &flow.RawPacket{
+		Timestamp: now,
+		Index:     f.RawPacketsCaptured,
+		Data:      buffer.Bytes(),
+		LinkType:  layers.LinkTypeEthernet,
+	}
+}
+
+func (g *Generator) updateFlow(f *flow.Flow, now int64) {
+	packets := int64(1 + g.rand.Intn(10))
+	bytes := packets * int64(g.opts.PacketSize)
+
+	update := &flow.FlowMetric{Start: f.Last, Last: now}
+	if g.rand.Intn(2) == 0 {
+		update.ABPackets, update.ABBytes = packets, bytes
+	} else {
+		update.BAPackets, update.BABytes = packets, bytes
+	}
+
+	f.Metric = &flow.FlowMetric{
+		ABPackets: f.Metric.ABPackets + update.ABPackets,
+		ABBytes:   f.Metric.ABBytes + update.ABBytes,
+		BAPackets: f.Metric.BAPackets + update.BAPackets,
+		BABytes:   f.Metric.BABytes + update.BABytes,
+		Start:     f.Start,
+		Last:      now,
+	}
+	f.LastUpdateMetric = update
+	f.Last = now
+
+	f.LastRawPackets = nil
+	for i := 0; i < g.opts.RawPackets; i++ {
+		f.LastRawPackets = append(f.LastRawPackets, g.rawPacket(f, now))
+		f.RawPacketsCaptured++
+	}
+}
+
+// nextFlow returns the next flow update, for a new flow or for a known one
+// according to the update ratio
+func (g *Generator) nextFlow(now int64) *flow.Flow {
+	var f *flow.Flow
+	switch {
+	case len(g.flows) < g.opts.Flows:
+		f = g.newFlow(now)
+		g.flows = append(g.flows, f)
+		g.report.Created++
+	case g.rand.Float64() >= g.opts.UpdateRatio:
+		f = g.newFlow(now)
+		g.flows[g.oldest] = f
+		g.oldest = (g.oldest + 1) % len(g.flows)
+		g.report.Created++
+	default:
+		f = g.flows[g.rand.Intn(len(g.flows))]
+		g.report.Updated++
+	}
+
+	g.updateFlow(f, now)
+	return f
+}
+
+func (g *Generator) send(flows []*flow.Flow) error {
+	msg := flow.Message{Flows: flows}
+	data, err := msg.Marshal()
+	if err == nil {
+		err = g.conn.Send(data)
+	}
+
+	if err != nil {
+		g.report.Errors++
+		g.report.LastError = err
+		return err
+	}
+
+	g.report.Sent += int64(len(flows))
+	g.report.Messages++
+	g.report.Bytes += int64(len(data))
+	return nil
+}
+
+// Run sends flow updates until the duration is elapsed or the quit channel
+// is closed, and returns the report of the generated load
+func (g *Generator) Run(quit <-chan struct{}) *Report {
+	start := time.Now()
+
+	var deadline <-chan time.Time
+	if g.opts.Duration > 0 {
+		timer := time.NewTimer(g.opts.Duration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	flows := make([]*flow.Flow, 0, g.opts.BulkSize)
+	for {
+		select {
+		case <-quit:
+			return g.report.done(start)
+		case <-deadline:
+			return g.report.done(start)
+		default:
+		}
+
+		// the flow updates are sent at the requested rate on average,
+		// waiting when ahead of it
+		if g.opts.Rate > 0 {
+			expected := int64(time.Since(start).Seconds() * float64(g.opts.Rate))
+			if g.report.Sent+g.report.Errors*int64(g.opts.BulkSize) >= expected {
+				time.Sleep(time.Millisecond)
+				continue
+			}
+		}
+
+		now := common.UnixMillis(time.Now())
+		for i := 0; i < g.opts.BulkSize; i++ {
+			flows = append(flows, g.nextFlow(now))
+		}
+		if err := g.send(flows); err != nil {
+			// back off when the connection can't keep up, the socket
+			// buffers being full
+			time.Sleep(time.Millisecond)
+		}
+		flows = flows[:0]
+	}
+}
+
+func (r Report) done(start time.Time) *Report {
+	r.Elapsed = time.Since(start)
+	return &r
+}
+
+// NewGenerator returns a new generator sending flows through the connection
+func NewGenerator(conn client.FlowClientConn, opts Options) (*Generator, error) {
+	if opts.Flows <= 0 {
+		return nil, errors.New("the number of flows must be strictly positive")
+	}
+	if opts.UpdateRatio < 0 || opts.UpdateRatio > 1 {
+		return nil, errors.New("the update ratio must be between 0 and 1")
+	}
+	if opts.RawPackets < 0 || opts.RawPackets > int(flow.MaxRawPacketLimit) {
+		return nil, fmt.Errorf("the number of raw packets must be between 0 and %d", flow.MaxRawPacketLimit)
+	}
+	if opts.PacketSize < 54 || opts.PacketSize > int(flow.MaxCaptureLength) {
+		return nil, fmt.Errorf("the packet size must be between 54 and %d", flow.MaxCaptureLength)
+	}
+	if opts.BulkSize <= 0 {
+		opts.BulkSize = 1
+	}
+
+	return &Generator{
+		conn: conn,
+		opts: opts,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
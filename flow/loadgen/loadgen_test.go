@@ -0,0 +1,101 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package loadgen
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/skydive-project/skydive/flow"
+)
+
+type fakeConn struct {
+	updates map[string]int
+	packets int
+}
+
+func (c *fakeConn) Connect() error { return nil }
+func (c *fakeConn) Close() error   { return nil }
+
+func (c *fakeConn) Send(data []byte) error {
+	var msg flow.Message
+	if err := msg.Unmarshal(data); err != nil {
+		return err
+	}
+	for _, f := range msg.Flows {
+		c.updates[f.UUID]++
+		for _, r := range f.LastRawPackets {
+			packet := gopacket.NewPacket(r.Data, layers.LayerTypeEthernet, gopacket.Default)
+			if packet.ErrorLayer() != nil || packet.TransportLayer() == nil {
+				return fmt.Errorf("invalid raw packet: %s", packet)
+			}
+			c.packets++
+		}
+	}
+	return nil
+}
+
+func TestGenerator(t *testing.T) {
+	conn := &fakeConn{updates: make(map[string]int)}
+	g, err := NewGenerator(conn, Options{Flows: 10, UpdateRatio: 1, RawPackets: 2, PacketSize: 128, BulkSize: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.rand = rand.New(rand.NewSource(1))
+
+	for i := 0; i < 20; i++ {
+		if err := g.send([]*flow.Flow{g.nextFlow(int64(i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// all the updates after the first ones are for the same flows
+	if len(conn.updates) != 10 || g.report.Created != 10 || g.report.Updated != 10 {
+		t.Fatalf("Expected 10 flows updated twice, got %d flows, report %+v", len(conn.updates), g.report)
+	}
+	if conn.packets != 40 || g.report.Sent != 20 || g.report.Errors != 0 {
+		t.Fatalf("Expected 40 raw packets and 20 flow updates, got %d, report %+v", conn.packets, g.report)
+	}
+
+	conn.updates = make(map[string]int)
+	g.opts.UpdateRatio = 0
+	for i := 0; i < 10; i++ {
+		g.send([]*flow.Flow{g.nextFlow(int64(i))})
+	}
+	if len(conn.updates) != 10 || len(g.flows) != 10 {
+		t.Fatalf("Expected 10 new flows replacing the previous ones, got %d flows", len(conn.updates))
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	conn := &fakeConn{}
+	for _, opts := range []Options{
+		{Flows: 0, PacketSize: 64},
+		{Flows: 10, UpdateRatio: 2, PacketSize: 64},
+		{Flows: 10, RawPackets: 100, PacketSize: 64},
+		{Flows: 10, PacketSize: 10},
+	} {
+		if _, err := NewGenerator(conn, opts); err == nil {
+			t.Errorf("Options %+v should be rejected", opts)
+		}
+	}
+}
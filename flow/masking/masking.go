@@ -0,0 +1,243 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package masking
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// Config describes how the flows are masked
+type Config struct {
+	// Length of the prefix kept from the IPv4 addresses, 32 keeps the address
+	IPv4Prefix int
+	// Length of the prefix kept from the IPv6 addresses, 128 keeps the address
+	IPv6Prefix int
+	// Replace the MAC addresses by a keyed hash
+	HashMAC bool
+	// Key of the MAC hash, a random key is used when empty
+	HashKey string
+	// Drop the payload layers (DNS, DHCP, VRRP) and the raw packets
+	DropPayload bool
+	// Mask the flows of all the captures, not only the flagged ones
+	AllCaptures bool
+}
+
+// Masker anonymizes the flows of the captures flagged for masking before
+// they are stored or sent to the subscribers
+type Masker struct {
+	sync.RWMutex
+	ipv4Mask    net.IPMask
+	ipv6Mask    net.IPMask
+	hashMAC     bool
+	hashKey     []byte
+	dropPayload bool
+	allCaptures bool
+	captures    map[string]bool
+}
+
+// IsMasked returns whether the flows of a capture are masked
+func (m *Masker) IsMasked(captureID string) bool {
+	if m.allCaptures {
+		return true
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+	return m.captures[captureID]
+}
+
+// SetCaptureMasked flags or unflags a capture for masking
+func (m *Masker) SetCaptureMasked(captureID string, masked bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	if masked {
+		m.captures[captureID] = true
+	} else {
+		delete(m.captures, captureID)
+	}
+}
+
+// OnCaptureEvent keeps track of the captures flagged for masking, to be
+// registered as a watcher of the capture API
+func (m *Masker) OnCaptureEvent(action string, id string, resource types.Resource) {
+	switch action {
+	case "init", "create", "set", "update":
+		m.SetCaptureMasked(id, resource.(*types.Capture).Masked)
+	case "expire", "delete":
+		m.SetCaptureMasked(id, false)
+	}
+}
+
+func (m *Masker) maskIP(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return addr
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(m.ipv4Mask).String()
+	}
+	return ip.Mask(m.ipv6Mask).String()
+}
+
+// maskMAC replaces a MAC address by a locally administered unicast address
+// derived from its keyed hash, so that the same address is always replaced
+// the same way without being reversible
+func (m *Masker) maskMAC(addr string) string {
+	mac, err := net.ParseMAC(addr)
+	if err != nil {
+		return addr
+	}
+
+	h := hmac.New(sha256.New, m.hashKey)
+	h.Write(mac)
+	sum := h.Sum(nil)
+
+	sum[0] = (sum[0] | 0x02) &^ 0x01
+	return net.HardwareAddr(sum[:len(mac)]).String()
+}
+
+// MaskFlow masks a flow in place, whether or not its capture is flagged
+func (m *Masker) MaskFlow(f *flow.Flow) {
+	if f.Link != nil && m.hashMAC {
+		f.Link.A = m.maskMAC(f.Link.A)
+		f.Link.B = m.maskMAC(f.Link.B)
+	}
+
+	if f.Network != nil {
+		f.Network.A = m.maskIP(f.Network.A)
+		f.Network.B = m.maskIP(f.Network.B)
+	}
+
+	if f.NAT != nil {
+		f.NAT.OriginalA = m.maskIP(f.NAT.OriginalA)
+		f.NAT.OriginalB = m.maskIP(f.NAT.OriginalB)
+		f.NAT.TranslatedA = m.maskIP(f.NAT.TranslatedA)
+		f.NAT.TranslatedB = m.maskIP(f.NAT.TranslatedB)
+	}
+
+	if f.DHCP != nil {
+		if m.hashMAC {
+			f.DHCP.ClientMAC = m.maskMAC(f.DHCP.ClientMAC)
+		}
+		f.DHCP.ClientIP = m.maskIP(f.DHCP.ClientIP)
+		f.DHCP.RequestedIP = m.maskIP(f.DHCP.RequestedIP)
+		f.DHCP.OfferedIP = m.maskIP(f.DHCP.OfferedIP)
+		f.DHCP.ServerIP = m.maskIP(f.DHCP.ServerIP)
+		f.DHCP.RelayAgentIP = m.maskIP(f.DHCP.RelayAgentIP)
+	}
+
+	if m.dropPayload {
+		f.DNS = nil
+		f.DHCPv4 = nil
+		f.DHCP = nil
+		f.VRRPv2 = nil
+		f.LastRawPackets = nil
+	}
+}
+
+// MaskFlows masks the flows of the captures flagged for masking
+func (m *Masker) MaskFlows(flows []*flow.Flow) {
+	for _, f := range flows {
+		if m.IsMasked(f.CaptureID) {
+			m.MaskFlow(f)
+		}
+	}
+}
+
+type maskingTableClient struct {
+	flow.TableClient
+	masker *Masker
+}
+
+func (c *maskingTableClient) LookupFlows(flowSearchQuery filters.SearchQuery) (*flow.FlowSet, error) {
+	fs, err := c.TableClient.LookupFlows(flowSearchQuery)
+	if fs != nil {
+		c.masker.MaskFlows(fs.Flows)
+	}
+	return fs, err
+}
+
+func (c *maskingTableClient) LookupFlowsByNodes(hnmap topology.HostNodeTIDMap, flowSearchQuery filters.SearchQuery) (*flow.FlowSet, error) {
+	fs, err := c.TableClient.LookupFlowsByNodes(hnmap, flowSearchQuery)
+	if fs != nil {
+		c.masker.MaskFlows(fs.Flows)
+	}
+	return fs, err
+}
+
+// NewTableClient returns a table client masking the flows returned by the
+// agents, so that the live flows are masked like the stored ones
+func NewTableClient(tableClient flow.TableClient, masker *Masker) flow.TableClient {
+	return &maskingTableClient{TableClient: tableClient, masker: masker}
+}
+
+// NewMasker returns a new masker
+func NewMasker(cfg Config) (*Masker, error) {
+	if cfg.IPv4Prefix < 0 || cfg.IPv4Prefix > 32 {
+		return nil, fmt.Errorf("invalid IPv4 prefix length %d", cfg.IPv4Prefix)
+	}
+	if cfg.IPv6Prefix < 0 || cfg.IPv6Prefix > 128 {
+		return nil, fmt.Errorf("invalid IPv6 prefix length %d", cfg.IPv6Prefix)
+	}
+
+	hashKey := []byte(cfg.HashKey)
+	if cfg.HashMAC && len(hashKey) == 0 {
+		logging.GetLogger().Warning("No MAC hash key configured, the masked MAC addresses will differ between analyzers and restarts")
+
+		hashKey = make([]byte, 32)
+		if _, err := rand.Read(hashKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Masker{
+		ipv4Mask:    net.CIDRMask(cfg.IPv4Prefix, 32),
+		ipv6Mask:    net.CIDRMask(cfg.IPv6Prefix, 128),
+		hashMAC:     cfg.HashMAC,
+		hashKey:     hashKey,
+		dropPayload: cfg.DropPayload,
+		allCaptures: cfg.AllCaptures,
+		captures:    make(map[string]bool),
+	}, nil
+}
+
+// NewMaskerFromConfig returns a new masker based on the analyzer configuration
+func NewMaskerFromConfig() (*Masker, error) {
+	return NewMasker(Config{
+		IPv4Prefix:  config.GetInt("analyzer.flow.masking.ipv4_prefix"),
+		IPv6Prefix:  config.GetInt("analyzer.flow.masking.ipv6_prefix"),
+		HashMAC:     config.GetBool("analyzer.flow.masking.hash_mac"),
+		HashKey:     config.GetString("analyzer.flow.masking.hash_key"),
+		DropPayload: config.GetBool("analyzer.flow.masking.drop_payload"),
+		AllCaptures: config.GetBool("analyzer.flow.masking.all_captures"),
+	})
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package masking
+
+import (
+	"net"
+	"testing"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/flow"
+)
+
+func newTestFlow(captureID string) *flow.Flow {
+	return &flow.Flow{
+		CaptureID: captureID,
+		Link:      &flow.FlowLayer{A: "fa:16:3e:29:e0:82", B: "fa:16:3e:96:06:e0"},
+		Network:   &flow.FlowLayer{A: "192.168.0.12", B: "2001:db8:1234:5678::1"},
+		NAT:       &flow.NAT{OriginalA: "10.0.3.4", TranslatedA: "172.16.5.6"},
+		LastRawPackets: []*flow.RawPacket{
+			{Data: []byte{0x01, 0x02}},
+		},
+	}
+}
+
+func TestMaskFlows(t *testing.T) {
+	masker, err := NewMasker(Config{IPv4Prefix: 24, IPv6Prefix: 48, HashMAC: true, HashKey: "secret", DropPayload: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	masker.OnCaptureEvent("create", "masked", &types.Capture{Masked: true})
+	masker.OnCaptureEvent("create", "clear", &types.Capture{})
+
+	masked, clear := newTestFlow("masked"), newTestFlow("clear")
+	masker.MaskFlows([]*flow.Flow{masked, clear})
+
+	if masked.Network.A != "192.168.0.0" || masked.Network.B != "2001:db8:1234::" {
+		t.Errorf("Addresses not truncated: %s, %s", masked.Network.A, masked.Network.B)
+	}
+	if masked.NAT.OriginalA != "10.0.3.0" || masked.NAT.TranslatedA != "172.16.5.0" {
+		t.Errorf("NAT addresses not truncated: %s, %s", masked.NAT.OriginalA, masked.NAT.TranslatedA)
+	}
+	if masked.LastRawPackets != nil {
+		t.Error("Raw packets not dropped")
+	}
+
+	mac, err := net.ParseMAC(masked.Link.A)
+	if err != nil || masked.Link.A == "fa:16:3e:29:e0:82" {
+		t.Errorf("MAC address not hashed: %s", masked.Link.A)
+	} else if mac[0]&0x02 == 0 || mac[0]&0x01 != 0 {
+		t.Errorf("Hashed MAC address should be locally administered unicast: %s", masked.Link.A)
+	}
+
+	// the same address is always hashed the same way
+	other := newTestFlow("masked")
+	masker.MaskFlow(other)
+	if other.Link.A != masked.Link.A {
+		t.Errorf("MAC hash not consistent: %s != %s", other.Link.A, masked.Link.A)
+	}
+
+	if clear.Network.A != "192.168.0.12" || clear.Link.A != "fa:16:3e:29:e0:82" || len(clear.LastRawPackets) != 1 {
+		t.Errorf("Flow of a capture not flagged should not be masked: %+v", clear)
+	}
+
+	masker.OnCaptureEvent("delete", "masked", nil)
+	if masker.IsMasked("masked") {
+		t.Error("Deleted capture should not be masked anymore")
+	}
+}
+
+func TestMaskAllCaptures(t *testing.T) {
+	masker, err := NewMasker(Config{IPv4Prefix: 16, IPv6Prefix: 128, AllCaptures: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := newTestFlow("any")
+	masker.MaskFlows([]*flow.Flow{f})
+
+	if f.Network.A != "192.168.0.0" || f.Network.B != "2001:db8:1234:5678::1" {
+		t.Errorf("Unexpected addresses: %s, %s", f.Network.A, f.Network.B)
+	}
+	if f.Link.A != "fa:16:3e:29:e0:82" || len(f.LastRawPackets) != 1 {
+		t.Errorf("MAC addresses and raw packets should be kept: %+v", f)
+	}
+}
+
+func TestInvalidPrefix(t *testing.T) {
+	if _, err := NewMasker(Config{IPv4Prefix: 33}); err == nil {
+		t.Error("An IPv4 prefix longer than 32 should be refused")
+	}
+	if _, err := NewMasker(Config{IPv6Prefix: -1}); err == nil {
+		t.Error("A negative IPv6 prefix should be refused")
+	}
+}
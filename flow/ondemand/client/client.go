@@ -20,6 +20,8 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/skydive-project/skydive/flow/probes"
 
@@ -36,8 +38,42 @@ import (
 )
 
 type onDemandFlowHandler struct {
+	sync.Mutex
 	graph         *graph.Graph
+	client        *client.OnDemandClient
 	nodeTypeQuery string
+	scheduled     map[string]*time.Timer
+}
+
+// schedule triggers a new registration check when the capture reaches its start time
+func (h *onDemandFlowHandler) schedule(capture *types.Capture, delay time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+
+	if _, found := h.scheduled[capture.UUID]; found {
+		return
+	}
+
+	logging.GetLogger().Debugf("Capture %s scheduled to start in %s", capture.UUID, delay)
+
+	h.scheduled[capture.UUID] = time.AfterFunc(delay, func() {
+		h.Lock()
+		delete(h.scheduled, capture.UUID)
+		h.Unlock()
+
+		h.client.CheckForRegistration()
+	})
+}
+
+// ReleaseResource cancels the start of a deleted capture
+func (h *onDemandFlowHandler) ReleaseResource(resource types.Resource) {
+	h.Lock()
+	defer h.Unlock()
+
+	if timer, found := h.scheduled[resource.ID()]; found {
+		timer.Stop()
+		delete(h.scheduled, resource.ID())
+	}
 }
 
 func (h *onDemandFlowHandler) DecodeMessage(msg json.RawMessage) (types.Resource, error) {
@@ -74,6 +110,13 @@ func (h *onDemandFlowHandler) GetNodeResources(resource types.Resource) []client
 
 	capture := resource.(*types.Capture)
 
+	if capture.StartTime != nil {
+		if delay := time.Until(*capture.StartTime); delay > 0 {
+			h.schedule(capture, delay)
+			return nil
+		}
+	}
+
 	query := capture.GremlinQuery
 	query += fmt.Sprintf(".Dedup().Has('Captures.ID', NEE('%s'))", resource.ID())
 	if capture.Type != "" && !common.CheckProbeCapabilities(capture.Type, common.MultipleOnSameNodeCapability) {
@@ -98,6 +141,23 @@ func (h *onDemandFlowHandler) GetNodeResources(resource types.Resource) []client
 	return nrs
 }
 
+// MatchNode returns whether a node still matches the selector of a capture.
+// Captures defined by a Gremlin query are left untouched as the query may
+// depend on more than the node itself.
+func (h *onDemandFlowHandler) MatchNode(n *graph.Node, resource types.Resource) bool {
+	capture := resource.(*types.Capture)
+	if capture.Selector == "" {
+		return true
+	}
+
+	selector, err := types.ParseLabelSelector(capture.Selector)
+	if err != nil {
+		logging.GetLogger().Errorf("Invalid selector for capture %s: %s", capture.ID(), err)
+		return true
+	}
+	return selector.Match(n)
+}
+
 func (h *onDemandFlowHandler) applyGremlinExpr(query string) []interface{} {
 	res, err := ge.TopologyGremlinQuery(h.graph, query)
 	if err != nil {
@@ -116,5 +176,8 @@ func NewOnDemandFlowProbeClient(g *graph.Graph, ch api.Handler, agentPool ws.Str
 		i++
 	}
 	nodeTypeQuery := new(gremlin.QueryString).Has("Host", gremlin.Ne(""), "Type", gremlin.Within(nodeTypes...)).String()
-	return client.NewOnDemandClient(g, ch, agentPool, subscriberPool, etcdClient, &onDemandFlowHandler{graph: g, nodeTypeQuery: nodeTypeQuery})
+
+	handler := &onDemandFlowHandler{graph: g, nodeTypeQuery: nodeTypeQuery, scheduled: make(map[string]*time.Timer)}
+	handler.client = client.NewOnDemandClient(g, ch, agentPool, subscriberPool, etcdClient, handler)
+	return handler.client
 }
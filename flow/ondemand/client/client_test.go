@@ -0,0 +1,51 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+)
+
+func TestScheduledCapture(t *testing.T) {
+	h := &onDemandFlowHandler{scheduled: make(map[string]*time.Timer)}
+
+	startTime := time.Now().Add(time.Hour)
+	capture := &types.Capture{GremlinQuery: "G.V()", StartTime: &startTime}
+	capture.SetID("capture1")
+
+	if nrs := h.GetNodeResources(capture); len(nrs) != 0 {
+		t.Errorf("a capture starting later should not be registered yet, got %v", nrs)
+	}
+
+	h.GetNodeResources(capture)
+	if len(h.scheduled) != 1 {
+		t.Fatalf("the start of the capture should be scheduled once, got %d timers", len(h.scheduled))
+	}
+	timer := h.scheduled["capture1"]
+
+	h.ReleaseResource(capture)
+	if len(h.scheduled) != 0 {
+		t.Errorf("the start of a deleted capture should be cancelled, got %d timers", len(h.scheduled))
+	}
+	if timer.Stop() {
+		t.Error("the timer of a deleted capture should be stopped")
+	}
+}
@@ -20,11 +20,14 @@ package server
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 
 	"github.com/skydive-project/skydive/api/types"
 	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/flow/probes"
 	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/ondemand"
 	"github.com/skydive-project/skydive/ondemand/server"
 	"github.com/skydive-project/skydive/probe"
@@ -39,14 +42,14 @@ type activeProbe struct {
 	probe   probes.Probe
 }
 
-func (p *activeProbe) OnStarted(metadata *probes.CaptureMetadata) {
-	p.graph.Lock()
+// addCaptureMetadata should be executed under graph lock
+func (p *activeProbe) addCaptureMetadata(metadata *probes.CaptureMetadata, state string) {
 	metadata.ID = p.capture.UUID
 	metadata.Description = p.capture.Description
 	metadata.Name = p.capture.Name
 	metadata.BPFFilter = p.capture.BPFFilter
 	metadata.Type = p.capture.Type
-	metadata.State = "active"
+	metadata.State = state
 	if p.graph.UpdateMetadata(p.n, "Captures", func(obj interface{}) bool {
 		captures := obj.(*probes.Captures)
 		*captures = append(*captures, metadata)
@@ -54,11 +57,10 @@ func (p *activeProbe) OnStarted(metadata *probes.CaptureMetadata) {
 	}) == common.ErrFieldNotFound {
 		p.graph.AddMetadata(p.n, "Captures", &probes.Captures{metadata})
 	}
-	p.graph.Unlock()
 }
 
-func (p *activeProbe) OnStopped() {
-	p.graph.Lock()
+// delCaptureMetadata should be executed under graph lock
+func (p *activeProbe) delCaptureMetadata() {
 	p.graph.UpdateMetadata(p.n, "Captures", func(obj interface{}) bool {
 		captures := obj.(*probes.Captures)
 		for i, capture := range *captures {
@@ -73,6 +75,17 @@ func (p *activeProbe) OnStopped() {
 		}
 		return false
 	})
+}
+
+func (p *activeProbe) OnStarted(metadata *probes.CaptureMetadata) {
+	p.graph.Lock()
+	p.addCaptureMetadata(metadata, "active")
+	p.graph.Unlock()
+}
+
+func (p *activeProbe) OnStopped() {
+	p.graph.Lock()
+	p.delCaptureMetadata()
 	p.graph.Unlock()
 }
 
@@ -93,8 +106,12 @@ func (p *activeProbe) OnError(err error) {
 }
 
 type onDemandFlowProbeServer struct {
-	graph         *graph.Graph
-	probeHandlers *probe.Bundle
+	sync.Mutex
+	graph          *graph.Graph
+	probeHandlers  *probe.Bundle
+	activeCaptures int
+	maxCaptures    int
+	maxRawPackets  int
 }
 
 func (o *onDemandFlowProbeServer) getProbeHandler(n *graph.Node, resource types.Resource) (probes.FlowProbeHandler, error) {
@@ -119,18 +136,47 @@ func (o *onDemandFlowProbeServer) CreateTask(n *graph.Node, resource types.Resou
 		return nil, err
 	}
 
-	active := &activeProbe{graph: o.graph, n: n, capture: resource.(*types.Capture), handler: handler}
-	if active.probe, err = handler.RegisterProbe(n, resource.(*types.Capture), active); err != nil {
+	capture := resource.(*types.Capture)
+	active := &activeProbe{graph: o.graph, n: n, capture: capture, handler: handler}
+
+	o.Lock()
+	defer o.Unlock()
+
+	// no task nor metadata is kept for a refused capture so that the client
+	// retries it, once a running capture is stopped for instance
+	if o.maxCaptures > 0 && o.activeCaptures >= o.maxCaptures {
+		logging.GetLogger().Warningf("Capture %s refused on node %s, limit of %d captures reached", capture.UUID, n.ID, o.maxCaptures)
+		return nil, fmt.Errorf("capture refused, limit of %d captures reached", o.maxCaptures)
+	}
+
+	if o.maxRawPackets > 0 && capture.RawPacketLimit > o.maxRawPackets {
+		logging.GetLogger().Warningf("Capture %s raw packet limit reduced from %d to %d", capture.UUID, capture.RawPacketLimit, o.maxRawPackets)
+
+		limited := *capture
+		limited.RawPacketLimit = o.maxRawPackets
+		capture = &limited
+	}
+
+	if active.probe, err = handler.RegisterProbe(n, capture, active); err != nil {
 		go active.OnError(err)
 		return nil, err
 	}
+	o.activeCaptures++
 
 	return active, nil
 }
 
 func (o *onDemandFlowProbeServer) RemoveTask(n *graph.Node, resource types.Resource, task ondemand.Task) error {
 	activeProbe := task.(*activeProbe)
-	return activeProbe.handler.UnregisterProbe(n, activeProbe, activeProbe.probe)
+	if err := activeProbe.handler.UnregisterProbe(n, activeProbe, activeProbe.probe); err != nil {
+		return err
+	}
+
+	o.Lock()
+	o.activeCaptures--
+	o.Unlock()
+
+	return nil
 }
 
 func (o *onDemandFlowProbeServer) ResourceName() string {
@@ -150,5 +196,7 @@ func NewOnDemandFlowProbeServer(fb *probe.Bundle, g *graph.Graph, pool *ws.Struc
 	return server.NewOnDemandServer(g, pool, &onDemandFlowProbeServer{
 		graph:         g,
 		probeHandlers: fb,
+		maxCaptures:   config.GetConfig().GetInt("agent.capture.max_captures"),
+		maxRawPackets: config.GetConfig().GetInt("agent.capture.max_raw_packets"),
 	})
 }
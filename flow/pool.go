@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/gogo/protobuf/proto"
+)
+
+// ErrInvalidMessage is returned when a flow message can't be decoded
+var ErrInvalidMessage = errors.New("invalid flow message")
+
+var (
+	flowPool    = sync.Pool{New: func() interface{} { return new(Flow) }}
+	messagePool = sync.Pool{New: func() interface{} { return new(Message) }}
+)
+
+// AcquireFlow returns an empty flow from the pool. The flow has to be
+// released once handled.
+func AcquireFlow() *Flow {
+	return flowPool.Get().(*Flow)
+}
+
+// Release resets the flow and puts it back into the pool. Only the flow
+// structure is reused, its layers and metrics being allocated at each
+// decoding, so a shallow copy made before the release remains valid.
+func (f *Flow) Release() {
+	f.Reset()
+	flowPool.Put(f)
+}
+
+// AcquireMessage returns an empty message from the pool
+func AcquireMessage() *Message {
+	return messagePool.Get().(*Message)
+}
+
+// Release puts the message back into the pool. The flows of the message are
+// not released, they belong to the caller once the message is decoded.
+func (m *Message) Release() {
+	for i := range m.Flows {
+		m.Flows[i] = nil
+	}
+	m.Flows = m.Flows[:0]
+	m.Stats = nil
+	messagePool.Put(m)
+}
+
+// DecodeMessage decodes a protobuf encoded message into a message taken from
+// the pool, its flows being taken from the pool as well. The message has to
+// be released once its flows are dispatched, each flow being released once
+// handled.
+func DecodeMessage(data []byte) (*Message, error) {
+	m := AcquireMessage()
+	if err := m.unmarshalPooled(data); err != nil {
+		for _, f := range m.Flows {
+			f.Release()
+		}
+		m.Release()
+		return nil, err
+	}
+	return m, nil
+}
+
+// unmarshalPooled does the same as the generated Unmarshal, but takes the
+// flows from the pool and reuses the flow slice of the message
+func (m *Message) unmarshalPooled(data []byte) error {
+	for i := 0; i < len(data); {
+		key, n := proto.DecodeVarint(data[i:])
+		if n == 0 {
+			return ErrInvalidMessage
+		}
+		fieldNum, wireType := key>>3, key&0x7
+
+		if wireType != 2 || (fieldNum != 1 && fieldNum != 2) {
+			skip, err := skipFlow(data[i:])
+			if err != nil {
+				return err
+			}
+			i += skip
+			continue
+		}
+		i += n
+
+		length, n := proto.DecodeVarint(data[i:])
+		if n == 0 {
+			return ErrInvalidMessage
+		}
+		i += n
+		end := i + int(length)
+		if int(length) < 0 || end > len(data) {
+			return io.ErrUnexpectedEOF
+		}
+
+		switch fieldNum {
+		case 1:
+			f := AcquireFlow()
+			if err := f.Unmarshal(data[i:end]); err != nil {
+				f.Release()
+				return err
+			}
+			m.Flows = append(m.Flows, f)
+		case 2:
+			if m.Stats == nil {
+				m.Stats = &Stats{}
+			}
+			if err := m.Stats.Unmarshal(data[i:end]); err != nil {
+				return err
+			}
+		}
+		i = end
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"testing"
+)
+
+func TestDecodeMessage(t *testing.T) {
+	msg := Message{
+		Flows: []*Flow{
+			{UUID: "aaa", Network: &FlowLayer{Protocol: FlowProtocol_IPV4, A: "192.168.0.1", B: "192.168.0.2"}},
+			{UUID: "bbb", Metric: &FlowMetric{ABPackets: 2, ABBytes: 84}},
+		},
+		Stats: &Stats{CaptureID: "ccc", PacketsReceived: 3},
+	}
+
+	data, err := msg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		decoded, err := DecodeMessage(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(decoded.Flows) != 2 || decoded.Flows[0].UUID != "aaa" || decoded.Flows[1].UUID != "bbb" {
+			t.Fatalf("Wrong flows decoded: %+v", decoded.Flows)
+		}
+		if decoded.Flows[0].Network.B != "192.168.0.2" || decoded.Flows[1].Metric.ABBytes != 84 {
+			t.Fatalf("Wrong flow layers decoded: %+v", decoded.Flows)
+		}
+		if decoded.Flows[1].Network != nil {
+			t.Fatalf("Layer of a released flow reused: %+v", decoded.Flows[1].Network)
+		}
+		if decoded.Stats == nil || decoded.Stats.CaptureID != "ccc" || decoded.Stats.PacketsReceived != 3 {
+			t.Fatalf("Wrong stats decoded: %+v", decoded.Stats)
+		}
+
+		for _, f := range decoded.Flows {
+			f.Release()
+		}
+		decoded.Release()
+	}
+
+	if _, err := DecodeMessage(data[:len(data)-3]); err == nil {
+		t.Fatal("Truncated message should not be decoded")
+	}
+}
@@ -283,7 +283,10 @@ func (p *ProbesHandler) RegisterProbe(n *graph.Node, capture *types.Capture, e p
 	}
 
 	uuids := flow.UUIDs{NodeTID: tid, CaptureID: capture.UUID}
-	ft := p.Ctx.FTA.Alloc(uuids, flow.TableOpts{})
+	ft := p.Ctx.FTA.Alloc(uuids, flow.TableOpts{
+		UpdateEvery: time.Duration(capture.UpdateInterval) * time.Second,
+		ExpireAfter: time.Duration(capture.ExpireTimeout) * time.Second,
+	})
 
 	probe := &Probe{
 		Ctx:          p.Ctx,
@@ -294,7 +297,7 @@ func (p *ProbesHandler) RegisterProbe(n *graph.Node, capture *types.Capture, e p
 		fmap:         []*ebpf.Map{fmap1, fmap2},
 		cmap:         cmap,
 		flowPage:     1,
-		expire:       p.Ctx.FTA.ExpireAfter(),
+		expire:       ft.ExpireAfter(),
 		quit:         make(chan bool),
 	}
 
@@ -23,6 +23,7 @@ package probes
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/skydive-project/skydive/api/types"
 	"github.com/skydive-project/skydive/common"
@@ -75,6 +76,9 @@ func TableOptsFromCapture(capture *types.Capture) flow.TableOpts {
 		ReassembleTCP:  capture.ReassembleTCP,
 		LayerKeyMode:   layerKeyMode,
 		ExtraLayers:    capture.ExtraLayers,
+		MaxPacketRate:  int64(config.GetConfig().GetInt("agent.capture.max_packets_per_second")),
+		UpdateEvery:    time.Duration(capture.UpdateInterval) * time.Second,
+		ExpireAfter:    time.Duration(capture.ExpireTimeout) * time.Second,
 	}
 }
 
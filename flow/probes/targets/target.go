@@ -19,9 +19,11 @@ package targets
 
 import (
 	"errors"
+	"time"
 
 	"github.com/google/gopacket"
 	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/flow"
 	"github.com/skydive-project/skydive/graffiti/graph"
 )
@@ -49,6 +51,9 @@ func tableOptsFromCapture(capture *types.Capture) flow.TableOpts {
 		ReassembleTCP:  capture.ReassembleTCP,
 		LayerKeyMode:   layerKeyMode,
 		ExtraLayers:    capture.ExtraLayers,
+		MaxPacketRate:  int64(config.GetConfig().GetInt("agent.capture.max_packets_per_second")),
+		UpdateEvery:    time.Duration(capture.UpdateInterval) * time.Second,
+		ExpireAfter:    time.Duration(capture.ExpireTimeout) * time.Second,
 	}
 }
 
@@ -0,0 +1,81 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"time"
+)
+
+// bulkTuner adapts the size and the deadline of the bulk inserts of a shard,
+// AIMD style. While the inserts complete within the target latency, the size
+// grows by a step as long as flows are queued and the deadline shrinks by a
+// step, so that the flows are stored sooner. As soon as an insert exceeds the
+// target latency, the size is halved and the deadline doubled.
+type bulkTuner struct {
+	size          int
+	minSize       int
+	maxSize       int
+	deadline      time.Duration
+	minDeadline   time.Duration
+	maxDeadline   time.Duration
+	targetLatency time.Duration
+}
+
+// adjust updates the size and the deadline after an insert that took
+// latency, queued flows waiting to be handled. onDeadline tells whether the
+// insert was triggered by the deadline rather than by a full bulk.
+func (t *bulkTuner) adjust(latency time.Duration, queued int, onDeadline bool) {
+	if latency > t.targetLatency {
+		t.size = max(t.minSize, t.size/2)
+		if t.deadline *= 2; t.deadline > t.maxDeadline {
+			t.deadline = t.maxDeadline
+		}
+		return
+	}
+
+	if !onDeadline && queued >= t.size {
+		if t.size += t.minSize; t.size > t.maxSize {
+			t.size = t.maxSize
+		}
+	}
+
+	if onDeadline && latency < t.targetLatency/2 {
+		if t.deadline -= t.minDeadline; t.deadline < t.minDeadline {
+			t.deadline = t.minDeadline
+		}
+	}
+}
+
+// newBulkTuner returns a tuner starting from the given size and deadline.
+// Without adaptation, the bounds are the starting values so that they are
+// never changed.
+func newBulkTuner(size int, deadline time.Duration, adaptive bool, minSize, maxSize int, minDeadline, targetLatency time.Duration) *bulkTuner {
+	if !adaptive {
+		minSize, maxSize, minDeadline = size, size, deadline
+	}
+
+	return &bulkTuner{
+		size:          size,
+		minSize:       minSize,
+		maxSize:       maxSize,
+		deadline:      deadline,
+		minDeadline:   minDeadline,
+		maxDeadline:   deadline,
+		targetLatency: targetLatency,
+	}
+}
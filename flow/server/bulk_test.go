@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBulkTuner(t *testing.T) {
+	tuner := newBulkTuner(100, 5*time.Second, true, 10, 150, time.Second, 500*time.Millisecond)
+
+	// the storage keeps up and flows are queued, the size grows up to its bound
+	for i := 0; i < 10; i++ {
+		tuner.adjust(100*time.Millisecond, 1000, false)
+	}
+	if tuner.size != 150 {
+		t.Errorf("Expected the size to grow up to 150, got %d", tuner.size)
+	}
+
+	// no backlog, the size doesn't change but the deadline shrinks
+	tuner.adjust(100*time.Millisecond, 0, true)
+	tuner.adjust(100*time.Millisecond, 0, true)
+	if tuner.size != 150 || tuner.deadline != 3*time.Second {
+		t.Errorf("Expected a size of 150 and a deadline of 3s, got %d and %s", tuner.size, tuner.deadline)
+	}
+
+	// the storage slows down
+	tuner.adjust(time.Second, 1000, false)
+	if tuner.size != 75 || tuner.deadline != 5*time.Second {
+		t.Errorf("Expected a size of 75 and a deadline of 5s, got %d and %s", tuner.size, tuner.deadline)
+	}
+
+	for i := 0; i < 10; i++ {
+		tuner.adjust(time.Second, 1000, false)
+	}
+	if tuner.size != 10 {
+		t.Errorf("Expected the size to drop down to 10, got %d", tuner.size)
+	}
+}
+
+func TestFixedBulkTuner(t *testing.T) {
+	tuner := newBulkTuner(100, 5*time.Second, false, 10, 1000, time.Second, 500*time.Millisecond)
+
+	tuner.adjust(100*time.Millisecond, 1000, false)
+	tuner.adjust(100*time.Millisecond, 0, true)
+	tuner.adjust(time.Second, 1000, false)
+	if tuner.size != 100 || tuner.deadline != 5*time.Second {
+		t.Errorf("Expected a size of 100 and a deadline of 5s, got %d and %s", tuner.size, tuner.deadline)
+	}
+}
@@ -18,22 +18,29 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"net"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/skydive-project/skydive/api/types"
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/flow/masking"
 	"github.com/skydive-project/skydive/flow/storage"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	shttp "github.com/skydive-project/skydive/http"
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/probe"
+	"github.com/skydive-project/skydive/tracing"
 	ws "github.com/skydive-project/skydive/websocket"
 )
 
@@ -58,10 +65,29 @@ func max(a, b int) int {
 // FlowServerConn describes a flow server connection
 type FlowServerConn interface {
 	Serve(flowChan chan *flow.Flow, statsChan chan *flow.Stats, quit chan struct{}, wg *sync.WaitGroup)
+	Counters() (received int64, dropped int64)
+}
+
+// flowCounters counts the flows received by a connection and the ones
+// dropped as the flow buffer was full
+type flowCounters struct {
+	received int64
+	dropped  int64
+}
+
+// Counters returns the number of flows received and dropped
+func (c *flowCounters) Counters() (int64, int64) {
+	return atomic.LoadInt64(&c.received), atomic.LoadInt64(&c.dropped)
+}
+
+func (c *flowCounters) count(received, dropped int) {
+	atomic.AddInt64(&c.received, int64(received))
+	atomic.AddInt64(&c.dropped, int64(dropped))
 }
 
 // FlowServerUDPConn describes a UDP flow server connection
 type FlowServerUDPConn struct {
+	flowCounters
 	conn                   *net.UDPConn
 	timeOfLastLostFlowsLog time.Time
 	numOfLostFlows         int
@@ -71,6 +97,7 @@ type FlowServerUDPConn struct {
 // FlowServerWebSocketConn describes a WebSocket flow server connection
 type FlowServerWebSocketConn struct {
 	ws.DefaultSpeakerEventHandler
+	flowCounters
 	server                 *shttp.Server
 	flowChan               chan *flow.Flow
 	statsChan              chan *flow.Stats
@@ -80,19 +107,43 @@ type FlowServerWebSocketConn struct {
 	auth                   shttp.AuthenticationBackend
 }
 
+// FlowServerListener is notified of the flows received by the flow server.
+// The flows are released to a pool once the listeners are notified, so a
+// listener keeping a flow has to keep a copy of it.
+type FlowServerListener interface {
+	OnFlows(flows []*flow.Flow)
+}
+
 // FlowServer describes a flow server
 type FlowServer struct {
 	storage            storage.Storage
 	conn               FlowServerConn
 	state              common.ServiceState
 	wgServer           sync.WaitGroup
-	bulkInsert         int
-	bulkInsertDeadline time.Duration
+	bulk               *bulkTuner
 	flowChan           chan *flow.Flow
 	statsChan          chan *flow.Stats
 	quit               chan struct{}
 	auth               shttp.AuthenticationBackend
 	subscriberEndpoint *FlowSubscriberEndpoint
+	listeners          []FlowServerListener
+	masker             *masking.Masker
+	shardCount         int
+	shards             []*flowShard
+	wgShards           sync.WaitGroup
+	handoff            bool
+	pendingLock        sync.Mutex
+	pending            []*flow.Flow
+	handled            int64
+}
+
+// flowShard batches the flows of a subset of the flow keys, the updates of a
+// flow being always handled by the same shard, in order. Each shard stores
+// its flows with a writer of its own.
+type flowShard struct {
+	server   *FlowServer
+	flowChan chan *flow.Flow
+	writer   storage.Writer
 }
 
 // OnMessage event
@@ -100,8 +151,8 @@ func (c *FlowServerWebSocketConn) OnMessage(client ws.Speaker, m ws.Message) {
 	// rawmessage at this point
 	b, _ := m.Bytes(ws.RawProtocol)
 
-	var msg flow.Message
-	if err := msg.Unmarshal(b); err != nil {
+	msg, err := flow.DecodeMessage(b)
+	if err != nil {
 		logging.GetLogger().Errorf("Error while parsing flow: %s", err)
 		return
 	}
@@ -109,24 +160,29 @@ func (c *FlowServerWebSocketConn) OnMessage(client ws.Speaker, m ws.Message) {
 	logging.GetLogger().Debugf("New flow message from Websocket connection: %+v", msg)
 
 	// TODO(safchain) handle multiple type of message
-	for _, f := range msg.Flows {
+	dropped := 0
+	for i, f := range msg.Flows {
 		if len(c.flowChan) >= c.maxFlowBufferSize {
-			c.numOfLostFlows++
+			dropped = len(msg.Flows) - i
+			c.numOfLostFlows += dropped
 			if c.timeOfLastLostFlowsLog.IsZero() ||
 				(time.Now().Sub(c.timeOfLastLostFlowsLog) >= time.Second) {
 				logging.GetLogger().Errorf("Buffer overflow - too many flow updates, removing and not storing flows: %d", c.numOfLostFlows)
 				c.timeOfLastLostFlowsLog = time.Now()
 				c.numOfLostFlows = 0
 			}
-			return
+			releaseFlows(msg.Flows[i:])
+			break
 		}
 
 		c.flowChan <- f
 	}
+	c.count(len(msg.Flows), dropped)
 
 	if msg.Stats != nil {
 		c.statsChan <- msg.Stats
 	}
+	msg.Release()
 }
 
 // Serve starts a WebSocket flow server
@@ -171,31 +227,38 @@ func (c *FlowServerUDPConn) Serve(flowChan chan *flow.Flow, statsChan chan *flow
 					logging.GetLogger().Errorf("Error while reading: %s", err)
 				}
 
-				var msg flow.Message
-				if err := msg.Unmarshal(data[0:n]); err != nil {
+				// the flows are decoded into pooled objects, released by
+				// the shards once handled, the read buffer being reused
+				msg, err := flow.DecodeMessage(data[0:n])
+				if err != nil {
 					logging.GetLogger().Errorf("Error while parsing flow: %s", err)
 					continue
 				}
 
 				logging.GetLogger().Debugf("New flow message from UDP connection: %+v", msg)
 
-				for _, f := range msg.Flows {
+				dropped := 0
+				for i, f := range msg.Flows {
 					if len(flowChan) >= c.maxFlowBufferSize {
-						c.numOfLostFlows++
+						dropped = len(msg.Flows) - i
+						c.numOfLostFlows += dropped
 						if c.timeOfLastLostFlowsLog.IsZero() ||
 							(time.Now().Sub(c.timeOfLastLostFlowsLog) >= time.Second) {
 							logging.GetLogger().Errorf("Buffer overflow - too many flow updates, removing and not storing flows: %d", c.numOfLostFlows)
 							c.timeOfLastLostFlowsLog = time.Now()
 							c.numOfLostFlows = 0
 						}
-						return
+						releaseFlows(msg.Flows[i:])
+						break
 					}
 					flowChan <- f
 				}
+				c.count(len(msg.Flows), dropped)
 
 				if msg.Stats != nil {
 					statsChan <- msg.Stats
 				}
+				msg.Release()
 			}
 		}
 	}()
@@ -219,52 +282,190 @@ func NewFlowServerUDPConn(addr string, port int) (*FlowServerUDPConn, error) {
 	return &FlowServerUDPConn{conn: conn, maxFlowBufferSize: flowsMax}, err
 }
 
-func (s *FlowServer) handleFlows(flows []*flow.Flow) {
+// handleFlows stores the flows with the writer and notifies the subscribers
+// and the listeners. It returns the time spent storing the flows.
+func (s *FlowServer) handleFlows(writer storage.Writer, flows []*flow.Flow) (latency time.Duration) {
 	if len(flows) > 0 {
-		if s.storage != nil {
-			if err := s.storage.StoreFlows(flows); err != nil {
+		ctx, span := tracing.Start(context.Background(), "flow.ingest", tracing.Int("flows", len(flows)))
+		defer span.End()
+
+		if s.masker != nil {
+			s.masker.MaskFlows(flows)
+		}
+
+		if writer != nil {
+			_, storeSpan := tracing.Start(ctx, "storage.StoreFlows")
+			start := time.Now()
+			err := writer.StoreFlows(flows)
+			if err != nil {
 				logging.GetLogger().Error(err)
 			} else {
 				logging.GetLogger().Debugf("%d flows stored", len(flows))
 			}
+			latency = time.Since(start)
+			tracing.End(storeSpan, err)
 		}
 
+		_, dispatchSpan := tracing.Start(ctx, "flow.dispatch")
 		s.subscriberEndpoint.SendFlows(flows)
+
+		for _, l := range s.listeners {
+			l.OnFlows(flows)
+		}
+		dispatchSpan.End()
+
+		atomic.AddInt64(&s.handled, int64(len(flows)))
 	}
+	return
+}
+
+// GetStatus returns the number of flows received, dropped and handled
+func (s *FlowServer) GetStatus() *types.FlowServerStatus {
+	received, dropped := s.conn.Counters()
+	return &types.FlowServerStatus{
+		Received: received,
+		Dropped:  dropped,
+		Handled:  atomic.LoadInt64(&s.handled),
+	}
+}
+
+// AddListener registers a listener notified of the received flows. Listeners
+// must be registered before the server is started.
+func (s *FlowServer) AddListener(l FlowServerListener) {
+	s.listeners = append(s.listeners, l)
+}
+
+// SetMasker sets the masker applied to the received flows before they are
+// stored or sent to the subscribers and the listeners
+func (s *FlowServer) SetMasker(m *masking.Masker) {
+	s.masker = m
 }
 
 func (s *FlowServer) handleStats(stats *flow.Stats) {
 	s.subscriberEndpoint.SendStats(stats)
 }
 
+// run batches the flows of the shard until its channel is closed, the size
+// and the deadline of the batches being adapted to the storage latency
+func (sh *flowShard) run() {
+	defer sh.server.wgShards.Done()
+
+	tuner := *sh.server.bulk
+	dlTimer := time.NewTicker(tuner.deadline)
+	defer func() { dlTimer.Stop() }()
+
+	var flows []*flow.Flow
+
+	insert := func(onDeadline bool) {
+		if len(flows) > 0 {
+			latency := sh.server.handleFlows(sh.writer, flows)
+
+			deadline := tuner.deadline
+			tuner.adjust(latency, len(sh.flowChan), onDeadline)
+			if tuner.deadline != deadline {
+				logging.GetLogger().Debugf("Flow bulk insert deadline set to %s, size %d", tuner.deadline, tuner.size)
+				dlTimer.Stop()
+				dlTimer = time.NewTicker(tuner.deadline)
+			}
+		}
+		flows = releaseFlows(flows)
+	}
+
+	for {
+		select {
+		case f, ok := <-sh.flowChan:
+			if !ok {
+				sh.flush(flows)
+				return
+			}
+
+			flows = append(flows, f)
+			if len(flows) >= tuner.size {
+				insert(false)
+			}
+		case <-dlTimer.C:
+			insert(true)
+		}
+	}
+}
+
+// flush handles the flows left when stopping, or keeps them to be handed off
+// to the next instance, and closes the writer of the shard
+func (sh *flowShard) flush(flows []*flow.Flow) {
+	s := sh.server
+	if s.handoff {
+		s.pendingLock.Lock()
+		s.pending = append(s.pending, flows...)
+		s.pendingLock.Unlock()
+	} else {
+		s.handleFlows(sh.writer, flows)
+		releaseFlows(flows)
+	}
+
+	if sh.writer != nil {
+		if err := sh.writer.Close(); err != nil {
+			logging.GetLogger().Errorf("Error while closing the flow writer: %s", err)
+		}
+	}
+}
+
+// newWriter returns a writer of the storage, nil if there is no storage
+func (s *FlowServer) newWriter() storage.Writer {
+	if s.storage == nil {
+		return nil
+	}
+	return storage.NewWriter(s.storage)
+}
+
+// releaseFlows puts the handled flows back into the pool and returns the
+// emptied slice to be reused
+func releaseFlows(flows []*flow.Flow) []*flow.Flow {
+	for i, f := range flows {
+		f.Release()
+		flows[i] = nil
+	}
+	return flows[:0]
+}
+
+func (s *FlowServer) dispatch(f *flow.Flow) {
+	h := fnv.New32a()
+	h.Write([]byte(f.UUID))
+	s.shards[h.Sum32()%uint32(len(s.shards))].flowChan <- f
+}
+
 // Start the flow server
 func (s *FlowServer) Start() {
 	s.state.Store(common.RunningState)
 	s.wgServer.Add(1)
 
+	// the channels of the shards are closed when stopping
+	s.shards = make([]*flowShard, s.shardCount)
+	for i := range s.shards {
+		s.shards[i] = &flowShard{server: s, flowChan: make(chan *flow.Flow, s.bulk.maxSize*2), writer: s.newWriter()}
+
+		s.wgShards.Add(1)
+		go s.shards[i].run()
+	}
+
 	s.conn.Serve(s.flowChan, s.statsChan, s.quit, &s.wgServer)
 	go func() {
 		defer s.wgServer.Done()
 
-		dlTimer := time.NewTicker(s.bulkInsertDeadline)
-		defer dlTimer.Stop()
-
-		var flows []*flow.Flow
-		defer s.handleFlows(flows)
-
 		for {
 			select {
 			case <-s.quit:
+				// the flows still queued are dispatched so that the shards
+				// handle them or hand them off before stopping
+				for len(s.flowChan) > 0 {
+					s.dispatch(<-s.flowChan)
+				}
+				for _, shard := range s.shards {
+					close(shard.flowChan)
+				}
+				s.wgShards.Wait()
 				return
-			case <-dlTimer.C:
-				s.handleFlows(flows)
-				flows = flows[:0]
 			case f := <-s.flowChan:
-				flows = append(flows, f)
-				if len(flows) >= s.bulkInsert {
-					s.handleFlows(flows)
-					flows = flows[:0]
-				}
+				s.dispatch(f)
 			case stats := <-s.statsChan:
 				s.handleStats(stats)
 			}
@@ -281,9 +482,29 @@ func (s *FlowServer) Stop() {
 	}
 }
 
+// Drain stops the server and returns the flows received but not yet
+// handled, so that they can be handed off to the next instance
+func (s *FlowServer) Drain() []*flow.Flow {
+	s.handoff = true
+	s.Stop()
+	return s.pending
+}
+
+// Inject handles flows as if they were received, the flows drained from a
+// previous instance for instance
+func (s *FlowServer) Inject(flows []*flow.Flow) {
+	writer := s.newWriter()
+	s.handleFlows(writer, flows)
+
+	if writer != nil {
+		if err := writer.Close(); err != nil {
+			logging.GetLogger().Errorf("Error while closing the flow writer: %s", err)
+		}
+	}
+}
+
 func (s *FlowServer) setupBulkConfigFromBackend() error {
-	s.bulkInsert = FlowBulkInsertDefault
-	s.bulkInsertDeadline = time.Duration(FlowBulkInsertDeadlineDefault) * time.Second
+	bulkInsertDeadline := time.Duration(FlowBulkInsertDeadlineDefault) * time.Second
 
 	storage := fmt.Sprintf("storage.%s.", config.GetString("analyzer.flow.backend"))
 	if config.IsSet(storage + "driver") {
@@ -294,14 +515,34 @@ func (s *FlowServer) setupBulkConfigFromBackend() error {
 		if bulkMaxDelay == 0 {
 			bulkMaxDelay = FlowBulkMaxDelayDefault
 		}
-		s.bulkInsertDeadline = time.Duration(bulkMaxDelay) * time.Second
+		bulkInsertDeadline = time.Duration(bulkMaxDelay) * time.Second
+	}
+
+	minSize := config.GetInt("analyzer.flow.bulk_insert.min_size")
+	maxSize := config.GetInt("analyzer.flow.bulk_insert.max_size")
+	if minSize > FlowBulkInsertDefault || maxSize < FlowBulkInsertDefault {
+		return fmt.Errorf("analyzer.flow.bulk_insert.min_size and max_size must surround %d", FlowBulkInsertDefault)
+	}
+
+	minDeadline := time.Duration(config.GetInt("analyzer.flow.bulk_insert.min_delay")) * time.Second
+	if minDeadline > bulkInsertDeadline {
+		minDeadline = bulkInsertDeadline
 	}
 
+	targetLatency := time.Duration(config.GetInt("analyzer.flow.bulk_insert.target_latency")) * time.Millisecond
+
+	// the bulk_maxdelay of the backend is the upper bound of the deadline
+	s.bulk = newBulkTuner(FlowBulkInsertDefault, bulkInsertDeadline, config.GetBool("analyzer.flow.bulk_insert.adaptive"), minSize, maxSize, minDeadline, targetLatency)
+
 	flowsMax := config.GetConfig().GetInt("analyzer.flow.max_buffer_size")
 
-	s.flowChan = make(chan *flow.Flow, max(flowsMax, s.bulkInsert*2))
+	s.flowChan = make(chan *flow.Flow, max(flowsMax, s.bulk.maxSize*2))
 	s.statsChan = make(chan *flow.Stats)
 
+	if s.shardCount = config.GetInt("analyzer.flow.shards"); s.shardCount == 0 {
+		s.shardCount = runtime.NumCPU()
+	}
+
 	return nil
 }
 
@@ -0,0 +1,198 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/flow/storage"
+	shttp "github.com/skydive-project/skydive/http"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+type fakeConn struct {
+	flowCounters
+}
+
+func (c *fakeConn) Serve(flowChan chan *flow.Flow, statsChan chan *flow.Stats, quit chan struct{}, wg *sync.WaitGroup) {
+}
+
+type storedFlow struct {
+	uuid string
+	last int64
+}
+
+// fakeWriter records the flows it stores, the flows being released once
+// handled
+type fakeWriter struct {
+	flows  []storedFlow
+	closed bool
+}
+
+func (w *fakeWriter) StoreFlows(flows []*flow.Flow) error {
+	for _, f := range flows {
+		w.flows = append(w.flows, storedFlow{uuid: f.UUID, last: f.Last})
+	}
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+type fakeStorage struct {
+	storage.Storage
+	sync.Mutex
+	writer  fakeWriter
+	writers []*fakeWriter
+	factory bool
+}
+
+func (s *fakeStorage) StoreFlows(flows []*flow.Flow) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.writer.StoreFlows(flows)
+}
+
+type fakeWriterFactory struct {
+	*fakeStorage
+}
+
+func (s *fakeWriterFactory) NewWriter() (storage.Writer, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	w := &fakeWriter{}
+	s.writers = append(s.writers, w)
+	return w, nil
+}
+
+func newTestFlowServer(store storage.Storage, shards int) *FlowServer {
+	return &FlowServer{
+		storage: store,
+		conn:    &fakeConn{},
+		quit:    make(chan struct{}, 2),
+		subscriberEndpoint: &FlowSubscriberEndpoint{
+			nsSubscriber: make(map[string][]ws.Speaker),
+			nsStreams:    make(map[string]map[*shttp.SSEStream]bool),
+		},
+		bulk:       newBulkTuner(10, 10*time.Millisecond, false, 10, 10, 10*time.Millisecond, time.Second),
+		flowChan:   make(chan *flow.Flow, 100),
+		statsChan:  make(chan *flow.Stats),
+		shardCount: shards,
+	}
+}
+
+// sendFlows sends concurrently the updates of the flows, each producer
+// sending the updates of its flows in order
+func sendFlows(s *FlowServer, producers, flows, updates int) {
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for u := 1; u <= updates; u++ {
+				for i := 0; i < flows; i++ {
+					s.flowChan <- &flow.Flow{UUID: fmt.Sprintf("flow-%d-%d", p, i), Last: int64(u)}
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+}
+
+// checkOrder checks that all the updates of the flows were stored, in order
+func checkOrder(t *testing.T, flows []storedFlow, expected, updates int) {
+	last := make(map[string]int64)
+	for _, f := range flows {
+		if f.last != last[f.uuid]+1 {
+			t.Errorf("Update %d of flow %s stored after update %d", f.last, f.uuid, last[f.uuid])
+		}
+		last[f.uuid] = f.last
+	}
+
+	if len(last) != expected {
+		t.Errorf("Expected %d flows to be stored, got %d", expected, len(last))
+	}
+	for uuid, l := range last {
+		if l != int64(updates) {
+			t.Errorf("Expected %d updates of flow %s to be stored, got %d", updates, uuid, l)
+		}
+	}
+}
+
+func TestFlowServerShards(t *testing.T) {
+	store := &fakeWriterFactory{fakeStorage: &fakeStorage{}}
+	s := newTestFlowServer(store, 4)
+
+	s.Start()
+	sendFlows(s, 8, 20, 50)
+	s.Stop()
+
+	if len(store.writers) != 4 {
+		t.Fatalf("Expected a writer per shard, got %d writers", len(store.writers))
+	}
+
+	if len(store.writer.flows) != 0 {
+		t.Errorf("Expected the flows to be stored by the shard writers, %d stored by the storage", len(store.writer.flows))
+	}
+
+	var flows []storedFlow
+	owners := make(map[string]*fakeWriter)
+	used := 0
+	for _, w := range store.writers {
+		if !w.closed {
+			t.Error("Expected the writers to be closed when stopping")
+		}
+
+		if len(w.flows) > 0 {
+			used++
+		}
+
+		for _, f := range w.flows {
+			if owner, ok := owners[f.uuid]; ok && owner != w {
+				t.Errorf("Flow %s stored by several shards", f.uuid)
+			}
+			owners[f.uuid] = w
+		}
+
+		flows = append(flows, w.flows...)
+	}
+
+	if used < 2 {
+		t.Errorf("Expected the flows to be spread across the shards, %d shard used", used)
+	}
+
+	checkOrder(t, flows, 8*20, 50)
+}
+
+func TestFlowServerSharedStorage(t *testing.T) {
+	store := &fakeStorage{}
+	s := newTestFlowServer(store, 4)
+
+	s.Start()
+	sendFlows(s, 8, 20, 50)
+	s.Stop()
+
+	checkOrder(t, store.writer.flows, 8*20, 50)
+}
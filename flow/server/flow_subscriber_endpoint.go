@@ -18,9 +18,16 @@
 package server
 
 import (
+	"net/http"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/flow"
+	shttp "github.com/skydive-project/skydive/http"
 	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
 	ws "github.com/skydive-project/skydive/websocket"
 )
 
@@ -29,23 +36,52 @@ type FlowSubscriberEndpoint struct {
 	common.RWMutex
 	pool         ws.StructSpeakerPool
 	nsSubscriber map[string][]ws.Speaker
+	sseEndpoint  string
+	sseQueueSize int
+	nsStreams    map[string]map[*shttp.SSEStream]bool
 }
 
 const (
 	flowNS  = "flow"
 	statsNS = "stats"
+
+	sseKeepAlive = 30 * time.Second
 )
 
+// sendSSE sends a message to the server-sent events streams subscribed to
+// its namespace, the message being encoded as for the JSON WebSocket clients
+func (fs *FlowSubscriberEndpoint) sendSSE(msg *ws.StructMessage) {
+	fs.RLock()
+	defer fs.RUnlock()
+
+	streams := fs.nsStreams[msg.Namespace]
+	if len(streams) == 0 {
+		return
+	}
+
+	data, err := msg.Bytes(ws.JSONProtocol)
+	if err != nil {
+		logging.GetLogger().Errorf("Unable to encode %s message: %s", msg.Type, err)
+		return
+	}
+
+	for stream := range streams {
+		stream.Send(msg.Type, data)
+	}
+}
+
 func (fs *FlowSubscriberEndpoint) sendFlows(ns string, flows []*flow.Flow) {
 	fs.RLock()
 	_, ok := fs.nsSubscriber[ns]
 	fs.RUnlock()
 
+	msg := ws.NewStructMessage(ns, "store", flows)
+
 	// at least one speaker for the flow namespace
 	if ok {
-		msg := ws.NewStructMessage(ns, "store", flows)
 		fs.pool.BroadcastMessage(msg)
 	}
+	fs.sendSSE(msg)
 }
 
 // SendFlows sends flow to the subscribers
@@ -70,15 +106,25 @@ func (fs *FlowSubscriberEndpoint) SendStats(stats *flow.Stats) {
 	_, ok := fs.nsSubscriber[statsNS]
 	fs.RUnlock()
 
+	msg := ws.NewStructMessage(statsNS, "stats", stats)
+
 	// at least one speaker for the flow namespace
 	if ok {
-		msg := ws.NewStructMessage(statsNS, "stats", stats)
 		fs.pool.BroadcastMessage(msg)
 	}
+	fs.sendSSE(msg)
 }
 
 // OnConnected Server interface
 func (fs *FlowSubscriberEndpoint) OnConnected(c ws.Speaker) {
+	// the flows are broadcasted unfiltered, the users restricted to a
+	// topology scope have to get them with Gremlin queries
+	if len(rbac.GetUserScopes(c.GetUsername(), "topology")) > 0 {
+		logging.GetLogger().Warningf("Closing flow subscription of %s, user %s is restricted to a topology scope", c.GetRemoteHost(), c.GetUsername())
+		c.Stop()
+		return
+	}
+
 	namespaces, ok := c.GetHeaders()["X-Websocket-Namespace"]
 	if !ok {
 		namespaces = []string{flowNS, statsNS}
@@ -117,11 +163,63 @@ func (fs *FlowSubscriberEndpoint) OnDisconnected(c ws.Speaker) {
 func (fs *FlowSubscriberEndpoint) OnMessage(c ws.Speaker, m ws.Message) {
 }
 
+// serveSSE streams the flows as server-sent events. As with the WebSocket
+// subscribers, the namespaces, flow, flow/<capture ID> or stats, can be
+// given with the X-Websocket-Namespace header or the namespace parameter.
+func (fs *FlowSubscriberEndpoint) serveSSE(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "sse", fs.sseEndpoint) || len(rbac.GetUserScopes(r.Username, "topology")) > 0 {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	namespaces, ok := r.Header["X-Websocket-Namespace"]
+	if !ok {
+		if namespaces, ok = r.URL.Query()["namespace"]; !ok {
+			namespaces = []string{flowNS, statsNS}
+		}
+	}
+
+	stream := shttp.NewSSEStream(fs.sseQueueSize)
+
+	fs.Lock()
+	for _, ns := range namespaces {
+		if _, ok := fs.nsStreams[ns]; !ok {
+			fs.nsStreams[ns] = make(map[*shttp.SSEStream]bool)
+		}
+		fs.nsStreams[ns][stream] = true
+	}
+	fs.Unlock()
+
+	logging.GetLogger().Infof("New SSE flow subscriber using namespaces: %v", namespaces)
+
+	if err := stream.Serve(w, &r.Request, sseKeepAlive); err != nil {
+		logging.GetLogger().Errorf("SSE stream of %s closed: %s", r.RemoteAddr, err)
+	}
+
+	fs.Lock()
+	for _, ns := range namespaces {
+		delete(fs.nsStreams[ns], stream)
+		if len(fs.nsStreams[ns]) == 0 {
+			delete(fs.nsStreams, ns)
+		}
+	}
+	fs.Unlock()
+}
+
+// RegisterSSEEndpoint serves the flows as server-sent events on the given
+// endpoint, for the clients that can't use WebSockets
+func (fs *FlowSubscriberEndpoint) RegisterSSEEndpoint(server *shttp.Server, endpoint string, authBackend shttp.AuthenticationBackend, queueSize int) {
+	fs.sseEndpoint = endpoint
+	fs.sseQueueSize = queueSize
+	server.HandleFunc(endpoint, fs.serveSSE, authBackend)
+}
+
 // NewFlowSubscriberEndpoint returns a new server to be used by external flow subscribers
 func NewFlowSubscriberEndpoint(srv *ws.StructServer) *FlowSubscriberEndpoint {
 	t := &FlowSubscriberEndpoint{
 		pool:         srv,
 		nsSubscriber: make(map[string][]ws.Speaker),
+		nsStreams:    make(map[string]map[*shttp.SSEStream]bool),
 	}
 	srv.AddEventHandler(t)
 	return t
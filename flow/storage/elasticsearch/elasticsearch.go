@@ -30,6 +30,7 @@ import (
 	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/flow"
 	fl "github.com/skydive-project/skydive/flow/layers"
+	"github.com/skydive-project/skydive/flow/storage"
 	es "github.com/skydive-project/skydive/storage/elasticsearch"
 )
 
@@ -137,6 +138,7 @@ type embeddedFlow struct {
 	DHCPv4       *fl.DHCPv4           `json:"DHCPv4,omitempty"`
 	DNS          *fl.DNS              `json:"DNS,omitempty"`
 	VRRPv2       *fl.VRRPv2           `json:"VRRPv2,omitempty"`
+	DHCP         *flow.DHCP           `json:"DHCP,omitempty"`
 	TrackingID   *string
 	L3TrackingID *string
 	ParentUUID   *string
@@ -157,6 +159,7 @@ func flowToEmbbedFlow(f *flow.Flow) *embeddedFlow {
 		DHCPv4:       f.DHCPv4,
 		DNS:          f.DNS,
 		VRRPv2:       f.VRRPv2,
+		DHCP:         f.DHCP,
 		TrackingID:   &f.TrackingID,
 		L3TrackingID: &f.L3TrackingID,
 		ParentUUID:   &f.ParentUUID,
@@ -178,19 +181,60 @@ type rawpacketRecord struct {
 	Flow *embeddedFlow `json:"Flow"`
 }
 
+type bulkIndexer interface {
+	BulkIndex(index es.Index, id string, data interface{}) error
+}
+
+// writer stores flows with a bulk indexer of its own, created once the
+// client is started
+type writer struct {
+	client  *es.Client
+	indexer *es.BulkIndexer
+}
+
+// StoreFlows push a set of flows in the database
+func (w *writer) StoreFlows(flows []*flow.Flow) error {
+	if w.indexer == nil {
+		indexer, err := w.client.NewBulkIndexer()
+		if err != nil {
+			return err
+		}
+		w.indexer = indexer
+	}
+
+	return storeFlows(w.indexer, flows)
+}
+
+// Close flushes the pending flows
+func (w *writer) Close() error {
+	if w.indexer == nil {
+		return nil
+	}
+	return w.indexer.Close()
+}
+
+// NewWriter returns a writer with a bulk indexer of its own
+func (c *Storage) NewWriter() (storage.Writer, error) {
+	return &writer{client: c.client}, nil
+}
+
 // StoreFlows push a set of flows in the database
 func (c *Storage) StoreFlows(flows []*flow.Flow) error {
 	if !c.client.Started() {
 		return errors.New("Storage is not yet started")
 	}
 
+	return storeFlows(c.client, flows)
+}
+
+func storeFlows(indexer bulkIndexer, flows []*flow.Flow) error {
 	for _, f := range flows {
 		data, err := json.Marshal(f)
 		if err != nil {
 			return err
 		}
 
-		if err := c.client.BulkIndex(flowIndex, f.UUID, json.RawMessage(data)); err != nil {
+		if err := indexer.BulkIndex(flowIndex, f.UUID, json.RawMessage(data)); err != nil {
 			return err
 		}
 
@@ -207,7 +251,7 @@ func (c *Storage) StoreFlows(flows []*flow.Flow) error {
 				return err
 			}
 
-			if err := c.client.BulkIndex(metricIndex, "", json.RawMessage(data)); err != nil {
+			if err := indexer.BulkIndex(metricIndex, "", json.RawMessage(data)); err != nil {
 				return err
 			}
 		}
@@ -223,7 +267,7 @@ func (c *Storage) StoreFlows(flows []*flow.Flow) error {
 				return err
 			}
 
-			if c.client.BulkIndex(rawpacketIndex, "", json.RawMessage(data)) != nil {
+			if indexer.BulkIndex(rawpacketIndex, "", json.RawMessage(data)) != nil {
 				return err
 			}
 		}
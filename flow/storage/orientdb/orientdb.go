@@ -30,13 +30,20 @@ import (
 	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/flow"
 	fl "github.com/skydive-project/skydive/flow/layers"
+	"github.com/skydive-project/skydive/flow/storage"
 	"github.com/skydive-project/skydive/logging"
 	orient "github.com/skydive-project/skydive/storage/orientdb"
 )
 
 // Storage describes a OrientDB database client
 type Storage struct {
-	client *orient.Client
+	client  *orient.Client
+	backend string
+}
+
+// writer stores flows with a client of its own
+type writer struct {
+	storage *Storage
 }
 
 // easyjson:json
@@ -55,6 +62,7 @@ type flowDoc struct {
 	DHCPv4             *fl.DHCPv4           `json:"DHCPv4,omitempty"`
 	DNS                *fl.DNS              `json:"DNS,omitempty"`
 	VRRPv2             *fl.VRRPv2           `json:"VRRPv2,omitempty"`
+	DHCP               *flow.DHCP           `json:"DHCP,omitempty"`
 	RawPacketsCaptured int64
 	TrackingID         *string
 	L3TrackingID       *string
@@ -105,6 +113,7 @@ func flowToDoc(f *flow.Flow) *flowDoc {
 		DHCPv4:             f.DHCPv4,
 		DNS:                f.DNS,
 		VRRPv2:             f.VRRPv2,
+		DHCP:               f.DHCP,
 		TrackingID:         &f.TrackingID,
 		L3TrackingID:       &f.L3TrackingID,
 		ParentUUID:         &f.ParentUUID,
@@ -347,15 +356,39 @@ func (c *Storage) Stop() {
 func (c *Storage) Close() {
 }
 
-// New creates a new OrientDB database client
-func New(backend string) (*Storage, error) {
+// StoreFlows pushes a set of flows in the database
+func (w *writer) StoreFlows(flows []*flow.Flow) error {
+	return w.storage.StoreFlows(flows)
+}
+
+// Close the writer
+func (w *writer) Close() error {
+	return nil
+}
+
+// NewWriter returns a writer with a client of its own
+func (c *Storage) NewWriter() (storage.Writer, error) {
+	client, err := newClient(c.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	return &writer{storage: &Storage{client: client, backend: c.backend}}, nil
+}
+
+func newClient(backend string) (*orient.Client, error) {
 	path := "storage." + backend
 	addr := config.GetString(path + ".addr")
 	database := config.GetString(path + ".database")
 	username := config.GetString(path + ".username")
 	password := config.GetString(path + ".password")
 
-	client, err := orient.NewClient(addr, database, username, password)
+	return orient.NewClient(addr, database, username, password)
+}
+
+// New creates a new OrientDB database client
+func New(backend string) (*Storage, error) {
+	client, err := newClient(backend)
 	if err != nil {
 		return nil, err
 	}
@@ -493,6 +526,7 @@ func New(backend string) (*Storage, error) {
 	client.CreateIndex("IPMetric", ipMetricFlowIndex)
 
 	return &Storage{
-		client: client,
+		client:  client,
+		backend: backend,
 	}, nil
 }
@@ -23,6 +23,7 @@ import (
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
 )
 
 // ErrNoStorageConfigured error no storage has been configured
@@ -39,3 +40,40 @@ type Storage interface {
 	SearchRawPackets(fsq filters.SearchQuery, packetFilter *filters.Filter) (map[string][]*flow.RawPacket, error)
 	Stop()
 }
+
+// Writer stores the flows of a single flow server shard
+type Writer interface {
+	StoreFlows(flows []*flow.Flow) error
+	Close() error
+}
+
+// WriterFactory is implemented by the storages able to create writers with a
+// connection of their own, so that the shards store their flows concurrently
+type WriterFactory interface {
+	NewWriter() (Writer, error)
+}
+
+type sharedWriter struct {
+	storage Storage
+}
+
+func (w *sharedWriter) StoreFlows(flows []*flow.Flow) error {
+	return w.storage.StoreFlows(flows)
+}
+
+func (w *sharedWriter) Close() error {
+	return nil
+}
+
+// NewWriter returns a writer of its own for the storage if it implements
+// WriterFactory, a writer sharing the storage otherwise
+func NewWriter(s Storage) Writer {
+	if factory, ok := s.(WriterFactory); ok {
+		w, err := factory.NewWriter()
+		if err == nil {
+			return w
+		}
+		logging.GetLogger().Errorf("Unable to create a flow writer, sharing the storage: %s", err)
+	}
+	return &sharedWriter{storage: s}
+}
@@ -20,6 +20,7 @@ package flow
 import (
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/gopacket"
@@ -43,6 +44,20 @@ type TableOpts struct {
 	ReassembleTCP  bool
 	LayerKeyMode   LayerKeyMode
 	ExtraLayers    ExtraLayers
+	MaxPacketRate  int64
+	// UpdateEvery and ExpireAfter override the ones given to the table
+	// when not zero
+	UpdateEvery time.Duration
+	ExpireAfter time.Duration
+}
+
+// Throttling describes how the flow tables degrade their accuracy to reduce
+// the resources used by the agent
+type Throttling struct {
+	// only one packet sequence out of SamplingRate is processed
+	SamplingRate int64
+	// the flows are sent UpdateFactor times less often
+	UpdateFactor int64
 }
 
 // UUIDs describes UUIDs that can be applied to flows table wise
@@ -76,6 +91,7 @@ type Table struct {
 	statsChan         chan Stats
 	expiredExtKeyChan chan interface{} // used when flow expired, the extKey will be sent over this chan
 	table             *simplelru.LRU
+	l3Flows           map[string]uint64 // flow keys by L3TrackingID, used to correlate ICMP errors
 	flush             chan bool
 	flushDone         chan bool
 	query             chan *TableQuery
@@ -97,6 +113,27 @@ type Table struct {
 	appTimeout        map[string]int64
 	stats             Stats
 	uuids             UUIDs
+	rateWindow        int64
+	ratePackets       int64
+	maxFlows          int
+	lastStatsLock     sync.RWMutex
+	lastStats         Stats
+	samplingRate      int64
+	sampled           int64
+	updateFactor      int64
+}
+
+// TableStatus describes the occupancy of a flow table, the drops being
+// the ones of the last statistics interval
+type TableStatus struct {
+	CaptureID     string
+	NodeTID       string
+	MaxFlows      int
+	QueueLength   int
+	QueueCapacity int
+	UpdateEvery   time.Duration
+	ExpireAfter   time.Duration
+	Stats         Stats
 }
 
 // OperationType operation type of a Flow in a flow table
@@ -136,12 +173,12 @@ func NewTable(updateEvery, expireAfter time.Duration, sender Sender, uuids UUIDs
 		// convert seconds to milleseconds
 		appTimeout[strings.ToUpper(key)] = int64(1000 * config.GetConfig().GetInt("flow.application_timeout."+key))
 	}
-	LRU, _ := simplelru.NewLRU(config.GetConfig().GetInt("flow.max_entries"), nil)
+	maxFlows := config.GetConfig().GetInt("flow.max_entries")
 	t := &Table{
 		packetSeqChan: make(chan *PacketSequence, 1000),
 		extFlowChan:   make(chan *ExtFlow, 1000),
 		statsChan:     make(chan Stats, 10),
-		table:         LRU,
+		l3Flows:       make(map[string]uint64),
 		flush:         make(chan bool),
 		flushDone:     make(chan bool),
 		state:         common.StoppedState,
@@ -152,11 +189,20 @@ func NewTable(updateEvery, expireAfter time.Duration, sender Sender, uuids UUIDs
 		uuids:         uuids,
 		appPortMap:    NewApplicationPortMapFromConfig(),
 		appTimeout:    appTimeout,
+		maxFlows:      maxFlows,
 	}
+	t.table, _ = simplelru.NewLRU(maxFlows, t.onEvict)
 	if len(opts) > 0 {
 		t.Opts = opts[0]
 	}
 
+	if t.Opts.UpdateEvery > 0 {
+		t.updateEvery = t.Opts.UpdateEvery
+	}
+	if t.Opts.ExpireAfter > 0 {
+		t.expireAfter = t.Opts.ExpireAfter
+	}
+
 	t.opts = Opts{
 		TCPMetric:    t.Opts.ExtraTCPMetric,
 		IPDefrag:     t.Opts.IPDefrag,
@@ -224,6 +270,26 @@ func (ft *Table) getOrCreateFlow(key uint64) (*Flow, bool) {
 	return new, true
 }
 
+// onEvict is called whenever a flow leaves the table, either expired or
+// evicted because of the table size
+func (ft *Table) onEvict(key interface{}, value interface{}) {
+	f := value.(*Flow)
+	if k, ok := ft.l3Flows[f.L3TrackingID]; ok && k == key.(uint64) {
+		delete(ft.l3Flows, f.L3TrackingID)
+	}
+}
+
+// correlateICMPError links an ICMP error flow to the flow of the packet
+// that triggered it, if this flow is known by the table
+func (ft *Table) correlateICMPError(f *Flow) {
+	original := f.ICMP.Original
+	if key, ok := ft.l3Flows[original.L3TrackingID]; ok {
+		if of, found := ft.table.Peek(key); found {
+			original.UUID = of.(*Flow).UUID
+		}
+	}
+}
+
 func (ft *Table) replaceFlow(key uint64, f *Flow) *Flow {
 	prev, _ := ft.table.Get(key)
 	if ft.table.Add(key, f) {
@@ -404,6 +470,11 @@ func (ft *Table) packetToFlow(packet *Packet, parentUUID string) *Flow {
 		}
 
 		flow.initFromPacket(key, l2Key, l3Key, packet, parentUUID, &ft.uuids, &ft.opts)
+		ft.l3Flows[flow.L3TrackingID] = key
+
+		if flow.ICMP != nil && flow.ICMP.Original != nil {
+			ft.correlateICMPError(flow)
+		}
 	} else {
 		if ft.Opts.ReassembleTCP {
 			if layer := packet.GoPacket.TransportLayer(); layer != nil && layer.LayerType() == layers.LayerTypeTCP {
@@ -526,6 +597,64 @@ func (ft *Table) State() common.ServiceState {
 	return ft.state.Load()
 }
 
+// Status returns the status of the flow table
+func (ft *Table) Status() *TableStatus {
+	ft.lastStatsLock.RLock()
+	defer ft.lastStatsLock.RUnlock()
+
+	return &TableStatus{
+		CaptureID:     ft.uuids.CaptureID,
+		NodeTID:       ft.uuids.NodeTID,
+		MaxFlows:      ft.maxFlows,
+		QueueLength:   len(ft.packetSeqChan),
+		QueueCapacity: cap(ft.packetSeqChan),
+		UpdateEvery:   ft.updateEvery,
+		ExpireAfter:   ft.expireAfter,
+		Stats:         ft.lastStats,
+	}
+}
+
+// ExpireAfter returns the duration after which the inactive flows expire
+func (ft *Table) ExpireAfter() time.Duration {
+	return ft.expireAfter
+}
+
+// SetThrottling sets the sampling rate and the update factor applied to
+// the packets and the flows of the table
+func (ft *Table) SetThrottling(t Throttling) {
+	atomic.StoreInt64(&ft.samplingRate, t.SamplingRate)
+	atomic.StoreInt64(&ft.updateFactor, t.UpdateFactor)
+}
+
+// throttled returns whether the given number of packets goes beyond the maximum
+// packet rate allowed for this table or is not sampled, in which case they have
+// to be dropped
+func (ft *Table) throttled(packets int64) bool {
+	if rate := atomic.LoadInt64(&ft.samplingRate); rate > 1 {
+		if ft.sampled++; ft.sampled%rate != 0 {
+			ft.stats.PacketsThrottled += packets
+			return true
+		}
+	}
+
+	if ft.Opts.MaxPacketRate <= 0 {
+		return false
+	}
+
+	if now := time.Now().Unix(); now != ft.rateWindow {
+		ft.rateWindow = now
+		ft.ratePackets = 0
+	}
+
+	ft.ratePackets += packets
+	if ft.ratePackets > ft.Opts.MaxPacketRate {
+		ft.stats.PacketsThrottled += packets
+		return true
+	}
+
+	return false
+}
+
 // Run background jobs, like update/expire entries event
 func (ft *Table) Run() {
 	ft.wg.Add(1)
@@ -549,6 +678,9 @@ func (ft *Table) Run() {
 	statsTicker := time.NewTicker(time.Second * 10)
 	defer statsTicker.Stop()
 
+	// number of update ticks skipped when throttled
+	var skippedUpdates int64
+
 	ft.query = make(chan *TableQuery, 100)
 	ft.reply = make(chan []byte, 100)
 
@@ -560,7 +692,10 @@ func (ft *Table) Run() {
 		case now := <-expireTicker.C:
 			ft.expireAt(now)
 		case now := <-updateTicker.C:
-			ft.updateAt(now)
+			if skippedUpdates++; skippedUpdates >= atomic.LoadInt64(&ft.updateFactor) {
+				skippedUpdates = 0
+				ft.updateAt(now)
+			}
 		case <-ft.flush:
 			if ft.Opts.ReassembleTCP {
 				ft.tcpAssembler.FlushAll()
@@ -573,9 +708,14 @@ func (ft *Table) Run() {
 				ft.reply <- ft.onQuery(query)
 			}
 		case ps := <-ft.packetSeqChan:
-			ft.processPacketSeq(ps)
+			if !ft.throttled(int64(len(ps.Packets))) {
+				ft.processPacketSeq(ps)
+			}
 		case extFlow := <-ft.extFlowChan:
-			ft.processExtFlow(extFlow)
+			// an external flow update, eBPF or operation, counts as a packet
+			if !ft.throttled(1) {
+				ft.processExtFlow(extFlow)
+			}
 		case now := <-ctTicker.C:
 			t := now.Add(-ctDuration)
 			if ft.tcpAssembler != nil {
@@ -594,6 +734,14 @@ func (ft *Table) Run() {
 
 			ft.sender.SendStats(ft.stats)
 
+			ft.lastStatsLock.Lock()
+			ft.lastStats = ft.stats
+			ft.lastStatsLock.Unlock()
+
+			if ft.stats.PacketsThrottled > 0 {
+				logging.GetLogger().Warningf("Capture %s throttled, %d packets dropped above %d packets/s or not sampled", ft.uuids.CaptureID, ft.stats.PacketsThrottled, ft.Opts.MaxPacketRate)
+			}
+
 			logging.GetLogger().Debugf("Flow table stats: %+v", ft.stats)
 			ft.stats = Stats{}
 		}
@@ -18,9 +18,11 @@
 package flow
 
 import (
+	"net"
 	"testing"
 	"time"
 
+	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/config"
@@ -78,6 +80,82 @@ func TestFlowExpire(t *testing.T) {
 	}
 }
 
+func TestPacketRateThrottling(t *testing.T) {
+	table := NewTable(time.Hour, time.Hour, &fakeMessageSender{}, UUIDs{}, TableOpts{MaxPacketRate: 10})
+
+	var accepted int
+	for i := 0; i != 10; i++ {
+		if !table.throttled(2) {
+			accepted++
+		}
+	}
+
+	// a rate window change between two calls would accept more sequences
+	if accepted < 5 {
+		t.Errorf("Should accept at least 5 packet sequences got : %d", accepted)
+	}
+
+	if table.stats.PacketsThrottled != int64(2*(10-accepted)) {
+		t.Errorf("Should have %d throttled packets got : %d", 2*(10-accepted), table.stats.PacketsThrottled)
+	}
+}
+
+func TestPacketSamplingThrottling(t *testing.T) {
+	table := NewTable(time.Hour, time.Hour, &fakeMessageSender{}, UUIDs{}, TableOpts{})
+	table.SetThrottling(Throttling{SamplingRate: 4, UpdateFactor: 4})
+
+	var accepted int
+	for i := 0; i != 100; i++ {
+		if !table.throttled(2) {
+			accepted++
+		}
+	}
+
+	if accepted != 25 {
+		t.Errorf("Should accept 25 packet sequences got : %d", accepted)
+	}
+
+	if table.stats.PacketsThrottled != 150 {
+		t.Errorf("Should have 150 throttled packets got : %d", table.stats.PacketsThrottled)
+	}
+}
+
+func TestExtFlowThrottling(t *testing.T) {
+	table := NewTable(time.Hour, time.Hour, &fakeMessageSender{}, UUIDs{}, TableOpts{})
+	table.SetThrottling(Throttling{SamplingRate: 4, UpdateFactor: 4})
+
+	_, extFlowChan, _ := table.Start(nil)
+	for table.State() != common.RunningState {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for i := 0; i != 100; i++ {
+		extFlowChan <- &ExtFlow{Type: OperationExtFlowType, Obj: &Operation{Type: ReplaceOperation, Flow: NewFlow(), Key: uint64(i)}}
+	}
+
+	for len(extFlowChan) != 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	table.Stop()
+
+	if table.stats.PacketsThrottled != 75 {
+		t.Errorf("Should have 75 throttled external flows got : %d", table.stats.PacketsThrottled)
+	}
+}
+
+func TestTableOptsIntervals(t *testing.T) {
+	table := NewTable(time.Minute, time.Hour, &fakeMessageSender{}, UUIDs{}, TableOpts{UpdateEvery: time.Second})
+
+	status := table.Status()
+	if status.UpdateEvery != time.Second {
+		t.Errorf("The update interval of the capture should be used, got : %s", status.UpdateEvery)
+	}
+
+	if status.ExpireAfter != time.Hour {
+		t.Errorf("The expire timeout of the agent should be used, got : %s", status.ExpireAfter)
+	}
+}
+
 func TestGetFlowsWithFilters(t *testing.T) {
 	table := NewTable(time.Hour, time.Hour, &fakeMessageSender{}, UUIDs{NodeTID: "probe-1"}, TableOpts{})
 
@@ -304,3 +382,207 @@ func BenchmarkGetFlows(b *testing.B) {
 		table.getFlows(nil)
 	}
 }
+
+func feedWithLayers(t *testing.T, table *Table, l ...gopacket.SerializableLayer) {
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, l...); err != nil {
+		t.Fatal(err)
+	}
+
+	p := gopacket.NewPacket(buf.Bytes(), layers.LinkTypeEthernet, gopacket.Default)
+	p.Metadata().CaptureInfo.Timestamp = time.Now()
+
+	table.processPacketSeq(PacketSeqFromGoPacket(p, 0, nil, nil))
+}
+
+func TestICMPErrorCorrelation(t *testing.T) {
+	table := NewTable(time.Hour, time.Hour, &fakeMessageSender{}, UUIDs{}, TableOpts{})
+
+	hostMAC, _ := net.ParseMAC("00:00:00:00:00:01")
+	routerMAC, _ := net.ParseMAC("00:00:00:00:00:02")
+
+	ip := &layers.IPv4{Version: 4, TTL: 1, Protocol: layers.IPProtocolUDP, SrcIP: net.IP{192, 168, 0, 1}, DstIP: net.IP{10, 0, 0, 1}}
+	udp := &layers.UDP{SrcPort: 34567, DstPort: 53}
+	udp.SetNetworkLayerForChecksum(ip)
+
+	feedWithLayers(t, table,
+		&layers.Ethernet{SrcMAC: hostMAC, DstMAC: routerMAC, EthernetType: layers.EthernetTypeIPv4},
+		ip, udp, gopacket.Payload([]byte("query")))
+
+	// the router quotes the IP header and the first 8 bytes of the payload
+	quoted := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(quoted, gopacket.SerializeOptions{FixLengths: true}, ip, udp); err != nil {
+		t.Fatal(err)
+	}
+
+	feedWithLayers(t, table,
+		&layers.Ethernet{SrcMAC: routerMAC, DstMAC: hostMAC, EthernetType: layers.EthernetTypeIPv4},
+		&layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolICMPv4, SrcIP: net.IP{192, 168, 0, 254}, DstIP: net.IP{192, 168, 0, 1}},
+		&layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeTimeExceeded, layers.ICMPv4CodeTTLExceeded)},
+		gopacket.Payload(quoted.Bytes()))
+
+	var udpFlow, icmpFlow *Flow
+	for _, f := range table.getFlows(&filters.SearchQuery{}).Flows {
+		if f.Transport != nil {
+			udpFlow = f
+		} else if f.ICMP != nil {
+			icmpFlow = f
+		}
+	}
+
+	if udpFlow == nil || icmpFlow == nil {
+		t.Fatalf("Should get an UDP and an ICMP flow")
+	}
+
+	if icmpFlow.ICMP.Type != ICMPType_TIME_EXCEEDED || icmpFlow.ICMP.Original == nil {
+		t.Fatalf("Should get the original flow of the time exceeded error, got : %+v", icmpFlow.ICMP)
+	}
+
+	original := icmpFlow.ICMP.Original
+	if original.Network.A != "192.168.0.1" || original.Network.B != "10.0.0.1" ||
+		original.Transport.Protocol != FlowProtocol_UDP || original.Transport.A != 34567 || original.Transport.B != 53 {
+		t.Errorf("Wrong original flow, got : %+v", original)
+	}
+
+	if original.L3TrackingID != udpFlow.L3TrackingID {
+		t.Errorf("Original L3TrackingID should be %s, got : %s", udpFlow.L3TrackingID, original.L3TrackingID)
+	}
+
+	if original.UUID != udpFlow.UUID {
+		t.Errorf("Original UUID should be %s, got : %s", udpFlow.UUID, original.UUID)
+	}
+
+	// once the original flow expired, the index does not reference it anymore
+	table.expireNow()
+	if len(table.l3Flows) != 0 {
+		t.Errorf("Expired flows should be removed from the index, got : %+v", table.l3Flows)
+	}
+}
+
+func TestFragmentationNeeded(t *testing.T) {
+	table := NewTable(time.Hour, time.Hour, &fakeMessageSender{}, UUIDs{}, TableOpts{})
+
+	hostMAC, _ := net.ParseMAC("00:00:00:00:00:01")
+	routerMAC, _ := net.ParseMAC("00:00:00:00:00:02")
+
+	ip := &layers.IPv4{Version: 4, TTL: 64, Flags: layers.IPv4DontFragment, Protocol: layers.IPProtocolUDP, SrcIP: net.IP{192, 168, 0, 1}, DstIP: net.IP{10, 0, 0, 1}}
+	udp := &layers.UDP{SrcPort: 34567, DstPort: 4789}
+	udp.SetNetworkLayerForChecksum(ip)
+
+	feedWithLayers(t, table,
+		&layers.Ethernet{SrcMAC: hostMAC, DstMAC: routerMAC, EthernetType: layers.EthernetTypeIPv4},
+		ip, udp, gopacket.Payload(make([]byte, 1000)))
+
+	quoted := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(quoted, gopacket.SerializeOptions{FixLengths: true}, ip, udp); err != nil {
+		t.Fatal(err)
+	}
+
+	feedWithLayers(t, table,
+		&layers.Ethernet{SrcMAC: routerMAC, DstMAC: hostMAC, EthernetType: layers.EthernetTypeIPv4},
+		&layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolICMPv4, SrcIP: net.IP{192, 168, 0, 254}, DstIP: net.IP{192, 168, 0, 1}},
+		&layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeFragmentationNeeded), Seq: 576},
+		gopacket.Payload(quoted.Bytes()))
+
+	var udpFlow, icmpFlow *Flow
+	for _, f := range table.getFlows(&filters.SearchQuery{}).Flows {
+		if f.Transport != nil {
+			udpFlow = f
+		} else if f.ICMP != nil {
+			icmpFlow = f
+		}
+	}
+
+	if udpFlow == nil || icmpFlow == nil {
+		t.Fatalf("Should get an UDP and an ICMP flow")
+	}
+
+	if udpFlow.MaxPacketLength != 1028 {
+		t.Errorf("Largest packet should be 1028 bytes long, got : %d", udpFlow.MaxPacketLength)
+	}
+
+	if icmpFlow.ICMP.MTU != 576 {
+		t.Errorf("Next hop MTU should be 576, got : %d", icmpFlow.ICMP.MTU)
+	}
+}
+
+func TestDHCPTransaction(t *testing.T) {
+	table := NewTable(time.Hour, time.Hour, &fakeMessageSender{}, UUIDs{}, TableOpts{ExtraLayers: DHCPv4Layer | DHCPv6Layer})
+
+	clientMAC, _ := net.ParseMAC("00:00:00:00:00:01")
+	serverMAC, _ := net.ParseMAC("00:00:00:00:00:02")
+
+	serverIP := net.IP{192, 168, 0, 254}
+	offer := &layers.DHCPv4{
+		Operation:    layers.DHCPOpReply,
+		HardwareType: layers.LinkTypeEthernet,
+		HardwareLen:  6,
+		Xid:          0x1234,
+		YourClientIP: net.IP{192, 168, 0, 10},
+		ClientHWAddr: clientMAC,
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeOffer)}),
+			layers.NewDHCPOption(layers.DHCPOptServerID, serverIP),
+			layers.NewDHCPOption(layers.DHCPOptLeaseTime, []byte{0, 0, 0x0e, 0x10}),
+		},
+	}
+
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: serverIP, DstIP: net.IPv4bcast}
+	udp := &layers.UDP{SrcPort: 67, DstPort: 68}
+	udp.SetNetworkLayerForChecksum(ip)
+
+	feedWithLayers(t, table,
+		&layers.Ethernet{SrcMAC: serverMAC, DstMAC: layers.EthernetBroadcast, EthernetType: layers.EthernetTypeIPv4},
+		ip, udp, offer)
+
+	// the ack of the same transaction keeps the offered address
+	offer.Options[0] = layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeAck)})
+	feedWithLayers(t, table,
+		&layers.Ethernet{SrcMAC: serverMAC, DstMAC: layers.EthernetBroadcast, EthernetType: layers.EthernetTypeIPv4},
+		ip, udp, offer)
+
+	ip6 := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: net.ParseIP("fe80::2"), DstIP: net.ParseIP("fe80::1")}
+	udp6 := &layers.UDP{SrcPort: 547, DstPort: 546}
+	udp6.SetNetworkLayerForChecksum(ip6)
+
+	duid := &layers.DHCPv6DUID{Type: layers.DHCPv6DUIDTypeLL, HardwareType: []byte{0, 1}, LinkLayerAddress: clientMAC}
+	iaAddr := append(net.ParseIP("2001:db8::10").To16(), 0, 0, 0x0e, 0x10, 0, 0, 0x1c, 0x20)
+	iaNA := append([]byte{0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, byte(layers.DHCPv6OptIAAddr), 0, byte(len(iaAddr))}, iaAddr...)
+
+	feedWithLayers(t, table,
+		&layers.Ethernet{SrcMAC: serverMAC, DstMAC: clientMAC, EthernetType: layers.EthernetTypeIPv6},
+		ip6, udp6, &layers.DHCPv6{
+			MsgType:       layers.DHCPv6MsgTypeReply,
+			TransactionID: []byte{0xab, 0xcd, 0xef},
+			Options: layers.DHCPv6Options{
+				layers.NewDHCPv6Option(layers.DHCPv6OptClientID, duid.Encode()),
+				layers.NewDHCPv6Option(layers.DHCPv6OptIANA, iaNA),
+			},
+		})
+
+	var v4, v6 *DHCP
+	for _, f := range table.getFlows(&filters.SearchQuery{}).Flows {
+		if f.DHCP == nil {
+			continue
+		}
+		if f.DHCP.Version == 4 {
+			v4 = f.DHCP
+		} else {
+			v6 = f.DHCP
+		}
+	}
+
+	if v4 == nil || v6 == nil {
+		t.Fatalf("Should get a DHCP and a DHCPv6 record")
+	}
+
+	expected := DHCP{Version: 4, MessageType: "Ack", TransactionID: "0x00001234", ClientMAC: "00:00:00:00:00:01", OfferedIP: "192.168.0.10", ServerIP: "192.168.0.254", LeaseTime: 3600}
+	if *v4 != expected {
+		t.Errorf("Wrong DHCP record, expected %+v, got : %+v", expected, v4)
+	}
+
+	expected = DHCP{Version: 6, MessageType: "Reply", TransactionID: "abcdef", ClientMAC: "00:00:00:00:00:01", OfferedIP: "2001:db8::10", ServerIP: "fe80::2", LeaseTime: 7200}
+	if *v6 != expected {
+		t.Errorf("Wrong DHCPv6 record, expected %+v, got : %+v", expected, v6)
+	}
+}
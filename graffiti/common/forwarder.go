@@ -58,7 +58,9 @@ func (t *Forwarder) OnNewMaster(c ws.Speaker) {
 
 		t.triggerResync()
 
-		// synced can now listen the graph
+		// synced can now listen the graph, the forwarder may already be
+		// listening when switching directly from a master to another one
+		t.graph.RemoveEventListener(t)
 		t.graph.AddEventListener(t)
 
 		t.graph.RUnlock()
@@ -100,6 +102,16 @@ func (t *Forwarder) GetMaster() ws.Speaker {
 	return t.masterElection.GetMaster()
 }
 
+// SetMasterSelector sets how the master is selected among the connected speakers
+func (t *Forwarder) SetMasterSelector(selector ws.MasterSelector) {
+	t.masterElection.SetMasterSelector(selector)
+}
+
+// Reelect selects the master again, a re-sync being done if it changed
+func (t *Forwarder) Reelect() {
+	t.masterElection.Reelect()
+}
+
 // NewForwarder returns a new Graph forwarder which forwards event of the given graph
 // to the given WebSocket JSON speakers.
 func NewForwarder(g *graph.Graph, pool ws.StructSpeakerPool) *Forwarder {
@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// TopologyScope restricts the topology a user can access to the nodes
+// selected by the Gremlin scopes of its roles and to the edges between them
+type TopologyScope struct {
+	user   string
+	key    string
+	scopes []*traversal.GremlinTraversalSequence
+}
+
+// NewTopologyScope returns the topology scope of a user, nil if the user
+// can access the whole topology
+func NewTopologyScope(parser *traversal.GremlinTraversalParser, user string) (*TopologyScope, error) {
+	expressions := rbac.GetUserScopes(user, "topology")
+	if len(expressions) == 0 {
+		return nil, nil
+	}
+
+	scope := &TopologyScope{user: user, key: strings.Join(expressions, "\n")}
+	for _, expression := range expressions {
+		ts, err := parser.Parse(strings.NewReader(expression))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid topology scope '%s' for user %s: %s", expression, user, err)
+		}
+		scope.scopes = append(scope.scopes, ts)
+	}
+
+	return scope, nil
+}
+
+// Key identifies the scope, the users whose roles have the same topology
+// scopes sharing the same key
+func (s *TopologyScope) Key() string {
+	return s.key
+}
+
+// Graph returns the part of the given graph in the scope. The returned
+// graph is flagged as scoped so that only the flows of its nodes are
+// returned by the Flows step.
+func (s *TopologyScope) Graph(g *graph.Graph, lockGraph bool) (*graph.Graph, error) {
+	var nodes []*graph.Node
+	for _, ts := range s.scopes {
+		res, err := ts.Exec(g, lockGraph)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to evaluate the topology scope of user %s: %s", s.user, err)
+		}
+
+		switch tv := res.(type) {
+		case *traversal.GraphTraversalV:
+			nodes = append(nodes, tv.GetNodes()...)
+		case *traversal.GraphTraversal:
+			nodes = append(nodes, tv.Graph.GetNodes(nil)...)
+		default:
+			return nil, fmt.Errorf("Topology scope of user %s did not return nodes", s.user)
+		}
+	}
+
+	sub := traversal.NewGraphTraversalV(traversal.NewGraphTraversal(g, lockGraph), nodes).SubGraph(traversal.StepContext{})
+	if err := sub.Error(); err != nil {
+		return nil, err
+	}
+
+	return sub.Graph.CloneWithContext(graph.Context{TimePoint: true, Scoped: true})
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/skydive-project/skydive/graffiti/common/scopetest"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	gws "github.com/skydive-project/skydive/graffiti/websocket"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+func TestTopologyScope(t *testing.T) {
+	scopetest.InitRBAC(t, scopetest.TenantPolicy)
+	g, a, other := scopetest.NewTenantGraph(t)
+	parser := traversal.NewGremlinTraversalParser()
+
+	if scope, err := NewTopologyScope(parser, "bob"); err != nil || scope != nil {
+		t.Fatalf("the access of bob should not be restricted, got %v, %v", scope, err)
+	}
+
+	scope, err := NewTopologyScope(parser, "alice")
+	if err != nil || scope == nil {
+		t.Fatalf("the access of alice should be restricted, got %v", err)
+	}
+
+	scoped, err := scope.Graph(g, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scoped.GetNode(a.ID) == nil || scoped.GetNode(other.ID) != nil {
+		t.Errorf("only the nodes of tenant a should be in the scope, got %v", scoped.GetNodes(nil))
+	}
+
+	if len(scoped.GetEdges(nil)) != 0 {
+		t.Errorf("the edges to nodes out of the scope should be hidden, got %v", scoped.GetEdges(nil))
+	}
+
+	// the Gremlin queries only see the scoped graph
+	ts, err := parser.Parse(strings.NewReader("G.V().Count()"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := ts.Exec(scoped, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := res.Values()[0]; count != 1 {
+		t.Errorf("a Gremlin query should only count the nodes of the scope, got %v", count)
+	}
+}
+
+func TestScopedSubscriber(t *testing.T) {
+	scopetest.InitRBAC(t, scopetest.TenantPolicy)
+	g, a, _ := scopetest.NewTenantGraph(t)
+
+	endpoint := &SubscriberEndpoint{
+		Graph:         g,
+		gremlinParser: traversal.NewGremlinTraversalParser(),
+		subscribers:   make(map[ws.Speaker]*subscriber),
+		scopeGraphs:   make(map[string]*graph.Graph),
+	}
+
+	scope, err := NewTopologyScope(endpoint.gremlinParser, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s1, err := endpoint.newSubscriber("host1", "", scope, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := endpoint.newSubscriber("host2", "", scope, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s1.graph != s2.graph {
+		t.Error("the graph of a scope should be computed once for its subscribers")
+	}
+
+	// a node of the scope is notified, not the others
+	endpoint.invalidateScopeGraphs()
+	inScope, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "a2", "Tenant": "a"})
+	msgs := endpoint.filteredMessages(s1, gws.NodeAddedMsgType, inScope)
+	if len(msgs) != 1 || msgs[0].Type != gws.NodeAddedMsgType {
+		t.Errorf("the node added in the scope should be notified, got %v", msgs)
+	}
+
+	endpoint.invalidateScopeGraphs()
+	outOfScope, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "b2", "Tenant": "b"})
+	if msgs := endpoint.filteredMessages(s1, gws.NodeAddedMsgType, outOfScope); len(msgs) != 0 {
+		t.Errorf("the node added out of the scope should not be notified, got %v", msgs)
+	}
+
+	endpoint.invalidateScopeGraphs()
+	g.AddMetadata(a, "Tenant", "b")
+	msgs = endpoint.filteredMessages(s1, gws.NodeUpdatedMsgType, a)
+	if len(msgs) != 1 || msgs[0].Type != gws.NodeDeletedMsgType {
+		t.Errorf("the node leaving the scope should be notified as deleted, got %v", msgs)
+	}
+
+	// a reloaded policy lifting the scope gives access to the whole graph
+	endpoint.subscribers[nil] = s1
+	scopetest.InitRBAC(t, "g, alice, admin")
+	endpoint.onPolicyReload()
+	if s1.scope != nil {
+		t.Error("the scope of the subscriber should be updated along with the policy")
+	}
+}
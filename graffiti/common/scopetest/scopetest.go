@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package scopetest provides the RBAC policy and the graph used to test the
+// topology scopes of the users
+package scopetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/casbin/casbin/model"
+	etcd "github.com/coreos/etcd/client"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// TenantPolicy restricts alice to the nodes of tenant a while bob sees
+// the whole topology
+const TenantPolicy = `p, tenant, topology, read, allow
+p1, tenant, topology, G.V().Has('Tenant', 'a')
+g, alice, tenant
+p, admin, topology, read, allow
+g, bob, admin`
+
+// policyKeysAPI serves a policy as if it was uploaded in etcd
+type policyKeysAPI struct {
+	etcd.KeysAPI
+	policy string
+}
+
+type idleWatcher struct{}
+
+func (idleWatcher) Next(ctx context.Context) (*etcd.Response, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (k *policyKeysAPI) Get(ctx context.Context, key string, opts *etcd.GetOptions) (*etcd.Response, error) {
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: k.policy}}, nil
+}
+
+func (k *policyKeysAPI) Watcher(key string, opts *etcd.WatcherOptions) etcd.Watcher {
+	return idleWatcher{}
+}
+
+// InitRBAC initializes the RBAC enforcer with the given policy
+func InitRBAC(t *testing.T, policy string) {
+	m := model.Model{}
+	m.AddDef("r", "r", "sub, obj, act")
+	m.AddDef("p", "p", "sub, obj, act, eft")
+	m.AddDef("p", "p1", "sub, obj, scope")
+	m.AddDef("g", "g", "_, _")
+	m.AddDef("e", "e", "some(where (p_eft == allow)) && !some(where (p_eft == deny))")
+	m.AddDef("m", "m", "g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act")
+
+	if err := rbac.Init(m, &policyKeysAPI{policy: policy}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// NewTenantGraph returns a graph with a node of tenant a linked to a node
+// of tenant b
+func NewTenantGraph(t *testing.T) (g *graph.Graph, a *graph.Node, b *graph.Node) {
+	backend, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g = graph.NewGraph("testhost", backend, common.UnknownService)
+
+	a, _ = g.NewNode(graph.GenID(), graph.Metadata{"Name": "a1", "Tenant": "a"})
+	b, _ = g.NewNode(graph.GenID(), graph.Metadata{"Name": "b1", "Tenant": "b"})
+	g.Link(a, b, graph.Metadata{"RelationType": "layer2"})
+
+	return g, a, b
+}
@@ -22,20 +22,28 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
 
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/graffiti/graph/traversal"
 	gws "github.com/skydive-project/skydive/graffiti/websocket"
+	shttp "github.com/skydive-project/skydive/http"
 	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
 	"github.com/skydive-project/skydive/websocket"
 	ws "github.com/skydive-project/skydive/websocket"
 )
 
+const sseKeepAlive = 30 * time.Second
+
 type subscriber struct {
 	graph         *graph.Graph
 	gremlinFilter string
 	ts            *traversal.GremlinTraversalSequence
+	scope         *TopologyScope
 }
 
 // SubscriberEndpoint sends all the modifications to its subscribers.
@@ -47,34 +55,119 @@ type SubscriberEndpoint struct {
 	wg            sync.WaitGroup
 	gremlinParser *traversal.GremlinTraversalParser
 	subscribers   map[ws.Speaker]*subscriber
+	sseEndpoint   string
+	sseQueueSize  int
+	sseStreams    map[*shttp.SSEStream]*subscriber
+	replayLog     *ws.ReplayLog
+	replayLock    sync.Mutex
+	scopeLock     sync.Mutex
+	scopeGraphs   map[string]*graph.Graph
 }
 
-func (t *SubscriberEndpoint) getGraph(gremlinQuery string, ts *traversal.GremlinTraversalSequence, lockGraph bool) (*graph.Graph, error) {
-	res, err := ts.Exec(t.Graph, lockGraph)
+// scopeGraph returns the part of the graph in a topology scope. It is
+// computed once for all the subscribers sharing the scope, until the graph
+// or the scopes change.
+func (t *SubscriberEndpoint) scopeGraph(scope *TopologyScope, lockGraph bool) (*graph.Graph, error) {
+	t.scopeLock.Lock()
+	defer t.scopeLock.Unlock()
+
+	if g, found := t.scopeGraphs[scope.Key()]; found {
+		return g, nil
+	}
+
+	g, err := scope.Graph(t.Graph, lockGraph)
+	if err != nil {
+		return nil, err
+	}
+	t.scopeGraphs[scope.Key()] = g
+
+	return g, nil
+}
+
+func (t *SubscriberEndpoint) invalidateScopeGraphs() {
+	t.scopeLock.Lock()
+	t.scopeGraphs = make(map[string]*graph.Graph)
+	t.scopeLock.Unlock()
+}
+
+// onPolicyReload updates the topology scopes of the subscribers, the
+// scopes of their roles having possibly changed
+func (t *SubscriberEndpoint) onPolicyReload() {
+	t.Graph.RLock()
+	defer t.Graph.RUnlock()
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.invalidateScopeGraphs()
+
+	update := func(s *subscriber) {
+		if s == nil || s.scope == nil {
+			return
+		}
+
+		scope, err := NewTopologyScope(t.gremlinParser, s.scope.user)
+		if err != nil {
+			logging.GetLogger().Error(err)
+			return
+		}
+		s.scope = scope
+	}
+
+	for _, s := range t.subscribers {
+		update(s)
+	}
+	for _, s := range t.sseStreams {
+		update(s)
+	}
+}
+
+// subscriberGraph returns the graph seen by a subscriber, the part of the
+// graph in the scope of its user, filtered by its Gremlin filter if any
+func (t *SubscriberEndpoint) subscriberGraph(s *subscriber, lockGraph bool) (*graph.Graph, error) {
+	g := t.Graph
+	if s.scope != nil {
+		var err error
+		if g, err = t.scopeGraph(s.scope, lockGraph); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.ts == nil {
+		return g, nil
+	}
+
+	res, err := s.ts.Exec(g, lockGraph)
 	if err != nil {
 		return nil, err
 	}
 
 	tv, ok := res.(*traversal.GraphTraversal)
 	if !ok {
-		return nil, fmt.Errorf("Gremlin query '%s' did not return a graph", gremlinQuery)
+		return nil, fmt.Errorf("Gremlin query '%s' did not return a graph", s.gremlinFilter)
 	}
 
 	return tv.Graph, nil
 }
 
-func (t *SubscriberEndpoint) newSubscriber(host string, gremlinFilter string, lockGraph bool) (*subscriber, error) {
-	ts, err := t.gremlinParser.Parse(strings.NewReader(gremlinFilter))
-	if err != nil {
-		return nil, fmt.Errorf("Invalid Gremlin filter '%s' for client %s", gremlinFilter, host)
+func (t *SubscriberEndpoint) newSubscriber(host string, gremlinFilter string, scope *TopologyScope, lockGraph bool) (*subscriber, error) {
+	s := &subscriber{gremlinFilter: gremlinFilter, scope: scope}
+
+	if gremlinFilter != "" {
+		ts, err := t.gremlinParser.Parse(strings.NewReader(gremlinFilter))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Gremlin filter '%s' for client %s", gremlinFilter, host)
+		}
+		s.ts = ts
 	}
 
-	g, err := t.getGraph(gremlinFilter, ts, lockGraph)
+	g, err := t.subscriberGraph(s, lockGraph)
 	if err != nil {
 		return nil, err
 	}
+	s.graph = g
 
-	return &subscriber{graph: g, ts: ts, gremlinFilter: gremlinFilter}, nil
+	return s, nil
 }
 
 // OnConnected called when a subscriber got connected.
@@ -84,17 +177,29 @@ func (t *SubscriberEndpoint) OnConnected(c ws.Speaker) {
 		gremlinFilter = c.GetURL().Query().Get("x-gremlin-filter")
 	}
 
-	if gremlinFilter != "" {
-		host := c.GetRemoteHost()
+	host := c.GetRemoteHost()
+
+	scope, err := NewTopologyScope(t.gremlinParser, c.GetUsername())
+	if err != nil {
+		logging.GetLogger().Errorf("Closing connection of client %s: %s", host, err)
+		c.Stop()
+		return
+	}
 
-		subscriber, err := t.newSubscriber(host, gremlinFilter, false)
+	if gremlinFilter != "" || scope != nil {
+		subscriber, err := t.newSubscriber(host, gremlinFilter, scope, false)
 		if err != nil {
 			logging.GetLogger().Error(err)
+			if scope != nil {
+				c.Stop()
+			}
 			return
 		}
 
 		logging.GetLogger().Infof("Client %s subscribed with filter %s during the connection", host, gremlinFilter)
+		t.Lock()
 		t.subscribers[c] = subscriber
+		t.Unlock()
 	}
 }
 
@@ -120,6 +225,10 @@ func (t *SubscriberEndpoint) OnStructMessage(c ws.Speaker, msg *ws.StructMessage
 		defer t.Graph.RUnlock()
 
 		syncMsg, status := obj.(*gws.SyncRequestMsg), http.StatusOK
+		if t.replay(c, msg, syncMsg) {
+			return
+		}
+
 		result, err := t.Graph.CloneWithContext(syncMsg.Context)
 		if err != nil {
 			logging.GetLogger().Errorf("unable to get a graph with context %+v: %s", syncMsg, err)
@@ -130,14 +239,33 @@ func (t *SubscriberEndpoint) OnStructMessage(c ws.Speaker, msg *ws.StructMessage
 
 		host := c.GetRemoteHost()
 
-		if syncMsg.GremlinFilter != nil {
+		// the subscribers restricted to a topology scope are always filtered
+		scope, err := NewTopologyScope(t.gremlinParser, c.GetUsername())
+		if err != nil {
+			logging.GetLogger().Error(err)
+			c.SendMessage(msg.Reply(err.Error(), gws.SyncReplyMsgType, http.StatusForbidden))
+			return
+		}
+
+		if syncMsg.GremlinFilter != nil || scope != nil {
+			t.RLock()
+			subscriber := t.subscribers[c]
+			t.RUnlock()
+
+			var gremlinFilter string
+			if syncMsg.GremlinFilter != nil {
+				gremlinFilter = *syncMsg.GremlinFilter
+			} else if subscriber != nil {
+				gremlinFilter = subscriber.gremlinFilter
+			}
+
 			// filter reset
-			if *syncMsg.GremlinFilter == "" {
+			if gremlinFilter == "" && scope == nil {
 				t.Lock()
 				delete(t.subscribers, c)
 				t.Unlock()
 			} else {
-				subscriber, err := t.newSubscriber(host, *syncMsg.GremlinFilter, false)
+				subscriber, err := t.newSubscriber(host, gremlinFilter, scope, false)
 				if err != nil {
 					logging.GetLogger().Error(err)
 
@@ -151,7 +279,7 @@ func (t *SubscriberEndpoint) OnStructMessage(c ws.Speaker, msg *ws.StructMessage
 					return
 				}
 
-				logging.GetLogger().Infof("Client %s requested subscription with filter %s", host, *syncMsg.GremlinFilter)
+				logging.GetLogger().Infof("Client %s requested subscription with filter %s", host, gremlinFilter)
 				result = subscriber.graph
 
 				t.Lock()
@@ -165,6 +293,13 @@ func (t *SubscriberEndpoint) OnStructMessage(c ws.Speaker, msg *ws.StructMessage
 
 			if subscriber != nil {
 				result = subscriber.graph
+			} else if t.replayLog != nil && syncMsg.TimeSlice == nil {
+				// the reply is stamped with the sequence of the last message
+				// sent so that the subscriber can later resume from it
+				reply := msg.Reply(&gws.SyncMsg{Elements: result.Elements(), ReplayID: t.replayLog.ID}, gws.SyncReplyMsgType, status)
+				reply.Sequence = t.replayLog.Sequence()
+				c.SendMessage(reply)
+				return
 			}
 		}
 
@@ -175,10 +310,147 @@ func (t *SubscriberEndpoint) OnStructMessage(c ws.Speaker, msg *ws.StructMessage
 	}
 }
 
-// notifyClients forwards local graph modification to subscribers. If a subscriber
-// specified a Gremlin filter, a 'Diff' is applied between the previous graph state
+// replay sends to a reconnecting subscriber the messages it missed, if they
+// are still in the replay log. It returns false when a full synchronization
+// is required. Only the subscribers without Gremlin filter can resume as the
+// filtered messages depend on the subscriber state. The graph lock has to be
+// held so that no new message is sent in between.
+func (t *SubscriberEndpoint) replay(c ws.Speaker, msg *ws.StructMessage, syncMsg *gws.SyncRequestMsg) bool {
+	if t.replayLog == nil || syncMsg.ReplayID != t.replayLog.ID || syncMsg.Sequence == 0 {
+		return false
+	}
+
+	if syncMsg.GremlinFilter != nil || syncMsg.TimeSlice != nil {
+		return false
+	}
+
+	t.RLock()
+	_, filtered := t.subscribers[c]
+	t.RUnlock()
+
+	if filtered {
+		return false
+	}
+
+	msgs, ok := t.replayLog.Since(syncMsg.Sequence)
+	if !ok {
+		logging.GetLogger().Infof("Client %s can't resume from sequence %d, sending the whole graph", c.GetRemoteHost(), syncMsg.Sequence)
+		return false
+	}
+
+	logging.GetLogger().Infof("Client %s resumed from sequence %d, replaying %d messages", c.GetRemoteHost(), syncMsg.Sequence, len(msgs))
+
+	reply := msg.Reply(&gws.SyncMsg{ReplayID: t.replayLog.ID, Resumed: true}, gws.SyncReplyMsgType, http.StatusOK)
+	reply.Sequence = syncMsg.Sequence
+	c.SendMessage(reply)
+
+	// the messages are shared with the other subscribers, their encoding
+	// being cached, concurrent replays are serialized
+	t.replayLock.Lock()
+	for _, m := range msgs {
+		c.SendMessage(m)
+	}
+	t.replayLock.Unlock()
+
+	return true
+}
+
+// filteredMessages returns the messages to send to a subscriber with a
+// Gremlin filter, computed from the 'Diff' between the previous graph state
 // for this subscriber and the current graph state.
+func (t *SubscriberEndpoint) filteredMessages(subscriber *subscriber, typ string, i interface{}) []*ws.StructMessage {
+	g, err := t.subscriberGraph(subscriber, false)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		return nil
+	}
+
+	var msgs []*ws.StructMessage
+
+	addedNodes, removedNodes, addedEdges, removedEdges := subscriber.graph.Diff(g)
+
+	for _, n := range addedNodes {
+		msgs = append(msgs, gws.NewStructMessage(gws.NodeAddedMsgType, n))
+	}
+
+	for _, n := range removedNodes {
+		msgs = append(msgs, gws.NewStructMessage(gws.NodeDeletedMsgType, n))
+	}
+
+	for _, e := range addedEdges {
+		msgs = append(msgs, gws.NewStructMessage(gws.EdgeAddedMsgType, e))
+	}
+
+	for _, e := range removedEdges {
+		msgs = append(msgs, gws.NewStructMessage(gws.EdgeDeletedMsgType, e))
+	}
+
+	// handle updates
+	switch typ {
+	case gws.NodeUpdatedMsgType:
+		if g.GetNode(i.(*graph.Node).ID) != nil {
+			msgs = append(msgs, gws.NewStructMessage(gws.NodeUpdatedMsgType, i))
+		}
+	case gws.EdgeUpdatedMsgType:
+		if g.GetEdge(i.(*graph.Edge).ID) != nil {
+			msgs = append(msgs, gws.NewStructMessage(gws.EdgeUpdatedMsgType, i))
+		}
+	}
+
+	subscriber.graph = g
+
+	return msgs
+}
+
+// sendSSE sends a message to a server-sent events stream, the message being
+// encoded as for the JSON WebSocket clients
+func sendSSE(stream *shttp.SSEStream, msg *ws.StructMessage) {
+	data, err := msg.Bytes(ws.JSONProtocol)
+	if err != nil {
+		logging.GetLogger().Errorf("Unable to encode %s message: %s", msg.Type, err)
+		return
+	}
+	stream.Send(msg.Type, data)
+}
+
+// notifySSEClients forwards local graph modification to the server-sent
+// events subscribers, with the same filtering as for the WebSocket ones
+func (t *SubscriberEndpoint) notifySSEClients(typ string, i interface{}) {
+	t.RLock()
+	defer t.RUnlock()
+
+	// encoded once for all the unfiltered streams
+	var unfiltered *ws.StructMessage
+	for stream, subscriber := range t.sseStreams {
+		if subscriber != nil {
+			for _, msg := range t.filteredMessages(subscriber, typ, i) {
+				sendSSE(stream, msg)
+			}
+			continue
+		}
+
+		if unfiltered == nil {
+			unfiltered = gws.NewStructMessage(typ, i)
+		}
+		sendSSE(stream, unfiltered)
+	}
+}
+
+// notifyClients forwards local graph modification to subscribers. If a subscriber
+// specified a Gremlin filter, only the modifications of the filtered graph
+// are sent.
 func (t *SubscriberEndpoint) notifyClients(typ string, i interface{}) {
+	t.invalidateScopeGraphs()
+	t.notifySSEClients(typ, i)
+
+	// unfiltered message, kept in the replay log even if there is no
+	// subscriber so that a reconnecting one can get it
+	var unfiltered *ws.StructMessage
+	if t.replayLog != nil {
+		unfiltered = gws.NewStructMessage(typ, i)
+		t.replayLog.Append(unfiltered)
+	}
+
 	for _, c := range t.pool.GetSpeakers() {
 		t.RLock()
 		subscriber, found := t.subscribers[c]
@@ -190,45 +462,14 @@ func (t *SubscriberEndpoint) notifyClients(typ string, i interface{}) {
 				return
 			}
 
-			g, err := t.getGraph(subscriber.gremlinFilter, subscriber.ts, false)
-			if err != nil {
-				logging.GetLogger().Error(err)
-				continue
-			}
-
-			addedNodes, removedNodes, addedEdges, removedEdges := subscriber.graph.Diff(g)
-
-			for _, n := range addedNodes {
-				c.SendMessage(gws.NewStructMessage(gws.NodeAddedMsgType, n))
-			}
-
-			for _, n := range removedNodes {
-				c.SendMessage(gws.NewStructMessage(gws.NodeDeletedMsgType, n))
+			for _, msg := range t.filteredMessages(subscriber, typ, i) {
+				c.SendMessage(msg)
 			}
-
-			for _, e := range addedEdges {
-				c.SendMessage(gws.NewStructMessage(gws.EdgeAddedMsgType, e))
-			}
-
-			for _, e := range removedEdges {
-				c.SendMessage(gws.NewStructMessage(gws.EdgeDeletedMsgType, e))
-			}
-
-			// handle updates
-			switch typ {
-			case gws.NodeUpdatedMsgType:
-				if g.GetNode(i.(*graph.Node).ID) != nil {
-					c.SendMessage(gws.NewStructMessage(gws.NodeUpdatedMsgType, i))
-				}
-			case gws.EdgeUpdatedMsgType:
-				if g.GetEdge(i.(*graph.Edge).ID) != nil {
-					c.SendMessage(gws.NewStructMessage(gws.EdgeUpdatedMsgType, i))
-				}
-			}
-
-			subscriber.graph = g
 		} else {
-			c.SendMessage(gws.NewStructMessage(typ, i))
+			if unfiltered == nil {
+				unfiltered = gws.NewStructMessage(typ, i)
+			}
+			c.SendMessage(unfiltered)
 		}
 	}
 }
@@ -263,6 +504,104 @@ func (t *SubscriberEndpoint) OnEdgeDeleted(e *graph.Edge) {
 	t.notifyClients(gws.EdgeDeletedMsgType, e)
 }
 
+// serveSSE streams the graph modifications as server-sent events. As with
+// the WebSocket subscribers, the graph can be filtered by a Gremlin query
+// given with the X-Gremlin-Filter header or the x-gremlin-filter parameter.
+// The first event is a SyncReply holding the current (filtered) graph.
+func (t *SubscriberEndpoint) serveSSE(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "sse", t.sseEndpoint) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	gremlinFilter := r.Header.Get("X-Gremlin-Filter")
+	if gremlinFilter == "" {
+		gremlinFilter = r.URL.Query().Get("x-gremlin-filter")
+	}
+
+	stream := shttp.NewSSEStream(t.sseQueueSize)
+
+	scope, err := NewTopologyScope(t.gremlinParser, r.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	t.Graph.RLock()
+
+	var subscriber *subscriber
+	result := t.Graph
+	if gremlinFilter != "" || scope != nil {
+		if subscriber, err = t.newSubscriber(r.RemoteAddr, gremlinFilter, scope, false); err != nil {
+			t.Graph.RUnlock()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result = subscriber.graph
+	}
+	sendSSE(stream, gws.NewStructMessage(gws.SyncReplyMsgType, result))
+
+	t.Lock()
+	t.sseStreams[stream] = subscriber
+	t.Unlock()
+
+	t.Graph.RUnlock()
+
+	logging.GetLogger().Infof("SSE client %s subscribed with filter '%s'", r.RemoteAddr, gremlinFilter)
+
+	if err := stream.Serve(w, &r.Request, sseKeepAlive); err != nil {
+		logging.GetLogger().Errorf("SSE stream of %s closed: %s", r.RemoteAddr, err)
+	}
+
+	t.Lock()
+	delete(t.sseStreams, stream)
+	t.Unlock()
+}
+
+// RegisterSSEEndpoint serves the graph modifications as server-sent events
+// on the given endpoint, for the clients that can't use WebSockets
+func (t *SubscriberEndpoint) RegisterSSEEndpoint(server *shttp.Server, endpoint string, authBackend shttp.AuthenticationBackend, queueSize int) {
+	t.sseEndpoint = endpoint
+	t.sseQueueSize = queueSize
+	server.HandleFunc(endpoint, t.serveSSE, authBackend)
+}
+
+// EnableReplayLog keeps the last size messages sent to the subscribers so
+// that a reconnecting one can resume from the last message it handled
+func (t *SubscriberEndpoint) EnableReplayLog(size int) {
+	t.Graph.Lock()
+	t.replayLog = ws.NewReplayLog(size)
+	t.Graph.Unlock()
+}
+
+// ReplayLogState returns the state of the replay log, nil if disabled
+func (t *SubscriberEndpoint) ReplayLogState() (*ws.ReplayLogState, error) {
+	t.Graph.RLock()
+	defer t.Graph.RUnlock()
+
+	if t.replayLog == nil {
+		return nil, nil
+	}
+
+	t.replayLock.Lock()
+	defer t.replayLock.Unlock()
+
+	return t.replayLog.State()
+}
+
+// RestoreReplayLog restores the replay log of a previous instance so that
+// its subscribers can resume from their last sequence
+func (t *SubscriberEndpoint) RestoreReplayLog(state *ws.ReplayLogState) error {
+	t.Graph.Lock()
+	defer t.Graph.Unlock()
+
+	if t.replayLog == nil {
+		return nil
+	}
+
+	return t.replayLog.Restore(state)
+}
+
 // NewSubscriberEndpoint returns a new server to be used by external subscribers,
 // for instance the WebUI.
 func NewSubscriberEndpoint(pool ws.StructSpeakerPool, g *graph.Graph, tr *traversal.GremlinTraversalParser) *SubscriberEndpoint {
@@ -270,9 +609,13 @@ func NewSubscriberEndpoint(pool ws.StructSpeakerPool, g *graph.Graph, tr *traver
 		Graph:         g,
 		pool:          pool,
 		subscribers:   make(map[ws.Speaker]*subscriber),
+		sseStreams:    make(map[*shttp.SSEStream]*subscriber),
 		gremlinParser: tr,
+		scopeGraphs:   make(map[string]*graph.Graph),
 	}
 
+	rbac.AddPolicyReloadHandler(t.onPolicyReload)
+
 	pool.AddEventHandler(t)
 
 	// subscribe to the graph messages
@@ -0,0 +1,181 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graph
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+// MetadataChange describes the change of a metadata key of a graph element
+type MetadataChange struct {
+	Key  string
+	From interface{} `json:",omitempty"`
+	To   interface{} `json:",omitempty"`
+}
+
+// NodeUpdate describes a node whose metadata changed
+type NodeUpdate struct {
+	Node    *Node
+	Changes []MetadataChange
+}
+
+// EdgeUpdate describes an edge whose metadata changed
+type EdgeUpdate struct {
+	Edge    *Edge
+	Changes []MetadataChange
+}
+
+// GraphDiff describes the differences between two states of a graph
+type GraphDiff struct {
+	AddedNodes   []*Node
+	RemovedNodes []*Node
+	UpdatedNodes []*NodeUpdate
+	AddedEdges   []*Edge
+	RemovedEdges []*Edge
+	UpdatedEdges []*EdgeUpdate
+}
+
+func diffMetadata(from, to Metadata, ignored map[string]bool) (changes []MetadataChange) {
+	keys := make(map[string]bool)
+	for k := range from {
+		keys[k] = true
+	}
+	for k := range to {
+		keys[k] = true
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		if !ignored[k] {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		if !reflect.DeepEqual(from[k], to[k]) {
+			changes = append(changes, MetadataChange{Key: k, From: from[k], To: to[k]})
+		}
+	}
+
+	return
+}
+
+// DiffMetadata returns the changes of the metadata keys between from and to,
+// sorted by key. Changes of the ignored keys are not reported.
+func DiffMetadata(from, to Metadata, ignored ...string) []MetadataChange {
+	ignoredKeys := make(map[string]bool, len(ignored))
+	for _, k := range ignored {
+		ignoredKeys[k] = true
+	}
+	return diffMetadata(from, to, ignoredKeys)
+}
+
+// matchDiffNode returns whether the node or its metadata match m, as the
+// diff filters are metadata filters
+func matchDiffNode(n *Node, m ElementMatcher) bool {
+	return m == nil || m.Match(n) || m.Match(n.Metadata)
+}
+
+// ComputeDiff returns the nodes matching m, either by their fields or by
+// their metadata, that were added, removed or updated between the from and
+// to graphs, along with the edges having one of these nodes as parent or
+// child. Changes of the ignored metadata keys are not reported.
+func ComputeDiff(from, to *Graph, m ElementMatcher, ignored ...string) *GraphDiff {
+	diff := &GraphDiff{}
+
+	ignoredKeys := make(map[string]bool, len(ignored))
+	for _, k := range ignored {
+		ignoredKeys[k] = true
+	}
+
+	fromNodes := make(map[Identifier]*Node)
+	for _, n := range from.GetNodes(nil) {
+		if matchDiffNode(n, m) {
+			fromNodes[n.ID] = n
+		}
+	}
+
+	toNodes := make(map[Identifier]*Node)
+	for _, n := range to.GetNodes(nil) {
+		if !matchDiffNode(n, m) {
+			continue
+		}
+		toNodes[n.ID] = n
+
+		old, found := fromNodes[n.ID]
+		if !found {
+			diff.AddedNodes = append(diff.AddedNodes, n)
+		} else if changes := diffMetadata(old.Metadata, n.Metadata, ignoredKeys); len(changes) > 0 {
+			diff.UpdatedNodes = append(diff.UpdatedNodes, &NodeUpdate{Node: n, Changes: changes})
+		}
+	}
+
+	for id, n := range fromNodes {
+		if _, found := toNodes[id]; !found {
+			diff.RemovedNodes = append(diff.RemovedNodes, n)
+		}
+	}
+	SortNodes(diff.RemovedNodes, "CreatedAt", common.SortAscending)
+
+	matchEdge := func(e *Edge) bool {
+		if m == nil {
+			return true
+		}
+		for _, id := range []Identifier{e.Parent, e.Child} {
+			if fromNodes[id] != nil || toNodes[id] != nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	fromEdges := make(map[Identifier]*Edge)
+	for _, e := range from.GetEdges(nil) {
+		if matchEdge(e) {
+			fromEdges[e.ID] = e
+		}
+	}
+
+	toEdges := make(map[Identifier]*Edge)
+	for _, e := range to.GetEdges(nil) {
+		if !matchEdge(e) {
+			continue
+		}
+		toEdges[e.ID] = e
+
+		old, found := fromEdges[e.ID]
+		if !found {
+			diff.AddedEdges = append(diff.AddedEdges, e)
+		} else if changes := diffMetadata(old.Metadata, e.Metadata, ignoredKeys); len(changes) > 0 {
+			diff.UpdatedEdges = append(diff.UpdatedEdges, &EdgeUpdate{Edge: e, Changes: changes})
+		}
+	}
+
+	for id, e := range fromEdges {
+		if _, found := toEdges[id]; !found {
+			diff.RemovedEdges = append(diff.RemovedEdges, e)
+		}
+	}
+	SortEdges(diff.RemovedEdges, "CreatedAt", common.SortAscending)
+
+	return diff
+}
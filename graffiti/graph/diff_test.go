@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graph
+
+import (
+	"testing"
+)
+
+func TestComputeDiff(t *testing.T) {
+	from, to := newGraph(t), newGraph(t)
+
+	for _, g := range []*Graph{from, to} {
+		n1, _ := g.NewNode("n1", Metadata{"Host": "h1", "MTU": 1500})
+		n2, _ := g.NewNode("n2", Metadata{"Host": "h1"})
+		g.NewNode("n3", Metadata{"Host": "h2"})
+		g.NewEdge("e1", n1, n2, Metadata{"RelationType": "layer2"})
+	}
+
+	// changes on h1
+	to.AddMetadata(to.GetNode("n1"), "MTU", 9000)
+	to.DelNode(to.GetNode("n2"))
+	n4, _ := to.NewNode("n4", Metadata{"Host": "h1"})
+	to.NewEdge("e2", to.GetNode("n1"), n4, Metadata{"RelationType": "ownership"})
+
+	// changes on h2 that must be filtered out
+	to.AddMetadata(to.GetNode("n3"), "MTU", 9000)
+	to.NewNode("n5", Metadata{"Host": "h2"})
+
+	diff := ComputeDiff(from, to, Metadata{"Host": "h1"})
+
+	if len(diff.AddedNodes) != 1 || diff.AddedNodes[0].ID != "n4" {
+		t.Errorf("Expected n4 to be added, got %+v", diff.AddedNodes)
+	}
+
+	if len(diff.RemovedNodes) != 1 || diff.RemovedNodes[0].ID != "n2" {
+		t.Errorf("Expected n2 to be removed, got %+v", diff.RemovedNodes)
+	}
+
+	if len(diff.UpdatedNodes) != 1 || diff.UpdatedNodes[0].Node.ID != "n1" {
+		t.Fatalf("Expected n1 to be updated, got %+v", diff.UpdatedNodes)
+	}
+
+	changes := diff.UpdatedNodes[0].Changes
+	if len(changes) != 1 || changes[0].Key != "MTU" || changes[0].From != 1500 || changes[0].To != 9000 {
+		t.Errorf("Expected MTU change of n1, got %+v", changes)
+	}
+
+	if len(diff.AddedEdges) != 1 || diff.AddedEdges[0].ID != "e2" {
+		t.Errorf("Expected e2 to be added, got %+v", diff.AddedEdges)
+	}
+
+	if len(diff.RemovedEdges) != 1 || diff.RemovedEdges[0].ID != "e1" {
+		t.Errorf("Expected e1 to be removed, got %+v", diff.RemovedEdges)
+	}
+
+	if diff = ComputeDiff(from, to, Metadata{"Host": "h1"}, "MTU"); len(diff.UpdatedNodes) != 0 {
+		t.Errorf("Expected MTU changes to be ignored, got %+v", diff.UpdatedNodes)
+	}
+}
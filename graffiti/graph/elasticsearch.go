@@ -22,6 +22,7 @@ package graph
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/olivere/elastic"
 
@@ -517,6 +518,146 @@ func (b *ElasticSearchBackend) flushGraph() error {
 	return b.client.UpdateByScript("graph_element", query, script, b.liveIndex.Alias(), b.archiveIndex.IndexWildcard())
 }
 
+func (b *ElasticSearchBackend) searchArchive(filter *filters.Filter, size int) ([]archivedRevision, error) {
+	query := filters.SearchQuery{
+		Sort:            true,
+		SortBy:          "ArchivedAt",
+		PaginationRange: &filters.Range{From: 0, To: int64(size)},
+	}
+
+	out, err := b.client.Search("graph_element", es.FormatFilter(filter, ""), query, b.archiveIndex.IndexWildcard())
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []archivedRevision
+	if out != nil && out.Hits != nil {
+		for _, d := range out.Hits.Hits {
+			var revision archivedRevision
+			if err := json.Unmarshal(*d.Source, &revision); err != nil {
+				logging.GetLogger().Errorf("Failed to unmarshal archived revision %s: %s", string(*d.Source), err)
+				continue
+			}
+			revisions = append(revisions, revision)
+		}
+	}
+
+	return revisions, nil
+}
+
+func (b *ElasticSearchBackend) oldestArchive() (int64, error) {
+	revisions, err := b.searchArchive(filters.NewNotNullFilter("ArchivedAt"), 1)
+	if err != nil || len(revisions) == 0 {
+		return 0, err
+	}
+	return revisions[0].ArchivedAt, nil
+}
+
+func (b *ElasticSearchBackend) compactHistory(from, to int64) (int, int64, error) {
+	window := filters.NewAndFilter(
+		filters.NewGteInt64Filter("ArchivedAt", from),
+		filters.NewLtInt64Filter("ArchivedAt", to),
+	)
+
+	revisions, err := b.searchArchive(window, compactionBatchSize)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var next int64
+	if len(revisions) == compactionBatchSize {
+		next = revisions[len(revisions)-1].ArchivedAt
+	}
+
+	compactions, removed := compactRevisions(revisions)
+	if len(compactions) == 0 {
+		return 0, next, nil
+	}
+
+	kept := make([]*filters.Filter, len(compactions))
+	merged := make([]*filters.Filter, len(compactions))
+	since := make(map[string]interface{}, len(compactions))
+	for i, c := range compactions {
+		kept[i] = filters.NewAndFilter(
+			filters.NewTermStringFilter("ID", c.ID),
+			filters.NewTermInt64Filter("Revision", c.Revision),
+		)
+		merged[i] = filters.NewAndFilter(
+			filters.NewTermStringFilter("ID", c.ID),
+			filters.NewLtInt64Filter("Revision", c.Revision),
+		)
+		since[c.ID] = c.UpdatedAt
+	}
+
+	// extend the kept revisions first so that the history stays consistent
+	// if the deletion fails
+	script := elastic.NewScript("ctx._source.UpdatedAt = params.since[ctx._source.ID];")
+	script.Lang("painless")
+	script.Params(map[string]interface{}{"since": since})
+
+	if err := b.client.UpdateByScript("graph_element", es.FormatFilter(filters.NewOrFilter(kept...), ""), script, b.archiveIndex.IndexWildcard()); err != nil {
+		return 0, 0, err
+	}
+
+	query := es.FormatFilter(filters.NewAndFilter(window, filters.NewOrFilter(merged...)), "")
+	if err := b.client.DeleteByQuery("graph_element", query, b.archiveIndex.IndexWildcard()); err != nil {
+		return 0, 0, err
+	}
+
+	return removed, next, nil
+}
+
+func (b *ElasticSearchBackend) purgeHistory(before int64) error {
+	query := es.FormatFilter(filters.NewLtInt64Filter("ArchivedAt", before), "")
+	return b.client.DeleteByQuery("graph_element", query, b.archiveIndex.IndexWildcard())
+}
+
+func metadataFieldMapping(fieldType, hint string) map[string]interface{} {
+	var mapping map[string]interface{}
+	switch fieldType {
+	case "string":
+		if hint == "text" {
+			mapping = map[string]interface{}{"type": "text"}
+		} else {
+			mapping = map[string]interface{}{"type": "keyword"}
+		}
+	case "integer":
+		mapping = map[string]interface{}{"type": "long"}
+	case "number":
+		mapping = map[string]interface{}{"type": "double"}
+	case "boolean":
+		mapping = map[string]interface{}{"type": "boolean"}
+	default:
+		return nil
+	}
+
+	if hint == "none" {
+		mapping["index"] = false
+	}
+	return mapping
+}
+
+// IndexMetadataField adds the metadata field to the mapping of the live and
+// archive indices. Objects and arrays are left to the dynamic templates.
+func (b *ElasticSearchBackend) IndexMetadataField(name string, fieldType string, hint string) error {
+	mapping := metadataFieldMapping(fieldType, hint)
+	if mapping == nil {
+		return nil
+	}
+
+	keys := strings.Split(name, ".")
+	for i := len(keys) - 1; i >= 0; i-- {
+		mapping = map[string]interface{}{
+			"properties": map[string]interface{}{keys[i]: mapping},
+		}
+	}
+	mapping = map[string]interface{}{
+		"properties": map[string]interface{}{"Metadata": mapping},
+	}
+
+	return b.client.PutMapping("graph_element", mapping, b.liveIndex.Alias(), b.archiveIndex.IndexWildcard())
+}
+
 // OnStarted implements storage client listener interface
 func (b *ElasticSearchBackend) OnStarted() {
 	if b.election != nil && b.election.IsMaster() {
@@ -547,8 +688,9 @@ func newElasticSearchBackendFromClient(client es.ClientInterface, liveIndex, arc
 	return c, nil
 }
 
-// NewElasticSearchBackendFromConfig creates a new graph backend from an ES configuration structure
-func NewElasticSearchBackendFromConfig(cfg es.Config, extraDynamicTemplates map[string]interface{}, electionService common.MasterElectionService) (*ElasticSearchBackend, error) {
+// NewElasticSearchBackendFromConfig creates a new graph backend from an ES configuration structure.
+// The history of the graph is compacted and purged according to the retention policy.
+func NewElasticSearchBackendFromConfig(cfg es.Config, extraDynamicTemplates map[string]interface{}, retention RetentionPolicy, electionService common.MasterElectionService) (*ElasticSearchBackend, error) {
 	mapping := make(map[string]interface{})
 	if err := json.Unmarshal([]byte(graphElementMapping), &mapping); err != nil {
 		return nil, err
@@ -590,5 +732,12 @@ func NewElasticSearchBackendFromConfig(cfg es.Config, extraDynamicTemplates map[
 		return nil, err
 	}
 
-	return newElasticSearchBackendFromClient(client, liveIndex, archiveIndex, electionService)
+	backend, err := newElasticSearchBackendFromClient(client, liveIndex, archiveIndex, electionService)
+	if err != nil {
+		return nil, err
+	}
+
+	startHistoryRetention("es-graph-retention", retention, backend, electionService)
+
+	return backend, nil
 }
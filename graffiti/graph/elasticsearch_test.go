@@ -91,6 +91,12 @@ func (f *fakeESClient) AddEventListener(l storage.EventListener) {
 func (f *fakeESClient) UpdateByScript(typ string, query elastic.Query, script *elastic.Script, indices ...string) error {
 	return nil
 }
+func (f *fakeESClient) DeleteByQuery(typ string, query elastic.Query, indices ...string) error {
+	return nil
+}
+func (f *fakeESClient) PutMapping(typ string, mapping map[string]interface{}, indices ...string) error {
+	return nil
+}
 
 func newElasticsearchGraph(t *testing.T) (*Graph, *fakeESClient) {
 	client := &fakeESClient{
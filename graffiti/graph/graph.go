@@ -118,10 +118,20 @@ type Backend interface {
 	IsHistorySupported() bool
 }
 
+// MetadataFieldIndexer is implemented by the backends able to index
+// declared metadata fields according to their type. The hint
+// tells how string fields should be indexed: keyword, text or none.
+type MetadataFieldIndexer interface {
+	IndexMetadataField(name string, fieldType string, hint string) error
+}
+
 // Context describes within time slice
 type Context struct {
 	TimeSlice *common.TimeSlice
 	TimePoint bool
+	// Scoped is set on the graphs restricted to the elements a user can
+	// access, only the flows of their nodes have then to be returned
+	Scoped bool `json:"-"`
 }
 
 var liveContext = Context{TimePoint: true}
@@ -35,6 +35,17 @@ type OrientDBBackend struct {
 	election common.MasterElection
 }
 
+// orientDBArchiveClasses lists the classes holding the revisions of the graph
+// elements. Links come first as node revisions still anchoring a link can't
+// be removed.
+var orientDBArchiveClasses = []struct {
+	name   string
+	delete string
+}{
+	{name: "Link", delete: "DELETE EDGE Link WHERE %s"},
+	{name: "Node", delete: "DELETE VERTEX Node WHERE %s AND bothE().size() = 0"},
+}
+
 type eventTime struct {
 	name string
 	t    Time
@@ -341,6 +352,111 @@ func (o *OrientDBBackend) flushGraph() error {
 	return nil
 }
 
+// sqlCount runs a command and returns the number of records it affected
+func (o *OrientDBBackend) sqlCount(query string) (int, error) {
+	result, err := o.client.SQL(query)
+	if err != nil {
+		return 0, err
+	}
+
+	values := struct {
+		Result []map[string]interface{}
+	}{}
+
+	if err := json.Unmarshal(result.Body, &values); err != nil {
+		return 0, fmt.Errorf("Error while parsing result: %s, %s", err, string(result.Body))
+	}
+	if len(values.Result) == 0 {
+		return 0, nil
+	}
+
+	count, ok := values.Result[0]["count"]
+	if !ok {
+		count = values.Result[0]["value"]
+	}
+
+	f, _ := count.(float64)
+	return int(f), nil
+}
+
+func (o *OrientDBBackend) searchArchive(class string, where string, limit int) ([]archivedRevision, error) {
+	query := fmt.Sprintf("SELECT ID, Revision, UpdatedAt, ArchivedAt FROM %s WHERE %s ORDER BY ArchivedAt LIMIT %d", class, where, limit)
+	result, err := o.client.SQL(query)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := struct {
+		Result []archivedRevision
+	}{}
+
+	if err := json.Unmarshal(result.Body, &revisions); err != nil {
+		return nil, fmt.Errorf("Error while parsing revisions: %s, %s", err, string(result.Body))
+	}
+
+	return revisions.Result, nil
+}
+
+func (o *OrientDBBackend) oldestArchive() (oldest int64, _ error) {
+	for _, class := range orientDBArchiveClasses {
+		revisions, err := o.searchArchive(class.name, "ArchivedAt IS NOT NULL", 1)
+		if err != nil {
+			return 0, err
+		}
+
+		if len(revisions) > 0 && (oldest == 0 || revisions[0].ArchivedAt < oldest) {
+			oldest = revisions[0].ArchivedAt
+		}
+	}
+
+	return oldest, nil
+}
+
+func (o *OrientDBBackend) compactHistory(from, to int64) (removed int, next int64, _ error) {
+	window := fmt.Sprintf("ArchivedAt >= %d AND ArchivedAt < %d", from, to)
+
+	for _, class := range orientDBArchiveClasses {
+		revisions, err := o.searchArchive(class.name, window, compactionBatchSize)
+		if err != nil {
+			return removed, 0, err
+		}
+
+		if len(revisions) == compactionBatchSize {
+			if last := revisions[len(revisions)-1].ArchivedAt; next == 0 || last < next {
+				next = last
+			}
+		}
+
+		compactions, _ := compactRevisions(revisions)
+		for _, c := range compactions {
+			query := fmt.Sprintf("UPDATE %s SET UpdatedAt = %d WHERE ID = '%s' AND Revision = %d", class.name, c.UpdatedAt, c.ID, c.Revision)
+			if _, err := o.client.SQL(query); err != nil {
+				return removed, 0, fmt.Errorf("Error while compacting %s: %s", c.ID, err)
+			}
+
+			where := fmt.Sprintf("ID = '%s' AND %s AND Revision < %d", c.ID, window, c.Revision)
+			count, err := o.sqlCount(fmt.Sprintf(class.delete, where))
+			if err != nil {
+				return removed, 0, fmt.Errorf("Error while compacting %s: %s", c.ID, err)
+			}
+			removed += count
+		}
+	}
+
+	return removed, next, nil
+}
+
+func (o *OrientDBBackend) purgeHistory(before int64) error {
+	for _, class := range orientDBArchiveClasses {
+		query := fmt.Sprintf(class.delete, fmt.Sprintf("ArchivedAt < %d", before))
+		if _, err := o.client.SQL(query); err != nil {
+			return fmt.Errorf("Error while purging %s history: %s", class.name, err)
+		}
+	}
+
+	return nil
+}
+
 // OnStarted implements storage client listener interface
 func (o *OrientDBBackend) OnStarted() {
 	if o.election != nil && o.election.IsMaster() {
@@ -419,12 +535,20 @@ func newOrientDBBackend(client orientdb.ClientInterface, electionService common.
 }
 
 // NewOrientDBBackend creates a new graph backend and
-// connect to an OrientDB instance
-func NewOrientDBBackend(addr string, database string, username string, password string, electionService common.MasterElectionService) (*OrientDBBackend, error) {
+// connect to an OrientDB instance. The history of the graph
+// is compacted and purged according to the retention policy.
+func NewOrientDBBackend(addr string, database string, username string, password string, retention RetentionPolicy, electionService common.MasterElectionService) (*OrientDBBackend, error) {
 	client, err := orientdb.NewClient(addr, database, username, password)
 	if err != nil {
 		return nil, err
 	}
 
-	return newOrientDBBackend(client, electionService)
+	backend, err := newOrientDBBackend(client, electionService)
+	if err != nil {
+		return nil, err
+	}
+
+	startHistoryRetention("orientdb-graph-retention", retention, backend, electionService)
+
+	return backend, nil
 }
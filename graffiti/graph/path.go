@@ -0,0 +1,308 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graph
+
+import (
+	"container/heap"
+	"encoding/json"
+	"strings"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+// MaxPaths is the maximum number of paths returned by LookupAllPaths
+const MaxPaths = 10000
+
+// Path describes a path between two nodes, with the edges linking them and
+// the sum of the weights of these edges
+type Path struct {
+	Nodes  []*Node
+	Edges  []*Edge
+	Weight float64
+}
+
+func (p *Path) key() string {
+	ids := make([]string, len(p.Nodes))
+	for i, n := range p.Nodes {
+		ids[i] = string(n.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+// edgeWeight returns the weight of an edge, stored in the weightField
+// metadata. Edges without a valid weight count as 1.
+func edgeWeight(e *Edge, weightField string) float64 {
+	if weightField == "" {
+		return 1
+	}
+
+	value, err := e.Metadata.GetField(weightField)
+	if err != nil {
+		return 1
+	}
+
+	var weight float64
+	switch v := value.(type) {
+	case float64:
+		weight = v
+	case float32:
+		weight = float64(v)
+	case json.Number:
+		if weight, err = v.Float64(); err != nil {
+			return 1
+		}
+	default:
+		i, err := common.ToInt64(value)
+		if err != nil {
+			return 1
+		}
+		weight = float64(i)
+	}
+
+	if weight < 0 {
+		return 1
+	}
+	return weight
+}
+
+// neighbor returns the other end of an edge
+func (g *Graph) neighbor(n *Node, e *Edge) *Node {
+	if e.Parent == n.ID {
+		return g.GetNode(e.Child)
+	}
+	return g.GetNode(e.Parent)
+}
+
+type pathItem struct {
+	node     *Node
+	distance float64
+	index    int
+}
+
+type pathQueue []*pathItem
+
+func (q pathQueue) Len() int           { return len(q) }
+func (q pathQueue) Less(i, j int) bool { return q[i].distance < q[j].distance }
+func (q pathQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+
+func (q *pathQueue) Push(x interface{}) {
+	item := x.(*pathItem)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *pathQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// dijkstra returns the lightest path from the source node to the first
+// node matching m, ignoring the excluded nodes and edges
+func (g *Graph) dijkstra(source *Node, m ElementMatcher, em ElementMatcher, weightField string, excludedNodes, excludedEdges map[Identifier]bool) *Path {
+	distance := map[Identifier]float64{source.ID: 0}
+	previous := make(map[Identifier]*Edge)
+	nodes := map[Identifier]*Node{source.ID: source}
+	visited := make(map[Identifier]bool)
+
+	queue := &pathQueue{{node: source}}
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(*pathItem)
+		u := item.node
+		if visited[u.ID] {
+			continue
+		}
+		visited[u.ID] = true
+
+		if u.ID != source.ID && u.MatchMetadata(m) {
+			path := &Path{Weight: distance[u.ID]}
+			for id := u.ID; id != source.ID; {
+				e := previous[id]
+				path.Nodes = append([]*Node{nodes[id]}, path.Nodes...)
+				path.Edges = append([]*Edge{e}, path.Edges...)
+				if e.Parent == id {
+					id = e.Child
+				} else {
+					id = e.Parent
+				}
+			}
+			path.Nodes = append([]*Node{source}, path.Nodes...)
+			return path
+		}
+
+		for _, e := range g.backend.GetNodeEdges(u, g.context, em) {
+			if excludedEdges[e.ID] {
+				continue
+			}
+
+			v := g.neighbor(u, e)
+			if v == nil || visited[v.ID] || excludedNodes[v.ID] {
+				continue
+			}
+
+			alt := distance[u.ID] + edgeWeight(e, weightField)
+			if d, ok := distance[v.ID]; !ok || alt < d {
+				distance[v.ID] = alt
+				previous[v.ID] = e
+				nodes[v.ID] = v
+				heap.Push(queue, &pathItem{node: v, distance: alt})
+			}
+		}
+	}
+
+	return nil
+}
+
+// LookupWeightedShortestPath returns the path from n to the closest other
+// node matching m, the distance being the sum of the weightField metadata of
+// the edges, or their number when no weight field is given. Edges are
+// followed in both directions and filtered by em.
+func (g *Graph) LookupWeightedShortestPath(n *Node, m ElementMatcher, em ElementMatcher, weightField string) *Path {
+	return g.dijkstra(n, m, em, weightField, nil, nil)
+}
+
+// LookupKShortestPaths returns up to k loopless paths from n to the nodes
+// matching m, ordered by weight, using the Yen algorithm
+func (g *Graph) LookupKShortestPaths(n *Node, m ElementMatcher, em ElementMatcher, weightField string, k int) []*Path {
+	first := g.dijkstra(n, m, em, weightField, nil, nil)
+	if first == nil || k <= 0 {
+		return nil
+	}
+
+	paths := []*Path{first}
+	known := map[string]bool{first.key(): true}
+	var candidates []*Path
+
+	for len(paths) < k {
+		last := paths[len(paths)-1]
+
+		for i := 0; i < len(last.Nodes)-1; i++ {
+			spurNode := last.Nodes[i]
+			rootNodes, rootEdges := last.Nodes[:i+1], last.Edges[:i]
+
+			// remove the edges used by the known paths sharing this root
+			excludedEdges := make(map[Identifier]bool)
+			for _, p := range paths {
+				if len(p.Nodes) > i+1 && samePrefix(p.Nodes, rootNodes) {
+					excludedEdges[p.Edges[i].ID] = true
+				}
+			}
+
+			excludedNodes := make(map[Identifier]bool)
+			for _, rn := range rootNodes[:i] {
+				excludedNodes[rn.ID] = true
+			}
+
+			spur := g.dijkstra(spurNode, m, em, weightField, excludedNodes, excludedEdges)
+			if spur == nil {
+				continue
+			}
+
+			candidate := &Path{
+				Nodes:  append(append([]*Node{}, rootNodes...), spur.Nodes[1:]...),
+				Edges:  append(append([]*Edge{}, rootEdges...), spur.Edges...),
+				Weight: spur.Weight,
+			}
+			for _, e := range rootEdges {
+				candidate.Weight += edgeWeight(e, weightField)
+			}
+
+			if key := candidate.key(); !known[key] {
+				known[key] = true
+				candidates = append(candidates, candidate)
+			}
+		}
+
+		if len(candidates) == 0 {
+			break
+		}
+
+		best := 0
+		for i, c := range candidates {
+			if c.Weight < candidates[best].Weight {
+				best = i
+			}
+		}
+		paths = append(paths, candidates[best])
+		candidates = append(candidates[:best], candidates[best+1:]...)
+	}
+
+	return paths
+}
+
+func samePrefix(nodes, prefix []*Node) bool {
+	for i, n := range prefix {
+		if nodes[i].ID != n.ID {
+			return false
+		}
+	}
+	return true
+}
+
+// LookupAllPaths returns the loopless paths of at most maxDepth edges from
+// n to the nodes matching m. The search stops after MaxPaths paths.
+func (g *Graph) LookupAllPaths(n *Node, m ElementMatcher, em ElementMatcher, maxDepth int) []*Path {
+	var paths []*Path
+
+	onPath := map[Identifier]bool{n.ID: true}
+	current := &Path{Nodes: []*Node{n}}
+
+	var walk func(u *Node)
+	walk = func(u *Node) {
+		if len(paths) >= MaxPaths {
+			return
+		}
+
+		if u.ID != n.ID && u.MatchMetadata(m) {
+			paths = append(paths, &Path{
+				Nodes:  append([]*Node{}, current.Nodes...),
+				Edges:  append([]*Edge{}, current.Edges...),
+				Weight: float64(len(current.Edges)),
+			})
+			return
+		}
+
+		if len(current.Edges) >= maxDepth {
+			return
+		}
+
+		for _, e := range g.backend.GetNodeEdges(u, g.context, em) {
+			v := g.neighbor(u, e)
+			if v == nil || onPath[v.ID] {
+				continue
+			}
+
+			onPath[v.ID] = true
+			current.Nodes = append(current.Nodes, v)
+			current.Edges = append(current.Edges, e)
+
+			walk(v)
+
+			current.Nodes = current.Nodes[:len(current.Nodes)-1]
+			current.Edges = current.Edges[:len(current.Edges)-1]
+			delete(onPath, v.ID)
+		}
+	}
+	walk(n)
+
+	return paths
+}
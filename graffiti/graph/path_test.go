@@ -0,0 +1,77 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graph
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func pathValues(p *Path) string {
+	var values []string
+	for _, n := range p.Nodes {
+		v, _ := n.GetFieldInt64("Value")
+		values = append(values, fmt.Sprintf("%d", v))
+	}
+	return strings.Join(values, "/")
+}
+
+func TestPaths(t *testing.T) {
+	g := newGraph(t)
+
+	n1, _ := g.NewNode(GenID(), Metadata{"Value": 1})
+	n2, _ := g.NewNode(GenID(), Metadata{"Value": 2})
+	n3, _ := g.NewNode(GenID(), Metadata{"Value": 3})
+	n4, _ := g.NewNode(GenID(), Metadata{"Value": 4})
+
+	g.Link(n1, n4, Metadata{"Type": "Layer3", "Weight": 10})
+	g.Link(n1, n2, Metadata{"Type": "Layer2", "Weight": 1})
+	g.Link(n2, n3, Metadata{"Type": "Layer2", "Weight": 1})
+	g.Link(n3, n4, Metadata{"Type": "Layer2", "Weight": 1})
+
+	if p := g.LookupWeightedShortestPath(n1, Metadata{"Value": 4}, nil, ""); p == nil || pathValues(p) != "1/4" {
+		t.Errorf("Wrong shortest path: %v", p)
+	}
+
+	p := g.LookupWeightedShortestPath(n1, Metadata{"Value": 4}, nil, "Weight")
+	if p == nil || pathValues(p) != "1/2/3/4" || p.Weight != 3 {
+		t.Errorf("Wrong weighted shortest path: %v", p)
+	}
+
+	if p := g.LookupWeightedShortestPath(n1, Metadata{"Value": 4}, Metadata{"Type": "Layer3"}, "Weight"); p == nil || pathValues(p) != "1/4" {
+		t.Errorf("Wrong filtered shortest path: %v", p)
+	}
+
+	if p := g.LookupWeightedShortestPath(n1, Metadata{"Value": 55}, nil, ""); p != nil {
+		t.Errorf("Shouldn't return a path: %v", p)
+	}
+
+	paths := g.LookupKShortestPaths(n1, Metadata{"Value": 4}, nil, "Weight", 3)
+	if len(paths) != 2 || pathValues(paths[0]) != "1/2/3/4" || pathValues(paths[1]) != "1/4" || paths[1].Weight != 10 {
+		t.Errorf("Wrong K shortest paths: %v", paths)
+	}
+
+	if paths := g.LookupAllPaths(n1, Metadata{"Value": 4}, nil, 3); len(paths) != 2 {
+		t.Errorf("Should return 2 paths, got: %v", paths)
+	}
+
+	if paths := g.LookupAllPaths(n1, Metadata{"Value": 4}, nil, 2); len(paths) != 1 || pathValues(paths[0]) != "1/4" {
+		t.Errorf("Should return only the direct path, got: %v", paths)
+	}
+}
@@ -0,0 +1,219 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graph
+
+import (
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/logging"
+)
+
+const (
+	dayMillis = int64(24 * time.Hour / time.Millisecond)
+
+	// compactionBatchSize is the maximum number of archived revisions
+	// compacted at once
+	compactionBatchSize = 5000
+
+	defaultCompactionInterval = time.Hour
+)
+
+// RetentionPolicy describes how long the history of the graph is kept by
+// the persistent backends. All the revisions are kept during FullHistory,
+// then only the last revision of each day is kept for every element.
+// History older than MaxAge is deleted. A zero value disables the
+// corresponding limit.
+type RetentionPolicy struct {
+	FullHistory time.Duration
+	MaxAge      time.Duration
+	Interval    time.Duration
+}
+
+// archivedRevision holds the fields of an archived revision used by the compaction
+type archivedRevision struct {
+	ID         string
+	Revision   int64
+	UpdatedAt  int64
+	ArchivedAt int64
+}
+
+// revisionCompaction describes the merge of all the revisions of an element
+// archived the same day into the last one of the day
+type revisionCompaction struct {
+	ID        string
+	Revision  int64
+	UpdatedAt int64
+}
+
+// historyCompactor is implemented by the backends able to enforce a retention policy
+type historyCompactor interface {
+	// oldestArchive returns the archive time of the oldest revision, 0 if none
+	oldestArchive() (int64, error)
+	// compactHistory compacts the first compactionBatchSize revisions
+	// archived within [from, to[. It returns the number of revisions removed
+	// and, when the batch was full, the archive time of its last revision.
+	compactHistory(from, to int64) (int, int64, error)
+	// purgeHistory removes the revisions archived before the given time
+	purgeHistory(before int64) error
+}
+
+type historyRetention struct {
+	policy         RetentionPolicy
+	compactor      historyCompactor
+	election       common.MasterElection
+	compactedUntil int64
+}
+
+// compactRevisions groups the revisions per element and per day of archive.
+// The last revision of a group is kept and extended to cover the validity of
+// the whole group, the other ones can be removed. The number of revisions to
+// remove is returned along with the compactions.
+func compactRevisions(revisions []archivedRevision) (compactions []revisionCompaction, removed int) {
+	type groupKey struct {
+		id  string
+		day int64
+	}
+
+	groups := make(map[groupKey]*revisionCompaction)
+	counts := make(map[groupKey]int)
+	var keys []groupKey
+
+	for _, revision := range revisions {
+		key := groupKey{id: revision.ID, day: revision.ArchivedAt / dayMillis}
+
+		group, found := groups[key]
+		if !found {
+			group = &revisionCompaction{ID: revision.ID, Revision: revision.Revision, UpdatedAt: revision.UpdatedAt}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		counts[key]++
+
+		if revision.Revision > group.Revision {
+			group.Revision = revision.Revision
+		}
+		if revision.UpdatedAt < group.UpdatedAt {
+			group.UpdatedAt = revision.UpdatedAt
+		}
+	}
+
+	for _, key := range keys {
+		if counts[key] > 1 {
+			compactions = append(compactions, *groups[key])
+			removed += counts[key] - 1
+		}
+	}
+
+	return
+}
+
+func (r *historyRetention) compactDay(from, to int64) error {
+	for {
+		removed, next, err := r.compactor.compactHistory(from, to)
+		if err != nil || next == 0 {
+			return err
+		}
+
+		// nothing left to merge in this batch, move to the next one
+		if removed == 0 {
+			if next <= from {
+				return nil
+			}
+			from = next
+		}
+	}
+}
+
+func (r *historyRetention) enforce() {
+	now := common.UnixMillis(time.Now())
+
+	if r.policy.MaxAge > 0 {
+		before := now - int64(r.policy.MaxAge/time.Millisecond)
+		if err := r.compactor.purgeHistory(before); err != nil {
+			logging.GetLogger().Errorf("Failed to purge graph history: %s", err)
+		}
+		if r.compactedUntil < before {
+			r.compactedUntil = before - before%dayMillis
+		}
+	}
+
+	if r.policy.FullHistory <= 0 {
+		return
+	}
+
+	if r.compactedUntil == 0 {
+		oldest, err := r.compactor.oldestArchive()
+		if err != nil {
+			logging.GetLogger().Errorf("Failed to retrieve the oldest graph revision: %s", err)
+			return
+		}
+		if oldest == 0 {
+			return
+		}
+		r.compactedUntil = oldest - oldest%dayMillis
+	}
+
+	cutoff := now - int64(r.policy.FullHistory/time.Millisecond)
+	cutoff -= cutoff % dayMillis
+
+	for day := r.compactedUntil; day < cutoff; day += dayMillis {
+		if err := r.compactDay(day, day+dayMillis); err != nil {
+			logging.GetLogger().Errorf("Failed to compact graph history of %s: %s", time.Unix(day/1000, 0).UTC().Format("2006-01-02"), err)
+			return
+		}
+		r.compactedUntil = day + dayMillis
+	}
+}
+
+func (r *historyRetention) run() {
+	ticker := time.NewTicker(r.policy.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if r.election == nil || r.election.IsMaster() {
+			r.enforce()
+		}
+	}
+}
+
+// startHistoryRetention enforces the retention policy periodically if any
+// limit is set. When an election service is given, only the master does it.
+func startHistoryRetention(name string, policy RetentionPolicy, compactor historyCompactor, electionService common.MasterElectionService) {
+	if policy.FullHistory <= 0 && policy.MaxAge <= 0 {
+		return
+	}
+
+	if policy.Interval <= 0 {
+		policy.Interval = defaultCompactionInterval
+	}
+
+	r := &historyRetention{
+		policy:    policy,
+		compactor: compactor,
+	}
+
+	if electionService != nil {
+		r.election = electionService.NewElection(name)
+		r.election.StartAndWait()
+	}
+
+	logging.GetLogger().Infof("Graph history retention: full history %s, max age %s", policy.FullHistory, policy.MaxAge)
+
+	go r.run()
+}
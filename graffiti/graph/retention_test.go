@@ -0,0 +1,55 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompactRevisions(t *testing.T) {
+	day := dayMillis
+
+	revisions := []archivedRevision{
+		{ID: "aaa", Revision: 1, UpdatedAt: 1000, ArchivedAt: 2000},
+		{ID: "aaa", Revision: 2, UpdatedAt: 2000, ArchivedAt: 3000},
+		{ID: "bbb", Revision: 1, UpdatedAt: 1500, ArchivedAt: 2500},
+		{ID: "aaa", Revision: 3, UpdatedAt: 3000, ArchivedAt: 4000},
+		{ID: "aaa", Revision: 4, UpdatedAt: 4000, ArchivedAt: day + 1000},
+		{ID: "aaa", Revision: 5, UpdatedAt: day + 1000, ArchivedAt: day + 2000},
+	}
+
+	compactions, removed := compactRevisions(revisions)
+
+	expected := []revisionCompaction{
+		{ID: "aaa", Revision: 3, UpdatedAt: 1000},
+		{ID: "aaa", Revision: 5, UpdatedAt: 4000},
+	}
+
+	if !reflect.DeepEqual(compactions, expected) {
+		t.Fatalf("Expected compactions %+v, got %+v", expected, compactions)
+	}
+
+	if removed != 3 {
+		t.Fatalf("Expected 3 revisions to be removed, got %d", removed)
+	}
+
+	if compactions, removed = compactRevisions(revisions[2:3]); len(compactions) != 0 || removed != 0 {
+		t.Fatalf("Expected no compaction of a single revision, got %+v", compactions)
+	}
+}
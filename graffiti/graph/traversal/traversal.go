@@ -18,9 +18,11 @@
 package traversal
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"reflect"
 	"strings"
 	"time"
@@ -45,6 +47,16 @@ type GraphTraversalStep interface {
 // StepContext a step within a context
 type StepContext struct {
 	PaginationRange *GraphTraversalRange
+	// Context of the execution of the step, carrying its span
+	Context context.Context
+}
+
+// TraceContext returns the context of the execution of the step
+func (c StepContext) TraceContext() context.Context {
+	if c.Context == nil {
+		return context.Background()
+	}
+	return c.Context
 }
 
 // Iterator on the range
@@ -253,6 +265,32 @@ func KeyValueToFilter(k string, v interface{}) (*filters.Filter, error) {
 		}
 
 		return &filters.Filter{IPV4RangeFilter: rf}, nil
+	case *CIDRElementMatcher:
+		ip, _, err := net.ParseCIDR(v.cidr)
+		if err != nil {
+			return nil, err
+		}
+
+		// use the IPv4 range filter when possible, IPv6 ranges are
+		// translated to a regex so that they can be used by the backends
+		if ip.To4() != nil {
+			rf, err := filters.NewIPV4RangeFilter(k, v.cidr)
+			if err != nil {
+				return nil, err
+			}
+			return &filters.Filter{IPV4RangeFilter: rf}, nil
+		}
+
+		regex, err := common.IPV6CIDRToRegex(v.cidr)
+		if err != nil {
+			return nil, err
+		}
+
+		rf, err := filters.NewRegexFilter(k, regex)
+		if err != nil {
+			return nil, err
+		}
+		return &filters.Filter{RegexFilter: rf}, nil
 	default:
 		i, err := common.ToInt64(v)
 		if err != nil {
@@ -460,6 +498,16 @@ func IPV4Range(s interface{}) *IPV4RangeElementMatcher {
 	return &IPV4RangeElementMatcher{value: s}
 }
 
+// CIDRElementMatcher matches IPv4 or IPv6 addresses contained in a cidr
+type CIDRElementMatcher struct {
+	cidr string
+}
+
+// Cidr predicate
+func Cidr(cidr string) *CIDRElementMatcher {
+	return &CIDRElementMatcher{cidr: cidr}
+}
+
 // Since describes a list of metadata that match since seconds
 type Since struct {
 	Seconds int64
@@ -990,6 +1038,21 @@ func (tv *GraphTraversalV) Dedup(ctx StepContext, s ...interface{}) *GraphTraver
 	return ntv
 }
 
+// NewGraphTraversalShortestPath returns a new shortest path step holding
+// the given paths
+func NewGraphTraversalShortestPath(gt *GraphTraversal, paths [][]*graph.Node, err ...error) *GraphTraversalShortestPath {
+	sp := &GraphTraversalShortestPath{
+		GraphTraversal: gt,
+		paths:          paths,
+	}
+
+	if len(err) > 0 {
+		sp.error = err[0]
+	}
+
+	return sp
+}
+
 // Values returns the graph values
 func (sp *GraphTraversalShortestPath) Values() []interface{} {
 	sp.GraphTraversal.RLock()
@@ -1360,31 +1423,54 @@ nodeloop:
 	return nte
 }
 
-// SubGraph step, node/edge out
-func (tv *GraphTraversalV) SubGraph(ctx StepContext, s ...interface{}) *GraphTraversal {
-	if tv.error != nil {
-		return &GraphTraversal{error: tv.error}
+// newSubGraph returns a graph made of the given nodes and of the edges linking
+// them. If an edge metadata is given, the ancestors of the nodes linked through
+// matching edges, owners for instance, are added as well.
+func newSubGraph(gt *GraphTraversal, nodes []*graph.Node, s ...interface{}) *GraphTraversal {
+	var em graph.ElementMatcher
+	switch len(s) {
+	case 0:
+	case 1:
+		m, ok := s[0].(graph.Metadata)
+		if !ok {
+			return &GraphTraversal{error: errors.New("SubGraph parameter has to be a metadata")}
+		}
+		em = m
+	default:
+		return &GraphTraversal{error: errors.New("SubGraph accepts only one parameter")}
 	}
 
-	tv.GraphTraversal.RLock()
-	defer tv.GraphTraversal.RUnlock()
-
 	memory, err := graph.NewMemoryBackend()
 	if err != nil {
 		return &GraphTraversal{error: err}
 	}
 
-	// first insert all the nodes
-	for _, n := range tv.nodes {
+	// first insert all the nodes, and their ancestors if requested
+	var added []*graph.Node
+	visited := make(map[graph.Identifier]bool)
+	for len(nodes) > 0 {
+		n := nodes[0]
+		nodes = nodes[1:]
+
+		if visited[n.ID] {
+			continue
+		}
+		visited[n.ID] = true
+
 		if err := memory.NodeAdded(n); err != nil {
 			return &GraphTraversal{error: fmt.Errorf("Error while adding node to SubGraph: %s", err)}
 		}
+		added = append(added, n)
+
+		if em != nil {
+			nodes = append(nodes, gt.Graph.LookupParents(n, nil, em)...)
+		}
 	}
 
 	// then insert edges, ignore edge insert error since one of the linked node couldn't be part
 	// of the SubGraph
-	for _, n := range tv.nodes {
-		edges := tv.GraphTraversal.Graph.GetNodeEdges(n, nil)
+	for _, n := range added {
+		edges := gt.Graph.GetNodeEdges(n, nil)
 		for _, e := range edges {
 			switch err := memory.EdgeAdded(e); err {
 			case nil, graph.ErrParentNotFound, graph.ErrChildNotFound, graph.ErrEdgeConflict:
@@ -1394,9 +1480,28 @@ func (tv *GraphTraversalV) SubGraph(ctx StepContext, s ...interface{}) *GraphTra
 		}
 	}
 
-	ng := graph.NewGraph(tv.GraphTraversal.Graph.GetHost(), memory, common.UnknownService)
+	ng := graph.NewGraph(gt.Graph.GetHost(), memory, common.UnknownService)
+
+	// a SubGraph of a scoped graph is scoped as well
+	if gt.Graph.GetContext().Scoped {
+		if ng, err = ng.CloneWithContext(gt.Graph.GetContext()); err != nil {
+			return &GraphTraversal{error: err}
+		}
+	}
+
+	return NewGraphTraversal(ng, gt.lockGraph)
+}
+
+// SubGraph step, node/edge out
+func (tv *GraphTraversalV) SubGraph(ctx StepContext, s ...interface{}) *GraphTraversal {
+	if tv.error != nil {
+		return &GraphTraversal{error: tv.error}
+	}
+
+	tv.GraphTraversal.RLock()
+	defer tv.GraphTraversal.RUnlock()
 
-	return NewGraphTraversal(ng, tv.GraphTraversal.lockGraph)
+	return newSubGraph(tv.GraphTraversal, tv.nodes, s...)
 }
 
 // SubGraph step, node/edge out
@@ -1408,35 +1513,12 @@ func (sp *GraphTraversalShortestPath) SubGraph(ctx StepContext, s ...interface{}
 	sp.GraphTraversal.RLock()
 	defer sp.GraphTraversal.RUnlock()
 
-	memory, err := graph.NewMemoryBackend()
-	if err != nil {
-		return &GraphTraversal{error: err}
-	}
-
-	// first insert all the nodes
-	for _, p := range sp.paths {
-		for _, n := range p {
-			if err := memory.NodeAdded(n); err != nil && err != graph.ErrNodeConflict {
-				return &GraphTraversal{error: fmt.Errorf("Error while adding node to SubGraph: %s", err)}
-			}
-		}
-	}
+	var nodes []*graph.Node
 	for _, p := range sp.paths {
-		for _, n := range p {
-			edges := sp.GraphTraversal.Graph.GetNodeEdges(n, nil)
-			for _, e := range edges {
-				switch err := memory.EdgeAdded(e); err {
-				case nil, graph.ErrParentNotFound, graph.ErrChildNotFound, graph.ErrEdgeConflict:
-				default:
-					return &GraphTraversal{error: fmt.Errorf("Error while adding edge to SubGraph: %s", err)}
-				}
-			}
-		}
+		nodes = append(nodes, p...)
 	}
 
-	ng := graph.NewGraph(sp.GraphTraversal.Graph.GetHost(), memory, common.UnknownService)
-
-	return NewGraphTraversal(ng, sp.GraphTraversal.lockGraph)
+	return newSubGraph(sp.GraphTraversal, nodes, s...)
 }
 
 // Dedup removes duplicated nodes from all the paths
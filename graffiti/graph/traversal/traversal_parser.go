@@ -18,16 +18,22 @@
 package traversal
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"math"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
+	lru "github.com/hashicorp/golang-lru"
+
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/tracing"
 )
 
 type (
@@ -45,6 +51,12 @@ type (
 		Context() *GremlinTraversalContext
 	}
 
+	// GremlinTraversalContextStep describes a step executed within the
+	// context of the sequence, carrying the span of the step
+	GremlinTraversalContextStep interface {
+		ExecContext(ctx context.Context, last GraphTraversalStep) (GraphTraversalStep, error)
+	}
+
 	// GremlinTraversalContext describes the context of a step
 	GremlinTraversalContext struct {
 		StepContext StepContext
@@ -180,13 +192,42 @@ var (
 // The mechanism is based on Reduce and Exec steps
 type GremlinTraversalParser struct {
 	common.RWMutex
-	scanner *GremlinTraversalScanner
+	scanner tokenScanner
 	buf     struct {
 		tok Token
 		lit string
 		n   int
 	}
 	extensions []GremlinTraversalExtension
+	bindings   map[string]interface{}
+	tokens     *lru.Cache
+}
+
+// number of queries whose tokens are kept by the parser
+const maxCachedQueries = 1024
+
+type tokenScanner interface {
+	Scan() (tok Token, lit string)
+}
+
+type scannedToken struct {
+	tok Token
+	lit string
+}
+
+// tokenReplayer replays the tokens of an already scanned query
+type tokenReplayer struct {
+	tokens []scannedToken
+	pos    int
+}
+
+func (r *tokenReplayer) Scan() (Token, string) {
+	if r.pos >= len(r.tokens) {
+		return EOF, ""
+	}
+	t := r.tokens[r.pos]
+	r.pos++
+	return t.tok, t.lit
 }
 
 func invokeStepFnc(last GraphTraversalStep, name string, gremlinStep GremlinTraversalStep) (GraphTraversalStep, error) {
@@ -867,9 +908,17 @@ func (s *GremlinTraversalStepSelect) Reduce(next GremlinTraversalStep) (GremlinT
 
 // Exec sequence step
 func (s *GremlinTraversalSequence) Exec(g *graph.Graph, lockGraph bool) (GraphTraversalStep, error) {
+	return s.ExecContext(context.Background(), g, lockGraph)
+}
+
+// ExecContext executes the sequence, tracing its steps as children of the
+// span of the context
+func (s *GremlinTraversalSequence) ExecContext(ctx context.Context, g *graph.Graph, lockGraph bool) (_ GraphTraversalStep, err error) {
 	var step GremlinTraversalStep
 	var last GraphTraversalStep
-	var err error
+
+	ctx, span := tracing.Start(ctx, "gremlin.exec")
+	defer func() { tracing.End(span, err) }()
 
 	s.GraphTraversal = NewGraphTraversal(g, lockGraph)
 	last = s.GraphTraversal
@@ -887,11 +936,19 @@ func (s *GremlinTraversalSequence) Exec(g *graph.Graph, lockGraph bool) (GraphTr
 			}
 		}
 
-		if last, err = step.Exec(last); err != nil {
-			return nil, err
+		// the steps querying a storage get the context of their span
+		stepCtx, stepSpan := tracing.Start(ctx, "gremlin.step "+stepName(step))
+		if cs, ok := step.(GremlinTraversalContextStep); ok {
+			last, err = cs.ExecContext(stepCtx, last)
+		} else {
+			last, err = step.Exec(last)
 		}
+		if err == nil {
+			err = last.Error()
+		}
+		tracing.End(stepSpan, err)
 
-		if err := last.Error(); err != nil {
+		if err != nil {
 			return nil, err
 		}
 	}
@@ -904,14 +961,57 @@ func (s *GremlinTraversalSequence) Exec(g *graph.Graph, lockGraph bool) (GraphTr
 	return res, nil
 }
 
+// stepName returns the name of a step, ex: V for GremlinTraversalStepV or
+// Flow for the FlowGremlinTraversalStep extension
+func stepName(step GremlinTraversalStep) string {
+	t := reflect.TypeOf(step)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(t.Name(), "GremlinTraversalStep"), "GremlinTraversalStep")
+}
+
+// Steps returns the steps of the sequence
+func (s *GremlinTraversalSequence) Steps() []GremlinTraversalStep {
+	return s.steps
+}
+
 // AddTraversalExtension registers a new gremlin traversal extension
 func (p *GremlinTraversalParser) AddTraversalExtension(e GremlinTraversalExtension) {
 	p.extensions = append(p.extensions, e)
+
+	// tokens depend on the registered extensions
+	p.tokens.Purge()
 }
 
 // NewGremlinTraversalParser creates a new gremlin language parser on the graph
 func NewGremlinTraversalParser() *GremlinTraversalParser {
-	return &GremlinTraversalParser{}
+	tokens, _ := lru.New(maxCachedQueries)
+	return &GremlinTraversalParser{
+		tokens: tokens,
+	}
+}
+
+// bindingValue returns the value of a query binding as a step parameter
+func bindingValue(name string, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string, bool, int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case float64:
+		// JSON numbers are decoded as float64
+		if v == math.Trunc(v) && math.Abs(v) < math.MaxInt64 {
+			return int64(v), nil
+		}
+		return v, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	}
+	return nil, fmt.Errorf("Unsupported value type %T for binding $%s", value, name)
 }
 
 func (p *GremlinTraversalParser) parseStepParams() ([]interface{}, error) {
@@ -938,6 +1038,16 @@ func (p *GremlinTraversalParser) parseStepParams() ([]interface{}, error) {
 			}
 		case STRING:
 			params = append(params, lit)
+		case BINDING:
+			value, ok := p.bindings[lit]
+			if !ok {
+				return nil, fmt.Errorf("No value bound to $%s", lit)
+			}
+			param, err := bindingValue(lit, value)
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, param)
 		case METADATA:
 			metadataParams, err := p.parseStepParams()
 			if err != nil {
@@ -1068,6 +1178,20 @@ func (p *GremlinTraversalParser) parseStepParams() ([]interface{}, error) {
 				return nil, fmt.Errorf("One parameter expected with IPV4RANGE: %v", ipParams)
 			}
 			params = append(params, IPV4Range(ipParams[0]))
+		case CIDR:
+			cidrParams, err := p.parseStepParams()
+			if err != nil {
+				return nil, err
+			}
+			if len(cidrParams) != 1 {
+				return nil, fmt.Errorf("One parameter expected with CIDR: %v", cidrParams)
+			}
+			switch param := cidrParams[0].(type) {
+			case string:
+				params = append(params, Cidr(param))
+			default:
+				return nil, fmt.Errorf("CIDR predicate expects a string as parameter, got: %s", lit)
+			}
 		case FOREVER:
 			params = append(params, &ForeverPredicate{})
 		case NOW:
@@ -1269,6 +1393,63 @@ func (p *GremlinTraversalParser) Parse(r io.Reader) (*GremlinTraversalSequence,
 	defer p.Unlock()
 
 	p.scanner = NewGremlinTraversalScanner(r, p.extensions)
+	p.bindings = nil
+
+	return p.parse()
+}
+
+// ParseWithBindings parses a Gremlin query where parameters can be given as
+// $name placeholders, replaced by the values of the bindings. As the query
+// doesn't change with the values, its tokens are cached and reused by the
+// next requests using the same query.
+func (p *GremlinTraversalParser) ParseWithBindings(query string, bindings map[string]interface{}) (*GremlinTraversalSequence, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.scanner = &tokenReplayer{tokens: p.tokenize(query)}
+	p.bindings = bindings
+	defer func() { p.bindings = nil }()
+
+	return p.parse()
+}
+
+func (p *GremlinTraversalParser) tokenize(query string) []scannedToken {
+	if tokens, found := p.tokens.Get(query); found {
+		return tokens.([]scannedToken)
+	}
+
+	var tokens []scannedToken
+	scanner := NewGremlinTraversalScanner(strings.NewReader(query), p.extensions)
+	for {
+		tok, lit := scanner.Scan()
+		if tok == EOF {
+			break
+		}
+		if tok != WS {
+			tokens = append(tokens, scannedToken{tok: tok, lit: lit})
+		}
+	}
+
+	p.tokens.Add(query, tokens)
+	return tokens
+}
+
+// Bindings returns the names of the $name placeholders of a query
+func (p *GremlinTraversalParser) Bindings(query string) []string {
+	p.Lock()
+	defer p.Unlock()
+
+	var names []string
+	for _, token := range p.tokenize(query) {
+		if token.tok == BINDING {
+			names = append(names, token.lit)
+		}
+	}
+	return names
+}
+
+func (p *GremlinTraversalParser) parse() (*GremlinTraversalSequence, error) {
+	p.buf.n = 0
 
 	seq := &GremlinTraversalSequence{
 		extensions: p.extensions,
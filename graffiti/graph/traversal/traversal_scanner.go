@@ -44,6 +44,7 @@ const (
 	RIGHTPARENTHESIS
 	STRING
 	NUMBER
+	BINDING
 
 	// Keywords
 	G
@@ -88,6 +89,7 @@ const (
 	ASC
 	DESC
 	IPV4RANGE
+	CIDR
 	SUBGRAPH
 	FOREVER
 	NOW
@@ -128,6 +130,8 @@ func (s *GremlinTraversalScanner) Scan() (tok Token, lit string) {
 	} else if isLetter(ch) {
 		s.unread()
 		return s.scanIdent()
+	} else if ch == '$' {
+		return s.scanBinding()
 	}
 
 	switch ch {
@@ -195,6 +199,27 @@ func (s *GremlinTraversalScanner) scanString() (tok Token, lit string) {
 	return STRING, buf.String()
 }
 
+func (s *GremlinTraversalScanner) scanBinding() (tok Token, lit string) {
+	var buf bytes.Buffer
+
+	for {
+		if ch := s.read(); ch == eof {
+			break
+		} else if !isLetter(ch) && !isDigit(ch) && ch != '_' {
+			s.unread()
+			break
+		} else {
+			_, _ = buf.WriteRune(ch)
+		}
+	}
+
+	if buf.Len() == 0 {
+		return ILLEGAL, "$"
+	}
+
+	return BINDING, buf.String()
+}
+
 func (s *GremlinTraversalScanner) scanIdent() (tok Token, lit string) {
 	var buf bytes.Buffer
 	buf.WriteRune(s.read())
@@ -295,6 +320,8 @@ func (s *GremlinTraversalScanner) scanIdent() (tok Token, lit string) {
 		return DESC, buf.String()
 	case "IPV4RANGE":
 		return IPV4RANGE, buf.String()
+	case "CIDR":
+		return CIDR, buf.String()
 	case "SUBGRAPH":
 		return SUBGRAPH, buf.String()
 	case "FOREVER":
@@ -18,6 +18,7 @@
 package traversal
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
@@ -472,6 +473,50 @@ func TestTraversalIpv4Range(t *testing.T) {
 	}
 }
 
+func TestTraversalCidr(t *testing.T) {
+	g := newTransversalGraph(t)
+	ctx := StepContext{}
+
+	g.NewNode(graph.GenID(), graph.Metadata{"Value": int64(5), "IPV6": []string{"fe80::1/64", "2001:db8:1::5/64"}})
+
+	tr := NewGraphTraversal(g, false)
+
+	tv := tr.V(ctx).Has(ctx, "IPV4", Cidr("192.168.0.0/16"))
+	if len(tv.Values()) != 2 {
+		t.Fatalf("Should return 2 nodes, returned: %v", tv.Values())
+	}
+
+	// next test
+	tv = tr.V(ctx).Has(ctx, "IPV6", Cidr("2001:db8::/32"))
+	if len(tv.Values()) != 1 {
+		t.Fatalf("Should return 1 node, returned: %v", tv.Values())
+	}
+
+	// next test
+	tv = tr.V(ctx).Has(ctx, "IPV6", Cidr("2001:db9::/32"))
+	if len(tv.Values()) != 0 {
+		t.Fatalf("Shouldn't return node, returned: %v", tv.Values())
+	}
+
+	// next test
+	tv = tr.V(ctx).Has(ctx, "IPV6", Cidr("fe80::/10"))
+	if len(tv.Values()) != 1 {
+		t.Fatalf("Should return 1 node, returned: %v", tv.Values())
+	}
+
+	// next test
+	tv = tr.V(ctx).Has(ctx, "IPV6", Cidr("2001:db8::/33"))
+	if tv.Error() == nil {
+		t.Fatal("Should return an error as the network part contains a zero group")
+	}
+
+	// next test
+	res := execTraversalQuery(t, g, `G.V().Has("IPV4", Cidr("10.0.0.0/8"))`)
+	if len(res.Values()) != 1 {
+		t.Fatalf("Should return 1 node, returned: %v", res.Values())
+	}
+}
+
 func TestTraversalBoth(t *testing.T) {
 	g := newTransversalGraph(t)
 	ctx := StepContext{}
@@ -575,6 +620,21 @@ func TestTraversalSubGraph(t *testing.T) {
 	if len(te.Values()) != 1 {
 		t.Fatalf("Should return 1 edge, returned: %v, %s", te.Values(), tv.Error())
 	}
+
+	// ancestors linked through matching edges are part of the subgraph
+	tv = tr.V(ctx).Has(ctx, "Value", 3).SubGraph(ctx, graph.Metadata{"Direction": "Left"}).V(ctx)
+	if len(tv.Values()) != 3 {
+		t.Fatalf("Should return 3 nodes, returned: %v, %s", tv.Values(), tv.Error())
+	}
+
+	te = tr.V(ctx).Has(ctx, "Value", 3).SubGraph(ctx, graph.Metadata{"Direction": "Left"}).E(ctx)
+	if len(te.Values()) != 3 {
+		t.Fatalf("Should return 3 edges, returned: %v, %s", te.Values(), te.Error())
+	}
+
+	if g := tr.V(ctx).SubGraph(ctx, "Direction"); g.Error() == nil {
+		t.Fatal("Should return an error as the parameter is not a metadata")
+	}
 }
 
 func execTraversalQuery(t *testing.T, g *graph.Graph, query string) GraphTraversalStep {
@@ -879,3 +939,65 @@ func TestDedupMultiplefields(t *testing.T) {
 		t.Fatalf("Should return 3 nodes, returned: %v", res.Values())
 	}
 }
+
+func TestTraversalBindings(t *testing.T) {
+	g := newTransversalGraph(t)
+	p := NewGremlinTraversalParser()
+
+	query := `G.V().Has("Type", $type, "Bytes", GT($bytes))`
+	for _, bindings := range []map[string]interface{}{
+		{"type": "intf", "bytes": 1500},
+		{"type": "intf", "bytes": float64(1500)},
+	} {
+		ts, err := p.ParseWithBindings(query, bindings)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := ts.Exec(g, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Values()) != 1 {
+			t.Fatalf("Should return 1 node, returned: %v", res.Values())
+		}
+	}
+
+	// values are never interpreted as part of the query
+	ts, err := p.ParseWithBindings(`G.V().Has("Name", $name)`, map[string]interface{}{"name": `Node4").Out("`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ts.Exec(g, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Values()) != 0 {
+		t.Fatalf("Should return no node, returned: %v", res.Values())
+	}
+
+	if _, err := p.ParseWithBindings(query, map[string]interface{}{"type": "intf"}); err == nil {
+		t.Fatal("Should return an error for a missing binding")
+	}
+}
+
+func TestTraversalTokenCache(t *testing.T) {
+	p := NewGremlinTraversalParser()
+
+	for i := 0; i < maxCachedQueries*2; i++ {
+		if _, err := p.ParseWithBindings(fmt.Sprintf(`G.V().Has("Value", %d)`, i), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if p.tokens.Len() != maxCachedQueries {
+		t.Errorf("Should keep the tokens of %d queries, kept: %d", maxCachedQueries, p.tokens.Len())
+	}
+
+	if names := p.Bindings(`G.V().Has("Type", $type, "Bytes", GT($bytes))`); len(names) != 2 || names[0] != "type" || names[1] != "bytes" {
+		t.Errorf("Should return the placeholders of the query, returned: %v", names)
+	}
+}
@@ -30,8 +30,9 @@ import (
 
 // Opts Hub options
 type Opts struct {
-	ServerOpts websocket.ServerOpts
-	Validator  validator.Validator
+	ServerOpts    websocket.ServerOpts
+	Validator     validator.Validator
+	ReplayLogSize int
 }
 
 // Hub describes a graph hub that accepts incoming connections
@@ -45,6 +46,7 @@ type Hub struct {
 	replicationWSServer *websocket.StructServer
 	replicationEndpoint *ReplicationEndpoint
 	subscriberWSServer  *websocket.StructServer
+	subscriberEndpoint  *gc.SubscriberEndpoint
 }
 
 // PeersStatus describes the state of a peer
@@ -111,6 +113,11 @@ func (h *Hub) SubscriberServer() *websocket.StructServer {
 	return h.subscriberWSServer
 }
 
+// SubscriberEndpoint returns the endpoint serving the graph to the subscribers
+func (h *Hub) SubscriberEndpoint() *gc.SubscriberEndpoint {
+	return h.subscriberEndpoint
+}
+
 // NewHub returns a new hub
 func NewHub(server *shttp.Server, g *graph.Graph, cached *graph.CachedBackend, apiAuthBackend, clusterAuthBackend shttp.AuthenticationBackend, clusterAuthOptions *shttp.AuthenticationOpts, podEndpoint string, peers []common.ServiceAddress, opts Opts) (*Hub, error) {
 	newWSServer := func(endpoint string, authBackend shttp.AuthenticationBackend) *websocket.Server {
@@ -140,7 +147,11 @@ func NewHub(server *shttp.Server, g *graph.Graph, cached *graph.CachedBackend, a
 	tr.AddTraversalExtension(ge.NewDescendantsTraversalExtension())
 
 	subscriberWSServer := websocket.NewStructServer(newWSServer("/ws/subscriber", apiAuthBackend))
-	gc.NewSubscriberEndpoint(subscriberWSServer, g, tr)
+	subscriberEndpoint := gc.NewSubscriberEndpoint(subscriberWSServer, g, tr)
+	subscriberEndpoint.RegisterSSEEndpoint(server, "/sse/subscriber", apiAuthBackend, opts.ServerOpts.QueueSize)
+	if opts.ReplayLogSize > 0 {
+		subscriberEndpoint.EnableReplayLog(opts.ReplayLogSize)
+	}
 
 	return &Hub{
 		server:              server,
@@ -151,5 +162,6 @@ func NewHub(server *shttp.Server, g *graph.Graph, cached *graph.CachedBackend, a
 		replicationWSServer: replicationWSServer,
 		publisherWSServer:   publisherWSServer,
 		subscriberWSServer:  subscriberWSServer,
+		subscriberEndpoint:  subscriberEndpoint,
 	}, nil
 }
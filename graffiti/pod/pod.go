@@ -29,8 +29,9 @@ import (
 
 // Opts defines pod server options
 type Opts struct {
-	ServerOpts websocket.ServerOpts
-	Validator  validator.Validator
+	ServerOpts    websocket.ServerOpts
+	Validator     validator.Validator
+	ReplayLogSize int
 }
 
 // Pod describes a graph pod. It maintains a local graph
@@ -105,7 +106,11 @@ func NewPod(server *api.Server, clientPool *websocket.StructClientPool, g *graph
 	}
 
 	subscriberWSServer := websocket.NewStructServer(newWSServer("/ws/subscriber", apiAuthBackend))
-	common.NewSubscriberEndpoint(subscriberWSServer, g, tr)
+	subscriberEndpoint := common.NewSubscriberEndpoint(subscriberWSServer, g, tr)
+	subscriberEndpoint.RegisterSSEEndpoint(server.HTTPServer, "/sse/subscriber", apiAuthBackend, opts.ServerOpts.QueueSize)
+	if opts.ReplayLogSize > 0 {
+		subscriberEndpoint.EnableReplayLog(opts.ReplayLogSize)
+	}
 
 	forwarder := common.NewForwarder(g, clientPool)
 
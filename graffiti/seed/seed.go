@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sync/atomic"
 
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/config"
@@ -50,12 +51,21 @@ type Seed struct {
 	g          *graph.Graph
 	logger     logging.Logger
 	listeners  []EventHandler
+	replayID   atomic.Value
 }
 
 // OnConnected websocket listener
 func (s *Seed) OnConnected(c ws.Speaker) {
 	s.logger.Infof("connected to %s", c.GetHost())
-	s.subscriber.SendMessage(gws.NewStructMessage(gws.SyncRequestMsgType, gws.SyncRequestMsg{}))
+
+	// try to resume from the last handled message, the agent sends the
+	// whole graph if it can't
+	syncRequest := gws.SyncRequestMsg{}
+	if replayID, _ := s.replayID.Load().(string); replayID != "" {
+		syncRequest.ReplayID = replayID
+		syncRequest.Sequence = s.subscriber.LastSequence()
+	}
+	s.subscriber.SendMessage(gws.NewStructMessage(gws.SyncRequestMsgType, syncRequest))
 }
 
 // OnStructMessage callback
@@ -83,6 +93,12 @@ func (s *Seed) OnStructMessage(c ws.Speaker, msg *ws.StructMessage) {
 	case gws.SyncMsgType, gws.SyncReplyMsgType:
 		r := obj.(*gws.SyncMsg)
 
+		s.replayID.Store(r.ReplayID)
+		if r.Resumed {
+			s.logger.Infof("resumed from sequence %d", msg.Sequence)
+			return
+		}
+
 		s.g.DelNodes(graph.Metadata{"Origin": origin})
 
 		for _, n := range r.Nodes {
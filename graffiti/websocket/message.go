@@ -52,15 +52,23 @@ var (
 	ErrSyncMsgMalFormed     = errors.New("SyncMsg/SyncReplyMsg malformed")
 )
 
-// SyncRequestMsg describes a graph synchro request message
+// SyncRequestMsg describes a graph synchro request message. A subscriber
+// reconnecting can specify the replay log and the sequence of the last message
+// it handled to get only the missing messages instead of the whole graph.
 type SyncRequestMsg struct {
 	graph.Context
 	GremlinFilter *string
+	ReplayID      string
+	Sequence      uint64
 }
 
-// SyncMsg describes graph synchro message
+// SyncMsg describes graph synchro message. ReplayID is the replay log the
+// subscriber can resume from. Resumed is set when the missing messages are
+// replayed, in which case no element is sent.
 type SyncMsg struct {
 	*graph.Elements
+	ReplayID string `json:",omitempty"`
+	Resumed  bool   `json:",omitempty"`
 }
 
 // PartiallyUpdatedMsg describes multiple graph modifications
@@ -69,9 +77,21 @@ type PartiallyUpdatedMsg struct {
 	Ops []graph.PartiallyUpdatedOp
 }
 
-// NewStructMessage returns a new graffiti websocket StructMessage
+// NewStructMessage returns a new graffiti websocket StructMessage. The
+// structural events are sent with a high priority so that they are never
+// dropped, while the updates of the nodes holding metrics are sent with a
+// low priority as they are refreshed at each metric update anyway.
 func NewStructMessage(typ string, i interface{}) *ws.StructMessage {
-	return ws.NewStructMessage(Namespace, typ, i)
+	msg := ws.NewStructMessage(Namespace, typ, i)
+	switch typ {
+	case SyncMsgType, NodeAddedMsgType, NodeDeletedMsgType, EdgeAddedMsgType, EdgeDeletedMsgType:
+		msg.SetPriority(ws.HighPriority)
+	case NodeUpdatedMsgType:
+		if n, ok := i.(*graph.Node); ok && n.Metadata["Metric"] != nil {
+			msg.SetPriority(ws.LowPriority)
+		}
+	}
+	return msg
 }
 
 // UnmarshalJSON custom unmarshal function
@@ -79,6 +99,8 @@ func (s *SyncRequestMsg) UnmarshalJSON(b []byte) error {
 	raw := struct {
 		Time          int64
 		GremlinFilter *string
+		ReplayID      string
+		Sequence      uint64
 	}{}
 
 	if err := json.Unmarshal(b, &raw); err != nil {
@@ -89,6 +111,8 @@ func (s *SyncRequestMsg) UnmarshalJSON(b []byte) error {
 		s.TimeSlice = common.NewTimeSlice(raw.Time, raw.Time)
 	}
 	s.GremlinFilter = raw.GremlinFilter
+	s.ReplayID = raw.ReplayID
+	s.Sequence = raw.Sequence
 
 	return nil
 }
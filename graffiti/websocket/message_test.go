@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/skydive-project/skydive/graffiti/graph"
 	ws "github.com/skydive-project/skydive/websocket"
 )
 
@@ -99,3 +100,23 @@ func TestHost(t *testing.T) {
 		t.Error("Should raise an error")
 	}
 }
+
+func TestMessagePriority(t *testing.T) {
+	node := graph.CreateNode(graph.GenID(), graph.Metadata{"Name": "eth0"}, graph.TimeUTC(), "host", "")
+	withMetric := graph.CreateNode(graph.GenID(), graph.Metadata{"Name": "eth0", "Metric": map[string]interface{}{"RxBytes": 1}}, graph.TimeUTC(), "host", "")
+
+	for _, test := range []struct {
+		typ      string
+		node     *graph.Node
+		expected ws.Priority
+	}{
+		{NodeAddedMsgType, withMetric, ws.HighPriority},
+		{NodeDeletedMsgType, withMetric, ws.HighPriority},
+		{NodeUpdatedMsgType, node, ws.NormalPriority},
+		{NodeUpdatedMsgType, withMetric, ws.LowPriority},
+	} {
+		if priority := NewStructMessage(test.typ, test.node).Priority(); priority != test.expected {
+			t.Errorf("Expected priority %d for %s, got %d", test.expected, test.typ, priority)
+		}
+	}
+}
@@ -120,6 +120,8 @@ func (q QueryString) Context(list ...interface{}) QueryString {
 			newQ = newQ.appends(fmt.Sprintf("%d", common.UnixMillis(t)))
 		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
 			newQ = newQ.appends(fmt.Sprintf("%d", t))
+		case ValueString:
+			newQ = newQ.appends(t.String())
 		default:
 			panic(fmt.Sprintf("argument %v: type %T not supported", t, v))
 		}
@@ -152,11 +154,21 @@ func (q QueryString) Has(list ...interface{}) QueryString {
 	return q.newQueryString("Has", list...)
 }
 
+// HasEither append a HasEither() operation to query
+func (q QueryString) HasEither(list ...interface{}) QueryString {
+	return q.newQueryString("HasEither", list...)
+}
+
 // HasKey append a HasKey() operation to query
 func (q QueryString) HasKey(v interface{}) QueryString {
 	return q.newQueryString("HasKey", v)
 }
 
+// HasNot append a HasNot() operation to query
+func (q QueryString) HasNot(v interface{}) QueryString {
+	return q.newQueryString("HasNot", v)
+}
+
 // Hops append a Hops() operation to query
 func (q QueryString) Hops() QueryString {
 	return q.newQueryString("Hops")
@@ -187,6 +199,11 @@ func (q QueryString) BothV(list ...interface{}) QueryString {
 	return q.newQueryString("BothV", list...)
 }
 
+// Limit append a Limit() operation to query
+func (q QueryString) Limit(v interface{}) QueryString {
+	return q.newQueryString("Limit", v)
+}
+
 // Metrics append a Metrics() operation to query
 func (q QueryString) Metrics(key ...interface{}) QueryString {
 	return q.newQueryString("Metrics", key...)
@@ -0,0 +1,477 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package sql
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/skydive-project/skydive/gremlin"
+)
+
+// DefaultColumns are the flow fields returned by a SELECT *
+var DefaultColumns = []string{
+	"UUID", "LayersPath", "Application",
+	"Network.A", "Network.B", "Transport.A", "Transport.B",
+	"Metric.ABPackets", "Metric.BAPackets", "Metric.ABBytes", "Metric.BABytes",
+	"Start", "Last",
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokSymbol
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+// Query describes a SQL query translated to a Gremlin flow query. Literals of
+// the SQL query are never written in the Gremlin query but bound to it.
+type Query struct {
+	Columns  []string
+	Bindings map[string]interface{}
+	either   bool
+	filters  []interface{}
+	keys     []string
+	nullKeys []string
+	sortBy   string
+	order    gremlin.ValueString
+	limit    int64
+}
+
+// Gremlin returns the Gremlin query, executed in the time context
+// defined by at and duration if not empty
+func (q *Query) Gremlin(at, duration string) gremlin.QueryString {
+	query := gremlin.G
+	if at != "" {
+		q.Bindings["at"] = at
+		if duration != "" {
+			q.Bindings["duration"] = duration
+			query = query.Context(gremlin.Binding("at"), gremlin.Binding("duration"))
+		} else {
+			query = query.Context(gremlin.Binding("at"))
+		}
+	}
+
+	query = query.Flows()
+	if len(q.filters) > 0 {
+		if q.either {
+			query = query.HasEither(q.filters...)
+		} else {
+			query = query.Has(q.filters...)
+		}
+	}
+	for _, key := range q.keys {
+		query = query.HasKey(key)
+	}
+	for _, key := range q.nullKeys {
+		query = query.HasNot(key)
+	}
+	if q.sortBy != "" {
+		query = query.Sort(q.order, q.sortBy)
+	}
+	if q.limit >= 0 {
+		query = query.Limit(q.limit)
+	}
+
+	return query
+}
+
+func (q *Query) bind(value interface{}) gremlin.ValueString {
+	name := fmt.Sprintf("v%d", len(q.Bindings))
+	q.Bindings[name] = value
+	return gremlin.Binding(name)
+}
+
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, value: string(runes[start:i])})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i++; i < len(runes) && unicode.IsDigit(runes[i]); i++ {
+			}
+			tokens = append(tokens, token{kind: tokNumber, value: string(runes[start:i])})
+		case r == '\'':
+			var value []rune
+			for i++; ; i++ {
+				if i == len(runes) {
+					return nil, errors.New("Unterminated string literal")
+				}
+				if runes[i] == '\'' {
+					// a doubled quote is an escaped quote
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						i++
+					} else {
+						break
+					}
+				}
+				value = append(value, runes[i])
+			}
+			i++
+			tokens = append(tokens, token{kind: tokString, value: string(value)})
+		default:
+			if i+1 < len(runes) {
+				switch op := string(runes[i : i+2]); op {
+				case "<=", ">=", "<>", "!=":
+					tokens = append(tokens, token{kind: tokSymbol, value: op})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune(",()*=<>;", r) {
+				return nil, fmt.Errorf("Unexpected character '%c' at position %d", r, i)
+			}
+			tokens = append(tokens, token{kind: tokSymbol, value: string(r)})
+			i++
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	query  *Query
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// keyword consumes the next token if it is the given keyword
+func (p *parser) keyword(keyword string) bool {
+	if t := p.peek(); t.kind == tokIdent && strings.EqualFold(t.value, keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// symbol consumes the next token if it is the given symbol
+func (p *parser) symbol(symbol string) bool {
+	if t := p.peek(); t.kind == tokSymbol && t.value == symbol {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if !p.keyword(keyword) {
+		return fmt.Errorf("%s expected, got '%s'", keyword, p.peek().value)
+	}
+	return nil
+}
+
+func (p *parser) expectSymbol(symbol string) error {
+	if !p.symbol(symbol) {
+		return fmt.Errorf("'%s' expected, got '%s'", symbol, p.peek().value)
+	}
+	return nil
+}
+
+func (p *parser) identifier() (string, error) {
+	t := p.next()
+	if t.kind != tokIdent {
+		return "", fmt.Errorf("Field name expected, got '%s'", t.value)
+	}
+	return t.value, nil
+}
+
+func (p *parser) value() (interface{}, error) {
+	switch t := p.next(); t.kind {
+	case tokString:
+		return t.value, nil
+	case tokNumber:
+		return strconv.ParseInt(t.value, 10, 64)
+	case tokIdent:
+		switch strings.ToUpper(t.value) {
+		case "TRUE":
+			return true, nil
+		case "FALSE":
+			return false, nil
+		}
+		fallthrough
+	default:
+		return nil, fmt.Errorf("Value expected, got '%s'", t.value)
+	}
+}
+
+func (p *parser) values() (values []interface{}, err error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+
+	for {
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, p.query.bind(value))
+
+		if !p.symbol(",") {
+			break
+		}
+	}
+
+	return values, p.expectSymbol(")")
+}
+
+// likeToRegex translates a LIKE pattern into a regular expression
+func likeToRegex(pattern string) string {
+	var regex string
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			regex += ".*"
+		case '_':
+			regex += "."
+		default:
+			regex += regexp.QuoteMeta(string(r))
+		}
+	}
+	return regex
+}
+
+func (p *parser) condition() error {
+	key, err := p.identifier()
+	if err != nil {
+		return err
+	}
+
+	q := p.query
+	if p.keyword("IS") {
+		not := p.keyword("NOT")
+		if err := p.expectKeyword("NULL"); err != nil {
+			return err
+		}
+		if not {
+			q.keys = append(q.keys, key)
+		} else {
+			q.nullKeys = append(q.nullKeys, key)
+		}
+		return nil
+	}
+
+	not := p.keyword("NOT")
+	switch {
+	case p.keyword("IN"):
+		values, err := p.values()
+		if err != nil {
+			return err
+		}
+		if not {
+			q.filters = append(q.filters, key, gremlin.Without(values...))
+		} else {
+			q.filters = append(q.filters, key, gremlin.Within(values...))
+		}
+		return nil
+	case not:
+		return fmt.Errorf("NOT is only supported with IN and IS NULL")
+	case p.keyword("LIKE"):
+		t := p.next()
+		if t.kind != tokString {
+			return fmt.Errorf("LIKE expects a string pattern, got '%s'", t.value)
+		}
+		q.filters = append(q.filters, key, gremlin.Regex(q.bind(likeToRegex(t.value))))
+		return nil
+	}
+
+	op := p.next()
+	if op.kind != tokSymbol {
+		return fmt.Errorf("Operator expected, got '%s'", op.value)
+	}
+
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	binding := q.bind(value)
+
+	switch op.value {
+	case "=":
+		q.filters = append(q.filters, key, binding)
+	case "!=", "<>":
+		q.filters = append(q.filters, key, gremlin.Ne(binding))
+	case "<":
+		q.filters = append(q.filters, key, gremlin.Lt(binding))
+	case "<=":
+		q.filters = append(q.filters, key, gremlin.Lte(binding))
+	case ">":
+		q.filters = append(q.filters, key, gremlin.Gt(binding))
+	case ">=":
+		q.filters = append(q.filters, key, gremlin.Gte(binding))
+	default:
+		return fmt.Errorf("Unsupported operator '%s'", op.value)
+	}
+
+	return nil
+}
+
+func (p *parser) where() error {
+	var and, or bool
+	for {
+		if err := p.condition(); err != nil {
+			return err
+		}
+
+		if p.keyword("AND") {
+			and = true
+		} else if p.keyword("OR") {
+			or = true
+		} else {
+			break
+		}
+
+		if and && or {
+			return errors.New("Mixing AND and OR is not supported")
+		}
+	}
+
+	if or && (len(p.query.keys) > 0 || len(p.query.nullKeys) > 0) {
+		return errors.New("IS NULL conditions can only be combined with AND")
+	}
+	p.query.either = or
+
+	return nil
+}
+
+func (p *parser) parse() error {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return err
+	}
+
+	q := p.query
+	if p.symbol("*") {
+		q.Columns = DefaultColumns
+	} else {
+		for {
+			column, err := p.identifier()
+			if err != nil {
+				return err
+			}
+			q.Columns = append(q.Columns, column)
+
+			if !p.symbol(",") {
+				break
+			}
+		}
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return err
+	}
+	if !p.keyword("flows") {
+		return fmt.Errorf("Only the flows table can be queried, got '%s'", p.peek().value)
+	}
+
+	if p.keyword("WHERE") {
+		if err := p.where(); err != nil {
+			return err
+		}
+	}
+
+	if p.keyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return err
+		}
+
+		sortBy, err := p.identifier()
+		if err != nil {
+			return err
+		}
+		q.sortBy, q.order = sortBy, gremlin.ASC
+
+		if p.keyword("DESC") {
+			q.order = gremlin.DESC
+		} else {
+			p.keyword("ASC")
+		}
+	}
+
+	if p.keyword("LIMIT") {
+		t := p.next()
+		if t.kind != tokNumber {
+			return fmt.Errorf("LIMIT expects a number, got '%s'", t.value)
+		}
+
+		limit, err := strconv.ParseInt(t.value, 10, 64)
+		if err != nil || limit < 0 {
+			return fmt.Errorf("Invalid LIMIT value: %s", t.value)
+		}
+		q.limit = limit
+	}
+
+	p.symbol(";")
+	if t := p.peek(); t.kind != tokEOF {
+		return fmt.Errorf("Unexpected '%s' at the end of the query", t.value)
+	}
+
+	return nil
+}
+
+// Parse translates a SELECT statement on the flows table to a Gremlin query.
+// Conditions are either all combined with AND or all with OR.
+func Parse(query string) (*Query, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{
+		tokens: tokens,
+		query:  &Query{Bindings: make(map[string]interface{}), limit: -1},
+	}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+
+	return p.query, nil
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package sql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		sql      string
+		gremlin  string
+		columns  []string
+		bindings map[string]interface{}
+	}{
+		{
+			sql:     "SELECT * FROM flows",
+			gremlin: `G.Flows()`,
+			columns: DefaultColumns,
+		},
+		{
+			sql:      "select Network.A, Metric.ABBytes from flows where Application = 'TCP' and Metric.ABBytes >= 1000 order by Metric.ABBytes desc limit 10;",
+			gremlin:  `G.Flows().Has("Application", $v0, "Metric.ABBytes", Gte($v1)).Sort(DESC, "Metric.ABBytes").Limit(10)`,
+			columns:  []string{"Network.A", "Metric.ABBytes"},
+			bindings: map[string]interface{}{"v0": "TCP", "v1": int64(1000)},
+		},
+		{
+			sql:      "SELECT UUID FROM flows WHERE Network.A LIKE '10.0.%' OR Application IN ('UDP', 'ICMPv4')",
+			gremlin:  `G.Flows().HasEither("Network.A", Regex($v0), "Application", Within($v1, $v2))`,
+			columns:  []string{"UUID"},
+			bindings: map[string]interface{}{"v0": `10\.0\..*`, "v1": "UDP", "v2": "ICMPv4"},
+		},
+		{
+			sql:      "SELECT UUID FROM flows WHERE Link.A <> 'it''s' AND Transport IS NOT NULL AND NAT IS NULL",
+			gremlin:  `G.Flows().Has("Link.A", Ne($v0)).HasKey("Transport").HasNot("NAT")`,
+			columns:  []string{"UUID"},
+			bindings: map[string]interface{}{"v0": "it's"},
+		},
+	}
+
+	for _, test := range tests {
+		q, err := Parse(test.sql)
+		if err != nil {
+			t.Fatalf("%s: %s", test.sql, err)
+		}
+
+		if gremlin := q.Gremlin("", "").String(); gremlin != test.gremlin {
+			t.Errorf("Wrong query,\nexpected: \"%s\",\nactual: \"%s\"", test.gremlin, gremlin)
+		}
+		if !reflect.DeepEqual(q.Columns, test.columns) {
+			t.Errorf("Wrong columns, expected: %v, got: %v", test.columns, q.Columns)
+		}
+		if len(test.bindings) > 0 && !reflect.DeepEqual(q.Bindings, test.bindings) {
+			t.Errorf("Wrong bindings, expected: %v, got: %v", test.bindings, q.Bindings)
+		}
+	}
+
+	q, _ := Parse("SELECT UUID FROM flows")
+	if gremlin := q.Gremlin("-1m", "30s").String(); gremlin != `G.Context($at, $duration).Flows()` {
+		t.Errorf("Wrong query with context: %s", gremlin)
+	}
+
+	for _, sql := range []string{
+		"DELETE FROM flows",
+		"SELECT UUID FROM nodes",
+		"SELECT UUID FROM flows WHERE A = 1 AND B = 2 OR C = 3",
+		"SELECT UUID FROM flows WHERE A = 1 OR B IS NULL",
+		"SELECT UUID FROM flows WHERE A NOT LIKE 'a%'",
+		"SELECT UUID FROM flows WHERE A = 'unterminated",
+		"SELECT UUID FROM flows LIMIT 10 OFFSET 5",
+	} {
+		if _, err := Parse(sql); err == nil {
+			t.Errorf("Should return an error: %s", sql)
+		}
+	}
+}
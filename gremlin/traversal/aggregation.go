@@ -0,0 +1,172 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+)
+
+// AggregationTraversalExtension describes a new extension to enhance the topology
+type AggregationTraversalExtension struct {
+	PercentileToken traversal.Token
+}
+
+// PercentileGremlinTraversalStep percentile step
+type PercentileGremlinTraversalStep struct {
+	traversal.GremlinTraversalContext
+}
+
+// NewAggregationTraversalExtension returns a new graph traversal extension
+func NewAggregationTraversalExtension() *AggregationTraversalExtension {
+	return &AggregationTraversalExtension{
+		PercentileToken: traversalPercentileToken,
+	}
+}
+
+// ScanIdent returns an associated graph token
+func (e *AggregationTraversalExtension) ScanIdent(s string) (traversal.Token, bool) {
+	switch s {
+	case "PERCENTILE":
+		return e.PercentileToken, true
+	}
+	return traversal.IDENT, false
+}
+
+// ParseStep parses aggregation steps
+func (e *AggregationTraversalExtension) ParseStep(t traversal.Token, p traversal.GremlinTraversalContext) (traversal.GremlinTraversalStep, error) {
+	switch t {
+	case e.PercentileToken:
+		if _, _, err := percentileParams(p.Params...); err != nil {
+			return nil, err
+		}
+		return &PercentileGremlinTraversalStep{GremlinTraversalContext: p}, nil
+	}
+	return nil, nil
+}
+
+// Exec Percentile step
+func (s *PercentileGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
+	var value *traversal.GraphTraversalValue
+	switch tv := last.(type) {
+	case *FlowTraversalStep:
+		value = tv.Percentile(s.StepContext, s.Params...)
+	case *GroupTraversalStep:
+		value = tv.Percentile(s.StepContext, s.Params...)
+	case *MetricsTraversalStep:
+		value = tv.Percentile(s.StepContext, s.Params...)
+	default:
+		return nil, traversal.ErrExecutionError
+	}
+	return value, value.Error()
+}
+
+// Reduce Percentile step
+func (s *PercentileGremlinTraversalStep) Reduce(next traversal.GremlinTraversalStep) (traversal.GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// Context Percentile step
+func (s *PercentileGremlinTraversalStep) Context() *traversal.GremlinTraversalContext {
+	return &s.GremlinTraversalContext
+}
+
+func sumParams(keys ...interface{}) (string, error) {
+	if len(keys) != 1 {
+		return "", errors.New("Sum requires 1 parameter")
+	}
+
+	key, ok := keys[0].(string)
+	if !ok {
+		return "", errors.New("Sum parameter has to be a string key")
+	}
+
+	k := strings.Split(key, ".")
+	if k[0] != "Metric" && k[0] != "LastUpdateMetric" {
+		return "", errors.New("Sum accepts only sub fields of Metric and LastUpadteMetric")
+	}
+
+	return key, nil
+}
+
+func sumFlows(flows []*flow.Flow, key string) (float64, error) {
+	var s float64
+	for _, fl := range flows {
+		v, err := fl.GetFieldInt64(key)
+		if err != nil {
+			return 0, err
+		}
+		s += float64(v)
+	}
+	return s, nil
+}
+
+func percentileParams(keys ...interface{}) (string, float64, error) {
+	if len(keys) != 2 {
+		return "", 0, errors.New("Percentile requires a key and a percentile as parameters")
+	}
+
+	key, ok := keys[0].(string)
+	if !ok {
+		return "", 0, errors.New("Percentile key has to be a string")
+	}
+
+	var p float64
+	switch v := keys[1].(type) {
+	case int64:
+		p = float64(v)
+	case float64:
+		p = v
+	default:
+		return "", 0, errors.New("Percentile has to be a number")
+	}
+
+	if p <= 0 || p > 100 {
+		return "", 0, fmt.Errorf("Percentile has to be in ]0, 100], got %v", p)
+	}
+
+	return key, p, nil
+}
+
+// flowValues returns the integer values mapped by 'key' of the flows having this field
+func flowValues(flows []*flow.Flow, key string) []int64 {
+	var values []int64
+	for _, fl := range flows {
+		if v, err := fl.GetFieldInt64(key); err == nil {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// percentile returns the nearest-rank percentile of the values
+func percentile(values []int64, p float64) int64 {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	rank := int(math.Ceil(p / 100 * float64(len(values))))
+	if rank < 1 {
+		rank = 1
+	}
+	return values[rank-1]
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+)
+
+// DiffIgnoredKeys lists the metadata keys whose changes are not reported
+// by default, as they change on every metric update
+var DiffIgnoredKeys = []string{"Metric", "LastUpdateMetric"}
+
+// DiffTraversalExtension describes a new extension to enhance the topology
+type DiffTraversalExtension struct {
+	DiffToken traversal.Token
+}
+
+// DiffGremlinTraversalStep diff step
+type DiffGremlinTraversalStep struct {
+	context traversal.GremlinTraversalContext
+	from    interface{}
+	matcher graph.ElementMatcher
+}
+
+// NewDiffTraversalExtension returns a new graph traversal extension
+func NewDiffTraversalExtension() *DiffTraversalExtension {
+	return &DiffTraversalExtension{
+		DiffToken: traversalDiffToken,
+	}
+}
+
+// ScanIdent returns an associated graph token
+func (e *DiffTraversalExtension) ScanIdent(s string) (traversal.Token, bool) {
+	switch s {
+	case "DIFF":
+		return e.DiffToken, true
+	}
+	return traversal.IDENT, false
+}
+
+// ParseStep parses diff step
+func (e *DiffTraversalExtension) ParseStep(t traversal.Token, p traversal.GremlinTraversalContext) (traversal.GremlinTraversalStep, error) {
+	switch t {
+	case e.DiffToken:
+	default:
+		return nil, nil
+	}
+
+	if len(p.Params) == 0 {
+		return nil, fmt.Errorf("Diff requires a time as first parameter : %v", p.Params)
+	}
+
+	step := &DiffGremlinTraversalStep{context: p, from: p.Params[0]}
+
+	if len(p.Params) > 1 {
+		matcher, err := traversal.ParamsToMetadataFilter(filters.BoolFilterOp_AND, p.Params[1:]...)
+		if err != nil {
+			return nil, fmt.Errorf("Diff nodes filter error: %s", err)
+		}
+		step.matcher = matcher
+	}
+
+	return step, nil
+}
+
+// Exec Diff step
+func (d *DiffGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
+	switch tv := last.(type) {
+	case *traversal.GraphTraversal:
+		// rely on the Context step to parse the time the same way
+		contextStep := &traversal.GremlinTraversalStepContext{
+			GremlinTraversalContext: traversal.GremlinTraversalContext{Params: []interface{}{d.from}},
+		}
+
+		step, err := contextStep.Exec(tv)
+		if err != nil {
+			return nil, err
+		}
+
+		from := step.(*traversal.GraphTraversal)
+		if err := from.Error(); err != nil {
+			return nil, err
+		}
+
+		tv.RLock()
+		diff := graph.ComputeDiff(from.Graph, tv.Graph, d.matcher, DiffIgnoredKeys...)
+		tv.RUnlock()
+
+		return NewDiffTraversalStep(tv, diff), nil
+	}
+
+	return nil, traversal.ErrExecutionError
+}
+
+// Reduce Diff step
+func (d *DiffGremlinTraversalStep) Reduce(next traversal.GremlinTraversalStep) (traversal.GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// Context Diff step
+func (d *DiffGremlinTraversalStep) Context() *traversal.GremlinTraversalContext {
+	return &d.context
+}
+
+// DiffTraversalStep traversal step of a graph diff
+type DiffTraversalStep struct {
+	GraphTraversal *traversal.GraphTraversal
+	diff           *graph.GraphDiff
+	error          error
+}
+
+// NewDiffTraversalStep creates a new traversal diff step
+func NewDiffTraversalStep(gt *traversal.GraphTraversal, diff *graph.GraphDiff) *DiffTraversalStep {
+	return &DiffTraversalStep{
+		GraphTraversal: gt,
+		diff:           diff,
+	}
+}
+
+// Values returns the diff
+func (t *DiffTraversalStep) Values() []interface{} {
+	return []interface{}{t.diff}
+}
+
+// MarshalJSON serialize in JSON
+func (t *DiffTraversalStep) MarshalJSON() ([]byte, error) {
+	values := t.Values()
+	t.GraphTraversal.RLock()
+	defer t.GraphTraversal.RUnlock()
+	return json.Marshal(values)
+}
+
+func (t *DiffTraversalStep) Error() error {
+	return t.error
+}
@@ -18,6 +18,7 @@
 package traversal
 
 import (
+	"context"
 	"errors"
 	"math/rand"
 	"strconv"
@@ -29,6 +30,7 @@ import (
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/flow/storage"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/graffiti/graph/traversal"
 	"github.com/skydive-project/skydive/topology"
@@ -84,6 +86,8 @@ func execTraversalQuery(t *testing.T, tc *fakeTableClient, query string) travers
 	tr := traversal.NewGremlinTraversalParser()
 	tr.AddTraversalExtension(NewFlowTraversalExtension(tc, nil))
 	tr.AddTraversalExtension(NewGroupTraversalExtension())
+	tr.AddTraversalExtension(NewAggregationTraversalExtension())
+	tr.AddTraversalExtension(NewPathsTraversalExtension())
 
 	ts, err := tr.Parse(strings.NewReader(query))
 	if err != nil {
@@ -191,6 +195,18 @@ func TestHasStepOp(t *testing.T) {
 	if len(res.Values()) != 1 {
 		t.Fatalf("Should return 1 result, returned: %v", res.Values())
 	}
+
+	query = `G.Flows().HasKey("ICMP.ID")`
+	res = execTraversalQuery(t, tc, query)
+	if len(res.Values()) != 2 {
+		t.Fatalf("Should return 2 result, returned: %v", res.Values())
+	}
+
+	query = `G.Flows().Has("NodeTID", "node1").HasNot("ICMP.ID")`
+	res = execTraversalQuery(t, tc, query)
+	if len(res.Values()) != 0 {
+		t.Fatalf("Should return 0 result, returned: %v", res.Values())
+	}
 }
 
 func TestLimitStepOp(t *testing.T) {
@@ -224,6 +240,13 @@ func TestLimitStepOp(t *testing.T) {
 	if len(res.Values()) != 1 {
 		t.Fatalf("Should return 1 result, returned: %v", res.Values())
 	}
+
+	// filters following a range apply on the limited flows
+	query = `G.Flows().Sort(ASC, "ICMP.ID").Limit(1).Has("ICMP.ID", 444)`
+	res = execTraversalQuery(t, tc, query)
+	if len(res.Values()) != 0 {
+		t.Fatalf("Should return 0 result, returned: %v", res.Values())
+	}
 }
 
 func TestDedupStepOp(t *testing.T) {
@@ -483,3 +506,154 @@ func TestBothStepOp(t *testing.T) {
 		t.Fatalf("Should return 1 result, returned: %v", res.Values())
 	}
 }
+
+func TestFlowNodesStep(t *testing.T) {
+	tc := newFakeTableClient("node1")
+
+	host, _ := tc.g.NewNode(graph.GenID(), graph.Metadata{"Name": "host1", "Type": "host"})
+	capture, _ := tc.g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth0", "Type": "device", "TID": "node1"})
+	peer, _ := tc.g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth1", "Type": "device", "IPV4": []string{"10.0.0.2/24"}})
+	topology.AddOwnershipLink(tc.g, host, capture, nil)
+	topology.AddOwnershipLink(tc.g, host, peer, nil)
+
+	_, extFlowChan, _ := tc.t.Start(nil)
+	defer tc.t.Stop()
+	for tc.t.State() != common.RunningState {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	for _, id := range []uint32{222, 444} {
+		icmp := newICMPFlow(id)
+		icmp.Network = &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV4, A: "10.0.0.1", B: "10.0.0.2"}
+
+		extFlowChan <- &flow.ExtFlow{
+			Type: flow.OperationExtFlowType,
+			Obj:  &flow.Operation{Type: flow.ReplaceOperation, Flow: icmp, Key: rand.Uint64()},
+		}
+	}
+
+	time.Sleep(time.Second)
+
+	query := `G.Flows().CaptureNode()`
+	res := execTraversalQuery(t, tc, query)
+	if len(res.Values()) != 2 {
+		t.Fatalf("Should return 2 results, returned: %v", res.Values())
+	}
+
+	query = `G.Flows().CaptureNode().Dedup()`
+	res = execTraversalQuery(t, tc, query)
+	if len(res.Values()) != 1 {
+		t.Fatalf("Should return 1 result, returned: %v", res.Values())
+	}
+
+	query = `G.Flows().Out().Dedup()`
+	res = execTraversalQuery(t, tc, query)
+	if len(res.Values()) != 1 || res.Values()[0].(*graph.Node).ID != peer.ID {
+		t.Fatalf("Should return the peer node, returned: %v", res.Values())
+	}
+
+	query = `G.Flows().Has("ICMP.ID", 222).CaptureNode().In("Type", "host")`
+	res = execTraversalQuery(t, tc, query)
+	if len(res.Values()) != 1 || res.Values()[0].(*graph.Node).ID != host.ID {
+		t.Fatalf("Should return the host node, returned: %v", res.Values())
+	}
+
+	query = `G.Flows().Nodes()`
+	res = execTraversalQuery(t, tc, query)
+	if len(res.Values()) != 4 {
+		t.Fatalf("Should return 4 results, returned: %v", res.Values())
+	}
+}
+
+func TestFlowEndpointMAC(t *testing.T) {
+	tc := newFakeTableClient("node1")
+
+	device, _ := tc.g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth0", "Type": "device", "IPV4": []string{"10.0.0.2/24"}})
+	peer, _ := tc.g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth1", "Type": "device", "PeerIntfMAC": "00:00:00:00:00:02"})
+
+	_, extFlowChan, _ := tc.t.Start(nil)
+	defer tc.t.Stop()
+	for tc.t.State() != common.RunningState {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	icmp := newICMPFlow(222)
+	icmp.Link = &flow.FlowLayer{Protocol: flow.FlowProtocol_ETHERNET, A: "00:00:00:00:00:01", B: "00:00:00:00:00:02"}
+	icmp.Network = &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV4, A: "10.0.0.1", B: "10.0.0.2"}
+
+	extFlowChan <- &flow.ExtFlow{
+		Type: flow.OperationExtFlowType,
+		Obj:  &flow.Operation{Type: flow.ReplaceOperation, Flow: icmp, Key: rand.Uint64()},
+	}
+
+	time.Sleep(time.Second)
+
+	// the IP address is not used when the flow has a MAC address
+	query := `G.Flows().Out()`
+	res := execTraversalQuery(t, tc, query)
+	if len(res.Values()) != 1 || res.Values()[0].(*graph.Node).ID != peer.ID {
+		t.Fatalf("Should return the peer node and not %s, returned: %v", device.ID, res.Values())
+	}
+
+	// Nodes only matches the MAC address of the nodes
+	query = `G.Flows().Nodes("Type", "device")`
+	res = execTraversalQuery(t, tc, query)
+	if len(res.Values()) != 0 {
+		t.Fatalf("Should return no result, returned: %v", res.Values())
+	}
+}
+
+// historyBackend pretends to keep the history, for the flow steps to query
+// the storage
+type historyBackend struct {
+	*graph.MemoryBackend
+}
+
+func (historyBackend) IsHistorySupported() bool {
+	return true
+}
+
+// encryptedStorage returns the raw packets as encrypted at rest
+type encryptedStorage struct {
+	storage.Storage
+}
+
+func (s *encryptedStorage) SearchRawPackets(fsq filters.SearchQuery, packetFilter *filters.Filter) (map[string][]*flow.RawPacket, error) {
+	return map[string][]*flow.RawPacket{"flow": {{Index: 1, Data: []byte("encrypted:packet")}}}, nil
+}
+
+func (s *encryptedStorage) DecryptRawPackets(packets []*flow.RawPacket) error {
+	for _, packet := range packets {
+		packet.Data = []byte(strings.TrimPrefix(string(packet.Data), "encrypted:"))
+	}
+	return nil
+}
+
+func TestRawPacketsDecryption(t *testing.T) {
+	b, _ := graph.NewMemoryBackend()
+	g, err := graph.NewGraph("testhost", historyBackend{b}, common.UnknownService).CloneWithContext(graph.Context{TimeSlice: common.NewTimeSlice(0, 1000)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawPackets := func(ctx context.Context) string {
+		fs := &FlowTraversalStep{
+			GraphTraversal:  traversal.NewGraphTraversal(g, false),
+			Storage:         &encryptedStorage{},
+			flowSearchQuery: filters.SearchQuery{Filter: filters.NewTermStringFilter("UUID", "flow")},
+		}
+
+		res := fs.RawPackets(traversal.StepContext{Context: ctx})
+		if res.Error() != nil {
+			t.Fatal(res.Error())
+		}
+		return string(res.rawPackets["flow"][0].Data)
+	}
+
+	if data := rawPackets(context.Background()); data != "encrypted:packet" {
+		t.Errorf("The raw packets should only be decrypted when allowed, got %s", data)
+	}
+	if data := rawPackets(WithRawPacketDecryption(context.Background())); data != "packet" {
+		t.Errorf("Expected the raw packets to be decrypted, got %s", data)
+	}
+}
@@ -18,6 +18,7 @@
 package traversal
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -34,6 +35,7 @@ import (
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/topology"
 	"github.com/skydive-project/skydive/topology/probes/socketinfo"
+	"github.com/skydive-project/skydive/tracing"
 )
 
 const (
@@ -102,230 +104,167 @@ type BpfGremlinTraversalStep struct {
 	traversal.GremlinTraversalContext
 }
 
-// Out returns the B node
-func (f *FlowTraversalStep) Out(ctx traversal.StepContext, s ...interface{}) *traversal.GraphTraversalV {
-	var nodes []*graph.Node
+// flowNodes resolves the nodes of the flows of a traversal step
+type flowNodes struct {
+	graph   *graph.Graph
+	it      *common.Iterator
+	nodes   []*graph.Node
+	ipIndex map[string][]*graph.Node
+}
 
-	if f.error != nil {
-		return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, f.error)
+func newFlowNodes(g *graph.Graph, ctx traversal.StepContext) *flowNodes {
+	return &flowNodes{
+		graph: g,
+		it:    ctx.PaginationRange.Iterator(),
 	}
+}
 
-	filter1, err := traversal.ParamsToFilter(filters.BoolFilterOp_AND, s...)
-	if err != nil {
-		return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, err)
-	}
+func (fn *flowNodes) done() bool {
+	return fn.it.Done()
+}
 
-	it := ctx.PaginationRange.Iterator()
+func (fn *flowNodes) add(node *graph.Node) {
+	if node != nil && fn.it.Next() {
+		fn.nodes = append(fn.nodes, node)
+	}
+}
 
-	f.GraphTraversal.RLock()
-	defer f.GraphTraversal.RUnlock()
+// lookupTID returns the node with the given TID
+func (fn *flowNodes) lookupTID(filter *filters.Filter, tid string) *graph.Node {
+	f := filters.NewAndFilter(filter, filters.NewTermStringFilter("TID", tid))
+	return fn.graph.LookupFirstNode(graph.NewElementFilter(f))
+}
 
-	for _, flow := range f.flowset.Flows {
-		if it.Done() {
-			break
-		}
-		if flow.Link.B != "" {
-			f1, err := traversal.KeyValueToFilter("MAC", flow.Link.B)
-			if err != nil {
-				return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, err)
-			}
-			f2, err := traversal.KeyValueToFilter("PeerIntfMAC", flow.Link.B)
-			if err != nil {
-				return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, err)
-			}
-			filter2 := filters.NewOrFilter(f1, f2)
-			matcher := graph.NewElementFilter(filters.NewAndFilter(filter1, filter2))
+// lookupMAC returns the node with the given MAC address, or whose peer
+// interface has this MAC address
+func (fn *flowNodes) lookupMAC(filter *filters.Filter, mac string, peer bool) *graph.Node {
+	f := filters.NewTermStringFilter("MAC", mac)
+	if peer {
+		f = filters.NewOrFilter(f, filters.NewTermStringFilter("PeerIntfMAC", mac))
+	}
+	return fn.graph.LookupFirstNode(graph.NewElementFilter(filters.NewAndFilter(filter, f)))
+}
 
-			if node := f.GraphTraversal.Graph.LookupFirstNode(matcher); node != nil && it.Next() {
-				nodes = append(nodes, node)
+// lookupIP returns the node with the given IP address. The index of the node
+// addresses is built once for the whole step.
+func (fn *flowNodes) lookupIP(filter *filters.Filter, ip string) *graph.Node {
+	if fn.ipIndex == nil {
+		fn.ipIndex = make(map[string][]*graph.Node)
+		for _, node := range fn.graph.GetNodes(nil) {
+			for _, key := range []string{"IPV4", "IPV6"} {
+				addrs, _ := node.GetFieldStringList(key)
+				for _, addr := range addrs {
+					// IP addresses are stored with their prefix length
+					if i := strings.IndexByte(addr, '/'); i != -1 {
+						addr = addr[:i]
+					}
+					fn.ipIndex[addr] = append(fn.ipIndex[addr], node)
+				}
 			}
 		}
 	}
 
-	return traversal.NewGraphTraversalV(f.GraphTraversal, nodes)
+	matcher := graph.NewElementFilter(filter)
+	for _, node := range fn.ipIndex[ip] {
+		if matcher.Match(node) {
+			return node
+		}
+	}
+	return nil
 }
 
-// In returns the A node
-func (f *FlowTraversalStep) In(ctx traversal.StepContext, s ...interface{}) *traversal.GraphTraversalV {
-	var nodes []*graph.Node
-
-	if f.error != nil {
-		return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, f.error)
+// lookupEndpoint returns the node of a flow endpoint using its MAC address,
+// or its IP address when the flow has no link layer, as with sFlow or
+// routed traffic
+func (fn *flowNodes) lookupEndpoint(filter *filters.Filter, mac, ip string, peer bool) *graph.Node {
+	if mac != "" {
+		return fn.lookupMAC(filter, mac, peer)
 	}
-
-	filter1, err := traversal.ParamsToFilter(filters.BoolFilterOp_AND, s...)
-	if err != nil {
-		return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, err)
+	if ip != "" {
+		return fn.lookupIP(filter, ip)
 	}
+	return nil
+}
 
-	it := ctx.PaginationRange.Iterator()
-
-	f.GraphTraversal.RLock()
-	defer f.GraphTraversal.RUnlock()
-
-	for _, flow := range f.flowset.Flows {
-		if it.Done() {
-			break
-		}
-
-		if flow.Link.A != "" {
-			f1, err := traversal.KeyValueToFilter("MAC", flow.Link.A)
-			if err != nil {
-				return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, err)
-			}
-			f2, err := traversal.KeyValueToFilter("PeerIntfMAC", flow.Link.A)
-			if err != nil {
-				return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, err)
-			}
-			filter2 := filters.NewOrFilter(f1, f2)
-			matcher := graph.NewElementFilter(filters.NewAndFilter(filter1, filter2))
-
-			if node := f.GraphTraversal.Graph.LookupFirstNode(matcher); node != nil && it.Next() {
-				nodes = append(nodes, node)
-			}
-		}
+func flowEndpoints(fl *flow.Flow) (macA, macB, ipA, ipB string) {
+	if fl.Link != nil {
+		macA, macB = fl.Link.A, fl.Link.B
 	}
-
-	return traversal.NewGraphTraversalV(f.GraphTraversal, nodes)
+	if fl.Network != nil {
+		ipA, ipB = fl.Network.A, fl.Network.B
+	}
+	return
 }
 
-// Both returns A and B nodes
-func (f *FlowTraversalStep) Both(ctx traversal.StepContext, s ...interface{}) *traversal.GraphTraversalV {
+// nodes returns the nodes reached by the lookup function from each flow
+func (f *FlowTraversalStep) nodes(ctx traversal.StepContext, s []interface{}, lookup func(fn *flowNodes, filter *filters.Filter, fl *flow.Flow)) *traversal.GraphTraversalV {
 	var nodes []*graph.Node
 
 	if f.error != nil {
 		return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, f.error)
 	}
 
-	filter1, err := traversal.ParamsToFilter(filters.BoolFilterOp_AND, s...)
+	filter, err := traversal.ParamsToFilter(filters.BoolFilterOp_AND, s...)
 	if err != nil {
 		return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, err)
 	}
 
-	it := ctx.PaginationRange.Iterator()
-
 	f.GraphTraversal.RLock()
 	defer f.GraphTraversal.RUnlock()
 
-	for _, flow := range f.flowset.Flows {
-		if it.Done() {
+	fn := newFlowNodes(f.GraphTraversal.Graph, ctx)
+	for _, fl := range f.flowset.Flows {
+		if fn.done() {
 			break
 		}
+		lookup(fn, filter, fl)
+	}
 
-		if flow.Link.A != "" {
-			f1, err := traversal.KeyValueToFilter("MAC", flow.Link.A)
-			if err != nil {
-				return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, err)
-			}
-			f2, err := traversal.KeyValueToFilter("PeerIntfMAC", flow.Link.A)
-			if err != nil {
-				return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, err)
-			}
-			filter2 := filters.NewOrFilter(f1, f2)
-
-			matcher := graph.NewElementFilter(filters.NewAndFilter(filter1, filter2))
+	return traversal.NewGraphTraversalV(f.GraphTraversal, fn.nodes)
+}
 
-			if node := f.GraphTraversal.Graph.LookupFirstNode(matcher); node != nil && it.Next() {
-				nodes = append(nodes, node)
-			}
-		}
-		if flow.Link.B != "" {
-			f1, err := traversal.KeyValueToFilter("MAC", flow.Link.B)
-			if err != nil {
-				return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, err)
-			}
-			f2, err := traversal.KeyValueToFilter("PeerIntfMAC", flow.Link.B)
-			if err != nil {
-				return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, err)
-			}
-			filter2 := filters.NewOrFilter(f1, f2)
-			matcher := graph.NewElementFilter(filters.NewAndFilter(filter1, filter2))
+// Out returns the B nodes
+func (f *FlowTraversalStep) Out(ctx traversal.StepContext, s ...interface{}) *traversal.GraphTraversalV {
+	return f.nodes(ctx, s, func(fn *flowNodes, filter *filters.Filter, fl *flow.Flow) {
+		_, macB, _, ipB := flowEndpoints(fl)
+		fn.add(fn.lookupEndpoint(filter, macB, ipB, true))
+	})
+}
 
-			if node := f.GraphTraversal.Graph.LookupFirstNode(matcher); node != nil && it.Next() {
-				nodes = append(nodes, node)
-			}
-		}
-	}
+// In returns the A nodes
+func (f *FlowTraversalStep) In(ctx traversal.StepContext, s ...interface{}) *traversal.GraphTraversalV {
+	return f.nodes(ctx, s, func(fn *flowNodes, filter *filters.Filter, fl *flow.Flow) {
+		macA, _, ipA, _ := flowEndpoints(fl)
+		fn.add(fn.lookupEndpoint(filter, macA, ipA, true))
+	})
+}
 
-	return traversal.NewGraphTraversalV(f.GraphTraversal, nodes)
+// Both returns A and B nodes
+func (f *FlowTraversalStep) Both(ctx traversal.StepContext, s ...interface{}) *traversal.GraphTraversalV {
+	return f.nodes(ctx, s, func(fn *flowNodes, filter *filters.Filter, fl *flow.Flow) {
+		macA, macB, ipA, ipB := flowEndpoints(fl)
+		fn.add(fn.lookupEndpoint(filter, macA, ipA, true))
+		fn.add(fn.lookupEndpoint(filter, macB, ipB, true))
+	})
 }
 
 // Nodes returns A, B and the capture nodes
 func (f *FlowTraversalStep) Nodes(ctx traversal.StepContext, s ...interface{}) *traversal.GraphTraversalV {
-	var nodes []*graph.Node
-
-	if f.error != nil {
-		return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, f.error)
-	}
-
-	filter1, err := traversal.ParamsToFilter(filters.BoolFilterOp_AND, s...)
-	if err != nil {
-		return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, err)
-	}
-
-	it := ctx.PaginationRange.Iterator()
-
-	f.GraphTraversal.RLock()
-	defer f.GraphTraversal.RUnlock()
-
-	for _, flow := range f.flowset.Flows {
-		if it.Done() {
-			break
+	return f.nodes(ctx, s, func(fn *flowNodes, filter *filters.Filter, fl *flow.Flow) {
+		macA, macB, ipA, ipB := flowEndpoints(fl)
+		if fl.NodeTID != "" {
+			fn.add(fn.lookupTID(filter, fl.NodeTID))
 		}
-
-		if flow.NodeTID != "" {
-			filter := filters.NewAndFilter(filter1, filters.NewTermStringFilter("TID", flow.NodeTID))
-			if node := f.GraphTraversal.Graph.LookupFirstNode(graph.NewElementFilter(filter)); node != nil && it.Next() {
-				nodes = append(nodes, node)
-			}
-		}
-
-		if flow.Link.A != "" {
-			filter := filters.NewAndFilter(filter1, filters.NewTermStringFilter("MAC", flow.Link.A))
-			if node := f.GraphTraversal.Graph.LookupFirstNode(graph.NewElementFilter(filter)); node != nil && it.Next() {
-				nodes = append(nodes, node)
-			}
-		}
-		if flow.Link.B != "" {
-			filter := filters.NewAndFilter(filter1, filters.NewTermStringFilter("MAC", flow.Link.B))
-			if node := f.GraphTraversal.Graph.LookupFirstNode(graph.NewElementFilter(filter)); node != nil && it.Next() {
-				nodes = append(nodes, node)
-			}
-		}
-	}
-	return traversal.NewGraphTraversalV(f.GraphTraversal, nodes)
+		fn.add(fn.lookupEndpoint(filter, macA, ipA, false))
+		fn.add(fn.lookupEndpoint(filter, macB, ipB, false))
+	})
 }
 
 // Hops returns all the capture nodes where the flow was seen
 func (f *FlowTraversalStep) Hops(ctx traversal.StepContext, s ...interface{}) *traversal.GraphTraversalV {
-	var nodes []*graph.Node
-
-	if f.error != nil {
-		return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, f.error)
-	}
-
-	filter1, err := traversal.ParamsToFilter(filters.BoolFilterOp_AND, s...)
-	if err != nil {
-		return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, err)
-	}
-
-	it := ctx.PaginationRange.Iterator()
-
-	f.GraphTraversal.RLock()
-	defer f.GraphTraversal.RUnlock()
-
-	for _, fl := range f.flowset.Flows {
-		if it.Done() {
-			break
-		}
-
-		filter := filters.NewAndFilter(filter1, filters.NewTermStringFilter("TID", fl.NodeTID))
-		if node := f.GraphTraversal.Graph.LookupFirstNode(graph.NewElementFilter(filter)); node != nil && it.Next() {
-			nodes = append(nodes, node)
-		}
-	}
-
-	return traversal.NewGraphTraversalV(f.GraphTraversal, nodes)
+	return f.nodes(ctx, s, func(fn *flowNodes, filter *filters.Filter, fl *flow.Flow) {
+		fn.add(fn.lookupTID(filter, fl.NodeTID))
+	})
 }
 
 // Count step
@@ -404,6 +343,24 @@ func (f *FlowTraversalStep) HasEither(ctx traversal.StepContext, s ...interface{
 	return f.has(filters.BoolFilterOp_OR, ctx, s...)
 }
 
+// HasKey step
+func (f *FlowTraversalStep) HasKey(ctx traversal.StepContext, key string) *FlowTraversalStep {
+	if f.error != nil {
+		return f
+	}
+
+	return &FlowTraversalStep{GraphTraversal: f.GraphTraversal, Storage: f.Storage, flowset: f.flowset.Filter(filters.NewNotNullFilter(key))}
+}
+
+// HasNot step
+func (f *FlowTraversalStep) HasNot(ctx traversal.StepContext, key string) *FlowTraversalStep {
+	if f.error != nil {
+		return f
+	}
+
+	return &FlowTraversalStep{GraphTraversal: f.GraphTraversal, Storage: f.Storage, flowset: f.flowset.Filter(filters.NewNullFilter(key))}
+}
+
 // Dedup deduplicate step
 func (f *FlowTraversalStep) Dedup(ctx traversal.StepContext, keys ...interface{}) *FlowTraversalStep {
 	if f.error != nil {
@@ -428,33 +385,9 @@ func (f *FlowTraversalStep) Dedup(ctx traversal.StepContext, keys ...interface{}
 
 // CaptureNode step
 func (f *FlowTraversalStep) CaptureNode(ctx traversal.StepContext, s ...interface{}) *traversal.GraphTraversalV {
-	var nodes []*graph.Node
-
-	if f.error != nil {
-		return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, f.error)
-	}
-
-	filter1, err := traversal.ParamsToFilter(filters.BoolFilterOp_AND, s...)
-	if err != nil {
-		return traversal.NewGraphTraversalV(f.GraphTraversal, nodes, err)
-	}
-
-	it := ctx.PaginationRange.Iterator()
-
-	f.GraphTraversal.RLock()
-	defer f.GraphTraversal.RUnlock()
-
-	for _, fl := range f.flowset.Flows {
-		if it.Done() {
-			break
-		}
-
-		filter := filters.NewAndFilter(filter1, filters.NewTermStringFilter("TID", fl.NodeTID))
-		if node := f.GraphTraversal.Graph.LookupFirstNode(graph.NewElementFilter(filter)); node != nil && it.Next() {
-			nodes = append(nodes, node)
-		}
-	}
-	return traversal.NewGraphTraversalV(f.GraphTraversal, nodes)
+	return f.nodes(ctx, s, func(fn *flowNodes, filter *filters.Filter, fl *flow.Flow) {
+		fn.add(fn.lookupTID(filter, fl.NodeTID))
+	})
 }
 
 // Sort step
@@ -482,29 +415,35 @@ func (f *FlowTraversalStep) Sum(ctx traversal.StepContext, keys ...interface{})
 		return traversal.NewGraphTraversalValueFromError(f.error)
 	}
 
-	if len(keys) != 1 {
-		return traversal.NewGraphTraversalValueFromError(fmt.Errorf("Sum requires 1 parameter"))
+	key, err := sumParams(keys...)
+	if err != nil {
+		return traversal.NewGraphTraversalValueFromError(err)
 	}
 
-	key, ok := keys[0].(string)
-	if !ok {
-		return traversal.NewGraphTraversalValueFromError(fmt.Errorf("Sum parameter has to be a string key"))
+	s, err := sumFlows(f.flowset.Flows, key)
+	if err != nil {
+		return traversal.NewGraphTraversalValueFromError(err)
 	}
+	return traversal.NewGraphTraversalValue(f.GraphTraversal, s)
+}
 
-	k := strings.Split(key, ".")
-	if k[0] != "Metric" && k[0] != "LastUpdateMetric" {
-		return traversal.NewGraphTraversalValueFromError(fmt.Errorf("Sum accepts only sub fields of Metric and LastUpadteMetric"))
+// Percentile returns the percentile of the integer values mapped by 'key'
+// cross flows, the flows without this field are ignored
+func (f *FlowTraversalStep) Percentile(ctx traversal.StepContext, keys ...interface{}) *traversal.GraphTraversalValue {
+	if f.error != nil {
+		return traversal.NewGraphTraversalValueFromError(f.error)
 	}
 
-	var s float64
-	for _, fl := range f.flowset.Flows {
-		if v, err := fl.GetFieldInt64(key); err == nil {
-			s += float64(v)
-		} else {
-			return traversal.NewGraphTraversalValueFromError(err)
-		}
+	key, p, err := percentileParams(keys...)
+	if err != nil {
+		return traversal.NewGraphTraversalValueFromError(err)
 	}
-	return traversal.NewGraphTraversalValue(f.GraphTraversal, s)
+
+	values := flowValues(f.flowset.Flows, key)
+	if len(values) == 0 {
+		return traversal.NewGraphTraversalValueFromError(fmt.Errorf("No flow with field %s", key))
+	}
+	return traversal.NewGraphTraversalValue(f.GraphTraversal, percentile(values, p))
 }
 
 // PropertyValues returns a flow field value
@@ -571,8 +510,11 @@ func (f *FlowTraversalStep) FlowMetrics(ctx traversal.StepContext) *MetricsTrave
 		f.flowSearchQuery.SortBy = defaultSortBy
 		f.flowSearchQuery.SortOrder = string(common.SortAscending)
 
+		_, span := tracing.Start(ctx.TraceContext(), "storage.SearchMetrics")
 		var err error
-		if flowMetrics, err = f.Storage.SearchMetrics(f.flowSearchQuery, metricFilter); err != nil {
+		flowMetrics, err = f.Storage.SearchMetrics(f.flowSearchQuery, metricFilter)
+		tracing.End(span, err)
+		if err != nil {
 			return NewMetricsTraversalStepFromError(err)
 		}
 	} else {
@@ -629,10 +571,23 @@ func (f *FlowTraversalStep) RawPackets(ctx traversal.StepContext) *RawPacketsTra
 		f.flowSearchQuery.SortBy = "Index"
 		f.flowSearchQuery.SortOrder = string(common.SortAscending)
 
+		_, span := tracing.Start(ctx.TraceContext(), "storage.SearchRawPackets")
 		var err error
-		if rawPackets, err = f.Storage.SearchRawPackets(f.flowSearchQuery, rawPacketsFilter); err != nil {
+		rawPackets, err = f.Storage.SearchRawPackets(f.flowSearchQuery, rawPacketsFilter)
+		tracing.End(span, err)
+		if err != nil {
 			return &RawPacketsTraversalStep{error: err}
 		}
+
+		// the packets encrypted at rest are only decrypted when the context
+		// of the query allows it
+		if decrypter, ok := f.Storage.(RawPacketDecrypter); ok && rawPacketDecryption(ctx.TraceContext()) {
+			for _, packets := range rawPackets {
+				if err := decrypter.DecryptRawPackets(packets); err != nil {
+					return &RawPacketsTraversalStep{error: fmt.Errorf("Unable to decrypt raw packets: %s", err)}
+				}
+			}
+		}
 	} else {
 		for _, fl := range f.flowset.Flows {
 			if len(fl.LastRawPackets) > 0 {
@@ -748,6 +703,7 @@ func NewFlowTraversalExtension(client flow.TableClient, storage storage.Storage)
 		CaptureNodeToken: traversalCaptureNodeToken,
 		AggregatesToken:  traversalAggregatesToken,
 		BpfToken:         traversalBpfToken,
+		GroupToken:       traversalGroupToken,
 		TableClient:      client,
 		Storage:          storage,
 	}
@@ -768,7 +724,7 @@ func (e *FlowTraversalExtension) ScanIdent(s string) (traversal.Token, bool) {
 		return e.AggregatesToken, true
 	case "BPF":
 		return e.BpfToken, true
-	case "GROUP":
+	case "GROUP", "GROUPBY":
 		return e.GroupToken, true
 	}
 	return traversal.IDENT, false
@@ -856,6 +812,12 @@ func (s *FlowGremlinTraversalStep) addTimeFilter(fsq *filters.SearchQuery, timeC
 
 // Exec flow step
 func (s *FlowGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
+	return s.ExecContext(context.Background(), last)
+}
+
+// ExecContext flow step, the storage queries being traced as children of
+// the span of the context
+func (s *FlowGremlinTraversalStep) ExecContext(ctx context.Context, last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
 	var graphTraversal *traversal.GraphTraversal
 	var err error
 	var context graph.Context
@@ -873,6 +835,13 @@ func (s *FlowGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (trav
 		graphTraversal = tv
 		graphTraversal.RLock()
 		context = graphTraversal.Graph.GetContext()
+		// a scoped graph only gives access to the flows of its nodes
+		if context.Scoped {
+			if nodes = captureAllowedNodes(graphTraversal.Graph.GetNodes(nil)); len(nodes) == 0 {
+				graphTraversal.RUnlock()
+				return &FlowTraversalStep{GraphTraversal: graphTraversal, Storage: s.Storage, flowset: flowset, flowSearchQuery: flowSearchQuery}, nil
+			}
+		}
 		graphTraversal.RUnlock()
 	case *traversal.GraphTraversalV:
 		graphTraversal = tv.GraphTraversal
@@ -926,10 +895,15 @@ func (s *FlowGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (trav
 			return &FlowTraversalStep{GraphTraversal: graphTraversal, Storage: s.Storage, flowSearchQuery: flowSearchQuery}, nil
 		}
 
-		if flowset, err = s.Storage.SearchFlows(flowSearchQuery); err != nil {
+		_, span := tracing.Start(ctx, "storage.SearchFlows")
+		flowset, err = s.Storage.SearchFlows(flowSearchQuery)
+		tracing.End(span, err)
+		if err != nil {
 			return nil, err
 		}
 	} else {
+		// the flows are looked up in the flow tables of the agents
+		_, span := tracing.Start(ctx, "flow.LookupFlows")
 		if len(nodes) != 0 {
 			graphTraversal.RLock()
 			hnmap := topology.BuildHostNodeTIDMap(nodes)
@@ -938,6 +912,7 @@ func (s *FlowGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (trav
 		} else {
 			flowset, err = s.TableClient.LookupFlows(flowSearchQuery)
 		}
+		tracing.End(span, err)
 	}
 
 	if err != nil {
@@ -952,57 +927,78 @@ func (s *FlowGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (trav
 	return &FlowTraversalStep{GraphTraversal: graphTraversal, Storage: s.Storage, flowset: flowset, flowSearchQuery: flowSearchQuery}, nil
 }
 
-// Reduce flow step
-func (s *FlowGremlinTraversalStep) Reduce(next traversal.GremlinTraversalStep) (traversal.GremlinTraversalStep, error) {
-	if step, ok := next.(*traversal.GremlinTraversalStepHas); ok {
+// pushDownFilter adds a filter to the flow query
+func (s *FlowGremlinTraversalStep) pushDownFilter(filter *filters.Filter) {
+	if s.paramsFilter != nil {
+		s.paramsFilter = filters.NewAndFilter(s.paramsFilter, filter)
+	} else {
+		s.paramsFilter = filter
+	}
+}
+
+// pushDown merges the filtering, dedup and sort steps into the flow query so
+// that they are evaluated by the agent flow tables or by the storage backend
+// instead of on the retrieved flows. It returns whether the step was merged.
+func (s *FlowGremlinTraversalStep) pushDown(next traversal.GremlinTraversalStep) (bool, error) {
+	switch step := next.(type) {
+	case *traversal.GremlinTraversalStepHas:
 		// merge has parameters, useful in case of multiple Has reduce
 		filter, err := paramsToFilter(filters.BoolFilterOp_AND, step.Params...)
 		if err != nil {
-			return s, err
-		}
-
-		if s.paramsFilter != nil {
-			s.paramsFilter = filters.NewAndFilter(s.paramsFilter, filter)
-		} else {
-			s.paramsFilter = filter
+			return false, err
 		}
-		return s, nil
-	} else if step, ok := next.(*traversal.GremlinTraversalStepHasEither); ok {
-		// merge has parameters, useful in case of multiple Has reduce
+		s.pushDownFilter(filter)
+	case *traversal.GremlinTraversalStepHasEither:
 		filter, err := paramsToFilter(filters.BoolFilterOp_OR, step.Params...)
 		if err != nil {
-			return s, err
+			return false, err
 		}
-
-		if s.paramsFilter != nil {
-			s.paramsFilter = filters.NewAndFilter(s.paramsFilter, filter)
-		} else {
-			s.paramsFilter = filter
+		s.pushDownFilter(filter)
+	case *traversal.GremlinTraversalStepHasKey:
+		key, ok := step.Params[0].(string)
+		if !ok {
+			return false, nil
 		}
-		return s, nil
-	}
-
-	if dedupStep, ok := next.(*traversal.GremlinTraversalStepDedup); ok {
+		s.pushDownFilter(filters.NewNotNullFilter(key))
+	case *traversal.GremlinTraversalStepHasNot:
+		key, ok := step.Params[0].(string)
+		if !ok {
+			return false, nil
+		}
+		s.pushDownFilter(filters.NewNullFilter(key))
+	case *traversal.GremlinTraversalStepDedup:
 		s.dedup = true
-		if len(dedupStep.Params) > 0 {
-			s.dedupBy = dedupStep.Params[0].(string)
+		if len(step.Params) > 0 {
+			s.dedupBy = step.Params[0].(string)
 		}
-		return s, nil
-	}
-
-	if sortStep, ok := next.(*traversal.GremlinTraversalStepSort); ok {
-		s.sort = true
-		s.sortBy = defaultSortBy
-		s.sortOrder = common.SortAscending
-		if len(sortStep.Params) > 0 {
+	case *traversal.GremlinTraversalStepSort:
+		sortOrder, sortBy := common.SortAscending, defaultSortBy
+		if len(step.Params) > 0 {
 			var err error
-			if s.sortOrder, s.sortBy, err = traversal.ParseSortParameter(sortStep.Params...); err != nil {
+			if sortOrder, sortBy, err = traversal.ParseSortParameter(step.Params...); err != nil {
 				// in case of error no reduce, the error will be triggered by the non reduce version
-				return next, nil
+				return false, nil
 			}
 		}
+		s.sort, s.sortOrder, s.sortBy = true, sortOrder, sortBy
+	default:
+		return false, nil
+	}
 
-		return s, nil
+	return true, nil
+}
+
+// Reduce flow step. Once a range has been reduced, the next steps apply to
+// the limited set of flows and are not pushed down to the flow query anymore.
+func (s *FlowGremlinTraversalStep) Reduce(next traversal.GremlinTraversalStep) (traversal.GremlinTraversalStep, error) {
+	if s.context.StepContext.PaginationRange == nil {
+		merged, err := s.pushDown(next)
+		if err != nil {
+			return s, err
+		}
+		if merged {
+			return s, nil
+		}
 	}
 
 	switch next.(type) {
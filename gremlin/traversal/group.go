@@ -78,7 +78,7 @@ func (g *GroupGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (tra
 	switch last.(type) {
 	case *FlowTraversalStep:
 		fs := last.(*FlowTraversalStep)
-		return fs.Group(g.StepContext), nil
+		return fs.Group(g.StepContext, g.Params...), nil
 	}
 	return nil, traversal.ErrExecutionError
 }
@@ -165,3 +165,44 @@ func (ts *GroupTraversalStep) MoreThan(ctx traversal.StepContext, s ...interface
 
 	return &GroupTraversalStep{GraphTraversal: ts.GraphTraversal, flowGroupSet: ts.flowGroupSet}
 }
+
+// Sum aggregates integer values mapped by 'key' cross the flows of each group
+func (ts *GroupTraversalStep) Sum(ctx traversal.StepContext, keys ...interface{}) *traversal.GraphTraversalValue {
+	if ts.error != nil {
+		return traversal.NewGraphTraversalValueFromError(ts.error)
+	}
+
+	key, err := sumParams(keys...)
+	if err != nil {
+		return traversal.NewGraphTraversalValueFromError(err)
+	}
+
+	sums := make(map[string]float64, len(ts.flowGroupSet))
+	for group, flows := range ts.flowGroupSet {
+		if sums[group], err = sumFlows(flows, key); err != nil {
+			return traversal.NewGraphTraversalValueFromError(err)
+		}
+	}
+	return traversal.NewGraphTraversalValue(ts.GraphTraversal, sums)
+}
+
+// Percentile returns the percentile of the integer values mapped by 'key'
+// cross the flows of each group. Groups without this field are left out.
+func (ts *GroupTraversalStep) Percentile(ctx traversal.StepContext, keys ...interface{}) *traversal.GraphTraversalValue {
+	if ts.error != nil {
+		return traversal.NewGraphTraversalValueFromError(ts.error)
+	}
+
+	key, p, err := percentileParams(keys...)
+	if err != nil {
+		return traversal.NewGraphTraversalValueFromError(err)
+	}
+
+	percentiles := make(map[string]int64, len(ts.flowGroupSet))
+	for group, flows := range ts.flowGroupSet {
+		if values := flowValues(flows, key); len(values) > 0 {
+			percentiles[group] = percentile(values, p)
+		}
+	}
+	return traversal.NewGraphTraversalValue(ts.GraphTraversal, percentiles)
+}
@@ -104,3 +104,48 @@ func TestGroup(t *testing.T) {
 		t.Fatalf("Tracking456 group should have 0 flow, returned: %v", flowGroup)
 	}
 }
+
+func TestGroupAggregation(t *testing.T) {
+	tc := newFakeTableClient("node1")
+
+	_, flowChan, _ := tc.t.Start(nil)
+	defer tc.t.Stop()
+	for tc.t.State() != common.RunningState {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// flows are active, otherwise the DNS one would time out at the first update
+	now := common.UnixMillis(time.Now())
+	for i, app := range []string{"ICMPv4", "ICMPv4", "ICMPv4", "DNS"} {
+		icmp := newICMPFlow(uint32(i))
+		icmp.Application = app
+		icmp.Start, icmp.Last = now, now
+		icmp.Metric = &flow.FlowMetric{ABBytes: int64(100 * (i + 1))}
+		flowChan <- &flow.ExtFlow{Type: flow.OperationExtFlowType, Obj: &flow.Operation{Type: flow.ReplaceOperation, Flow: icmp, Key: rand.Uint64()}}
+	}
+
+	time.Sleep(time.Second)
+
+	query := `G.Flows().GroupBy("Application").Sum("Metric.ABBytes")`
+	res := execTraversalQuery(t, tc, query)
+	if len(res.Values()) != 1 {
+		t.Fatalf("Should return 1 result, returned: %v", res.Values())
+	}
+	sums := res.Values()[0].(map[string]float64)
+	if sums["ICMPv4"] != 600 || sums["DNS"] != 400 {
+		t.Fatalf("Wrong sums, returned: %v", sums)
+	}
+
+	query = `G.Flows().GroupBy("Application").Percentile("Metric.ABBytes", 50)`
+	res = execTraversalQuery(t, tc, query)
+	percentiles := res.Values()[0].(map[string]int64)
+	if percentiles["ICMPv4"] != 200 || percentiles["DNS"] != 400 {
+		t.Fatalf("Wrong percentiles, returned: %v", percentiles)
+	}
+
+	query = `G.Flows().Percentile("Metric.ABBytes", 95)`
+	res = execTraversalQuery(t, tc, query)
+	if value := res.Values()[0].(int64); value != 400 {
+		t.Fatalf("Wrong percentile, returned: %v", value)
+	}
+}
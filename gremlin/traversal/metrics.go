@@ -18,9 +18,11 @@
 package traversal
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/graffiti/graph/traversal"
@@ -34,6 +36,8 @@ const (
 // MetricsTraversalExtension describes a new extension to enhance the topology
 type MetricsTraversalExtension struct {
 	MetricsToken traversal.Token
+	WindowToken  traversal.Token
+	RateToken    traversal.Token
 }
 
 // MetricsGremlinTraversalStep describes the Metrics gremlin traversal step
@@ -42,10 +46,24 @@ type MetricsGremlinTraversalStep struct {
 	key string
 }
 
+// WindowGremlinTraversalStep describes the Window gremlin traversal step
+type WindowGremlinTraversalStep struct {
+	traversal.GremlinTraversalContext
+	window int64
+	step   int64
+}
+
+// RateGremlinTraversalStep describes the Rate gremlin traversal step
+type RateGremlinTraversalStep struct {
+	traversal.GremlinTraversalContext
+}
+
 // NewMetricsTraversalExtension returns a new graph traversal extension
 func NewMetricsTraversalExtension() *MetricsTraversalExtension {
 	return &MetricsTraversalExtension{
 		MetricsToken: traversalMetricsToken,
+		WindowToken:  traversalWindowToken,
+		RateToken:    traversalRateToken,
 	}
 }
 
@@ -54,6 +72,10 @@ func (e *MetricsTraversalExtension) ScanIdent(s string) (traversal.Token, bool)
 	switch s {
 	case "METRICS":
 		return e.MetricsToken, true
+	case "WINDOW":
+		return e.WindowToken, true
+	case "RATE":
+		return e.RateToken, true
 	}
 	return traversal.IDENT, false
 }
@@ -62,6 +84,15 @@ func (e *MetricsTraversalExtension) ScanIdent(s string) (traversal.Token, bool)
 func (e *MetricsTraversalExtension) ParseStep(t traversal.Token, p traversal.GremlinTraversalContext) (traversal.GremlinTraversalStep, error) {
 	switch t {
 	case e.MetricsToken:
+	case e.WindowToken:
+		return parseWindowStep(p)
+	case e.RateToken:
+		for _, param := range p.Params {
+			if _, ok := param.(string); !ok {
+				return nil, errors.New("Rate parameters have to be metric field names")
+			}
+		}
+		return &RateGremlinTraversalStep{GremlinTraversalContext: p}, nil
 	default:
 		return nil, nil
 	}
@@ -93,15 +124,67 @@ func (e *MetricsTraversalExtension) ParseStep(t traversal.Token, p traversal.Gre
 
 // Exec executes the metrics step
 func (s *MetricsGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
+	return s.ExecContext(context.Background(), last)
+}
+
+// ExecContext executes the metrics step, the storage queries being traced
+// as children of the span of the context
+func (s *MetricsGremlinTraversalStep) ExecContext(ctx context.Context, last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
+	stepContext := s.StepContext
+	stepContext.Context = ctx
+
 	switch tv := last.(type) {
 	case *traversal.GraphTraversalV:
-		return InterfaceMetrics(s.StepContext, tv, s.key), nil
+		return InterfaceMetrics(stepContext, tv, s.key), nil
 	case *FlowTraversalStep:
-		return tv.FlowMetrics(s.StepContext), nil
+		return tv.FlowMetrics(stepContext), nil
 	}
 	return nil, traversal.ErrExecutionError
 }
 
+// parseDuration returns in milliseconds a duration given either as a
+// string like "5m" or as a number of seconds
+func parseDuration(param interface{}) (int64, error) {
+	var d int64
+	switch v := param.(type) {
+	case string:
+		duration, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, err
+		}
+		d = int64(duration / time.Millisecond)
+	case int64:
+		d = v * 1000
+	default:
+		return 0, fmt.Errorf("Invalid duration: %v", param)
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("Duration has to be positive: %v", param)
+	}
+	return d, nil
+}
+
+func parseWindowStep(p traversal.GremlinTraversalContext) (traversal.GremlinTraversalStep, error) {
+	if len(p.Params) == 0 || len(p.Params) > 2 {
+		return nil, fmt.Errorf("Window requires a window duration and an optional sliding step : %v", p.Params)
+	}
+
+	window, err := parseDuration(p.Params[0])
+	if err != nil {
+		return nil, err
+	}
+
+	step := window
+	if len(p.Params) == 2 {
+		if step, err = parseDuration(p.Params[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &WindowGremlinTraversalStep{GremlinTraversalContext: p, window: window, step: step}, nil
+}
+
 // Reduce metrics step
 func (s *MetricsGremlinTraversalStep) Reduce(next traversal.GremlinTraversalStep) (traversal.GremlinTraversalStep, error) {
 	return next, nil
@@ -112,6 +195,46 @@ func (s *MetricsGremlinTraversalStep) Context() *traversal.GremlinTraversalConte
 	return &s.GremlinTraversalContext
 }
 
+// Exec executes the window step
+func (s *WindowGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
+	switch tv := last.(type) {
+	case *MetricsTraversalStep:
+		m := tv.Window(s.StepContext, s.window, s.step)
+		return m, m.Error()
+	}
+	return nil, traversal.ErrExecutionError
+}
+
+// Reduce window step
+func (s *WindowGremlinTraversalStep) Reduce(next traversal.GremlinTraversalStep) (traversal.GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// Context window step
+func (s *WindowGremlinTraversalStep) Context() *traversal.GremlinTraversalContext {
+	return &s.GremlinTraversalContext
+}
+
+// Exec executes the rate step
+func (s *RateGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
+	switch tv := last.(type) {
+	case *MetricsTraversalStep:
+		value := tv.Rate(s.StepContext, s.Params...)
+		return value, value.Error()
+	}
+	return nil, traversal.ErrExecutionError
+}
+
+// Reduce rate step
+func (s *RateGremlinTraversalStep) Reduce(next traversal.GremlinTraversalStep) (traversal.GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// Context rate step
+func (s *RateGremlinTraversalStep) Context() *traversal.GremlinTraversalContext {
+	return &s.GremlinTraversalContext
+}
+
 // MetricsTraversalStep traversal step metric interface counters
 type MetricsTraversalStep struct {
 	GraphTraversal *traversal.GraphTraversal
@@ -170,6 +293,34 @@ func (m *MetricsTraversalStep) Sum(ctx traversal.StepContext, keys ...interface{
 	return traversal.NewGraphTraversalValue(m.GraphTraversal, total)
 }
 
+// Percentile returns the percentile of the integer values mapped by 'key'
+// cross the metrics of each node
+func (m *MetricsTraversalStep) Percentile(ctx traversal.StepContext, keys ...interface{}) *traversal.GraphTraversalValue {
+	if m.error != nil {
+		return traversal.NewGraphTraversalValueFromError(m.error)
+	}
+
+	key, p, err := percentileParams(keys...)
+	if err != nil {
+		return traversal.NewGraphTraversalValueFromError(err)
+	}
+
+	percentiles := make(map[string]int64, len(m.metrics))
+	for id, metrics := range m.metrics {
+		var values []int64
+		for _, metric := range metrics {
+			if value, err := metric.GetFieldInt64(key); err == nil {
+				values = append(values, value)
+			}
+		}
+
+		if len(values) > 0 {
+			percentiles[id] = percentile(values, p)
+		}
+	}
+	return traversal.NewGraphTraversalValue(m.GraphTraversal, percentiles)
+}
+
 func slice(m common.Metric, start, last int64) (common.Metric, common.Metric, common.Metric) {
 	s1, s2 := m.Split(start)
 	if s2 == nil || s2.IsZero() {
@@ -225,6 +376,142 @@ func aggregateMetrics(m []common.Metric, start, last int64, sliceLength int64, r
 	return
 }
 
+// timeRange returns the time slice of the traversal context or, without
+// context, the time range covered by the metrics
+func (m *MetricsTraversalStep) timeRange() (start, last int64) {
+	context := m.GraphTraversal.Graph.GetContext()
+	if context.TimeSlice != nil {
+		return context.TimeSlice.Start, context.TimeSlice.Last
+	}
+
+	// metrics may start at the epoch, 0 can't be used as an unset value
+	first := true
+	for _, array := range m.metrics {
+		for _, metric := range array {
+			if first || start > metric.GetStart() {
+				start, first = metric.GetStart(), false
+			}
+
+			if last < metric.GetLast() {
+				last = metric.GetLast()
+			}
+		}
+	}
+	return
+}
+
+// Window slices the metrics of each element into windows of 'window'
+// milliseconds, sliding every 'step' milliseconds. Each window sums the
+// parts of the metrics it overlaps.
+func (m *MetricsTraversalStep) Window(ctx traversal.StepContext, window, step int64) *MetricsTraversalStep {
+	if m.error != nil {
+		return NewMetricsTraversalStepFromError(m.error)
+	}
+
+	start, last := m.timeRange()
+
+	if steps := (last - start) / step; steps > aggregatesMaxSlices {
+		return NewMetricsTraversalStepFromError(fmt.Errorf("Window available slices exceeded: %d/%d", steps, aggregatesMaxSlices))
+	}
+
+	windowed := make(map[string][]common.Metric, len(m.metrics))
+	for id, metrics := range m.metrics {
+		var windows []common.Metric
+		for wStart := start; wStart < last; wStart += step {
+			wLast := wStart + window
+			if wLast > last {
+				wLast = last
+			}
+
+			var w common.Metric
+			for _, metric := range metrics {
+				if metric.GetLast() <= wStart || metric.GetStart() >= wLast {
+					continue
+				}
+
+				_, s2, _ := slice(metric, wStart, wLast)
+				if s2 == nil {
+					continue
+				}
+
+				if w == nil {
+					// Split may return the metric itself, work on a copy as
+					// windows overlap when sliding
+					w = s2.Sub(s2).Add(s2)
+				} else {
+					w = w.Add(s2)
+				}
+			}
+
+			if w != nil {
+				w.SetStart(wStart)
+				w.SetLast(wLast)
+				windows = append(windows, w)
+			}
+		}
+
+		if len(windows) > 0 {
+			windowed[id] = windows
+		}
+	}
+
+	return NewMetricsTraversalStep(m.GraphTraversal, windowed)
+}
+
+// Rate returns for each metric the per second rate of its fields, or of
+// the given fields only
+func (m *MetricsTraversalStep) Rate(ctx traversal.StepContext, keys ...interface{}) *traversal.GraphTraversalValue {
+	if m.error != nil {
+		return traversal.NewGraphTraversalValueFromError(m.error)
+	}
+
+	var fields []string
+	for _, key := range keys {
+		field, ok := key.(string)
+		if !ok {
+			return traversal.NewGraphTraversalValueFromError(errors.New("Rate parameters have to be metric field names"))
+		}
+		fields = append(fields, field)
+	}
+
+	rates := make(map[string][]map[string]interface{}, len(m.metrics))
+	for id, metrics := range m.metrics {
+		for _, metric := range metrics {
+			duration := metric.GetLast() - metric.GetStart()
+			if duration <= 0 {
+				continue
+			}
+
+			keys := fields
+			if len(keys) == 0 {
+				keys = metric.GetFieldKeys()
+			}
+
+			rate := map[string]interface{}{
+				"Start": metric.GetStart(),
+				"Last":  metric.GetLast(),
+			}
+			for _, key := range keys {
+				if key == "Start" || key == "Last" {
+					continue
+				}
+
+				value, err := metric.GetFieldInt64(key)
+				if err != nil {
+					if len(fields) == 0 {
+						continue
+					}
+					return traversal.NewGraphTraversalValueFromError(err)
+				}
+				rate[key] = float64(value) * 1000 / float64(duration)
+			}
+			rates[id] = append(rates[id], rate)
+		}
+	}
+
+	return traversal.NewGraphTraversalValue(m.GraphTraversal, rates)
+}
+
 // Aggregates merges multiple metrics array into one by summing overlapping
 // metrics. It returns a unique array will all the aggregated metrics.
 func (m *MetricsTraversalStep) Aggregates(ctx traversal.StepContext, s ...interface{}) *MetricsTraversalStep {
@@ -241,25 +528,7 @@ func (m *MetricsTraversalStep) Aggregates(ctx traversal.StepContext, s ...interf
 		sliceLength = sl * 1000 // Millisecond
 	}
 
-	context := m.GraphTraversal.Graph.GetContext()
-
-	var start, last int64
-	if context.TimeSlice != nil {
-		start, last = context.TimeSlice.Start, context.TimeSlice.Last
-	} else {
-		// no time context then take min/max of the metrics
-		for _, array := range m.metrics {
-			for _, metric := range array {
-				if start == 0 || start > metric.GetStart() {
-					start = metric.GetStart()
-				}
-
-				if last < metric.GetLast() {
-					last = metric.GetLast()
-				}
-			}
-		}
-	}
+	start, last := m.timeRange()
 
 	steps := (last - start) / sliceLength
 	if (last-start)%sliceLength != 0 {
@@ -697,3 +697,38 @@ func TestFlowMetricsAggregatesSum3(t *testing.T) {
 
 	testMetricSum(t, metrics, expected, time.Unix(30, 0), 30*time.Second)
 }
+
+func TestMetricsWindowRate(t *testing.T) {
+	g := graph.NewGraph("test", &FakeGraphBackend{}, common.UnknownService)
+	gt := traversal.NewGraphTraversal(g, false)
+
+	metrics := map[string][]common.Metric{
+		"aa": {
+			&flow.FlowMetric{ABBytes: 1000, Start: 0, Last: 10000},
+			&flow.FlowMetric{ABBytes: 2000, Start: 10000, Last: 20000},
+		},
+	}
+
+	step := NewMetricsTraversalStep(gt, metrics).Window(traversal.StepContext{}, 10000, 5000)
+	if err := step.Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	rates := step.Rate(traversal.StepContext{}, "ABBytes").Values()[0].(map[string][]map[string]interface{})["aa"]
+
+	expected := []float64{100, 150, 200, 200}
+	if len(rates) != len(expected) {
+		t.Fatalf("Expected %d windows, got: %v", len(expected), rates)
+	}
+
+	for i, rate := range rates {
+		if rate["ABBytes"] != expected[i] {
+			t.Errorf("Expected a rate of %f for window %d, got: %v", expected[i], i, rate)
+		}
+	}
+
+	// original samples have to be kept intact
+	if fm := metrics["aa"][0].(*flow.FlowMetric); fm.Start != 0 || fm.Last != 10000 || fm.ABBytes != 1000 {
+		t.Errorf("Original metric modified: %v", fm)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// NeighborConflictsTraversalExtension describes a new extension to enhance the topology
+type NeighborConflictsTraversalExtension struct {
+	NeighborConflictsToken traversal.Token
+}
+
+// NeighborConflictsGremlinTraversalStep neighbor conflicts step
+type NeighborConflictsGremlinTraversalStep struct {
+	context traversal.GremlinTraversalContext
+}
+
+// NewNeighborConflictsTraversalExtension returns a new graph traversal extension
+func NewNeighborConflictsTraversalExtension() *NeighborConflictsTraversalExtension {
+	return &NeighborConflictsTraversalExtension{
+		NeighborConflictsToken: traversalNeighborConflictsToken,
+	}
+}
+
+// ScanIdent returns an associated graph token
+func (e *NeighborConflictsTraversalExtension) ScanIdent(s string) (traversal.Token, bool) {
+	switch s {
+	case "NEIGHBORCONFLICTS":
+		return e.NeighborConflictsToken, true
+	}
+	return traversal.IDENT, false
+}
+
+// ParseStep parses neighbor conflicts step
+func (e *NeighborConflictsTraversalExtension) ParseStep(t traversal.Token, p traversal.GremlinTraversalContext) (traversal.GremlinTraversalStep, error) {
+	switch t {
+	case e.NeighborConflictsToken:
+	default:
+		return nil, nil
+	}
+
+	if len(p.Params) != 0 {
+		return nil, fmt.Errorf("NeighborConflicts accepts no parameter : %v", p.Params)
+	}
+
+	return &NeighborConflictsGremlinTraversalStep{context: p}, nil
+}
+
+// Exec NeighborConflicts step
+func (s *NeighborConflictsGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
+	switch tv := last.(type) {
+	case *traversal.GraphTraversalV:
+		tv.GraphTraversal.RLock()
+		conflicts := topology.GetNeighborConflicts(tv.GetNodes())
+		tv.GraphTraversal.RUnlock()
+
+		return NewNeighborConflictsTraversalStep(tv.GraphTraversal, conflicts), nil
+	}
+	return nil, traversal.ErrExecutionError
+}
+
+// Reduce NeighborConflicts step
+func (s *NeighborConflictsGremlinTraversalStep) Reduce(next traversal.GremlinTraversalStep) (traversal.GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// Context NeighborConflicts step
+func (s *NeighborConflictsGremlinTraversalStep) Context() *traversal.GremlinTraversalContext {
+	return &s.context
+}
+
+// NeighborConflictsTraversalStep traversal step of the IP addresses claimed
+// by several MAC addresses
+type NeighborConflictsTraversalStep struct {
+	GraphTraversal *traversal.GraphTraversal
+	conflicts      []*topology.NeighborConflict
+	error          error
+}
+
+// NewNeighborConflictsTraversalStep creates a new traversal neighbor conflicts step
+func NewNeighborConflictsTraversalStep(gt *traversal.GraphTraversal, conflicts []*topology.NeighborConflict) *NeighborConflictsTraversalStep {
+	return &NeighborConflictsTraversalStep{
+		GraphTraversal: gt,
+		conflicts:      conflicts,
+	}
+}
+
+// Values returns the conflicts, one value per IP address and kind of conflict
+func (t *NeighborConflictsTraversalStep) Values() []interface{} {
+	values := make([]interface{}, len(t.conflicts))
+	for i, conflict := range t.conflicts {
+		values[i] = conflict
+	}
+	return values
+}
+
+// MarshalJSON serialize in JSON
+func (t *NeighborConflictsTraversalStep) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Values())
+}
+
+func (t *NeighborConflictsTraversalStep) Error() error {
+	return t.error
+}
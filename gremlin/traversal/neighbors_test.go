@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	"github.com/skydive-project/skydive/topology"
+)
+
+func execNeighborConflictsQuery(t *testing.T, g *graph.Graph, query string) []*topology.NeighborConflict {
+	tr := traversal.NewGremlinTraversalParser()
+	tr.AddTraversalExtension(NewNeighborConflictsTraversalExtension())
+
+	ts, err := tr.Parse(strings.NewReader(query))
+	if err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+
+	res, err := ts.Exec(g, false)
+	if err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+
+	var conflicts []*topology.NeighborConflict
+	for _, value := range res.Values() {
+		conflicts = append(conflicts, value.(*topology.NeighborConflict))
+	}
+	return conflicts
+}
+
+func TestNeighborConflictsStep(t *testing.T) {
+	g := newGraph(t)
+
+	gateway := &topology.Neighbor{IP: net.ParseIP("10.0.0.1"), MAC: "00:00:00:00:00:01", State: []string{"NUD_REACHABLE"}}
+	g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth0", "MAC": "00:00:00:00:00:01", "IPV4": []string{"10.0.0.1/24"}})
+	g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth1", "MAC": "00:00:00:00:00:02", "IPV4": []string{"10.0.0.2/24"}, "Neighbors": &topology.Neighbors{gateway}})
+
+	if conflicts := execNeighborConflictsQuery(t, g, "G.V().NeighborConflicts()"); len(conflicts) != 0 {
+		t.Fatalf("Should not return any conflict, got: %+v", conflicts)
+	}
+
+	// a host answering the ARP requests for the gateway
+	spoofed := &topology.Neighbor{IP: net.ParseIP("10.0.0.1"), MAC: "00:00:00:00:00:03", State: []string{"NUD_STALE"}}
+	n3, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth2", "MAC": "00:00:00:00:00:04", "IPV4": []string{"10.0.0.3/24"}, "Neighbors": &topology.Neighbors{spoofed}})
+
+	// unresolved entries are not taken into account
+	incomplete := &topology.Neighbor{IP: net.ParseIP("10.0.0.2"), MAC: "00:00:00:00:00:00", State: []string{"NUD_INCOMPLETE"}}
+	g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth3", "MAC": "00:00:00:00:00:05", "Neighbors": &topology.Neighbors{incomplete}})
+
+	conflicts := execNeighborConflictsQuery(t, g, "G.V().NeighborConflicts()")
+	if len(conflicts) != 1 || conflicts[0].Type != topology.SpoofedNeighborConflict || conflicts[0].IP != "10.0.0.1" {
+		t.Fatalf("Should return the spoofed gateway, got: %+v", conflicts)
+	}
+
+	if claims := conflicts[0].Claims; len(claims) != 2 || claims[0].Name != "eth0" || claims[1].Node != n3.ID || claims[1].MAC != "00:00:00:00:00:03" {
+		t.Errorf("Should return the claims of the gateway and of the spoofed entry, got: %+v", claims)
+	}
+
+	// the same IP held by another interface
+	g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth4", "MAC": "00:00:00:00:00:06", "IPV4": []string{"10.0.0.2/24"}})
+
+	conflicts = execNeighborConflictsQuery(t, g, "G.V().NeighborConflicts()")
+	if len(conflicts) != 2 || conflicts[1].Type != topology.DuplicateIPConflict || conflicts[1].IP != "10.0.0.2" || len(conflicts[1].Claims) != 2 {
+		t.Fatalf("Should return the duplicate IP, got: %+v", conflicts)
+	}
+
+	// limiting the detection to some nodes
+	if conflicts := execNeighborConflictsQuery(t, g, "G.V().Has('Name', Within('eth0', 'eth1', 'eth4')).NeighborConflicts()"); len(conflicts) != 1 {
+		t.Errorf("Should only return the duplicate IP, got: %+v", conflicts)
+	}
+}
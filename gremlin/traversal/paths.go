@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+)
+
+const defaultAllPathsMaxDepth = 10
+
+// PathsTraversalExtension describes a new extension to enhance the topology
+// with path analysis steps
+type PathsTraversalExtension struct {
+	ShortestPathToken   traversal.Token
+	KShortestPathsToken traversal.Token
+	AllPathsToken       traversal.Token
+}
+
+// PathsGremlinTraversalStep describes the ShortestPath, KShortestPaths and
+// AllPaths steps
+type PathsGremlinTraversalStep struct {
+	traversal.GremlinTraversalContext
+	token       traversal.Token
+	target      graph.Metadata
+	edgeFilter  graph.ElementMatcher
+	weightField string
+	count       int
+}
+
+// NewPathsTraversalExtension returns a new graph traversal extension
+func NewPathsTraversalExtension() *PathsTraversalExtension {
+	return &PathsTraversalExtension{
+		ShortestPathToken:   traversalShortestPathToken,
+		KShortestPathsToken: traversalKShortestPathsToken,
+		AllPathsToken:       traversalAllPathsToken,
+	}
+}
+
+// ScanIdent returns an associated graph token
+func (e *PathsTraversalExtension) ScanIdent(s string) (traversal.Token, bool) {
+	switch s {
+	case "SHORTESTPATH":
+		return e.ShortestPathToken, true
+	case "KSHORTESTPATHS":
+		return e.KShortestPathsToken, true
+	case "ALLPATHS":
+		return e.AllPathsToken, true
+	}
+	return traversal.IDENT, false
+}
+
+// ParseStep parses the path steps. The first parameter is the metadata of
+// the destination nodes, then come in any order the number of paths for
+// KShortestPaths or the maximum depth for AllPaths, the edge metadata field
+// holding the weight and the metadata of the edges to follow.
+func (e *PathsTraversalExtension) ParseStep(t traversal.Token, p traversal.GremlinTraversalContext) (traversal.GremlinTraversalStep, error) {
+	var name string
+	switch t {
+	case e.ShortestPathToken:
+		name = "ShortestPath"
+	case e.KShortestPathsToken:
+		name = "KShortestPaths"
+	case e.AllPathsToken:
+		name = "AllPaths"
+	default:
+		return nil, nil
+	}
+
+	if len(p.Params) == 0 {
+		return nil, fmt.Errorf("%s requires the metadata of the destination nodes", name)
+	}
+
+	target, ok := p.Params[0].(graph.Metadata)
+	if !ok {
+		return nil, fmt.Errorf("%s first parameter has to be the metadata of the destination nodes", name)
+	}
+
+	step := &PathsGremlinTraversalStep{GremlinTraversalContext: p, token: t, target: target}
+	if t == e.AllPathsToken {
+		step.count = defaultAllPathsMaxDepth
+	}
+
+	for _, param := range p.Params[1:] {
+		switch param := param.(type) {
+		case int64:
+			if t == e.ShortestPathToken || param <= 0 {
+				return nil, fmt.Errorf("%s invalid parameter: %d", name, param)
+			}
+			step.count = int(param)
+		case string:
+			if t == e.AllPathsToken {
+				return nil, errors.New("AllPaths doesn't support weights")
+			}
+			step.weightField = param
+		case graph.Metadata:
+			step.edgeFilter = param
+		default:
+			return nil, fmt.Errorf("%s invalid parameter: %v", name, param)
+		}
+	}
+
+	if t == e.KShortestPathsToken && step.count == 0 {
+		return nil, errors.New("KShortestPaths requires the number of paths")
+	}
+
+	return step, nil
+}
+
+// Exec path step
+func (s *PathsGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
+	tv, ok := last.(*traversal.GraphTraversalV)
+	if !ok {
+		return nil, traversal.ErrExecutionError
+	}
+
+	if err := tv.Error(); err != nil {
+		return nil, err
+	}
+
+	tv.GraphTraversal.RLock()
+	defer tv.GraphTraversal.RUnlock()
+
+	g := tv.GraphTraversal.Graph
+
+	var paths []*graph.Path
+	visited := make(map[graph.Identifier]bool)
+	for _, n := range tv.GetNodes() {
+		if visited[n.ID] {
+			continue
+		}
+		visited[n.ID] = true
+
+		switch s.token {
+		case traversalShortestPathToken:
+			if path := g.LookupWeightedShortestPath(n, s.target, s.edgeFilter, s.weightField); path != nil {
+				paths = append(paths, path)
+			}
+		case traversalKShortestPathsToken:
+			paths = append(paths, g.LookupKShortestPaths(n, s.target, s.edgeFilter, s.weightField, s.count)...)
+		case traversalAllPathsToken:
+			paths = append(paths, g.LookupAllPaths(n, s.target, s.edgeFilter, s.count)...)
+		}
+	}
+
+	nodes := make([][]*graph.Node, len(paths))
+	for i, path := range paths {
+		nodes[i] = path.Nodes
+	}
+
+	return traversal.NewGraphTraversalShortestPath(tv.GraphTraversal, nodes), nil
+}
+
+// Reduce path step
+func (s *PathsGremlinTraversalStep) Reduce(next traversal.GremlinTraversalStep) (traversal.GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// Context path step
+func (s *PathsGremlinTraversalStep) Context() *traversal.GremlinTraversalContext {
+	return &s.GremlinTraversalContext
+}
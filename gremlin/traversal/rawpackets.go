@@ -18,6 +18,7 @@
 package traversal
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 
@@ -27,6 +28,26 @@ import (
 	"github.com/skydive-project/skydive/graffiti/graph/traversal"
 )
 
+type rawPacketDecryptionKey struct{}
+
+// RawPacketDecrypter is implemented by the flow storages keeping the raw
+// packets encrypted at rest
+type RawPacketDecrypter interface {
+	DecryptRawPackets(packets []*flow.RawPacket) error
+}
+
+// WithRawPacketDecryption returns a context in which the RawPackets steps
+// decrypt the raw packets encrypted at rest, for the users allowed to read
+// them in clear
+func WithRawPacketDecryption(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rawPacketDecryptionKey{}, true)
+}
+
+func rawPacketDecryption(ctx context.Context) bool {
+	decrypt, _ := ctx.Value(rawPacketDecryptionKey{}).(bool)
+	return decrypt
+}
+
 // RawPacketsTraversalExtension describes a new extension to enhance the topology
 type RawPacketsTraversalExtension struct {
 	RawPacketsToken traversal.Token
@@ -71,10 +92,19 @@ func (e *RawPacketsTraversalExtension) ParseStep(t traversal.Token, p traversal.
 
 // Exec RawPackets step
 func (r *RawPacketsGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
+	return r.ExecContext(context.Background(), last)
+}
+
+// ExecContext RawPackets step, the storage query being traced as a child of
+// the span of the context
+func (r *RawPacketsGremlinTraversalStep) ExecContext(ctx context.Context, last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
 	switch last.(type) {
 	case *FlowTraversalStep:
+		stepContext := r.StepContext
+		stepContext.Context = ctx
+
 		fs := last.(*FlowTraversalStep)
-		return fs.RawPackets(r.StepContext), nil
+		return fs.RawPackets(stepContext), nil
 	}
 
 	return nil, traversal.ErrExecutionError
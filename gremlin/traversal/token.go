@@ -20,17 +20,25 @@ package traversal
 import "github.com/skydive-project/skydive/graffiti/graph/traversal"
 
 const (
-	traversalFlowToken        traversal.Token = 1001
-	traversalHopsToken        traversal.Token = 1002
-	traversalNodesToken       traversal.Token = 1003
-	traversalCaptureNodeToken traversal.Token = 1004
-	traversalAggregatesToken  traversal.Token = 1005
-	traversalRawPacketsToken  traversal.Token = 1006
-	traversalBpfToken         traversal.Token = 1007
-	traversalMetricsToken     traversal.Token = 1008
-	traversalSocketsToken     traversal.Token = 1009
-	traversalDescendantsToken traversal.Token = 1010
-	traversalNextHopToken     traversal.Token = 1011
-	traversalGroupToken       traversal.Token = 1012
-	traversalMoreThanToken    traversal.Token = 1013
+	traversalFlowToken              traversal.Token = 1001
+	traversalHopsToken              traversal.Token = 1002
+	traversalNodesToken             traversal.Token = 1003
+	traversalCaptureNodeToken       traversal.Token = 1004
+	traversalAggregatesToken        traversal.Token = 1005
+	traversalRawPacketsToken        traversal.Token = 1006
+	traversalBpfToken               traversal.Token = 1007
+	traversalMetricsToken           traversal.Token = 1008
+	traversalSocketsToken           traversal.Token = 1009
+	traversalDescendantsToken       traversal.Token = 1010
+	traversalNextHopToken           traversal.Token = 1011
+	traversalGroupToken             traversal.Token = 1012
+	traversalMoreThanToken          traversal.Token = 1013
+	traversalDiffToken              traversal.Token = 1014
+	traversalPercentileToken        traversal.Token = 1015
+	traversalWindowToken            traversal.Token = 1016
+	traversalRateToken              traversal.Token = 1017
+	traversalShortestPathToken      traversal.Token = 1018
+	traversalKShortestPathsToken    traversal.Token = 1019
+	traversalAllPathsToken          traversal.Token = 1020
+	traversalNeighborConflictsToken traversal.Token = 1021
 )
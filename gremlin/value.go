@@ -49,9 +49,17 @@ func (v ValueString) String() string {
 	return string(v)
 }
 
+// ASC const definition
+const ASC = ValueString("ASC")
+
 // DESC const definition
 const DESC = ValueString("DESC")
 
+// Binding used to reference a value bound to the query by its name
+func Binding(name string) ValueString {
+	return ValueString("$" + name)
+}
+
 // Quote used to quote string values as needed by query
 func Quote(s string) ValueString {
 	escaped, err := json.Marshal(s)
@@ -64,8 +72,8 @@ func Quote(s string) ValueString {
 }
 
 // Regex used for constructing a regexp expression string
-func Regex(s string) ValueString {
-	return ValueString(fmt.Sprintf("Regex(%s)", Quote(s)))
+func Regex(v interface{}) ValueString {
+	return newValueString("Regex", v)
 }
 
 func newValueString(name string, list ...interface{}) ValueString {
@@ -101,6 +109,11 @@ func Ipv4Range(list ...interface{}) ValueString {
 	return newValueString("Ipv4Range", list...)
 }
 
+// Cidr append a Cidr() operation to query
+func Cidr(cidr string) ValueString {
+	return newValueString("Cidr", cidr)
+}
+
 // Inside append a Inside() operation to query
 func Inside(list ...interface{}) ValueString {
 	return newValueString("Inside", list...)
@@ -126,7 +139,17 @@ func Ne(v interface{}) ValueString {
 	return newValueString("Ne", v)
 }
 
+// Nee append a Nee() operation to query
+func Nee(v interface{}) ValueString {
+	return newValueString("Nee", v)
+}
+
 // Within append a Within() operation to query
 func Within(list ...interface{}) ValueString {
 	return newValueString("Within", list...)
 }
+
+// Without append a Without() operation to query
+func Without(list ...interface{}) ValueString {
+	return newValueString("Without", list...)
+}
@@ -25,10 +25,12 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"time"
 
+	"github.com/skydive-project/skydive/certificate"
 	"github.com/skydive-project/skydive/common"
 )
 
@@ -60,7 +62,7 @@ func readBody(resp *http.Response) string {
 func getHTTPClient(tlsConfig *tls.Config) *http.Client {
 	client := &http.Client{}
 	if tlsConfig != nil {
-		tr := &http.Transport{TLSClientConfig: tlsConfig}
+		tr := &http.Transport{DialTLS: certificate.DialTLS(&net.Dialer{}, tlsConfig)}
 		client = &http.Client{Transport: tr}
 	}
 	return client
@@ -78,7 +80,12 @@ func NewRestClient(url *url.URL, authOpts *AuthenticationOpts, tlsConfig *tls.Co
 
 // Request issues a request to the API
 func (c *RestClient) Request(method, path string, body io.Reader, header http.Header) (*http.Response, error) {
-	url := c.url.ResolveReference(&url.URL{Path: path})
+	ref, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	url := c.url.ResolveReference(ref)
 	req, err := http.NewRequest(method, url.String(), body)
 	if err != nil {
 		return nil, err
@@ -179,6 +186,28 @@ func (c *CrudClient) Create(resource string, value interface{}, opts *CreateOpti
 	return common.JSONDecode(resp.Body, value)
 }
 
+// Validate submits a resource in dry-run mode and fills the passed report
+// with the validation result, without creating anything
+func (c *CrudClient) Validate(resource string, value interface{}, report interface{}) error {
+	s, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	contentReader := bytes.NewReader(s)
+	resp, err := c.Request("POST", resource+"?dry_run=true", contentReader, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnprocessableEntity {
+		return fmt.Errorf("Failed to validate %s, %s: %s", resource, resp.Status, readBody(resp))
+	}
+
+	return common.JSONDecode(resp.Body, report)
+}
+
 // Update modify a resource using a PUT call to the API
 func (c *CrudClient) Update(resource string, id string, value interface{}) error {
 	s, err := json.Marshal(value)
@@ -34,6 +34,7 @@ import (
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/rbac"
+	"github.com/skydive-project/skydive/tracing"
 )
 
 // PathPrefix describes the prefix of the path of an URL
@@ -82,7 +83,7 @@ func (s *Server) RegisterRoutes(routes []Route, auth AuthenticationBackend) {
 		r := s.Router.
 			Methods(route.Method).
 			Name(route.Name).
-			Handler(auth.Wrap(route.HandlerFunc))
+			Handler(tracing.Handler(route.Name, auth.Wrap(route.HandlerFunc)))
 		switch p := route.Path.(type) {
 		case string:
 			r.Path(p)
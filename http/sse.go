@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package http
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultSSEQueueSize = 10000
+
+type sseEvent struct {
+	name string
+	data []byte
+}
+
+// SSEStream is a server-sent events stream. The events are queued so that
+// a slow client never blocks the producers, the stream being closed once
+// its queue is full. EventSource clients then reconnect by themselves.
+type SSEStream struct {
+	events    chan sseEvent
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Send queues an event, it returns false if the stream is closed
+func (s *SSEStream) Send(name string, data []byte) bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	select {
+	case s.events <- sseEvent{name: name, data: data}:
+		return true
+	default:
+		s.Close()
+		return false
+	}
+}
+
+// Close closes the stream
+func (s *SSEStream) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+func writeSSEEvent(w http.ResponseWriter, event sseEvent) error {
+	var b bytes.Buffer
+	b.WriteString("event: " + event.name + "\n")
+	for _, line := range bytes.Split(event.data, []byte("\n")) {
+		b.WriteString("data: ")
+		b.Write(line)
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// Serve writes the events of the stream to the response until either the
+// client disconnects or the stream is closed. A comment is sent on idle
+// streams every keepAlive so that the proxies don't close the connection.
+func (s *SSEStream) Serve(w http.ResponseWriter, r *http.Request, keepAlive time.Duration) error {
+	defer s.Close()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("Streaming not supported by the response writer")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-s.done:
+			return nil
+		case event := <-s.events:
+			if err := writeSSEEvent(w, event); err != nil {
+				return err
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			if _, err := w.Write([]byte(": keep-alive\n\n")); err != nil {
+				return err
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// NewSSEStream returns a stream queuing up to queueSize events
+func NewSSEStream(queueSize int) *SSEStream {
+	if queueSize <= 0 {
+		queueSize = defaultSSEQueueSize
+	}
+
+	return &SSEStream{
+		events: make(chan sseEvent, queueSize),
+		done:   make(chan struct{}),
+	}
+}
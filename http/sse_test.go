@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSSEStreamEvents(t *testing.T) {
+	stream := NewSSEStream(10)
+	stream.Send("NodeAdded", []byte(`{"ID":"1"}`))
+	stream.Send("NodeDeleted", []byte("{\n}"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			stream.Close()
+		}()
+		stream.Serve(w, r, time.Minute)
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Wrong content type: %s", ct)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "event: NodeAdded\ndata: {\"ID\":\"1\"}\n\nevent: NodeDeleted\ndata: {\ndata: }\n\n"
+	if string(body) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(body))
+	}
+}
+
+func TestSSEStreamOverflow(t *testing.T) {
+	stream := NewSSEStream(1)
+	if !stream.Send("NodeAdded", nil) {
+		t.Error("Event should be queued")
+	}
+	if stream.Send("NodeAdded", nil) {
+		t.Error("Stream should be closed once its queue is full")
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	auth "github.com/abbot/go-http-auth"
+)
+
+// APITokenPrefix is the prefix of the API tokens of the service accounts,
+// telling them apart from the tokens of the authentication backends
+const APITokenPrefix = "skt_"
+
+// TokenValidator returns the user an API token authenticates
+type TokenValidator interface {
+	ValidateToken(token string) (string, error)
+}
+
+// TokenAuthenticationBackend authenticates the requests carrying an API
+// token with a validator, and the other ones with the wrapped backend
+type TokenAuthenticationBackend struct {
+	AuthenticationBackend
+	validator TokenValidator
+}
+
+// Wrap an HTTP handler with API token authentication
+func (b *TokenAuthenticationBackend) Wrap(wrapped auth.AuthenticatedHandlerFunc) http.HandlerFunc {
+	backendWrapped := b.AuthenticationBackend.Wrap(wrapped)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(tokenFromRequest(r), "Bearer ")
+		if !strings.HasPrefix(token, APITokenPrefix) {
+			backendWrapped(w, r)
+			return
+		}
+
+		if username, err := b.validator.ValidateToken(token); err != nil {
+			Unauthorized(w, r)
+		} else {
+			authCallWrapped(w, r, username, wrapped)
+		}
+	}
+}
+
+// NewTokenAuthenticationBackend returns a backend accepting the API tokens
+// on top of the given backend
+func NewTokenAuthenticationBackend(backend AuthenticationBackend, validator TokenValidator) *TokenAuthenticationBackend {
+	return &TokenAuthenticationBackend{
+		AuthenticationBackend: backend,
+		validator:             validator,
+	}
+}
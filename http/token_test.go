@@ -0,0 +1,75 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package http
+
+import (
+	"net/http"
+	"testing"
+
+	auth "github.com/abbot/go-http-auth"
+)
+
+type fakeTokenValidator map[string]string
+
+func (v fakeTokenValidator) ValidateToken(token string) (string, error) {
+	if user, found := v[token]; found {
+		return user, nil
+	}
+	return "", ErrWrongCredentials
+}
+
+func TestTokenAuthenticate(t *testing.T) {
+	provider := NewHtpasswdMapProvider(map[string]string{"user1": "pass1"})
+
+	basic, err := NewBasicAuthenticationBackend("basic", provider.SecretProvider(), DefaultUserRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := NewTokenAuthenticationBackend(basic, fakeTokenValidator{APITokenPrefix + "secret": "serviceaccount:ci"})
+
+	var username string
+	handler := backend.Wrap(func(w http.ResponseWriter, r *auth.AuthenticatedRequest) { username = r.Username })
+
+	authenticate := func(header, value string) (string, int) {
+		username = ""
+		w := &fakeResponseWriter{headers: make(http.Header)}
+		r := &http.Request{Header: make(http.Header)}
+		r.Header.Set(header, value)
+		handler(w, r)
+		return username, w.status
+	}
+
+	if user, _ := authenticate("Authorization", "Bearer "+APITokenPrefix+"secret"); user != "serviceaccount:ci" {
+		t.Errorf("Bearer token should authenticate the service account, got '%s'", user)
+	}
+
+	if user, _ := authenticate("X-Auth-Token", APITokenPrefix+"secret"); user != "serviceaccount:ci" {
+		t.Errorf("X-Auth-Token should authenticate the service account, got '%s'", user)
+	}
+
+	if user, status := authenticate("X-Auth-Token", APITokenPrefix+"revoked"); user != "" || status != http.StatusUnauthorized {
+		t.Errorf("Unknown token should be rejected, got '%s' with status %d", user, status)
+	}
+
+	r := &http.Request{Header: make(http.Header)}
+	r.SetBasicAuth("user1", "pass1")
+	if user, _ := authenticate("Authorization", r.Header.Get("Authorization")); user != "user1" {
+		t.Errorf("Basic credentials should be handled by the wrapped backend, got '%s'", user)
+	}
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ids
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/skydive-project/skydive/alert"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	"github.com/skydive-project/skydive/gremlin"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// MetadataKey is the metadata key of the IDS alerts summary of the nodes
+const MetadataKey = "IDS"
+
+// Correlation describes an IDS alert with the flows and the nodes it
+// relates to
+type Correlation struct {
+	Event *EveEvent
+	// UUIDs of the matching flows
+	Flows []string
+	// IDs of the nodes having captured the flows or owning the IP addresses
+	Nodes []graph.Identifier
+}
+
+// Correlator correlates the IDS alerts with the flows and the topology
+type Correlator struct {
+	Graph  *graph.Graph
+	Pool   ws.StructSpeakerPool
+	parser *traversal.GremlinTraversalParser
+	slack  time.Duration
+}
+
+func flowQuery(e *EveEvent, at time.Time, slack time.Duration, reverse bool) (gremlin.QueryString, map[string]interface{}) {
+	bindings := map[string]interface{}{
+		"a": e.SrcIP,
+		"b": e.DestIP,
+	}
+	if reverse {
+		bindings["a"], bindings["b"] = e.DestIP, e.SrcIP
+	}
+
+	query := gremlin.G
+	if !at.IsZero() {
+		bindings["at"] = common.UnixMillis(at.Add(slack))
+		bindings["duration"] = int64(2 * slack / time.Second)
+		query = query.Context(gremlin.Binding("at"), gremlin.Binding("duration"))
+	}
+
+	filters := []interface{}{"Network.A", gremlin.Binding("a"), "Network.B", gremlin.Binding("b")}
+	switch proto := e.Protocol(); proto {
+	case "TCP", "UDP", "SCTP":
+		bindings["protocol"], bindings["pa"], bindings["pb"] = proto, e.SrcPort, e.DestPort
+		if reverse {
+			bindings["pa"], bindings["pb"] = e.DestPort, e.SrcPort
+		}
+		filters = append(filters,
+			"Transport.Protocol", gremlin.Binding("protocol"),
+			"Transport.A", gremlin.Binding("pa"),
+			"Transport.B", gremlin.Binding("pb"))
+	}
+
+	return query.Flows().Has(filters...), bindings
+}
+
+// lookupFlows returns the flows of both directions matching the 5-tuple of
+// the event. at is zero to look at the live flows.
+func (c *Correlator) lookupFlows(e *EveEvent, at time.Time) (flows []*flow.Flow, err error) {
+	for _, reverse := range []bool{false, true} {
+		query, bindings := flowQuery(e, at, c.slack, reverse)
+
+		ts, err := c.parser.ParseWithBindings(query.String(), bindings)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := ts.Exec(c.Graph, true)
+		if err != nil {
+			return nil, err
+		}
+
+		if fs, ok := res.(*ge.FlowTraversalStep); ok {
+			for _, value := range fs.Values() {
+				flows = append(flows, value.(*flow.Flow))
+			}
+		}
+	}
+	return flows, nil
+}
+
+// active returns whether the flow was active around the given time
+func active(f *flow.Flow, t time.Time, slack time.Duration) bool {
+	ms := common.UnixMillis(t)
+	return f.Start-int64(slack/time.Millisecond) <= ms && ms <= f.Last+int64(slack/time.Millisecond)
+}
+
+// lookupNodes returns the nodes having captured the flows and the ones
+// owning the IP addresses of the event
+func (c *Correlator) lookupNodes(e *EveEvent, flows []*flow.Flow) []*graph.Node {
+	c.Graph.RLock()
+	defer c.Graph.RUnlock()
+
+	var nodes []*graph.Node
+	seen := make(map[graph.Identifier]bool)
+	add := func(n *graph.Node) {
+		if !seen[n.ID] {
+			seen[n.ID] = true
+			nodes = append(nodes, n)
+		}
+	}
+
+	for _, f := range flows {
+		if f.NodeTID != "" {
+			if n := c.Graph.LookupFirstNode(graph.Metadata{"TID": f.NodeTID}); n != nil {
+				add(n)
+			}
+		}
+	}
+
+	for _, n := range c.Graph.GetNodes(nil) {
+		for _, field := range []string{"IPV4", "IPV6"} {
+			addrs, _ := n.GetFieldStringList(field)
+			for _, addr := range addrs {
+				if ip := strings.SplitN(addr, "/", 2)[0]; ip == e.SrcIP || ip == e.DestIP {
+					add(n)
+				}
+			}
+		}
+	}
+
+	return nodes
+}
+
+// annotate updates the IDS alerts summary of the node
+func (c *Correlator) annotate(n *graph.Node, e *EveEvent, t time.Time) {
+	var count int64
+	if summary, err := n.GetField(MetadataKey); err == nil {
+		if m, ok := summary.(map[string]interface{}); ok {
+			count, _ = common.ToInt64(m["Count"])
+		}
+	}
+
+	c.Graph.AddMetadata(n, MetadataKey, map[string]interface{}{
+		"Count":         count + 1,
+		"LastSignature": e.Alert.Signature,
+		"LastSeverity":  e.Alert.Severity,
+		"LastTime":      common.UnixMillis(t),
+	})
+}
+
+// Correlate looks up the flows and the nodes related to an IDS alert,
+// annotates the nodes and broadcasts the alert
+func (c *Correlator) Correlate(e *EveEvent) (*Correlation, error) {
+	t, err := e.Time()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid event timestamp '%s': %s", e.Timestamp, err)
+	}
+
+	var flows []*flow.Flow
+	live, err := c.lookupFlows(e, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range live {
+		if active(f, t, c.slack) {
+			flows = append(flows, f)
+		}
+	}
+
+	// fallback to the flow storage for the events of the past flows
+	if len(flows) == 0 {
+		if flows, err = c.lookupFlows(e, t); err != nil {
+			logging.GetLogger().Debugf("Failed to lookup flows of IDS alert in storage: %s", err)
+		}
+	}
+
+	correlation := &Correlation{Event: e, Flows: []string{}, Nodes: []graph.Identifier{}}
+	for _, f := range flows {
+		correlation.Flows = append(correlation.Flows, f.UUID)
+	}
+
+	nodes := c.lookupNodes(e, flows)
+
+	c.Graph.Lock()
+	for _, n := range nodes {
+		c.annotate(n, e, t)
+		correlation.Nodes = append(correlation.Nodes, n.ID)
+	}
+	c.Graph.Unlock()
+
+	msg := alert.Message{
+		UUID:       fmt.Sprintf("ids/suricata/%d", e.Alert.SignatureID),
+		Timestamp:  t.UTC(),
+		ReasonData: correlation,
+	}
+	c.Pool.BroadcastMessage(ws.NewStructMessage(alert.Namespace, "Alert", msg))
+
+	return correlation, nil
+}
+
+// CorrelateSuricata correlates the alerts of a stream of Suricata EVE events
+func (c *Correlator) CorrelateSuricata(r io.Reader) (interface{}, error) {
+	events, err := ParseEve(r)
+	if err != nil {
+		return nil, err
+	}
+
+	correlations := []*Correlation{}
+	for _, e := range events {
+		correlation, err := c.Correlate(e)
+		if err != nil {
+			return nil, err
+		}
+		correlations = append(correlations, correlation)
+	}
+
+	return correlations, nil
+}
+
+// NewCorrelator returns a new IDS alerts correlator. The flows are matched
+// when they were active within slack of the alerts.
+func NewCorrelator(g *graph.Graph, parser *traversal.GremlinTraversalParser, pool ws.StructSpeakerPool, slack time.Duration) *Correlator {
+	return &Correlator{
+		Graph:  g,
+		Pool:   pool,
+		parser: parser,
+		slack:  slack,
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ids
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+)
+
+// eveTimeFormat is the format of the timestamps of the Suricata EVE events
+const eveTimeFormat = "2006-01-02T15:04:05.999999-0700"
+
+// EveAlert describes the alert section of a Suricata EVE event
+type EveAlert struct {
+	Action      string `json:"action,omitempty"`
+	SignatureID int64  `json:"signature_id"`
+	Signature   string `json:"signature"`
+	Category    string `json:"category,omitempty"`
+	Severity    int64  `json:"severity"`
+}
+
+// EveEvent describes a Suricata EVE JSON event
+type EveEvent struct {
+	Timestamp string    `json:"timestamp"`
+	FlowID    int64     `json:"flow_id,omitempty"`
+	EventType string    `json:"event_type"`
+	SrcIP     string    `json:"src_ip"`
+	SrcPort   int64     `json:"src_port,omitempty"`
+	DestIP    string    `json:"dest_ip"`
+	DestPort  int64     `json:"dest_port,omitempty"`
+	Proto     string    `json:"proto"`
+	Alert     *EveAlert `json:"alert,omitempty"`
+}
+
+// Time returns the time of the event
+func (e *EveEvent) Time() (time.Time, error) {
+	return time.Parse(eveTimeFormat, e.Timestamp)
+}
+
+// Protocol returns the transport protocol of the event using the flow
+// protocol names
+func (e *EveEvent) Protocol() string {
+	switch proto := strings.ToUpper(e.Proto); proto {
+	case "ICMP":
+		return "ICMPV4"
+	case "IPV6-ICMP":
+		return "ICMPV6"
+	default:
+		return proto
+	}
+}
+
+// ParseEve reads a stream of EVE JSON events, one per line as written by
+// Suricata, and returns the alerts
+func ParseEve(r io.Reader) ([]*EveEvent, error) {
+	var alerts []*EveEvent
+
+	decoder := json.NewDecoder(r)
+	for {
+		var event EveEvent
+		if err := decoder.Decode(&event); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if event.EventType == "alert" && event.Alert != nil {
+			alerts = append(alerts, &event)
+		}
+	}
+
+	return alerts, nil
+}
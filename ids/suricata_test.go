@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ids
+
+import (
+	"strings"
+	"testing"
+)
+
+const eveEvents = `{"timestamp":"2019-09-10T14:33:38.123456+0200","flow_id":1234,"event_type":"flow","src_ip":"10.0.0.1","src_port":45000,"dest_ip":"10.0.0.2","dest_port":80,"proto":"TCP"}
+{"timestamp":"2019-09-10T14:33:39.000000+0200","flow_id":1234,"event_type":"alert","src_ip":"10.0.0.1","src_port":45000,"dest_ip":"10.0.0.2","dest_port":80,"proto":"TCP","alert":{"action":"allowed","signature_id":2001219,"signature":"ET SCAN Potential SSH Scan","category":"Attempted Information Leak","severity":2}}
+{"timestamp":"2019-09-10T14:33:40.000000+0200","event_type":"alert","src_ip":"fe80::1","dest_ip":"fe80::2","proto":"IPv6-ICMP","alert":{"signature_id":1,"signature":"ICMPv6 test","severity":3}}
+`
+
+func TestParseEve(t *testing.T) {
+	alerts, err := ParseEve(strings.NewReader(eveEvents))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(alerts) != 2 {
+		t.Fatalf("2 alerts expected, got %d", len(alerts))
+	}
+
+	e := alerts[0]
+	if e.Alert.SignatureID != 2001219 || e.SrcPort != 45000 || e.Protocol() != "TCP" {
+		t.Errorf("Wrong alert: %+v", e)
+	}
+
+	ts, err := e.Time()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts.UTC().Hour() != 12 || ts.Second() != 39 {
+		t.Errorf("Wrong timestamp: %s", ts)
+	}
+
+	if proto := alerts[1].Protocol(); proto != "ICMPV6" {
+		t.Errorf("ICMPV6 protocol expected, got %s", proto)
+	}
+
+	if _, err := ParseEve(strings.NewReader("{invalid")); err == nil {
+		t.Error("Error expected on invalid events")
+	}
+}
@@ -667,6 +667,10 @@ export function IPV4RANGE(param: any): Predicate {
     return new Predicate("IPV4RANGE", param)
 }
 
+export function CIDR(param: any): Predicate {
+    return new Predicate("CIDR", param)
+}
+
 export function REGEX(param: any): Predicate {
     return new Predicate("REGEX", param)
 }
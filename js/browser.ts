@@ -25,6 +25,7 @@ window.LT = apiLib.LT
 window.GTE = apiLib.GTE
 window.LTE = apiLib.LTE
 window.IPV4RANGE = apiLib.IPV4RANGE
+window.CIDR = apiLib.CIDR
 window.REGEX = apiLib.REGEX
 window.WITHIN = apiLib.WITHIN
 window.WITHOUT = apiLib.WITHOUT
@@ -0,0 +1,141 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package latency
+
+import (
+	"sort"
+)
+
+// Cell holds the RTT statistics, in nanoseconds, of the flows between
+// two groups of nodes
+type Cell struct {
+	Src      string
+	Dst      string
+	Samples  int64
+	Min      int64
+	Max      int64
+	Mean     int64
+	Baseline int64 `json:",omitempty"`
+}
+
+// Matrix describes the RTT between groups of nodes over an aggregation window
+// swagger:model LatencyMatrix
+type Matrix struct {
+	GroupBy string
+	Start   int64
+	Last    int64
+	Cells   []*Cell
+}
+
+type cellKey struct {
+	src, dst string
+}
+
+type cellStats struct {
+	samples int64
+	sum     int64
+	min     int64
+	max     int64
+}
+
+// aggregator accumulates the RTT samples of a window for one kind of group
+type aggregator struct {
+	groupBy   string
+	current   map[cellKey]*cellStats
+	baselines map[cellKey]int64
+	last      *Matrix
+}
+
+func (a *aggregator) add(src, dst string, rtt int64) {
+	key := cellKey{src: src, dst: dst}
+
+	stats, found := a.current[key]
+	if !found {
+		stats = &cellStats{min: rtt, max: rtt}
+		a.current[key] = stats
+	}
+
+	stats.samples++
+	stats.sum += rtt
+	if rtt < stats.min {
+		stats.min = rtt
+	}
+	if rtt > stats.max {
+		stats.max = rtt
+	}
+}
+
+// rotate closes the current window, updates the baselines and returns the
+// cells whose mean RTT exceeds their baseline by more than the given ratio
+func (a *aggregator) rotate(start, last int64, minSamples int64, ratio float64) (regressions []*Cell) {
+	m := &Matrix{
+		GroupBy: a.groupBy,
+		Start:   start,
+		Last:    last,
+	}
+
+	for key, stats := range a.current {
+		cell := &Cell{
+			Src:      key.src,
+			Dst:      key.dst,
+			Samples:  stats.samples,
+			Min:      stats.min,
+			Max:      stats.max,
+			Mean:     stats.sum / stats.samples,
+			Baseline: a.baselines[key],
+		}
+		m.Cells = append(m.Cells, cell)
+
+		if stats.samples < minSamples {
+			continue
+		}
+
+		if cell.Baseline == 0 {
+			a.baselines[key] = cell.Mean
+			continue
+		}
+
+		if float64(cell.Mean) > float64(cell.Baseline)*(1+ratio) {
+			regressions = append(regressions, cell)
+		}
+
+		// exponentially weighted moving average of the window means
+		a.baselines[key] = (cell.Baseline*4 + cell.Mean) / 5
+	}
+
+	sort.Slice(m.Cells, func(i, j int) bool {
+		if m.Cells[i].Src != m.Cells[j].Src {
+			return m.Cells[i].Src < m.Cells[j].Src
+		}
+		return m.Cells[i].Dst < m.Cells[j].Dst
+	})
+
+	a.last = m
+	a.current = make(map[cellKey]*cellStats)
+
+	return
+}
+
+func newAggregator(groupBy string) *aggregator {
+	return &aggregator{
+		groupBy:   groupBy,
+		current:   make(map[cellKey]*cellStats),
+		baselines: make(map[cellKey]int64),
+		last:      &Matrix{GroupBy: groupBy},
+	}
+}
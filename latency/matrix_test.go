@@ -0,0 +1,62 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package latency
+
+import (
+	"testing"
+)
+
+func TestAggregatorRotate(t *testing.T) {
+	a := newAggregator(GroupByHost)
+
+	for _, rtt := range []int64{10, 20, 30} {
+		a.add("host1", "host2", rtt)
+	}
+	a.add("host2", "host1", 5)
+
+	if regressions := a.rotate(0, 1000, 2, 0.5); len(regressions) != 0 {
+		t.Fatalf("No regression expected without baseline, got: %+v", regressions)
+	}
+
+	if len(a.last.Cells) != 2 {
+		t.Fatalf("Expected 2 cells, got: %+v", a.last.Cells)
+	}
+
+	cell := a.last.Cells[0]
+	if cell.Src != "host1" || cell.Samples != 3 || cell.Min != 10 || cell.Max != 30 || cell.Mean != 20 {
+		t.Fatalf("Wrong cell statistics: %+v", cell)
+	}
+
+	// the second cell had not enough samples to get a baseline
+	if _, found := a.baselines[cellKey{src: "host2", dst: "host1"}]; found {
+		t.Fatal("Unexpected baseline for a cell without enough samples")
+	}
+
+	a.add("host1", "host2", 25)
+	a.add("host1", "host2", 25)
+	if regressions := a.rotate(1000, 2000, 2, 0.5); len(regressions) != 0 {
+		t.Fatalf("No regression expected, got: %+v", regressions)
+	}
+
+	a.add("host1", "host2", 100)
+	a.add("host1", "host2", 100)
+	regressions := a.rotate(2000, 3000, 2, 0.5)
+	if len(regressions) != 1 || regressions[0].Mean != 100 || regressions[0].Baseline != 21 {
+		t.Fatalf("Expected a regression, got: %+v", regressions)
+	}
+}
@@ -0,0 +1,242 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package latency
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/alert"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+const (
+	// GroupByHost groups the nodes by host
+	GroupByHost = "host"
+	// GroupByNamespace groups the nodes by network namespace
+	GroupByNamespace = "namespace"
+	// GroupByZone groups the nodes by availability zone, as defined by the
+	// AZ metadata of their host
+	GroupByZone = "az"
+)
+
+var groupKinds = []string{GroupByHost, GroupByNamespace, GroupByZone}
+
+// Regression describes a latency increase between two groups of nodes
+type Regression struct {
+	GroupBy string
+	*Cell
+}
+
+// Server aggregates the RTT of the flows received by the analyzer into
+// latency matrices
+type Server struct {
+	sync.RWMutex
+	Graph       *graph.Graph
+	Pool        ws.StructSpeakerPool
+	window      time.Duration
+	minSamples  int64
+	ratio       float64
+	aggregators map[string]*aggregator
+	endpoints   map[string]map[string]string
+	seen        map[string]bool
+	start       time.Time
+	quit        chan bool
+	wg          sync.WaitGroup
+}
+
+// refreshEndpoints maps the IP addresses of the graph to the groups of
+// their nodes
+func (s *Server) refreshEndpoints() {
+	s.Graph.RLock()
+
+	zones := make(map[string]string)
+	for _, node := range s.Graph.GetNodes(graph.Metadata{"Type": "host"}) {
+		if zone, _ := node.GetFieldString("AZ"); zone != "" {
+			zones[node.Host] = zone
+		}
+	}
+
+	endpoints := make(map[string]map[string]string)
+	for _, node := range s.Graph.GetNodes(nil) {
+		var ips []string
+		for _, field := range []string{"IPV4", "IPV6"} {
+			addrs, _ := node.GetFieldStringList(field)
+			ips = append(ips, addrs...)
+		}
+		if len(ips) == 0 {
+			continue
+		}
+
+		namespace, _, _ := topology.NamespaceFromNode(s.Graph, node)
+		if namespace == "" {
+			namespace = "root"
+		}
+		zone := zones[node.Host]
+		if zone == "" {
+			zone = "unknown"
+		}
+
+		groups := map[string]string{
+			GroupByHost:      node.Host,
+			GroupByNamespace: node.Host + "/" + namespace,
+			GroupByZone:      zone,
+		}
+
+		for _, ip := range ips {
+			endpoints[strings.SplitN(ip, "/", 2)[0]] = groups
+		}
+	}
+
+	s.Graph.RUnlock()
+
+	s.Lock()
+	s.endpoints = endpoints
+	s.Unlock()
+}
+
+// OnFlows adds the RTT of the flows to the current window
+func (s *Server) OnFlows(flows []*flow.Flow) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, f := range flows {
+		if f.Metric == nil || f.Metric.RTT <= 0 || f.Network == nil {
+			continue
+		}
+
+		// the same flow is reported by every capture point and at every
+		// update, its RTT is only accounted once per window
+		if s.seen[f.TrackingID] {
+			continue
+		}
+
+		src, dst := s.endpoints[f.Network.A], s.endpoints[f.Network.B]
+		if src == nil || dst == nil {
+			continue
+		}
+		s.seen[f.TrackingID] = true
+
+		for kind, a := range s.aggregators {
+			a.add(src[kind], dst[kind], f.Metric.RTT)
+		}
+	}
+}
+
+func (s *Server) rotate() {
+	s.Lock()
+
+	now := time.Now().UTC()
+	start, last := common.UnixMillis(s.start), common.UnixMillis(now)
+
+	var regressions []*Regression
+	for kind, a := range s.aggregators {
+		for _, cell := range a.rotate(start, last, s.minSamples, s.ratio) {
+			regressions = append(regressions, &Regression{GroupBy: kind, Cell: cell})
+		}
+	}
+
+	s.seen = make(map[string]bool)
+	s.start = now
+
+	s.Unlock()
+
+	for _, r := range regressions {
+		logging.GetLogger().Infof("Latency regression between %s %s and %s: %dns (baseline %dns)", r.GroupBy, r.Src, r.Dst, r.Mean, r.Baseline)
+
+		msg := alert.Message{
+			UUID:       fmt.Sprintf("latency/%s/%s/%s", r.GroupBy, r.Src, r.Dst),
+			Timestamp:  now,
+			ReasonData: r,
+		}
+		s.Pool.BroadcastMessage(ws.NewStructMessage(alert.Namespace, "Alert", msg))
+	}
+}
+
+// GetLatencyMatrix returns the matrix of the last aggregation window for the
+// given kind of group
+func (s *Server) GetLatencyMatrix(groupBy string) (interface{}, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	a, found := s.aggregators[groupBy]
+	if !found {
+		return nil, fmt.Errorf("Unknown group '%s', should be one of %s", groupBy, strings.Join(groupKinds, ", "))
+	}
+
+	return a.last, nil
+}
+
+// Start the latency server
+func (s *Server) Start() {
+	s.refreshEndpoints()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.window)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.rotate()
+				s.refreshEndpoints()
+			case <-s.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the latency server
+func (s *Server) Stop() {
+	s.quit <- true
+	s.wg.Wait()
+}
+
+// NewServer creates a new latency server
+func NewServer(g *graph.Graph, pool ws.StructSpeakerPool) *Server {
+	s := &Server{
+		Graph:       g,
+		Pool:        pool,
+		window:      time.Duration(config.GetInt("analyzer.latency.window")) * time.Second,
+		minSamples:  int64(config.GetInt("analyzer.latency.min_samples")),
+		ratio:       config.GetConfig().GetFloat64("analyzer.latency.regression_ratio"),
+		aggregators: make(map[string]*aggregator),
+		endpoints:   make(map[string]map[string]string),
+		seen:        make(map[string]bool),
+		start:       time.Now().UTC(),
+		quit:        make(chan bool),
+	}
+
+	for _, kind := range groupKinds {
+		s.aggregators[kind] = newAggregator(kind)
+	}
+
+	return s
+}
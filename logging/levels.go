@@ -0,0 +1,290 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logging
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// modulePrefix is trimmed from the package paths to get the module names
+const modulePrefix = "github.com/skydive-project/skydive/"
+
+// Levels describes the logging levels
+// swagger:model
+type Levels struct {
+	// Most verbose level of the backends
+	Level string
+	// Levels overriding the one of the backends for some modules and their
+	// sub modules, the module of a message being the package logging it,
+	// ex: flow/server
+	Modules map[string]string
+}
+
+// moduleLevels holds the levels overriding the ones of the backends for some
+// modules, and the modules of the functions already seen
+type moduleLevels struct {
+	sync.RWMutex
+	levels  map[string]zapcore.Level
+	min     zapcore.Level
+	modules map[uintptr]string
+}
+
+var (
+	overrides     = &moduleLevels{levels: make(map[string]zapcore.Level), modules: make(map[uintptr]string)}
+	backendLevels []zap.AtomicLevel
+)
+
+// module returns the package of the function at pc, relative to the
+// repository
+func (m *moduleLevels) module(pc uintptr) string {
+	m.RLock()
+	module, ok := m.modules[pc]
+	m.RUnlock()
+	if ok {
+		return module
+	}
+
+	if f := runtime.FuncForPC(pc); f != nil {
+		name := f.Name()
+		i := strings.LastIndex(name, "/")
+		if j := strings.Index(name[i+1:], "."); j >= 0 {
+			module = strings.TrimPrefix(name[:i+1+j], modulePrefix)
+		}
+	}
+
+	m.Lock()
+	m.modules[pc] = module
+	m.Unlock()
+
+	return module
+}
+
+// level returns the level overriding the one of the backends for the
+// caller, the most specific module being used
+func (m *moduleLevels) level(caller zapcore.EntryCaller) (zapcore.Level, bool) {
+	m.RLock()
+	empty := len(m.levels) == 0
+	m.RUnlock()
+	if empty || !caller.Defined {
+		return 0, false
+	}
+
+	module := m.module(caller.PC)
+
+	m.RLock()
+	defer m.RUnlock()
+
+	for {
+		if level, ok := m.levels[module]; ok {
+			return level, true
+		}
+
+		i := strings.LastIndex(module, "/")
+		if i < 0 {
+			return 0, false
+		}
+		module = module[:i]
+	}
+}
+
+// enabled returns whether a module may log at the given level
+func (m *moduleLevels) enabled(level zapcore.Level) bool {
+	m.RLock()
+	defer m.RUnlock()
+
+	return len(m.levels) > 0 && level >= m.min
+}
+
+func (m *moduleLevels) set(module string, level zapcore.Level, reset bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	if reset {
+		delete(m.levels, module)
+	} else {
+		m.levels[module] = level
+	}
+
+	m.min = zapcore.FatalLevel
+	for _, level := range m.levels {
+		if level < m.min {
+			m.min = level
+		}
+	}
+}
+
+// levelCore filters the messages of a backend according to the level of
+// the backend, or to the level of their module when overridden. While a
+// module is more verbose than the backends, the messages of all the modules
+// at its level are formatted before being filtered out.
+type levelCore struct {
+	zapcore.Core
+	level zap.AtomicLevel
+}
+
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return c.level.Enabled(level) || overrides.enabled(level)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+// Write is called once the caller of the entry is known, the module levels
+// being applied there
+func (c *levelCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	if level, ok := overrides.level(entry.Caller); ok {
+		if entry.Level < level {
+			return nil
+		}
+	} else if !c.level.Enabled(entry.Level) {
+		return nil
+	}
+
+	return c.Core.Write(entry, fields)
+}
+
+func newLevelCore(backend Backend, encoder zapcore.Encoder, level zapcore.Level) zapcore.Core {
+	all := zap.LevelEnablerFunc(func(zapcore.Level) bool { return true })
+
+	atomicLevel := zap.NewAtomicLevelAt(level)
+	backendLevels = append(backendLevels, atomicLevel)
+
+	return &levelCore{Core: backend.Core(all, encoder), level: atomicLevel}
+}
+
+func parseLevel(level string) (zapcore.Level, error) {
+	switch strings.ToUpper(level) {
+	case "CRITICAL":
+		return zapcore.DPanicLevel, nil
+	case "ERROR":
+		return zapcore.ErrorLevel, nil
+	case "WARNING":
+		return zapcore.WarnLevel, nil
+	case "NOTICE", "INFO":
+		return zapcore.InfoLevel, nil
+	case "DEBUG":
+		return zapcore.DebugLevel, nil
+	}
+	return 0, fmt.Errorf("Invalid logging level: %s", level)
+}
+
+func levelName(level zapcore.Level) string {
+	switch level {
+	case zapcore.DebugLevel:
+		return "DEBUG"
+	case zapcore.InfoLevel:
+		return "INFO"
+	case zapcore.WarnLevel:
+		return "WARNING"
+	case zapcore.ErrorLevel:
+		return "ERROR"
+	}
+	return "CRITICAL"
+}
+
+// SetLevel sets the level of all the backends
+func SetLevel(level string) error {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	for _, backendLevel := range backendLevels {
+		backendLevel.SetLevel(lvl)
+	}
+	return nil
+}
+
+// SetModuleLevel overrides the level of the backends for a module and its
+// sub modules, an empty level removing the override
+func SetModuleLevel(module, level string) error {
+	module = strings.Trim(module, "/")
+	if level == "" {
+		overrides.set(module, 0, true)
+		return nil
+	}
+
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	overrides.set(module, lvl, false)
+	return nil
+}
+
+// GetLevels returns the level of the backends and the ones of the modules
+func GetLevels() *Levels {
+	levels := &Levels{Modules: make(map[string]string)}
+
+	min := zapcore.FatalLevel
+	for _, backendLevel := range backendLevels {
+		if backendLevel.Level() < min {
+			min = backendLevel.Level()
+		}
+	}
+	levels.Level = levelName(min)
+
+	overrides.RLock()
+	for module, level := range overrides.levels {
+		levels.Modules[module] = levelName(level)
+	}
+	overrides.RUnlock()
+
+	return levels
+}
+
+// SetLevels sets the level of the backends, if any, and of the modules,
+// nothing being changed if one of the levels is invalid
+func SetLevels(levels *Levels) error {
+	if levels.Level != "" {
+		if _, err := parseLevel(levels.Level); err != nil {
+			return err
+		}
+	}
+	for _, level := range levels.Modules {
+		if level == "" {
+			continue
+		}
+		if _, err := parseLevel(level); err != nil {
+			return err
+		}
+	}
+
+	if levels.Level != "" {
+		SetLevel(levels.Level)
+	}
+	for module, level := range levels.Modules {
+		SetModuleLevel(module, level)
+	}
+	return nil
+}
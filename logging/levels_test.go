@@ -0,0 +1,48 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logging
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestModuleLevels(t *testing.T) {
+	recent := NewRecentBackend(10)
+	if err := InitLogging("test", false, []*LoggerConfig{NewLoggerConfig(recent, "INFO", "json")}); err != nil {
+		t.Fatal(err)
+	}
+
+	GetLogger().Debug("hidden")
+	if err := SetModuleLevel("logging", "DEBUG"); err != nil {
+		t.Fatal(err)
+	}
+	GetLogger().With("key", "value").Debug("shown")
+	if err := SetModuleLevel("logging", ""); err != nil {
+		t.Fatal(err)
+	}
+	GetLogger().Debug("hidden again")
+
+	logs := strings.Join(RecentLogs(), "\n")
+	if strings.Contains(logs, "hidden") || !strings.Contains(logs, "shown") || !strings.Contains(logs, `"key":"value"`) {
+		t.Errorf("unexpected logs: %s", logs)
+	}
+	if err := SetModuleLevel("logging", "VERBOSE"); err == nil {
+		t.Error("invalid level should fail")
+	}
+}
@@ -45,6 +45,9 @@ type Logger interface {
 	Infof(format string, args ...interface{})
 	Debug(args ...interface{})
 	Debugf(format string, args ...interface{})
+	// With returns a logger adding the key/value pairs as fields of its
+	// messages, ex: With("capture", id, "node", tid)
+	With(keysAndValues ...interface{}) Logger
 }
 
 // DefaultLogger describes an identifier logger
@@ -197,6 +200,14 @@ func (l *DefaultLogger) Debugf(format string, args ...interface{}) {
 	l.logf(DEBUG, &format, args...)
 }
 
+// With returns a logger adding the key/value pairs as fields of its messages.
+func (l *DefaultLogger) With(keysAndValues ...interface{}) Logger {
+	return &DefaultLogger{
+		Logger: l.Sugar().With(keysAndValues...).Desugar(),
+		id:     l.id,
+	}
+}
+
 // Write implements the io.Writer interface
 func (l *DefaultLogger) Write(p []byte) (n int, err error) {
 	s := strings.TrimRight(string(p), "\n")
@@ -290,15 +301,12 @@ func NewStdioBackend(file *os.File) Backend {
 // InitLogging initializes logging system with an identifier for the log messages,
 // whether the output should be in colored mode and a set of logger configs.
 func InitLogging(id string, color bool, loggers []*LoggerConfig) (err error) {
-	getMessagePriority := func(backendLevel zapcore.Level) zap.LevelEnablerFunc {
-		return zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-			return lvl >= backendLevel
-		})
-	}
-
 	encoderConfig := newEncoderConfig(color)
 	consoleEncoder := zapcore.NewConsoleEncoder(encoderConfig)
-	jsonEncoder := zapcore.NewJSONEncoder(encoderConfig)
+	// the escape codes of the colors would end up in the JSON documents
+	jsonEncoder := zapcore.NewJSONEncoder(newEncoderConfig(false))
+
+	backendLevels = nil
 
 	var cores []zapcore.Core
 	for _, logger := range loggers {
@@ -309,8 +317,7 @@ func InitLogging(id string, color bool, loggers []*LoggerConfig) (err error) {
 		default:
 			encoder = consoleEncoder
 		}
-		backendLevel := getZapLevel(logger.logLevel)
-		cores = append(cores, logger.backend.Core(getMessagePriority(backendLevel), encoder))
+		cores = append(cores, newLevelCore(logger.backend, encoder, getZapLevel(logger.logLevel)))
 	}
 
 	newCore := zap.WrapCore(func(zapcore.Core) zapcore.Core {
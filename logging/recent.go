@@ -0,0 +1,85 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logging
+
+import (
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// recentBackend keeps the last log lines in a ring buffer
+type recentBackend struct {
+	sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+var recent *recentBackend
+
+// Write stores a log line, zap encoders writing one entry at a time
+func (b *recentBackend) Write(p []byte) (int, error) {
+	b.Lock()
+	b.lines[b.next] = strings.TrimRight(string(p), "\n")
+	b.next = (b.next + 1) % len(b.lines)
+	if b.next == 0 {
+		b.full = true
+	}
+	b.Unlock()
+
+	return len(p), nil
+}
+
+// Sync implements the zapcore.WriteSyncer interface
+func (b *recentBackend) Sync() error {
+	return nil
+}
+
+// Core returns a zap core
+func (b *recentBackend) Core(msgPriority zap.LevelEnablerFunc, encoder zapcore.Encoder) zapcore.Core {
+	return zapcore.NewCore(encoder, b, msgPriority)
+}
+
+func (b *recentBackend) get() []string {
+	b.Lock()
+	defer b.Unlock()
+
+	if !b.full {
+		return append([]string{}, b.lines[:b.next]...)
+	}
+	return append(append([]string{}, b.lines[b.next:]...), b.lines[:b.next]...)
+}
+
+// NewRecentBackend returns a logging backend keeping the last size lines
+// in memory, to be retrieved with RecentLogs
+func NewRecentBackend(size int) Backend {
+	recent = &recentBackend{lines: make([]string, size)}
+	return recent
+}
+
+// RecentLogs returns the lines kept by the last created recent backend,
+// oldest first
+func RecentLogs() []string {
+	if recent == nil {
+		return nil
+	}
+	return recent.get()
+}
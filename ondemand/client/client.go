@@ -50,6 +50,20 @@ type OnDemandClientHandler interface {
 	EncodeMessage(nodeID graph.Identifier, resource types.Resource) (json.RawMessage, error)
 }
 
+// OnDemandResourceReleaser can be implemented by the ondemand clients
+// keeping a state per resource, a timer for instance, released when the
+// resource is deleted
+type OnDemandResourceReleaser interface {
+	ReleaseResource(resource types.Resource)
+}
+
+// OnDemandNodeMatcher can be implemented by the ondemand clients whose
+// resources select nodes by their metadata, the tasks being stopped on the
+// nodes that are updated and no longer match the resource
+type OnDemandNodeMatcher interface {
+	MatchNode(n *graph.Node, resource types.Resource) bool
+}
+
 // OnDemandClient describes an ondemand task client based on a websocket
 type OnDemandClient struct {
 	common.RWMutex
@@ -233,6 +247,11 @@ func (o *OnDemandClient) checkForRegistrationCallback() {
 	}
 }
 
+// CheckForRegistration triggers a new check of the resources to register
+func (o *OnDemandClient) CheckForRegistration() {
+	o.checkForRegistration.Call()
+}
+
 // OnNodeAdded graph event
 func (o *OnDemandClient) OnNodeAdded(n *graph.Node) {
 	if !o.IsMaster() {
@@ -264,14 +283,25 @@ func (o *OnDemandClient) OnNodeAdded(n *graph.Node) {
 
 // OnNodeUpdated graph event
 func (o *OnDemandClient) OnNodeUpdated(n *graph.Node) {
+	matcher, _ := o.handler.(OnDemandNodeMatcher)
+
 	o.RLock()
 	if tasks, ok := o.registeredNodes[n.ID]; ok {
 		for resourceID, started := range tasks {
-			if resource := o.resources[resourceID]; !started && resource != nil {
-				if o.handler.CheckState(n, resource) {
-					o.registeredNodes[n.ID][resourceID] = true
-					o.subscriberPool.BroadcastMessage(ws.NewStructMessage(o.wsNotificationNamespace, "NodeUpdated", resource))
-				}
+			resource := o.resources[resourceID]
+			if resource == nil {
+				continue
+			}
+
+			if matcher != nil && o.IsMaster() && !matcher.MatchNode(n, resource) {
+				logging.GetLogger().Debugf("Node %s no longer matches %s", n.ID, resourceID)
+				go o.unregisterTask(n, resource)
+				continue
+			}
+
+			if !started && o.handler.CheckState(n, resource) {
+				o.registeredNodes[n.ID][resourceID] = true
+				o.subscriberPool.BroadcastMessage(ws.NewStructMessage(o.wsNotificationNamespace, "NodeUpdated", resource))
 			}
 		}
 	}
@@ -339,6 +369,10 @@ func (o *OnDemandClient) unregisterResource(resource types.Resource) {
 }
 
 func (o *OnDemandClient) onResourceDeleted(resource types.Resource) {
+	if releaser, ok := o.handler.(OnDemandResourceReleaser); ok {
+		releaser.ReleaseResource(resource)
+	}
+
 	if !o.IsMaster() {
 		// fill the cache with recent delete in order to be able to delete then
 		// in case we lose the master and nobody is master yet. This cache will
@@ -388,6 +422,38 @@ func (o *OnDemandClient) onAPIWatcherEvent(action string, id string, resource ty
 	}
 }
 
+// RegisteredTasks returns, by node, the resources registered on the agents
+// and whether they were started
+func (o *OnDemandClient) RegisteredTasks() map[graph.Identifier]map[string]bool {
+	o.RLock()
+	defer o.RUnlock()
+
+	registered := make(map[graph.Identifier]map[string]bool)
+	for nodeID, tasks := range o.registeredNodes {
+		registered[nodeID] = make(map[string]bool)
+		for resourceID, started := range tasks {
+			registered[nodeID][resourceID] = started
+		}
+	}
+	return registered
+}
+
+// RestoreRegisteredTasks restores the tasks registered by a previous instance
+// so that they are not registered again on the agents
+func (o *OnDemandClient) RestoreRegisteredTasks(registered map[graph.Identifier]map[string]bool) {
+	o.Lock()
+	defer o.Unlock()
+
+	for nodeID, tasks := range registered {
+		if _, found := o.registeredNodes[nodeID]; !found {
+			o.registeredNodes[nodeID] = make(map[string]bool)
+		}
+		for resourceID, started := range tasks {
+			o.registeredNodes[nodeID][resourceID] = started
+		}
+	}
+}
+
 // Start the task
 func (o *OnDemandClient) Start() {
 	o.MasterElection.AddEventListener(o)
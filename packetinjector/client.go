@@ -108,6 +108,11 @@ func (h *onDemandPacketInjectionHandler) createRequest(nodeID graph.Identifier,
 		Mode:             pi.Mode,
 		IncrementPayload: pi.IncrementPayload,
 		TTL:              pi.TTL,
+		Rate:             pi.Rate,
+		Duration:         pi.Duration,
+		PayloadLengthMin: pi.PayloadLengthMin,
+		PayloadLengthMax: pi.PayloadLengthMax,
+		TCPHandshake:     pi.TCPHandshake,
 	}
 
 	if len(pir.Mode) == 0 {
@@ -39,6 +39,10 @@ var (
 	}
 )
 
+// interval between the packets of an injection limited by a duration but
+// without rate nor interval, as ping does
+const defaultDurationInterval = time.Second
+
 // ForgedPacketGenerator is used to forge packets. It creates
 // a gopacket.Packet with the proper layers that can be directly
 // inserted into a socket.
@@ -48,7 +52,25 @@ type ForgedPacketGenerator struct {
 	close     chan bool
 }
 
-func forgePacket(packetType string, layerType gopacket.LayerType, srcMAC, dstMAC net.HardwareAddr, TTL uint8, srcIP, dstIP net.IP, srcPort, dstPort uint16, ID uint16, data string) ([]byte, gopacket.Packet, error) {
+// tcpSegment defines the TCP header of a packet belonging to an emulated
+// connection. Except for the SYN-ACK of the handshake, only the client side
+// of the connection is injected, the acknowledgment number being computed
+// from the sequence number of the SYN-ACK.
+type tcpSegment struct {
+	Seq, Ack           uint32
+	SYN, ACK, PSH, FIN bool
+}
+
+func newTCPLayer(srcPort, dstPort uint16, segment *tcpSegment) *layers.TCP {
+	tcpLayer := &layers.TCP{SrcPort: layers.TCPPort(srcPort), DstPort: layers.TCPPort(dstPort), Seq: rand.Uint32(), SYN: true}
+	if segment != nil {
+		tcpLayer.Seq, tcpLayer.Ack = segment.Seq, segment.Ack
+		tcpLayer.SYN, tcpLayer.ACK, tcpLayer.PSH, tcpLayer.FIN = segment.SYN, segment.ACK, segment.PSH, segment.FIN
+	}
+	return tcpLayer
+}
+
+func forgePacket(packetType string, layerType gopacket.LayerType, srcMAC, dstMAC net.HardwareAddr, TTL uint8, srcIP, dstIP net.IP, srcPort, dstPort uint16, ID uint16, segment *tcpSegment, data string) ([]byte, gopacket.Packet, error) {
 	var l []gopacket.SerializableLayer
 
 	payload := gopacket.Payload([]byte(data))
@@ -86,16 +108,12 @@ func forgePacket(packetType string, layerType gopacket.LayerType, srcMAC, dstMAC
 		l = append(l, ipLayer, icmpLayer, echoLayer)
 	case "tcp4":
 		ipLayer := &layers.IPv4{SrcIP: srcIP, DstIP: dstIP, Version: 4, Protocol: layers.IPProtocolTCP, TTL: TTL}
-		srcPort := layers.TCPPort(srcPort)
-		dstPort := layers.TCPPort(dstPort)
-		tcpLayer := &layers.TCP{SrcPort: srcPort, DstPort: dstPort, Seq: rand.Uint32(), SYN: true}
+		tcpLayer := newTCPLayer(srcPort, dstPort, segment)
 		tcpLayer.SetNetworkLayerForChecksum(ipLayer)
 		l = append(l, ipLayer, tcpLayer)
 	case "tcp6":
 		ipLayer := &layers.IPv6{Version: 6, SrcIP: srcIP, DstIP: dstIP, NextHeader: layers.IPProtocolTCP}
-		srcPort := layers.TCPPort(srcPort)
-		dstPort := layers.TCPPort(dstPort)
-		tcpLayer := &layers.TCP{SrcPort: srcPort, DstPort: dstPort, Seq: rand.Uint32(), SYN: true}
+		tcpLayer := newTCPLayer(srcPort, dstPort, segment)
 		tcpLayer.SetNetworkLayerForChecksum(ipLayer)
 		l = append(l, ipLayer, tcpLayer)
 	case "udp4":
@@ -131,6 +149,34 @@ func (f *ForgedPacketGenerator) Close() {
 	f.close <- true
 }
 
+// send forges a packet and pushes it to the given channel, it returns false
+// if the packet can't be forged or if the generator has been closed
+func (f *ForgedPacketGenerator) send(ch chan *Packet, srcPort, id uint16, segment *tcpSegment, payload string) bool {
+	packetData, packet, err := forgePacket(f.Type, f.LayerType, f.SrcMAC, f.DstMAC, f.TTL, f.SrcIP, f.DstIP, srcPort, f.DstPort, id, segment, payload)
+	return f.push(ch, packetData, packet, err)
+}
+
+// sendReply forges a packet from the destination to the source, the SYN-ACK
+// of an emulated handshake
+func (f *ForgedPacketGenerator) sendReply(ch chan *Packet, srcPort, id uint16, segment *tcpSegment) bool {
+	packetData, packet, err := forgePacket(f.Type, f.LayerType, f.DstMAC, f.SrcMAC, f.TTL, f.DstIP, f.SrcIP, f.DstPort, srcPort, id, segment, "")
+	return f.push(ch, packetData, packet, err)
+}
+
+func (f *ForgedPacketGenerator) push(ch chan *Packet, packetData []byte, packet gopacket.Packet, err error) bool {
+	if err != nil {
+		logging.GetLogger().Error(err)
+		return false
+	}
+
+	select {
+	case <-f.close:
+		return false
+	case ch <- &Packet{data: packetData, gopacket: packet}:
+	}
+	return true
+}
+
 // PacketSource returns a channel when forged packets are pushed
 func (f *ForgedPacketGenerator) PacketSource() chan *Packet {
 	ch := make(chan *Packet)
@@ -148,35 +194,88 @@ func (f *ForgedPacketGenerator) PacketSource() chan *Packet {
 			f.Count = 1
 		}
 
+		interval := time.Millisecond * time.Duration(f.Interval)
+		if f.Rate != 0 {
+			interval = time.Second / time.Duration(f.Rate)
+		}
+
+		if interval == 0 && f.Duration != 0 {
+			interval = defaultDurationInterval
+		}
+
+		var ticker *time.Ticker
+		if interval != 0 {
+			ticker = time.NewTicker(interval)
+			defer ticker.Stop()
+		}
+
+		// when a duration is given, packets are sent until it expires
+		var deadline time.Time
+		if f.Duration != 0 {
+			deadline = time.Now().Add(time.Second * time.Duration(f.Duration))
+		}
+
 		id := f.ICMPID
 		srcPort := f.SrcPort
 
-		for i := uint64(0); i < f.Count; i++ {
-			packetData, packet, err := forgePacket(f.Type, f.LayerType, f.SrcMAC, f.DstMAC, f.TTL, f.SrcIP, f.DstIP, srcPort, f.DstPort, id, payload)
-			if err != nil {
-				logging.GetLogger().Error(err)
+		// three-way handshake: SYN, SYN-ACK from the destination, then ACK
+		var segment *tcpSegment
+		if f.TCPHandshake && (f.Type == types.PITypeTCP4 || f.Type == types.PITypeTCP6) {
+			segment = &tcpSegment{Seq: rand.Uint32(), SYN: true}
+			if !f.send(ch, srcPort, id, segment, "") {
 				return
 			}
 
-			if f.IncrementPayload > 0 {
-				payload = payload + common.RandString(int(f.IncrementPayload))
+			synAck := &tcpSegment{Seq: rand.Uint32(), Ack: segment.Seq + 1, SYN: true, ACK: true}
+			if !f.sendReply(ch, srcPort, id, synAck) {
+				return
+			}
+
+			segment.Seq++
+			segment.Ack = synAck.Seq + 1
+			segment.SYN, segment.ACK = false, true
+			if !f.send(ch, srcPort, id, segment, "") {
+				return
+			}
+			segment.PSH = true
+		}
+
+		for i := uint64(0); ; i++ {
+			if deadline.IsZero() && i == f.Count || !deadline.IsZero() && time.Now().After(deadline) {
+				break
+			}
+
+			data := payload
+			if f.PayloadLengthMax != 0 {
+				length := f.PayloadLengthMin
+				if f.PayloadLengthMax > f.PayloadLengthMin {
+					length += rand.Int63n(f.PayloadLengthMax - f.PayloadLengthMin + 1)
+				}
+				data = common.RandString(int(length))
 			}
 
-			select {
-			case <-f.close:
+			if !f.send(ch, srcPort, id, segment, data) {
 				return
-			case ch <- &Packet{data: packetData, gopacket: packet}:
 			}
 
-			if i != f.Count-1 && f.Interval != 0 {
+			if segment != nil {
+				segment.Seq += uint32(len(data))
+			}
+
+			if f.IncrementPayload > 0 {
+				payload = payload + common.RandString(int(f.IncrementPayload))
+			}
+
+			if ticker != nil && (!deadline.IsZero() || i != f.Count-1) {
 				select {
 				case <-f.close:
 					return
-				case <-time.After(time.Millisecond * time.Duration(f.Interval)):
+				case <-ticker.C:
 				}
 			}
 
-			if f.Mode == types.PIModeRandom {
+			// the 5-tuple of an emulated TCP connection has to stay the same
+			if f.Mode == types.PIModeRandom && segment == nil {
 				switch f.Type {
 				case types.PITypeICMP4, types.PITypeICMP6:
 					id = uint16(rand.Intn(math.MaxUint16-1) + 1)
@@ -185,6 +284,13 @@ func (f *ForgedPacketGenerator) PacketSource() chan *Packet {
 				}
 			}
 		}
+
+		if segment != nil {
+			segment.PSH, segment.FIN = false, true
+			if !f.send(ch, srcPort, id, segment, "") {
+				return
+			}
+		}
 		ch <- nil
 	}()
 
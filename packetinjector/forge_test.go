@@ -0,0 +1,148 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package packetinjector
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/skydive-project/skydive/api/types"
+)
+
+func newTestGenerator(t *testing.T, pp *PacketInjectionRequest) *ForgedPacketGenerator {
+	pp.SrcIP, pp.DstIP = net.ParseIP("192.168.0.1"), net.ParseIP("192.168.0.2")
+	pp.SrcMAC, _ = net.ParseMAC("00:00:00:00:00:01")
+	pp.DstMAC, _ = net.ParseMAC("00:00:00:00:00:02")
+	pp.TTL = 64
+
+	f, err := NewForgedPacketGenerator(pp, "ether")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func collectPackets(t *testing.T, f *ForgedPacketGenerator, timeout time.Duration) (packets []*Packet) {
+	ch := f.PacketSource()
+	after := time.After(timeout)
+	for {
+		select {
+		case packet, ok := <-ch:
+			if !ok || packet == nil {
+				return
+			}
+			packets = append(packets, packet)
+		case <-after:
+			f.Close()
+			t.Fatalf("packet source not terminated after %s, %d packets received", timeout, len(packets))
+		}
+	}
+}
+
+func TestTCPHandshake(t *testing.T) {
+	f := newTestGenerator(t, &PacketInjectionRequest{
+		Type:         types.PITypeTCP4,
+		SrcPort:      12345,
+		DstPort:      80,
+		Count:        2,
+		Payload:      "skydive",
+		TCPHandshake: true,
+	})
+
+	packets := collectPackets(t, f, 5*time.Second)
+	if len(packets) != 6 {
+		t.Fatalf("expected SYN, SYN-ACK, ACK, 2 data packets and FIN, got %d packets", len(packets))
+	}
+
+	var segments []*layers.TCP
+	var ips []*layers.IPv4
+	for _, packet := range packets {
+		segments = append(segments, packet.gopacket.Layer(layers.LayerTypeTCP).(*layers.TCP))
+		ips = append(ips, packet.gopacket.Layer(layers.LayerTypeIPv4).(*layers.IPv4))
+	}
+
+	syn, synAck, ack := segments[0], segments[1], segments[2]
+	if !syn.SYN || syn.ACK {
+		t.Errorf("first packet should be a SYN: %+v", syn)
+	}
+
+	if !synAck.SYN || !synAck.ACK || synAck.Ack != syn.Seq+1 {
+		t.Errorf("second packet should be a SYN-ACK acknowledging the SYN: %+v", synAck)
+	}
+	if synAck.SrcPort != 80 || synAck.DstPort != 12345 || !ips[1].SrcIP.Equal(f.DstIP) || !ips[1].DstIP.Equal(f.SrcIP) {
+		t.Errorf("SYN-ACK should be sent from the destination to the source: %s -> %s", ips[1].SrcIP, ips[1].DstIP)
+	}
+
+	if ack.SYN || !ack.ACK || ack.Seq != syn.Seq+1 || ack.Ack != synAck.Seq+1 {
+		t.Errorf("third packet should be an ACK of the SYN-ACK: %+v", ack)
+	}
+
+	seq := ack.Seq
+	for i, segment := range segments[3:5] {
+		if !segment.PSH || segment.Seq != seq || segment.Ack != ack.Ack || string(segment.Payload) != "skydive" {
+			t.Errorf("data packet %d has wrong header or payload: %+v", i, segment)
+		}
+		seq += uint32(len(segment.Payload))
+	}
+
+	if fin := segments[5]; !fin.FIN || fin.Seq != seq {
+		t.Errorf("last packet should be a FIN: %+v", fin)
+	}
+
+	for i, segment := range segments {
+		if i != 1 && (segment.SrcPort != 12345 || segment.DstPort != 80) {
+			t.Errorf("packet %d doesn't belong to the connection: %d -> %d", i, segment.SrcPort, segment.DstPort)
+		}
+	}
+}
+
+func TestDurationWithoutRate(t *testing.T) {
+	f := newTestGenerator(t, &PacketInjectionRequest{
+		Type:     types.PITypeUDP4,
+		SrcPort:  12345,
+		DstPort:  53,
+		Duration: 1,
+	})
+
+	// packets are spaced by the default interval instead of flooding
+	packets := collectPackets(t, f, 5*time.Second)
+	if len(packets) == 0 || len(packets) > 2 {
+		t.Errorf("expected at most 2 packets in 1 second, got %d", len(packets))
+	}
+}
+
+func TestDurationWithRate(t *testing.T) {
+	f := newTestGenerator(t, &PacketInjectionRequest{
+		Type:     types.PITypeUDP4,
+		SrcPort:  12345,
+		DstPort:  53,
+		Duration: 1,
+		Rate:     20,
+	})
+
+	start := time.Now()
+	packets := collectPackets(t, f, 5*time.Second)
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("injection stopped before its deadline: %s", elapsed)
+	}
+	if len(packets) < 10 || len(packets) > 22 {
+		t.Errorf("expected about 20 packets, got %d", len(packets))
+	}
+}
@@ -49,6 +49,11 @@ type PacketInjectionRequest struct {
 	Payload          string
 	Pcap             []byte
 	TTL              uint8
+	Rate             uint64
+	Duration         uint64
+	PayloadLengthMin int64
+	PayloadLengthMax int64
+	TCPHandshake     bool
 }
 
 // GetName returns the name of the resource
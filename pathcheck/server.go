@@ -0,0 +1,478 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pathcheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	etcdclient "github.com/coreos/etcd/client"
+
+	"github.com/skydive-project/skydive/alert"
+	api "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/etcd"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+const (
+	// number of trace packets injected for each check
+	tracePacketCount = 3
+	// interval in milliseconds between two trace packets
+	tracePacketInterval = 100
+	// delay given to the agents to capture the trace packets
+	settleDelay = 3 * time.Second
+)
+
+// check holds the runtime state of a registered path check
+type check struct {
+	*types.PathCheck
+	interval   time.Duration
+	captureID  string
+	pathQuery  string
+	lastReport *types.PathCheckReport
+	quit       chan bool
+}
+
+// Server periodically injects trace packets for the registered path checks
+// and reports on which nodes of the path they were captured
+type Server struct {
+	common.RWMutex
+	common.MasterElection
+	Graph            *graph.Graph
+	Pool             ws.StructSpeakerPool
+	PathCheckHandler api.Handler
+	captureHandler   api.Handler
+	injectionHandler api.Handler
+	etcdClient       *etcd.Client
+	gremlinParser    *traversal.GremlinTraversalParser
+	watcher          api.StoppableWatcher
+	checks           map[string]*check
+}
+
+func (s *Server) gremlinQuery(query string, lockGraph bool) ([]interface{}, error) {
+	ts, err := s.gremlinParser.Parse(strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := ts.Exec(s.Graph, lockGraph)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Values(), nil
+}
+
+// resolvePath returns the nodes of the shortest path between the source
+// and the destination of a check
+func (s *Server) resolvePath(c *check) (string, []*graph.Node, error) {
+	s.Graph.RLock()
+	defer s.Graph.RUnlock()
+
+	values, err := s.gremlinQuery(c.Dst, false)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var dstTID string
+	if len(values) > 0 {
+		if node, ok := values[0].(*graph.Node); ok {
+			dstTID, _ = node.GetFieldString("TID")
+		}
+	}
+	if dstTID == "" {
+		return "", nil, fmt.Errorf("Not able to find a destination node for '%s'", c.Dst)
+	}
+
+	pathQuery := fmt.Sprintf("%s.ShortestPathTo(Metadata('TID', '%s'))", c.Src, dstTID)
+	if values, err = s.gremlinQuery(pathQuery, false); err != nil {
+		return "", nil, err
+	}
+
+	for _, value := range values {
+		if nodes, ok := value.([]*graph.Node); ok && len(nodes) > 0 {
+			return pathQuery, nodes, nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("No path found between '%s' and '%s'", c.Src, c.Dst)
+}
+
+// captureTTL returns the TTL of the capture of a check. The capture is
+// refreshed at each run so that it expires when the analyzer running the
+// check stops, or loses the master election.
+func (c *check) captureTTL() time.Duration {
+	return 2*c.interval + settleDelay
+}
+
+// refreshCapture postpones the expiration of the capture of a check
+func (s *Server) refreshCapture(c *check) error {
+	key := fmt.Sprintf("/%s/%s", s.captureHandler.Name(), c.captureID)
+	_, err := s.etcdClient.KeysAPI.Set(context.Background(), key, "", &etcdclient.SetOptions{
+		TTL:       c.captureTTL(),
+		Refresh:   true,
+		PrevExist: etcdclient.PrevExist,
+	})
+	return err
+}
+
+// ensureCapture makes sure a capture is running on the nodes of the path
+func (s *Server) ensureCapture(c *check, pathQuery string) error {
+	if c.captureID != "" {
+		if c.pathQuery == pathQuery {
+			if err := s.refreshCapture(c); err == nil {
+				return nil
+			}
+			// the capture expired or was deleted, it is created again
+			c.captureID, c.pathQuery = "", ""
+		} else {
+			s.deleteCapture(c)
+		}
+	}
+
+	bpf := "icmp"
+	if c.Type == types.PITypeICMP6 {
+		bpf = "icmp6"
+	}
+
+	capture := types.NewCapture(pathQuery, bpf)
+	capture.Name = "pathcheck " + c.UUID
+	capture.Description = fmt.Sprintf("Capture of the path check '%s'", c.Name)
+
+	if err := s.captureHandler.Create(capture, &api.CreateOptions{TTL: c.captureTTL()}); err != nil {
+		return fmt.Errorf("Failed to create capture for path check %s: %s", c.UUID, err)
+	}
+
+	c.captureID = capture.ID()
+	c.pathQuery = pathQuery
+
+	return nil
+}
+
+func (s *Server) deleteCapture(c *check) {
+	if err := s.captureHandler.Delete(c.captureID); err != nil {
+		logging.GetLogger().Warningf("Failed to delete capture of path check %s: %s", c.UUID, err)
+	}
+	c.captureID, c.pathQuery = "", ""
+}
+
+func (s *Server) injectTracePackets(c *check, marker uint16) error {
+	injection := &types.PacketInjection{
+		Src:      c.Src,
+		Dst:      c.Dst,
+		Type:     c.Type,
+		ICMPID:   marker,
+		Count:    tracePacketCount,
+		Interval: tracePacketInterval,
+	}
+
+	ttl := settleDelay + time.Duration(tracePacketCount*tracePacketInterval)*time.Millisecond
+	return s.injectionHandler.Create(injection, &api.CreateOptions{TTL: ttl})
+}
+
+// capturedFlows returns, for each node, the start time of the first flow
+// matching the trace packets
+func (s *Server) capturedFlows(marker uint16) (map[string]int64, error) {
+	values, err := s.gremlinQuery(fmt.Sprintf("G.Flows().Has('ICMP.ID', %d)", marker), true)
+	if err != nil {
+		return nil, err
+	}
+
+	starts := make(map[string]int64)
+	for _, value := range values {
+		f, ok := value.(*flow.Flow)
+		if !ok {
+			continue
+		}
+
+		if start, found := starts[f.NodeTID]; !found || f.Start < start {
+			starts[f.NodeTID] = f.Start
+		}
+	}
+
+	return starts, nil
+}
+
+func capturedPath(report *types.PathCheckReport) (tids []string) {
+	for _, hop := range report.Hops {
+		if hop.Captured {
+			tids = append(tids, hop.NodeTID)
+		}
+	}
+	return
+}
+
+func samePath(r1, r2 *types.PathCheckReport) bool {
+	p1, p2 := capturedPath(r1), capturedPath(r2)
+	if len(p1) != len(p2) {
+		return false
+	}
+	for i := range p1 {
+		if p1[i] != p2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// newReport returns the report of the trace packets captured on the nodes of
+// a path, the latencies being relative to the first capture
+func newReport(nodes []*graph.Node, starts map[string]int64, marker uint16, last *types.PathCheckReport) *types.PathCheckReport {
+	var first int64
+	for _, start := range starts {
+		if first == 0 || start < first {
+			first = start
+		}
+	}
+
+	report := &types.PathCheckReport{
+		Timestamp: time.Now().UTC(),
+		Marker:    int64(marker),
+	}
+
+	for _, node := range nodes {
+		tid, _ := node.GetFieldString("TID")
+		name, _ := node.GetFieldString("Name")
+
+		hop := &types.PathCheckHop{NodeTID: tid, Name: name}
+		if start, found := starts[tid]; found {
+			hop.Captured = true
+			hop.Latency = start - first
+		}
+		report.Hops = append(report.Hops, hop)
+	}
+
+	if n := len(report.Hops); n > 0 {
+		report.Reachable = report.Hops[n-1].Captured
+	}
+
+	if last != nil && !samePath(last, report) {
+		report.Changed = true
+	}
+
+	return report
+}
+
+func (s *Server) runCheck(c *check) error {
+	pathQuery, nodes, err := s.resolvePath(c)
+	if err != nil {
+		return err
+	}
+
+	if err = s.ensureCapture(c, pathQuery); err != nil {
+		return err
+	}
+
+	marker := uint16(rand.Intn(math.MaxUint16-1) + 1)
+	if err = s.injectTracePackets(c, marker); err != nil {
+		return fmt.Errorf("Failed to inject trace packets for path check %s: %s", c.UUID, err)
+	}
+
+	select {
+	case <-time.After(settleDelay):
+	case <-c.quit:
+		return nil
+	}
+
+	starts, err := s.capturedFlows(marker)
+	if err != nil {
+		return err
+	}
+
+	report := newReport(nodes, starts, marker, c.lastReport)
+	c.lastReport = report
+
+	if err = s.storeReport(c, report); err != nil {
+		return err
+	}
+
+	if report.Changed {
+		s.notifyPathChange(c, report)
+	}
+
+	return nil
+}
+
+func (s *Server) storeReport(c *check, report *types.PathCheckReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%s/%s", api.PathCheckReportPath, c.UUID)
+	if _, err = s.etcdClient.KeysAPI.Set(context.Background(), key, string(data), nil); err != nil {
+		return fmt.Errorf("Failed to store report of path check %s: %s", c.UUID, err)
+	}
+
+	return nil
+}
+
+func (s *Server) deleteReport(id string) {
+	key := fmt.Sprintf("%s/%s", api.PathCheckReportPath, id)
+	s.etcdClient.KeysAPI.Delete(context.Background(), key, nil)
+}
+
+// notifyPathChange sends an alert message to the websocket subscribers and
+// to the webhook of the check
+func (s *Server) notifyPathChange(c *check, report *types.PathCheckReport) {
+	msg := alert.Message{
+		UUID:       c.UUID,
+		Timestamp:  report.Timestamp,
+		ReasonData: report,
+	}
+
+	logging.GetLogger().Infof("Path of path check %s changed", c.UUID)
+
+	s.Pool.BroadcastMessage(ws.NewStructMessage(alert.Namespace, "Alert", msg))
+
+	if c.Action == "" {
+		return
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to marshal path check alert to JSON: %s", err)
+		return
+	}
+
+	go func() {
+		req, err := http.NewRequest("POST", c.Action, bytes.NewReader(payload))
+		if err != nil {
+			logging.GetLogger().Warningf("Failed to post path check alert to %s: %s", c.Action, err)
+			return
+		}
+
+		req.Close = true
+		if _, err = http.DefaultClient.Do(req); err != nil {
+			logging.GetLogger().Warningf("Error while posting path check alert to %s: %s", c.Action, err)
+		}
+	}()
+}
+
+func (s *Server) registerCheck(pc *types.PathCheck) {
+	logging.GetLogger().Debugf("Registering path check: %+v", pc)
+
+	s.unregisterCheck(pc.UUID, false)
+
+	interval := time.Duration(pc.Interval) * time.Second
+	if interval < settleDelay {
+		interval = settleDelay
+	}
+
+	c := &check{PathCheck: pc, interval: interval, quit: make(chan bool)}
+
+	s.Lock()
+	s.checks[pc.UUID] = c
+	s.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if s.IsMaster() {
+				if err := s.runCheck(c); err != nil {
+					logging.GetLogger().Warning(err)
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-c.quit:
+				if c.captureID != "" {
+					s.deleteCapture(c)
+				}
+				return
+			}
+		}
+	}()
+}
+
+func (s *Server) unregisterCheck(id string, deleteReport bool) {
+	s.Lock()
+	c, found := s.checks[id]
+	delete(s.checks, id)
+	s.Unlock()
+
+	if found {
+		logging.GetLogger().Debugf("Unregistering path check: %s", id)
+		close(c.quit)
+	}
+
+	if deleteReport && s.IsMaster() {
+		s.deleteReport(id)
+	}
+}
+
+func (s *Server) onAPIWatcherEvent(action string, id string, resource types.Resource) {
+	switch action {
+	case "init", "create", "set", "update":
+		s.registerCheck(resource.(*types.PathCheck))
+	case "expire", "delete":
+		s.unregisterCheck(id, true)
+	}
+}
+
+// Start the path check server
+func (s *Server) Start() {
+	s.StartAndWait()
+
+	s.watcher = s.PathCheckHandler.AsyncWatch(s.onAPIWatcherEvent)
+}
+
+// Stop the path check server
+func (s *Server) Stop() {
+	s.watcher.Stop()
+
+	s.Lock()
+	for id, c := range s.checks {
+		close(c.quit)
+		delete(s.checks, id)
+	}
+	s.Unlock()
+
+	s.MasterElection.Stop()
+}
+
+// NewServer creates a new path check server
+func NewServer(apiServer *api.Server, pool ws.StructSpeakerPool, g *graph.Graph, parser *traversal.GremlinTraversalParser, etcdClient *etcd.Client) *Server {
+	return &Server{
+		MasterElection:   etcdClient.NewElection("pathcheck-server"),
+		Graph:            g,
+		Pool:             pool,
+		PathCheckHandler: apiServer.GetHandler("pathcheck"),
+		captureHandler:   apiServer.GetHandler("capture"),
+		injectionHandler: apiServer.GetHandler("injectpacket"),
+		etcdClient:       etcdClient,
+		gremlinParser:    parser,
+		checks:           make(map[string]*check),
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pathcheck
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+func newPath(names ...string) (nodes []*graph.Node) {
+	for _, name := range names {
+		m := graph.Metadata{"TID": "tid-" + name, "Name": name}
+		nodes = append(nodes, graph.CreateNode(graph.Identifier(name), m, graph.TimeUTC(), "host", common.AnalyzerService))
+	}
+	return
+}
+
+func newTestReport(captured ...string) *types.PathCheckReport {
+	report := &types.PathCheckReport{}
+	for _, tid := range captured {
+		report.Hops = append(report.Hops, &types.PathCheckHop{NodeTID: tid, Captured: true})
+	}
+	return report
+}
+
+func TestSamePath(t *testing.T) {
+	missed := newTestReport("a", "c")
+	missed.Hops = append(missed.Hops, &types.PathCheckHop{NodeTID: "b"})
+
+	tests := []struct {
+		name     string
+		r1, r2   *types.PathCheckReport
+		expected bool
+	}{
+		{"same hops", newTestReport("a", "b", "c"), newTestReport("a", "b", "c"), true},
+		{"nothing captured", newTestReport(), newTestReport(), true},
+		{"missing hop", newTestReport("a", "b", "c"), newTestReport("a", "c"), false},
+		{"other hop", newTestReport("a", "b", "c"), newTestReport("a", "d", "c"), false},
+		{"other order", newTestReport("a", "b", "c"), newTestReport("a", "c", "b"), false},
+		{"uncaptured hops ignored", missed, newTestReport("a", "c"), true},
+	}
+
+	for _, test := range tests {
+		if same := samePath(test.r1, test.r2); same != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.name, test.expected, same)
+		}
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	nodes := newPath("src", "switch", "dst")
+
+	report := newReport(nodes, map[string]int64{"tid-src": 1000, "tid-switch": 1003, "tid-dst": 1010}, 42, nil)
+	if report.Marker != 42 || !report.Reachable || report.Changed {
+		t.Errorf("Expected a reachable unchanged report with marker 42, got %+v", report)
+	}
+
+	expected := []types.PathCheckHop{
+		{NodeTID: "tid-src", Name: "src", Captured: true, Latency: 0},
+		{NodeTID: "tid-switch", Name: "switch", Captured: true, Latency: 3},
+		{NodeTID: "tid-dst", Name: "dst", Captured: true, Latency: 10},
+	}
+	if len(report.Hops) != len(expected) {
+		t.Fatalf("Expected %d hops, got %d", len(expected), len(report.Hops))
+	}
+	for i, hop := range report.Hops {
+		if *hop != expected[i] {
+			t.Errorf("Expected hop %+v, got %+v", expected[i], *hop)
+		}
+	}
+
+	// the trace packets are lost after the switch
+	lost := newReport(nodes, map[string]int64{"tid-src": 2000, "tid-switch": 2005}, 43, report)
+	if lost.Reachable || !lost.Changed {
+		t.Errorf("Expected an unreachable changed report, got %+v", lost)
+	}
+	if hop := lost.Hops[2]; hop.Captured || hop.Latency != 0 {
+		t.Errorf("Expected the destination not to be captured, got %+v", hop)
+	}
+
+	// the same path is captured again
+	if again := newReport(nodes, map[string]int64{"tid-src": 3000, "tid-switch": 3001}, 44, lost); again.Changed {
+		t.Error("Expected the report not to be changed")
+	}
+
+	// nothing captured
+	if none := newReport(nodes, nil, 45, nil); none.Reachable || len(none.Hops) != 3 {
+		t.Errorf("Expected an unreachable report with 3 hops, got %+v", none)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/gorilla/mux"
+
+	shttp "github.com/skydive-project/skydive/http"
+)
+
+// routes executing queries, subject to the concurrent query quota. A TopN
+// stream holds its slot as long as it is open.
+var queryRoutes = map[string]bool{
+	"AlertBacktest":           true,
+	"BandwidthGet":            true,
+	"DependencyGet":           true,
+	"FederatedTopologySearch": true,
+	"GraphQLQuery":            true,
+	"SavedQueryExecute":       true,
+	"SQLQuery":                true,
+	"TopNGet":                 true,
+	"TopNStream":              true,
+	"TopologiesSearch":        true,
+	"TopologyDiff":            true,
+}
+
+// limitKey returns the key the request is limited by, the remote host for the
+// anonymous requests
+func limitKey(r *auth.AuthenticatedRequest) string {
+	if r.Username != "" {
+		return r.Username
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (l *Limiter) handler(wrapped auth.AuthenticatedHandlerFunc) auth.AuthenticatedHandlerFunc {
+	return func(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+		// the WebSocket connections and the UI are not limited
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			wrapped(w, r)
+			return
+		}
+
+		user := limitKey(r)
+
+		if ok, retryAfter := l.Allow(user); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, fmt.Sprintf("Rate limit exceeded for %s", user), http.StatusTooManyRequests)
+			return
+		}
+
+		if route := mux.CurrentRoute(&r.Request); route != nil && queryRoutes[route.GetName()] {
+			release, ok := l.Acquire(user)
+			if !ok {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, fmt.Sprintf("Too many concurrent queries for %s", user), http.StatusTooManyRequests)
+				return
+			}
+			defer release()
+		}
+
+		wrapped(w, r)
+	}
+}
+
+type authenticationBackend struct {
+	shttp.AuthenticationBackend
+	limiter *Limiter
+}
+
+// Wrap an HTTP handler with authentication, the calls being limited once
+// authenticated
+func (b *authenticationBackend) Wrap(wrapped auth.AuthenticatedHandlerFunc) http.HandlerFunc {
+	return b.AuthenticationBackend.Wrap(b.limiter.handler(wrapped))
+}
+
+// Wrap returns an authentication backend limiting the API calls
+// authenticated by the given backend
+func (l *Limiter) Wrap(backend shttp.AuthenticationBackend) shttp.AuthenticationBackend {
+	return &authenticationBackend{AuthenticationBackend: backend, limiter: l}
+}
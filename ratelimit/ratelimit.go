@@ -0,0 +1,224 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ratelimit
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/config"
+)
+
+// idle users are forgotten after this delay
+const purgeAfter = 10 * time.Minute
+
+// Limits describes the rate limit and the query quota of a user
+type Limits struct {
+	// Number of requests per second, 0 means no limit
+	RequestsPerSecond float64
+	// Number of requests above the rate accepted at once
+	Burst int
+	// Number of queries executed at the same time, 0 means no limit
+	MaxConcurrentQueries int
+}
+
+type userState struct {
+	limits  Limits
+	tokens  float64
+	last    time.Time
+	seen    time.Time
+	queries int
+	usage   types.RateLimitUsage
+}
+
+// Limiter enforces per user rate limits, using a token bucket, and concurrent
+// query quotas. API tokens being authenticated as service accounts, they are
+// limited on their own.
+type Limiter struct {
+	sync.Mutex
+	limits    Limits
+	overrides map[string]Limits
+	users     map[string]*userState
+	usage     types.RateLimitUsage
+	lastPurge time.Time
+	now       func() time.Time
+}
+
+func (l *Limiter) purge(now time.Time) {
+	if now.Sub(l.lastPurge) < time.Minute {
+		return
+	}
+	l.lastPurge = now
+
+	for user, state := range l.users {
+		if state.queries == 0 && now.Sub(state.seen) > purgeAfter {
+			delete(l.users, user)
+		}
+	}
+}
+
+func (l *Limiter) state(user string, now time.Time) *userState {
+	l.purge(now)
+
+	state, ok := l.users[user]
+	if !ok {
+		limits, ok := l.overrides[strings.ToLower(user)]
+		if !ok {
+			limits = l.limits
+		}
+		if limits.Burst < 1 {
+			limits.Burst = 1
+		}
+
+		state = &userState{limits: limits, tokens: float64(limits.Burst), last: now}
+		l.users[user] = state
+	}
+	state.seen = now
+
+	return state
+}
+
+// Allow returns whether a request of the user is accepted, otherwise the
+// delay after which it would be
+func (l *Limiter) Allow(user string) (bool, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	state := l.state(user, now)
+
+	rate := state.limits.RequestsPerSecond
+	if rate <= 0 {
+		return true, 0
+	}
+
+	state.tokens = math.Min(float64(state.limits.Burst), state.tokens+now.Sub(state.last).Seconds()*rate)
+	state.last = now
+
+	if state.tokens < 1 {
+		state.usage.Throttled++
+		l.usage.Throttled++
+		return false, time.Duration((1 - state.tokens) / rate * float64(time.Second))
+	}
+	state.tokens--
+
+	return true, 0
+}
+
+// Acquire reserves a query slot of the user, to be released by calling the
+// returned function once the query is executed. It returns false if the user
+// already runs the maximum number of concurrent queries.
+func (l *Limiter) Acquire(user string) (func(), bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	state := l.state(user, l.now())
+
+	if max := state.limits.MaxConcurrentQueries; max > 0 && state.queries >= max {
+		state.usage.QuotaExceeded++
+		l.usage.QuotaExceeded++
+		return nil, false
+	}
+	state.queries++
+	l.usage.ActiveQueries++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.Lock()
+			state.queries--
+			l.usage.ActiveQueries--
+			l.Unlock()
+		})
+	}, true
+}
+
+// GetStatus returns the number of rejected requests and running queries,
+// in total and for the users having been limited or running queries
+func (l *Limiter) GetStatus() *types.RateLimitStatus {
+	l.Lock()
+	defer l.Unlock()
+
+	status := &types.RateLimitStatus{
+		RateLimitUsage: l.usage,
+		Users:          make(map[string]*types.RateLimitUsage),
+	}
+
+	for user, state := range l.users {
+		if state.usage.Throttled == 0 && state.usage.QuotaExceeded == 0 && state.queries == 0 {
+			continue
+		}
+
+		usage := state.usage
+		usage.ActiveQueries = state.queries
+		status.Users[user] = &usage
+	}
+
+	return status
+}
+
+// NewLimiter returns a new limiter applying the given limits to all the
+// users but the ones with specific limits. The users are matched case
+// insensitively, as the configuration keys.
+func NewLimiter(limits Limits, overrides map[string]Limits) *Limiter {
+	lowered := make(map[string]Limits, len(overrides))
+	for user, override := range overrides {
+		lowered[strings.ToLower(user)] = override
+	}
+
+	return &Limiter{
+		limits:    limits,
+		overrides: lowered,
+		users:     make(map[string]*userState),
+		now:       time.Now,
+	}
+}
+
+// NewLimiterFromConfig returns a new limiter based on the analyzer configuration
+func NewLimiterFromConfig() *Limiter {
+	cfg := config.GetConfig()
+
+	limits := Limits{
+		RequestsPerSecond:    cfg.GetFloat64("analyzer.rate_limit.requests_per_second"),
+		Burst:                cfg.GetInt("analyzer.rate_limit.burst"),
+		MaxConcurrentQueries: cfg.GetInt("analyzer.rate_limit.max_concurrent_queries"),
+	}
+
+	// the users only override some of the limits
+	overrides := make(map[string]Limits)
+	for user := range cfg.GetStringMap("analyzer.rate_limit.users") {
+		prefix := "analyzer.rate_limit.users." + user + "."
+
+		override := limits
+		if cfg.IsSet(prefix + "requests_per_second") {
+			override.RequestsPerSecond = cfg.GetFloat64(prefix + "requests_per_second")
+		}
+		if cfg.IsSet(prefix + "burst") {
+			override.Burst = cfg.GetInt(prefix + "burst")
+		}
+		if cfg.IsSet(prefix + "max_concurrent_queries") {
+			override.MaxConcurrentQueries = cfg.GetInt(prefix + "max_concurrent_queries")
+		}
+		overrides[user] = override
+	}
+
+	return NewLimiter(limits, overrides)
+}
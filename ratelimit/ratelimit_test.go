@@ -0,0 +1,152 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/gorilla/mux"
+
+	shttp "github.com/skydive-project/skydive/http"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestLimiter(limits Limits, overrides map[string]Limits) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	limiter := NewLimiter(limits, overrides)
+	limiter.now = clock.Now
+	return limiter, clock
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter, clock := newTestLimiter(Limits{RequestsPerSecond: 2, Burst: 3}, map[string]Limits{"Admin": {}})
+
+	for i := 0; i != 3; i++ {
+		if ok, _ := limiter.Allow("user"); !ok {
+			t.Fatalf("Request %d within the burst should be accepted", i)
+		}
+	}
+
+	ok, retryAfter := limiter.Allow("user")
+	if ok || retryAfter != 500*time.Millisecond {
+		t.Errorf("Request above the burst should be rejected for 500ms, got %v, %s", ok, retryAfter)
+	}
+
+	// the other users have their own bucket
+	if ok, _ := limiter.Allow("other"); !ok {
+		t.Error("Request of another user should be accepted")
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	for i := 0; i != 2; i++ {
+		if ok, _ := limiter.Allow("user"); !ok {
+			t.Errorf("Request %d refilled after a second should be accepted", i)
+		}
+	}
+	if ok, _ := limiter.Allow("user"); ok {
+		t.Error("Only 2 requests should be refilled after a second")
+	}
+
+	for i := 0; i != 10; i++ {
+		if ok, _ := limiter.Allow("admin"); !ok {
+			t.Fatal("Requests of a user without rate limit should be accepted")
+		}
+	}
+
+	status := limiter.GetStatus()
+	if status.Throttled != 2 || status.Users["user"] == nil || status.Users["user"].Throttled != 2 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+	if _, ok := status.Users["other"]; ok {
+		t.Error("Users not limited should not be reported")
+	}
+}
+
+func TestQueryQuota(t *testing.T) {
+	limiter, _ := newTestLimiter(Limits{MaxConcurrentQueries: 1}, nil)
+
+	release, ok := limiter.Acquire("user")
+	if !ok {
+		t.Fatal("First query should be accepted")
+	}
+
+	if _, ok := limiter.Acquire("user"); ok {
+		t.Error("Second concurrent query should be rejected")
+	}
+
+	if status := limiter.GetStatus(); status.ActiveQueries != 1 || status.QuotaExceeded != 1 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	release()
+	release()
+
+	if _, ok := limiter.Acquire("user"); !ok {
+		t.Error("Query should be accepted once the previous one is done")
+	}
+	if status := limiter.GetStatus(); status.ActiveQueries != 1 {
+		t.Errorf("Releasing twice should free a single slot, got %d active queries", status.ActiveQueries)
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	limiter, _ := newTestLimiter(Limits{RequestsPerSecond: 1, Burst: 1, MaxConcurrentQueries: 1}, nil)
+	backend := limiter.Wrap(shttp.NewNoAuthenticationBackend())
+
+	// the query holds its slot while another one is sent
+	var nested int
+	router := mux.NewRouter()
+	router.Methods("POST").Path("/api/topology").Name("TopologiesSearch").Handler(backend.Wrap(func(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+		if release, ok := limiter.Acquire("admin"); ok {
+			release()
+		} else {
+			nested = http.StatusTooManyRequests
+		}
+	}))
+	router.Methods("GET").Path("/ui/index.html").Handler(backend.Wrap(func(w http.ResponseWriter, r *auth.AuthenticatedRequest) {}))
+
+	request := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	if w := request("POST", "/api/topology"); w.Code != http.StatusOK || nested != http.StatusTooManyRequests {
+		t.Errorf("The query should be accepted and hold its slot, got %d", w.Code)
+	}
+
+	w := request("POST", "/api/topology")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected a 429 status with a Retry-After header, got %d", w.Code)
+	}
+
+	if w := request("GET", "/ui/index.html"); w.Code != http.StatusOK {
+		t.Errorf("Requests outside of the API should not be limited, got %d", w.Code)
+	}
+}
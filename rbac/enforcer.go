@@ -18,6 +18,9 @@
 package rbac
 
 import (
+	"strings"
+	"sync"
+
 	"github.com/casbin/casbin"
 	"github.com/casbin/casbin/model"
 	etcd "github.com/coreos/etcd/client"
@@ -30,8 +33,18 @@ type Permission struct {
 	Allowed bool
 }
 
+// ScopePolicyType is the type of the policy rules restricting the elements
+// of an object a subject can access, for instance :
+// p1, tenant, topology, G.V().Has('K8s.Namespace', 'tenant')
+const ScopePolicyType = "p1"
+
 var enforcer *casbin.SyncedEnforcer
 
+var (
+	reloadHandlersLock sync.RWMutex
+	reloadHandlers     []func()
+)
+
 // Init loads the model from the configuration file then the policies.
 // 3 policies are applied, in that order :
 // - the policy uploaded in etcd and shared by all analyzers
@@ -62,6 +75,12 @@ func Init(model model.Model, kapi etcd.KeysAPI, loadPolicy func(model.Model) err
 		}
 		model.PrintPolicy()
 		casbinEnforcer.BuildRoleLinks()
+
+		reloadHandlersLock.RLock()
+		for _, handler := range reloadHandlers {
+			handler()
+		}
+		reloadHandlersLock.RUnlock()
 	})
 
 	enforcer = casbinEnforcer
@@ -87,6 +106,54 @@ func AddRoleForUser(user, role string) bool {
 	return enforcer.AddRoleForUser(user, role)
 }
 
+// SetRolesForUser replaces the roles of a user, if they differ
+func SetRolesForUser(user string, roles []string) {
+	if enforcer == nil {
+		return
+	}
+
+	current := make(map[string]bool)
+	for _, role := range enforcer.GetRolesForUser(user) {
+		current[role] = true
+	}
+
+	same := len(current) == len(roles)
+	for _, role := range roles {
+		same = same && current[role]
+	}
+	if same {
+		return
+	}
+
+	enforcer.DeleteRolesForUser(user)
+	for _, role := range roles {
+		enforcer.AddRoleForUser(user, role)
+	}
+}
+
+// AddPolicyReloadHandler registers a function called once the policy was
+// reloaded, to bind again the roles set with SetRolesForUser for instance
+func AddPolicyReloadHandler(handler func()) {
+	reloadHandlersLock.Lock()
+	reloadHandlers = append(reloadHandlers, handler)
+	reloadHandlersLock.Unlock()
+}
+
+// HasRoles returns whether a user holds all the given roles. Without
+// enforcer, all the roles are granted.
+func HasRoles(user string, roles []string) bool {
+	if enforcer == nil {
+		return true
+	}
+
+	for _, role := range roles {
+		if !enforcer.HasRoleForUser(user, role) {
+			return false
+		}
+	}
+	return true
+}
+
 // GetUserRoles returns the roles of a user
 func GetUserRoles(user string) []string {
 	if enforcer == nil {
@@ -122,3 +189,28 @@ func GetPermissionsForUser(user string) []Permission {
 
 	return permissions
 }
+
+// GetUserScopes returns the Gremlin expressions selecting the elements of an
+// object, the topology nodes for instance, a user and its roles can access.
+// No scope means that the access is not restricted.
+func GetUserScopes(user, obj string) []string {
+	if enforcer == nil {
+		return nil
+	}
+
+	subjects := enforcer.GetRolesForUser(user)
+	subjects = append(subjects, user)
+
+	var scopes []string
+	for _, subject := range subjects {
+		for _, p := range enforcer.GetFilteredNamedPolicy(ScopePolicyType, 0, subject, obj) {
+			// the policy lines being split on commas, the expression
+			// may have been split as well
+			if len(p) > 2 {
+				scopes = append(scopes, strings.Join(p[2:], ", "))
+			}
+		}
+	}
+
+	return scopes
+}
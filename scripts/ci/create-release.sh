@@ -71,6 +71,13 @@ release "$changelog"
 upload skydive $GOPATH/bin/skydive
 upload skydive-${VERSION}.tar.gz rpmbuild/SOURCES/skydive-${VERSION}.tar.gz
 
+# SDK packages are versioned without the suffix of development versions
+SDK_VERSION=${VERSION%%-*}
+make sdk.dist VERSION=${VERSION} SDK_VERSION=${SDK_VERSION} DESTDIR=$PWD/sdk-dist
+upload skydive-openapi-${SDK_VERSION}.json sdk-dist/skydive-openapi-${SDK_VERSION}.json
+upload skydive-sdk-go-${SDK_VERSION}.tar.gz sdk-dist/skydive-sdk-go-${SDK_VERSION}.tar.gz
+upload skydive-sdk-${SDK_VERSION}.tar.gz sdk-dist/skydive-sdk-${SDK_VERSION}.tar.gz
+
 if [ -n "$DRY_RUN" ]; then
     cleanup
 fi
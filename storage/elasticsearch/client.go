@@ -64,6 +64,8 @@ type ClientInterface interface {
 	Start()
 	AddEventListener(listener storage.EventListener)
 	UpdateByScript(typ string, query elastic.Query, script *elastic.Script, indices ...string) error
+	DeleteByQuery(typ string, query elastic.Query, indices ...string) error
+	PutMapping(typ string, mapping map[string]interface{}, indices ...string) error
 }
 
 // Index defines a Client Index
@@ -154,19 +156,8 @@ func (c *Client) createIndices() error {
 	return nil
 }
 
-func (c *Client) start() error {
-	esConfig, err := esconfig.Parse(c.url.String())
-	if err != nil {
-		return err
-	}
-
-	esClient, err := elastic.NewClientFromConfig(esConfig)
-	if err != nil {
-		return err
-	}
-	c.esClient = esClient
-
-	bulkProcessor, err := esClient.BulkProcessor().
+func (c *Client) newBulkProcessor() (*elastic.BulkProcessor, error) {
+	return c.esClient.BulkProcessor().
 		After(func(executionId int64, requests []elastic.BulkableRequest, response *elastic.BulkResponse, err error) {
 			if err != nil {
 				logging.GetLogger().Errorf("Failed to execute bulk query: %s", err)
@@ -182,6 +173,21 @@ func (c *Client) start() error {
 		}).
 		FlushInterval(time.Duration(c.cfg.BulkMaxDelay) * time.Second).
 		Do(context.Background())
+}
+
+func (c *Client) start() error {
+	esConfig, err := esconfig.Parse(c.url.String())
+	if err != nil {
+		return err
+	}
+
+	esClient, err := elastic.NewClientFromConfig(esConfig)
+	if err != nil {
+		return err
+	}
+	c.esClient = esClient
+
+	bulkProcessor, err := c.newBulkProcessor()
 	if err != nil {
 		return err
 	}
@@ -321,12 +327,47 @@ func (c *Client) Index(index Index, id string, data interface{}) error {
 
 // BulkIndex returns the bulk index from the indexer
 func (c *Client) BulkIndex(index Index, id string, data interface{}) error {
-	req := elastic.NewBulkIndexRequest().Index(index.Alias()).Type(index.Type).Id(id).Doc(data)
-	c.bulkProcessor.Add(req)
+	c.bulkProcessor.Add(newBulkIndexRequest(index, id, data))
+
+	return nil
+}
+
+// BulkIndexer indexes documents with a bulk processor of its own
+type BulkIndexer struct {
+	bulkProcessor *elastic.BulkProcessor
+}
+
+// BulkIndex adds a document to the bulk processor of the indexer
+func (b *BulkIndexer) BulkIndex(index Index, id string, data interface{}) error {
+	b.bulkProcessor.Add(newBulkIndexRequest(index, id, data))
 
 	return nil
 }
 
+// Close flushes the pending documents and stops the indexer
+func (b *BulkIndexer) Close() error {
+	return b.bulkProcessor.Close()
+}
+
+// NewBulkIndexer returns an indexer with a bulk processor of its own, the
+// client has to be started
+func (c *Client) NewBulkIndexer() (*BulkIndexer, error) {
+	if !c.Started() {
+		return nil, errors.New("Client is not yet started")
+	}
+
+	bulkProcessor, err := c.newBulkProcessor()
+	if err != nil {
+		return nil, err
+	}
+
+	return &BulkIndexer{bulkProcessor: bulkProcessor}, nil
+}
+
+func newBulkIndexRequest(index Index, id string, data interface{}) *elastic.BulkIndexRequest {
+	return elastic.NewBulkIndexRequest().Index(index.Alias()).Type(index.Type).Id(id).Doc(data)
+}
+
 // Get an object
 func (c *Client) Get(index Index, id string) (*elastic.GetResult, error) {
 	return c.esClient.Get().Index(index.Alias()).Type(index.Type).Id(id).Do(context.Background())
@@ -353,6 +394,22 @@ func (c *Client) UpdateByScript(typ string, query elastic.Query, script *elastic
 	return nil
 }
 
+// DeleteByQuery deletes the documents matching the given query
+func (c *Client) DeleteByQuery(typ string, query elastic.Query, indices ...string) error {
+	if _, err := c.esClient.DeleteByQuery(indices...).Type(typ).Query(query).Refresh("true").Do(context.Background()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// PutMapping adds fields to the mapping of the given indices
+func (c *Client) PutMapping(typ string, mapping map[string]interface{}, indices ...string) error {
+	if _, err := c.esClient.PutMapping().Index(indices...).Type(typ).BodyJson(mapping).Do(context.Background()); err != nil {
+		return err
+	}
+	return nil
+}
+
 // Search an object
 func (c *Client) Search(typ string, query elastic.Query, opts filters.SearchQuery, indices ...string) (*elastic.SearchResult, error) {
 	searchQuery := c.esClient.
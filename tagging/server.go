@@ -0,0 +1,395 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package tagging
+
+import (
+	"sort"
+	"strings"
+
+	api "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/etcd"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	"github.com/skydive-project/skydive/logging"
+)
+
+const (
+	tagsKey   = "Tags"
+	labelsKey = "Labels"
+)
+
+// rule is a tagging rule with its parsed Gremlin expression
+type rule struct {
+	*types.TaggingRule
+	traversalSequence *traversal.GremlinTraversalSequence
+}
+
+// actions holds the tags and labels the rules set on an element
+type actions struct {
+	tags   map[string]bool
+	labels map[string]string
+}
+
+func newActions() *actions {
+	return &actions{
+		tags:   make(map[string]bool),
+		labels: make(map[string]string),
+	}
+}
+
+func (a *actions) merge(r *types.TaggingRule) {
+	for _, tag := range r.Tags {
+		a.tags[tag] = true
+	}
+	for k, v := range r.Labels {
+		a.labels[k] = v
+	}
+}
+
+// Server evaluates the tagging rules on graph events and keeps the tags and
+// labels of the matching nodes and edges up to date
+type Server struct {
+	common.RWMutex
+	common.MasterElection
+	graph.DefaultGraphListener
+	Graph         *graph.Graph
+	RuleHandler   api.Handler
+	watcher       api.StoppableWatcher
+	rules         map[string]*rule
+	applied       map[graph.Identifier]*actions
+	gremlinParser *traversal.GremlinTraversalParser
+	evaluating    bool
+}
+
+func elementID(i interface{}) (graph.Identifier, bool) {
+	switch e := i.(type) {
+	case *graph.Node:
+		return e.ID, true
+	case *graph.Edge:
+		return e.ID, true
+	}
+	return "", false
+}
+
+func (s *Server) matchingElements(r *rule) []interface{} {
+	result, err := r.traversalSequence.Exec(s.Graph, false)
+	if err != nil {
+		logging.GetLogger().Warningf("Failed to evaluate tagging rule %s: %s", r.UUID, err)
+		return nil
+	}
+
+	var elements []interface{}
+	for _, value := range result.Values() {
+		switch value := value.(type) {
+		case *graph.Node, *graph.Edge:
+			elements = append(elements, value)
+		case []*graph.Node:
+			for _, n := range value {
+				elements = append(elements, n)
+			}
+		case []*graph.Edge:
+			for _, e := range value {
+				elements = append(elements, e)
+			}
+		}
+	}
+	return elements
+}
+
+// evaluate runs all the rules and updates the tags and labels of the elements
+// whose matching rules changed. The graph lock must be held.
+func (s *Server) evaluate() {
+	// updating the metadata triggers new graph events
+	if s.evaluating || !s.IsMaster() {
+		return
+	}
+	s.evaluating = true
+	defer func() { s.evaluating = false }()
+
+	s.Lock()
+	defer s.Unlock()
+
+	elements := make(map[graph.Identifier]interface{})
+	wanted := make(map[graph.Identifier]*actions)
+	for _, r := range s.rules {
+		for _, element := range s.matchingElements(r) {
+			id, _ := elementID(element)
+			elements[id] = element
+			if _, found := wanted[id]; !found {
+				wanted[id] = newActions()
+			}
+			wanted[id].merge(r.TaggingRule)
+		}
+	}
+
+	for id := range s.applied {
+		if _, found := elements[id]; found {
+			continue
+		}
+		if n := s.Graph.GetNode(id); n != nil {
+			elements[id] = n
+		} else if e := s.Graph.GetEdge(id); e != nil {
+			elements[id] = e
+		} else {
+			delete(s.applied, id)
+		}
+	}
+
+	for id, element := range elements {
+		previous, want := s.applied[id], wanted[id]
+		if previous == nil {
+			previous = newActions()
+		}
+		if want == nil {
+			want = newActions()
+		}
+
+		if err := s.apply(element, previous, want); err != nil {
+			logging.GetLogger().Errorf("Failed to tag %s: %s", id, err)
+			continue
+		}
+
+		if len(want.tags) == 0 && len(want.labels) == 0 {
+			delete(s.applied, id)
+		} else {
+			s.applied[id] = want
+		}
+	}
+}
+
+func getTags(g common.Getter) []string {
+	value, err := g.GetField(tagsKey)
+	if err != nil {
+		return nil
+	}
+
+	var tags []string
+	switch value := value.(type) {
+	case []string:
+		tags = append(tags, value...)
+	case []interface{}:
+		for _, tag := range value {
+			if tag, ok := tag.(string); ok {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+func getLabels(g common.Getter) map[string]string {
+	value, err := g.GetField(labelsKey)
+	if err != nil {
+		return nil
+	}
+
+	labels := make(map[string]string)
+	switch value := value.(type) {
+	case map[string]string:
+		for k, v := range value {
+			labels[k] = v
+		}
+	case map[string]interface{}:
+		for k, v := range value {
+			if v, ok := v.(string); ok {
+				labels[k] = v
+			}
+		}
+	}
+	return labels
+}
+
+// apply replaces the tags and labels previously set by the rules on an
+// element by the wanted ones, keeping the ones set by other sources
+func (s *Server) apply(element interface{}, previous, want *actions) error {
+	getter := element.(common.Getter)
+
+	currentTags := getTags(getter)
+	var tags []string
+	for _, tag := range currentTags {
+		if !previous.tags[tag] && !want.tags[tag] {
+			tags = append(tags, tag)
+		}
+	}
+	var added []string
+	for tag := range want.tags {
+		added = append(added, tag)
+	}
+	sort.Strings(added)
+	tags = append(tags, added...)
+
+	currentLabels := getLabels(getter)
+	labels := make(map[string]string)
+	for k, v := range currentLabels {
+		if _, found := previous.labels[k]; !found {
+			labels[k] = v
+		}
+	}
+	for k, v := range want.labels {
+		labels[k] = v
+	}
+
+	tagsChanged := strings.Join(tags, "\x00") != strings.Join(currentTags, "\x00")
+	labelsChanged := len(labels) != len(currentLabels)
+	for k, v := range labels {
+		if cv, found := currentLabels[k]; !found || cv != v {
+			labelsChanged = true
+		}
+	}
+
+	if !tagsChanged && !labelsChanged {
+		return nil
+	}
+
+	tr := s.Graph.StartMetadataTransaction(element)
+	if tagsChanged {
+		if len(tags) > 0 {
+			tr.AddMetadata(tagsKey, tags)
+		} else {
+			tr.DelMetadata(tagsKey)
+		}
+	}
+	if labelsChanged {
+		if len(labels) > 0 {
+			tr.AddMetadata(labelsKey, labels)
+		} else {
+			tr.DelMetadata(labelsKey)
+		}
+	}
+	return tr.Commit()
+}
+
+// OnNodeAdded event
+func (s *Server) OnNodeAdded(n *graph.Node) {
+	s.evaluate()
+}
+
+// OnNodeUpdated event
+func (s *Server) OnNodeUpdated(n *graph.Node) {
+	s.evaluate()
+}
+
+// OnNodeDeleted event
+func (s *Server) OnNodeDeleted(n *graph.Node) {
+	s.evaluate()
+}
+
+// OnEdgeAdded event
+func (s *Server) OnEdgeAdded(e *graph.Edge) {
+	s.evaluate()
+}
+
+// OnEdgeUpdated event
+func (s *Server) OnEdgeUpdated(e *graph.Edge) {
+	s.evaluate()
+}
+
+// OnEdgeDeleted event
+func (s *Server) OnEdgeDeleted(e *graph.Edge) {
+	s.evaluate()
+}
+
+// OnStartAsMaster event
+func (s *Server) OnStartAsMaster() {
+}
+
+// OnStartAsSlave event
+func (s *Server) OnStartAsSlave() {
+}
+
+// OnSwitchToMaster event, the tags are only set by the master
+func (s *Server) OnSwitchToMaster() {
+	s.Graph.Lock()
+	s.evaluate()
+	s.Graph.Unlock()
+}
+
+// OnSwitchToSlave event
+func (s *Server) OnSwitchToSlave() {
+}
+
+func (s *Server) registerRule(taggingRule *types.TaggingRule) error {
+	ts, err := s.gremlinParser.Parse(strings.NewReader(taggingRule.Query))
+	if err != nil {
+		return err
+	}
+
+	logging.GetLogger().Debugf("Registering tagging rule: %+v", taggingRule)
+
+	s.Lock()
+	s.rules[taggingRule.UUID] = &rule{TaggingRule: taggingRule, traversalSequence: ts}
+	s.Unlock()
+
+	return nil
+}
+
+func (s *Server) unregisterRule(id string) {
+	logging.GetLogger().Debugf("Unregistering tagging rule: %s", id)
+
+	s.Lock()
+	delete(s.rules, id)
+	s.Unlock()
+}
+
+func (s *Server) onAPIWatcherEvent(action string, id string, resource types.Resource) {
+	switch action {
+	case "init", "create", "set", "update":
+		if err := s.registerRule(resource.(*types.TaggingRule)); err != nil {
+			logging.GetLogger().Errorf("Failed to register tagging rule: %s", err)
+			return
+		}
+	case "expire", "delete":
+		s.unregisterRule(id)
+	}
+
+	s.Graph.Lock()
+	s.evaluate()
+	s.Graph.Unlock()
+}
+
+// Start the tagging server
+func (s *Server) Start() {
+	s.StartAndWait()
+
+	s.watcher = s.RuleHandler.AsyncWatch(s.onAPIWatcherEvent)
+	s.Graph.AddEventListener(s)
+}
+
+// Stop the tagging server
+func (s *Server) Stop() {
+	s.Graph.RemoveEventListener(s)
+	s.watcher.Stop()
+	s.MasterElection.Stop()
+}
+
+// NewServer creates a new tagging server
+func NewServer(apiServer *api.Server, g *graph.Graph, parser *traversal.GremlinTraversalParser, etcdClient *etcd.Client) *Server {
+	s := &Server{
+		MasterElection: etcdClient.NewElection("tagging-server"),
+		Graph:          g,
+		RuleHandler:    apiServer.GetHandler("taggingrule"),
+		rules:          make(map[string]*rule),
+		applied:        make(map[graph.Identifier]*actions),
+		gremlinParser:  parser,
+	}
+	s.MasterElection.AddEventListener(s)
+
+	return s
+}
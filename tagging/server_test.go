@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package tagging
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+)
+
+type masterElection struct{}
+
+func (m *masterElection) Start()                                                  {}
+func (m *masterElection) StartAndWait()                                           {}
+func (m *masterElection) Stop()                                                   {}
+func (m *masterElection) IsMaster() bool                                          { return true }
+func (m *masterElection) AddEventListener(listener common.MasterElectionListener) {}
+func (m *masterElection) TTL() time.Duration                                      { return 0 }
+
+func newServer(t *testing.T) *Server {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := graph.NewGraph("testhost", b, common.UnknownService)
+
+	s := &Server{
+		MasterElection: &masterElection{},
+		Graph:          g,
+		rules:          make(map[string]*rule),
+		applied:        make(map[graph.Identifier]*actions),
+		gremlinParser:  traversal.NewGremlinTraversalParser(),
+	}
+	g.AddEventListener(s)
+
+	return s
+}
+
+func TestTaggingRule(t *testing.T) {
+	s := newServer(t)
+	g := s.Graph
+
+	g.Lock()
+	defer g.Unlock()
+
+	n1, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth0", "Type": "device", "MTU": 1400, "Tags": []string{"user"}})
+	n2, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth1", "Type": "device", "MTU": 9000})
+
+	rule := &types.TaggingRule{
+		Query:  "G.V().Has('Type', 'device', 'MTU', LT(1500))",
+		Tags:   []string{"jumbo-mismatch"},
+		Labels: map[string]string{"severity": "warning"},
+	}
+	rule.UUID = "rule1"
+	if err := s.registerRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	s.evaluate()
+
+	if tags := getTags(n1); !reflect.DeepEqual(tags, []string{"user", "jumbo-mismatch"}) {
+		t.Errorf("Wrong tags for eth0: %v", tags)
+	}
+	if labels := getLabels(n1); labels["severity"] != "warning" {
+		t.Errorf("Wrong labels for eth0: %v", labels)
+	}
+	if tags := getTags(n2); len(tags) != 0 {
+		t.Errorf("eth1 should not be tagged: %v", tags)
+	}
+
+	// the rules are evaluated on graph updates
+	g.AddMetadata(n1, "MTU", 1500)
+	g.AddMetadata(n2, "MTU", 1000)
+
+	if tags := getTags(n1); !reflect.DeepEqual(tags, []string{"user"}) {
+		t.Errorf("Wrong tags for eth0: %v", tags)
+	}
+	if _, err := n1.GetField("Labels"); err == nil {
+		t.Errorf("Labels of eth0 should have been removed")
+	}
+	if tags := getTags(n2); strings.Join(tags, ",") != "jumbo-mismatch" {
+		t.Errorf("Wrong tags for eth1: %v", tags)
+	}
+
+	s.unregisterRule("rule1")
+	s.evaluate()
+
+	if tags := getTags(n2); len(tags) != 0 {
+		t.Errorf("eth1 should not be tagged anymore: %v", tags)
+	}
+}
@@ -18,6 +18,7 @@
 package tests
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
@@ -53,7 +54,7 @@ func TestAlertAPI(t *testing.T) {
 		t.Error(err)
 	}
 
-	if *alert != *alert2 {
+	if !reflect.DeepEqual(alert, alert2) {
 		t.Errorf("Alert corrupted: %+v != %+v", alert, alert2)
 	}
 
@@ -66,7 +67,7 @@ func TestAlertAPI(t *testing.T) {
 		}
 	}
 
-	if alerts[alert.UUID] != *alert {
+	if !reflect.DeepEqual(alerts[alert.UUID], *alert) {
 		t.Errorf("Alert corrupted: %+v != %+v", alerts[alert.UUID], alert)
 	}
 
@@ -0,0 +1,296 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topn
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// trackedFlow records the capture point whose updates are accounted for a
+// flow, so that a flow captured at several points is only accounted once
+type trackedFlow struct {
+	uuid string
+	seen int64
+}
+
+type subscriber struct {
+	groupBy string
+	by      string
+	n       int
+	stream  *shttp.SSEStream
+}
+
+// Server ranks the talkers of the flows received by the analyzer and
+// streams the rankings to its subscribers at every update interval
+type Server struct {
+	sync.RWMutex
+	interval    time.Duration
+	size        int
+	window      *window
+	start       int64
+	last        int64
+	tracked     map[string]*trackedFlow
+	subscribers map[*subscriber]bool
+	quit        chan bool
+	wg          sync.WaitGroup
+}
+
+// flowKeys returns the keys of the groups a flow belongs to
+func flowKeys(f *flow.Flow) map[string][]string {
+	keys := make(map[string][]string)
+
+	endpoints := f.Network
+	if endpoints == nil {
+		endpoints = f.Link
+	}
+	if endpoints != nil {
+		keys[GroupByHost] = []string{endpoints.A, endpoints.B}
+
+		a, b := endpoints.A, endpoints.B
+		if b < a {
+			a, b = b, a
+		}
+		keys[GroupByPair] = []string{a + " <-> " + b}
+	}
+
+	if f.Application != "" {
+		keys[GroupByApplication] = []string{f.Application}
+	}
+
+	if f.Transport != nil {
+		// the first packet captured is a reply when the capture started in
+		// the middle of a connection
+		port := f.Transport.B
+		if f.Transport.A < 1024 && f.Transport.B >= 1024 {
+			port = f.Transport.A
+		}
+		keys[GroupByPort] = []string{fmt.Sprintf("%s/%d", f.Transport.Protocol, port)}
+	}
+
+	return keys
+}
+
+// OnFlows accounts the traffic of the flow updates in the current slot
+func (s *Server) OnFlows(flows []*flow.Flow) {
+	now := common.UnixMillis(time.Now())
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, f := range flows {
+		metric := f.LastUpdateMetric
+		if metric == nil {
+			metric = f.Metric
+		}
+		if metric == nil {
+			continue
+		}
+
+		t, found := s.tracked[f.TrackingID]
+		if !found {
+			t = &trackedFlow{uuid: f.UUID}
+			s.tracked[f.TrackingID] = t
+		} else if t.uuid != f.UUID {
+			continue
+		}
+		t.seen = now
+
+		bytes, packets := metric.ABBytes+metric.BABytes, metric.ABPackets+metric.BAPackets
+		for groupBy, keys := range flowKeys(f) {
+			for _, key := range keys {
+				s.window.add(groupBy, key, bytes, packets)
+			}
+		}
+
+		if f.FinishType != flow.FlowFinishType_NOT_FINISHED {
+			delete(s.tracked, f.TrackingID)
+		}
+	}
+}
+
+func isKind(kinds []string, kind string) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func checkKinds(groupBy, by string, n int) error {
+	if !isKind(groupKinds, groupBy) {
+		return fmt.Errorf("Unknown group '%s', should be one of %s", groupBy, strings.Join(groupKinds, ", "))
+	}
+	if !isKind(rankKinds, by) {
+		return fmt.Errorf("Unknown ranking '%s', should be one of %s", by, strings.Join(rankKinds, ", "))
+	}
+	if n <= 0 {
+		return fmt.Errorf("Invalid number of talkers %d", n)
+	}
+	return nil
+}
+
+// top returns the current ranking, the lock being held by the caller
+func (s *Server) top(groupBy, by string, n int) *Top {
+	talkers := s.window.top(groupBy, by, n)
+	if talkers == nil {
+		talkers = []*Talker{}
+	}
+
+	return &Top{
+		GroupBy: groupBy,
+		By:      by,
+		Start:   s.start,
+		Last:    s.last,
+		Talkers: talkers,
+	}
+}
+
+// GetTopN returns the n first talkers of the last ranking
+func (s *Server) GetTopN(groupBy, by string, n int) (interface{}, error) {
+	if err := checkKinds(groupBy, by, n); err != nil {
+		return nil, err
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.top(groupBy, by, n), nil
+}
+
+func send(sub *subscriber, top *Top) {
+	data, err := json.Marshal(top)
+	if err != nil {
+		logging.GetLogger().Errorf("Unable to encode the top talkers: %s", err)
+		return
+	}
+	sub.stream.Send("topn", data)
+}
+
+// SubscribeTopN sends the n first talkers to the stream at every update of
+// the ranking, starting with the current one. The returned function ends
+// the subscription.
+func (s *Server) SubscribeTopN(groupBy, by string, n int, stream *shttp.SSEStream) (func(), error) {
+	if err := checkKinds(groupBy, by, n); err != nil {
+		return nil, err
+	}
+
+	sub := &subscriber{groupBy: groupBy, by: by, n: n, stream: stream}
+
+	s.Lock()
+	s.subscribers[sub] = true
+	top := s.top(groupBy, by, n)
+	s.Unlock()
+
+	send(sub, top)
+
+	return func() {
+		s.Lock()
+		delete(s.subscribers, sub)
+		s.Unlock()
+	}, nil
+}
+
+// slide ranks the talkers of the window and sends the rankings to the
+// subscribers
+func (s *Server) slide() {
+	now := time.Now()
+
+	s.Lock()
+
+	s.window.slide()
+
+	s.last = common.UnixMillis(now)
+	if start := common.UnixMillis(now.Add(-time.Duration(s.size) * s.interval)); start > s.start {
+		s.start = start
+	}
+
+	// flows may expire on the agents without being reported as finished
+	unseen := common.UnixMillis(now.Add(-2 * time.Duration(s.size) * s.interval))
+	for id, t := range s.tracked {
+		if t.seen < unseen {
+			delete(s.tracked, id)
+		}
+	}
+
+	tops := make(map[*subscriber]*Top, len(s.subscribers))
+	for sub := range s.subscribers {
+		tops[sub] = s.top(sub.groupBy, sub.by, sub.n)
+	}
+
+	s.Unlock()
+
+	for sub, top := range tops {
+		send(sub, top)
+	}
+}
+
+// Start the top talkers server
+func (s *Server) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.slide()
+			case <-s.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the top talkers server
+func (s *Server) Stop() {
+	s.quit <- true
+	s.wg.Wait()
+}
+
+// NewServer creates a new top talkers server
+func NewServer() *Server {
+	interval := time.Duration(config.GetInt("analyzer.topn.interval")) * time.Second
+	size := int(time.Duration(config.GetInt("analyzer.topn.window")) * time.Second / interval)
+	if size < 1 {
+		size = 1
+	}
+
+	return &Server{
+		interval:    interval,
+		size:        size,
+		window:      newWindow(size),
+		start:       common.UnixMillis(time.Now()),
+		tracked:     make(map[string]*trackedFlow),
+		subscribers: make(map[*subscriber]bool),
+		quit:        make(chan bool),
+	}
+}
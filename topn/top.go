@@ -0,0 +1,157 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topn
+
+import (
+	"sort"
+)
+
+const (
+	// GroupByHost accounts the traffic of the flows to both their ends
+	GroupByHost = "host"
+	// GroupByPair accounts the traffic between two ends, whatever the direction
+	GroupByPair = "pair"
+	// GroupByApplication accounts the traffic per application protocol
+	GroupByApplication = "application"
+	// GroupByPort accounts the traffic per transport protocol and server port
+	GroupByPort = "port"
+
+	// ByBytes ranks the talkers by number of bytes
+	ByBytes = "bytes"
+	// ByPackets ranks the talkers by number of packets
+	ByPackets = "packets"
+)
+
+var (
+	groupKinds = []string{GroupByHost, GroupByPair, GroupByApplication, GroupByPort}
+	rankKinds  = []string{ByBytes, ByPackets}
+)
+
+// Talker holds the traffic of a group of flows over the window
+type Talker struct {
+	Key     string
+	Bytes   int64
+	Packets int64
+}
+
+// Top describes the groups of flows having exchanged the most bytes or
+// packets over a sliding window, timestamps in milliseconds
+// swagger:model TopN
+type Top struct {
+	GroupBy string
+	By      string
+	Start   int64
+	Last    int64
+	Talkers []*Talker
+}
+
+type counters map[string]*Talker
+
+// window accumulates the traffic in slots, one per update interval, the
+// talkers being ranked over all the slots when the window slides
+type window struct {
+	slots   []map[string]counters
+	current int
+	ranked  map[string]map[string][]*Talker
+}
+
+func newSlot() map[string]counters {
+	slot := make(map[string]counters)
+	for _, kind := range groupKinds {
+		slot[kind] = make(counters)
+	}
+	return slot
+}
+
+func (w *window) add(groupBy, key string, bytes, packets int64) {
+	c := w.slots[w.current][groupBy]
+
+	t, found := c[key]
+	if !found {
+		t = &Talker{Key: key}
+		c[key] = t
+	}
+	t.Bytes += bytes
+	t.Packets += packets
+}
+
+// slide ranks the talkers of all the slots then starts a new slot in place
+// of the oldest one
+func (w *window) slide() {
+	for _, groupBy := range groupKinds {
+		totals := make(counters)
+		for _, slot := range w.slots {
+			for key, t := range slot[groupBy] {
+				total, found := totals[key]
+				if !found {
+					total = &Talker{Key: key}
+					totals[key] = total
+				}
+				total.Bytes += t.Bytes
+				total.Packets += t.Packets
+			}
+		}
+
+		talkers := make([]*Talker, 0, len(totals))
+		for _, t := range totals {
+			talkers = append(talkers, t)
+		}
+
+		byBytes := make([]*Talker, len(talkers))
+		copy(byBytes, talkers)
+		sort.Slice(byBytes, func(i, j int) bool {
+			if byBytes[i].Bytes != byBytes[j].Bytes {
+				return byBytes[i].Bytes > byBytes[j].Bytes
+			}
+			return byBytes[i].Key < byBytes[j].Key
+		})
+
+		byPackets := talkers
+		sort.Slice(byPackets, func(i, j int) bool {
+			if byPackets[i].Packets != byPackets[j].Packets {
+				return byPackets[i].Packets > byPackets[j].Packets
+			}
+			return byPackets[i].Key < byPackets[j].Key
+		})
+
+		w.ranked[groupBy] = map[string][]*Talker{ByBytes: byBytes, ByPackets: byPackets}
+	}
+
+	w.current = (w.current + 1) % len(w.slots)
+	w.slots[w.current] = newSlot()
+}
+
+// top returns the first n talkers of the last ranking
+func (w *window) top(groupBy, by string, n int) []*Talker {
+	talkers := w.ranked[groupBy][by]
+	if len(talkers) > n {
+		talkers = talkers[:n]
+	}
+	return talkers
+}
+
+func newWindow(size int) *window {
+	w := &window{
+		slots:  make([]map[string]counters, size),
+		ranked: make(map[string]map[string][]*Talker),
+	}
+	for i := range w.slots {
+		w.slots[i] = newSlot()
+	}
+	return w
+}
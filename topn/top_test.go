@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topn
+
+import (
+	"testing"
+)
+
+func TestWindowSlide(t *testing.T) {
+	w := newWindow(2)
+
+	w.add(GroupByHost, "192.168.0.1", 1000, 10)
+	w.add(GroupByHost, "192.168.0.2", 500, 50)
+	w.add(GroupByHost, "192.168.0.3", 100, 1)
+	w.slide()
+
+	top := w.top(GroupByHost, ByBytes, 2)
+	if len(top) != 2 || top[0].Key != "192.168.0.1" || top[1].Key != "192.168.0.2" {
+		t.Fatalf("Wrong top talkers by bytes: %+v", top)
+	}
+
+	if top = w.top(GroupByHost, ByPackets, 10); len(top) != 3 || top[0].Key != "192.168.0.2" {
+		t.Fatalf("Wrong top talkers by packets: %+v", top)
+	}
+
+	// the second slot adds up to the first one
+	w.add(GroupByHost, "192.168.0.3", 2000, 20)
+	w.slide()
+
+	if top = w.top(GroupByHost, ByBytes, 1); len(top) != 1 || top[0].Key != "192.168.0.3" || top[0].Bytes != 2100 {
+		t.Fatalf("Wrong top talker over the window: %+v", top)
+	}
+
+	// the first slot is now out of the window
+	w.slide()
+
+	if top = w.top(GroupByHost, ByBytes, 10); len(top) != 1 || top[0].Bytes != 2000 || top[0].Packets != 20 {
+		t.Fatalf("Expected the talker of the second slot only, got: %+v", top)
+	}
+
+	if top = w.top(GroupByPort, ByBytes, 10); len(top) != 0 {
+		t.Fatalf("Expected no talker, got: %+v", top)
+	}
+}
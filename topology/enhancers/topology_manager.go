@@ -32,6 +32,10 @@ import (
 	"github.com/skydive-project/skydive/topology"
 )
 
+// userManager is the manager of the nodes and edges defined through the API.
+// It tells the probes they don't own these elements.
+const userManager = "user"
+
 // TopologyManager describes topology manager
 type TopologyManager struct {
 	common.MasterElection
@@ -41,6 +45,8 @@ type TopologyManager struct {
 	nodeHandler *apiServer.NodeRuleAPI
 	edgeHandler *apiServer.EdgeRuleAPI
 	graph       *graph.Graph
+	syncing     bool
+	syncPending bool
 }
 
 // DefToMetadata converts a string in k1=v1,k2=v2,... format to a metadata object
@@ -83,6 +89,14 @@ func (tm *TopologyManager) OnSwitchToSlave() {
 }
 
 func (tm *TopologyManager) syncTopology() {
+	// creating elements may delete others, e.g. a previous ownership link,
+	// which would trigger a new synchronization
+	if tm.syncing {
+		return
+	}
+	tm.syncing = true
+	defer func() { tm.syncing = false }()
+
 	nodes := tm.nodeHandler.Index()
 	edges := tm.edgeHandler.Index()
 
@@ -97,6 +111,38 @@ func (tm *TopologyManager) syncTopology() {
 	}
 }
 
+// deferSyncTopology synchronizes the topology once the graph lock is released.
+// The edges of a node are deleted before the node itself, a synchronization
+// done meanwhile would link the node being deleted again.
+func (tm *TopologyManager) deferSyncTopology() {
+	if tm.syncPending {
+		return
+	}
+	tm.syncPending = true
+
+	go func() {
+		tm.graph.Lock()
+		defer tm.graph.Unlock()
+
+		tm.syncPending = false
+		tm.syncTopology()
+	}()
+}
+
+// userMetadata returns a copy of the given metadata owned by the user manager
+func userMetadata(m graph.Metadata) graph.Metadata {
+	metadata := graph.Metadata{}
+	for k, v := range m {
+		metadata[k] = v
+	}
+	metadata["Manager"] = userManager
+	return metadata
+}
+
+func isUserManaged(m graph.Metadata) bool {
+	return m["Manager"] == userManager
+}
+
 func (tm *TopologyManager) createEdge(edge *types.EdgeRule) error {
 	src := tm.getNodes(edge.Src)
 	dst := tm.getNodes(edge.Dst)
@@ -105,14 +151,16 @@ func (tm *TopologyManager) createEdge(edge *types.EdgeRule) error {
 		return errors.New("Source or Destination node not found")
 	}
 
+	metadata := userMetadata(edge.Metadata)
+
 	switch edge.Metadata["RelationType"] {
 	case "layer2":
 		if !topology.HaveLayer2Link(tm.graph, src[0], dst[0]) {
-			topology.AddLayer2Link(tm.graph, src[0], dst[0], edge.Metadata)
+			topology.AddLayer2Link(tm.graph, src[0], dst[0], metadata)
 		}
 	case "ownership":
 		if !topology.HaveOwnershipLink(tm.graph, src[0], dst[0]) {
-			topology.AddOwnershipLink(tm.graph, src[0], dst[0], nil)
+			topology.AddOwnershipLink(tm.graph, src[0], dst[0], metadata)
 		}
 	default:
 		// check nodes are already linked
@@ -120,7 +168,7 @@ func (tm *TopologyManager) createEdge(edge *types.EdgeRule) error {
 			return errors.New("Nodes are already linked")
 		}
 		id := graph.GenID(string(src[0].ID) + string(dst[0].ID) + edge.Metadata["RelationType"].(string))
-		_, err := tm.graph.NewEdge(id, src[0], dst[0], edge.Metadata)
+		_, err := tm.graph.NewEdge(id, src[0], dst[0], metadata)
 		if err != nil {
 			return err
 		}
@@ -141,11 +189,12 @@ func (tm *TopologyManager) createNode(node *types.NodeRule) error {
 		return nil
 	}
 
+	metadata := userMetadata(node.Metadata)
 	if node.Metadata["Type"] == "fabric" {
-		node.Metadata["Probe"] = "fabric"
+		metadata["Probe"] = "fabric"
 	}
 
-	tm.graph.NewNode(id, node.Metadata, "")
+	tm.graph.NewNode(id, metadata, "")
 	return nil
 }
 
@@ -274,6 +323,21 @@ func (tm *TopologyManager) OnNodeUpdated(n *graph.Node) {
 	tm.syncTopology()
 }
 
+// OnNodeDeleted event, user defined nodes are recreated unless their rule was removed
+func (tm *TopologyManager) OnNodeDeleted(n *graph.Node) {
+	if isUserManaged(n.Metadata) {
+		tm.deferSyncTopology()
+	}
+}
+
+// OnEdgeDeleted event, user defined edges are recreated unless their rule was removed
+// or one of their nodes is gone
+func (tm *TopologyManager) OnEdgeDeleted(e *graph.Edge) {
+	if isUserManaged(e.Metadata) {
+		tm.deferSyncTopology()
+	}
+}
+
 // Start start the topology manager
 func (tm *TopologyManager) Start() {
 	tm.MasterElection.StartAndWait()
@@ -0,0 +1,182 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package usertopology
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+
+	apiServer "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+// rulesKeysAPI returns the rules stored under a directory as etcd would
+type rulesKeysAPI struct {
+	etcd.KeysAPI
+	rules map[string][]types.Resource
+}
+
+func (k *rulesKeysAPI) Get(ctx context.Context, key string, opts *etcd.GetOptions) (*etcd.Response, error) {
+	dir := &etcd.Node{Key: key, Dir: true}
+	for _, rule := range k.rules[key] {
+		data, _ := json.Marshal(rule)
+		dir.Nodes = append(dir.Nodes, &etcd.Node{Key: key + rule.ID(), Value: string(data)})
+	}
+	return &etcd.Response{Node: dir}, nil
+}
+
+func newTestTopologyManager(t *testing.T) *TopologyManager {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.UnknownService)
+	g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth0", "Type": "device", "Manager": "netlink"})
+
+	nodeRule := &types.NodeRule{
+		Action:   "create",
+		Metadata: graph.Metadata{"Name": "switch", "Type": "switch"},
+	}
+	nodeRule.SetID("switch")
+
+	edgeRule := &types.EdgeRule{
+		Src:      "G.V().Has('Name', 'eth0')",
+		Dst:      "G.V().Has('Name', 'switch')",
+		Metadata: graph.Metadata{"RelationType": "layer2"},
+	}
+	edgeRule.SetID("link")
+
+	kapi := &rulesKeysAPI{rules: map[string][]types.Resource{
+		"/noderule/": {nodeRule},
+		"/edgerule/": {edgeRule},
+	}}
+
+	tm := &TopologyManager{
+		nodeHandler: &apiServer.NodeRuleAPI{
+			BasicAPIHandler: apiServer.BasicAPIHandler{ResourceHandler: &apiServer.NodeRuleResourceHandler{}, EtcdKeyAPI: kapi},
+			Graph:           g,
+		},
+		edgeHandler: &apiServer.EdgeRuleAPI{
+			BasicAPIHandler: apiServer.BasicAPIHandler{ResourceHandler: &apiServer.EdgeRuleResourceHandler{}, EtcdKeyAPI: kapi},
+			Graph:           g,
+		},
+		graph: g,
+	}
+
+	g.Lock()
+	tm.syncTopology()
+	g.Unlock()
+
+	g.AddEventListener(tm)
+	return tm
+}
+
+// waitSync waits for the deferred synchronization of the topology
+func waitSync(t *testing.T, tm *TopologyManager) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tm.graph.RLock()
+		pending := tm.syncPending
+		tm.graph.RUnlock()
+
+		if !pending {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("The topology was not synchronized")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUserMetadata(t *testing.T) {
+	m := graph.Metadata{"Name": "switch", "Manager": "netlink"}
+
+	metadata := userMetadata(m)
+	if !isUserManaged(metadata) || metadata["Name"] != "switch" {
+		t.Errorf("Expected user managed metadata, got %+v", metadata)
+	}
+	if m["Manager"] != "netlink" {
+		t.Error("The metadata of the rule should not be modified")
+	}
+}
+
+func TestUserTopologyRecreated(t *testing.T) {
+	tm := newTestTopologyManager(t)
+	g := tm.graph
+
+	g.Lock()
+	edges := g.GetEdges(nil)
+	if len(edges) != 1 || !isUserManaged(edges[0].Metadata) {
+		t.Fatalf("Expected a user defined edge, got %+v", edges)
+	}
+
+	// the user defined edge is recreated as long as its rule exists
+	g.DelEdge(edges[0])
+	g.Unlock()
+	waitSync(t, tm)
+
+	g.RLock()
+	if edges := g.GetEdges(nil); len(edges) != 1 {
+		t.Errorf("Expected the user defined edge to be recreated, got %+v", edges)
+	}
+	g.RUnlock()
+
+	// so is the user defined node, along with its edge
+	g.Lock()
+	g.DelNode(g.LookupFirstNode(graph.Metadata{"Name": "switch"}))
+	g.Unlock()
+	waitSync(t, tm)
+
+	g.RLock()
+	if node := g.LookupFirstNode(graph.Metadata{"Name": "switch"}); node == nil || !isUserManaged(node.Metadata) {
+		t.Errorf("Expected the user defined node to be recreated, got %+v", node)
+	}
+	if edges := g.GetEdges(nil); len(edges) != 1 {
+		t.Errorf("Expected the user defined edge to be recreated, got %+v", edges)
+	}
+	g.RUnlock()
+}
+
+func TestUserEdgeOfDeletedNode(t *testing.T) {
+	tm := newTestTopologyManager(t)
+	g := tm.graph
+
+	// the edges of a node are deleted before the node itself, the user
+	// defined edge must not be recreated meanwhile
+	g.Lock()
+	g.DelNode(g.LookupFirstNode(graph.Metadata{"Name": "eth0"}))
+	g.Unlock()
+	waitSync(t, tm)
+
+	g.RLock()
+	defer g.RUnlock()
+
+	if edges := g.GetEdges(nil); len(edges) != 0 {
+		t.Errorf("Expected no edge to the deleted node, got %+v", edges)
+	}
+	if node := g.LookupFirstNode(graph.Metadata{"Name": "switch"}); node == nil {
+		t.Error("Expected the user defined node to be kept")
+	}
+}
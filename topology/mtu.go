@@ -0,0 +1,200 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topology
+
+import (
+	"net"
+	"sort"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+const (
+	// UnderlayMTUMismatch reports a tunnel whose encapsulated packets do
+	// not fit in the MTU of the underlay interface
+	UnderlayMTUMismatch = "Underlay"
+	// PathMTUMismatch reports a tunnel whose encapsulated packets do not
+	// fit in the path MTU reported by ICMP errors
+	PathMTUMismatch = "PathMTU"
+	// PortMTUMismatch reports an interface bridged with a tunnel that
+	// accepts frames the tunnel can not carry
+	PortMTUMismatch = "Port"
+	// PacketLengthMismatch reports packets captured on a tunnel that are
+	// too large to be carried once encapsulated
+	PacketLengthMismatch = "PacketLength"
+)
+
+// MTUMismatch describes an MTU, or a packet length, larger than the one the
+// path of an overlay tunnel carries
+type MTUMismatch struct {
+	Reason string
+	// name of the underlay interface or of the bridge port
+	Name   string `json:",omitempty"`
+	MTU    int64
+	MaxMTU int64
+}
+
+// encapsulation overhead of the tunnels, outer IP header excluded. The
+// inner Ethernet header of the layer 2 tunnels is part of the payload.
+var tunnelOverheads = map[string]int64{
+	"vxlan":     14 + 8 + 8,
+	"geneve":    14 + 8 + 8,
+	"gretap":    14 + 4,
+	"ip6gretap": 14 + 4,
+}
+
+// TunnelOverhead returns the number of bytes the encapsulation adds to the
+// packets sent through a tunnel interface
+func TunnelOverhead(node *graph.Node) (int64, bool) {
+	ty, _ := node.GetFieldString("Type")
+	overhead, ok := tunnelOverheads[ty]
+	if !ok {
+		return 0, false
+	}
+
+	ip := tunnelRemote(node)
+	if ty == "ip6gretap" || (ip != nil && ip.To4() == nil) {
+		return overhead + 40, true
+	}
+	return overhead + 20, true
+}
+
+func tunnelRemote(node *graph.Node) net.IP {
+	remote, _ := node.GetFieldString("Tunnel.Remote")
+	return net.ParseIP(remote)
+}
+
+// lookupRoute returns the interface of the namespace holding the longest
+// prefix route to the IP address
+func lookupRoute(interfaces []*graph.Node, ip net.IP) *graph.Node {
+	var best *graph.Node
+	bestLen := -1
+
+	for _, intf := range interfaces {
+		field, err := intf.GetField("RoutingTables")
+		if err != nil {
+			continue
+		}
+		rts, ok := field.(*RoutingTables)
+		if !ok {
+			continue
+		}
+
+		for _, rt := range *rts {
+			for _, route := range rt.Routes {
+				prefix := net.IPNet(route.Prefix)
+				if !prefix.Contains(ip) {
+					continue
+				}
+				if ones, _ := prefix.Mask.Size(); ones > bestLen {
+					best, bestLen = intf, ones
+				}
+			}
+		}
+	}
+
+	return best
+}
+
+// lookupUnderlay returns the interface the encapsulated packets of a
+// tunnel are sent through, either the one it is bound to, or the one
+// routing its remote endpoint
+func lookupUnderlay(interfaces []*graph.Node, node *graph.Node) *graph.Node {
+	if index, err := node.GetFieldInt64("Tunnel.UnderlayIfIndex"); err == nil {
+		for _, intf := range interfaces {
+			if i, _ := intf.GetFieldInt64("IfIndex"); i == index {
+				return intf
+			}
+		}
+		return nil
+	}
+
+	if ip := tunnelRemote(node); ip != nil && !ip.IsMulticast() {
+		return lookupRoute(interfaces, ip)
+	}
+	return nil
+}
+
+// GetMTUMismatches returns the MTU mismatches along the path of an overlay
+// tunnel. The underlay interface, the path MTU reported by ICMP errors and
+// the largest packet captured on the tunnel, stored as the PathMTU and
+// MaxPacketLength metadata, bound the MTU the tunnel can use.
+func GetMTUMismatches(g *graph.Graph, node *graph.Node) []*MTUMismatch {
+	overhead, ok := TunnelOverhead(node)
+	if !ok {
+		return nil
+	}
+
+	mtu, err := node.GetFieldInt64("MTU")
+	if err != nil {
+		return nil
+	}
+
+	var interfaces []*graph.Node
+	for _, parent := range g.LookupParents(node, nil, OwnershipMetadata()) {
+		for _, child := range g.LookupChildren(parent, nil, OwnershipMetadata()) {
+			if child.ID != node.ID {
+				interfaces = append(interfaces, child)
+			}
+		}
+	}
+
+	var mismatches []*MTUMismatch
+	maxMTU := mtu
+
+	if underlay := lookupUnderlay(interfaces, node); underlay != nil {
+		if underlayMTU, err := underlay.GetFieldInt64("MTU"); err == nil && mtu+overhead > underlayMTU {
+			name, _ := underlay.GetFieldString("Name")
+			mismatches = append(mismatches, &MTUMismatch{Reason: UnderlayMTUMismatch, Name: name, MTU: mtu, MaxMTU: underlayMTU - overhead})
+			maxMTU = underlayMTU - overhead
+		}
+	}
+
+	if pathMTU, err := node.GetFieldInt64("PathMTU"); err == nil && pathMTU > 0 && mtu+overhead > pathMTU {
+		mismatches = append(mismatches, &MTUMismatch{Reason: PathMTUMismatch, MTU: mtu, MaxMTU: pathMTU - overhead})
+		if pathMTU-overhead < maxMTU {
+			maxMTU = pathMTU - overhead
+		}
+	}
+
+	if length, err := node.GetFieldInt64("MaxPacketLength"); err == nil && length > maxMTU {
+		mismatches = append(mismatches, &MTUMismatch{Reason: PacketLengthMismatch, MTU: length, MaxMTU: maxMTU})
+	}
+
+	// the bridge forwards the frames to the tunnel whatever their size
+	if masterIndex, err := node.GetFieldInt64("MasterIndex"); err == nil {
+		for _, intf := range interfaces {
+			if index, _ := intf.GetFieldInt64("MasterIndex"); index != masterIndex {
+				continue
+			}
+			if portMTU, err := intf.GetFieldInt64("MTU"); err == nil && portMTU > maxMTU {
+				name, _ := intf.GetFieldString("Name")
+				mismatches = append(mismatches, &MTUMismatch{Reason: PortMTUMismatch, Name: name, MTU: portMTU, MaxMTU: maxMTU})
+			}
+		}
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool {
+		if mismatches[i].Reason != mismatches[j].Reason {
+			return mismatches[i].Reason < mismatches[j].Reason
+		}
+		return mismatches[i].Name < mismatches[j].Name
+	})
+
+	return mismatches
+}
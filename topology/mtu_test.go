@@ -0,0 +1,86 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topology
+
+import (
+	"net"
+	"testing"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+func TestMTUMismatches(t *testing.T) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.UnknownService)
+
+	_, underlay, _ := net.ParseCIDR("192.168.1.0/24")
+	routes := &RoutingTables{&RoutingTable{ID: 254, Routes: []*Route{
+		{Prefix: Prefix(IPv4DefaultRoute), NextHops: []*NextHop{{IP: net.ParseIP("10.0.0.1"), IfIndex: 3}}},
+		{Prefix: Prefix(*underlay), NextHops: []*NextHop{{IfIndex: 2}}},
+	}}}
+
+	host, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "host", "Type": "host"})
+	eth0, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth0", "Type": "device", "IfIndex": int64(2), "MTU": int64(1500), "RoutingTables": routes})
+	eth1, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth1", "Type": "device", "IfIndex": int64(3), "MTU": int64(9000)})
+	port, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "veth0", "Type": "veth", "IfIndex": int64(4), "MasterIndex": int64(5), "MTU": int64(1500)})
+	vxlan, _ := g.NewNode(graph.GenID(), graph.Metadata{
+		"Name": "vxlan0", "Type": "vxlan", "IfIndex": int64(6), "MasterIndex": int64(5), "MTU": int64(1500),
+		"Tunnel": map[string]interface{}{"VNI": int64(42), "Remote": "192.168.1.2"},
+	})
+	for _, n := range []*graph.Node{eth0, eth1, port, vxlan} {
+		AddOwnershipLink(g, host, n, nil)
+	}
+
+	// the VXLAN header does not fit in the 1500 bytes of the underlay
+	mismatches := GetMTUMismatches(g, vxlan)
+	if len(mismatches) != 2 ||
+		*mismatches[0] != (MTUMismatch{Reason: PortMTUMismatch, Name: "veth0", MTU: 1500, MaxMTU: 1450}) ||
+		*mismatches[1] != (MTUMismatch{Reason: UnderlayMTUMismatch, Name: "eth0", MTU: 1500, MaxMTU: 1450}) {
+		t.Fatalf("Should report the underlay and the bridge port, got: %+v", mismatches)
+	}
+
+	g.AddMetadata(vxlan, "MTU", int64(1450))
+	g.AddMetadata(port, "MTU", int64(1450))
+	if mismatches := GetMTUMismatches(g, vxlan); len(mismatches) != 0 {
+		t.Fatalf("Should not report any mismatch, got: %+v", mismatches)
+	}
+
+	// a router of the underlay network reported a smaller MTU, and packets
+	// larger than what the path carries were captured on the tunnel
+	g.AddMetadata(vxlan, "PathMTU", int64(1400))
+	g.AddMetadata(vxlan, "MaxPacketLength", int64(1450))
+
+	mismatches = GetMTUMismatches(g, vxlan)
+	if len(mismatches) != 3 ||
+		*mismatches[0] != (MTUMismatch{Reason: PacketLengthMismatch, MTU: 1450, MaxMTU: 1350}) ||
+		*mismatches[1] != (MTUMismatch{Reason: PathMTUMismatch, MTU: 1450, MaxMTU: 1350}) ||
+		*mismatches[2] != (MTUMismatch{Reason: PortMTUMismatch, Name: "veth0", MTU: 1450, MaxMTU: 1350}) {
+		t.Errorf("Should report the path MTU, the captured packets and the bridge port, got: %+v", mismatches)
+	}
+
+	// the tunnel bound to the jumbo frames interface
+	g.AddMetadata(vxlan, "Tunnel.UnderlayIfIndex", int64(3))
+	g.DelMetadata(vxlan, "PathMTU")
+	if mismatches := GetMTUMismatches(g, vxlan); len(mismatches) != 0 {
+		t.Errorf("Should not report any mismatch, got: %+v", mismatches)
+	}
+}
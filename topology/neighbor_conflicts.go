@@ -0,0 +1,185 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topology
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+const (
+	// DuplicateIPConflict reports an IP address held by interfaces having
+	// different MAC addresses
+	DuplicateIPConflict = "DuplicateIP"
+	// SpoofedNeighborConflict reports neighbor entries binding an IP address
+	// to a MAC address that does not hold it, or neighbor tables that
+	// disagree on the MAC address of an IP address
+	SpoofedNeighborConflict = "SpoofedNeighbor"
+)
+
+// NeighborClaim describes the binding of an IP address to a MAC address
+// claimed by a node, either as holder of the address or by a neighbor entry
+type NeighborClaim struct {
+	Node graph.Identifier
+	Host string `json:",omitempty"`
+	Name string `json:",omitempty"`
+	MAC  string
+	// Address or Neighbor
+	Source string
+}
+
+// NeighborConflict describes the conflicting claims about an IP address
+type NeighborConflict struct {
+	IP     string
+	Type   string
+	Claims []*NeighborClaim
+}
+
+// claims indexes the claims by IP then MAC address
+type claims map[string]map[string][]*NeighborClaim
+
+func (c claims) add(ip net.IP, claim *NeighborClaim) {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() || ip.IsLinkLocalUnicast() {
+		return
+	}
+
+	key := ip.String()
+	macs, ok := c[key]
+	if !ok {
+		macs = make(map[string][]*NeighborClaim)
+		c[key] = macs
+	}
+	macs[claim.MAC] = append(macs[claim.MAC], claim)
+}
+
+func (c claims) list(ip string, exclude map[string][]*NeighborClaim) (l []*NeighborClaim) {
+	for mac, macClaims := range c[ip] {
+		if _, found := exclude[mac]; !found {
+			l = append(l, macClaims...)
+		}
+	}
+	return
+}
+
+func newClaim(node *graph.Node, mac, source string) *NeighborClaim {
+	name, _ := node.GetFieldString("Name")
+	return &NeighborClaim{Node: node.ID, Host: node.Host, Name: name, MAC: strings.ToLower(mac), Source: source}
+}
+
+// usable returns whether the neighbor entry holds a resolved MAC address
+func usable(neighbor *Neighbor) bool {
+	if neighbor.IP == nil || neighbor.MAC == "" {
+		return false
+	}
+
+	for _, state := range neighbor.State {
+		switch state {
+		case "NUD_INCOMPLETE", "NUD_FAILED", "NUD_NOARP":
+			return false
+		}
+	}
+
+	// entries answered on behalf of others, not bindings seen by the node
+	for _, flag := range neighbor.Flags {
+		if flag == "NTF_PROXY" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetNeighborConflicts compares the IP addresses held by the given interfaces
+// with the entries of their neighbor tables and reports the IP addresses
+// claimed by several MAC addresses. Only the given nodes are compared, which
+// allows to limit the detection to a network segment.
+func GetNeighborConflicts(nodes []*graph.Node) []*NeighborConflict {
+	owners, neighbors := make(claims), make(claims)
+
+	for _, node := range nodes {
+		if state, _ := node.GetFieldString("State"); state == "DOWN" {
+			continue
+		}
+
+		if mac, _ := node.GetFieldString("MAC"); mac != "" {
+			for _, key := range []string{"IPV4", "IPV6"} {
+				addrs, _ := node.GetFieldStringList(key)
+				for _, addr := range addrs {
+					if ip, _, err := net.ParseCIDR(addr); err == nil {
+						owners.add(ip, newClaim(node, mac, "Address"))
+					} else if ip := net.ParseIP(addr); ip != nil {
+						owners.add(ip, newClaim(node, mac, "Address"))
+					}
+				}
+			}
+		}
+
+		if field, err := node.GetField("Neighbors"); err == nil {
+			if nbs, ok := field.(*Neighbors); ok {
+				for _, neighbor := range *nbs {
+					if usable(neighbor) {
+						neighbors.add(neighbor.IP, newClaim(node, neighbor.MAC, "Neighbor"))
+					}
+				}
+			}
+		}
+	}
+
+	var conflicts []*NeighborConflict
+	for ip, macs := range owners {
+		if len(macs) > 1 {
+			conflicts = append(conflicts, &NeighborConflict{IP: ip, Type: DuplicateIPConflict, Claims: owners.list(ip, nil)})
+		}
+	}
+
+	for ip, macs := range neighbors {
+		if holders, found := owners[ip]; found {
+			if spoofed := neighbors.list(ip, holders); len(spoofed) > 0 {
+				involved := append(owners.list(ip, nil), spoofed...)
+				conflicts = append(conflicts, &NeighborConflict{IP: ip, Type: SpoofedNeighborConflict, Claims: involved})
+			}
+		} else if len(macs) > 1 {
+			conflicts = append(conflicts, &NeighborConflict{IP: ip, Type: SpoofedNeighborConflict, Claims: neighbors.list(ip, nil)})
+		}
+	}
+
+	// sort to return the same result as long as the topology does not change
+	for _, conflict := range conflicts {
+		sort.Slice(conflict.Claims, func(i, j int) bool {
+			a, b := conflict.Claims[i], conflict.Claims[j]
+			if a.Source != b.Source {
+				return a.Source < b.Source
+			}
+			if a.MAC != b.MAC {
+				return a.MAC < b.MAC
+			}
+			return a.Node < b.Node
+		})
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].IP != conflicts[j].IP {
+			return conflicts[i].IP < conflicts[j].IP
+		}
+		return conflicts[i].Type < conflicts[j].Type
+	})
+
+	return conflicts
+}
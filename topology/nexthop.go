@@ -35,6 +35,7 @@ type NextHop struct {
 	IP       net.IP `json:"IP,omitempty"`
 	MAC      string `json:"MAC,omitempty"`
 	IfIndex  int64  `json:"IfIndex"`
+	Weight   int64  `json:"Weight,omitempty"`
 }
 
 // GetNextHop returns the next hop to reach a specified IP
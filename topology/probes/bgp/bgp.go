@@ -0,0 +1,263 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package bgp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/probe"
+	"github.com/skydive-project/skydive/topology"
+	tp "github.com/skydive-project/skydive/topology/probes"
+)
+
+// Managers of the BGP session nodes, one per routing daemon
+const (
+	BirdManager  = "bird"
+	GobgpManager = "gobgp"
+)
+
+const (
+	retryDelay    = time.Second
+	maxRetryDelay = time.Minute
+)
+
+// daemon retrieves the BGP sessions of a routing daemon
+type daemon interface {
+	sessions() (map[string]*Metadata, error)
+	close()
+}
+
+// Probe describes a probe that reports the BGP sessions of the BIRD or GoBGP
+// routing daemons, and a summary of the routes learnt through them
+type Probe struct {
+	Ctx          tp.Context
+	daemon       string
+	socket       string
+	gobgpHost    string
+	gobgpPort    int
+	pollInterval time.Duration
+	sessions     map[string]*graph.Node
+}
+
+func (p *Probe) sessionMetadata(session *Metadata) graph.Metadata {
+	return graph.Metadata{
+		"Type":    "bgpsession",
+		"Name":    session.Protocol,
+		"Manager": session.Daemon,
+		"BGP":     session,
+	}
+}
+
+// neighborInterface returns the interface of the host which is on the same
+// subnet as the BGP neighbor
+func (p *Probe) neighborInterface(address string) *graph.Node {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil
+	}
+
+	for _, intf := range p.Ctx.Graph.LookupChildren(p.Ctx.RootNode, nil, topology.OwnershipMetadata()) {
+		for _, field := range []string{"IPV4", "IPV6"} {
+			addrs, _ := intf.GetFieldStringList(field)
+			for _, addr := range addrs {
+				if _, ipnet, err := net.ParseCIDR(addr); err == nil && ipnet.Contains(ip) {
+					return intf
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *Probe) updateSession(session *Metadata) {
+	id := graph.GenID(string(p.Ctx.RootNode.ID), "bgp", session.Protocol)
+
+	node, found := p.sessions[session.Protocol]
+	if !found {
+		var err error
+		if node, err = p.Ctx.Graph.NewNode(id, p.sessionMetadata(session)); err != nil {
+			p.Ctx.Logger.Error(err)
+			return
+		}
+		topology.AddOwnershipLink(p.Ctx.Graph, p.Ctx.RootNode, node, nil)
+		p.sessions[session.Protocol] = node
+	} else {
+		tr := p.Ctx.Graph.StartMetadataTransaction(node)
+		for k, v := range p.sessionMetadata(session) {
+			tr.AddMetadata(k, v)
+		}
+		tr.Commit()
+	}
+
+	if intf := p.neighborInterface(session.NeighborAddress); intf != nil && !p.Ctx.Graph.AreLinked(node, intf, nil) {
+		if _, err := p.Ctx.Graph.NewEdge(graph.GenID(string(id), string(intf.ID)), node, intf, graph.Metadata{"RelationType": "bgp"}); err != nil {
+			p.Ctx.Logger.Error(err)
+		}
+	}
+}
+
+// connect returns a client of the configured daemon. With the auto mode,
+// BIRD is used when its control socket exists, GoBGP otherwise.
+func (p *Probe) connect() (daemon, error) {
+	switch p.daemon {
+	case BirdManager:
+		return newBirdClient(p.socket)
+	case GobgpManager:
+		return newGobgpClient(p.gobgpHost, p.gobgpPort)
+	}
+
+	if _, err := os.Stat(p.socket); err == nil {
+		return newBirdClient(p.socket)
+	}
+	return newGobgpClient(p.gobgpHost, p.gobgpPort)
+}
+
+func (p *Probe) update(client daemon) error {
+	sessions, err := client.sessions()
+	if err != nil {
+		return err
+	}
+
+	p.Ctx.Graph.Lock()
+	defer p.Ctx.Graph.Unlock()
+
+	for _, session := range sessions {
+		p.updateSession(session)
+	}
+
+	for name, node := range p.sessions {
+		if _, found := sessions[name]; !found {
+			if err := p.Ctx.Graph.DelNode(node); err != nil {
+				p.Ctx.Logger.Error(err)
+			}
+			delete(p.sessions, name)
+		}
+	}
+
+	return nil
+}
+
+// removeSessions removes the session nodes of the host, the ones left by a
+// previous run of the probe included
+func (p *Probe) removeSessions() {
+	p.Ctx.Graph.Lock()
+	defer p.Ctx.Graph.Unlock()
+
+	for _, node := range p.Ctx.Graph.LookupChildren(p.Ctx.RootNode, graph.Metadata{"Type": "bgpsession"}, topology.OwnershipMetadata()) {
+		if err := p.Ctx.Graph.DelNode(node); err != nil {
+			p.Ctx.Logger.Error(err)
+		}
+	}
+
+	p.sessions = make(map[string]*graph.Node)
+}
+
+// poll retrieves the sessions, connecting to the daemon if needed. The
+// client is closed on failure so that the next poll reconnects.
+func (p *Probe) poll(client daemon) (daemon, error) {
+	if client == nil {
+		var err error
+		if client, err = p.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.update(client); err != nil {
+		client.close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Do polls the BGP sessions of the routing daemon. On failure, the session
+// nodes are removed as they can't be trusted anymore and the daemon is
+// polled again with an exponential backoff.
+func (p *Probe) Do(ctx context.Context, wg *sync.WaitGroup) error {
+	p.removeSessions()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		var client daemon
+		var err error
+		delay := retryDelay
+
+		for {
+			wait := p.pollInterval
+			if client, err = p.poll(client); err != nil {
+				p.Ctx.Logger.Errorf("Failed to retrieve BGP sessions, retrying in %s: %s", delay, err)
+				p.removeSessions()
+
+				wait = delay
+				if delay *= 2; delay > maxRetryDelay {
+					delay = maxRetryDelay
+				}
+			} else {
+				delay = retryDelay
+			}
+
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				if client != nil {
+					client.close()
+				}
+				p.removeSessions()
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// NewProbe returns a new BGP topology probe
+func NewProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
+	daemon := ctx.Config.GetString("agent.topology.bgp.daemon")
+	switch daemon {
+	case "auto", BirdManager, GobgpManager:
+	default:
+		return nil, fmt.Errorf("unsupported BGP daemon %s", daemon)
+	}
+
+	p := &Probe{
+		Ctx:          ctx,
+		daemon:       daemon,
+		socket:       ctx.Config.GetString("agent.topology.bgp.bird_socket"),
+		gobgpHost:    ctx.Config.GetString("agent.topology.bgp.gobgp_host"),
+		gobgpPort:    ctx.Config.GetInt("agent.topology.bgp.gobgp_port"),
+		pollInterval: time.Duration(ctx.Config.GetInt("agent.topology.bgp.poll_interval")) * time.Second,
+		sessions:     make(map[string]*graph.Node),
+	}
+
+	return tp.NewProbeWrapper(p), nil
+}
+
+// Register registers graph metadata decoders
+func Register() {
+	graph.NodeMetadataDecoders["BGP"] = MetadataDecoder
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package bgp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const birdTimeout = 10 * time.Second
+
+// birdLine is a line of a reply of the BIRD control socket
+type birdLine struct {
+	code int
+	text string
+}
+
+// birdClient talks to the BIRD routing daemon through its control socket
+type birdClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// command sends a command and returns the lines of its reply. Each line is
+// prefixed by a 4 digits code followed by '-' when more lines follow or by
+// a space for the last one. Lines starting with a space continue the
+// previous code.
+func (c *birdClient) command(cmd string) ([]birdLine, error) {
+	c.conn.SetDeadline(time.Now().Add(birdTimeout))
+
+	if cmd != "" {
+		if _, err := fmt.Fprintf(c.conn, "%s\n", cmd); err != nil {
+			return nil, err
+		}
+	}
+
+	var lines []birdLine
+	code := 0
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\n")
+
+		if strings.HasPrefix(line, " ") {
+			lines = append(lines, birdLine{code: code, text: line[1:]})
+			continue
+		}
+
+		if len(line) < 5 {
+			return nil, fmt.Errorf("Malformed BIRD reply: '%s'", line)
+		}
+
+		if code, err = strconv.Atoi(line[:4]); err != nil {
+			return nil, fmt.Errorf("Malformed BIRD reply: '%s'", line)
+		}
+
+		if code >= 8000 {
+			return nil, fmt.Errorf("BIRD error: %s", line[5:])
+		}
+
+		if code != 0 {
+			lines = append(lines, birdLine{code: code, text: line[5:]})
+		}
+
+		if line[4] == ' ' {
+			return lines, nil
+		}
+	}
+}
+
+// sessions returns the BGP sessions of the daemon, indexed by protocol name.
+// The routes are summarized per address family, from the channels of BIRD 2
+// or from the neighbor address with BIRD 1.
+func (c *birdClient) sessions() (map[string]*Metadata, error) {
+	lines, err := c.command("show protocols all")
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make(map[string]*Metadata)
+
+	var current *Metadata
+	var channel string
+	var unassigned int64
+
+	// routes imported outside of a channel belong to the family of the neighbor
+	assign := func() {
+		if current != nil && unassigned != 0 {
+			if ip := net.ParseIP(current.NeighborAddress); ip != nil && ip.To4() == nil {
+				current.IPv6Prefixes += unassigned
+			} else {
+				current.IPv4Prefixes += unassigned
+			}
+		}
+		unassigned = 0
+	}
+
+	for _, line := range lines {
+		switch line.code {
+		case 1002:
+			// name, protocol, table, state, since and info columns
+			assign()
+			current, channel = nil, ""
+
+			fields := strings.Fields(line.text)
+			if len(fields) < 5 || fields[1] != "BGP" {
+				continue
+			}
+
+			current = &Metadata{
+				Daemon:   BirdManager,
+				Protocol: fields[0],
+				State:    fields[3],
+				Since:    fields[4],
+			}
+			if fields[2] != "---" {
+				current.addTable(fields[2])
+			}
+			if len(fields) > 5 {
+				current.State = strings.Join(fields[5:], " ")
+			}
+			sessions[current.Protocol] = current
+		case 1006:
+			if current == nil {
+				continue
+			}
+
+			if fields := strings.Fields(line.text); len(fields) == 2 && fields[0] == "Channel" {
+				channel = fields[1]
+				continue
+			}
+
+			kv := strings.SplitN(line.text, ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			value := strings.TrimSpace(kv[1])
+
+			switch strings.TrimSpace(kv[0]) {
+			case "BGP state":
+				current.State = value
+			case "Neighbor address":
+				current.NeighborAddress = strings.Fields(value + " ")[0]
+			case "Neighbor AS":
+				current.NeighborAS, _ = strconv.ParseInt(value, 10, 64)
+			case "Local AS":
+				current.LocalAS, _ = strconv.ParseInt(value, 10, 64)
+			case "Table":
+				current.addTable(value)
+			case "Routes":
+				// 10 imported, 5 exported, 10 preferred
+				for _, stat := range strings.Split(value, ",") {
+					var count int64
+					var kind string
+					if _, err := fmt.Sscanf(strings.TrimSpace(stat), "%d %s", &count, &kind); err != nil {
+						continue
+					}
+
+					switch kind {
+					case "imported":
+						current.RoutesImported += count
+						switch {
+						case strings.HasPrefix(channel, "ipv4"):
+							current.IPv4Prefixes += count
+						case strings.HasPrefix(channel, "ipv6"):
+							current.IPv6Prefixes += count
+						case channel == "":
+							unassigned += count
+						}
+					case "exported":
+						current.RoutesExported += count
+					}
+				}
+			}
+		}
+	}
+	assign()
+
+	return sessions, nil
+}
+
+func (c *birdClient) close() {
+	c.conn.Close()
+}
+
+func newBirdClient(socket string) (*birdClient, error) {
+	conn, err := net.DialTimeout("unix", socket, birdTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &birdClient{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+
+	// consume the welcome message
+	if _, err := c.command(""); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package bgp
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"testing"
+)
+
+const showProtocols = `2002-Name       Proto      Table      State  Since         Info
+1002-device1    Device     ---        up     2019-06-11    
+1002-peer1      BGP        ---        up     2019-06-11    Established   
+1006-  BGP state:          Established
+       Neighbor address: 10.0.0.2
+       Neighbor AS:      65001
+       Local AS:         65000
+     Channel ipv4
+       State:          UP
+       Table:          master4
+       Routes:         2 imported, 5 exported, 2 preferred
+     Channel ipv6
+       State:          UP
+       Table:          master6
+       Routes:         3 imported, 1 exported, 3 preferred
+ 
+0000 
+`
+
+// BIRD 1 reports the routes before the neighbor, without channel
+const showProtocolsBird1 = `2002-name     proto    table    state  since       info
+1002-peer6    BGP      master   up     2019-06-11  Established   
+1006-  Preference:     100
+       Input filter:   ACCEPT
+       Output filter:  ACCEPT
+       Routes:         4 imported, 1 exported, 4 preferred
+       BGP state:          Established
+         Neighbor address: 2001:db8::2
+         Neighbor AS:      65001
+ 
+0000 
+`
+
+func newTestClient(replies ...string) *birdClient {
+	client, server := net.Pipe()
+
+	go func() {
+		reader := bufio.NewReader(server)
+		for _, reply := range replies {
+			if _, err := reader.ReadString('\n'); err != nil {
+				return
+			}
+			server.Write([]byte(reply))
+		}
+		server.Close()
+	}()
+
+	return &birdClient{conn: client, reader: bufio.NewReader(client)}
+}
+
+func TestBirdSessions(t *testing.T) {
+	c := newTestClient(showProtocols)
+	defer c.close()
+
+	sessions, err := c.sessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]*Metadata{
+		"peer1": {
+			Daemon:          BirdManager,
+			Protocol:        "peer1",
+			State:           "Established",
+			Since:           "2019-06-11",
+			LocalAS:         65000,
+			NeighborAS:      65001,
+			NeighborAddress: "10.0.0.2",
+			Tables:          []string{"master4", "master6"},
+			RoutesImported:  5,
+			RoutesExported:  6,
+			IPv4Prefixes:    2,
+			IPv6Prefixes:    3,
+		},
+	}
+
+	if !reflect.DeepEqual(sessions, expected) {
+		t.Errorf("Expected sessions %+v, got %+v", expected["peer1"], sessions["peer1"])
+	}
+}
+
+func TestBird1Sessions(t *testing.T) {
+	c := newTestClient(showProtocolsBird1)
+	defer c.close()
+
+	sessions, err := c.sessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]*Metadata{
+		"peer6": {
+			Daemon:          BirdManager,
+			Protocol:        "peer6",
+			State:           "Established",
+			Since:           "2019-06-11",
+			NeighborAS:      65001,
+			NeighborAddress: "2001:db8::2",
+			Tables:          []string{"master"},
+			RoutesImported:  4,
+			RoutesExported:  1,
+			IPv6Prefixes:    4,
+		},
+	}
+
+	if !reflect.DeepEqual(sessions, expected) {
+		t.Errorf("Expected sessions %+v, got %+v", expected["peer6"], sessions["peer6"])
+	}
+}
+
+func TestBirdError(t *testing.T) {
+	c := newTestClient("9001 Unknown command\n")
+	defer c.close()
+
+	if _, err := c.sessions(); err == nil {
+		t.Error("Expected an error for an error reply")
+	}
+}
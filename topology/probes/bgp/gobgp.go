@@ -0,0 +1,170 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package bgp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// session states of the GoBGP API
+var gobgpStates = map[int]string{
+	1: "Idle",
+	2: "Connect",
+	3: "Active",
+	4: "OpenSent",
+	5: "OpenConfirm",
+	6: "Established",
+}
+
+// address family identifiers, the safi 1 being unicast and 2 multicast
+const (
+	afiIPv4 = 1
+	afiIPv6 = 2
+)
+
+type gobgpFamily struct {
+	Afi  int `json:"afi"`
+	Safi int `json:"safi"`
+}
+
+// table returns the name GoBGP gives to the RIB of a family
+func (f gobgpFamily) table() string {
+	var afi, safi string
+	switch f.Afi {
+	case afiIPv4:
+		afi = "ipv4"
+	case afiIPv6:
+		afi = "ipv6"
+	default:
+		return fmt.Sprintf("afi%d-safi%d", f.Afi, f.Safi)
+	}
+
+	switch f.Safi {
+	case 1:
+		safi = "unicast"
+	case 2:
+		safi = "multicast"
+	default:
+		return fmt.Sprintf("%s-safi%d", afi, f.Safi)
+	}
+
+	return afi + "-" + safi
+}
+
+// gobgpPeer is the subset of a peer reported by 'gobgp neighbor -j'
+type gobgpPeer struct {
+	Conf struct {
+		NeighborAddress string `json:"neighbor_address"`
+		LocalAs         int64  `json:"local_as"`
+		PeerAs          int64  `json:"peer_as"`
+	} `json:"conf"`
+	State struct {
+		SessionState int `json:"session_state"`
+	} `json:"state"`
+	Timers struct {
+		State struct {
+			Uptime struct {
+				Seconds int64 `json:"seconds"`
+			} `json:"uptime"`
+		} `json:"state"`
+	} `json:"timers"`
+	AfiSafis []struct {
+		State struct {
+			Family     gobgpFamily `json:"family"`
+			Accepted   int64       `json:"accepted"`
+			Advertised int64       `json:"advertised"`
+		} `json:"state"`
+	} `json:"afi_safis"`
+}
+
+// gobgpClient retrieves the BGP sessions of the GoBGP daemon through its
+// command line client
+type gobgpClient struct {
+	host string
+	port int
+}
+
+// parseGobgpNeighbors returns the sessions described by the output of
+// 'gobgp neighbor -j', indexed by neighbor address
+func parseGobgpNeighbors(data []byte) (map[string]*Metadata, error) {
+	var peers []gobgpPeer
+	if err := json.Unmarshal(data, &peers); err != nil {
+		return nil, fmt.Errorf("Malformed GoBGP reply: %s", err)
+	}
+
+	sessions := make(map[string]*Metadata)
+	for _, peer := range peers {
+		session := &Metadata{
+			Daemon:          GobgpManager,
+			Protocol:        peer.Conf.NeighborAddress,
+			State:           gobgpStates[peer.State.SessionState],
+			LocalAS:         peer.Conf.LocalAs,
+			NeighborAS:      peer.Conf.PeerAs,
+			NeighborAddress: peer.Conf.NeighborAddress,
+		}
+
+		if session.State == "" {
+			session.State = "Unknown"
+		}
+
+		if uptime := peer.Timers.State.Uptime.Seconds; uptime != 0 {
+			session.Since = time.Unix(uptime, 0).UTC().Format(time.RFC3339)
+		}
+
+		for _, afiSafi := range peer.AfiSafis {
+			family := afiSafi.State.Family
+			session.addTable(family.table())
+			session.RoutesImported += afiSafi.State.Accepted
+			session.RoutesExported += afiSafi.State.Advertised
+
+			switch family.Afi {
+			case afiIPv4:
+				session.IPv4Prefixes += afiSafi.State.Accepted
+			case afiIPv6:
+				session.IPv6Prefixes += afiSafi.State.Accepted
+			}
+		}
+
+		sessions[session.Protocol] = session
+	}
+
+	return sessions, nil
+}
+
+// sessions returns the BGP sessions of the daemon, indexed by neighbor address
+func (c *gobgpClient) sessions() (map[string]*Metadata, error) {
+	out, err := exec.Command("gobgp", "-u", c.host, "-p", strconv.Itoa(c.port), "-j", "neighbor").Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the GoBGP neighbors: %s", err)
+	}
+	return parseGobgpNeighbors(out)
+}
+
+func (c *gobgpClient) close() {
+}
+
+func newGobgpClient(host string, port int) (*gobgpClient, error) {
+	if _, err := exec.LookPath("gobgp"); err != nil {
+		return nil, err
+	}
+	return &gobgpClient{host: host, port: port}, nil
+}
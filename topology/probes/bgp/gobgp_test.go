@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package bgp
+
+import (
+	"reflect"
+	"testing"
+)
+
+const gobgpNeighbors = `[
+  {
+    "conf": {"local_as": 65000, "neighbor_address": "10.0.0.2", "peer_as": 65001},
+    "state": {"neighbor_address": "10.0.0.2", "peer_as": 65001, "session_state": 6},
+    "timers": {"state": {"uptime": {"seconds": 1560211200}}},
+    "afi_safis": [
+      {"state": {"family": {"afi": 1, "safi": 1}, "enabled": true, "received": 3, "accepted": 2, "advertised": 5}},
+      {"state": {"family": {"afi": 2, "safi": 1}, "enabled": true, "received": 1, "accepted": 1}}
+    ]
+  },
+  {
+    "conf": {"local_as": 65000, "neighbor_address": "10.0.1.2", "peer_as": 65002},
+    "state": {"neighbor_address": "10.0.1.2", "peer_as": 65002, "session_state": 3},
+    "timers": {"state": {}},
+    "afi_safis": [
+      {"state": {"family": {"afi": 1, "safi": 2}}}
+    ]
+  }
+]`
+
+func TestGobgpNeighbors(t *testing.T) {
+	sessions, err := parseGobgpNeighbors([]byte(gobgpNeighbors))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]*Metadata{
+		"10.0.0.2": {
+			Daemon:          GobgpManager,
+			Protocol:        "10.0.0.2",
+			State:           "Established",
+			Since:           "2019-06-11T00:00:00Z",
+			LocalAS:         65000,
+			NeighborAS:      65001,
+			NeighborAddress: "10.0.0.2",
+			Tables:          []string{"ipv4-unicast", "ipv6-unicast"},
+			RoutesImported:  3,
+			RoutesExported:  5,
+			IPv4Prefixes:    2,
+			IPv6Prefixes:    1,
+		},
+		"10.0.1.2": {
+			Daemon:          GobgpManager,
+			Protocol:        "10.0.1.2",
+			State:           "Active",
+			LocalAS:         65000,
+			NeighborAS:      65002,
+			NeighborAddress: "10.0.1.2",
+			Tables:          []string{"ipv4-multicast"},
+		},
+	}
+
+	for name, session := range expected {
+		if !reflect.DeepEqual(sessions[name], session) {
+			t.Errorf("Expected session %+v, got %+v", session, sessions[name])
+		}
+	}
+
+	if len(sessions) != len(expected) {
+		t.Errorf("Expected %d sessions, got %d", len(expected), len(sessions))
+	}
+
+	if _, err := parseGobgpNeighbors([]byte("rpc error")); err == nil {
+		t.Error("Expected an error for a malformed reply")
+	}
+}
@@ -0,0 +1,67 @@
+//go:generate go run github.com/skydive-project/skydive/scripts/gendecoder -package github.com/skydive-project/skydive/topology/probes/bgp
+//go:generate go run github.com/mailru/easyjson/easyjson $GOFILE
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package bgp
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+// Metadata describes a BGP session of the routing daemon. The routes learnt
+// are summarized by the number of prefixes per address family.
+// easyjson:json
+// gendecoder
+type Metadata struct {
+	Daemon          string   `json:",omitempty"`
+	Protocol        string   `json:",omitempty"`
+	State           string   `json:",omitempty"`
+	Since           string   `json:",omitempty"`
+	LocalAS         int64    `json:",omitempty"`
+	NeighborAS      int64    `json:",omitempty"`
+	NeighborAddress string   `json:",omitempty"`
+	Tables          []string `json:",omitempty"`
+	RoutesImported  int64    `json:",omitempty"`
+	RoutesExported  int64    `json:",omitempty"`
+	IPv4Prefixes    int64    `json:",omitempty"`
+	IPv6Prefixes    int64    `json:",omitempty"`
+}
+
+// addTable adds a routing table the routes of the session are imported to
+func (m *Metadata) addTable(table string) {
+	for _, t := range m.Tables {
+		if t == table {
+			return
+		}
+	}
+	m.Tables = append(m.Tables, table)
+}
+
+// MetadataDecoder implements a json message raw decoder
+func MetadataDecoder(raw json.RawMessage) (common.Getter, error) {
+	var m Metadata
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal BGP metadata %s: %s", string(raw), err)
+	}
+
+	return &m, nil
+}
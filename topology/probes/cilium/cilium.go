@@ -0,0 +1,255 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/probe"
+	"github.com/skydive-project/skydive/topology"
+	tp "github.com/skydive-project/skydive/topology/probes"
+)
+
+// Manager of the Cilium nodes
+const Manager = "cilium"
+
+// endpoint is the subset of the Cilium endpoint model used by the probe
+type endpoint struct {
+	ID     int64 `json:"id"`
+	Status struct {
+		State    string `json:"state"`
+		Identity struct {
+			ID     int64    `json:"id"`
+			Labels []string `json:"labels"`
+		} `json:"identity"`
+		Networking struct {
+			InterfaceName string `json:"interface-name"`
+		} `json:"networking"`
+		ExternalIdentifiers struct {
+			K8sNamespace string `json:"k8s-namespace"`
+			K8sPodName   string `json:"k8s-pod-name"`
+		} `json:"external-identifiers"`
+		Policy struct {
+			Realized struct {
+				PolicyEnabled  string `json:"policy-enabled"`
+				PolicyRevision int64  `json:"policy-revision"`
+			} `json:"realized"`
+		} `json:"policy"`
+	} `json:"status"`
+}
+
+// Probe describes a probe that reports the endpoints of the Cilium agent on
+// their interfaces, along with their security identity and policy state
+type Probe struct {
+	Ctx          tp.Context
+	client       *http.Client
+	pollInterval time.Duration
+	interfaces   map[int64]*graph.Node
+	identities   map[int64]*graph.Node
+}
+
+func (p *Probe) getEndpoints() ([]*endpoint, error) {
+	resp, err := p.client.Get("http://cilium/v1/endpoint")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to retrieve Cilium endpoints: %s", resp.Status)
+	}
+
+	var endpoints []*endpoint
+	if err := json.NewDecoder(resp.Body).Decode(&endpoints); err != nil {
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+func endpointMetadata(ep *endpoint) *Metadata {
+	policy := ep.Status.Policy.Realized.PolicyEnabled
+	return &Metadata{
+		EndpointID:     ep.ID,
+		Identity:       ep.Status.Identity.ID,
+		Labels:         ep.Status.Identity.Labels,
+		State:          ep.Status.State,
+		PolicyIngress:  policy == "ingress" || policy == "both",
+		PolicyEgress:   policy == "egress" || policy == "both",
+		PolicyRevision: ep.Status.Policy.Realized.PolicyRevision,
+		PodName:        ep.Status.ExternalIdentifiers.K8sPodName,
+		PodNamespace:   ep.Status.ExternalIdentifiers.K8sNamespace,
+	}
+}
+
+// getIdentity returns the node of a security identity, shared by the
+// endpoints of the host
+func (p *Probe) getIdentity(ep *endpoint) *graph.Node {
+	id := ep.Status.Identity.ID
+
+	m := graph.Metadata{
+		"Type":    "ciliumidentity",
+		"Name":    "identity-" + strconv.FormatInt(id, 10),
+		"Manager": Manager,
+		"Cilium": &Metadata{
+			Identity: id,
+			Labels:   ep.Status.Identity.Labels,
+		},
+	}
+
+	if node, found := p.identities[id]; found {
+		if err := p.Ctx.Graph.SetMetadata(node, m); err != nil {
+			p.Ctx.Logger.Error(err)
+		}
+		return node
+	}
+
+	node, err := p.Ctx.Graph.NewNode(graph.GenID(string(p.Ctx.RootNode.ID), "cilium", "identity", strconv.FormatInt(id, 10)), m)
+	if err != nil {
+		p.Ctx.Logger.Error(err)
+		return nil
+	}
+	topology.AddOwnershipLink(p.Ctx.Graph, p.Ctx.RootNode, node, nil)
+	p.identities[id] = node
+
+	return node
+}
+
+func (p *Probe) update() error {
+	endpoints, err := p.getEndpoints()
+	if err != nil {
+		return err
+	}
+
+	p.Ctx.Graph.Lock()
+	defer p.Ctx.Graph.Unlock()
+
+	interfaces := make(map[int64]*graph.Node)
+	identities := make(map[int64]bool)
+
+	for _, ep := range endpoints {
+		ifName := ep.Status.Networking.InterfaceName
+		if ifName == "" {
+			continue
+		}
+
+		intf := p.Ctx.Graph.LookupFirstChild(p.Ctx.RootNode, graph.Metadata{"Name": ifName})
+		if intf == nil {
+			continue
+		}
+
+		if err := p.Ctx.Graph.AddMetadata(intf, "Cilium", endpointMetadata(ep)); err != nil {
+			p.Ctx.Logger.Error(err)
+			continue
+		}
+		interfaces[ep.ID] = intf
+
+		if ep.Status.Identity.ID == 0 {
+			continue
+		}
+
+		if identity := p.getIdentity(ep); identity != nil {
+			identities[ep.Status.Identity.ID] = true
+			if !topology.HaveLink(p.Ctx.Graph, identity, intf, "identity") {
+				topology.AddLink(p.Ctx.Graph, identity, intf, "identity", nil)
+			}
+		}
+	}
+
+	for id, intf := range p.interfaces {
+		if interfaces[id] == nil && p.Ctx.Graph.GetNode(intf.ID) != nil {
+			p.Ctx.Graph.DelMetadata(intf, "Cilium")
+		}
+	}
+	p.interfaces = interfaces
+
+	for id, node := range p.identities {
+		if !identities[id] {
+			if err := p.Ctx.Graph.DelNode(node); err != nil {
+				p.Ctx.Logger.Error(err)
+			}
+			delete(p.identities, id)
+		}
+	}
+
+	return nil
+}
+
+// Do polls the endpoints of the Cilium agent
+func (p *Probe) Do(ctx context.Context, wg *sync.WaitGroup) error {
+	if err := p.update(); err != nil {
+		return err
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(p.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.update(); err != nil {
+					p.Ctx.Logger.Errorf("Failed to retrieve the Cilium endpoints: %s", err)
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// NewProbe returns a new Cilium topology probe
+func NewProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
+	socket := ctx.Config.GetString("agent.topology.cilium.socket")
+
+	p := &Probe{
+		Ctx: ctx,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+		pollInterval: time.Duration(ctx.Config.GetInt("agent.topology.cilium.poll_interval")) * time.Second,
+		interfaces:   make(map[int64]*graph.Node),
+		identities:   make(map[int64]*graph.Node),
+	}
+
+	return tp.NewProbeWrapper(p), nil
+}
+
+// Register registers graph metadata decoders
+func Register() {
+	graph.NodeMetadataDecoders["Cilium"] = MetadataDecoder
+}
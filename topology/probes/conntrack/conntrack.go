@@ -0,0 +1,156 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package conntrack
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/probe"
+	tp "github.com/skydive-project/skydive/topology/probes"
+)
+
+var protocols = map[uint8]string{
+	6:   "TCP",
+	17:  "UDP",
+	132: "SCTP",
+}
+
+type poller struct {
+	*Probe
+	ctx          tp.Context
+	pollInterval time.Duration
+}
+
+// listNAT returns the translated entries of the conntrack table of a namespace
+func listNAT(path string) (natTable, error) {
+	if path != "" {
+		ctx, err := common.NewNetNsContext(path)
+		defer ctx.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	table := make(natTable)
+	for _, family := range []netlink.InetFamily{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		entries, err := netlink.ConntrackTableList(netlink.ConntrackTable, family)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			protocol, found := protocols[entry.Forward.Protocol]
+			if !found {
+				continue
+			}
+
+			// the reply tuple holds the translated addresses and ports, swapped
+			nat := newNAT(protocol,
+				entry.Forward.SrcIP.String(), entry.Forward.DstIP.String(), int64(entry.Forward.SrcPort), int64(entry.Forward.DstPort),
+				entry.Reverse.DstIP.String(), entry.Reverse.SrcIP.String(), int64(entry.Reverse.DstPort), int64(entry.Reverse.SrcPort))
+
+			if nat.SNAT || nat.DNAT {
+				table.add(protocol, nat)
+			}
+		}
+	}
+
+	return table, nil
+}
+
+func (p *poller) getNamespaces() map[graph.Identifier]string {
+	p.graph.RLock()
+	defer p.graph.RUnlock()
+
+	namespaces := map[graph.Identifier]string{p.rootNode.ID: ""}
+	for _, node := range p.graph.GetNodes(graph.Metadata{"Type": "netns"}) {
+		if path, _ := node.GetFieldString("Path"); path != "" {
+			namespaces[node.ID] = path
+		}
+	}
+
+	return namespaces
+}
+
+func (p *poller) update() {
+	tables := make(map[graph.Identifier]natTable)
+	for id, path := range p.getNamespaces() {
+		table, err := listNAT(path)
+		if err != nil {
+			p.ctx.Logger.Debugf("Failed to retrieve the conntrack table of %s: %s", id, err)
+			continue
+		}
+		tables[id] = table
+	}
+
+	p.Lock()
+	p.tables = tables
+	p.Unlock()
+}
+
+// Do polls the conntrack tables of the network namespaces
+func (p *poller) Do(ctx context.Context, wg *sync.WaitGroup) error {
+	if _, err := netlink.ConntrackTableList(netlink.ConntrackTable, netlink.FAMILY_V4); err != nil {
+		return err
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(p.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			p.update()
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// NewProbe returns a new conntrack probe
+func NewProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
+	p := &Probe{
+		graph:    ctx.Graph,
+		rootNode: ctx.RootNode,
+		tables:   make(map[graph.Identifier]natTable),
+	}
+
+	p.ProbeWrapper = tp.NewProbeWrapper(&poller{
+		Probe:        p,
+		ctx:          ctx,
+		pollInterval: time.Duration(ctx.Config.GetInt("agent.topology.conntrack.poll_interval")) * time.Second,
+	})
+
+	return p, nil
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package conntrack
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/topology"
+	tp "github.com/skydive-project/skydive/topology/probes"
+)
+
+// natTable indexes the NAT mappings of a network namespace by the addresses
+// and ports of the flows captured before and after the translation
+type natTable map[string]*flow.NAT
+
+func tupleKey(protocol, a, b string, portA, portB int64) string {
+	return fmt.Sprintf("%s/%s:%d/%s:%d", protocol, a, portA, b, portB)
+}
+
+func (t natTable) add(protocol string, nat *flow.NAT) {
+	for _, key := range []string{
+		tupleKey(protocol, nat.OriginalA, nat.OriginalB, nat.OriginalPortA, nat.OriginalPortB),
+		tupleKey(protocol, nat.OriginalB, nat.OriginalA, nat.OriginalPortB, nat.OriginalPortA),
+		tupleKey(protocol, nat.TranslatedA, nat.TranslatedB, nat.TranslatedPortA, nat.TranslatedPortB),
+		tupleKey(protocol, nat.TranslatedB, nat.TranslatedA, nat.TranslatedPortB, nat.TranslatedPortA),
+	} {
+		t[key] = nat
+	}
+}
+
+// newNAT returns the NAT mapping of a conntrack entry, its tracking ID being
+// computed from the original tuple
+func newNAT(protocol string, origA, origB string, origPortA, origPortB int64, transA, transB string, transPortA, transPortB int64) *flow.NAT {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(tupleKey(protocol, origA, origB, origPortA, origPortB)))
+
+	return &flow.NAT{
+		TrackingID:      strconv.FormatUint(hasher.Sum64(), 16),
+		SNAT:            origA != transA || origPortA != transPortA,
+		DNAT:            origB != transB || origPortB != transPortB,
+		OriginalA:       origA,
+		OriginalB:       origB,
+		OriginalPortA:   origPortA,
+		OriginalPortB:   origPortB,
+		TranslatedA:     transA,
+		TranslatedB:     transB,
+		TranslatedPortA: transPortA,
+		TranslatedPortB: transPortB,
+	}
+}
+
+// Probe describes a probe that keeps the NAT mappings of the conntrack
+// tables of the host and of its network namespaces
+type Probe struct {
+	*tp.ProbeWrapper
+	sync.RWMutex
+	graph    *graph.Graph
+	rootNode *graph.Node
+	tables   map[graph.Identifier]natTable
+}
+
+// getNamespace returns the network namespace node owning a node, or the
+// host node if there is none
+func (p *Probe) getNamespace(node *graph.Node) *graph.Node {
+	for node != nil {
+		if ty, _ := node.GetFieldString("Type"); ty == "netns" || node.ID == p.rootNode.ID {
+			return node
+		}
+
+		parents := p.graph.LookupParents(node, nil, topology.OwnershipMetadata())
+		if len(parents) == 0 {
+			break
+		}
+		node = parents[0]
+	}
+	return p.rootNode
+}
+
+func (p *Probe) lookup(namespace graph.Identifier, key string) *flow.NAT {
+	p.RLock()
+	defer p.RUnlock()
+
+	if nat, found := p.tables[namespace][key]; found {
+		return nat
+	}
+
+	// flows captured in a namespace can be translated by the host
+	return p.tables[p.rootNode.ID][key]
+}
+
+func (p *Probe) annotate(flows []*flow.Flow) {
+	p.graph.RLock()
+	defer p.graph.RUnlock()
+
+	for _, f := range flows {
+		if f.Network == nil || f.Transport == nil || f.NodeTID == "" {
+			continue
+		}
+
+		node := p.graph.LookupFirstNode(graph.Metadata{"TID": f.NodeTID})
+		if node == nil {
+			continue
+		}
+
+		key := tupleKey(f.Transport.Protocol.String(), f.Network.A, f.Network.B, f.Transport.A, f.Transport.B)
+		if nat := p.lookup(p.getNamespace(node).ID, key); nat != nil {
+			mapping := *nat
+			f.NAT = &mapping
+		}
+	}
+}
+
+// FlowAnnotator attaches the NAT mapping of the flows before forwarding
+// them to a flow sender
+type FlowAnnotator struct {
+	probe  *Probe
+	sender flow.Sender
+}
+
+// SendFlows annotates and forwards the flows
+func (a *FlowAnnotator) SendFlows(flows []*flow.Flow) {
+	a.probe.annotate(flows)
+	a.sender.SendFlows(flows)
+}
+
+// SendStats forwards the flow stats
+func (a *FlowAnnotator) SendStats(stats flow.Stats) {
+	a.sender.SendStats(stats)
+}
+
+// NewFlowAnnotator returns a new flow sender attaching the NAT mappings
+func (p *Probe) NewFlowAnnotator(sender flow.Sender) *FlowAnnotator {
+	return &FlowAnnotator{
+		probe:  p,
+		sender: sender,
+	}
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package conntrack
+
+import (
+	"testing"
+)
+
+func TestNATTable(t *testing.T) {
+	// a pod reaching a service whose backend is on another node
+	nat := newNAT("TCP", "10.244.1.5", "10.96.0.10", 41000, 53, "10.244.1.5", "10.244.2.7", 41000, 8053)
+	if nat.SNAT || !nat.DNAT {
+		t.Fatalf("expected a DNAT mapping, got %+v", nat)
+	}
+
+	table := make(natTable)
+	table.add("TCP", nat)
+
+	for _, key := range []string{
+		tupleKey("TCP", "10.244.1.5", "10.96.0.10", 41000, 53),
+		tupleKey("TCP", "10.244.1.5", "10.244.2.7", 41000, 8053),
+		tupleKey("TCP", "10.244.2.7", "10.244.1.5", 8053, 41000),
+	} {
+		if table[key] != nat {
+			t.Errorf("mapping not found for %s", key)
+		}
+	}
+
+	if table[tupleKey("UDP", "10.244.1.5", "10.96.0.10", 41000, 53)] != nil {
+		t.Error("mapping should not be found for another protocol")
+	}
+}
@@ -0,0 +1,332 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	pb "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/probe"
+	"github.com/skydive-project/skydive/topology"
+	tp "github.com/skydive-project/skydive/topology/probes"
+	ns "github.com/skydive-project/skydive/topology/probes/netns"
+)
+
+const requestTimeout = 10 * time.Second
+
+type sandboxInfo struct {
+	Pid       int
+	Namespace string
+	Node      *graph.Node
+}
+
+// Probe describes a probe that reports the pod sandboxes and the containers
+// of a runtime implementing the Kubernetes Container Runtime Interface
+type Probe struct {
+	Ctx          tp.Context
+	runtime      string
+	endpoint     string
+	pollInterval time.Duration
+	nsProbe      *ns.ProbeHandler
+	client       pb.RuntimeServiceClient
+	sandboxes    map[string]*sandboxInfo
+	containers   map[string]*graph.Node
+}
+
+// sandboxPid returns the PID of the sandbox infra process from the verbose
+// status of the sandbox, as reported by both containerd and CRI-O
+func sandboxPid(status *pb.PodSandboxStatusResponse) (int, error) {
+	var info struct {
+		Pid int `json:"pid"`
+	}
+
+	raw, found := status.Info["info"]
+	if !found {
+		return 0, errors.New("no verbose info for sandbox")
+	}
+
+	if err := json.Unmarshal([]byte(raw), &info); err != nil {
+		return 0, err
+	}
+
+	if info.Pid == 0 {
+		return 0, errors.New("no pid for sandbox")
+	}
+
+	return info.Pid, nil
+}
+
+func hostNetwork(status *pb.PodSandboxStatus) bool {
+	return status.GetLinux().GetNamespaces().GetOptions().GetNetwork() == pb.NamespaceMode_NODE
+}
+
+func (p *Probe) registerSandbox(ctx context.Context, sandbox *pb.PodSandbox) (*sandboxInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	status, err := p.client.PodSandboxStatus(ctx, &pb.PodSandboxStatusRequest{PodSandboxId: sandbox.Id, Verbose: true})
+	if err != nil {
+		return nil, err
+	}
+
+	if hostNetwork(status.GetStatus()) {
+		return &sandboxInfo{Node: p.Ctx.RootNode}, nil
+	}
+
+	pid, err := sandboxPid(status)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := fmt.Sprintf("/proc/%d/ns/net", pid)
+	p.Ctx.Logger.Debugf("Register %s sandbox %s and PID %d", p.runtime, sandbox.Id, pid)
+
+	n, err := p.nsProbe.Register(namespace, sandbox.Metadata.Namespace+"/"+sandbox.Metadata.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Ctx.Graph.Lock()
+	if err := p.Ctx.Graph.AddMetadata(n, "Manager", p.runtime); err != nil {
+		p.Ctx.Logger.Error(err)
+	}
+	p.Ctx.Graph.Unlock()
+
+	return &sandboxInfo{Pid: pid, Namespace: namespace, Node: n}, nil
+}
+
+func (p *Probe) unregisterSandbox(id string) {
+	info := p.sandboxes[id]
+	if info.Namespace != "" {
+		p.Ctx.Logger.Debugf("Stop listening for namespace %s with PID %d", info.Namespace, info.Pid)
+		p.nsProbe.Unregister(info.Namespace)
+	}
+	delete(p.sandboxes, id)
+}
+
+func containerMetadata(container *pb.Container, sandbox *pb.PodSandbox) *Metadata {
+	m := &Metadata{
+		ContainerID:   container.Id,
+		ContainerName: container.GetMetadata().GetName(),
+		SandboxID:     container.PodSandboxId,
+		State:         container.State.String(),
+		Image:         container.GetImage().GetImage(),
+	}
+
+	if sandbox != nil {
+		m.PodName = sandbox.GetMetadata().GetName()
+		m.PodNamespace = sandbox.GetMetadata().GetNamespace()
+		m.PodUID = sandbox.GetMetadata().GetUid()
+	}
+
+	if len(container.Labels) != 0 {
+		m.Labels = graph.Metadata(common.NormalizeValue(container.Labels).(map[string]interface{}))
+	}
+
+	return m
+}
+
+func (p *Probe) update(ctx context.Context) error {
+	listCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	sandboxList, err := p.client.ListPodSandbox(listCtx, &pb.ListPodSandboxRequest{
+		Filter: &pb.PodSandboxFilter{State: &pb.PodSandboxStateValue{State: pb.PodSandboxState_SANDBOX_READY}},
+	})
+	if err != nil {
+		return err
+	}
+
+	containerList, err := p.client.ListContainers(listCtx, &pb.ListContainersRequest{
+		Filter: &pb.ContainerFilter{State: &pb.ContainerStateValue{State: pb.ContainerState_CONTAINER_RUNNING}},
+	})
+	if err != nil {
+		return err
+	}
+
+	sandboxes := make(map[string]*pb.PodSandbox)
+	for _, sandbox := range sandboxList.Items {
+		sandboxes[sandbox.Id] = sandbox
+		if _, found := p.sandboxes[sandbox.Id]; found {
+			continue
+		}
+
+		info, err := p.registerSandbox(ctx, sandbox)
+		if err != nil {
+			p.Ctx.Logger.Debugf("Failed to register %s sandbox %s: %s", p.runtime, sandbox.Id, err)
+			continue
+		}
+		p.sandboxes[sandbox.Id] = info
+	}
+
+	p.Ctx.Graph.Lock()
+
+	containers := make(map[string]*graph.Node)
+	for _, container := range containerList.Containers {
+		info, found := p.sandboxes[container.PodSandboxId]
+		if !found {
+			continue
+		}
+
+		m := containerMetadata(container, sandboxes[container.PodSandboxId])
+
+		node, found := p.containers[container.Id]
+		if found {
+			if err := p.Ctx.Graph.AddMetadata(node, "CRI", m); err != nil {
+				p.Ctx.Logger.Error(err)
+			}
+		} else {
+			metadata := graph.Metadata{
+				"Type":    "container",
+				"Name":    m.ContainerName,
+				"Manager": p.runtime,
+				"CRI":     m,
+			}
+
+			if node, err = p.Ctx.Graph.NewNode(graph.GenID(p.runtime, container.Id), metadata); err != nil {
+				p.Ctx.Logger.Error(err)
+				continue
+			}
+			topology.AddOwnershipLink(p.Ctx.Graph, info.Node, node, nil)
+		}
+		containers[container.Id] = node
+	}
+
+	for id, node := range p.containers {
+		if _, found := containers[id]; !found {
+			if err := p.Ctx.Graph.DelNode(node); err != nil {
+				p.Ctx.Logger.Error(err)
+			}
+		}
+	}
+	p.containers = containers
+
+	p.Ctx.Graph.Unlock()
+
+	for id := range p.sandboxes {
+		if _, found := sandboxes[id]; !found {
+			p.unregisterSandbox(id)
+		}
+	}
+
+	return nil
+}
+
+// Do connects to the runtime and polls its sandboxes and containers
+func (p *Probe) Do(ctx context.Context, wg *sync.WaitGroup) error {
+	protocol, address, err := common.ParseAddr(p.endpoint)
+	if err != nil {
+		return err
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(dialCtx, address, grpc.WithInsecure(), grpc.WithBlock(),
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout(protocol, addr, timeout)
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to connect to %s: %s", p.endpoint, err)
+	}
+
+	p.client = pb.NewRuntimeServiceClient(conn)
+
+	version, err := p.client.Version(dialCtx, &pb.VersionRequest{})
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("Failed to retrieve the version of %s: %s", p.runtime, err)
+	}
+
+	p.Ctx.Logger.Infof("Connected to %s %s (CRI %s)", version.RuntimeName, version.RuntimeVersion, version.RuntimeApiVersion)
+
+	if err := p.update(ctx); err != nil {
+		conn.Close()
+		return err
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer conn.Close()
+
+		ticker := time.NewTicker(p.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.update(ctx); err != nil {
+					p.Ctx.Logger.Errorf("Failed to retrieve the %s containers: %s", p.runtime, err)
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func newProbe(ctx tp.Context, bundle *probe.Bundle, runtime string) (probe.Handler, error) {
+	nsHandler := bundle.GetHandler("netns")
+	if nsHandler == nil {
+		return nil, errors.New("unable to find the netns handler")
+	}
+
+	p := &Probe{
+		Ctx:          ctx,
+		runtime:      runtime,
+		endpoint:     ctx.Config.GetString("agent.topology." + runtime + ".endpoint"),
+		pollInterval: time.Duration(ctx.Config.GetInt("agent.topology."+runtime+".poll_interval")) * time.Second,
+		nsProbe:      nsHandler.(*ns.ProbeHandler),
+		sandboxes:    make(map[string]*sandboxInfo),
+		containers:   make(map[string]*graph.Node),
+	}
+
+	return tp.NewProbeWrapper(p), nil
+}
+
+// NewContainerdProbe returns a new topology probe for containerd
+func NewContainerdProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
+	return newProbe(ctx, bundle, "containerd")
+}
+
+// NewCRIOProbe returns a new topology probe for CRI-O
+func NewCRIOProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
+	return newProbe(ctx, bundle, "crio")
+}
+
+// Register registers graph metadata decoders
+func Register() {
+	graph.NodeMetadataDecoders["CRI"] = MetadataDecoder
+}
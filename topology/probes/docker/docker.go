@@ -54,6 +54,7 @@ type ProbeHandler struct {
 	common.RWMutex
 	Ctx          tp.Context
 	nsProbe      *ns.ProbeHandler
+	manager      string
 	url          string
 	client       *client.Client
 	hostNs       netns.NsHandle
@@ -84,7 +85,7 @@ func (p *ProbeHandler) registerContainer(id string) {
 	defer nsHandle.Close()
 
 	namespace := p.containerNamespace(info.State.Pid)
-	p.Ctx.Logger.Debugf("Register docker container %s and PID %d", info.ID, info.State.Pid)
+	p.Ctx.Logger.Debugf("Register %s container %s and PID %d", p.manager, info.ID, info.State.Pid)
 
 	var n *graph.Node
 	if p.hostNs.Equal(nsHandle) {
@@ -97,7 +98,7 @@ func (p *ProbeHandler) registerContainer(id string) {
 		}
 
 		p.Ctx.Graph.Lock()
-		if err := p.Ctx.Graph.AddMetadata(n, "Manager", "docker"); err != nil {
+		if err := p.Ctx.Graph.AddMetadata(n, "Manager", p.manager); err != nil {
 			p.Ctx.Logger.Error(err)
 		}
 		p.Ctx.Graph.Unlock()
@@ -126,7 +127,7 @@ func (p *ProbeHandler) registerContainer(id string) {
 		metadata := graph.Metadata{
 			"Type":           "container",
 			"Name":           info.Name[1:],
-			"Manager":        "docker",
+			"Manager":        p.manager,
 			"InitProcessPID": pid,
 			"Docker":         dockerMetadata,
 		}
@@ -196,7 +197,7 @@ func (p *ProbeHandler) Do(ctx context.Context, wg *sync.WaitGroup) error {
 		return err
 	}
 
-	p.Ctx.Logger.Infof("Connected to Docker %s", version.Version)
+	p.Ctx.Logger.Infof("Connected to %s %s on %s", p.manager, version.Version, p.url)
 
 	if p.hostNs, err = netns.Get(); err != nil {
 		return err
@@ -266,12 +267,7 @@ func NewProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
 	dockerURL := ctx.Config.GetString("agent.topology.docker.url")
 	netnsRunPath := ctx.Config.GetString("agent.topology.docker.netns.run_path")
 
-	p := &ProbeHandler{
-		nsProbe:      nsHandler.(*ns.ProbeHandler),
-		url:          dockerURL,
-		containerMap: make(map[string]containerInfo),
-		Ctx:          ctx,
-	}
+	p := newProbeHandler(ctx, nsHandler.(*ns.ProbeHandler), "docker", dockerURL)
 
 	if netnsRunPath != "" {
 		p.nsProbe.Exclude(netnsRunPath + "/default")
@@ -281,6 +277,16 @@ func NewProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
 	return probes.NewProbeWrapper(p), nil
 }
 
+func newProbeHandler(ctx tp.Context, nsProbe *ns.ProbeHandler, manager, url string) *ProbeHandler {
+	return &ProbeHandler{
+		nsProbe:      nsProbe,
+		manager:      manager,
+		url:          url,
+		containerMap: make(map[string]containerInfo),
+		Ctx:          ctx,
+	}
+}
+
 // Register registers graph metadata decoders
 func Register() {
 	graph.NodeMetadataDecoders["Docker"] = MetadataDecoder
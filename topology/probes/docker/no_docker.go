@@ -30,6 +30,11 @@ func NewProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
 	return nil, common.ErrNotImplemented
 }
 
+// NewPodmanProbe returns a new topology Podman probe
+func NewPodmanProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
+	return nil, common.ErrNotImplemented
+}
+
 // Register registers graph metadata decoders
 func Register() {
 }
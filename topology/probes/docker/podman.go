@@ -0,0 +1,83 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package docker
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/skydive-project/skydive/probe"
+	tp "github.com/skydive-project/skydive/topology/probes"
+	ns "github.com/skydive-project/skydive/topology/probes/netns"
+)
+
+// rootlessSockets matches the API sockets of the Podman services started
+// by unprivileged users
+const rootlessSockets = "/run/user/*/podman/podman.sock"
+
+// PodmanProbe describes a probe that reports the containers of the system
+// wide and of the rootless Podman services through their Docker compatible API
+type PodmanProbe struct {
+	probes []*tp.ProbeWrapper
+}
+
+// Start the Podman probe
+func (p *PodmanProbe) Start() error {
+	for _, probe := range p.probes {
+		if err := probe.Start(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop the Podman probe
+func (p *PodmanProbe) Stop() {
+	for _, probe := range p.probes {
+		probe.Stop()
+	}
+}
+
+// NewPodmanProbe returns a new topology Podman probe
+func NewPodmanProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
+	nsHandler := bundle.GetHandler("netns")
+	if nsHandler == nil {
+		return nil, errors.New("unable to find the netns handler")
+	}
+	nsProbe := nsHandler.(*ns.ProbeHandler)
+
+	urls := []string{ctx.Config.GetString("agent.topology.podman.url")}
+	if ctx.Config.GetBool("agent.topology.podman.rootless") {
+		sockets, err := filepath.Glob(rootlessSockets)
+		if err != nil {
+			return nil, err
+		}
+		for _, socket := range sockets {
+			urls = append(urls, "unix://"+socket)
+		}
+	}
+
+	p := &PodmanProbe{}
+	for _, url := range urls {
+		p.probes = append(p.probes, tp.NewProbeWrapper(newProbeHandler(ctx, nsProbe, "podman", url)))
+	}
+
+	return p, nil
+}
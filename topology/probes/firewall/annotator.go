@@ -0,0 +1,145 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package firewall
+
+import (
+	"net"
+	"strings"
+
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// FlowAnnotator annotates the flows that got no reply with the drop rule of
+// the firewall of their capture namespace that most likely matched them,
+// before forwarding them to a flow sender
+type FlowAnnotator struct {
+	graph  *graph.Graph
+	sender flow.Sender
+}
+
+func matchAddress(pattern, ip string) bool {
+	if pattern == "" {
+		return true
+	}
+	if _, cidr, err := net.ParseCIDR(pattern); err == nil {
+		return cidr.Contains(net.ParseIP(ip))
+	}
+	return net.ParseIP(pattern).Equal(net.ParseIP(ip))
+}
+
+// matchInterface handles the iptables '+' and nftables '*' wildcards
+func matchInterface(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	if strings.HasSuffix(pattern, "+") || strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(name, pattern[:len(pattern)-1])
+	}
+	return pattern == name
+}
+
+func matchRule(rule *Rule, f *flow.Flow, ifName string) bool {
+	if !rule.Complete || (rule.Verdict != "DROP" && rule.Verdict != "REJECT") {
+		return false
+	}
+
+	if !matchAddress(rule.Source, f.Network.A) || !matchAddress(rule.Destination, f.Network.B) {
+		return false
+	}
+
+	if !matchInterface(rule.InputInterface, ifName) || !matchInterface(rule.OutputInterface, ifName) {
+		return false
+	}
+
+	if rule.Protocol == "" {
+		return true
+	}
+
+	if f.Transport == nil || !strings.EqualFold(rule.Protocol, f.Transport.Protocol.String()) {
+		return false
+	}
+
+	return (rule.SourcePort == 0 || rule.SourcePort == f.Transport.A) &&
+		(rule.DestinationPort == 0 || rule.DestinationPort == f.Transport.B)
+}
+
+// getFirewall returns the firewall metadata of the namespace owning the node
+func (a *FlowAnnotator) getFirewall(node *graph.Node) *Metadata {
+	for node != nil {
+		if m, ok := node.Metadata["Firewall"].(*Metadata); ok {
+			return m
+		}
+
+		parents := a.graph.LookupParents(node, nil, topology.OwnershipMetadata())
+		if len(parents) == 0 {
+			return nil
+		}
+		node = parents[0]
+	}
+	return nil
+}
+
+func (a *FlowAnnotator) annotate(flows []*flow.Flow) {
+	a.graph.RLock()
+	defer a.graph.RUnlock()
+
+	for _, f := range flows {
+		if f.Network == nil || f.Metric == nil || f.Metric.BAPackets != 0 || f.NodeTID == "" {
+			continue
+		}
+
+		node := a.graph.LookupFirstNode(graph.Metadata{"TID": f.NodeTID})
+		if node == nil {
+			continue
+		}
+		ifName, _ := node.GetFieldString("Name")
+
+		firewall := a.getFirewall(node)
+		if firewall == nil {
+			continue
+		}
+
+		for _, rule := range firewall.Rules {
+			if matchRule(rule, f, ifName) {
+				f.DropRule = rule.Text
+				break
+			}
+		}
+	}
+}
+
+// SendFlows annotates and forwards the flows
+func (a *FlowAnnotator) SendFlows(flows []*flow.Flow) {
+	a.annotate(flows)
+	a.sender.SendFlows(flows)
+}
+
+// SendStats forwards the flow stats
+func (a *FlowAnnotator) SendStats(stats flow.Stats) {
+	a.sender.SendStats(stats)
+}
+
+// NewFlowAnnotator returns a new flow sender annotating the dropped flows
+func NewFlowAnnotator(g *graph.Graph, sender flow.Sender) *FlowAnnotator {
+	return &FlowAnnotator{
+		graph:  g,
+		sender: sender,
+	}
+}
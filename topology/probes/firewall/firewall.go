@@ -0,0 +1,247 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package firewall
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/probe"
+	tp "github.com/skydive-project/skydive/topology/probes"
+)
+
+// Probe describes a probe that reports the nftables or iptables ruleset of
+// the host and of its network namespaces
+type Probe struct {
+	Ctx          tp.Context
+	backend      string
+	pollInterval time.Duration
+	hashes       map[graph.Identifier]string
+}
+
+type target struct {
+	node *graph.Node
+	path string
+}
+
+func listNftables() ([]*Rule, error) {
+	out, err := exec.Command("nft", "-j", "list", "ruleset").Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list nftables ruleset: %s", err)
+	}
+	return parseNftables(out)
+}
+
+func listIptables() ([]*Rule, error) {
+	var rules []*Rule
+	for family, command := range map[string]string{"ip": "iptables-save", "ip6": "ip6tables-save"} {
+		out, err := exec.Command(command).Output()
+		if err != nil {
+			return nil, fmt.Errorf("unable to run %s: %s", command, err)
+		}
+		rules = append(rules, parseIptables(family, out)...)
+	}
+	return rules, nil
+}
+
+// listRules returns the backend and the rules of the current network namespace
+func (p *Probe) listRules() (string, []*Rule, error) {
+	switch p.backend {
+	case "nftables":
+		rules, err := listNftables()
+		return "nftables", rules, err
+	case "iptables":
+		rules, err := listIptables()
+		return "iptables", rules, err
+	}
+
+	// rules defined with iptables-legacy are not reported by nft
+	if _, err := exec.LookPath("nft"); err == nil {
+		if rules, err := listNftables(); err == nil && len(rules) > 0 {
+			return "nftables", rules, nil
+		}
+	}
+	rules, err := listIptables()
+	return "iptables", rules, err
+}
+
+func (p *Probe) snapshot(path string) (*Metadata, error) {
+	if path != "" {
+		ctx, err := common.NewNetNsContext(path)
+		defer ctx.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	backend, rules, err := p.listRules()
+	if err != nil {
+		return nil, err
+	}
+
+	texts := make([]string, len(rules))
+	for i, rule := range rules {
+		texts[i] = rule.Text
+	}
+	sort.Strings(texts)
+
+	h := sha1.New()
+	for _, text := range texts {
+		h.Write([]byte(text + "\n"))
+	}
+
+	return &Metadata{
+		Backend: backend,
+		Hash:    hex.EncodeToString(h.Sum(nil)),
+		Rules:   rules,
+	}, nil
+}
+
+// diffRules returns the rules only present in the first and second rulesets
+func diffRules(old, new []*Rule) (added, removed []string) {
+	previous := make(map[string]bool)
+	for _, rule := range old {
+		previous[rule.Text] = true
+	}
+
+	current := make(map[string]bool)
+	for _, rule := range new {
+		current[rule.Text] = true
+		if !previous[rule.Text] {
+			added = append(added, rule.Text)
+		}
+	}
+
+	for _, rule := range old {
+		if !current[rule.Text] {
+			removed = append(removed, rule.Text)
+		}
+	}
+
+	return
+}
+
+func (p *Probe) getTargets() []target {
+	p.Ctx.Graph.RLock()
+	defer p.Ctx.Graph.RUnlock()
+
+	targets := []target{{node: p.Ctx.RootNode}}
+	for _, node := range p.Ctx.Graph.GetNodes(graph.Metadata{"Type": "netns"}) {
+		if path, _ := node.GetFieldString("Path"); path != "" {
+			targets = append(targets, target{node: node, path: path})
+		}
+	}
+
+	return targets
+}
+
+func (p *Probe) update() {
+	hashes := make(map[graph.Identifier]string)
+
+	for _, t := range p.getTargets() {
+		m, err := p.snapshot(t.path)
+		if err != nil {
+			p.Ctx.Logger.Debugf("Failed to retrieve the firewall rules of %s: %s", t.node.ID, err)
+			continue
+		}
+		hashes[t.node.ID] = m.Hash
+
+		if p.hashes[t.node.ID] == m.Hash {
+			continue
+		}
+
+		p.Ctx.Graph.Lock()
+		if node := p.Ctx.Graph.GetNode(t.node.ID); node != nil {
+			var old []*Rule
+			if previous, ok := node.Metadata["Firewall"].(*Metadata); ok {
+				old = previous.Rules
+			}
+
+			added, removed := diffRules(old, m.Rules)
+			m.LastChange = &Change{
+				Time:    common.UnixMillis(time.Now()),
+				Added:   added,
+				Removed: removed,
+			}
+
+			if err := p.Ctx.Graph.AddMetadata(node, "Firewall", m); err != nil {
+				p.Ctx.Logger.Error(err)
+			}
+		}
+		p.Ctx.Graph.Unlock()
+	}
+
+	p.hashes = hashes
+}
+
+// Do polls the firewall rules of the network namespaces
+func (p *Probe) Do(ctx context.Context, wg *sync.WaitGroup) error {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(p.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			p.update()
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// NewProbe returns a new firewall topology probe
+func NewProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
+	backend := ctx.Config.GetString("agent.topology.firewall.backend")
+	switch backend {
+	case "auto", "nftables", "iptables":
+	default:
+		return nil, fmt.Errorf("unsupported firewall backend %s", backend)
+	}
+
+	p := &Probe{
+		Ctx:          ctx,
+		backend:      backend,
+		pollInterval: time.Duration(ctx.Config.GetInt("agent.topology.firewall.poll_interval")) * time.Second,
+		hashes:       make(map[graph.Identifier]string),
+	}
+
+	return tp.NewProbeWrapper(p), nil
+}
+
+// Register registers graph metadata decoders
+func Register() {
+	graph.NodeMetadataDecoders["Firewall"] = MetadataDecoder
+}
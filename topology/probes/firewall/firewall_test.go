@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package firewall
+
+import (
+	"reflect"
+	"testing"
+)
+
+const nftablesRuleset = `{"nftables": [
+  {"metainfo": {"version": "0.9.3", "json_schema_version": 1}},
+  {"table": {"family": "inet", "name": "filter", "handle": 1}},
+  {"chain": {"family": "inet", "table": "filter", "name": "input", "handle": 1, "type": "filter", "hook": "input", "prio": 0, "policy": "accept"}},
+  {"rule": {"family": "inet", "table": "filter", "chain": "input", "handle": 3, "expr": [
+    {"match": {"op": "==", "left": {"payload": {"protocol": "ip", "field": "saddr"}}, "right": {"prefix": {"addr": "10.0.0.0", "len": 8}}}},
+    {"match": {"op": "==", "left": {"payload": {"protocol": "tcp", "field": "dport"}}, "right": 22}},
+    {"counter": {"packets": 12, "bytes": 720}},
+    {"drop": null}
+  ]}},
+  {"rule": {"family": "inet", "table": "filter", "chain": "input", "handle": 4, "expr": [
+    {"match": {"op": "in", "left": {"ct": {"key": "state"}}, "right": ["established", "related"]}},
+    {"accept": null}
+  ]}}
+]}`
+
+const iptablesSave = `# Generated by iptables-save
+*filter
+:INPUT ACCEPT [0:0]
+-A INPUT -s 192.168.1.0/24 -i eth0 -p udp -m udp --dport 53 -m comment --comment "no dns" -j REJECT --reject-with icmp-port-unreachable
+-A INPUT -m state --state RELATED,ESTABLISHED -j ACCEPT
+COMMIT
+`
+
+func TestNftables(t *testing.T) {
+	rules, err := parseNftables([]byte(nftablesRuleset))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(rules))
+	}
+
+	drop := *rules[0]
+	drop.Text = ""
+	expected := Rule{
+		Family:          "inet",
+		Table:           "filter",
+		Chain:           "input",
+		Verdict:         "DROP",
+		Source:          "10.0.0.0/8",
+		Protocol:        "tcp",
+		DestinationPort: 22,
+		Complete:        true,
+	}
+	if !reflect.DeepEqual(drop, expected) {
+		t.Errorf("expected %+v, got %+v", expected, drop)
+	}
+
+	if rules[1].Complete || rules[1].Verdict != "ACCEPT" {
+		t.Errorf("conntrack rule should be incomplete: %+v", rules[1])
+	}
+}
+
+func TestIptables(t *testing.T) {
+	rules := parseIptables("ip", []byte(iptablesSave))
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(rules))
+	}
+
+	reject := *rules[0]
+	reject.Text = ""
+	expected := Rule{
+		Family:          "ip",
+		Table:           "filter",
+		Chain:           "INPUT",
+		Verdict:         "REJECT",
+		Source:          "192.168.1.0/24",
+		Protocol:        "udp",
+		DestinationPort: 53,
+		InputInterface:  "eth0",
+		Complete:        true,
+	}
+	if !reflect.DeepEqual(reject, expected) {
+		t.Errorf("expected %+v, got %+v", expected, reject)
+	}
+
+	if rules[1].Complete {
+		t.Errorf("state rule should be incomplete: %+v", rules[1])
+	}
+}
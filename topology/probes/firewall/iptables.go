@@ -0,0 +1,143 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package firewall
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// splitArgs splits an iptables-save line, keeping quoted arguments whole
+func splitArgs(line string) (args []string) {
+	var current strings.Builder
+	quoted, escaped, pending := false, false, false
+
+	for _, c := range line {
+		switch {
+		case escaped:
+			current.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted, pending = !quoted, true
+		case c == ' ' && !quoted:
+			if pending || current.Len() > 0 {
+				args = append(args, current.String())
+				current.Reset()
+				pending = false
+			}
+		default:
+			current.WriteRune(c)
+		}
+	}
+
+	if pending || current.Len() > 0 {
+		args = append(args, current.String())
+	}
+
+	return args
+}
+
+func newIptablesRule(family, table, line string) *Rule {
+	rule := &Rule{
+		Family:   family,
+		Table:    table,
+		Complete: true,
+		Text:     family + " " + table + " " + line,
+	}
+
+	args := splitArgs(line)
+	for i := 0; i < len(args); i++ {
+		opt, value := args[i], ""
+		if opt == "!" {
+			rule.Complete = false
+			continue
+		}
+		if i+1 < len(args) {
+			value = args[i+1]
+		}
+
+		switch opt {
+		case "-A", "--append":
+			rule.Chain = value
+		case "-s", "--source":
+			rule.Source = value
+		case "-d", "--destination":
+			rule.Destination = value
+		case "-p", "--protocol":
+			rule.Protocol = value
+		case "-i", "--in-interface":
+			rule.InputInterface = value
+		case "-o", "--out-interface":
+			rule.OutputInterface = value
+		case "--sport", "--source-port", "--dport", "--destination-port":
+			port, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				// port ranges
+				rule.Complete = false
+			} else if opt == "--sport" || opt == "--source-port" {
+				rule.SourcePort = port
+			} else {
+				rule.DestinationPort = port
+			}
+		case "-m", "--match":
+			if value != "tcp" && value != "udp" && value != "comment" {
+				rule.Complete = false
+			}
+		case "--comment":
+		case "-j", "--jump":
+			// the remaining arguments are the target options
+			rule.Verdict = value
+			return rule
+		case "-g", "--goto":
+			rule.Verdict = "GOTO"
+			return rule
+		default:
+			rule.Complete = false
+			if !strings.HasPrefix(value, "-") {
+				i++
+			}
+			continue
+		}
+		i++
+	}
+
+	return rule
+}
+
+// parseIptables returns the rules of the output of iptables-save
+func parseIptables(family string, data []byte) []*Rule {
+	var rules []*Rule
+	var table string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "*"):
+			table = line[1:]
+		case strings.HasPrefix(line, "-A "):
+			rules = append(rules, newIptablesRule(family, table, line))
+		}
+	}
+
+	return rules
+}
@@ -0,0 +1,77 @@
+//go:generate go run github.com/skydive-project/skydive/scripts/gendecoder -package github.com/skydive-project/skydive/topology/probes/firewall
+//go:generate go run github.com/mailru/easyjson/easyjson $GOFILE
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package firewall
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+// Metadata describes the firewall ruleset of a network namespace
+// easyjson:json
+// gendecoder
+type Metadata struct {
+	Backend    string  `json:",omitempty"`
+	Hash       string  `json:",omitempty"`
+	Rules      []*Rule `json:",omitempty"`
+	LastChange *Change `json:",omitempty"`
+}
+
+// Rule describes a firewall rule. Complete is false when the rule holds
+// matches that can not be evaluated against a flow.
+// easyjson:json
+// gendecoder
+type Rule struct {
+	Family          string `json:",omitempty"`
+	Table           string `json:",omitempty"`
+	Chain           string `json:",omitempty"`
+	Verdict         string `json:",omitempty"`
+	Source          string `json:",omitempty"`
+	Destination     string `json:",omitempty"`
+	Protocol        string `json:",omitempty"`
+	SourcePort      int64  `json:",omitempty"`
+	DestinationPort int64  `json:",omitempty"`
+	InputInterface  string `json:",omitempty"`
+	OutputInterface string `json:",omitempty"`
+	Complete        bool   `json:",omitempty"`
+	Text            string `json:",omitempty"`
+}
+
+// Change describes the rules added and removed by the last ruleset update
+// easyjson:json
+// gendecoder
+type Change struct {
+	Time    int64    `json:",omitempty"`
+	Added   []string `json:",omitempty"`
+	Removed []string `json:",omitempty"`
+}
+
+// MetadataDecoder implements a json message raw decoder
+func MetadataDecoder(raw json.RawMessage) (common.Getter, error) {
+	var m Metadata
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal firewall metadata %s: %s", string(raw), err)
+	}
+
+	return &m, nil
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package firewall
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type nftPayload struct {
+	Protocol string `json:"protocol"`
+	Field    string `json:"field"`
+}
+
+type nftMeta struct {
+	Key string `json:"key"`
+}
+
+type nftOperand struct {
+	Payload *nftPayload `json:"payload"`
+	Meta    *nftMeta    `json:"meta"`
+}
+
+type nftPrefix struct {
+	Addr string `json:"addr"`
+	Len  int    `json:"len"`
+}
+
+type nftMatch struct {
+	Op    string          `json:"op"`
+	Left  nftOperand      `json:"left"`
+	Right json.RawMessage `json:"right"`
+}
+
+type nftRule struct {
+	Family string                       `json:"family"`
+	Table  string                       `json:"table"`
+	Chain  string                       `json:"chain"`
+	Expr   []map[string]json.RawMessage `json:"expr"`
+}
+
+type nftRuleset struct {
+	Nftables []struct {
+		Rule *nftRule `json:"rule"`
+	} `json:"nftables"`
+}
+
+var nftVerdicts = map[string]string{
+	"accept": "ACCEPT",
+	"drop":   "DROP",
+	"reject": "REJECT",
+	"jump":   "JUMP",
+	"goto":   "GOTO",
+	"return": "RETURN",
+}
+
+// nftValue returns the string form of the right operand of a match, CIDR
+// prefixes being returned in their address/length notation
+func nftValue(raw json.RawMessage) (string, bool) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, true
+	}
+
+	var n int64
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return strconv.FormatInt(n, 10), true
+	}
+
+	var p struct {
+		Prefix *nftPrefix `json:"prefix"`
+	}
+	if err := json.Unmarshal(raw, &p); err == nil && p.Prefix != nil {
+		return fmt.Sprintf("%s/%d", p.Prefix.Addr, p.Prefix.Len), true
+	}
+
+	return "", false
+}
+
+// applyMatch fills the rule with a match expression, returning false when
+// the match can not be expressed with the rule fields
+func (r *Rule) applyMatch(m *nftMatch) bool {
+	if m.Op != "==" {
+		return false
+	}
+
+	value, ok := nftValue(m.Right)
+	if !ok {
+		return false
+	}
+
+	switch {
+	case m.Left.Payload != nil:
+		switch m.Left.Payload.Field {
+		case "saddr":
+			r.Source = value
+		case "daddr":
+			r.Destination = value
+		case "sport", "dport":
+			port, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return false
+			}
+			if m.Left.Payload.Field == "sport" {
+				r.SourcePort = port
+			} else {
+				r.DestinationPort = port
+			}
+			r.Protocol = m.Left.Payload.Protocol
+		default:
+			return false
+		}
+	case m.Left.Meta != nil:
+		switch m.Left.Meta.Key {
+		case "l4proto":
+			r.Protocol = value
+		case "iifname":
+			r.InputInterface = value
+		case "oifname":
+			r.OutputInterface = value
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+
+	return true
+}
+
+func newNftRule(nr *nftRule) *Rule {
+	rule := &Rule{
+		Family:   nr.Family,
+		Table:    nr.Table,
+		Chain:    nr.Chain,
+		Complete: true,
+	}
+
+	var text []string
+	for _, expr := range nr.Expr {
+		for key, value := range expr {
+			if key == "counter" {
+				continue
+			}
+			text = append(text, fmt.Sprintf(`{"%s":%s}`, key, string(value)))
+
+			if verdict, found := nftVerdicts[key]; found {
+				rule.Verdict = verdict
+				continue
+			}
+
+			if key != "match" {
+				rule.Complete = false
+				continue
+			}
+
+			var m nftMatch
+			if err := json.Unmarshal(value, &m); err != nil || !rule.applyMatch(&m) {
+				rule.Complete = false
+			}
+		}
+	}
+
+	rule.Text = fmt.Sprintf("%s %s %s [%s]", nr.Family, nr.Table, nr.Chain, strings.Join(text, ","))
+
+	return rule
+}
+
+// parseNftables returns the rules of the JSON output of 'nft -j list ruleset'
+func parseNftables(data []byte) ([]*Rule, error) {
+	var ruleset nftRuleset
+	if err := json.Unmarshal(data, &ruleset); err != nil {
+		return nil, fmt.Errorf("unable to parse nftables ruleset: %s", err)
+	}
+
+	var rules []*Rule
+	for _, object := range ruleset.Nftables {
+		if object.Rule != nil {
+			rules = append(rules, newNftRule(object.Rule))
+		}
+	}
+
+	return rules, nil
+}
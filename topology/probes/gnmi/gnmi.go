@@ -0,0 +1,486 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gnmi
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/probe"
+	"github.com/skydive-project/skydive/topology"
+	tp "github.com/skydive-project/skydive/topology/probes"
+)
+
+// Manager of the gNMI nodes
+const Manager = "gnmi"
+
+const retryInterval = 10 * time.Second
+
+// Probe describes a probe that subscribes to the OpenConfig interfaces
+// telemetry of a list of network devices over gNMI
+type Probe struct {
+	*tp.ProbeWrapper
+	graph          *graph.Graph
+	targets        []string
+	username       string
+	password       string
+	tls            bool
+	insecure       bool
+	sampleInterval time.Duration
+}
+
+// ifaceState holds the state of an interface, built from the leaves
+// received in one notification
+type ifaceState struct {
+	name     string
+	metadata graph.Metadata
+	gnmi     *Metadata
+	metric   *topology.InterfaceMetric
+}
+
+// elems returns the elements of a path, prefixed by the ones of the prefix
+// of its notification
+func elems(prefix, path *gpb.Path) []*gpb.PathElem {
+	var elems []*gpb.PathElem
+	if prefix != nil {
+		elems = append(elems, prefix.GetElem()...)
+	}
+	return append(elems, path.GetElem()...)
+}
+
+// interfaceLeaf returns the name of the interface and the path of the leaf
+// relative to the interface container, ie. state/counters/in-octets
+func interfaceLeaf(elems []*gpb.PathElem) (string, string) {
+	if len(elems) < 3 || elems[0].Name != "interfaces" || elems[1].Name != "interface" {
+		return "", ""
+	}
+
+	name := elems[1].Key["name"]
+
+	var leaf []string
+	for _, elem := range elems[2:] {
+		leaf = append(leaf, elem.Name)
+	}
+	return name, strings.Join(leaf, "/")
+}
+
+// value returns the value of a leaf, JSON encoded values being decoded as
+// devices are free to use them for scalar values
+func value(v *gpb.TypedValue) interface{} {
+	switch val := v.GetValue().(type) {
+	case *gpb.TypedValue_StringVal:
+		return val.StringVal
+	case *gpb.TypedValue_UintVal:
+		return int64(val.UintVal)
+	case *gpb.TypedValue_IntVal:
+		return val.IntVal
+	case *gpb.TypedValue_BoolVal:
+		return val.BoolVal
+	case *gpb.TypedValue_JsonVal:
+		return decodeJSON(val.JsonVal)
+	case *gpb.TypedValue_JsonIetfVal:
+		return decodeJSON(val.JsonIetfVal)
+	}
+	return nil
+}
+
+func decodeJSON(b []byte) interface{} {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil
+	}
+
+	if f, ok := v.(float64); ok {
+		return int64(f)
+	}
+	return v
+}
+
+func toInt64(v interface{}) int64 {
+	switch val := v.(type) {
+	case int64:
+		return val
+	case string:
+		// RFC 7951 encodes the 64 bits integers as strings
+		i, _ := strconv.ParseInt(val, 10, 64)
+		return i
+	}
+	return 0
+}
+
+func toString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// identity returns the name of an identity without the module prefix
+// devices may add, ie. openconfig-if-ethernet:SPEED_10GB
+func identity(v interface{}) string {
+	s := toString(v)
+	if i := strings.LastIndex(s, ":"); i != -1 {
+		return s[i+1:]
+	}
+	return s
+}
+
+// apply sets the leaf of an interface to the given value
+func (s *ifaceState) apply(leaf string, v interface{}) {
+	switch leaf {
+	case "state/oper-status":
+		if identity(v) == "UP" {
+			s.metadata["State"] = "UP"
+		} else {
+			s.metadata["State"] = "DOWN"
+		}
+	case "state/admin-status":
+		s.gnmi.AdminStatus = identity(v)
+	case "state/description":
+		s.gnmi.Description = toString(v)
+	case "state/mtu":
+		s.metadata["MTU"] = toInt64(v)
+	case "ethernet/state/mac-address":
+		s.metadata["MAC"] = strings.ToLower(toString(v))
+	case "ethernet/state/port-speed":
+		s.gnmi.Speed = identity(v)
+	case "state/counters/in-octets":
+		s.metric.RxBytes = toInt64(v)
+	case "state/counters/in-unicast-pkts":
+		s.metric.RxPackets = toInt64(v)
+	case "state/counters/in-errors":
+		s.metric.RxErrors = toInt64(v)
+	case "state/counters/in-discards":
+		s.metric.RxDropped = toInt64(v)
+	case "state/counters/in-multicast-pkts":
+		s.metric.Multicast = toInt64(v)
+	case "state/counters/out-octets":
+		s.metric.TxBytes = toInt64(v)
+	case "state/counters/out-unicast-pkts":
+		s.metric.TxPackets = toInt64(v)
+	case "state/counters/out-errors":
+		s.metric.TxErrors = toInt64(v)
+	case "state/counters/out-discards":
+		s.metric.TxDropped = toInt64(v)
+	}
+}
+
+// parseNotification returns the state of the interfaces updated by a
+// notification, the interfaces it deletes and the host name of the device
+// if reported
+func parseNotification(n *gpb.Notification) (map[string]*ifaceState, []string, string) {
+	var hostname string
+	states := make(map[string]*ifaceState)
+
+	for _, update := range n.GetUpdate() {
+		elems := elems(n.GetPrefix(), update.GetPath())
+
+		if len(elems) == 3 && elems[0].Name == "system" && elems[1].Name == "state" && elems[2].Name == "hostname" {
+			hostname = toString(value(update.GetVal()))
+			continue
+		}
+
+		name, leaf := interfaceLeaf(elems)
+		if name == "" {
+			continue
+		}
+
+		state, found := states[name]
+		if !found {
+			state = &ifaceState{
+				name:     name,
+				metadata: graph.Metadata{},
+				gnmi:     &Metadata{},
+				metric:   &topology.InterfaceMetric{},
+			}
+			states[name] = state
+		}
+		state.apply(leaf, value(update.GetVal()))
+	}
+
+	var deleted []string
+	for _, path := range n.GetDelete() {
+		// only the deletion of the whole interface is handled
+		if elems := elems(n.GetPrefix(), path); len(elems) == 2 && elems[0].Name == "interfaces" && elems[1].Name == "interface" {
+			deleted = append(deleted, elems[1].Key["name"])
+		}
+	}
+
+	return states, deleted, hostname
+}
+
+func deviceID(target string) graph.Identifier {
+	return graph.GenID(Manager, target)
+}
+
+func portID(target, name string) graph.Identifier {
+	return graph.GenID(Manager, target, name)
+}
+
+func (p *Probe) getOrCreateDevice(target string) (*graph.Node, error) {
+	if node := p.graph.GetNode(deviceID(target)); node != nil {
+		return node, nil
+	}
+
+	return p.graph.NewNode(deviceID(target), graph.Metadata{
+		"Type":    "switch",
+		"Name":    target,
+		"Manager": Manager,
+		"Probe":   Manager,
+		"GNMI":    &Metadata{Target: target},
+	})
+}
+
+// updatePort merges the state of an interface into its node, the leaves
+// not part of the notification being kept untouched
+func (p *Probe) updatePort(target string, device *graph.Node, state *ifaceState, timestamp int64) {
+	id := portID(target, state.name)
+
+	node := p.graph.GetNode(id)
+	if node == nil {
+		var err error
+		if node, err = p.graph.NewNode(id, graph.Metadata{
+			"Type":    "switchport",
+			"Name":    state.name,
+			"Manager": Manager,
+			"Probe":   Manager,
+			"GNMI":    &Metadata{Target: target},
+		}); err != nil {
+			logging.GetLogger().Error(err)
+			return
+		}
+		topology.AddOwnershipLink(p.graph, device, node, nil)
+	}
+
+	tr := p.graph.StartMetadataTransaction(node)
+	for k, v := range state.metadata {
+		tr.AddMetadata(k, v)
+	}
+
+	m := &Metadata{Target: target}
+	if field, err := node.GetField("GNMI"); err == nil {
+		if prev, ok := field.(*Metadata); ok {
+			*m = *prev
+		}
+	}
+	if state.gnmi.AdminStatus != "" {
+		m.AdminStatus = state.gnmi.AdminStatus
+	}
+	if state.gnmi.Description != "" {
+		m.Description = state.gnmi.Description
+	}
+	if state.gnmi.Speed != "" {
+		m.Speed = state.gnmi.Speed
+	}
+	m.Timestamp = timestamp
+	tr.AddMetadata("GNMI", m)
+
+	if !state.metric.IsZero() {
+		metric := state.metric
+		if field, err := node.GetField("Metric"); err == nil {
+			prevMetric := field.(*topology.InterfaceMetric)
+
+			// counters are usually streamed one by one, so the ones missing
+			// from the notification keep their previous value
+			merged := *prevMetric
+			for _, counter := range []struct{ dst, src *int64 }{
+				{&merged.RxBytes, &metric.RxBytes}, {&merged.RxPackets, &metric.RxPackets},
+				{&merged.RxErrors, &metric.RxErrors}, {&merged.RxDropped, &metric.RxDropped},
+				{&merged.Multicast, &metric.Multicast}, {&merged.TxBytes, &metric.TxBytes},
+				{&merged.TxPackets, &metric.TxPackets}, {&merged.TxErrors, &metric.TxErrors},
+				{&merged.TxDropped, &metric.TxDropped},
+			} {
+				if *counter.src != 0 {
+					*counter.dst = *counter.src
+				}
+			}
+			metric = &merged
+
+			if lastUpdateMetric := metric.Sub(prevMetric).(*topology.InterfaceMetric); !lastUpdateMetric.IsZero() {
+				lastUpdateMetric.Start = prevMetric.Last
+				lastUpdateMetric.Last = timestamp
+				tr.AddMetadata("LastUpdateMetric", lastUpdateMetric)
+			}
+		}
+		metric.Last = timestamp
+		tr.AddMetadata("Metric", metric)
+	}
+
+	tr.Commit()
+}
+
+func (p *Probe) handleNotification(target string, n *gpb.Notification) {
+	states, deleted, hostname := parseNotification(n)
+
+	// gNMI timestamps are expressed in nanoseconds
+	timestamp := n.GetTimestamp() / int64(time.Millisecond)
+	if timestamp == 0 {
+		timestamp = int64(common.UnixMillis(time.Now()))
+	}
+
+	p.graph.Lock()
+	defer p.graph.Unlock()
+
+	device, err := p.getOrCreateDevice(target)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		return
+	}
+
+	if hostname != "" {
+		p.graph.AddMetadata(device, "Name", hostname)
+	}
+
+	for _, state := range states {
+		p.updatePort(target, device, state, timestamp)
+	}
+
+	for _, name := range deleted {
+		if node := p.graph.GetNode(portID(target, name)); node != nil {
+			if err := p.graph.DelNode(node); err != nil {
+				logging.GetLogger().Error(err)
+			}
+		}
+	}
+}
+
+func (p *Probe) subscribeRequest() *gpb.SubscribeRequest {
+	var subscriptions []*gpb.Subscription
+	for _, path := range [][]*gpb.PathElem{
+		{{Name: "interfaces"}, {Name: "interface"}, {Name: "state"}},
+		{{Name: "interfaces"}, {Name: "interface"}, {Name: "ethernet"}, {Name: "state"}},
+		{{Name: "system"}, {Name: "state"}, {Name: "hostname"}},
+	} {
+		subscriptions = append(subscriptions, &gpb.Subscription{
+			Path:           &gpb.Path{Elem: path},
+			Mode:           gpb.SubscriptionMode_SAMPLE,
+			SampleInterval: uint64(p.sampleInterval.Nanoseconds()),
+		})
+	}
+
+	return &gpb.SubscribeRequest{
+		Request: &gpb.SubscribeRequest_Subscribe{
+			Subscribe: &gpb.SubscriptionList{
+				Mode:         gpb.SubscriptionList_STREAM,
+				Encoding:     gpb.Encoding_JSON_IETF,
+				Subscription: subscriptions,
+			},
+		},
+	}
+}
+
+func (p *Probe) subscribe(ctx context.Context, target string) error {
+	opts := []grpc.DialOption{grpc.WithBlock()}
+	if p.tls {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: p.insecure})))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, retryInterval)
+	conn, err := grpc.DialContext(dialCtx, target, opts...)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to connect: %s", err)
+	}
+	defer conn.Close()
+
+	if p.username != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "username", p.username, "password", p.password)
+	}
+
+	stream, err := gpb.NewGNMIClient(conn).Subscribe(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe: %s", err)
+	}
+
+	if err := stream.Send(p.subscribeRequest()); err != nil {
+		return fmt.Errorf("failed to send subscription: %s", err)
+	}
+
+	logging.GetLogger().Infof("Subscribed to gNMI target %s", target)
+
+	for {
+		response, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		if update := response.GetUpdate(); update != nil {
+			p.handleNotification(target, update)
+		}
+	}
+}
+
+// Do subscribes to the telemetry of the targets, reconnecting on failure
+func (p *Probe) Do(ctx context.Context, wg *sync.WaitGroup) error {
+	for _, target := range p.targets {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+
+			for {
+				if err := p.subscribe(ctx, target); err != nil && ctx.Err() == nil {
+					logging.GetLogger().Errorf("gNMI subscription to %s failed: %s", target, err)
+				}
+
+				select {
+				case <-time.After(retryInterval):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(target)
+	}
+
+	return nil
+}
+
+// NewProbe returns a new gNMI topology probe
+func NewProbe(g *graph.Graph) (probe.Handler, error) {
+	p := &Probe{
+		graph:          g,
+		targets:        config.GetStringSlice("analyzer.topology.gnmi.targets"),
+		username:       config.GetString("analyzer.topology.gnmi.username"),
+		password:       config.GetString("analyzer.topology.gnmi.password"),
+		tls:            config.GetBool("analyzer.topology.gnmi.tls"),
+		insecure:       config.GetBool("analyzer.topology.gnmi.insecure"),
+		sampleInterval: time.Duration(config.GetInt("analyzer.topology.gnmi.sample_interval")) * time.Second,
+	}
+	p.ProbeWrapper = tp.NewProbeWrapper(p)
+
+	return p, nil
+}
+
+// Register registers graph metadata decoders
+func Register() {
+	graph.NodeMetadataDecoders["GNMI"] = MetadataDecoder
+}
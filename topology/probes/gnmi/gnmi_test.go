@@ -0,0 +1,72 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gnmi
+
+import (
+	"testing"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+func interfacePath(name string, leaf ...string) *gpb.Path {
+	path := &gpb.Path{Elem: []*gpb.PathElem{{Name: "interface", Key: map[string]string{"name": name}}}}
+	for _, elem := range leaf {
+		path.Elem = append(path.Elem, &gpb.PathElem{Name: elem})
+	}
+	return path
+}
+
+func TestParseNotification(t *testing.T) {
+	n := &gpb.Notification{
+		Prefix: &gpb.Path{Elem: []*gpb.PathElem{{Name: "interfaces"}}},
+		Update: []*gpb.Update{
+			{Path: interfacePath("Ethernet1", "state", "oper-status"), Val: &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: "UP"}}},
+			{Path: interfacePath("Ethernet1", "state", "mtu"), Val: &gpb.TypedValue{Value: &gpb.TypedValue_UintVal{UintVal: 9000}}},
+			{Path: interfacePath("Ethernet1", "state", "counters", "in-octets"), Val: &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: []byte(`"123456"`)}}},
+			{Path: interfacePath("Ethernet1", "ethernet", "state", "port-speed"), Val: &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: "openconfig-if-ethernet:SPEED_10GB"}}},
+			{Path: interfacePath("Ethernet2", "state", "oper-status"), Val: &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: "LOWER_LAYER_DOWN"}}},
+		},
+		Delete: []*gpb.Path{interfacePath("Ethernet3")},
+	}
+
+	states, deleted, _ := parseNotification(n)
+	if len(states) != 2 {
+		t.Fatalf("Expected 2 interfaces, got: %d", len(states))
+	}
+
+	eth1 := states["Ethernet1"]
+	if eth1.metadata["State"] != "UP" || eth1.metadata["MTU"] != int64(9000) {
+		t.Errorf("Wrong Ethernet1 metadata: %+v", eth1.metadata)
+	}
+
+	if eth1.metric.RxBytes != 123456 {
+		t.Errorf("Wrong Ethernet1 counters: %+v", eth1.metric)
+	}
+
+	if eth1.gnmi.Speed != "SPEED_10GB" {
+		t.Errorf("Wrong Ethernet1 speed: %s", eth1.gnmi.Speed)
+	}
+
+	if states["Ethernet2"].metadata["State"] != "DOWN" {
+		t.Errorf("Wrong Ethernet2 metadata: %+v", states["Ethernet2"].metadata)
+	}
+
+	if len(deleted) != 1 || deleted[0] != "Ethernet3" {
+		t.Errorf("Expected Ethernet3 to be deleted, got: %v", deleted)
+	}
+}
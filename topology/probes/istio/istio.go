@@ -57,6 +57,7 @@ func NewIstioProbe(g *graph.Graph) (*k8s.Probe, error) {
 
 	verifierHandlers := []verifierHandler{
 		newVirtualServiceGatewayVerifier,
+		newSidecarVerifier,
 	}
 
 	verifiers := initResourceVerifiers(verifierHandlers, g)
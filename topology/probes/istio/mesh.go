@@ -0,0 +1,232 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package istio
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology/probes/k8s"
+
+	models "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	sidecarContainerName = "istio-proxy"
+	maxCorrelatedFlows   = 100000
+
+	// AnomalyNoSidecar is reported when only one of the peers of a flow
+	// has an Envoy sidecar, its traffic bypassing the mesh
+	AnomalyNoSidecar = "nosidecar"
+	// AnomalyUnrouted is reported when a flow reaches a version of an
+	// application that none of the virtual services routes to
+	AnomalyUnrouted = "unrouted"
+)
+
+// getSidecar returns the Envoy sidecar container of a pod
+func getSidecar(pod *v1.Pod) *v1.Container {
+	for i, container := range pod.Spec.Containers {
+		if container.Name == sidecarContainerName {
+			return &pod.Spec.Containers[i]
+		}
+	}
+	return nil
+}
+
+func sidecarReady(pod *v1.Pod) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == sidecarContainerName {
+			return status.Ready
+		}
+	}
+	return false
+}
+
+func getPodCache() *k8s.ResourceCache {
+	if cache := k8s.GetSubprobe(k8s.Manager, "pod"); cache != nil {
+		return cache.(*k8s.ResourceCache)
+	}
+	return nil
+}
+
+// findSidecars reports the Envoy sidecar of the pods in their Istio metadata
+func findSidecars(g *graph.Graph) {
+	podCache := getPodCache()
+	if podCache == nil {
+		return
+	}
+
+	for _, obj := range podCache.List() {
+		pod := obj.(*v1.Pod)
+
+		podNode := g.GetNode(graph.Identifier(pod.GetUID()))
+		if podNode == nil {
+			continue
+		}
+
+		sidecar := getSidecar(pod)
+		if sidecar == nil {
+			continue
+		}
+
+		m := map[string]interface{}{
+			"Image": sidecar.Image,
+			"Ready": sidecarReady(pod),
+		}
+
+		if current, _ := podNode.GetField(detailsField + ".Sidecar"); !reflect.DeepEqual(current, m) {
+			if err := g.AddMetadata(podNode, detailsField+".Sidecar", m); err != nil {
+				logging.GetLogger().Error(err)
+			}
+		}
+	}
+}
+
+func newSidecarVerifier(g *graph.Graph) *resourceVerifier {
+	var handlers []graph.ListenerHandler
+	if podProbe := k8s.GetSubprobe(k8s.Manager, "pod"); podProbe != nil {
+		handlers = append(handlers, podProbe)
+	}
+	return newResourceVerifier(g, handlers, findSidecars)
+}
+
+// MeshVerifier correlates the flows between pods with the mesh routes and
+// links the pods whose traffic does not go through the mesh as expected
+type MeshVerifier struct {
+	sync.Mutex
+	graph *graph.Graph
+	seen  map[string]bool
+}
+
+// isUnrouted returns whether a virtual service of the namespace of the pod
+// has routes for its application but none of them to its version
+func isUnrouted(pod *v1.Pod) bool {
+	cache := k8s.GetSubprobe(Manager, "virtualservice")
+	if cache == nil {
+		return false
+	}
+
+	app, version := pod.Labels["app"], pod.Labels["version"]
+	if app == "" {
+		return false
+	}
+
+	routed, unrouted := false, false
+	for _, obj := range cache.(*k8s.ResourceCache).List() {
+		vs := obj.(*models.VirtualService)
+		if !k8s.MatchNamespace(vs, pod) {
+			continue
+		}
+
+		for _, im := range []instanceMap{
+			newInstanceMapFromHTTPRoutes(vs.Spec.Http),
+			newInstanceMapFromTLSRoutes(vs.Spec.Tls),
+			newInstanceMapFromTCPRoutes(vs.Spec.Tcp),
+		} {
+			if _, found := im[app]; !found {
+				continue
+			}
+			if im.has(app, version) {
+				routed = true
+			} else {
+				unrouted = true
+			}
+		}
+	}
+
+	return unrouted && !routed
+}
+
+func (m *MeshVerifier) linkAnomaly(src, dst *v1.Pod, anomaly string, f *flow.Flow) {
+	srcNode := m.graph.GetNode(graph.Identifier(src.GetUID()))
+	dstNode := m.graph.GetNode(graph.Identifier(dst.GetUID()))
+	if srcNode == nil || dstNode == nil {
+		return
+	}
+
+	id := graph.GenID(string(srcNode.ID), string(dstNode.ID), "RelationType", "meshanomaly", anomaly)
+	if m.graph.GetEdge(id) != nil {
+		return
+	}
+
+	logging.GetLogger().Infof("Mesh anomaly %s for flow %s between pods %s/%s and %s/%s", anomaly, f.UUID, src.Namespace, src.Name, dst.Namespace, dst.Name)
+
+	metadata := k8s.NewEdgeMetadata(Manager, "meshanomaly")
+	metadata["Anomaly"] = anomaly
+	metadata["TrackingID"] = f.TrackingID
+	if _, err := m.graph.NewEdge(id, srcNode, dstNode, metadata); err != nil {
+		logging.GetLogger().Error(err)
+	}
+}
+
+// OnFlows correlates the flows between pods with the mesh routes
+func (m *MeshVerifier) OnFlows(flows []*flow.Flow) {
+	podCache := getPodCache()
+	if podCache == nil {
+		return
+	}
+
+	pods := make(map[string]*v1.Pod)
+	for _, obj := range podCache.List() {
+		if pod := obj.(*v1.Pod); pod.Status.PodIP != "" && !pod.Spec.HostNetwork {
+			pods[pod.Status.PodIP] = pod
+		}
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.graph.Lock()
+	defer m.graph.Unlock()
+
+	for _, f := range flows {
+		if f.Network == nil || m.seen[f.TrackingID] {
+			continue
+		}
+
+		src, dst := pods[f.Network.A], pods[f.Network.B]
+		if src == nil || dst == nil {
+			continue
+		}
+
+		if len(m.seen) >= maxCorrelatedFlows {
+			m.seen = make(map[string]bool)
+		}
+		m.seen[f.TrackingID] = true
+
+		if (getSidecar(src) == nil) != (getSidecar(dst) == nil) {
+			m.linkAnomaly(src, dst, AnomalyNoSidecar, f)
+		}
+
+		if isUnrouted(dst) {
+			m.linkAnomaly(src, dst, AnomalyUnrouted, f)
+		}
+	}
+}
+
+// NewMeshVerifier returns a new verifier of the flows going through the mesh
+func NewMeshVerifier(g *graph.Graph) *MeshVerifier {
+	return &MeshVerifier{
+		graph: g,
+		seen:  make(map[string]bool),
+	}
+}
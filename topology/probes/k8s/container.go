@@ -34,6 +34,9 @@ const (
 	dockerContainerNameField = "Docker.Labels.io.kubernetes.container.name"
 	dockerPodNameField       = "Docker.Labels.io.kubernetes.pod.name"
 	dockerPodNamespaceField  = "Docker.Labels.io.kubernetes.pod.namespace"
+	criContainerNameField    = "CRI.ContainerName"
+	criPodNameField          = "CRI.PodName"
+	criPodNamespaceField     = "CRI.PodNamespace"
 )
 
 type containerProbe struct {
@@ -161,7 +164,20 @@ func newDockerIndexer(g *graph.Graph) *graph.MetadataIndexer {
 	return graph.NewMetadataIndexer(g, g, m, dockerPodNamespaceField, dockerPodNameField, dockerContainerNameField)
 }
 
-func newContainerDockerLinker(g *graph.Graph) probe.Handler {
+// newRuntimeIndexer indexes the containers reported by a CRI runtime probe
+// by pod namespace, pod name and container name
+func newRuntimeIndexer(g *graph.Graph) *graph.MetadataIndexer {
+	m := graph.NewElementFilter(filters.NewAndFilter(
+		filters.NewTermStringFilter("Type", "container"),
+		filters.NewNotNullFilter(criPodNamespaceField),
+		filters.NewNotNullFilter(criPodNameField),
+		filters.NewNotNullFilter(criContainerNameField),
+	))
+
+	return graph.NewMetadataIndexer(g, g, m, criPodNamespaceField, criPodNameField, criContainerNameField)
+}
+
+func newContainerRuntimeLinker(g *graph.Graph, runtimeIndexer *graph.MetadataIndexer) probe.Handler {
 	containerProbe := GetSubprobe(Manager, "container")
 	if containerProbe == nil {
 		return nil
@@ -171,10 +187,9 @@ func newContainerDockerLinker(g *graph.Graph) probe.Handler {
 	containerIndexer := newObjectIndexerFromFilter(g, containerProbe, containerFilter, MetadataFields("Namespace", "Pod", "Name")...)
 	containerIndexer.Start()
 
-	dockerIndexer := newDockerIndexer(g)
-	dockerIndexer.Start()
+	runtimeIndexer.Start()
 
-	ml := graph.NewMetadataIndexerLinker(g, containerIndexer, dockerIndexer, NewEdgeMetadata(Manager, "container"))
+	ml := graph.NewMetadataIndexerLinker(g, containerIndexer, runtimeIndexer, NewEdgeMetadata(Manager, "container"))
 
 	linker := &Linker{
 		ResourceLinker: ml.ResourceLinker,
@@ -183,3 +198,11 @@ func newContainerDockerLinker(g *graph.Graph) probe.Handler {
 
 	return linker
 }
+
+func newContainerDockerLinker(g *graph.Graph) probe.Handler {
+	return newContainerRuntimeLinker(g, newDockerIndexer(g))
+}
+
+func newContainerCRILinker(g *graph.Graph) probe.Handler {
+	return newContainerRuntimeLinker(g, newRuntimeIndexer(g))
+}
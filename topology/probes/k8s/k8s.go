@@ -110,6 +110,7 @@ func NewK8sProbe(g *graph.Graph) (*Probe, error) {
 
 	linkerHandlers := []LinkHandler{
 		newContainerDockerLinker,
+		newContainerCRILinker,
 		newDeploymentPodLinker,
 		newDeploymentReplicaSetLinker,
 		newPodContainerLinker,
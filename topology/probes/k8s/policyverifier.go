@@ -0,0 +1,395 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/alert"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	maxPolicyViolations = 100
+	maxVerifiedFlows    = 100000
+)
+
+// PolicyViolation describes a flow that should have been denied by the
+// network policies
+type PolicyViolation struct {
+	FlowUUID   string
+	TrackingID string
+	Src        string
+	Dst        string
+	Protocol   string
+	Port       int64
+	PolicyType string
+	Last       int64
+}
+
+// PolicyPath describes a pair of pods allowed to communicate by a network policy
+type PolicyPath struct {
+	Policy     string
+	PolicyType string
+	Src        string
+	Dst        string
+}
+
+// PolicyVerification reports the flows denied by the network policies and
+// the allowed paths over which no flow was observed
+// swagger:model NetworkPolicyVerification
+type PolicyVerification struct {
+	Violations []*PolicyViolation
+	Unused     []*PolicyPath
+}
+
+type podPair struct {
+	src, dst string
+}
+
+// PolicyVerifier matches the flows received by the analyzer against the
+// Kubernetes network policies
+type PolicyVerifier struct {
+	sync.RWMutex
+	pool       ws.StructSpeakerPool
+	violations []*PolicyViolation
+	observed   map[podPair]bool
+	seen       map[string]bool
+}
+
+func podName(pod metav1.Object) string {
+	return pod.GetNamespace() + "/" + pod.GetName()
+}
+
+func getCache(name string) *ResourceCache {
+	if subprobe := GetSubprobe(Manager, name); subprobe != nil {
+		return subprobe.(*ResourceCache)
+	}
+	return nil
+}
+
+// selectsPod returns whether the network policy applies to the pod
+func selectsPod(np *v1beta1.NetworkPolicy, pod *corev1.Pod) bool {
+	return np.Namespace == pod.Namespace && matchLabelSelector(pod, &np.Spec.PodSelector)
+}
+
+func matchPeer(peer v1beta1.NetworkPolicyPeer, policyNamespace string, pod *corev1.Pod, ip string, namespaces []interface{}) bool {
+	if peer.IPBlock != nil {
+		_, cidr, err := net.ParseCIDR(peer.IPBlock.CIDR)
+		if err != nil || !cidr.Contains(net.ParseIP(ip)) {
+			return false
+		}
+		for _, except := range peer.IPBlock.Except {
+			if _, cidr, err := net.ParseCIDR(except); err == nil && cidr.Contains(net.ParseIP(ip)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if pod == nil {
+		return false
+	}
+
+	if peer.NamespaceSelector == nil {
+		if pod.Namespace != policyNamespace {
+			return false
+		}
+	} else {
+		matched := false
+		for _, ns := range filterObjectsBySelector(namespaces, peer.NamespaceSelector) {
+			if ns.GetName() == pod.Namespace {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return peer.PodSelector == nil || matchLabelSelector(pod, peer.PodSelector)
+}
+
+// matchPorts returns whether the rule ports match the protocol and port of
+// the flow, named ports being resolved using the destination pod. As the
+// ports only apply to TCP, UDP and SCTP, the flows of other protocols, ICMP
+// for instance, only match the rules without ports.
+func matchPorts(ports []v1beta1.NetworkPolicyPort, protocol string, port int64, dst *corev1.Pod) bool {
+	if len(ports) == 0 {
+		return true
+	}
+
+	for _, p := range ports {
+		proto := string(corev1.ProtocolTCP)
+		if p.Protocol != nil {
+			proto = string(*p.Protocol)
+		}
+		if proto != protocol {
+			continue
+		}
+
+		if p.Port == nil {
+			return true
+		}
+
+		if p.Port.Type == intstr.Int {
+			if int64(p.Port.IntVal) == port {
+				return true
+			}
+			continue
+		}
+
+		if dst == nil {
+			continue
+		}
+		for _, container := range dst.Spec.Containers {
+			for _, cp := range container.Ports {
+				if cp.Name == p.Port.StrVal && int64(cp.ContainerPort) == port {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// flowProtocol returns the protocol and the destination port of a flow, the
+// flows without transport layer having no port
+func flowProtocol(f *flow.Flow) (string, int64) {
+	switch {
+	case f.Transport != nil:
+		return f.Transport.Protocol.String(), f.Transport.B
+	case f.ICMP != nil && f.Network.Protocol == flow.FlowProtocol_IPV6:
+		return flow.FlowProtocol_ICMPV6.String(), 0
+	case f.ICMP != nil:
+		return flow.FlowProtocol_ICMPV4.String(), 0
+	}
+	return f.Network.Protocol.String(), 0
+}
+
+// allowed returns whether the policies of the given type allow the flow
+func allowed(policies []interface{}, namespaces []interface{}, ty PolicyType, src, dst *corev1.Pod, srcIP, dstIP, protocol string, port int64) bool {
+	target, peerPod, peerIP := src, dst, dstIP
+	if ty == PolicyTypeIngress {
+		target, peerPod, peerIP = dst, src, srcIP
+	}
+
+	isolated := false
+	for _, obj := range policies {
+		np := obj.(*v1beta1.NetworkPolicy)
+		if !selectsPod(np, target) {
+			continue
+		}
+
+		if ty == PolicyTypeIngress && isIngress(np) {
+			isolated = true
+			for _, rule := range np.Spec.Ingress {
+				if !matchPorts(rule.Ports, protocol, port, dst) {
+					continue
+				}
+				if len(rule.From) == 0 {
+					return true
+				}
+				for _, peer := range rule.From {
+					if matchPeer(peer, np.Namespace, peerPod, peerIP, namespaces) {
+						return true
+					}
+				}
+			}
+		}
+
+		if ty == PolicyTypeEgress && isEgress(np) {
+			isolated = true
+			for _, rule := range np.Spec.Egress {
+				if !matchPorts(rule.Ports, protocol, port, dst) {
+					continue
+				}
+				if len(rule.To) == 0 {
+					return true
+				}
+				for _, peer := range rule.To {
+					if matchPeer(peer, np.Namespace, peerPod, peerIP, namespaces) {
+						return true
+					}
+				}
+			}
+		}
+	}
+
+	return !isolated
+}
+
+func (v *PolicyVerifier) addViolation(violation *PolicyViolation) {
+	v.violations = append(v.violations, violation)
+	if len(v.violations) > maxPolicyViolations {
+		v.violations = v.violations[len(v.violations)-maxPolicyViolations:]
+	}
+
+	logging.GetLogger().Infof("Flow %s from %s to %s %s/%d denied by %s network policies", violation.FlowUUID, violation.Src, violation.Dst, violation.Protocol, violation.Port, violation.PolicyType)
+
+	msg := alert.Message{
+		UUID:       "networkpolicy/" + violation.TrackingID,
+		Timestamp:  time.Now().UTC(),
+		ReasonData: violation,
+	}
+	v.pool.BroadcastMessage(ws.NewStructMessage(alert.Namespace, "Alert", msg))
+}
+
+// OnFlows verifies the flows against the network policies
+func (v *PolicyVerifier) OnFlows(flows []*flow.Flow) {
+	npCache, podCache, namespaceCache := getCache("networkpolicy"), getCache("pod"), getCache("namespace")
+	if npCache == nil || podCache == nil || namespaceCache == nil {
+		return
+	}
+
+	pods := make(map[string]*corev1.Pod)
+	for _, obj := range podCache.List() {
+		if pod := obj.(*corev1.Pod); pod.Status.PodIP != "" && !pod.Spec.HostNetwork {
+			pods[pod.Status.PodIP] = pod
+		}
+	}
+	policies, namespaces := npCache.List(), namespaceCache.List()
+
+	v.Lock()
+	defer v.Unlock()
+
+	for _, f := range flows {
+		if f.Network == nil || v.seen[f.TrackingID] {
+			continue
+		}
+
+		src, dst := pods[f.Network.A], pods[f.Network.B]
+		if src == nil && dst == nil {
+			continue
+		}
+
+		if len(v.seen) >= maxVerifiedFlows {
+			v.seen = make(map[string]bool)
+		}
+		v.seen[f.TrackingID] = true
+
+		protocol, port := flowProtocol(f)
+
+		violation := &PolicyViolation{
+			FlowUUID:   f.UUID,
+			TrackingID: f.TrackingID,
+			Src:        f.Network.A,
+			Dst:        f.Network.B,
+			Protocol:   protocol,
+			Port:       port,
+			Last:       f.Last,
+		}
+		if src != nil {
+			violation.Src = podName(src)
+		}
+		if dst != nil {
+			violation.Dst = podName(dst)
+		}
+
+		if src != nil && !allowed(policies, namespaces, PolicyTypeEgress, src, dst, f.Network.A, f.Network.B, protocol, port) {
+			violation.PolicyType = PolicyTypeEgress.String()
+			v.addViolation(violation)
+			continue
+		}
+
+		if dst != nil && !allowed(policies, namespaces, PolicyTypeIngress, src, dst, f.Network.A, f.Network.B, protocol, port) {
+			violation.PolicyType = PolicyTypeIngress.String()
+			v.addViolation(violation)
+			continue
+		}
+
+		if src != nil && dst != nil {
+			v.observed[podPair{src: podName(src), dst: podName(dst)}] = true
+		}
+	}
+}
+
+// GetVerification returns the last flows denied by the network policies and
+// the allowed paths over which no flow was observed
+func (v *PolicyVerifier) GetVerification() (interface{}, error) {
+	npCache, podCache, namespaceCache := getCache("networkpolicy"), getCache("pod"), getCache("namespace")
+	if npCache == nil || podCache == nil || namespaceCache == nil {
+		return nil, fmt.Errorf("Kubernetes network policies are not monitored")
+	}
+
+	npl := &networkPolicyLinker{
+		npCache:        npCache,
+		podCache:       podCache,
+		namespaceCache: namespaceCache,
+	}
+
+	v.RLock()
+	defer v.RUnlock()
+
+	verification := &PolicyVerification{
+		Violations: append([]*PolicyViolation{}, v.violations...),
+		Unused:     []*PolicyPath{},
+	}
+
+	for _, obj := range npCache.List() {
+		np := obj.(*v1beta1.NetworkPolicy)
+		selected := filterObjectsBySelector(podCache.List(), &np.Spec.PodSelector, np.Namespace)
+
+		addUnused := func(ty PolicyType, src, dst metav1.Object) {
+			if !v.observed[podPair{src: podName(src), dst: podName(dst)}] {
+				verification.Unused = append(verification.Unused, &PolicyPath{
+					Policy:     podName(np),
+					PolicyType: ty.String(),
+					Src:        podName(src),
+					Dst:        podName(dst),
+				})
+			}
+		}
+
+		for _, pod := range selected {
+			if isIngress(np) {
+				for _, peer := range npl.getIngressAllow(np) {
+					addUnused(PolicyTypeIngress, peer, pod)
+				}
+			}
+			if isEgress(np) {
+				for _, peer := range npl.getEgressAllow(np) {
+					addUnused(PolicyTypeEgress, pod, peer)
+				}
+			}
+		}
+	}
+
+	return verification, nil
+}
+
+// NewPolicyVerifier returns a new network policy verifier
+func NewPolicyVerifier(pool ws.StructSpeakerPool) *PolicyVerifier {
+	return &PolicyVerifier{
+		pool:     pool,
+		observed: make(map[podPair]bool),
+		seen:     make(map[string]bool),
+	}
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/flow"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func newTestPod(namespace, name string, labels map[string]string, ports ...corev1.ContainerPort) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: name, Ports: ports}}},
+	}
+}
+
+func newTestNamespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func newPolicyPort(protocol corev1.Protocol, port *intstr.IntOrString) v1beta1.NetworkPolicyPort {
+	p := v1beta1.NetworkPolicyPort{Port: port}
+	if protocol != "" {
+		p.Protocol = &protocol
+	}
+	return p
+}
+
+func intPort(port int) *intstr.IntOrString {
+	p := intstr.FromInt(port)
+	return &p
+}
+
+func namedPort(name string) *intstr.IntOrString {
+	p := intstr.FromString(name)
+	return &p
+}
+
+func TestMatchPorts(t *testing.T) {
+	db := newTestPod("default", "db", nil, corev1.ContainerPort{Name: "pgsql", ContainerPort: 5432})
+
+	tests := []struct {
+		name     string
+		ports    []v1beta1.NetworkPolicyPort
+		protocol string
+		port     int64
+		dst      *corev1.Pod
+		expected bool
+	}{
+		{"no port", nil, "TCP", 80, db, true},
+		{"no port icmp", nil, "ICMPV4", 0, db, true},
+		{"port", []v1beta1.NetworkPolicyPort{newPolicyPort("", intPort(80))}, "TCP", 80, db, true},
+		{"other port", []v1beta1.NetworkPolicyPort{newPolicyPort("", intPort(80))}, "TCP", 81, db, false},
+		{"tcp by default", []v1beta1.NetworkPolicyPort{newPolicyPort("", intPort(80))}, "UDP", 80, db, false},
+		{"icmp with port", []v1beta1.NetworkPolicyPort{newPolicyPort("", intPort(80))}, "ICMPV4", 0, db, false},
+		{"protocol only", []v1beta1.NetworkPolicyPort{newPolicyPort(corev1.ProtocolUDP, nil)}, "UDP", 53, db, true},
+		{"other protocol", []v1beta1.NetworkPolicyPort{newPolicyPort(corev1.ProtocolUDP, nil)}, "TCP", 53, db, false},
+		{"icmp with protocol", []v1beta1.NetworkPolicyPort{newPolicyPort(corev1.ProtocolTCP, nil)}, "ICMPV6", 0, db, false},
+		{"named port", []v1beta1.NetworkPolicyPort{newPolicyPort("", namedPort("pgsql"))}, "TCP", 5432, db, true},
+		{"other named port", []v1beta1.NetworkPolicyPort{newPolicyPort("", namedPort("http"))}, "TCP", 5432, db, false},
+		{"named port without pod", []v1beta1.NetworkPolicyPort{newPolicyPort("", namedPort("pgsql"))}, "TCP", 5432, nil, false},
+		{"one of the ports", []v1beta1.NetworkPolicyPort{newPolicyPort("", intPort(80)), newPolicyPort(corev1.ProtocolUDP, intPort(53))}, "UDP", 53, db, true},
+	}
+
+	for _, test := range tests {
+		if matched := matchPorts(test.ports, test.protocol, test.port, test.dst); matched != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.name, test.expected, matched)
+		}
+	}
+}
+
+func TestMatchPeer(t *testing.T) {
+	namespaces := []interface{}{
+		newTestNamespace("default", nil),
+		newTestNamespace("front", map[string]string{"team": "web"}),
+	}
+
+	web := newTestPod("default", "web", map[string]string{"app": "web"})
+	front := newTestPod("front", "web", map[string]string{"app": "web"})
+	other := newTestPod("default", "other", map[string]string{"app": "other"})
+
+	ipBlock := v1beta1.NetworkPolicyPeer{IPBlock: &v1beta1.IPBlock{CIDR: "10.0.0.0/24", Except: []string{"10.0.0.128/25"}}}
+	webPods := v1beta1.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}}
+	webNamespaces := v1beta1.NetworkPolicyPeer{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "web"}}}
+	webPodsOfWebNamespaces := v1beta1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "web"}},
+		PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+	}
+
+	tests := []struct {
+		name     string
+		peer     v1beta1.NetworkPolicyPeer
+		pod      *corev1.Pod
+		ip       string
+		expected bool
+	}{
+		{"ip block", ipBlock, nil, "10.0.0.1", true},
+		{"ip block except", ipBlock, nil, "10.0.0.200", false},
+		{"outside ip block", ipBlock, nil, "10.0.1.1", false},
+		{"ip block ignores pods", ipBlock, web, "10.0.1.1", false},
+		{"pod selector", webPods, web, "10.0.0.1", true},
+		{"pod selector other labels", webPods, other, "10.0.0.1", false},
+		{"pod selector other namespace", webPods, front, "10.0.0.1", false},
+		{"pod selector without pod", webPods, nil, "10.0.0.1", false},
+		{"namespace selector", webNamespaces, front, "10.0.0.1", true},
+		{"namespace selector other namespace", webNamespaces, web, "10.0.0.1", false},
+		{"both selectors", webPodsOfWebNamespaces, front, "10.0.0.1", true},
+		{"both selectors other namespace", webPodsOfWebNamespaces, web, "10.0.0.1", false},
+	}
+
+	for _, test := range tests {
+		if matched := matchPeer(test.peer, "default", test.pod, test.ip, namespaces); matched != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.name, test.expected, matched)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	namespaces := []interface{}{newTestNamespace("default", nil)}
+
+	web := newTestPod("default", "web", map[string]string{"app": "web"})
+	db := newTestPod("default", "db", map[string]string{"app": "db"})
+	other := newTestPod("default", "other", map[string]string{"app": "other"})
+
+	// the database only accepts PostgreSQL connections from the web pods
+	dbIngress := &v1beta1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db"},
+		Spec: v1beta1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+			Ingress: []v1beta1.NetworkPolicyIngressRule{{
+				Ports: []v1beta1.NetworkPolicyPort{newPolicyPort("", intPort(5432))},
+				From:  []v1beta1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}}},
+			}},
+		},
+	}
+
+	// the database accepts any protocol from the web pods
+	dbAnyIngress := &v1beta1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db-any"},
+		Spec: v1beta1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+			Ingress: []v1beta1.NetworkPolicyIngressRule{{
+				From: []v1beta1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}}},
+			}},
+		},
+	}
+
+	// the web pods can't initiate any connection
+	webEgress := &v1beta1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec: v1beta1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			PolicyTypes: []v1beta1.PolicyType{v1beta1.PolicyTypeEgress},
+		},
+	}
+
+	// a policy of another namespace
+	otherNamespace := &v1beta1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "db"},
+		Spec: v1beta1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		policies []interface{}
+		ty       PolicyType
+		src, dst *corev1.Pod
+		protocol string
+		port     int64
+		expected bool
+	}{
+		{"no policy", nil, PolicyTypeIngress, web, db, "TCP", 5432, true},
+		{"ingress allowed", []interface{}{dbIngress}, PolicyTypeIngress, web, db, "TCP", 5432, true},
+		{"ingress other port", []interface{}{dbIngress}, PolicyTypeIngress, web, db, "TCP", 80, false},
+		{"ingress other pod", []interface{}{dbIngress}, PolicyTypeIngress, other, db, "TCP", 5432, false},
+		{"ingress icmp with ports", []interface{}{dbIngress}, PolicyTypeIngress, web, db, "ICMPV4", 0, false},
+		{"ingress icmp without ports", []interface{}{dbIngress, dbAnyIngress}, PolicyTypeIngress, web, db, "ICMPV4", 0, true},
+		{"ingress not isolated", []interface{}{dbIngress}, PolicyTypeIngress, db, web, "TCP", 80, true},
+		{"egress not isolated", []interface{}{dbIngress}, PolicyTypeEgress, web, db, "TCP", 5432, true},
+		{"egress denied", []interface{}{webEgress}, PolicyTypeEgress, web, db, "TCP", 5432, false},
+		{"egress denied icmp", []interface{}{webEgress}, PolicyTypeEgress, web, db, "ICMPV4", 0, false},
+		{"egress only", []interface{}{webEgress}, PolicyTypeIngress, other, web, "TCP", 80, true},
+		{"other namespace", []interface{}{otherNamespace}, PolicyTypeIngress, web, db, "TCP", 5432, true},
+	}
+
+	for _, test := range tests {
+		if ok := allowed(test.policies, namespaces, test.ty, test.src, test.dst, "10.0.0.1", "10.0.0.2", test.protocol, test.port); ok != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.name, test.expected, ok)
+		}
+	}
+}
+
+func TestFlowProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		flow     *flow.Flow
+		protocol string
+		port     int64
+	}{
+		{
+			"tcp",
+			&flow.Flow{
+				Network:   &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV4},
+				Transport: &flow.TransportLayer{Protocol: flow.FlowProtocol_TCP, A: 43210, B: 80},
+			},
+			"TCP", 80,
+		},
+		{
+			"icmpv4",
+			&flow.Flow{Network: &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV4}, ICMP: &flow.ICMPLayer{}},
+			"ICMPV4", 0,
+		},
+		{
+			"icmpv6",
+			&flow.Flow{Network: &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV6}, ICMP: &flow.ICMPLayer{}},
+			"ICMPV6", 0,
+		},
+		{
+			"protocol only",
+			&flow.Flow{Network: &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV4}},
+			"IPV4", 0,
+		},
+	}
+
+	for _, test := range tests {
+		if protocol, port := flowProtocol(test.flow); protocol != test.protocol || port != test.port {
+			t.Errorf("%s: expected %s/%d, got %s/%d", test.name, test.protocol, test.port, protocol, port)
+		}
+	}
+}
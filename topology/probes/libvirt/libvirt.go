@@ -24,9 +24,11 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"strings"
 	"sync"
 
+	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/probe"
 	"github.com/skydive-project/skydive/topology"
 	"github.com/skydive-project/skydive/topology/probes"
@@ -43,7 +45,7 @@ type Probe struct {
 	conn         monitor               // libvirt connection
 	interfaceMap map[string]*Interface // Found interfaces not yet connected.
 	uri          string                // uri of the libvirt connection
-	tunProcessor *graph.Processor      // metadata indexer for regular interfaces
+	tunProcessor *graph.Processor      // metadata indexer for tap, macvtap and vhost-user interfaces
 }
 
 // monitor abstracts a libvirt monitor
@@ -71,6 +73,9 @@ type Address struct {
 // Source describe the XML coding of a libvirt source
 type Source struct {
 	Address *Address `xml:"address"`
+	Device  string   `xml:"dev,attr,omitempty"`
+	Mode    string   `xml:"mode,attr,omitempty"`
+	Path    string   `xml:"path,attr,omitempty"`
 }
 
 // DomainState describes the state of a domain
@@ -223,10 +228,7 @@ func (probe *Probe) registerInterfaces(interfaces []*Interface, hostdevs []*Host
 				"Libvirt hostdev interface %d on %s", i, itf.Ctx.RootNode.Metadata["Name"])
 			itf.ProcessNode(probe.Ctx.Graph, node)
 		} else {
-			var target string
-			if itf.Target != nil {
-				target = itf.Target.Device
-			}
+			target := itf.targetName()
 			if target == "" {
 				continue
 			}
@@ -248,6 +250,45 @@ func (probe *Probe) registerInterfaces(interfaces []*Interface, hostdevs []*Host
 	}
 }
 
+// targetName returns the name of the host interface of a domain interface.
+// vhost-user interfaces usually have no target device, the port of the
+// virtual switch being named after the socket instead.
+func (itf *Interface) targetName() string {
+	if itf.Target != nil && itf.Target.Device != "" {
+		return itf.Target.Device
+	}
+	if itf.Type == "vhostuser" && itf.Source != nil && itf.Source.Path != "" {
+		return filepath.Base(itf.Source.Path)
+	}
+	return ""
+}
+
+// unregisterInterface removes the libvirt information of an interface
+// unplugged from a domain
+func (probe *Probe) unregisterInterface(domainNode *graph.Node, alias string) {
+	probe.Ctx.Graph.Lock()
+	defer probe.Ctx.Graph.Unlock()
+
+	domainName, _ := domainNode.GetFieldString("Name")
+	filter := graph.NewElementFilter(filters.NewAndFilter(
+		filters.NewTermStringFilter("Libvirt.Domain", domainName),
+		filters.NewTermStringFilter("Libvirt.Alias", alias),
+	))
+
+	for _, node := range probe.Ctx.Graph.GetNodes(filter) {
+		probe.Ctx.Logger.Debugf("Libvirt interface %s removed from %s", alias, domainName)
+
+		if err := probe.Ctx.Graph.DelMetadata(node, "Libvirt"); err != nil {
+			probe.Ctx.Logger.Error(err)
+		}
+		if edge := probe.Ctx.Graph.GetFirstLink(node, domainNode, graph.Metadata{"RelationType": "vlayer2"}); edge != nil {
+			if err := probe.Ctx.Graph.DelEdge(edge); err != nil {
+				probe.Ctx.Logger.Error(err)
+			}
+		}
+	}
+}
+
 func formatPciAddress(address *Address) string {
 	return fmt.Sprintf(
 		"%s:%s:%s.%s",
@@ -268,11 +309,16 @@ func (itf *Interface) ProcessNode(g *graph.Graph, node *graph.Node) bool {
 	address := itf.Address
 	formatted := formatPciAddress(&address)
 	metadata := Metadata{
-		MAC:     itf.Mac.Address,
 		Domain:  itf.Ctx.RootNode.Metadata["Name"].(string),
 		BusType: address.Type,
 		BusInfo: formatted,
 		Alias:   alias,
+		Type:    itf.Type,
+	}
+	if itf.Source != nil {
+		metadata.SourceDevice = itf.Source.Device
+		metadata.SourceMode = itf.Source.Mode
+		metadata.SocketPath = itf.Source.Path
 	}
 
 	tr := g.StartMetadataTransaction(node)
@@ -407,12 +453,23 @@ func (probe *Probe) Do(ctx context.Context, wg *sync.WaitGroup) error {
 	return nil
 }
 
+// newInterfaceFilter matches the host interfaces that may back a domain
+// interface, tap devices, macvtap devices or vhost-user ports
+func newInterfaceFilter() *graph.ElementFilter {
+	return graph.NewElementFilter(filters.NewOrFilter(
+		filters.NewTermStringFilter("Type", "tun"),
+		filters.NewTermStringFilter("Type", "macvtap"),
+		filters.NewTermStringFilter("Type", "dpdkvhostuser"),
+		filters.NewTermStringFilter("Type", "dpdkvhostuserclient"),
+	))
+}
+
 // NewProbe returns a new topology Libvirt probe
 func NewProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
 	uri := ctx.Config.GetString("agent.topology.libvirt.url")
 	probe := &Probe{
 		Ctx:          ctx,
-		tunProcessor: graph.NewProcessor(ctx.Graph, ctx.Graph, graph.Metadata{"Type": "tun"}, "Name"),
+		tunProcessor: graph.NewProcessor(ctx.Graph, ctx.Graph, newInterfaceFilter(), "Name"),
 		interfaceMap: make(map[string]*Interface),
 		uri:          uri,
 	}
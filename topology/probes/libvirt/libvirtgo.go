@@ -49,9 +49,10 @@ func (d libvirtgoDomain) GetState() (DomainState, int, error) {
 
 type LibvirtgoMonitor struct {
 	*libvirtgo.Connect
-	ctx          probes.Context
-	cidLifecycle int // libvirt callback id of monitor to unregister
-	cidDevAdded  int // second monitor on devices added to domains
+	ctx           probes.Context
+	cidLifecycle  int // libvirt callback id of monitor to unregister
+	cidDevAdded   int // second monitor on devices added to domains
+	cidDevRemoved int // third monitor on devices removed from domains
 }
 
 func (m *LibvirtgoMonitor) AllDomains() ([]domain, error) {
@@ -74,6 +75,9 @@ func (m *LibvirtgoMonitor) Stop() {
 		if err := m.DomainEventDeregister(m.cidDevAdded); err != nil {
 			m.ctx.Logger.Errorf("Problem during deregistration: %s", err)
 		}
+		if err := m.DomainEventDeregister(m.cidDevRemoved); err != nil {
+			m.ctx.Logger.Errorf("Problem during deregistration: %s", err)
+		}
 	}
 
 	if _, err := m.Close(); err != nil {
@@ -123,7 +127,7 @@ func newMonitor(ctx context.Context, probe *Probe, wg *sync.WaitGroup) (*Libvirt
 		}
 	}
 
-	monitor := &LibvirtgoMonitor{Connect: conn, cidLifecycle: -1}
+	monitor := &LibvirtgoMonitor{Connect: conn, ctx: probe.Ctx, cidLifecycle: -1}
 	if monitor.cidLifecycle, err = conn.DomainEventLifecycleRegister(nil, callback); err != nil {
 		return nil, fmt.Errorf("Could not register the lifecycle event handler %s", err)
 	}
@@ -133,6 +137,9 @@ func newMonitor(ctx context.Context, probe *Probe, wg *sync.WaitGroup) (*Libvirt
 		event *libvirtgo.DomainEventDeviceAdded,
 	) {
 		domainNode := probe.getDomain(libvirtgoDomain{*d})
+		if domainNode == nil {
+			return
+		}
 		interfaces, hostdevs := probe.getDomainInterfaces(libvirtgoDomain{*d}, domainNode, event.DevAlias)
 		probe.registerInterfaces(interfaces, hostdevs) // 0 or 1 device changed.
 	}
@@ -141,6 +148,19 @@ func newMonitor(ctx context.Context, probe *Probe, wg *sync.WaitGroup) (*Libvirt
 		return nil, fmt.Errorf("Could not register the device added event handler %s", err)
 	}
 
+	callbackDeviceRemoved := func(
+		c *libvirtgo.Connect, d *libvirtgo.Domain,
+		event *libvirtgo.DomainEventDeviceRemoved,
+	) {
+		if domainNode := probe.getDomain(libvirtgoDomain{*d}); domainNode != nil {
+			probe.unregisterInterface(domainNode, event.DevAlias)
+		}
+	}
+
+	if monitor.cidDevRemoved, err = conn.DomainEventDeviceRemovedRegister(nil, callbackDeviceRemoved); err != nil {
+		return nil, fmt.Errorf("Could not register the device removed event handler %s", err)
+	}
+
 	wg.Add(2)
 
 	disconnected := make(chan error, 1)
@@ -31,11 +31,15 @@ import (
 // easyjson:json
 // gendecoder
 type Metadata struct {
-	MAC     string `json:",omitempty"`
-	Domain  string `json:",omitempty"`
-	BusType string `json:",omitempty"`
-	BusInfo string `json:",omitempty"`
-	Alias   string `json:",omitempty"`
+	MAC          string `json:",omitempty"`
+	Domain       string `json:",omitempty"`
+	BusType      string `json:",omitempty"`
+	BusInfo      string `json:",omitempty"`
+	Alias        string `json:",omitempty"`
+	Type         string `json:",omitempty"`
+	SourceDevice string `json:",omitempty"`
+	SourceMode   string `json:",omitempty"`
+	SocketPath   string `json:",omitempty"`
 }
 
 // MetadataDecoder implements a json message raw decoder
@@ -48,18 +48,23 @@ import (
 */
 import "C"
 
+// LLDP frames are sent to one of the nearest bridge multicast addresses,
+// CDP frames are 802.3 SNAP frames sent to the Cisco multicast address
 const lldpBPFFilter = `ether[0] & 1 = 1 and
-  ether proto 0x88cc and
   !(ether src %s) and
-  (ether dst 01:80:c2:00:00:0e or
-   ether dst 01:80:c2:00:00:03 or
-   ether dst 01:80:c2:00:00:00)`
+  ((ether proto 0x88cc and
+    (ether dst 01:80:c2:00:00:0e or
+     ether dst 01:80:c2:00:00:03 or
+     ether dst 01:80:c2:00:00:00)) or
+   ether dst 01:00:0c:cc:cc:cc)`
+
+const cdpMulticastAddr = "01:00:0c:cc:cc:cc"
 
 // Capture 8192 bytes so that we have the full Ethernet frame
 const lldpSnapLen = 8192
 
 // Probe describes the probe that is in charge of listening for
-// LLDP packets on interfaces and create the corresponding chassis and port nodes
+// LLDP and CDP packets on interfaces and create the corresponding chassis and port nodes
 type Probe struct {
 	sync.RWMutex
 	graph.DefaultGraphListener
@@ -112,15 +117,15 @@ func addMulticastAddr(intf string, addr string) error {
 	return nil
 }
 
-func (p *Probe) handlePacket(n *graph.Node, ifName string, packet gopacket.Packet) {
+func bytesToString(b []byte) string {
+	return string(bytes.Trim(b, "\x00"))
+}
+
+func (p *Probe) handleLLDP(n *graph.Node, ifName string, packet gopacket.Packet) {
 	lldpLayer := packet.Layer(layers.LayerTypeLinkLayerDiscovery)
 	if lldpLayer != nil {
 		lldpLayer := lldpLayer.(*layers.LinkLayerDiscovery)
 
-		bytesToString := func(b []byte) string {
-			return string(bytes.Trim(b, "\x00"))
-		}
-
 		chassisLLDPMetadata := &Metadata{
 			ChassisIDType: lldpLayer.ChassisID.Subtype.String(),
 		}
@@ -246,9 +251,6 @@ func (p *Probe) handlePacket(n *graph.Node, ifName string, packet gopacket.Packe
 
 		// TODO: Handle TTL (set port to down when timer expires ?)
 
-		p.Ctx.Graph.Lock()
-
-		// Create a node for the sending chassis with a predictable ID
 		// Some switches - such as Cisco Nexus - sends a different chassis ID
 		// for each port, so you use SysName and MgmtAddress if present and
 		// fallback to chassis ID otherwise.
@@ -256,33 +258,113 @@ func (p *Probe) handlePacket(n *graph.Node, ifName string, packet gopacket.Packe
 			chassisDiscriminators = append(chassisDiscriminators, chassisID, lldpLayer.ChassisID.Subtype.String())
 		}
 
-		chassisNodeID := graph.GenID(chassisDiscriminators...)
-		chassis := p.getOrCreate(chassisNodeID, chassisMetadata)
+		p.addNeighbor(n, chassisDiscriminators, chassisMetadata, []string{portID, lldpLayer.PortID.Subtype.String()}, portMetadata)
+	}
+}
 
-		// Create a port with a predicatable ID
-		port := p.getOrCreate(graph.GenID(
-			string(chassisNodeID),
-			portID, lldpLayer.PortID.Subtype.String(),
-		), portMetadata)
+func (p *Probe) handleCDP(n *graph.Node, packet gopacket.Packet) {
+	cdpLayer := packet.Layer(layers.LayerTypeCiscoDiscoveryInfo)
+	if cdpLayer == nil {
+		return
+	}
+	cdpInfo := cdpLayer.(*layers.CiscoDiscoveryInfo)
 
-		if !topology.HaveOwnershipLink(p.Ctx.Graph, chassis, port) {
-			topology.AddOwnershipLink(p.Ctx.Graph, chassis, port, nil)
-			topology.AddLayer2Link(p.Ctx.Graph, chassis, port, nil)
-		}
+	deviceID := bytesToString([]byte(cdpInfo.DeviceID))
+	portID := bytesToString([]byte(cdpInfo.PortID))
+	if deviceID == "" || portID == "" {
+		return
+	}
 
-		if !topology.HaveLayer2Link(p.Ctx.Graph, port, n) {
-			topology.AddLayer2Link(p.Ctx.Graph, port, n, nil)
-		}
+	chassisCDPMetadata := &Metadata{
+		ChassisID: deviceID,
+		SysName:   deviceID,
+		Platform:  bytesToString([]byte(cdpInfo.Platform)),
+		Version:   bytesToString([]byte(cdpInfo.Version)),
+	}
+	if cdpInfo.SysName != "" {
+		chassisCDPMetadata.SysName = bytesToString([]byte(cdpInfo.SysName))
+	}
+
+	chassisMetadata := graph.Metadata{
+		"CDP":   chassisCDPMetadata,
+		"Type":  "switch",
+		"Probe": "cdp",
+		"Name":  chassisCDPMetadata.SysName,
+	}
+
+	// Use the same discriminators as LLDP so that a switch speaking both
+	// protocols is reported as a single node
+	chassisDiscriminators := []string{chassisCDPMetadata.SysName, "SysName"}
+
+	addresses := cdpInfo.MgmtAddresses
+	if len(addresses) == 0 {
+		addresses = cdpInfo.Addresses
+	}
+	if len(addresses) > 0 {
+		chassisCDPMetadata.MgmtAddress = addresses[0].String()
+		chassisDiscriminators = append(chassisDiscriminators, chassisCDPMetadata.MgmtAddress, "MgmtAddress")
+	}
+
+	portCDPMetadata := &Metadata{
+		PortID:     portID,
+		PortIDType: layers.LLDPPortIDSubtypeIfaceName.String(),
+		PVID:       int64(cdpInfo.NativeVLAN),
+	}
+	portMetadata := graph.Metadata{
+		"CDP":   portCDPMetadata,
+		"Type":  "switchport",
+		"Probe": "cdp",
+		"Name":  portID,
+	}
 
-		p.Ctx.Graph.Unlock()
+	if cdpInfo.MTU != 0 {
+		portMetadata["MTU"] = int64(cdpInfo.MTU)
+	}
+
+	p.addNeighbor(n, chassisDiscriminators, chassisMetadata, []string{portID, portCDPMetadata.PortIDType}, portMetadata)
+}
+
+// addNeighbor creates or updates the chassis and port nodes of a neighbor
+// and links the port to the interface the announce was received on
+func (p *Probe) addNeighbor(n *graph.Node, chassisDiscriminators []string, chassisMetadata graph.Metadata, portDiscriminators []string, portMetadata graph.Metadata) {
+	p.Ctx.Graph.Lock()
+	defer p.Ctx.Graph.Unlock()
+
+	// Create a node for the sending chassis with a predictable ID
+	chassisNodeID := graph.GenID(chassisDiscriminators...)
+	chassis := p.getOrCreate(chassisNodeID, chassisMetadata)
+
+	// Create a port with a predicatable ID
+	port := p.getOrCreate(graph.GenID(append([]string{string(chassisNodeID)}, portDiscriminators...)...), portMetadata)
+
+	if !topology.HaveOwnershipLink(p.Ctx.Graph, chassis, port) {
+		topology.AddOwnershipLink(p.Ctx.Graph, chassis, port, nil)
+		topology.AddLayer2Link(p.Ctx.Graph, chassis, port, nil)
+	}
+
+	if !topology.HaveLayer2Link(p.Ctx.Graph, port, n) {
+		topology.AddLayer2Link(p.Ctx.Graph, port, n, nil)
+	}
+}
+
+func (p *Probe) handlePacket(n *graph.Node, ifName string, packet gopacket.Packet) {
+	if packet.Layer(layers.LayerTypeLinkLayerDiscovery) != nil {
+		p.handleLLDP(n, ifName, packet)
+	} else {
+		p.handleCDP(n, packet)
 	}
 }
 
 func (p *Probe) startCapture(ifName, mac string, n *graph.Node) error {
 	lldpPrefix := "01:80:c2:00:00"
+	addrs := []string{cdpMulticastAddr}
 	for _, lastByte := range []byte{0x00, 0x03, 0x0e} {
+		addrs = append(addrs, fmt.Sprintf("%s:%02X", lldpPrefix, lastByte))
+	}
+
+	for _, addr := range addrs {
 		// Add multicast address so that the kernel does not discard it
-		if err := addMulticastAddr(ifName, fmt.Sprintf("%s:%02X", lldpPrefix, lastByte)); err != nil {
+		if err := addMulticastAddr(ifName, addr); err != nil {
 			return fmt.Errorf("Failed to add multicast address: %s", err)
 		}
 	}
@@ -402,7 +484,7 @@ func (p *Probe) OnNodeUpdated(n *graph.Node) {
 	}
 }
 
-// Start capturing LLDP packets
+// Start capturing LLDP and CDP packets
 func (p *Probe) Start() error {
 	if !p.state.CompareAndSwap(common.StoppedState, common.RunningState) {
 		return probe.ErrNotStopped
@@ -457,4 +539,5 @@ func NewProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
 // Register registers graph metadata decoders
 func Register() {
 	graph.NodeMetadataDecoders["LLDP"] = MetadataDecoder
+	graph.NodeMetadataDecoders["CDP"] = MetadataDecoder
 }
@@ -27,7 +27,7 @@ import (
 	"github.com/skydive-project/skydive/common"
 )
 
-// Metadata describes the LLDP chassis metadata
+// Metadata describes the LLDP or CDP chassis and port metadata
 // easyjson:json
 // gendecoder
 type Metadata struct {
@@ -44,6 +44,8 @@ type Metadata struct {
 	LinkAggregation *LinkAggregationMetadata `json:"LinkAgggregation,omitempty"`
 	VLANNames       []VLANNameMetadata       `json:"VLANNames,omitempty"`
 	PPVIDs          []PPVIDMetadata          `json:"PPVIDs,omitempty"`
+	Platform        string                   `json:"Platform,omitempty"`
+	Version         string                   `json:"Version,omitempty"`
 }
 
 // LinkAggregationMetadata describes the LLDP link aggregation metadata
@@ -72,11 +74,11 @@ type VLANNameMetadata struct {
 	Name string `json:"Name"`
 }
 
-// MetadataDecoder implements the JSON raw decoder for LLDP metadata
+// MetadataDecoder implements the JSON raw decoder for LLDP and CDP metadata
 func MetadataDecoder(raw json.RawMessage) (common.Getter, error) {
 	var metadata Metadata
 	if err := json.Unmarshal(raw, &metadata); err != nil {
-		return nil, fmt.Errorf("unable to unmarshal LLDP metadata %s: %s", string(raw), err)
+		return nil, fmt.Errorf("unable to unmarshal LLDP/CDP metadata %s: %s", string(raw), err)
 	}
 
 	return &metadata, nil
@@ -0,0 +1,94 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+// DHCPAnnotator links the DHCP transactions carried by the flows to the
+// interface of the client, found by its MAC address
+type DHCPAnnotator struct {
+	graph  *graph.Graph
+	sender flow.Sender
+}
+
+// lookupClient returns the TID of the interface holding the MAC address,
+// bridges, bonds and teams borrowing the address of one of their ports
+func (a *DHCPAnnotator) lookupClient(mac string) string {
+	var tids []string
+	for _, node := range a.graph.GetNodes(graph.Metadata{"MAC": mac}) {
+		switch ty, _ := node.GetFieldString("Type"); ty {
+		case "bridge", "ovsbridge", "openvswitch", "bond", "team":
+			continue
+		}
+		if tid, _ := node.GetFieldString("TID"); tid != "" {
+			tids = append(tids, tid)
+		}
+	}
+
+	if len(tids) == 0 {
+		return ""
+	}
+	sort.Strings(tids)
+	return tids[0]
+}
+
+func (a *DHCPAnnotator) annotate(flows []*flow.Flow) {
+	a.graph.RLock()
+	defer a.graph.RUnlock()
+
+	clients := make(map[string]string)
+	for _, f := range flows {
+		if f.DHCP == nil || f.DHCP.ClientMAC == "" {
+			continue
+		}
+
+		mac := strings.ToLower(f.DHCP.ClientMAC)
+		tid, found := clients[mac]
+		if !found {
+			tid = a.lookupClient(mac)
+			clients[mac] = tid
+		}
+		f.DHCP.ClientNodeTID = tid
+	}
+}
+
+// SendFlows annotates and forwards the flows
+func (a *DHCPAnnotator) SendFlows(flows []*flow.Flow) {
+	a.annotate(flows)
+	a.sender.SendFlows(flows)
+}
+
+// SendStats forwards the flow stats
+func (a *DHCPAnnotator) SendStats(stats flow.Stats) {
+	a.sender.SendStats(stats)
+}
+
+// NewDHCPAnnotator returns a new flow sender linking the DHCP transactions
+// to the interface of their client
+func NewDHCPAnnotator(g *graph.Graph, sender flow.Sender) *DHCPAnnotator {
+	return &DHCPAnnotator{
+		graph:  g,
+		sender: sender,
+	}
+}
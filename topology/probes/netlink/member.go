@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"sync"
+
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/topology"
+)
+
+const maxMemberFlows = 100000
+
+// MemberCorrelator attributes the flows captured on a bond, a team or
+// upstream of ECMP routes to the member interface that carried them, by
+// correlating them with the flows captured on the member interfaces
+type MemberCorrelator struct {
+	sync.Mutex
+	graph   *graph.Graph
+	sender  flow.Sender
+	members map[string]string
+}
+
+// isMember returns whether the interface is enslaved to a bond or a team, or
+// is one of the next hops of an ECMP route
+func isMember(g *graph.Graph, node *graph.Node) bool {
+	if masterIndex, err := node.GetFieldInt64("MasterIndex"); err == nil {
+		for _, parent := range g.LookupParents(node, nil, topology.OwnershipMetadata()) {
+			master := g.LookupFirstChild(parent, graph.Metadata{"IfIndex": masterIndex})
+			if master == nil {
+				continue
+			}
+			if ty, _ := master.GetFieldString("Type"); ty == "bond" || ty == "team" {
+				return true
+			}
+		}
+	}
+
+	ifIndex, err := node.GetFieldInt64("IfIndex")
+	if err != nil {
+		return false
+	}
+
+	field, err := node.GetField("RoutingTables")
+	if err != nil {
+		return false
+	}
+
+	rts, ok := field.(*topology.RoutingTables)
+	if !ok {
+		return false
+	}
+
+	for _, rt := range *rts {
+		for _, route := range rt.Routes {
+			if len(route.NextHops) < 2 {
+				continue
+			}
+			for _, nh := range route.NextHops {
+				if nh.IfIndex == ifIndex {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func (c *MemberCorrelator) correlate(flows []*flow.Flow) {
+	c.graph.RLock()
+	memberTIDs := make(map[string]bool)
+	for _, f := range flows {
+		if _, found := memberTIDs[f.NodeTID]; found || f.NodeTID == "" {
+			continue
+		}
+		node := c.graph.LookupFirstNode(graph.Metadata{"TID": f.NodeTID})
+		memberTIDs[f.NodeTID] = node != nil && isMember(c.graph, node)
+	}
+	c.graph.RUnlock()
+
+	c.Lock()
+	defer c.Unlock()
+
+	for _, f := range flows {
+		if memberTIDs[f.NodeTID] && f.L3TrackingID != "" {
+			if len(c.members) >= maxMemberFlows {
+				c.members = make(map[string]string)
+			}
+			c.members[f.L3TrackingID] = f.NodeTID
+		}
+	}
+
+	for _, f := range flows {
+		if tid, found := c.members[f.L3TrackingID]; found {
+			f.MemberNodeTID = tid
+		}
+	}
+}
+
+// SendFlows attributes the flows to their member interface and forwards them
+func (c *MemberCorrelator) SendFlows(flows []*flow.Flow) {
+	c.correlate(flows)
+	c.sender.SendFlows(flows)
+}
+
+// SendStats forwards the flow stats
+func (c *MemberCorrelator) SendStats(stats flow.Stats) {
+	c.sender.SendStats(stats)
+}
+
+// NewMemberCorrelator returns a new flow sender attributing the flows to
+// the member interfaces of bonds, teams and ECMP routes
+func NewMemberCorrelator(g *graph.Graph, sender flow.Sender) *MemberCorrelator {
+	return &MemberCorrelator{
+		graph:   g,
+		sender:  sender,
+		members: make(map[string]string),
+	}
+}
@@ -45,6 +45,64 @@ type VF struct {
 	Vlan      int64  `json:",omitempty"`
 }
 
+// WireGuard describes the configuration of a WireGuard interface
+// easyjson:json
+// gendecoder
+type WireGuard struct {
+	PublicKey    string           `json:",omitempty"`
+	ListenPort   int64            `json:",omitempty"`
+	FirewallMark int64            `json:",omitempty"`
+	Peers        []*WireGuardPeer `json:",omitempty"`
+}
+
+// WireGuardPeer describes a peer of a WireGuard interface. HandshakeAge is
+// the number of seconds elapsed since the last handshake, if any.
+// easyjson:json
+// gendecoder
+type WireGuardPeer struct {
+	PublicKey           string   `json:",omitempty"`
+	Endpoint            string   `json:",omitempty"`
+	AllowedIPs          []string `json:",omitempty"`
+	PersistentKeepalive int64    `json:",omitempty"`
+	LastHandshake       int64    `json:",omitempty"`
+	HandshakeAge        int64    `json:",omitempty"`
+}
+
+// IPsec describes an IPsec tunnel, made of the pair of XFRM states between
+// two endpoints, along with the XFRM policies sending traffic through it
+// easyjson:json
+// gendecoder
+type IPsec struct {
+	Local    string        `json:",omitempty"`
+	Remote   string        `json:",omitempty"`
+	Protocol string        `json:",omitempty"`
+	Mode     string        `json:",omitempty"`
+	Reqid    int64         `json:",omitempty"`
+	InSPI    int64         `json:",omitempty"`
+	OutSPI   int64         `json:",omitempty"`
+	Policies []*XfrmPolicy `json:",omitempty"`
+}
+
+// XfrmPolicy describes the selector of an XFRM policy
+// easyjson:json
+// gendecoder
+type XfrmPolicy struct {
+	Src      string `json:",omitempty"`
+	Dst      string `json:",omitempty"`
+	Dir      string `json:",omitempty"`
+	Priority int64  `json:",omitempty"`
+}
+
+// VFMetadataDecoder implements a json message raw decoder
+func VFMetadataDecoder(raw json.RawMessage) (common.Getter, error) {
+	var vf VF
+	if err := json.Unmarshal(raw, &vf); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal virtual function %s: %s", string(raw), err)
+	}
+
+	return &vf, nil
+}
+
 // VFSMetadataDecoder implements a json message raw decoder
 func VFSMetadataDecoder(raw json.RawMessage) (common.Getter, error) {
 	var vfs VFS
@@ -54,3 +112,23 @@ func VFSMetadataDecoder(raw json.RawMessage) (common.Getter, error) {
 
 	return &vfs, nil
 }
+
+// WireGuardMetadataDecoder implements a json message raw decoder
+func WireGuardMetadataDecoder(raw json.RawMessage) (common.Getter, error) {
+	var wg WireGuard
+	if err := json.Unmarshal(raw, &wg); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal WireGuard metadata %s: %s", string(raw), err)
+	}
+
+	return &wg, nil
+}
+
+// IPsecMetadataDecoder implements a json message raw decoder
+func IPsecMetadataDecoder(raw json.RawMessage) (common.Getter, error) {
+	var ipsec IPsec
+	if err := json.Unmarshal(raw, &ipsec); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal IPsec metadata %s: %s", string(raw), err)
+	}
+
+	return &ipsec, nil
+}
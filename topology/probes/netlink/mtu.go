@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// MTUAnalyzer annotates the overlay tunnels with their MTU mismatches. The
+// path MTU reported by the ICMP errors quoting encapsulated packets and the
+// largest packets captured on the tunnels are learnt from the flows, before
+// forwarding them to a flow sender.
+type MTUAnalyzer struct {
+	graph.DefaultGraphListener
+	graph  *graph.Graph
+	sender flow.Sender
+}
+
+func isTunnel(node *graph.Node) bool {
+	_, ok := topology.TunnelOverhead(node)
+	return ok
+}
+
+func (a *MTUAnalyzer) updateMismatches(node *graph.Node) {
+	if mismatches := topology.GetMTUMismatches(a.graph, node); len(mismatches) > 0 {
+		a.graph.AddMetadata(node, "MTUMismatches", mismatches)
+	} else if _, err := node.GetField("MTUMismatches"); err == nil {
+		a.graph.DelMetadata(node, "MTUMismatches")
+	}
+}
+
+// onNodeEvent checks the tunnel, or the tunnels of the namespace of the
+// interface, the MTU of the interface bounding theirs
+func (a *MTUAnalyzer) onNodeEvent(node *graph.Node) {
+	if isTunnel(node) {
+		a.updateMismatches(node)
+		return
+	}
+
+	if _, err := node.GetFieldInt64("MTU"); err != nil {
+		return
+	}
+
+	for _, parent := range a.graph.LookupParents(node, nil, topology.OwnershipMetadata()) {
+		for _, child := range a.graph.LookupChildren(parent, nil, topology.OwnershipMetadata()) {
+			if isTunnel(child) {
+				a.updateMismatches(child)
+			}
+		}
+	}
+}
+
+// OnNodeAdded event
+func (a *MTUAnalyzer) OnNodeAdded(node *graph.Node) {
+	a.onNodeEvent(node)
+}
+
+// OnNodeUpdated event
+func (a *MTUAnalyzer) OnNodeUpdated(node *graph.Node) {
+	a.onNodeEvent(node)
+}
+
+// matchTunnel returns whether the original flow of an ICMP error was
+// encapsulated by the tunnel
+func matchTunnel(node *graph.Node, original *flow.ICMPOriginalFlow) bool {
+	if local, _ := node.GetFieldString("Tunnel.Local"); local != "" && local != original.Network.A {
+		return false
+	}
+
+	switch ty, _ := node.GetFieldString("Type"); ty {
+	case "vxlan", "geneve":
+		return original.Transport != nil && original.Transport.Protocol == flow.FlowProtocol_UDP
+	default:
+		return original.Transport == nil
+	}
+}
+
+func (a *MTUAnalyzer) analyze(flows []*flow.Flow) {
+	a.graph.Lock()
+	defer a.graph.Unlock()
+
+	tunnels := make(map[string]*graph.Node)
+	for _, f := range flows {
+		if f.ICMP != nil && f.ICMP.MTU != 0 && f.ICMP.Original != nil && f.ICMP.Original.Network != nil {
+			original := f.ICMP.Original
+			for _, node := range a.graph.GetNodes(graph.Metadata{"Tunnel.Remote": original.Network.B}) {
+				if matchTunnel(node, original) {
+					a.graph.AddMetadata(node, "PathMTU", int64(f.ICMP.MTU))
+				}
+			}
+		}
+
+		if f.NodeTID == "" || f.MaxPacketLength == 0 {
+			continue
+		}
+
+		node, found := tunnels[f.NodeTID]
+		if !found {
+			if node = a.graph.LookupFirstNode(graph.Metadata{"TID": f.NodeTID}); node != nil && !isTunnel(node) {
+				node = nil
+			}
+			tunnels[f.NodeTID] = node
+		}
+
+		if node != nil {
+			if length, _ := node.GetFieldInt64("MaxPacketLength"); f.MaxPacketLength > length {
+				a.graph.AddMetadata(node, "MaxPacketLength", f.MaxPacketLength)
+			}
+		}
+	}
+}
+
+// SendFlows learns the MTU of the tunnels from the flows and forwards them
+func (a *MTUAnalyzer) SendFlows(flows []*flow.Flow) {
+	a.analyze(flows)
+	a.sender.SendFlows(flows)
+}
+
+// SendStats forwards the flow stats
+func (a *MTUAnalyzer) SendStats(stats flow.Stats) {
+	a.sender.SendStats(stats)
+}
+
+// NewMTUAnalyzer returns a new flow sender annotating the overlay tunnels
+// with their MTU mismatches
+func NewMTUAnalyzer(g *graph.Graph, sender flow.Sender) *MTUAnalyzer {
+	a := &MTUAnalyzer{
+		graph:  g,
+		sender: sender,
+	}
+	g.AddEventListener(a)
+	return a
+}
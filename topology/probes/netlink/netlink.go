@@ -32,6 +32,7 @@ import (
 	"github.com/safchain/ethtool"
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netlink/nl"
+	"golang.zx2c4.com/wireguard/wgctrl"
 
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/filters"
@@ -80,6 +81,9 @@ type Probe struct {
 	quit                 chan bool
 	netNsNameTry         map[graph.Identifier]int
 	sriovProcessor       *graph.Processor
+	wireguard            *wgctrl.Client
+	ipsecNodes           map[graph.Identifier]*graph.Node
+	multipathRoutes      []netlink.Route
 }
 
 // ProbeHandler describes a list NetLink NameSpace probe to enhance the graph
@@ -329,6 +333,42 @@ func (u *Probe) getFamilyNeighbors(index, family int) *topology.Neighbors {
 	return &neighbors
 }
 
+// getTunnelMetadata returns the endpoints of the VXLAN and GRE tap tunnels
+func getTunnelMetadata(link netlink.Link) map[string]interface{} {
+	tunnel := make(map[string]interface{})
+
+	switch link := link.(type) {
+	case *netlink.Vxlan:
+		tunnel["VNI"] = int64(link.VxlanId)
+		if link.Port != 0 {
+			tunnel["Port"] = int64(link.Port)
+		}
+		if link.VtepDevIndex != 0 {
+			tunnel["UnderlayIfIndex"] = int64(link.VtepDevIndex)
+		}
+		if link.SrcAddr != nil {
+			tunnel["Local"] = link.SrcAddr.String()
+		}
+		if link.Group != nil {
+			tunnel["Remote"] = link.Group.String()
+		}
+	case *netlink.Gretap:
+		if link.Link != 0 {
+			tunnel["UnderlayIfIndex"] = int64(link.Link)
+		}
+		if link.Local != nil {
+			tunnel["Local"] = link.Local.String()
+		}
+		if link.Remote != nil {
+			tunnel["Remote"] = link.Remote.String()
+		}
+	default:
+		return nil
+	}
+
+	return tunnel
+}
+
 func newInterfaceMetricsFromNetlink(link netlink.Link) *topology.InterfaceMetric {
 	statistics := link.Attrs().Statistics
 	if statistics == nil {
@@ -560,8 +600,28 @@ func (u *Probe) addLinkToTopology(link netlink.Link) {
 	}
 	metadata["LinkFlags"] = flags
 
-	if link.Type() == "bond" {
-		metadata["BondMode"] = link.(*netlink.Bond).Mode.String()
+	if bond, ok := link.(*netlink.Bond); ok {
+		metadata["BondMode"] = bond.Mode.String()
+		if bond.XmitHashPolicy >= 0 {
+			metadata["BondXmitHashPolicy"] = bond.XmitHashPolicy.String()
+		}
+		if bond.LacpRate >= 0 {
+			metadata["BondLacpRate"] = bond.LacpRate.String()
+		}
+		if bond.Miimon > 0 {
+			metadata["BondMiimon"] = int64(bond.Miimon)
+		}
+		if bond.ActiveSlave > 0 {
+			metadata["BondActiveSlave"] = int64(bond.ActiveSlave)
+		}
+	}
+
+	if tunnel := getTunnelMetadata(link); tunnel != nil {
+		metadata["Tunnel"] = tunnel
+	}
+
+	if linkType == "wireguard" {
+		u.addWireGuardMetadata(attrs.Name, metadata)
 	}
 
 	businfo, err := u.ethtool.BusInfo(attrs.Name)
@@ -622,6 +682,21 @@ func (u *Probe) getRoutingTables(link netlink.Link, table int) *topology.Routing
 		return nil
 	}
 
+	// ECMP routes have no output interface, add the ones using the link
+	u.RLock()
+	for _, r := range u.multipathRoutes {
+		if table != syscall.RTA_UNSPEC && r.Table != table {
+			continue
+		}
+		for _, nh := range r.MultiPath {
+			if nh.LinkIndex == link.Attrs().Index {
+				routeList = append(routeList, r)
+				break
+			}
+		}
+	}
+	u.RUnlock()
+
 	if len(routeList) == 0 {
 		return nil
 	}
@@ -648,7 +723,8 @@ func (u *Probe) getRoutingTables(link netlink.Link, table int) *topology.Routing
 		route := routingTable.GetOrCreateRoute(protocol, prefix)
 		if len(r.MultiPath) > 0 {
 			for _, nh := range r.MultiPath {
-				route.GetOrCreateNextHop(nh.Gw, int64(nh.LinkIndex), int64(r.Priority))
+				nextHop := route.GetOrCreateNextHop(nh.Gw, int64(nh.LinkIndex), int64(r.Priority))
+				nextHop.Weight = int64(nh.Hops) + 1
 			}
 		} else {
 			route.GetOrCreateNextHop(r.Gw, int64(r.LinkIndex), int64(r.Priority))
@@ -706,6 +782,13 @@ func (u *Probe) onLinkDeleted(link netlink.Link) {
 		} else {
 			delete(u.netNsNameTry, intf.ID)
 
+			// the VFs bound to vfio-pci have no netdev, no event will remove them
+			for _, vf := range u.Ctx.Graph.LookupChildren(intf, graph.Metadata{"Driver": vfioDriver}, graph.Metadata{"RelationType": "vf"}) {
+				if err := u.Ctx.Graph.DelNode(vf); err != nil {
+					u.Ctx.Logger.Error(err)
+				}
+			}
+
 			err = u.Ctx.Graph.DelNode(intf)
 		}
 
@@ -829,6 +912,10 @@ func (u *Probe) onAddressDeleted(addr netlink.Addr, family int, index int64) {
 
 func (u *Probe) initialize() {
 	u.Ctx.Logger.Debugf("Initialize Netlink interfaces for %s", u.Ctx.RootNode.ID)
+	if _, err := u.updateMultipathRoutes(); err != nil {
+		u.Ctx.Logger.Errorf("Unable to list ECMP routes: %s", err)
+	}
+
 	links, err := u.handle.LinkList()
 	if err != nil {
 		u.Ctx.Logger.Errorf("Unable to list interfaces: %s", err)
@@ -897,11 +984,47 @@ func (u *Probe) parseNeighborMsg(m []byte) (*topology.Neighbors, *topology.Neigh
 	return fdb, neighbors, neigh.LinkIndex, nil
 }
 
-func (u *Probe) parseRtMsg(m []byte) (*topology.RoutingTables, int, error) {
+// updateMultipathRoutes refreshes the ECMP routes of the namespace and returns
+// the indexes of the interfaces used by the previous and the new routes
+func (u *Probe) updateMultipathRoutes() ([]int, error) {
+	routeFilter := &netlink.Route{Table: syscall.RT_TABLE_UNSPEC}
+	routeList, err := u.handle.RouteListFiltered(netlink.FAMILY_ALL, routeFilter, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return nil, err
+	}
+
+	var multipathRoutes []netlink.Route
+	for _, r := range routeList {
+		if len(r.MultiPath) > 0 {
+			multipathRoutes = append(multipathRoutes, r)
+		}
+	}
+
+	u.Lock()
+	indexes := make(map[int]bool)
+	for _, routes := range [][]netlink.Route{u.multipathRoutes, multipathRoutes} {
+		for _, r := range routes {
+			for _, nh := range r.MultiPath {
+				indexes[nh.LinkIndex] = true
+			}
+		}
+	}
+	u.multipathRoutes = multipathRoutes
+	u.Unlock()
+
+	var linkIndexes []int
+	for index := range indexes {
+		linkIndexes = append(linkIndexes, index)
+	}
+	return linkIndexes, nil
+}
+
+// parseRtMsg returns the indexes of the interfaces whose routes changed
+func (u *Probe) parseRtMsg(m []byte) ([]int, error) {
 	msg := nl.DeserializeRtMsg(m)
 	attrs, err := nl.ParseRouteAttr(m[msg.Len():])
 	if err != nil {
-		return nil, -1, err
+		return nil, err
 	}
 	native := nl.NativeEndian()
 	var linkIndex int
@@ -909,16 +1032,21 @@ func (u *Probe) parseRtMsg(m []byte) (*topology.RoutingTables, int, error) {
 		switch attr.Attr.Type {
 		case syscall.RTA_OIF:
 			linkIndex = int(native.Uint32(attr.Value[0:4]))
-			break
+		case syscall.RTA_MULTIPATH:
+			return u.updateMultipathRoutes()
 		}
 	}
 
+	return []int{linkIndex}, nil
+}
+
+func (u *Probe) getLinkRoutingTables(linkIndex int) (*topology.RoutingTables, error) {
 	link, err := u.handle.LinkByIndex(linkIndex)
 	if err != nil {
-		return nil, linkIndex, err
+		return nil, err
 	}
 
-	return u.getRoutingTables(link, syscall.RTA_UNSPEC), linkIndex, err
+	return u.getRoutingTables(link, syscall.RTA_UNSPEC), nil
 }
 
 func parseAddr(m []byte) (addr netlink.Addr, family, index int, err error) {
@@ -1102,9 +1230,11 @@ Ready:
 		select {
 		case <-updateIntfsTicker.C:
 			u.updateIntfs()
+			u.updateIPsec()
 		case t := <-metricTicker.C:
 			now := t.UTC()
 			u.updateIntfMetric(now, last)
+			u.updateWireGuard(now)
 			last = now
 		case <-u.quit:
 			return
@@ -1154,12 +1284,20 @@ func (u *Probe) onMessageAvailable() {
 			}
 			u.onAddressDeleted(addr, family, int64(ifindex))
 		case syscall.RTM_NEWROUTE, syscall.RTM_DELROUTE:
-			rts, index, err := u.parseRtMsg(msg.Data)
+			indexes, err := u.parseRtMsg(msg.Data)
 			if err != nil {
 				u.Ctx.Logger.Warningf("Failed to get Routes: %s", err)
 				continue
 			}
-			u.onRoutingTablesChanged(int64(index), rts)
+
+			for _, index := range indexes {
+				rts, err := u.getLinkRoutingTables(index)
+				if err != nil {
+					u.Ctx.Logger.Warningf("Failed to get Routes: %s", err)
+					continue
+				}
+				u.onRoutingTablesChanged(int64(index), rts)
+			}
 
 		case RtmNewNeigh, RtmDelNeigh:
 			fdb, neighbors, index, err := u.parseNeighborMsg(msg.Data)
@@ -1185,6 +1323,9 @@ func (u *Probe) closeFds() {
 	if u.epollFd != 0 {
 		syscall.Close(u.epollFd)
 	}
+	if u.wireguard != nil {
+		u.wireguard.Close()
+	}
 }
 
 func (u *Probe) stop() {
@@ -1204,6 +1345,7 @@ func newProbe(ctx tp.Context, nsPath string, sriovProcessor *graph.Processor) (*
 		quit:                 make(chan bool),
 		netNsNameTry:         make(map[graph.Identifier]int),
 		sriovProcessor:       sriovProcessor,
+		ipsecNodes:           make(map[graph.Identifier]*graph.Node),
 	}
 	var context *common.NetNSContext
 	var err error
@@ -1224,7 +1366,7 @@ func newProbe(ctx tp.Context, nsPath string, sriovProcessor *graph.Processor) (*
 	}
 
 	// Both NewHandle and Subscribe need to done in the network namespace.
-	if probe.handle, err = netlink.NewHandle(syscall.NETLINK_ROUTE); err != nil {
+	if probe.handle, err = netlink.NewHandle(syscall.NETLINK_ROUTE, syscall.NETLINK_XFRM); err != nil {
 		return errFnc(fmt.Errorf("Failed to create netlink handle: %s", err))
 	}
 
@@ -1251,6 +1393,11 @@ func newProbe(ctx tp.Context, nsPath string, sriovProcessor *graph.Processor) (*
 		return errFnc(fmt.Errorf("Failed to create epoll: %s", err))
 	}
 
+	// the WireGuard generic netlink socket is bound to the namespace as well
+	if probe.wireguard, err = wgctrl.New(); err != nil {
+		ctx.Logger.Debugf("WireGuard interfaces will not be reported: %s", err)
+	}
+
 	// Leave the network namespace
 	context.Close()
 
@@ -1378,6 +1525,7 @@ func NewProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
 // Register registers graph metadata decoders
 func Register() {
 	graph.NodeMetadataDecoders["Vfs"] = VFSMetadataDecoder
+	graph.NodeMetadataDecoders["VF"] = VFMetadataDecoder
 
 	graph.NodeMetadataDecoders["RoutingTables"] = topology.RoutingTablesMetadataDecoder
 	graph.NodeMetadataDecoders["FDB"] = topology.NeighborMetadataDecoder
@@ -1385,4 +1533,7 @@ func Register() {
 
 	graph.NodeMetadataDecoders["Metric"] = topology.InterfaceMetricMetadataDecoder
 	graph.NodeMetadataDecoders["LastUpdateMetric"] = topology.InterfaceMetricMetadataDecoder
+
+	graph.NodeMetadataDecoders["WireGuard"] = WireGuardMetadataDecoder
+	graph.NodeMetadataDecoders["IPsec"] = IPsecMetadataDecoder
 }
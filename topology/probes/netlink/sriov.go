@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -36,9 +37,13 @@ import (
 	"github.com/skydive-project/skydive/topology"
 )
 
+// vfioDriver is the driver of the VFs assigned to a VM through PCI passthrough
+const vfioDriver = "vfio-pci"
+
 type pendingVf struct {
 	intf *graph.Node
 	vfid int
+	vf   *VF
 }
 
 // PciFromString transforms the symbolic representation of a pci address
@@ -81,10 +86,16 @@ func readIntFile(path string) (int, error) {
 }
 
 /* ProcessNode, the action associated to a pendingVf connects the node of actual
-   virtual to the VF node associated to the physical interface */
+   virtual to the VF node associated to the physical interface. The VF node
+   also gets the VLAN, MAC and rate settings of the physical interface, so
+   that the traffic bypassing the kernel datapath, as the one of a VF assigned
+   to a VM, can be attributed. A VF assigned to a VM is linked to its domain */
 func (pending *pendingVf) ProcessNode(g *graph.Graph, node *graph.Node) bool {
 	tr := g.StartMetadataTransaction(node)
 	tr.AddMetadata("VfID", int64(pending.vfid))
+	if pending.vf != nil {
+		tr.AddMetadata("VF", pending.vf)
+	}
 	if err := tr.Commit(); err != nil {
 		logging.GetLogger().Errorf("Metadata transaction failed: %s", err)
 	}
@@ -93,9 +104,50 @@ func (pending *pendingVf) ProcessNode(g *graph.Graph, node *graph.Node) bool {
 			logging.GetLogger().Error(err)
 		}
 	}
+	if domain, _ := node.GetFieldString("Libvirt.Domain"); domain != "" {
+		vm := g.LookupFirstNode(graph.Metadata{"Name": domain, "Type": "libvirt"})
+		if vm != nil && !topology.HaveLink(g, node, vm, "vlayer2") {
+			if _, err := topology.AddLink(g, node, vm, "vlayer2", nil); err != nil {
+				logging.GetLogger().Error(err)
+			}
+		}
+	}
 	return false
 }
 
+// pciDriver returns the name of the driver bound to a PCI device, if any
+func pciDriver(businfo string) string {
+	path, err := os.Readlink(fmt.Sprintf("/sys/bus/pci/devices/%s/driver", businfo))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(path)
+}
+
+/* addPassthroughVf adds the node of a VF bound to vfio-pci, unless the libvirt
+   probe already added it. Such a VF has no netdev, the netlink events never
+   report it */
+func addPassthroughVf(g *graph.Graph, root *graph.Node, vfAddress string) (*graph.Node, error) {
+	if node := g.LookupFirstChild(root, graph.Metadata{"BusInfo": vfAddress}); node != nil {
+		return node, nil
+	}
+
+	m := graph.Metadata{
+		"Name":    vfAddress,
+		"BusInfo": vfAddress,
+		"Driver":  vfioDriver,
+		"Type":    "device",
+	}
+	node, err := g.NewNode(graph.GenID(), m)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := topology.AddOwnershipLink(g, root, node, nil); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
 // errZeroVfs is used as a catchable exception rather than an error
 var errZeroVfs = errors.New("zero VFS")
 
@@ -203,14 +255,22 @@ func (u *Probe) handleSriov(
 		logging.GetLogger().Errorf("Metadata transaction failed: %s", err)
 	}
 
-	for _, vf := range attrsVfs {
+	for i, vf := range attrsVfs {
 		id := vf.ID
 		pciVf := pciaddress + (uint32)(offset+id*stride)
 		vfAddress := PciToString(pciVf)
 		pending := pendingVf{
 			intf: intf,
 			vfid: id,
+			vf:   vfs[i],
 		}
 		u.sriovProcessor.DoAction(&pending, vfAddress)
+
+		if pciDriver(vfAddress) == vfioDriver {
+			if _, err := addPassthroughVf(graph, u.Ctx.RootNode, vfAddress); err != nil {
+				logging.GetLogger().Errorf(
+					"SR-IOV: cannot add VF %s - %s", vfAddress, err)
+			}
+		}
 	}
 }
@@ -0,0 +1,124 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Orange.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/topology"
+)
+
+func TestVFMetadataDecoder(t *testing.T) {
+	Register()
+
+	var node graph.Node
+	data := `{"ID": "vf", "Metadata": {"Name": "ens1f0v1", "VF": {"ID": 1, "MAC": "52:54:00:12:34:56", "Vlan": 100, "Spoofchk": true}}}`
+	if err := json.Unmarshal([]byte(data), &node); err != nil {
+		t.Fatal(err)
+	}
+
+	if vlan, _ := node.GetFieldInt64("VF.Vlan"); vlan != 100 {
+		t.Errorf("Expected the VLAN of the VF, got %d", vlan)
+	}
+	if mac, _ := node.GetFieldString("VF.MAC"); mac != "52:54:00:12:34:56" {
+		t.Errorf("Expected the MAC of the VF, got %s", mac)
+	}
+	if spoofchk, _ := node.GetFieldBool("VF.Spoofchk"); !spoofchk {
+		t.Error("Expected the spoof checking of the VF to be enabled")
+	}
+
+	if _, err := VFMetadataDecoder(json.RawMessage(`{"Vlan": "100"}`)); err == nil {
+		t.Error("Expected an invalid VF to be refused")
+	}
+}
+
+func newSriovGraph(t *testing.T) (*graph.Graph, *graph.Processor) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.UnknownService)
+
+	processor := graph.NewProcessor(g, g, graph.Metadata{"Type": "device"}, "BusInfo")
+	processor.Start()
+
+	return g, processor
+}
+
+func TestPendingVf(t *testing.T) {
+	g, processor := newSriovGraph(t)
+
+	g.Lock()
+	defer g.Unlock()
+
+	host, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "host", "Type": "host"})
+	pf, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "ens1f0", "Type": "device", "BusInfo": "0000:03:00.0"})
+	vm, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "vm1", "Type": "libvirt"})
+
+	// a VF assigned to a VM, already reported by the libvirt probe
+	assigned, _ := g.NewNode(graph.GenID(), graph.Metadata{
+		"Name":    "hdev-03:10.2",
+		"Type":    "device",
+		"BusInfo": "0000:03:10.2",
+		"Libvirt": map[string]interface{}{"Domain": "vm1"},
+	})
+
+	processor.DoAction(&pendingVf{intf: pf, vfid: 2, vf: &VF{ID: 2, Vlan: 100}}, "0000:03:10.2")
+	processor.DoAction(&pendingVf{intf: pf, vfid: 3, vf: &VF{ID: 3, Vlan: 200}}, "0000:03:10.3")
+
+	if vfid, _ := assigned.GetFieldInt64("VfID"); vfid != 2 {
+		t.Errorf("Expected the VF ID to be set, got %d", vfid)
+	}
+	if vlan, _ := assigned.GetFieldInt64("VF.Vlan"); vlan != 100 {
+		t.Errorf("Expected the VLAN of the VF, got %d", vlan)
+	}
+	if !topology.HaveLink(g, pf, assigned, "vf") {
+		t.Error("Expected the VF to be linked to its physical interface")
+	}
+	if !topology.HaveLink(g, assigned, vm, "vlayer2") {
+		t.Error("Expected the VF to be linked to the VM it is assigned to")
+	}
+
+	// the VF bound to vfio-pci has no netdev, its node is added by the probe
+	// and matched by the pending action
+	vf, err := addPassthroughVf(g, host, "0000:03:10.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if driver, _ := vf.GetFieldString("Driver"); driver != vfioDriver {
+		t.Errorf("Expected the VF to be bound to vfio-pci, got %s", driver)
+	}
+	if vlan, _ := vf.GetFieldInt64("VF.Vlan"); vlan != 200 {
+		t.Errorf("Expected the VLAN of the VF, got %d", vlan)
+	}
+	if !topology.HaveOwnershipLink(g, host, vf) || !topology.HaveLink(g, pf, vf, "vf") {
+		t.Error("Expected the VF to be owned by the host and linked to its physical interface")
+	}
+	if topology.HaveLink(g, vf, vm, "vlayer2") {
+		t.Error("The VF is not assigned to the VM")
+	}
+
+	if again, _ := addPassthroughVf(g, host, "0000:03:10.3"); again.ID != vf.ID {
+		t.Error("Expected the node of the VF to be added once")
+	}
+}
@@ -0,0 +1,107 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"reflect"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+func newWireGuardMetadata(device *wgtypes.Device, now time.Time) *WireGuard {
+	wg := &WireGuard{
+		PublicKey:    device.PublicKey.String(),
+		ListenPort:   int64(device.ListenPort),
+		FirewallMark: int64(device.FirewallMark),
+	}
+
+	for _, peer := range device.Peers {
+		p := &WireGuardPeer{
+			PublicKey:           peer.PublicKey.String(),
+			PersistentKeepalive: int64(peer.PersistentKeepaliveInterval / time.Second),
+		}
+
+		if peer.Endpoint != nil {
+			p.Endpoint = peer.Endpoint.String()
+		}
+
+		for _, ipnet := range peer.AllowedIPs {
+			p.AllowedIPs = append(p.AllowedIPs, ipnet.String())
+		}
+
+		if !peer.LastHandshakeTime.IsZero() {
+			p.LastHandshake = common.UnixMillis(peer.LastHandshakeTime)
+			p.HandshakeAge = int64(now.Sub(peer.LastHandshakeTime) / time.Second)
+		}
+
+		wg.Peers = append(wg.Peers, p)
+	}
+
+	return wg
+}
+
+// updateWireGuard reports the peers of the WireGuard interfaces
+func (u *Probe) updateWireGuard(now time.Time) {
+	if u.wireguard == nil {
+		return
+	}
+
+	for _, node := range u.cloneLinkNodes() {
+		u.Ctx.Graph.RLock()
+		linkType, _ := node.GetFieldString("Type")
+		name, _ := node.GetFieldString("Name")
+		u.Ctx.Graph.RUnlock()
+
+		if linkType != "wireguard" {
+			continue
+		}
+
+		device, err := u.wireguard.Device(name)
+		if err != nil {
+			u.Ctx.Logger.Debugf("Unable to retrieve WireGuard device %s: %s", name, err)
+			continue
+		}
+		wg := newWireGuardMetadata(device, now)
+
+		u.Ctx.Graph.Lock()
+		if field, err := node.GetField("WireGuard"); err != nil || !reflect.DeepEqual(field, wg) {
+			if err := u.Ctx.Graph.AddMetadata(node, "WireGuard", wg); err != nil {
+				u.Ctx.Logger.Error(err)
+			}
+		}
+		u.Ctx.Graph.Unlock()
+	}
+}
+
+// addWireGuardMetadata adds the WireGuard metadata of an interface being
+// added to the topology
+func (u *Probe) addWireGuardMetadata(name string, metadata graph.Metadata) {
+	if u.wireguard == nil {
+		return
+	}
+
+	if device, err := u.wireguard.Device(name); err == nil {
+		metadata["WireGuard"] = newWireGuardMetadata(device, time.Now())
+	}
+}
@@ -0,0 +1,180 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/topology"
+)
+
+var xfrmDirs = map[netlink.Dir]string{
+	netlink.XFRM_DIR_IN:  "in",
+	netlink.XFRM_DIR_OUT: "out",
+	netlink.XFRM_DIR_FWD: "fwd",
+}
+
+// getLocalAddresses returns the interface index of the addresses of the namespace
+func (u *Probe) getLocalAddresses() map[string]int {
+	addresses := make(map[string]int)
+
+	links, err := u.handle.LinkList()
+	if err != nil {
+		return addresses
+	}
+
+	for _, link := range links {
+		if addrs, err := u.handle.AddrList(link, netlink.FAMILY_ALL); err == nil {
+			for _, addr := range addrs {
+				addresses[addr.IP.String()] = link.Attrs().Index
+			}
+		}
+	}
+	return addresses
+}
+
+// getIPsecTunnels returns the IPsec tunnels of the namespace, grouping the
+// inbound and outbound XFRM states between two endpoints
+func (u *Probe) getIPsecTunnels(local map[string]int) (map[string]*IPsec, error) {
+	states, err := u.handle.XfrmStateList(netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+
+	policies, err := u.handle.XfrmPolicyList(netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+
+	tunnels := make(map[string]*IPsec)
+	for _, state := range states {
+		src, dst := state.Src.String(), state.Dst.String()
+
+		_, isSrcLocal := local[src]
+		_, isDstLocal := local[dst]
+		outbound := isSrcLocal || !isDstLocal
+		if !outbound {
+			src, dst = dst, src
+		}
+
+		key := fmt.Sprintf("%s/%s/%d", src, dst, state.Reqid)
+		tunnel, found := tunnels[key]
+		if !found {
+			tunnel = &IPsec{
+				Local:    src,
+				Remote:   dst,
+				Protocol: state.Proto.String(),
+				Mode:     state.Mode.String(),
+				Reqid:    int64(state.Reqid),
+			}
+			tunnels[key] = tunnel
+		}
+
+		if outbound {
+			tunnel.OutSPI = int64(state.Spi)
+		} else {
+			tunnel.InSPI = int64(state.Spi)
+		}
+	}
+
+	for _, policy := range policies {
+		if policy.Src == nil || policy.Dst == nil {
+			continue
+		}
+
+		for _, tmpl := range policy.Tmpls {
+			src, dst := tmpl.Src.String(), tmpl.Dst.String()
+			for _, tunnel := range tunnels {
+				if tmpl.Reqid != 0 && int64(tmpl.Reqid) != tunnel.Reqid {
+					continue
+				}
+				if (src == tunnel.Local && dst == tunnel.Remote) || (src == tunnel.Remote && dst == tunnel.Local) {
+					tunnel.Policies = append(tunnel.Policies, &XfrmPolicy{
+						Src:      policy.Src.String(),
+						Dst:      policy.Dst.String(),
+						Dir:      xfrmDirs[policy.Dir],
+						Priority: int64(policy.Priority),
+					})
+				}
+			}
+		}
+	}
+
+	return tunnels, nil
+}
+
+// updateIPsec reports the IPsec tunnels as nodes linked to the interface
+// holding their local endpoint address
+func (u *Probe) updateIPsec() {
+	local := u.getLocalAddresses()
+
+	tunnels, err := u.getIPsecTunnels(local)
+	if err != nil {
+		u.Ctx.Logger.Debugf("Unable to retrieve the XFRM states and policies of %s: %s", u.Ctx.RootNode.ID, err)
+		return
+	}
+
+	links := u.cloneLinkNodes()
+
+	u.Ctx.Graph.Lock()
+	defer u.Ctx.Graph.Unlock()
+
+	nodes := make(map[graph.Identifier]*graph.Node)
+	for key, tunnel := range tunnels {
+		id := graph.GenID(string(u.Ctx.RootNode.ID), "ipsec", key)
+
+		node := u.Ctx.Graph.GetNode(id)
+		if node == nil {
+			metadata := graph.Metadata{
+				"Type":  "ipsec",
+				"Name":  "ipsec-" + tunnel.Remote,
+				"IPsec": tunnel,
+			}
+
+			if node, err = u.Ctx.Graph.NewNode(id, metadata); err != nil {
+				u.Ctx.Logger.Error(err)
+				continue
+			}
+			topology.AddOwnershipLink(u.Ctx.Graph, u.Ctx.RootNode, node, nil)
+		} else if field, err := node.GetField("IPsec"); err != nil || !reflect.DeepEqual(field, tunnel) {
+			if err := u.Ctx.Graph.AddMetadata(node, "IPsec", tunnel); err != nil {
+				u.Ctx.Logger.Error(err)
+			}
+		}
+		nodes[id] = node
+
+		if intf, found := links[local[tunnel.Local]]; found && !topology.HaveLink(u.Ctx.Graph, node, intf, "ipsec") {
+			topology.AddLink(u.Ctx.Graph, node, intf, "ipsec", nil)
+		}
+	}
+
+	for id, node := range u.ipsecNodes {
+		if _, found := nodes[id]; !found {
+			if err := u.Ctx.Graph.DelNode(node); err != nil {
+				u.Ctx.Logger.Error(err)
+			}
+		}
+	}
+	u.ipsecNodes = nodes
+}
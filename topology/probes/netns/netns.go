@@ -20,17 +20,22 @@
 package netns
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
 	fsnotify "gopkg.in/fsnotify/fsnotify.v1"
 
 	"github.com/skydive-project/skydive/common"
@@ -52,6 +57,11 @@ type ProbeHandler struct {
 	rootNs          *NetNs
 	watcher         *fsnotify.Watcher
 	pending         chan string
+	runPaths        []string
+	managed         map[string]bool
+	reconcileReq    chan struct{}
+	reconcileEvery  time.Duration
+	nsidSocket      *nl.NetlinkSocket
 	exclude         []string
 	state           common.ServiceState
 	wg              sync.WaitGroup
@@ -278,19 +288,168 @@ func (u *ProbeHandler) initializeRunPath(path string) {
 		return
 	}
 
-	files, _ := ioutil.ReadDir(path)
-	for _, f := range files {
-		fullpath, name := path+"/"+f.Name(), f.Name()
+	u.Lock()
+	u.runPaths = append(u.runPaths, path)
+	u.Unlock()
+
+	u.requestReconcile()
+	u.Ctx.Logger.Debugf("ProbeHandler initialized %s", path)
+}
 
-		if u.isPathExcluded(fullpath) {
+// nsfsMounts returns the mount points of the network namespaces bind
+// mounted, as reported by a mountinfo file
+func nsfsMounts(r io.Reader) []string {
+	var mounts []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// mount ID, parent ID, major:minor, root, mount point, options,
+		// optional fields, separator, filesystem type, source, options
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 7 || !strings.HasPrefix(fields[3], "net:[") {
 			continue
 		}
 
-		if _, err := u.Register(fullpath, name); err != nil {
-			u.Ctx.Logger.Errorf("Failed to register namespace %s: %s", fullpath, err)
+		for i, field := range fields[6:] {
+			if field == "-" {
+				if i+7 < len(fields) && fields[i+7] == "nsfs" {
+					mounts = append(mounts, unescapeMountPath(fields[4]))
+				}
+				break
+			}
+		}
+	}
+
+	return mounts
+}
+
+// unescapeMountPath decodes the octal escaped characters of a mount point
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, "\\") {
+		return path
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if c, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// listNamespaces returns the network namespaces found in the watched paths
+// and the ones bind mounted anywhere else, indexed by their path
+func (u *ProbeHandler) listNamespaces() map[string]string {
+	namespaces := make(map[string]string)
+
+	u.RLock()
+	runPaths := append([]string{}, u.runPaths...)
+	u.RUnlock()
+
+	for _, path := range runPaths {
+		files, _ := ioutil.ReadDir(path)
+		for _, f := range files {
+			namespaces[path+"/"+f.Name()] = f.Name()
+		}
+	}
+
+	if f, err := os.Open("/proc/self/mountinfo"); err == nil {
+		for _, path := range nsfsMounts(f) {
+			namespaces[path] = getNetNSName(path)
+		}
+		f.Close()
+	}
+
+	for path := range namespaces {
+		if u.isPathExcluded(path) {
+			delete(namespaces, path)
+		}
+	}
+
+	return namespaces
+}
+
+func (u *ProbeHandler) registerManaged(path, name string) {
+	if _, err := u.Register(path, name); err != nil {
+		u.Ctx.Logger.Errorf("Failed to register namespace %s: %s", path, err)
+		return
+	}
+	u.managed[path] = true
+}
+
+func (u *ProbeHandler) unregisterManaged(path string) {
+	u.Unregister(path)
+	delete(u.managed, path)
+}
+
+// reconcile registers the namespaces whose creation was missed and
+// unregisters the ones whose deletion was missed, a namespace bind
+// mounted on an existing path being replaced when the inode changed
+func (u *ProbeHandler) reconcile() {
+	namespaces := u.listNamespaces()
+
+	for path := range u.managed {
+		if _, found := namespaces[path]; !found {
+			u.Ctx.Logger.Debugf("Network namespace %s disappeared", path)
+			u.unregisterManaged(path)
+			continue
+		}
+
+		u.RLock()
+		ns := u.pathToNetNS[path]
+		u.RUnlock()
+
+		var stats syscall.Stat_t
+		if ns != nil && syscall.Stat(path, &stats) == nil && (stats.Dev != ns.dev || stats.Ino != ns.ino) {
+			u.Ctx.Logger.Debugf("Network namespace %s has been replaced", path)
+			u.unregisterManaged(path)
+		}
+	}
+
+	for path, name := range namespaces {
+		if !u.managed[path] {
+			u.registerManaged(path, name)
+		}
+	}
+}
+
+func (u *ProbeHandler) requestReconcile() {
+	select {
+	case u.reconcileReq <- struct{}{}:
+	default:
+	}
+}
+
+// rtnlGroupNsid is the netlink group of the namespace ID events, RTNLGRP_NSID
+// in linux/rtnetlink.h
+const rtnlGroupNsid = 0x1c
+
+// watchNsid triggers a reconciliation each time a namespace ID is assigned
+// or released, which happens when an interface is moved to a namespace, as
+// done by the CNI plugins, even if the namespace is not mounted where
+// inotify could see it
+func (u *ProbeHandler) watchNsid() {
+	for {
+		msgs, err := u.nsidSocket.Receive()
+		if err != nil {
+			if u.state.Load() == common.RunningState {
+				u.Ctx.Logger.Errorf("Failed to receive namespace ID events: %s", err)
+			}
+			return
+		}
+
+		for _, msg := range msgs {
+			if msg.Header.Type == unix.RTM_NEWNSID || msg.Header.Type == unix.RTM_DELNSID {
+				u.requestReconcile()
+			}
 		}
 	}
-	u.Ctx.Logger.Debugf("ProbeHandler initialized %s", path)
 }
 
 func (u *ProbeHandler) start() {
@@ -301,6 +460,9 @@ func (u *ProbeHandler) start() {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
+	reconcileTicker := time.NewTicker(u.reconcileEvery)
+	defer reconcileTicker.Stop()
+
 	for u.state.Load() == common.RunningState {
 		select {
 		case path := <-u.pending:
@@ -311,17 +473,18 @@ func (u *ProbeHandler) start() {
 				continue
 			}
 			if ev.Op&fsnotify.Create == fsnotify.Create {
-				if _, err := u.Register(ev.Name, getNetNSName(ev.Name)); err != nil {
-					u.Ctx.Logger.Errorf("Failed to register namespace %s: %s", ev.Name, err)
-					continue
-				}
+				u.registerManaged(ev.Name, getNetNSName(ev.Name))
 			}
-			if ev.Op&fsnotify.Remove == fsnotify.Remove {
-				u.Unregister(ev.Name)
+			if ev.Op&fsnotify.Remove == fsnotify.Remove && u.managed[ev.Name] {
+				u.unregisterManaged(ev.Name)
 			}
 
 		case err := <-u.watcher.Errors:
 			u.Ctx.Logger.Errorf("Error while watching network namespace: %s", err)
+		case <-u.reconcileReq:
+			u.reconcile()
+		case <-reconcileTicker.C:
+			u.reconcile()
 		case <-ticker.C:
 		}
 	}
@@ -340,6 +503,16 @@ func (u *ProbeHandler) Start() error {
 
 	u.wg.Add(1)
 	go u.start()
+
+	if s, err := nl.Subscribe(unix.NETLINK_ROUTE, rtnlGroupNsid); err == nil {
+		// closing the socket does not wake up a pending receive, the
+		// goroutine is thus not waited for when stopping
+		u.nsidSocket = s
+		go u.watchNsid()
+	} else {
+		u.Ctx.Logger.Warningf("Unable to subscribe to namespace ID events, relying on periodic reconciliation: %s", err)
+	}
+
 	return nil
 }
 
@@ -348,6 +521,9 @@ func (u *ProbeHandler) Stop() {
 	if !u.state.CompareAndSwap(common.RunningState, common.StoppingState) {
 		return
 	}
+	if u.nsidSocket != nil {
+		u.nsidSocket.Close()
+	}
 	u.wg.Wait()
 
 	u.nlHandler.Stop()
@@ -406,6 +582,9 @@ func NewProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
 		rootNs:          rootNs,
 		watcher:         watcher,
 		pending:         make(chan string, 10),
+		managed:         make(map[string]bool),
+		reconcileReq:    make(chan struct{}, 1),
+		reconcileEvery:  time.Duration(ctx.Config.GetInt("agent.topology.netns.reconcile_interval")) * time.Second,
 		state:           common.StoppedState,
 	}
 
@@ -0,0 +1,41 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netns
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const mountinfo = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+431 25 0:4 net:[4026532572] /run/netns/cni-1234 rw shared:5 - nsfs nsfs rw
+432 25 0:4 net:[4026532680] /var/lib/custom\040path/ns1 rw shared:5 master:3 - nsfs nsfs rw
+433 25 0:4 mnt:[4026532681] /run/mntns rw shared:5 - nsfs nsfs rw
+`
+
+func TestNsfsMounts(t *testing.T) {
+	mounts := nsfsMounts(strings.NewReader(mountinfo))
+
+	expected := []string{"/run/netns/cni-1234", "/var/lib/custom path/ns1"}
+	if !reflect.DeepEqual(mounts, expected) {
+		t.Errorf("Expected %v, got %v", expected, mounts)
+	}
+}
@@ -33,13 +33,18 @@ import (
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/amphorae"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/provider"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/trunks"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
 	"github.com/gophercloud/gophercloud/pagination"
 
 	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/probe"
 	"github.com/skydive-project/skydive/topology"
@@ -51,6 +56,8 @@ type Probe struct {
 	graph.DefaultGraphListener
 	Ctx             tp.Context
 	client          *gophercloud.ServiceClient
+	lbClient        *gophercloud.ServiceClient
+	trunkBundle     *probe.Bundle
 	portMetadata    map[graph.Identifier]portMetadata
 	nodeUpdaterChan chan graph.Identifier
 	intfRegexp      *regexp.Regexp
@@ -71,6 +78,17 @@ type Metadata struct {
 	IPV4        []string `json:",omitempty"`
 	IPV6        []string `json:",omitempty"`
 	VNI         int64    `json:",omitempty"`
+
+	TrunkID          string `json:",omitempty"`
+	ParentPortID     string `json:",omitempty"`
+	SegmentationType string `json:",omitempty"`
+	SegmentationID   int64  `json:",omitempty"`
+
+	LoadBalancerID   string `json:",omitempty"`
+	LoadBalancerName string `json:",omitempty"`
+	LoadBalancerRole string `json:",omitempty"`
+	AmphoraID        string `json:",omitempty"`
+	ComputeID        string `json:",omitempty"`
 }
 
 // MetadataDecoder implements a json message raw decoder
@@ -203,9 +221,132 @@ func (p *Probe) retrieveAttributes(portMd portMetadata) (*Metadata, error) {
 		VNI:         int64(VNI),
 	}
 
+	if err := p.retrieveTrunk(&port, a); err != nil {
+		p.Ctx.Logger.Warningf("Failed to retrieve the trunk of port %s: %s", port.ID, err)
+	}
+
+	if p.lbClient != nil {
+		if err := p.retrieveLoadBalancer(&port, a); err != nil {
+			p.Ctx.Logger.Warningf("Failed to retrieve the load balancer of port %s: %s", port.ID, err)
+		}
+	}
+
 	return a, nil
 }
 
+// retrieveTrunk reports the trunk a port is the parent or a subport of
+func (p *Probe) retrieveTrunk(port *ports.Port, a *Metadata) error {
+	if port.DeviceOwner == "trunk:subport" {
+		trunk, err := trunks.Get(p.client, port.DeviceID).Extract()
+		if err != nil {
+			return err
+		}
+
+		a.TrunkID, a.ParentPortID = trunk.ID, trunk.PortID
+		for _, subport := range trunk.Subports {
+			if subport.PortID == port.ID {
+				a.SegmentationType = subport.SegmentationType
+				a.SegmentationID = int64(subport.SegmentationID)
+			}
+		}
+		return nil
+	}
+
+	page, err := trunks.List(p.client, trunks.ListOpts{PortID: port.ID}).AllPages()
+	if err != nil {
+		return err
+	}
+
+	trunkList, err := trunks.ExtractTrunks(page)
+	if err != nil {
+		return err
+	}
+
+	if len(trunkList) > 0 {
+		a.TrunkID = trunkList[0].ID
+	}
+
+	return nil
+}
+
+// retrieveLoadBalancer reports the Octavia load balancer a port is the VIP,
+// an amphora port or a pool member of
+func (p *Probe) retrieveLoadBalancer(port *ports.Port, a *Metadata) error {
+	if port.DeviceOwner == "Octavia" {
+		page, err := loadbalancers.List(p.lbClient, loadbalancers.ListOpts{VipPortID: port.ID}).AllPages()
+		if err != nil {
+			return err
+		}
+
+		lbs, err := loadbalancers.ExtractLoadBalancers(page)
+		if err != nil {
+			return err
+		}
+
+		if len(lbs) > 0 {
+			a.LoadBalancerID, a.LoadBalancerName, a.LoadBalancerRole = lbs[0].ID, lbs[0].Name, "vip"
+			return nil
+		}
+
+		if page, err = amphorae.List(p.lbClient, amphorae.ListOpts{VRRPPortID: port.ID}).AllPages(); err != nil {
+			return err
+		}
+
+		amphoraList, err := amphorae.ExtractAmphorae(page)
+		if err != nil {
+			return err
+		}
+
+		if len(amphoraList) > 0 {
+			amphora := amphoraList[0]
+			a.LoadBalancerID, a.LoadBalancerRole = amphora.LoadbalancerID, "amphora"
+			a.AmphoraID, a.ComputeID = amphora.ID, amphora.ComputeID
+		}
+		return nil
+	}
+
+	if len(port.FixedIPs) == 0 {
+		return nil
+	}
+
+	page, err := pools.List(p.lbClient, pools.ListOpts{}).AllPages()
+	if err != nil {
+		return err
+	}
+
+	poolList, err := pools.ExtractPools(page)
+	if err != nil {
+		return err
+	}
+
+	for _, pool := range poolList {
+		if len(pool.Loadbalancers) == 0 {
+			continue
+		}
+
+		for _, ip := range port.FixedIPs {
+			page, err := pools.ListMembers(p.lbClient, pool.ID, pools.ListMembersOpts{Address: ip.IPAddress}).AllPages()
+			if err != nil {
+				return err
+			}
+
+			members, err := pools.ExtractMembers(page)
+			if err != nil {
+				return err
+			}
+
+			for _, member := range members {
+				if member.SubnetID == "" || member.SubnetID == ip.SubnetID {
+					a.LoadBalancerID, a.LoadBalancerRole = pool.Loadbalancers[0].ID, "member"
+					return nil
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
 func (p *Probe) nodeUpdater() {
 	p.Ctx.Logger.Debug("Starting Neutron updater")
 
@@ -390,6 +531,10 @@ func (p *Probe) OnNodeDeleted(n *graph.Node) {
 func (p *Probe) Start() error {
 	p.Ctx.Graph.AddEventListener(p)
 
+	if err := p.trunkBundle.Start(); err != nil {
+		return err
+	}
+
 	go func() {
 		for p.client == nil {
 			client, err := openstack.NewClient(p.opts.IdentityEndpoint)
@@ -429,6 +574,16 @@ func (p *Probe) Start() error {
 				continue
 			}
 			p.client = networkClient
+
+			lbClient, err := openstack.NewLoadBalancerV2(client, gophercloud.EndpointOpts{
+				Region:       p.regionName,
+				Availability: p.availability,
+			})
+			if err != nil {
+				p.Ctx.Logger.Infof("Octavia load balancers won't be reported: %s", err)
+			} else {
+				p.lbClient = lbClient
+			}
 		}
 		p.Ctx.Graph.RLock()
 		for _, n := range p.Ctx.Graph.GetNodes(nil) {
@@ -445,6 +600,7 @@ func (p *Probe) Start() error {
 // Stop the probe
 func (p *Probe) Stop() {
 	p.Ctx.Graph.RemoveEventListener(p)
+	p.trunkBundle.Stop()
 	close(p.nodeUpdaterChan)
 }
 
@@ -469,8 +625,20 @@ func NewProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
 		return nil, fmt.Errorf("Endpoint type '%s' is not valid (must be 'public', 'admin' or 'internal')", endpointType)
 	}
 
+	// link the subports of a trunk to the interfaces of its parent port
+	trunkBundle := probe.NewBundle()
+
+	parentIndexer := graph.NewMetadataIndexer(ctx.Graph, ctx.Graph, graph.NewElementFilter(filters.NewNotNullFilter("Neutron.TrunkID")), "Neutron.PortID")
+	trunkBundle.AddHandler("parentIndexer", parentIndexer)
+
+	subportIndexer := graph.NewMetadataIndexer(ctx.Graph, ctx.Graph, nil, "Neutron.ParentPortID")
+	trunkBundle.AddHandler("subportIndexer", subportIndexer)
+
+	trunkBundle.AddHandler("trunkLinker", graph.NewMetadataIndexerLinker(ctx.Graph, parentIndexer, subportIndexer, graph.Metadata{"RelationType": "trunk"}))
+
 	return &Probe{
-		Ctx: ctx,
+		Ctx:         ctx,
+		trunkBundle: trunkBundle,
 		// only looking for interfaces matching the following regex as nova, neutron interfaces match this pattern
 		intfRegexp: regexp.MustCompile(`((tap|qr-|qg-|qvo)[a-fA-F0-9\-]+)|(vnet[0-9]+)`),
 		nsRegexp:   regexp.MustCompile(`(qrouter|qdhcp)-[a-fA-F0-9\-]+`),
@@ -34,6 +34,7 @@ import (
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/topology"
+	"github.com/socketplane/libovsdb"
 )
 
 type ovnEvent func()
@@ -43,7 +44,9 @@ type Probe struct {
 	graph.ListenerHandler
 	graph       *graph.Graph
 	address     string
+	sbAddress   string
 	ovndbapi    goovn.Client
+	sbClient    *libovsdb.OvsdbClient
 	switchPorts map[string]*goovn.LogicalSwitch
 	eventChan   chan ovnEvent
 	bundle      *probe.Bundle
@@ -53,20 +56,28 @@ type Probe struct {
 	lspIndexer  *graph.Indexer
 	lrIndexer   *graph.Indexer
 	lrpIndexer  *graph.Indexer
+	chIndexer   *graph.Indexer
 	spLinker    *graph.ResourceLinker
 	srLinker    *graph.MetadataIndexerLinker
 	rpLinker    *graph.ResourceLinker
 	aclLinker   *graph.ResourceLinker
 	ifaceLinker *graph.MetadataIndexerLinker
+	hostLinker  *graph.MetadataIndexerLinker
+	bindLinker  *graph.MetadataIndexerLinker
+	lsps        map[string]*goovn.LogicalSwitchPort
+	portChassis map[string]string
+	chassisName map[string]string
+	bindings    map[string]*portBinding
 }
 
 // Metadata describes the information of an OVN object
 // easyjson:json
 // gendecoder
 type Metadata struct {
-	LSPMetadata `json:",omitempty"`
-	LRPMetadata `json:",omitempty"`
-	ACLMetadata `json:",omitempty"`
+	LSPMetadata     `json:",omitempty"`
+	LRPMetadata     `json:",omitempty"`
+	ACLMetadata     `json:",omitempty"`
+	ChassisMetadata `json:",omitempty"`
 
 	ExtID   graph.Metadata `json:",omitempty" field:"Metadata"`
 	Options graph.Metadata `json:",omitempty" field:"Metadata"`
@@ -81,6 +92,7 @@ type LSPMetadata struct {
 	DHCPv4Options string   `json:",omitempty"`
 	DHCPv6Options string   `json:",omitempty"`
 	Type          string   `json:",omitempty"`
+	Chassis       string   `json:",omitempty"`
 }
 
 // LRPMetadata describes the information of an OVN logical router port
@@ -104,6 +116,13 @@ type ACLMetadata struct {
 	Priority  int64  `json:",omitempty"`
 }
 
+// ChassisMetadata describes the information of an OVN chassis
+// easyjson:json
+// gendecoder
+type ChassisMetadata struct {
+	Hostname string `json:",omitempty"`
+}
+
 // MetadataDecoder implements a json message raw decoder
 func MetadataDecoder(raw json.RawMessage) (common.Getter, error) {
 	var m Metadata
@@ -333,6 +352,7 @@ func (p *Probe) logicalPortMetadata(lp *goovn.LogicalSwitchPort) graph.Metadata
 				DHCPv4Options: lp.DHCPv4Options,
 				DHCPv6Options: lp.DHCPv6Options,
 				Type:          lp.Type,
+				Chassis:       p.portChassis[lp.Name],
 			},
 			ExtID:   common.NormalizeValue(lp.ExternalID).(map[string]interface{}),
 			Options: common.NormalizeValue(lp.Options).(map[string]interface{}),
@@ -364,12 +384,18 @@ func (p *Probe) logicalRouterPortMetadata(lp *goovn.LogicalRouterPort) graph.Met
 
 // OnLogicalPortCreate is called when a logical port is created on a switch
 func (p *Probe) OnLogicalPortCreate(lp *goovn.LogicalSwitchPort) {
-	p.eventChan <- func() { p.registerNode(p.lspIndexer, lp.UUID, p.logicalPortMetadata(lp)) }
+	p.eventChan <- func() {
+		p.lsps[lp.Name] = lp
+		p.registerNode(p.lspIndexer, lp.UUID, p.logicalPortMetadata(lp))
+	}
 }
 
 // OnLogicalPortDelete is called when a logical is deleted from a switch
 func (p *Probe) OnLogicalPortDelete(lp *goovn.LogicalSwitchPort) {
-	p.eventChan <- func() { p.unregisterNode(p.lspIndexer, lp.UUID) }
+	p.eventChan <- func() {
+		delete(p.lsps, lp.Name)
+		p.unregisterNode(p.lspIndexer, lp.UUID)
+	}
 }
 
 // OnDHCPOptionsCreate is called when DHCP options are created
@@ -511,6 +537,12 @@ func (p *Probe) Do(ctx context.Context, wg *sync.WaitGroup) error {
 		}
 	}
 
+	if p.sbAddress != "" {
+		if err := p.monitorSouthbound(); err != nil {
+			logging.GetLogger().Warningf("Unable to monitor the OVN southbound database, chassis won't be reported: %s", err)
+		}
+	}
+
 	wg.Add(1)
 
 	go func() {
@@ -528,6 +560,9 @@ func (p *Probe) Do(ctx context.Context, wg *sync.WaitGroup) error {
 				eventCallback()
 			case <-ctx.Done():
 				p.ovndbapi.Close()
+				if p.sbClient != nil {
+					p.sbClient.Disconnect()
+				}
 				return
 			}
 		}
@@ -536,17 +571,24 @@ func (p *Probe) Do(ctx context.Context, wg *sync.WaitGroup) error {
 	return nil
 }
 
-// NewProbe creates a new graph OVS database probe
-func NewProbe(g *graph.Graph, address string) (probe.Handler, error) {
+// NewProbe creates a new graph OVN probe. The southbound database address
+// is optional, when set chassis and port bindings are also reported.
+func NewProbe(g *graph.Graph, address string, sbAddress string) (probe.Handler, error) {
 	p := &Probe{
-		graph:      g,
-		address:    address,
-		eventChan:  make(chan ovnEvent, 50),
-		aclIndexer: graph.NewIndexer(g, nil, uuidHasher, false),
-		lsIndexer:  graph.NewIndexer(g, nil, uuidHasher, false),
-		lspIndexer: graph.NewIndexer(g, nil, uuidHasher, false),
-		lrIndexer:  graph.NewIndexer(g, nil, uuidHasher, false),
-		lrpIndexer: graph.NewIndexer(g, nil, uuidHasher, false),
+		graph:       g,
+		address:     address,
+		sbAddress:   sbAddress,
+		eventChan:   make(chan ovnEvent, 50),
+		aclIndexer:  graph.NewIndexer(g, nil, uuidHasher, false),
+		lsIndexer:   graph.NewIndexer(g, nil, uuidHasher, false),
+		lspIndexer:  graph.NewIndexer(g, nil, uuidHasher, false),
+		lrIndexer:   graph.NewIndexer(g, nil, uuidHasher, false),
+		lrpIndexer:  graph.NewIndexer(g, nil, uuidHasher, false),
+		chIndexer:   graph.NewIndexer(g, nil, uuidHasher, false),
+		lsps:        make(map[string]*goovn.LogicalSwitchPort),
+		portChassis: make(map[string]string),
+		chassisName: make(map[string]string),
+		bindings:    make(map[string]*portBinding),
 	}
 
 	p.bundle = &probe.Bundle{
@@ -556,6 +598,7 @@ func NewProbe(g *graph.Graph, address string) (probe.Handler, error) {
 			"lspIndexer": p.lspIndexer,
 			"lrIndexer":  p.lrIndexer,
 			"lrpIndexer": p.lrpIndexer,
+			"chIndexer":  p.chIndexer,
 		},
 	}
 
@@ -603,12 +646,34 @@ func NewProbe(g *graph.Graph, address string) (probe.Handler, error) {
 	p.ifaceLinker = graph.NewMetadataIndexerLinker(g, p.ifaces, lpIndexer2, graph.Metadata{"RelationType": "mapping"})
 	p.bundle.AddHandler("ifaceLinker", p.ifaceLinker)
 
+	// Link the chassis to the host nodes with the same name
+	chassisHostIndexer := graph.NewMetadataIndexer(g, p.chIndexer, nil, "OVN.Hostname")
+	p.bundle.AddHandler("chassisHostIndexer", chassisHostIndexer)
+
+	hostIndexer := graph.NewMetadataIndexer(g, g, graph.Metadata{"Type": "host"}, "Name")
+	p.bundle.AddHandler("hostIndexer", hostIndexer)
+
+	p.hostLinker = graph.NewMetadataIndexerLinker(g, chassisHostIndexer, hostIndexer, graph.Metadata{"RelationType": "mapping"})
+	p.bundle.AddHandler("hostLinker", p.hostLinker)
+
+	// Link the logical switch ports to the chassis they are bound to
+	boundPortIndexer := graph.NewMetadataIndexer(g, p.lspIndexer, nil, "OVN.Chassis")
+	p.bundle.AddHandler("boundPortIndexer", boundPortIndexer)
+
+	chassisIndexer := graph.NewMetadataIndexer(g, p.chIndexer, nil, "Name")
+	p.bundle.AddHandler("chassisIndexer", chassisIndexer)
+
+	p.bindLinker = graph.NewMetadataIndexerLinker(g, boundPortIndexer, chassisIndexer, graph.Metadata{"RelationType": "binding"})
+	p.bundle.AddHandler("bindLinker", p.bindLinker)
+
 	// Handle linkers errors
 	p.aclLinker.AddEventListener(p)
 	p.rpLinker.AddEventListener(p)
 	p.spLinker.AddEventListener(p)
 	p.srLinker.AddEventListener(p)
 	p.ifaceLinker.AddEventListener(p)
+	p.hostLinker.AddEventListener(p)
+	p.bindLinker.AddEventListener(p)
 
 	return probes.NewProbeWrapper(p), nil
 }
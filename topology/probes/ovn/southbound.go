@@ -0,0 +1,204 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ovn
+
+import (
+	"reflect"
+
+	"github.com/socketplane/libovsdb"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// sbNotifier forwards the updates of the OVN southbound database to the probe
+type sbNotifier struct {
+	probe *Probe
+}
+
+// Update is called when rows of the southbound database are modified
+func (n *sbNotifier) Update(context interface{}, tableUpdates libovsdb.TableUpdates) {
+	n.probe.eventChan <- func() { n.probe.onSouthboundUpdate(&tableUpdates) }
+}
+
+// Locked is required by the libovsdb notification handler interface
+func (n *sbNotifier) Locked([]interface{}) {
+}
+
+// Stolen is required by the libovsdb notification handler interface
+func (n *sbNotifier) Stolen([]interface{}) {
+}
+
+// Echo is required by the libovsdb notification handler interface
+func (n *sbNotifier) Echo([]interface{}) {
+}
+
+// Disconnected is called when the connection to the southbound database is lost
+func (n *sbNotifier) Disconnected(c *libovsdb.OvsdbClient) {
+	logging.GetLogger().Warning("disconnected from the OVN southbound database")
+}
+
+func ovsMapToMetadata(m interface{}) map[string]interface{} {
+	metadata := make(map[string]interface{})
+	if ovsMap, ok := m.(libovsdb.OvsMap); ok {
+		for k, v := range ovsMap.GoMap {
+			metadata[k.(string)] = v
+		}
+	}
+	return metadata
+}
+
+// ovsRef returns the UUID of an optional reference column
+func ovsRef(field interface{}) string {
+	switch ref := field.(type) {
+	case libovsdb.UUID:
+		return ref.GoUUID
+	case libovsdb.OvsSet:
+		if len(ref.GoSet) > 0 {
+			if uuid, ok := ref.GoSet[0].(libovsdb.UUID); ok {
+				return uuid.GoUUID
+			}
+		}
+	}
+	return ""
+}
+
+func (p *Probe) chassisMetadata(uuid string, row *libovsdb.Row) graph.Metadata {
+	name, _ := row.Fields["name"].(string)
+	hostname, _ := row.Fields["hostname"].(string)
+
+	return graph.Metadata{
+		"Type":    "chassis",
+		"Name":    name,
+		"Manager": "ovn",
+		"UUID":    uuid,
+		"OVN": &Metadata{
+			ChassisMetadata: ChassisMetadata{
+				Hostname: hostname,
+			},
+			ExtID: common.NormalizeValue(ovsMapToMetadata(row.Fields["external_ids"])).(map[string]interface{}),
+		},
+	}
+}
+
+// portBinding describes the binding of a logical switch port to a chassis
+type portBinding struct {
+	port    string
+	chassis string // UUID of the chassis
+}
+
+// bindPort sets the chassis a logical switch port is bound to
+func (p *Probe) bindPort(name, chassis string) {
+	if p.portChassis[name] == chassis {
+		return
+	}
+
+	if chassis == "" {
+		delete(p.portChassis, name)
+	} else {
+		p.portChassis[name] = chassis
+	}
+
+	if lp, found := p.lsps[name]; found {
+		p.registerNode(p.lspIndexer, lp.UUID, p.logicalPortMetadata(lp))
+	}
+}
+
+// rebindChassis updates the ports bound to a chassis which was added,
+// renamed or deleted, the port bindings possibly referencing a chassis
+// before it is reported
+func (p *Probe) rebindChassis(uuid string) {
+	for _, binding := range p.bindings {
+		if binding.chassis == uuid {
+			p.bindPort(binding.port, p.chassisName[uuid])
+		}
+	}
+}
+
+func (p *Probe) onSouthboundUpdate(updates *libovsdb.TableUpdates) {
+	empty := libovsdb.Row{}
+
+	// chassis have to be known before handling the port bindings
+	// referencing them
+	for uuid, row := range updates.Updates["Chassis"].Rows {
+		if reflect.DeepEqual(row.New, empty) {
+			delete(p.chassisName, uuid)
+			p.unregisterNode(p.chIndexer, uuid)
+			p.rebindChassis(uuid)
+			continue
+		}
+
+		name, _ := row.New.Fields["name"].(string)
+		p.chassisName[uuid] = name
+		p.registerNode(p.chIndexer, uuid, p.chassisMetadata(uuid, &row.New))
+		p.rebindChassis(uuid)
+	}
+
+	for uuid, row := range updates.Updates["Port_Binding"].Rows {
+		if reflect.DeepEqual(row.New, empty) {
+			if binding, found := p.bindings[uuid]; found {
+				delete(p.bindings, uuid)
+				p.bindPort(binding.port, "")
+			}
+			continue
+		}
+
+		name, _ := row.New.Fields["logical_port"].(string)
+		binding := &portBinding{port: name, chassis: ovsRef(row.New.Fields["chassis"])}
+		p.bindings[uuid] = binding
+		p.bindPort(binding.port, p.chassisName[binding.chassis])
+	}
+}
+
+// monitorSouthbound connects to the OVN southbound database and monitors
+// the chassis and the port bindings
+func (p *Probe) monitorSouthbound() error {
+	protocol, target, err := common.ParseAddr(p.sbAddress)
+	if err != nil {
+		return err
+	}
+
+	client, err := libovsdb.ConnectUsingProtocol(protocol, target)
+	if err != nil {
+		return err
+	}
+	client.Register(&sbNotifier{probe: p})
+
+	requests := map[string]libovsdb.MonitorRequest{
+		"Chassis": {
+			Columns: []string{"name", "hostname", "external_ids"},
+			Select:  libovsdb.MonitorSelect{Initial: true, Insert: true, Delete: true, Modify: true},
+		},
+		"Port_Binding": {
+			Columns: []string{"logical_port", "chassis"},
+			Select:  libovsdb.MonitorSelect{Initial: true, Insert: true, Delete: true, Modify: true},
+		},
+	}
+
+	updates, err := client.Monitor("OVN_Southbound", "", requests)
+	if err != nil {
+		client.Disconnect()
+		return err
+	}
+
+	p.sbClient = client
+	p.eventChan <- func() { p.onSouthboundUpdate(updates) }
+
+	return nil
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ovn
+
+import (
+	"testing"
+
+	goovn "github.com/ebay/go-ovn"
+	"github.com/socketplane/libovsdb"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+func newTestProbe(t *testing.T) *Probe {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.AnalyzerService)
+
+	return &Probe{
+		graph:       g,
+		lspIndexer:  graph.NewIndexer(g, nil, uuidHasher, false),
+		chIndexer:   graph.NewIndexer(g, nil, uuidHasher, false),
+		lsps:        make(map[string]*goovn.LogicalSwitchPort),
+		portChassis: make(map[string]string),
+		chassisName: make(map[string]string),
+		bindings:    make(map[string]*portBinding),
+	}
+}
+
+func addLogicalPort(p *Probe, uuid, name string) {
+	lp := &goovn.LogicalSwitchPort{UUID: uuid, Name: name}
+	p.lsps[lp.Name] = lp
+	p.registerNode(p.lspIndexer, lp.UUID, p.logicalPortMetadata(lp))
+}
+
+// tableUpdate returns the update of rows of a table, an empty row standing
+// for a deleted one
+func tableUpdate(table string, rows map[string]libovsdb.Row) *libovsdb.TableUpdates {
+	update := libovsdb.TableUpdate{Rows: make(map[string]libovsdb.RowUpdate)}
+	for uuid, row := range rows {
+		update.Rows[uuid] = libovsdb.RowUpdate{New: row}
+	}
+	return &libovsdb.TableUpdates{Updates: map[string]libovsdb.TableUpdate{table: update}}
+}
+
+func chassisRow(name string) libovsdb.Row {
+	return libovsdb.Row{Fields: map[string]interface{}{"name": name, "hostname": name + ".example.com"}}
+}
+
+func bindingRow(port, chassis string) libovsdb.Row {
+	return libovsdb.Row{Fields: map[string]interface{}{"logical_port": port, "chassis": libovsdb.UUID{GoUUID: chassis}}}
+}
+
+func portChassis(p *Probe, uuid string) string {
+	p.graph.RLock()
+	defer p.graph.RUnlock()
+
+	node, _ := p.lspIndexer.GetNode(uuid)
+	if node == nil {
+		return ""
+	}
+	chassis, _ := node.GetFieldString("OVN.Chassis")
+	return chassis
+}
+
+func TestPortBinding(t *testing.T) {
+	p := newTestProbe(t)
+	addLogicalPort(p, "lsp1", "port1")
+
+	// the binding references a chassis not reported yet
+	p.onSouthboundUpdate(tableUpdate("Port_Binding", map[string]libovsdb.Row{"pb1": bindingRow("port1", "ch1")}))
+	if chassis := portChassis(p, "lsp1"); chassis != "" {
+		t.Errorf("Expected the port to be unbound, got chassis '%s'", chassis)
+	}
+
+	p.onSouthboundUpdate(tableUpdate("Chassis", map[string]libovsdb.Row{"ch1": chassisRow("chassis1")}))
+	if chassis := portChassis(p, "lsp1"); chassis != "chassis1" {
+		t.Errorf("Expected the port to be bound to chassis1, got '%s'", chassis)
+	}
+
+	p.onSouthboundUpdate(tableUpdate("Chassis", map[string]libovsdb.Row{"ch1": chassisRow("chassis2")}))
+	if chassis := portChassis(p, "lsp1"); chassis != "chassis2" {
+		t.Errorf("Expected the port to follow the renamed chassis, got '%s'", chassis)
+	}
+
+	p.onSouthboundUpdate(tableUpdate("Chassis", map[string]libovsdb.Row{"ch1": {}}))
+	if chassis := portChassis(p, "lsp1"); chassis != "" {
+		t.Errorf("Expected the port to be unbound from the deleted chassis, got '%s'", chassis)
+	}
+	if node, _ := p.chIndexer.GetNode("ch1"); node != nil {
+		t.Error("Expected the chassis node to be removed")
+	}
+
+	p.onSouthboundUpdate(tableUpdate("Chassis", map[string]libovsdb.Row{"ch1": chassisRow("chassis1")}))
+	if chassis := portChassis(p, "lsp1"); chassis != "chassis1" {
+		t.Errorf("Expected the port to be bound to the chassis added again, got '%s'", chassis)
+	}
+
+	p.onSouthboundUpdate(tableUpdate("Port_Binding", map[string]libovsdb.Row{"pb1": {}}))
+	if chassis := portChassis(p, "lsp1"); chassis != "" {
+		t.Errorf("Expected the port to be unbound once its binding is deleted, got '%s'", chassis)
+	}
+}
+
+func TestPortBindingMove(t *testing.T) {
+	p := newTestProbe(t)
+
+	p.onSouthboundUpdate(tableUpdate("Chassis", map[string]libovsdb.Row{"ch1": chassisRow("chassis1"), "ch2": chassisRow("chassis2")}))
+	p.onSouthboundUpdate(tableUpdate("Port_Binding", map[string]libovsdb.Row{"pb1": bindingRow("port1", "ch1")}))
+
+	// the logical port is reported after its binding
+	addLogicalPort(p, "lsp1", "port1")
+	if chassis := portChassis(p, "lsp1"); chassis != "chassis1" {
+		t.Errorf("Expected the port to be bound to chassis1, got '%s'", chassis)
+	}
+
+	// the port migrates to an other chassis
+	p.onSouthboundUpdate(tableUpdate("Port_Binding", map[string]libovsdb.Row{"pb1": bindingRow("port1", "ch2")}))
+	if chassis := portChassis(p, "lsp1"); chassis != "chassis2" {
+		t.Errorf("Expected the port to be bound to chassis2, got '%s'", chassis)
+	}
+
+	// the deletion of the previous chassis doesn't affect the port
+	p.onSouthboundUpdate(tableUpdate("Chassis", map[string]libovsdb.Row{"ch1": {}}))
+	if chassis := portChassis(p, "lsp1"); chassis != "chassis2" {
+		t.Errorf("Expected the port to stay bound to chassis2, got '%s'", chassis)
+	}
+}
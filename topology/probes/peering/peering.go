@@ -23,13 +23,20 @@ import (
 	"github.com/skydive-project/skydive/topology"
 )
 
-// Probe describes graph peering based on MAC address and graph events
+// Probe describes graph peering based on MAC address and graph events. It
+// also links the WireGuard interfaces and the IPsec tunnels to their peers.
 type Probe struct {
 	graph.DefaultGraphListener
 	graph              *graph.Graph
 	peerIntfMACIndexer *graph.MetadataIndexer
 	macIndexer         *graph.MetadataIndexer
 	linker             *graph.MetadataIndexerLinker
+	wgPeerIndexer      *graph.MetadataIndexer
+	wgKeyIndexer       *graph.MetadataIndexer
+	wgLinker           *graph.MetadataIndexerLinker
+	ipsecIndexer       *graph.MetadataIndexer
+	ipsecPeerIndexer   *graph.MetadataIndexer
+	ipsecLinker        *graph.MetadataIndexerLinker
 }
 
 // Start the MAC peering resolver probe
@@ -37,6 +44,12 @@ func (p *Probe) Start() error {
 	p.peerIntfMACIndexer.Start()
 	p.macIndexer.Start()
 	p.linker.Start()
+	p.wgPeerIndexer.Start()
+	p.wgKeyIndexer.Start()
+	p.wgLinker.Start()
+	p.ipsecIndexer.Start()
+	p.ipsecPeerIndexer.Start()
+	p.ipsecLinker.Start()
 	return nil
 }
 
@@ -45,6 +58,12 @@ func (p *Probe) Stop() {
 	p.peerIntfMACIndexer.Stop()
 	p.macIndexer.Stop()
 	p.linker.Stop()
+	p.wgPeerIndexer.Stop()
+	p.wgKeyIndexer.Stop()
+	p.wgLinker.Stop()
+	p.ipsecIndexer.Stop()
+	p.ipsecPeerIndexer.Stop()
+	p.ipsecLinker.Stop()
 }
 
 // OnError implements the LinkerEventListener interface
@@ -59,13 +78,32 @@ func NewProbe(g *graph.Graph) *Probe {
 
 	linker := graph.NewMetadataIndexerLinker(g, peerIntfMACIndexer, macIndexer, graph.Metadata{"RelationType": topology.Layer2Link})
 
+	wgFilter := graph.Metadata{"Type": "wireguard"}
+	wgPeerIndexer := graph.NewMetadataIndexer(g, g, wgFilter, "WireGuard.Peers.PublicKey")
+	wgKeyIndexer := graph.NewMetadataIndexer(g, g, wgFilter, "WireGuard.PublicKey")
+	wgLinker := graph.NewMetadataIndexerLinker(g, wgPeerIndexer, wgKeyIndexer, graph.Metadata{"RelationType": "wireguard"})
+
+	// the local endpoint of a tunnel is the remote one of its peer
+	ipsecFilter := graph.Metadata{"Type": "ipsec"}
+	ipsecIndexer := graph.NewMetadataIndexer(g, g, ipsecFilter, "IPsec.Local", "IPsec.Remote")
+	ipsecPeerIndexer := graph.NewMetadataIndexer(g, g, ipsecFilter, "IPsec.Remote", "IPsec.Local")
+	ipsecLinker := graph.NewMetadataIndexerLinker(g, ipsecIndexer, ipsecPeerIndexer, graph.Metadata{"RelationType": "ipsec"})
+
 	probe := &Probe{
 		graph:              g,
 		peerIntfMACIndexer: peerIntfMACIndexer,
 		macIndexer:         macIndexer,
 		linker:             linker,
+		wgPeerIndexer:      wgPeerIndexer,
+		wgKeyIndexer:       wgKeyIndexer,
+		wgLinker:           wgLinker,
+		ipsecIndexer:       ipsecIndexer,
+		ipsecPeerIndexer:   ipsecPeerIndexer,
+		ipsecLinker:        ipsecLinker,
 	}
 	linker.AddEventListener(probe)
+	wgLinker.AddEventListener(probe)
+	ipsecLinker.AddEventListener(probe)
 
 	return probe
 }
@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package snmp
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+// Metadata describes a network device or one of its interfaces as reported
+// by its SNMP agent
+// easyjson:json
+// gendecoder
+type Metadata struct {
+	Address     string      `json:",omitempty"`
+	SysName     string      `json:",omitempty"`
+	SysDescr    string      `json:",omitempty"`
+	SysObjectID string      `json:",omitempty"`
+	ChassisID   string      `json:",omitempty"`
+	IfIndex     int64       `json:",omitempty"`
+	Descr       string      `json:",omitempty"`
+	Speed       int64       `json:",omitempty"`
+	FDB         []string    `json:",omitempty"`
+	Neighbors   []*Neighbor `json:",omitempty"`
+}
+
+// Neighbor describes a neighbor reported by the LLDP MIB of a device
+// easyjson:json
+// gendecoder
+type Neighbor struct {
+	ChassisID string `json:",omitempty"`
+	PortID    string `json:",omitempty"`
+	SysName   string `json:",omitempty"`
+}
+
+// MetadataDecoder implements a json message raw decoder
+func MetadataDecoder(raw json.RawMessage) (common.Getter, error) {
+	var m Metadata
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal SNMP metadata %s: %s", string(raw), err)
+	}
+
+	return &m, nil
+}
@@ -0,0 +1,660 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/soniah/gosnmp"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/probe"
+	"github.com/skydive-project/skydive/topology"
+	tp "github.com/skydive-project/skydive/topology/probes"
+)
+
+// Manager of the SNMP nodes
+const Manager = "snmp"
+
+const (
+	sysDescrOID    = ".1.3.6.1.2.1.1.1.0"
+	sysObjectIDOID = ".1.3.6.1.2.1.1.2.0"
+	sysNameOID     = ".1.3.6.1.2.1.1.5.0"
+
+	ifDescrOID       = ".1.3.6.1.2.1.2.2.1.2"
+	ifMtuOID         = ".1.3.6.1.2.1.2.2.1.4"
+	ifSpeedOID       = ".1.3.6.1.2.1.2.2.1.5"
+	ifPhysAddressOID = ".1.3.6.1.2.1.2.2.1.6"
+	ifOperStatusOID  = ".1.3.6.1.2.1.2.2.1.8"
+	ifInDiscardsOID  = ".1.3.6.1.2.1.2.2.1.13"
+	ifInErrorsOID    = ".1.3.6.1.2.1.2.2.1.14"
+	ifOutDiscardsOID = ".1.3.6.1.2.1.2.2.1.19"
+	ifOutErrorsOID   = ".1.3.6.1.2.1.2.2.1.20"
+
+	ifNameOID            = ".1.3.6.1.2.1.31.1.1.1.1"
+	ifHCInOctetsOID      = ".1.3.6.1.2.1.31.1.1.1.6"
+	ifHCInUcastPktsOID   = ".1.3.6.1.2.1.31.1.1.1.7"
+	ifHCOutOctetsOID     = ".1.3.6.1.2.1.31.1.1.1.10"
+	ifHCOutUcastPktsOID  = ".1.3.6.1.2.1.31.1.1.1.11"
+	ifHighSpeedOID       = ".1.3.6.1.2.1.31.1.1.1.15"
+	dot1dBasePortIfIndex = ".1.3.6.1.2.1.17.1.4.1.2"
+	dot1dTpFdbPortOID    = ".1.3.6.1.2.1.17.4.3.1.2"
+
+	lldpLocChassisIDOID = ".1.0.8802.1.1.2.1.3.2.0"
+	lldpLocPortIDOID    = ".1.0.8802.1.1.2.1.3.7.1.3"
+	lldpRemChassisIDOID = ".1.0.8802.1.1.2.1.4.1.1.5"
+	lldpRemPortIDOID    = ".1.0.8802.1.1.2.1.4.1.1.7"
+	lldpRemSysNameOID   = ".1.0.8802.1.1.2.1.4.1.1.9"
+)
+
+// Probe describes a probe that polls a list of switches and routers over
+// SNMP and reports them with their interfaces, their forwarding databases
+// and their LLDP neighbors
+type Probe struct {
+	*tp.ProbeWrapper
+	graph        *graph.Graph
+	targets      []string
+	community    string
+	version      gosnmp.SnmpVersion
+	timeout      time.Duration
+	pollInterval time.Duration
+	devices      map[string]*syncState
+	bundle       *probe.Bundle
+}
+
+// syncState holds the nodes and edges reported by one poll of a device
+type syncState struct {
+	nodes map[graph.Identifier]*graph.Node
+	edges map[graph.Identifier]*graph.Edge
+}
+
+// iface holds the interface of a device as reported by its SNMP agent
+type iface struct {
+	name     string
+	mac      string
+	mtu      int64
+	state    string
+	metadata *Metadata
+	metric   *topology.InterfaceMetric
+}
+
+// device holds the result of the poll of a device
+type device struct {
+	address  string
+	metadata *Metadata
+	ports    map[int64]*iface
+}
+
+// walk retrieves a table, indexed by the OID suffix of its entries
+func walk(client *gosnmp.GoSNMP, oid string) (map[string]interface{}, error) {
+	walkAll := client.BulkWalkAll
+	if client.Version == gosnmp.Version1 {
+		walkAll = client.WalkAll
+	}
+
+	pdus, err := walkAll(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{}, len(pdus))
+	for _, pdu := range pdus {
+		values[strings.TrimPrefix(pdu.Name, oid+".")] = pdu.Value
+	}
+	return values, nil
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case []byte:
+		return strings.TrimRight(string(v), "\x00")
+	case string:
+		return v
+	}
+	return ""
+}
+
+func toInt64(value interface{}) int64 {
+	if value == nil {
+		return 0
+	}
+	return gosnmp.ToBigInt(value).Int64()
+}
+
+func toMAC(value interface{}) string {
+	if b, ok := value.([]byte); ok && len(b) == 6 {
+		return net.HardwareAddr(b).String()
+	}
+	return ""
+}
+
+// indexToMAC converts the index of a dot1dTpFdbTable entry, the decimal
+// notation of the MAC address, to its usual notation
+func indexToMAC(index string) string {
+	fields := strings.Split(index, ".")
+	if len(fields) != 6 {
+		return ""
+	}
+
+	mac := make(net.HardwareAddr, 6)
+	for i, field := range fields {
+		b, err := strconv.ParseUint(field, 10, 8)
+		if err != nil {
+			return ""
+		}
+		mac[i] = byte(b)
+	}
+	return mac.String()
+}
+
+// chassisID returns the chassis or port ID reported by the LLDP MIB,
+// using the usual notation when it is a MAC address
+func chassisID(value interface{}) string {
+	if mac := toMAC(value); mac != "" {
+		return mac
+	}
+	return toString(value)
+}
+
+func operStatus(value interface{}) string {
+	if toInt64(value) == 1 {
+		return "UP"
+	}
+	return "DOWN"
+}
+
+func (p *Probe) newClient(target string) (*gosnmp.GoSNMP, error) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		host, portStr = target, "161"
+	}
+
+	udpPort, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SNMP target %s: %s", target, err)
+	}
+
+	client := &gosnmp.GoSNMP{
+		Target:    host,
+		Port:      uint16(udpPort),
+		Community: p.community,
+		Version:   p.version,
+		Timeout:   p.timeout,
+		Retries:   1,
+	}
+
+	return client, client.Connect()
+}
+
+func (p *Probe) pollInterfaces(client *gosnmp.GoSNMP, dev *device) error {
+	descrs, err := walk(client, ifDescrOID)
+	if err != nil {
+		return err
+	}
+
+	columns := make(map[string]map[string]interface{})
+	for _, oid := range []string{ifNameOID, ifMtuOID, ifSpeedOID, ifHighSpeedOID, ifPhysAddressOID, ifOperStatusOID,
+		ifInDiscardsOID, ifInErrorsOID, ifOutDiscardsOID, ifOutErrorsOID,
+		ifHCInOctetsOID, ifHCInUcastPktsOID, ifHCOutOctetsOID, ifHCOutUcastPktsOID} {
+		// devices not implementing the IF-MIB extensions return no entries
+		if columns[oid], err = walk(client, oid); err != nil {
+			return err
+		}
+	}
+
+	for index, descr := range descrs {
+		ifIndex, err := strconv.ParseInt(index, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		speed := toInt64(columns[ifSpeedOID][index])
+		if highSpeed := toInt64(columns[ifHighSpeedOID][index]); highSpeed > 0 {
+			speed = highSpeed * 1000000
+		}
+
+		name := toString(columns[ifNameOID][index])
+		if name == "" {
+			name = toString(descr)
+		}
+
+		dev.ports[ifIndex] = &iface{
+			name:  name,
+			mac:   toMAC(columns[ifPhysAddressOID][index]),
+			mtu:   toInt64(columns[ifMtuOID][index]),
+			state: operStatus(columns[ifOperStatusOID][index]),
+			metadata: &Metadata{
+				IfIndex: ifIndex,
+				Descr:   toString(descr),
+				Speed:   speed,
+			},
+			metric: &topology.InterfaceMetric{
+				RxBytes:   toInt64(columns[ifHCInOctetsOID][index]),
+				RxPackets: toInt64(columns[ifHCInUcastPktsOID][index]),
+				RxErrors:  toInt64(columns[ifInErrorsOID][index]),
+				RxDropped: toInt64(columns[ifInDiscardsOID][index]),
+				TxBytes:   toInt64(columns[ifHCOutOctetsOID][index]),
+				TxPackets: toInt64(columns[ifHCOutUcastPktsOID][index]),
+				TxErrors:  toInt64(columns[ifOutErrorsOID][index]),
+				TxDropped: toInt64(columns[ifOutDiscardsOID][index]),
+			},
+		}
+	}
+
+	return nil
+}
+
+func (p *Probe) pollFDB(client *gosnmp.GoSNMP, dev *device) error {
+	basePorts, err := walk(client, dot1dBasePortIfIndex)
+	if err != nil {
+		return err
+	}
+
+	entries, err := walk(client, dot1dTpFdbPortOID)
+	if err != nil {
+		return err
+	}
+
+	for index, basePort := range entries {
+		mac := indexToMAC(index)
+		if mac == "" {
+			continue
+		}
+
+		ifIndex := toInt64(basePorts[strconv.FormatInt(toInt64(basePort), 10)])
+		if port, found := dev.ports[ifIndex]; found {
+			port.metadata.FDB = append(port.metadata.FDB, mac)
+		}
+	}
+
+	for _, port := range dev.ports {
+		sort.Strings(port.metadata.FDB)
+	}
+
+	return nil
+}
+
+func (p *Probe) pollLLDP(client *gosnmp.GoSNMP, dev *device) error {
+	result, err := client.Get([]string{lldpLocChassisIDOID})
+	if err == nil && len(result.Variables) > 0 {
+		dev.metadata.ChassisID = chassisID(result.Variables[0].Value)
+	}
+
+	localPorts, err := walk(client, lldpLocPortIDOID)
+	if err != nil {
+		return err
+	}
+
+	columns := make(map[string]map[string]interface{})
+	for _, oid := range []string{lldpRemChassisIDOID, lldpRemPortIDOID, lldpRemSysNameOID} {
+		if columns[oid], err = walk(client, oid); err != nil {
+			return err
+		}
+	}
+
+	// the local port number is usually the interface index, otherwise
+	// the local port ID is the name of the interface
+	portsByName := make(map[string]*iface)
+	for _, port := range dev.ports {
+		portsByName[port.name] = port
+	}
+
+	for index, remChassisID := range columns[lldpRemChassisIDOID] {
+		// index is made of the time mark, the local port number and the
+		// neighbor index
+		fields := strings.Split(index, ".")
+		if len(fields) != 3 {
+			continue
+		}
+
+		localPort, found := portsByName[toString(localPorts[fields[1]])]
+		if !found {
+			portNum, _ := strconv.ParseInt(fields[1], 10, 64)
+			if localPort, found = dev.ports[portNum]; !found {
+				continue
+			}
+		}
+
+		localPort.metadata.Neighbors = append(localPort.metadata.Neighbors, &Neighbor{
+			ChassisID: chassisID(remChassisID),
+			PortID:    chassisID(columns[lldpRemPortIDOID][index]),
+			SysName:   toString(columns[lldpRemSysNameOID][index]),
+		})
+	}
+
+	return nil
+}
+
+func (p *Probe) poll(target string) (*device, error) {
+	client, err := p.newClient(target)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Conn.Close()
+
+	result, err := client.Get([]string{sysDescrOID, sysObjectIDOID, sysNameOID})
+	if err != nil {
+		return nil, err
+	}
+
+	dev := &device{
+		address:  target,
+		metadata: &Metadata{Address: target},
+		ports:    make(map[int64]*iface),
+	}
+
+	for _, variable := range result.Variables {
+		switch variable.Name {
+		case sysDescrOID:
+			dev.metadata.SysDescr = toString(variable.Value)
+		case sysObjectIDOID:
+			dev.metadata.SysObjectID = toString(variable.Value)
+		case sysNameOID:
+			dev.metadata.SysName = toString(variable.Value)
+		}
+	}
+
+	if err := p.pollInterfaces(client, dev); err != nil {
+		return nil, err
+	}
+
+	// the bridge and the LLDP MIBs are optional
+	if err := p.pollFDB(client, dev); err != nil {
+		logging.GetLogger().Debugf("Failed to retrieve the forwarding database of %s: %s", target, err)
+	}
+
+	if err := p.pollLLDP(client, dev); err != nil {
+		logging.GetLogger().Debugf("Failed to retrieve the LLDP neighbors of %s: %s", target, err)
+	}
+
+	return dev, nil
+}
+
+func deviceID(address string) graph.Identifier {
+	return graph.GenID(Manager, address)
+}
+
+func portID(address string, ifIndex int64) graph.Identifier {
+	return graph.GenID(Manager, address, strconv.FormatInt(ifIndex, 10))
+}
+
+func (p *Probe) setNode(state *syncState, id graph.Identifier, m graph.Metadata) *graph.Node {
+	m["Manager"] = Manager
+	m["Probe"] = Manager
+
+	node := p.graph.GetNode(id)
+	if node == nil {
+		var err error
+		if node, err = p.graph.NewNode(id, m); err != nil {
+			logging.GetLogger().Error(err)
+			return nil
+		}
+	} else {
+		tr := p.graph.StartMetadataTransaction(node)
+		for k, v := range m {
+			tr.AddMetadata(k, v)
+		}
+		tr.Commit()
+	}
+
+	state.nodes[id] = node
+	return node
+}
+
+func (p *Probe) setLink(state *syncState, parent, child *graph.Node, relationType string) {
+	if parent == nil || child == nil {
+		return
+	}
+
+	id := graph.GenID(string(parent.ID), string(child.ID), "RelationType", relationType)
+	edge := p.graph.GetEdge(id)
+	if edge == nil {
+		var err error
+		if edge, err = p.graph.NewEdge(id, parent, child, graph.Metadata{"RelationType": relationType, "Manager": Manager}); err != nil {
+			logging.GetLogger().Error(err)
+			return
+		}
+	}
+
+	state.edges[id] = edge
+}
+
+func (p *Probe) syncDevice(state *syncState, dev *device, now, last time.Time) {
+	name := dev.metadata.SysName
+	if name == "" {
+		name = dev.address
+	}
+
+	devNode := p.setNode(state, deviceID(dev.address), graph.Metadata{
+		"Type": "switch",
+		"Name": name,
+		"SNMP": dev.metadata,
+	})
+
+	for ifIndex, port := range dev.ports {
+		m := graph.Metadata{
+			"Type":  "switchport",
+			"Name":  port.name,
+			"State": port.state,
+			"SNMP":  port.metadata,
+		}
+		if port.mac != "" {
+			m["MAC"] = port.mac
+		}
+		if port.mtu != 0 {
+			m["MTU"] = port.mtu
+		}
+
+		id := portID(dev.address, ifIndex)
+		if node := p.graph.GetNode(id); node != nil && !port.metric.IsZero() {
+			if prevMetric, err := node.GetField("Metric"); err == nil {
+				if lastUpdateMetric := port.metric.Sub(prevMetric.(*topology.InterfaceMetric)).(*topology.InterfaceMetric); !lastUpdateMetric.IsZero() {
+					lastUpdateMetric.Start = int64(common.UnixMillis(last))
+					lastUpdateMetric.Last = int64(common.UnixMillis(now))
+					m["LastUpdateMetric"] = lastUpdateMetric
+				}
+			}
+		}
+		if !port.metric.IsZero() {
+			port.metric.Last = int64(common.UnixMillis(now))
+			m["Metric"] = port.metric
+		}
+
+		portNode := p.setNode(state, id, m)
+		p.setLink(state, devNode, portNode, topology.OwnershipLink)
+	}
+}
+
+// syncNeighbors links the ports of a device to the ports of the other polled
+// devices reported as their LLDP neighbors
+func (p *Probe) syncNeighbors(state *syncState, dev *device, devices map[string]*device) {
+	for ifIndex, port := range dev.ports {
+		for _, neighbor := range port.metadata.Neighbors {
+			for _, remote := range devices {
+				if remote.metadata.ChassisID == "" || remote.metadata.ChassisID != neighbor.ChassisID {
+					continue
+				}
+
+				for remoteIndex, remotePort := range remote.ports {
+					if neighbor.PortID == remotePort.name || neighbor.PortID == remotePort.mac || neighbor.PortID == remotePort.metadata.Descr {
+						// only one of the two devices creates the link
+						if string(portID(dev.address, ifIndex)) < string(portID(remote.address, remoteIndex)) {
+							p.setLink(state, p.graph.GetNode(portID(dev.address, ifIndex)), p.graph.GetNode(portID(remote.address, remoteIndex)), topology.Layer2Link)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func (p *Probe) update(last time.Time) {
+	devices := make(map[string]*device)
+	for _, target := range p.targets {
+		dev, err := p.poll(target)
+		if err != nil {
+			logging.GetLogger().Errorf("Failed to poll SNMP device %s: %s", target, err)
+			continue
+		}
+		devices[target] = dev
+	}
+	now := time.Now()
+
+	p.graph.Lock()
+	defer p.graph.Unlock()
+
+	states := make(map[string]*syncState)
+	for target, dev := range devices {
+		state := &syncState{
+			nodes: make(map[graph.Identifier]*graph.Node),
+			edges: make(map[graph.Identifier]*graph.Edge),
+		}
+		p.syncDevice(state, dev, now, last)
+		states[target] = state
+	}
+
+	// all the ports have to be known before linking the neighbors
+	for target, dev := range devices {
+		p.syncNeighbors(states[target], dev, devices)
+	}
+
+	// the elements of the unreachable devices are kept until they answer
+	// again, the ones of the others are replaced by the new state
+	for target, state := range states {
+		if prev, found := p.devices[target]; found {
+			for id, edge := range prev.edges {
+				if _, found := state.edges[id]; !found && p.graph.GetEdge(id) != nil {
+					if err := p.graph.DelEdge(edge); err != nil {
+						logging.GetLogger().Error(err)
+					}
+				}
+			}
+
+			for id, node := range prev.nodes {
+				if _, found := state.nodes[id]; !found && p.graph.GetNode(id) != nil {
+					if err := p.graph.DelNode(node); err != nil {
+						logging.GetLogger().Error(err)
+					}
+				}
+			}
+		}
+		p.devices[target] = state
+	}
+}
+
+// Do polls the SNMP devices
+func (p *Probe) Do(ctx context.Context, wg *sync.WaitGroup) error {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		last := time.Now()
+		p.update(last)
+
+		ticker := time.NewTicker(p.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				p.update(last)
+				last = now
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Start the SNMP probe
+func (p *Probe) Start() error {
+	if err := p.bundle.Start(); err != nil {
+		return err
+	}
+	return p.ProbeWrapper.Start()
+}
+
+// Stop the SNMP probe
+func (p *Probe) Stop() {
+	p.ProbeWrapper.Stop()
+	p.bundle.Stop()
+}
+
+// NewProbe returns a new SNMP topology probe
+func NewProbe(g *graph.Graph) (probe.Handler, error) {
+	var version gosnmp.SnmpVersion
+	switch v := config.GetString("analyzer.topology.snmp.version"); v {
+	case "1":
+		version = gosnmp.Version1
+	case "2c":
+		version = gosnmp.Version2c
+	default:
+		return nil, fmt.Errorf("unsupported SNMP version %s", v)
+	}
+
+	p := &Probe{
+		graph:        g,
+		targets:      config.GetStringSlice("analyzer.topology.snmp.targets"),
+		community:    config.GetString("analyzer.topology.snmp.community"),
+		version:      version,
+		timeout:      time.Duration(config.GetInt("analyzer.topology.snmp.timeout")) * time.Second,
+		pollInterval: time.Duration(config.GetInt("analyzer.topology.snmp.poll_interval")) * time.Second,
+		devices:      make(map[string]*syncState),
+		bundle:       probe.NewBundle(),
+	}
+	p.ProbeWrapper = tp.NewProbeWrapper(p)
+
+	// link the ports to the interfaces, reported by the agents, whose MAC
+	// address has been learnt on them
+	fdbIndexer := graph.NewMetadataIndexer(g, g, graph.Metadata{"Type": "switchport", "Manager": Manager}, "SNMP.FDB")
+	p.bundle.AddHandler("fdbIndexer", fdbIndexer)
+
+	intfIndexer := graph.NewMetadataIndexer(g, g, graph.Metadata{"Type": "device"}, "MAC")
+	p.bundle.AddHandler("intfIndexer", intfIndexer)
+
+	p.bundle.AddHandler("fdbLinker", graph.NewMetadataIndexerLinker(g, fdbIndexer, intfIndexer, graph.Metadata{"RelationType": topology.Layer2Link, "Type": "fdb"}))
+
+	// map the devices to the switches discovered by the LLDP probe of the
+	// agents
+	chassisIndexer := graph.NewMetadataIndexer(g, g, graph.Metadata{"Type": "switch", "Manager": Manager}, "SNMP.ChassisID")
+	p.bundle.AddHandler("chassisIndexer", chassisIndexer)
+
+	lldpIndexer := graph.NewMetadataIndexer(g, g, graph.Metadata{"Type": "switch", "Probe": "lldp"}, "LLDP.ChassisID")
+	p.bundle.AddHandler("lldpIndexer", lldpIndexer)
+
+	p.bundle.AddHandler("chassisLinker", graph.NewMetadataIndexerLinker(g, chassisIndexer, lldpIndexer, graph.Metadata{"RelationType": "mapping"}))
+
+	return p, nil
+}
+
+// Register registers graph metadata decoders
+func Register() {
+	graph.NodeMetadataDecoders["SNMP"] = MetadataDecoder
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package snmp
+
+import "testing"
+
+func TestIndexToMAC(t *testing.T) {
+	if mac := indexToMAC("0.80.86.171.205.239"); mac != "00:50:56:ab:cd:ef" {
+		t.Errorf("Wrong MAC address, got: %s", mac)
+	}
+
+	for _, index := range []string{"0.80.86.171.205", "0.80.86.171.205.256", "a.b.c.d.e.f"} {
+		if mac := indexToMAC(index); mac != "" {
+			t.Errorf("Index %s should not be converted, got: %s", index, mac)
+		}
+	}
+}
+
+func TestChassisID(t *testing.T) {
+	if id := chassisID([]byte{0x00, 0x50, 0x56, 0xab, 0xcd, 0xef}); id != "00:50:56:ab:cd:ef" {
+		t.Errorf("Wrong chassis ID, got: %s", id)
+	}
+
+	if id := chassisID([]byte("Ethernet1/1")); id != "Ethernet1/1" {
+		t.Errorf("Wrong port ID, got: %s", id)
+	}
+}
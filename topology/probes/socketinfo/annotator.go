@@ -0,0 +1,98 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package socketinfo
+
+import (
+	"net"
+
+	"github.com/skydive-project/skydive/flow"
+)
+
+// FlowAnnotator attaches the processes owning the sockets of the endpoints
+// of the flows before forwarding them to a flow sender
+type FlowAnnotator struct {
+	connCache *ConnectionCache
+	sender    flow.Sender
+}
+
+func newFlowProcess(pi *ProcessInfo) *flow.Process {
+	if pi == nil {
+		return nil
+	}
+
+	return &flow.Process{
+		Name:        pi.Name,
+		Pid:         pi.Pid,
+		Cgroup:      pi.Cgroup,
+		ContainerID: pi.ContainerID,
+	}
+}
+
+func (a *FlowAnnotator) annotate(flows []*flow.Flow) {
+	for _, f := range flows {
+		if f.Network == nil || f.Transport == nil {
+			continue
+		}
+
+		protocol := f.Transport.Protocol
+		if protocol != flow.FlowProtocol_TCP && protocol != flow.FlowProtocol_UDP {
+			continue
+		}
+
+		ipA, ipB := net.ParseIP(f.Network.A), net.ParseIP(f.Network.B)
+		if ipA == nil || ipB == nil {
+			continue
+		}
+		portA, portB := int(f.Transport.A), int(f.Transport.B)
+
+		processA, processB := a.connCache.Map(protocol, ipA, portA, ipB, portB)
+
+		// servers using unconnected UDP sockets are only known by the
+		// address they are bound to
+		if processB == nil {
+			processB = a.connCache.MapListener(protocol, ipB, portB)
+		}
+
+		if f.ProcessA == nil {
+			f.ProcessA = newFlowProcess(processA)
+		}
+		if f.ProcessB == nil {
+			f.ProcessB = newFlowProcess(processB)
+		}
+	}
+}
+
+// SendFlows annotates and forwards the flows
+func (a *FlowAnnotator) SendFlows(flows []*flow.Flow) {
+	a.annotate(flows)
+	a.sender.SendFlows(flows)
+}
+
+// SendStats forwards the flow stats
+func (a *FlowAnnotator) SendStats(stats flow.Stats) {
+	a.sender.SendStats(stats)
+}
+
+// NewFlowAnnotator returns a new flow sender attaching the processes owning
+// the sockets of the flows
+func (p *ProbeHandler) NewFlowAnnotator(sender flow.Sender) *FlowAnnotator {
+	return &FlowAnnotator{
+		connCache: p.connCache,
+		sender:    sender,
+	}
+}
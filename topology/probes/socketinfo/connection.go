@@ -36,9 +36,11 @@ import (
 
 // ProcessInfo describes the information of a running process
 type ProcessInfo struct {
-	Process string
-	Pid     int64
-	Name    string
+	Process     string
+	Pid         int64
+	Name        string
+	Cgroup      string
+	ContainerID string
 }
 
 // ConnectionState describes the state of a connection
@@ -136,6 +138,19 @@ func (c *ConnectionCache) Map(protocol flow.FlowProtocol, srcIP net.IP, srcPort
 	return
 }
 
+// MapListener returns the process owning the listening or unconnected
+// socket bound to an address, or to the wildcard address, on a port
+func (c *ConnectionCache) MapListener(protocol flow.FlowProtocol, ip net.IP, port int) *ProcessInfo {
+	for _, local := range []net.IP{ip, net.IPv4zero, net.IPv6unspecified} {
+		for _, remote := range []net.IP{net.IPv4zero, net.IPv6unspecified} {
+			if conn, _ := c.Get(protocol, local, port, remote, 0); conn != nil {
+				return &conn.(*ConnectionInfo).ProcessInfo
+			}
+		}
+	}
+	return nil
+}
+
 // MapTCP returns the sending and receiving processes for a pair of TCP addresses
 func (c *ConnectionCache) MapTCP(srcAddr, dstAddr *net.TCPAddr) (a *ProcessInfo, b *ProcessInfo) {
 	return c.Map(flow.FlowProtocol_TCP, srcAddr.IP, srcAddr.Port, dstAddr.IP, dstAddr.Port)
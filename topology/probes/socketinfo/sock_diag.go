@@ -0,0 +1,146 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package socketinfo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	sockDiagByFamily  = 20
+	sizeofInetDiagReq = 56
+	sizeofInetDiagMsg = 72
+)
+
+// inetDiagReq describes a inet_diag_req_v2 request dumping all the sockets
+// of a family and a protocol
+type inetDiagReq struct {
+	family   uint8
+	protocol uint8
+}
+
+func (r *inetDiagReq) Len() int {
+	return sizeofInetDiagReq
+}
+
+func (r *inetDiagReq) Serialize() []byte {
+	b := make([]byte, sizeofInetDiagReq)
+	b[0] = r.family
+	b[1] = r.protocol
+	// request the sockets in all the states
+	nl.NativeEndian().PutUint32(b[4:8], ^uint32(0))
+	return b
+}
+
+// inetDiagMsg holds the fields of a inet_diag_msg used to map a socket to
+// its process
+type inetDiagMsg struct {
+	state      uint8
+	localIP    net.IP
+	localPort  uint16
+	remoteIP   net.IP
+	remotePort uint16
+	inode      uint32
+}
+
+func parseInetDiagMsg(b []byte) (*inetDiagMsg, error) {
+	if len(b) < sizeofInetDiagMsg {
+		return nil, fmt.Errorf("inet_diag message too short: %d", len(b))
+	}
+
+	ipLen := net.IPv4len
+	if b[0] == unix.AF_INET6 {
+		ipLen = net.IPv6len
+	}
+
+	return &inetDiagMsg{
+		state:      b[1],
+		localPort:  binary.BigEndian.Uint16(b[4:6]),
+		remotePort: binary.BigEndian.Uint16(b[6:8]),
+		localIP:    net.IP(append([]byte(nil), b[8:8+ipLen]...)),
+		remoteIP:   net.IP(append([]byte(nil), b[24:24+ipLen]...)),
+		inode:      nl.NativeEndian().Uint32(b[68:72]),
+	}, nil
+}
+
+// dumpSockets returns the sockets of a protocol, of both the IPv4 and IPv6
+// families, of the network namespace at the given path
+func dumpSockets(nsPath string, protocol uint8) ([]*inetDiagMsg, error) {
+	ns, err := netns.GetFromPath(nsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer ns.Close()
+
+	curNs, err := netns.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer curNs.Close()
+
+	s, err := nl.GetNetlinkSocketAt(ns, curNs, unix.NETLINK_INET_DIAG)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	var sockets []*inetDiagMsg
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		req := nl.NewNetlinkRequest(sockDiagByFamily, unix.NLM_F_DUMP)
+		req.AddData(&inetDiagReq{family: family, protocol: protocol})
+
+		if err := s.Send(req); err != nil {
+			return nil, err
+		}
+
+	done:
+		for {
+			msgs, err := s.Receive()
+			if err != nil {
+				return nil, err
+			}
+
+			for _, m := range msgs {
+				switch m.Header.Type {
+				case unix.NLMSG_DONE:
+					break done
+				case unix.NLMSG_ERROR:
+					errno := int32(nl.NativeEndian().Uint32(m.Data[0:4]))
+					return nil, syscall.Errno(-errno)
+				}
+
+				msg, err := parseInetDiagMsg(m.Data)
+				if err != nil {
+					return nil, err
+				}
+				sockets = append(sockets, msg)
+			}
+		}
+	}
+
+	return sockets, nil
+}
@@ -1,5 +1,3 @@
-// +build linux
-
 /*
  * Copyright (C) 2019 Red Hat, Inc.
  *
@@ -26,4 +24,5 @@ import (
 // ProbeHandler describes a probe that collects active connections
 type ProbeHandler struct {
 	probe.Handler
+	connCache *ConnectionCache
 }
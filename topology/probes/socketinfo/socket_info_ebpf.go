@@ -133,7 +133,8 @@ func NewProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
 	}
 
 	probeHandler := &ProbeHandler{
-		Handler: p,
+		Handler:   p,
+		connCache: procProbe.connCache,
 	}
 
 	var err error
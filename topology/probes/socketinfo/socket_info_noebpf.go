@@ -26,7 +26,10 @@ import (
 
 // NewProbe returns a new socket info topology probe
 func NewProbe(ctx tp.Context, bundle *probe.Bundle) (probe.Handler, error) {
+	procProbe := NewProcProbe(ctx)
+
 	return &ProbeHandler{
-		Handler: NewProcProbe(ctx),
+		Handler:   procProbe,
+		connCache: procProbe.connCache,
 	}, nil
 }
@@ -24,9 +24,11 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
@@ -54,10 +56,52 @@ var tcpStates = []string{
 
 // ProcProbe describes a probe that collects active connections
 type ProcProbe struct {
-	Ctx       tp.Context
-	connCache *ConnectionCache
-	quit      chan bool
-	procGlob  string
+	Ctx            tp.Context
+	connCache      *ConnectionCache
+	quit           chan bool
+	procGlob       string
+	sockDiagFailed bool
+}
+
+var containerIDRegexp = regexp.MustCompile("[0-9a-f]{64}")
+
+// getProcessCgroup returns the cgroup of a process, the one of the unified
+// hierarchy or of the cpu controller, used by the container runtimes
+func getProcessCgroup(pid int) string {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return ""
+	}
+
+	var cgroup string
+	for _, line := range strings.Split(string(data), "\n") {
+		// each line is made of hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 || fields[2] == "/" {
+			continue
+		}
+
+		for _, controller := range strings.Split(fields[1], ",") {
+			if controller == "cpu" {
+				return fields[2]
+			}
+		}
+
+		if fields[0] == "0" && fields[1] == "" {
+			cgroup = fields[2]
+		}
+	}
+
+	return cgroup
+}
+
+// getContainerID returns the ID of the container a cgroup belongs to,
+// the container runtimes naming the cgroups after the container IDs
+func getContainerID(cgroup string) string {
+	if ids := containerIDRegexp.FindAllString(cgroup, -1); len(ids) > 0 {
+		return ids[len(ids)-1]
+	}
+	return ""
 }
 
 func getProcessInfo(pid int) (*ProcessInfo, error) {
@@ -66,10 +110,14 @@ func getProcessInfo(pid int) (*ProcessInfo, error) {
 		return nil, err
 	}
 
+	cgroup := getProcessCgroup(pid)
+
 	return &ProcessInfo{
-		Process: pi.Process,
-		Name:    pi.Name,
-		Pid:     pi.Pid,
+		Process:     pi.Process,
+		Name:        pi.Name,
+		Pid:         pi.Pid,
+		Cgroup:      cgroup,
+		ContainerID: getContainerID(cgroup),
 	}, nil
 }
 
@@ -125,21 +173,7 @@ func (s *ProcProbe) scanProc() error {
 		return
 	}
 
-	parseNetEntry := func(line string) (*ConnectionInfo, error) {
-		var localIPPort, remoteIPPort string
-		var inode, ignore, state int
-
-		_, err := fmt.Sscanf(line, "%d: %s %s %x %x:%x %x:%x %x %d %d %d",
-			&ignore, &localIPPort, &remoteIPPort,
-			&state, &ignore, &ignore, &ignore, &ignore, &ignore, &ignore, &ignore,
-			&inode)
-		if err != nil {
-			return nil, err
-		}
-
-		localIP, localPort := parseProcAddr(localIPPort)
-		remoteIP, remotePort := parseProcAddr(remoteIPPort)
-
+	newConnection := func(inode int, localIP net.IP, localPort uint16, remoteIP net.IP, remotePort uint16, state int) (*ConnectionInfo, error) {
 		pid, found := inodePids[inode]
 		if !found {
 			return nil, fmt.Errorf("Could not find process for inode %d", inode)
@@ -147,6 +181,7 @@ func (s *ProcProbe) scanProc() error {
 
 		processInfo, found := processes[pid]
 		if !found {
+			var err error
 			processInfo, err = getProcessInfo(pid)
 			if err != nil {
 				return nil, fmt.Errorf("Failed to get stats for process %d", pid)
@@ -154,6 +189,10 @@ func (s *ProcProbe) scanProc() error {
 			processes[pid] = processInfo
 		}
 
+		if state >= len(tcpStates) {
+			state = 0
+		}
+
 		return &ConnectionInfo{
 			ProcessInfo:   *processInfo,
 			LocalAddress:  localIP.String(),
@@ -164,6 +203,24 @@ func (s *ProcProbe) scanProc() error {
 		}, nil
 	}
 
+	parseNetEntry := func(line string) (*ConnectionInfo, error) {
+		var localIPPort, remoteIPPort string
+		var inode, ignore, state int
+
+		_, err := fmt.Sscanf(line, "%d: %s %s %x %x:%x %x:%x %x %d %d %d",
+			&ignore, &localIPPort, &remoteIPPort,
+			&state, &ignore, &ignore, &ignore, &ignore, &ignore, &ignore, &ignore,
+			&inode)
+		if err != nil {
+			return nil, err
+		}
+
+		localIP, localPort := parseProcAddr(localIPPort)
+		remoteIP, remotePort := parseProcAddr(remoteIPPort)
+
+		return newConnection(inode, localIP, localPort, remoteIP, remotePort, state)
+	}
+
 	parseNet := func(protocol flow.FlowProtocol, path string) {
 		u, err := os.Open(path)
 		if err != nil {
@@ -209,10 +266,72 @@ func (s *ProcProbe) scanProc() error {
 		parseNet(flow.FlowProtocol_UDP, path)
 	}
 
+	// dumpNamespace retrieves the sockets of a network namespace using
+	// sock_diag, which is much faster than parsing the /proc files
+	dumpNamespace := func(nsPath string) error {
+		for _, protocol := range []flow.FlowProtocol{flow.FlowProtocol_TCP, flow.FlowProtocol_UDP} {
+			ipProtocol := uint8(syscall.IPPROTO_TCP)
+			if protocol == flow.FlowProtocol_UDP {
+				ipProtocol = syscall.IPPROTO_UDP
+			}
+
+			sockets, err := dumpSockets(nsPath, ipProtocol)
+			if err != nil {
+				return err
+			}
+
+			for _, socket := range sockets {
+				conn, err := newConnection(int(socket.inode), socket.localIP, socket.localPort, socket.remoteIP, socket.remotePort, int(socket.state))
+				if err != nil {
+					continue
+				}
+				conn.Protocol = protocol
+
+				s.connCache.Set(conn.Hash(), conn)
+			}
+		}
+		return nil
+	}
+
+	dumpNamespaces := func() error {
+		var stats syscall.Stat_t
+		if err := syscall.Stat("/proc/self/ns/net", &stats); err != nil {
+			return err
+		}
+		dumped := map[uint64]bool{stats.Ino: true}
+
+		if err := dumpNamespace("/proc/self/ns/net"); err != nil {
+			return err
+		}
+
+		d, err := filepath.Glob("/proc/[0-9]*/ns/net")
+		if err != nil {
+			return err
+		}
+
+		for _, item := range d {
+			if err := syscall.Stat(item, &stats); err != nil || dumped[stats.Ino] {
+				continue
+			}
+			dumped[stats.Ino] = true
+
+			// the process may have exited in the meantime
+			dumpNamespace(item)
+		}
+		return nil
+	}
+
 	if err := buildInodePidMap(); err != nil {
 		return err
 	}
 
+	if err := dumpNamespaces(); err == nil {
+		return nil
+	} else if !s.sockDiagFailed {
+		s.Ctx.Logger.Infof("Unable to use sock_diag, falling back to /proc parsing: %s", err)
+		s.sockDiagFailed = true
+	}
+
 	d, err := filepath.Glob(s.procGlob)
 	if err != nil {
 		return err
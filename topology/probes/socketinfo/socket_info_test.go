@@ -54,3 +54,23 @@ func TestConnectionCache(t *testing.T) {
 		t.Errorf("No entry expected for %s -> %s, got %+v", addr1.String(), addr2.String(), c)
 	}
 }
+
+func TestMapListener(t *testing.T) {
+	c := NewConnectionCache()
+	conn := &ConnectionInfo{
+		ProcessInfo:   ProcessInfo{Name: "dnsmasq", Pid: 42},
+		LocalAddress:  net.IPv4zero.String(),
+		LocalPort:     53,
+		RemoteAddress: net.IPv4zero.String(),
+		Protocol:      flow.FlowProtocol_UDP,
+	}
+	c.Set(conn.Hash(), conn)
+
+	if pi := c.MapListener(flow.FlowProtocol_UDP, net.IPv4(192, 168, 0, 1), 53); pi == nil || pi.Pid != 42 {
+		t.Errorf("Expected dnsmasq to be bound to port 53, got %+v", pi)
+	}
+
+	if pi := c.MapListener(flow.FlowProtocol_TCP, net.IPv4(192, 168, 0, 1), 53); pi != nil {
+		t.Errorf("No TCP listener expected, got %+v", pi)
+	}
+}
@@ -0,0 +1,396 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/view"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/probe"
+	"github.com/skydive-project/skydive/topology"
+	tp "github.com/skydive-project/skydive/topology/probes"
+)
+
+// Manager of the vSphere nodes
+const Manager = "vsphere"
+
+// Probe describes a probe that reports the ESXi hosts, the distributed
+// switches, their port groups and the virtual machines known by a vCenter
+type Probe struct {
+	*tp.ProbeWrapper
+	graph        *graph.Graph
+	url          *url.URL
+	insecure     bool
+	pollInterval time.Duration
+	client       *govmomi.Client
+	nodes        map[graph.Identifier]*graph.Node
+	edges        map[graph.Identifier]*graph.Edge
+	bundle       *probe.Bundle
+}
+
+// syncState holds the nodes and edges reported by one poll of the vCenter
+type syncState struct {
+	nodes map[graph.Identifier]*graph.Node
+	edges map[graph.Identifier]*graph.Edge
+}
+
+func moID(ref types.ManagedObjectReference) graph.Identifier {
+	return graph.GenID(Manager, ref.Type, ref.Value)
+}
+
+func (p *Probe) setNode(state *syncState, id graph.Identifier, m graph.Metadata) *graph.Node {
+	m["Manager"] = Manager
+
+	node := p.graph.GetNode(id)
+	if node == nil {
+		var err error
+		if node, err = p.graph.NewNode(id, m); err != nil {
+			logging.GetLogger().Error(err)
+			return nil
+		}
+	} else if err := p.graph.SetMetadata(node, m); err != nil {
+		logging.GetLogger().Error(err)
+	}
+
+	state.nodes[id] = node
+	return node
+}
+
+func (p *Probe) setLink(state *syncState, parent, child *graph.Node, relationType string) {
+	if parent == nil || child == nil {
+		return
+	}
+
+	id := graph.GenID(string(parent.ID), string(child.ID), "RelationType", relationType)
+	edge := p.graph.GetEdge(id)
+	if edge == nil {
+		var err error
+		if edge, err = p.graph.NewEdge(id, parent, child, graph.Metadata{"RelationType": relationType, "Manager": Manager}); err != nil {
+			logging.GetLogger().Error(err)
+			return
+		}
+	}
+
+	state.edges[id] = edge
+}
+
+func (p *Probe) syncHosts(state *syncState, hosts []mo.HostSystem) {
+	for _, host := range hosts {
+		metadata := &Metadata{MoRef: host.Reference().Value}
+		if hw := host.Summary.Hardware; hw != nil {
+			metadata.UUID = hw.Uuid
+		}
+		if product := host.Summary.Config.Product; product != nil {
+			metadata.Version = product.Version
+		}
+		if runtime := host.Summary.Runtime; runtime != nil {
+			metadata.ConnectionState = string(runtime.ConnectionState)
+		}
+
+		p.setNode(state, moID(host.Reference()), graph.Metadata{
+			"Type":    "esxi",
+			"Name":    host.Name,
+			"VSphere": metadata,
+		})
+	}
+}
+
+func (p *Probe) syncSwitches(state *syncState, switches []mo.VmwareDistributedVirtualSwitch) {
+	for _, dvs := range switches {
+		metadata := &Metadata{
+			MoRef: dvs.Reference().Value,
+			UUID:  dvs.Summary.Uuid,
+		}
+		if product := dvs.Summary.ProductInfo; product != nil {
+			metadata.Version = product.Version
+		}
+
+		node := p.setNode(state, moID(dvs.Reference()), graph.Metadata{
+			"Type":    "dvswitch",
+			"Name":    dvs.Name,
+			"VSphere": metadata,
+		})
+
+		for _, host := range dvs.Summary.HostMember {
+			p.setLink(state, state.nodes[moID(host)], node, topology.Layer2Link)
+		}
+	}
+}
+
+func portgroupVlan(pg *mo.DistributedVirtualPortgroup) int64 {
+	if setting, ok := pg.Config.DefaultPortConfig.(*types.VMwareDVSPortSetting); ok {
+		if spec, ok := setting.Vlan.(*types.VmwareDistributedVirtualSwitchVlanIdSpec); ok {
+			return int64(spec.VlanId)
+		}
+	}
+	return 0
+}
+
+func (p *Probe) syncPortgroups(state *syncState, portgroups []mo.DistributedVirtualPortgroup) {
+	for i, pg := range portgroups {
+		node := p.setNode(state, moID(pg.Reference()), graph.Metadata{
+			"Type": "portgroup",
+			"Name": pg.Name,
+			"VSphere": &Metadata{
+				MoRef:  pg.Reference().Value,
+				VlanID: portgroupVlan(&portgroups[i]),
+			},
+		})
+
+		if dvs := pg.Config.DistributedVirtualSwitch; dvs != nil {
+			dvsRef := *dvs
+			dvsRef.Type = "VmwareDistributedVirtualSwitch"
+			p.setLink(state, state.nodes[moID(dvsRef)], node, topology.OwnershipLink)
+		}
+	}
+}
+
+func (p *Probe) syncVNICs(state *syncState, vm *mo.VirtualMachine, vmNode *graph.Node) {
+	if vm.Config == nil {
+		return
+	}
+
+	for _, device := range vm.Config.Hardware.Device {
+		card, ok := device.(types.BaseVirtualEthernetCard)
+		if !ok {
+			continue
+		}
+		nic := card.GetVirtualEthernetCard()
+
+		name := fmt.Sprintf("nic-%d", nic.Key)
+		if info := nic.DeviceInfo; info != nil {
+			name = info.GetDescription().Label
+		}
+
+		metadata := &Metadata{MAC: nic.MacAddress}
+		if nic.Connectable != nil {
+			metadata.Connected = nic.Connectable.Connected
+		}
+
+		id := graph.GenID(string(vmNode.ID), "vnic", fmt.Sprintf("%d", nic.Key))
+		node := p.setNode(state, id, graph.Metadata{
+			"Type":    "vnic",
+			"Name":    name,
+			"VSphere": metadata,
+		})
+		p.setLink(state, vmNode, node, topology.OwnershipLink)
+
+		var portgroup graph.Identifier
+		switch backing := nic.Backing.(type) {
+		case *types.VirtualEthernetCardDistributedVirtualPortBackingInfo:
+			portgroup = moID(types.ManagedObjectReference{Type: "DistributedVirtualPortgroup", Value: backing.Port.PortgroupKey})
+		case *types.VirtualEthernetCardNetworkBackingInfo:
+			if backing.Network != nil {
+				portgroup = moID(*backing.Network)
+			}
+		}
+		p.setLink(state, node, state.nodes[portgroup], topology.Layer2Link)
+	}
+}
+
+func (p *Probe) syncVMs(state *syncState, vms []mo.VirtualMachine) {
+	for i, vm := range vms {
+		metadata := &Metadata{
+			MoRef:      vm.Reference().Value,
+			UUID:       vm.Summary.Config.Uuid,
+			PowerState: string(vm.Summary.Runtime.PowerState),
+			GuestOS:    vm.Summary.Config.GuestFullName,
+		}
+
+		node := p.setNode(state, moID(vm.Reference()), graph.Metadata{
+			"Type":    "vm",
+			"Name":    vm.Name,
+			"VSphere": metadata,
+		})
+		if node == nil {
+			continue
+		}
+
+		if host := vm.Summary.Runtime.Host; host != nil {
+			p.setLink(state, state.nodes[moID(*host)], node, topology.OwnershipLink)
+		}
+
+		p.syncVNICs(state, &vms[i], node)
+	}
+}
+
+func (p *Probe) update(ctx context.Context) error {
+	m := view.NewManager(p.client.Client)
+
+	v, err := m.CreateContainerView(ctx, p.client.ServiceContent.RootFolder, []string{"HostSystem", "VmwareDistributedVirtualSwitch", "DistributedVirtualPortgroup", "VirtualMachine"}, true)
+	if err != nil {
+		return err
+	}
+	defer v.Destroy(ctx)
+
+	var hosts []mo.HostSystem
+	if err := v.Retrieve(ctx, []string{"HostSystem"}, []string{"name", "summary"}, &hosts); err != nil {
+		return err
+	}
+
+	var switches []mo.VmwareDistributedVirtualSwitch
+	if err := v.Retrieve(ctx, []string{"VmwareDistributedVirtualSwitch"}, []string{"name", "summary"}, &switches); err != nil {
+		return err
+	}
+
+	var portgroups []mo.DistributedVirtualPortgroup
+	if err := v.Retrieve(ctx, []string{"DistributedVirtualPortgroup"}, []string{"name", "config"}, &portgroups); err != nil {
+		return err
+	}
+
+	var vms []mo.VirtualMachine
+	if err := v.Retrieve(ctx, []string{"VirtualMachine"}, []string{"name", "summary", "config.hardware.device"}, &vms); err != nil {
+		return err
+	}
+
+	p.graph.Lock()
+	defer p.graph.Unlock()
+
+	state := &syncState{
+		nodes: make(map[graph.Identifier]*graph.Node),
+		edges: make(map[graph.Identifier]*graph.Edge),
+	}
+
+	// hosts and switches have to be known before linking the elements
+	// referencing them
+	p.syncHosts(state, hosts)
+	p.syncSwitches(state, switches)
+	p.syncPortgroups(state, portgroups)
+	p.syncVMs(state, vms)
+
+	for id, edge := range p.edges {
+		if _, found := state.edges[id]; !found && p.graph.GetEdge(id) != nil {
+			if err := p.graph.DelEdge(edge); err != nil {
+				logging.GetLogger().Error(err)
+			}
+		}
+	}
+
+	for id, node := range p.nodes {
+		if _, found := state.nodes[id]; !found && p.graph.GetNode(id) != nil {
+			if err := p.graph.DelNode(node); err != nil {
+				logging.GetLogger().Error(err)
+			}
+		}
+	}
+
+	p.nodes, p.edges = state.nodes, state.edges
+
+	return nil
+}
+
+// Do connects to the vCenter and polls its inventory
+func (p *Probe) Do(ctx context.Context, wg *sync.WaitGroup) error {
+	client, err := govmomi.NewClient(ctx, p.url, p.insecure)
+	if err != nil {
+		return fmt.Errorf("Failed to connect to vCenter %s: %s", p.url.Host, err)
+	}
+	p.client = client
+
+	logging.GetLogger().Infof("Connected to vCenter %s", client.ServiceContent.About.FullName)
+
+	if err := p.update(ctx); err != nil {
+		client.Logout(context.Background())
+		return err
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer client.Logout(context.Background())
+
+		ticker := time.NewTicker(p.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.update(ctx); err != nil {
+					logging.GetLogger().Errorf("Failed to retrieve the vSphere inventory: %s", err)
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Start the vSphere probe
+func (p *Probe) Start() error {
+	if err := p.bundle.Start(); err != nil {
+		return err
+	}
+	return p.ProbeWrapper.Start()
+}
+
+// Stop the vSphere probe
+func (p *Probe) Stop() {
+	p.ProbeWrapper.Stop()
+	p.bundle.Stop()
+}
+
+// NewProbe returns a new vSphere topology probe
+func NewProbe(g *graph.Graph) (probe.Handler, error) {
+	u, err := url.Parse(config.GetString("analyzer.topology.vsphere.url"))
+	if err != nil {
+		return nil, err
+	}
+	u.User = url.UserPassword(config.GetString("analyzer.topology.vsphere.username"), config.GetString("analyzer.topology.vsphere.password"))
+
+	p := &Probe{
+		graph:        g,
+		url:          u,
+		insecure:     config.GetBool("analyzer.topology.vsphere.insecure"),
+		pollInterval: time.Duration(config.GetInt("analyzer.topology.vsphere.poll_interval")) * time.Second,
+		nodes:        make(map[graph.Identifier]*graph.Node),
+		edges:        make(map[graph.Identifier]*graph.Edge),
+		bundle:       probe.NewBundle(),
+	}
+	p.ProbeWrapper = tp.NewProbeWrapper(p)
+
+	// link the vNICs to the interfaces reported by the agents running
+	// in the guests
+	vnicIndexer := graph.NewMetadataIndexer(g, g, graph.Metadata{"Type": "vnic", "Manager": Manager}, "VSphere.MAC")
+	p.bundle.AddHandler("vnicIndexer", vnicIndexer)
+
+	intfIndexer := graph.NewMetadataIndexer(g, g, graph.Metadata{"Type": "device"}, "MAC")
+	p.bundle.AddHandler("intfIndexer", intfIndexer)
+
+	p.bundle.AddHandler("vnicLinker", graph.NewMetadataIndexerLinker(g, vnicIndexer, intfIndexer, graph.Metadata{"RelationType": "mapping"}))
+
+	return p, nil
+}
+
+// Register registers graph metadata decoders
+func Register() {
+	graph.NodeMetadataDecoders["VSphere"] = MetadataDecoder
+}
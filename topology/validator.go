@@ -18,7 +18,12 @@
 package topology
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
 
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/statics"
@@ -28,10 +33,120 @@ import (
 // ErrInvalidSchema is return when a JSON schema is invalid
 var ErrInvalidSchema = errors.New("Invalid schema")
 
+// MetadataField declares the type of a custom metadata key
+type MetadataField struct {
+	// Metadata key, dot separated for nested keys
+	Name string `valid:"nonzero" yaml:"Name"`
+	// Field type: string, integer, number, boolean, object or array
+	Type string `valid:"regexp=^(string|integer|number|boolean|object|array)$" yaml:"Type"`
+	// Node types or edge relation types the field applies to, all if empty
+	Types []string `yaml:"Types"`
+	// Whether the elements of these types must define the field
+	Required bool `yaml:"Required"`
+	// Indexing hint for the backends: keyword, text or none
+	Index string `valid:"regexp=^(|keyword|text|none)$" yaml:"Index"`
+}
+
 // SchemaValidator validates graph nodes and edges using a JSON schema
+// and the declared metadata fields
 type SchemaValidator struct {
+	sync.RWMutex
 	nodeSchema gojsonschema.JSONLoader
 	edgeSchema gojsonschema.JSONLoader
+	fields     []MetadataField
+}
+
+func (f *MetadataField) appliesTo(typ string) bool {
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *MetadataField) validateValue(value interface{}) bool {
+	if n, ok := value.(json.Number); ok {
+		switch f.Type {
+		case "integer":
+			_, err := n.Int64()
+			return err == nil
+		case "number":
+			_, err := n.Float64()
+			return err == nil
+		}
+		return false
+	}
+
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+
+	switch kind := v.Kind(); f.Type {
+	case "string":
+		return kind == reflect.String
+	case "integer":
+		switch kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return true
+		case reflect.Float32, reflect.Float64:
+			return v.Float() == math.Trunc(v.Float())
+		}
+	case "number":
+		switch kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+	case "boolean":
+		return kind == reflect.Bool
+	case "object":
+		return kind == reflect.Map || kind == reflect.Struct
+	case "array":
+		return kind == reflect.Slice || kind == reflect.Array
+	}
+	return false
+}
+
+func (v *SchemaValidator) validateFields(kind string, id graph.Identifier, typ string, m graph.Metadata) error {
+	v.RLock()
+	defer v.RUnlock()
+
+	for _, field := range v.fields {
+		if !field.appliesTo(typ) {
+			continue
+		}
+
+		value, err := m.GetField(field.Name)
+		if err != nil {
+			if field.Required {
+				return fmt.Errorf("Metadata %s of %s %s is required", field.Name, kind, id)
+			}
+			continue
+		}
+
+		if !field.validateValue(value) {
+			return fmt.Errorf("Metadata %s of %s %s must be of type %s", field.Name, kind, id, field.Type)
+		}
+	}
+
+	return nil
+}
+
+// SetMetadataFields replaces the declared metadata fields
+func (v *SchemaValidator) SetMetadataFields(fields []MetadataField) {
+	v.Lock()
+	v.fields = fields
+	v.Unlock()
 }
 
 func (v *SchemaValidator) validate(obj interface{}, schema gojsonschema.JSONLoader) error {
@@ -47,12 +162,22 @@ func (v *SchemaValidator) validate(obj interface{}, schema gojsonschema.JSONLoad
 
 // ValidateNode valides a graph node
 func (v *SchemaValidator) ValidateNode(node *graph.Node) error {
-	return v.validate(node, v.nodeSchema)
+	if err := v.validate(node, v.nodeSchema); err != nil {
+		return err
+	}
+
+	typ, _ := node.GetFieldString("Type")
+	return v.validateFields("node", node.ID, typ, node.Metadata)
 }
 
 // ValidateEdge valides a graph edge
 func (v *SchemaValidator) ValidateEdge(edge *graph.Edge) error {
-	return v.validate(edge, v.edgeSchema)
+	if err := v.validate(edge, v.edgeSchema); err != nil {
+		return err
+	}
+
+	relationType, _ := edge.GetFieldString("RelationType")
+	return v.validateFields("edge", edge.ID, relationType, edge.Metadata)
 }
 
 // NewSchemaValidator returns a new JSON schema validator for
@@ -0,0 +1,63 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topology
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+func TestMetadataFields(t *testing.T) {
+	validator, err := NewSchemaValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validator.SetMetadataFields([]MetadataField{
+		{Name: "Rack.Position", Type: "integer"},
+		{Name: "Owner", Type: "string", Types: []string{"host"}, Required: true},
+	})
+
+	newNode := func(m graph.Metadata) *graph.Node {
+		return graph.CreateNode(graph.GenID(), m, graph.TimeUTC(), "", "")
+	}
+
+	valid := []graph.Metadata{
+		{"Name": "eth0", "Type": "device"},
+		{"Name": "eth0", "Type": "device", "Rack": map[string]interface{}{"Position": 4}},
+		{"Name": "host1", "Type": "host", "Owner": "ops"},
+	}
+	for _, m := range valid {
+		if err := validator.ValidateNode(newNode(m)); err != nil {
+			t.Errorf("Expected node %v to be valid: %s", m, err)
+		}
+	}
+
+	invalid := []graph.Metadata{
+		{"Name": "eth0", "Type": "device", "Rack": map[string]interface{}{"Position": "top"}},
+		{"Name": "eth0", "Type": "device", "Rack": map[string]interface{}{"Position": 4.5}},
+		{"Name": "host1", "Type": "host"},
+		{"Name": "host1", "Type": "host", "Owner": 12},
+	}
+	for _, m := range invalid {
+		if err := validator.ValidateNode(newNode(m)); err == nil {
+			t.Errorf("Expected node %v to be invalid", m)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/version"
+)
+
+const (
+	scopeName = "github.com/skydive-project/skydive"
+
+	batchSize     = 512
+	queueSize     = 2048
+	flushInterval = 5 * time.Second
+)
+
+// OTLP span kinds and status codes
+const (
+	kindInternal = 1
+	kindServer   = 2
+
+	statusError = 2
+)
+
+// Options describes the OTLP collector the spans are exported to
+type Options struct {
+	// Endpoint is the address of the OTLP HTTP collector, ex: localhost:4318
+	Endpoint string
+	// Insecure disables TLS
+	Insecure bool
+	// Headers are sent along with the spans, to authenticate for instance
+	Headers map[string]string
+	// SampleRatio is the ratio of the traces recorded, the decision of the
+	// caller being followed for the propagated ones
+	SampleRatio float64
+}
+
+// Attribute describes a key/value pair attached to a span
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: int64(value)}
+}
+
+// Bool returns a boolean attribute
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// SpanContext identifies a span within a trace
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// Span describes a timed operation. A nil span, returned while the tracing
+// is disabled, can be used safely.
+type Span struct {
+	sync.Mutex
+	SpanContext
+	Name      string
+	ParentID  [8]byte
+	Kind      int
+	StartTime time.Time
+	EndTime   time.Time
+	Attrs     []Attribute
+	Err       error
+	ended     bool
+}
+
+// processor is notified of the sampled spans when they end
+type processor interface {
+	onEnd(span *Span)
+}
+
+type spanKey struct{}
+
+var (
+	tracer struct {
+		sync.RWMutex
+		processor processor
+		ratio     float64
+	}
+	exp *exporter
+)
+
+// Init exports the spans of a service to an OTLP collector. Until called,
+// spans are neither recorded nor exported.
+func Init(service common.Service, opts Options) error {
+	if opts.Endpoint == "" {
+		return fmt.Errorf("no endpoint defined for the tracing collector")
+	}
+
+	scheme := "https"
+	if opts.Insecure {
+		scheme = "http"
+	}
+
+	exp = newExporter(scheme+"://"+opts.Endpoint+"/v1/traces", opts.Headers, map[string]string{
+		"service.name":        "skydive-" + string(service.Type),
+		"service.instance.id": service.ID,
+		"service.version":     version.Version,
+	})
+	exp.start()
+
+	setProcessor(exp, opts.SampleRatio)
+
+	return nil
+}
+
+// Shutdown exports the pending spans and stops the exporter
+func Shutdown() {
+	if exp == nil {
+		return
+	}
+
+	setProcessor(nil, 0)
+	exp.stop()
+	exp = nil
+}
+
+func setProcessor(p processor, ratio float64) {
+	tracer.Lock()
+	tracer.processor, tracer.ratio = p, ratio
+	tracer.Unlock()
+}
+
+// SpanFromContext returns the span of a context, nil if none
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start starts a span, child of the one of the context if any
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return start(ctx, name, kindInternal, attrs)
+}
+
+func start(ctx context.Context, name string, kind int, attrs []Attribute) (context.Context, *Span) {
+	tracer.RLock()
+	p, ratio := tracer.processor, tracer.ratio
+	tracer.RUnlock()
+
+	if p == nil {
+		return ctx, nil
+	}
+
+	span := &Span{Name: name, Kind: kind, StartTime: time.Now(), Attrs: attrs}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.TraceID, span.ParentID, span.Sampled = parent.TraceID, parent.SpanID, parent.Sampled
+	} else {
+		rand.Read(span.TraceID[:])
+		span.Sampled = sample(ratio)
+	}
+	rand.Read(span.SpanID[:])
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func sample(ratio float64) bool {
+	if ratio >= 1 {
+		return true
+	}
+	if ratio <= 0 {
+		return false
+	}
+
+	const precision = 1 << 30
+	n, err := rand.Int(rand.Reader, big.NewInt(precision))
+	return err == nil && float64(n.Int64()) < ratio*precision
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+
+	s.Lock()
+	s.Attrs = append(s.Attrs, attrs...)
+	s.Unlock()
+}
+
+// End ends the span, exporting it when sampled
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.Lock()
+	if s.ended {
+		s.Unlock()
+		return
+	}
+	s.ended, s.EndTime = true, time.Now()
+	s.Unlock()
+
+	if !s.Sampled {
+		return
+	}
+
+	tracer.RLock()
+	p := tracer.processor
+	tracer.RUnlock()
+
+	if p != nil {
+		p.onEnd(s)
+	}
+}
+
+// End ends a span, marking it as failed if an error occurred
+func End(span *Span, err error) {
+	if span == nil {
+		return
+	}
+
+	if err != nil {
+		span.Lock()
+		span.Err = err
+		span.Unlock()
+	}
+	span.End()
+}
+
+// Annotate adds attributes to the span of the context
+func Annotate(ctx context.Context, attrs ...Attribute) {
+	SpanFromContext(ctx).SetAttributes(attrs...)
+}
+
+// Handler returns an HTTP handler executing a handler in a span, continuing
+// the trace of the caller when propagated within the traceparent header
+func Handler(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if remote, ok := parseTraceParent(r.Header.Get("traceparent")); ok {
+			ctx = context.WithValue(ctx, spanKey{}, &Span{SpanContext: remote, ended: true})
+		}
+
+		ctx, span := start(ctx, name, kindServer, []Attribute{
+			String("http.method", r.Method),
+			String("http.target", r.URL.Path),
+		})
+		defer span.End()
+
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// parseTraceParent parses a W3C trace context header,
+// ex: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func parseTraceParent(header string) (sc SpanContext, _ bool) {
+	fields := strings.Split(header, "-")
+	if len(fields) < 4 || len(fields[0]) != 2 || fields[0] == "ff" ||
+		len(fields[1]) != 32 || len(fields[2]) != 16 || len(fields[3]) != 2 {
+		return sc, false
+	}
+
+	if _, err := hex.Decode(sc.TraceID[:], []byte(fields[1])); err != nil || sc.TraceID == [16]byte{} {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(fields[2])); err != nil || sc.SpanID == [8]byte{} {
+		return sc, false
+	}
+
+	flags, err := strconv.ParseUint(fields[3], 16, 8)
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags&1 == 1
+
+	return sc, true
+}
+
+// exporter sends the spans by batches to an OTLP collector, using the JSON
+// encoding of the OTLP HTTP protocol
+type exporter struct {
+	url      string
+	headers  map[string]string
+	resource []otlpAttribute
+	client   *http.Client
+	queue    chan *Span
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func (e *exporter) onEnd(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+		logging.GetLogger().Debugf("Tracing queue full, span %s dropped", span.Name)
+	}
+}
+
+func (e *exporter) run() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() {
+		if len(batch) > 0 {
+			if err := e.export(batch); err != nil {
+				logging.GetLogger().Warningf("Failed to export %d spans: %s", len(batch), err)
+			}
+			batch = nil
+		}
+	}
+
+	for {
+		select {
+		case span := <-e.queue:
+			if batch = append(batch, span); len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.quit:
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *exporter) export(spans []*Span) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector replied %s", resp.Status)
+	}
+	return nil
+}
+
+func (e *exporter) start() {
+	e.wg.Add(1)
+	go e.run()
+}
+
+func (e *exporter) stop() {
+	close(e.quit)
+	e.wg.Wait()
+}
+
+func newExporter(url string, headers map[string]string, resource map[string]string) *exporter {
+	e := &exporter{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		queue:   make(chan *Span, queueSize),
+		quit:    make(chan struct{}),
+	}
+	keys := make([]string, 0, len(resource))
+	for k := range resource {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e.resource = append(e.resource, newOTLPAttribute(String(k, resource[k])))
+	}
+	return e
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+type recorder struct {
+	sync.Mutex
+	ended []*Span
+}
+
+func (r *recorder) onEnd(span *Span) {
+	r.Lock()
+	r.ended = append(r.ended, span)
+	r.Unlock()
+}
+
+func newRecorder(ratio float64) *recorder {
+	r := &recorder{}
+	setProcessor(r, ratio)
+	return r
+}
+
+func TestHandler(t *testing.T) {
+	recorder := newRecorder(1)
+	defer setProcessor(nil, 0)
+
+	handler := Handler("TopologySearch", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "gremlin.exec")
+		End(span, errors.New("invalid step"))
+	}))
+
+	r := httptest.NewRequest("POST", "/api/topology", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := recorder.ended
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	exec, request := spans[0], spans[1]
+	if request.Name != "TopologySearch" || exec.Name != "gremlin.exec" {
+		t.Errorf("unexpected spans: %s, %s", request.Name, exec.Name)
+	}
+
+	if traceID := newOTLPSpan(request).TraceID; traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("the trace of the caller should be continued, got %s", traceID)
+	}
+
+	if parentID := newOTLPSpan(request).ParentSpanID; parentID != "00f067aa0ba902b7" {
+		t.Errorf("the span of the caller should be the parent of the one of the handler, got %s", parentID)
+	}
+
+	if exec.ParentID != request.SpanID {
+		t.Error("the span of the handler should be the parent of the one of the query")
+	}
+
+	if status := newOTLPSpan(exec).Status; status == nil || status.Code != statusError {
+		t.Errorf("the span of a failed operation should be marked as failed, got %v", status)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	recorder := newRecorder(0)
+	defer setProcessor(nil, 0)
+
+	handler := Handler("TopologySearch", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "gremlin.exec")
+		span.End()
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/topology", nil))
+	if len(recorder.ended) != 0 {
+		t.Errorf("no trace should be recorded with a ratio of 0, got %d spans", len(recorder.ended))
+	}
+
+	// the decision of the caller is followed
+	r := httptest.NewRequest("GET", "/api/topology", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if len(recorder.ended) != 2 {
+		t.Errorf("the trace sampled by the caller should be recorded, got %d spans", len(recorder.ended))
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	ctx, span := Start(httptest.NewRequest("GET", "/", nil).Context(), "gremlin.exec", String("gremlin.query", "G.V()"))
+	if span != nil || SpanFromContext(ctx) != nil {
+		t.Error("no span should be created until the tracing is initialized")
+	}
+
+	Annotate(ctx, Int("flows", 1))
+	End(span, errors.New("invalid step"))
+}
+
+func TestExport(t *testing.T) {
+	var request otlpRequest
+	var auth string
+	done := make(chan struct{})
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+		close(done)
+	}))
+	defer collector.Close()
+
+	service := common.Service{Type: common.AnalyzerService, ID: "analyzer1"}
+	if err := Init(service, Options{
+		Endpoint:    collector.Listener.Addr().String(),
+		Insecure:    true,
+		Headers:     map[string]string{"Authorization": "Bearer xxx"},
+		SampleRatio: 1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := Start(httptest.NewRequest("GET", "/", nil).Context(), "flow.ingest", Int("flows", 3))
+	span.End()
+	Shutdown()
+	<-done
+
+	if auth != "Bearer xxx" {
+		t.Errorf("the headers should be sent to the collector, got %q", auth)
+	}
+
+	if len(request.ResourceSpans) != 1 || len(request.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected request: %+v", request)
+	}
+
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 1 || spans[0].Name != "flow.ingest" {
+		t.Fatalf("unexpected spans: %+v", spans)
+	}
+
+	if attrs := spans[0].Attributes; len(attrs) != 1 || attrs[0].Value.IntValue == nil || *attrs[0].Value.IntValue != "3" {
+		t.Errorf("unexpected attributes: %+v", attrs)
+	}
+}
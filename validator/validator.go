@@ -160,12 +160,7 @@ func isIPOrCIDR(v interface{}, param string) error {
 	}
 }
 
-func isGremlinExpr(v interface{}, param string) error {
-	query, ok := v.(string)
-	if !ok {
-		return GremlinNotValid(errors.New("not a string"))
-	}
-
+func newGremlinParser() *traversal.GremlinTraversalParser {
 	tr := traversal.NewGremlinTraversalParser()
 	tr.AddTraversalExtension(ge.NewMetricsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewFlowTraversalExtension(nil, nil))
@@ -173,9 +168,36 @@ func isGremlinExpr(v interface{}, param string) error {
 	tr.AddTraversalExtension(ge.NewRawPacketsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewDescendantsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewNextHopTraversalExtension())
+	tr.AddTraversalExtension(ge.NewNeighborConflictsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewGroupTraversalExtension())
+	tr.AddTraversalExtension(ge.NewDiffTraversalExtension())
+	tr.AddTraversalExtension(ge.NewAggregationTraversalExtension())
+	tr.AddTraversalExtension(ge.NewPathsTraversalExtension())
+
+	return tr
+}
+
+// ParseGremlin parses a Gremlin expression using the steps of the
+// topology, flow and metric extensions
+func ParseGremlin(query string) (*traversal.GremlinTraversalSequence, error) {
+	return newGremlinParser().Parse(strings.NewReader(query))
+}
+
+func isGremlinExpr(v interface{}, param string) error {
+	query, ok := v.(string)
+	if !ok {
+		return GremlinNotValid(errors.New("not a string"))
+	}
 
-	if _, err := tr.Parse(strings.NewReader(query)); err != nil {
+	// the values of the $name placeholders are only known when the query
+	// is executed, an empty string stands for them
+	parser := newGremlinParser()
+	bindings := make(map[string]interface{})
+	for _, name := range parser.Bindings(query) {
+		bindings[name] = ""
+	}
+
+	if _, err := parser.ParseWithBindings(query, bindings); err != nil {
 		return GremlinNotValid(err)
 	}
 
@@ -266,6 +288,33 @@ func isValidCaptureType(v interface{}, param string) error {
 	return CaptureTypeNotValid(typ)
 }
 
+// ValidateFields validates an object and returns all the errors, indexed by
+// field. The errors returned by the Validate method of the object are
+// indexed by an empty field.
+func ValidateFields(value interface{}) map[string][]string {
+	errs := make(map[string][]string)
+
+	if err := skydiveValidator.Validate(value); err != nil {
+		if fieldErrs, ok := err.(valid.ErrorMap); ok {
+			for field, fieldErr := range fieldErrs {
+				for _, err := range fieldErr {
+					errs[field] = append(errs[field], err.Error())
+				}
+			}
+		} else {
+			errs[""] = append(errs[""], err.Error())
+		}
+	}
+
+	if obj, ok := value.(Validator); ok {
+		if err := obj.Validate(); err != nil {
+			errs[""] = append(errs[""], err.Error())
+		}
+	}
+
+	return errs
+}
+
 // Validate an object based on previously (at init) registered function
 func Validate(value interface{}) error {
 	if err := skydiveValidator.Validate(value); err != nil {
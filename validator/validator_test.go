@@ -49,6 +49,16 @@ func TestGremlin(t *testing.T) {
 	if err := Validate(g); err == nil {
 		t.Error("Should return an error")
 	}
+
+	g = gremlinTest{GremlinQuery: "G.V().Has('Name', $name, 'Type', Within($type1, $type2))"}
+	if err := Validate(g); err != nil {
+		t.Errorf("Should not return an error for placeholders: %s", err.Error())
+	}
+
+	g = gremlinTest{GremlinQuery: "G.V().Has('Name', $name"}
+	if err := Validate(g); err == nil {
+		t.Error("Should return an error")
+	}
 }
 
 type ipTest struct {
@@ -0,0 +1,294 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+
+	api "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/etcd"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// delay before the first retry of a delivery, doubled at each retry
+const retryDelay = time.Second
+
+// subscription holds a webhook and the queue of its pending events. The
+// events are delivered in order by a single goroutine.
+type subscription struct {
+	webhook *types.Webhook
+	queue   chan *types.WebhookEvent
+	quit    chan struct{}
+}
+
+// Server POSTs the lifecycle events of the API resources to the registered
+// webhooks. All the analyzers watch the resources but only the master
+// delivers the events.
+type Server struct {
+	common.RWMutex
+	common.MasterElection
+	WebhookHandler api.Handler
+	handlers       map[string]api.Handler
+	watchers       []api.StoppableWatcher
+	subscriptions  map[string]*subscription
+	client         *http.Client
+	queueSize      int
+	maxRetries     int
+	wg             sync.WaitGroup
+}
+
+// eventFromAction returns the webhook event of an etcd action, an empty
+// string for the initial listing of the resources
+func eventFromAction(action string) string {
+	switch action {
+	case "create", "set":
+		return "created"
+	case "update", "compareAndSwap":
+		return "updated"
+	case "delete", "expire", "compareAndDelete":
+		return "deleted"
+	}
+	return ""
+}
+
+// sign returns the signature of a payload, as sent in the
+// X-Skydive-Signature header
+func sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Server) post(webhook *types.Webhook, event *types.WebhookEvent, payload []byte) (retry bool, err error) {
+	req, err := http.NewRequest("POST", webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Skydive-Event", event.Resource+"."+event.Event)
+	req.Header.Set("X-Skydive-Delivery", event.ID)
+	if webhook.Secret != "" {
+		req.Header.Set("X-Skydive-Signature", sign(webhook.Secret, payload))
+	}
+	req.Close = true
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status %s", resp.Status)
+	default:
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
+
+// deliver posts an event to a webhook, retrying with an exponential backoff
+// on network errors and server errors
+func (s *Server) deliver(sub *subscription, event *types.WebhookEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to marshal webhook event: %s", err)
+		return
+	}
+
+	s.RLock()
+	webhook := sub.webhook
+	s.RUnlock()
+
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(webhook, event, payload)
+		if err == nil {
+			return
+		}
+
+		if !retry || attempt >= s.maxRetries {
+			logging.GetLogger().Warningf("Failed to deliver event %s of %s %s to webhook %s: %s", event.Event, event.Resource, event.ResourceID, webhook.UUID, err)
+			return
+		}
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-sub.quit:
+			return
+		}
+	}
+}
+
+func (s *Server) run(sub *subscription) {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case event := <-sub.queue:
+			s.deliver(sub, event)
+		case <-sub.quit:
+			return
+		}
+	}
+}
+
+func (s *Server) registerWebhook(webhook *types.Webhook) {
+	logging.GetLogger().Debugf("Registering webhook: %s", webhook.UUID)
+
+	s.Lock()
+	defer s.Unlock()
+
+	if sub, found := s.subscriptions[webhook.UUID]; found {
+		sub.webhook = webhook
+		return
+	}
+
+	sub := &subscription{
+		webhook: webhook,
+		queue:   make(chan *types.WebhookEvent, s.queueSize),
+		quit:    make(chan struct{}),
+	}
+	s.subscriptions[webhook.UUID] = sub
+
+	s.wg.Add(1)
+	go s.run(sub)
+}
+
+func (s *Server) unregisterWebhook(id string) {
+	logging.GetLogger().Debugf("Unregistering webhook: %s", id)
+
+	s.Lock()
+	defer s.Unlock()
+
+	if sub, found := s.subscriptions[id]; found {
+		close(sub.quit)
+		delete(s.subscriptions, id)
+	}
+}
+
+func (s *Server) onWebhookEvent(action string, id string, resource types.Resource) {
+	switch action {
+	case "init", "create", "set", "update":
+		s.registerWebhook(resource.(*types.Webhook))
+	case "expire", "delete":
+		s.unregisterWebhook(id)
+	}
+}
+
+// notify queues an event of a resource for the webhooks subscribed to it
+func (s *Server) notify(resource string, action string, id string, object types.Resource) {
+	event := eventFromAction(action)
+	if event == "" || !s.IsMaster() {
+		return
+	}
+
+	now := time.Now().UTC()
+
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, sub := range s.subscriptions {
+		if !sub.webhook.Match(resource, event) {
+			continue
+		}
+
+		u, _ := uuid.NewV4()
+		e := &types.WebhookEvent{
+			ID:         u.String(),
+			Webhook:    sub.webhook.UUID,
+			Timestamp:  now,
+			Resource:   resource,
+			Event:      event,
+			ResourceID: id,
+			Object:     object,
+		}
+
+		select {
+		case sub.queue <- e:
+		default:
+			logging.GetLogger().Warningf("Queue of webhook %s full, dropping event %s of %s %s", sub.webhook.UUID, event, resource, id)
+		}
+	}
+}
+
+// Start the webhook server
+func (s *Server) Start() {
+	s.StartAndWait()
+
+	s.watchers = append(s.watchers, s.WebhookHandler.AsyncWatch(s.onWebhookEvent))
+	for name, handler := range s.handlers {
+		name := name
+		s.watchers = append(s.watchers, handler.AsyncWatch(func(action string, id string, resource types.Resource) {
+			s.notify(name, action, id, resource)
+		}))
+	}
+}
+
+// Stop the webhook server
+func (s *Server) Stop() {
+	for _, watcher := range s.watchers {
+		watcher.Stop()
+	}
+
+	s.Lock()
+	for id, sub := range s.subscriptions {
+		close(sub.quit)
+		delete(s.subscriptions, id)
+	}
+	s.Unlock()
+
+	s.wg.Wait()
+	s.MasterElection.Stop()
+}
+
+// NewServer creates a new webhook server
+func NewServer(apiServer *api.Server, etcdClient *etcd.Client) *Server {
+	s := &Server{
+		MasterElection: etcdClient.NewElection("webhook-server"),
+		WebhookHandler: apiServer.GetHandler("webhook"),
+		handlers:       make(map[string]api.Handler),
+		subscriptions:  make(map[string]*subscription),
+		client:         &http.Client{Timeout: time.Duration(config.GetInt("analyzer.webhook.timeout")) * time.Second},
+		queueSize:      config.GetInt("analyzer.webhook.queue_size"),
+		maxRetries:     config.GetInt("analyzer.webhook.max_retries"),
+	}
+
+	for _, name := range types.WebhookResources {
+		if handler := apiServer.GetHandler(name); handler != nil {
+			s.handlers[name] = handler
+		}
+	}
+
+	return s
+}
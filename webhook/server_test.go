@@ -0,0 +1,172 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+)
+
+type masterElection struct {
+	master bool
+}
+
+func (m *masterElection) Start()                                                  {}
+func (m *masterElection) StartAndWait()                                           {}
+func (m *masterElection) Stop()                                                   {}
+func (m *masterElection) IsMaster() bool                                          { return m.master }
+func (m *masterElection) AddEventListener(listener common.MasterElectionListener) {}
+func (m *masterElection) TTL() time.Duration                                      { return 0 }
+
+type delivery struct {
+	header http.Header
+	body   []byte
+	event  types.WebhookEvent
+}
+
+func newServer(master bool) *Server {
+	return &Server{
+		MasterElection: &masterElection{master: master},
+		subscriptions:  make(map[string]*subscription),
+		client:         &http.Client{Timeout: time.Second},
+		queueSize:      10,
+	}
+}
+
+func newReceiver(t *testing.T, status int) (*httptest.Server, chan *delivery) {
+	deliveries := make(chan *delivery, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		d := &delivery{header: r.Header, body: body}
+		if err := json.Unmarshal(body, &d.event); err != nil {
+			t.Error(err)
+		}
+		deliveries <- d
+
+		w.WriteHeader(status)
+	}))
+	return ts, deliveries
+}
+
+func waitDelivery(t *testing.T, deliveries chan *delivery) *delivery {
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not called")
+	}
+	return nil
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	ts, deliveries := newReceiver(t, http.StatusOK)
+	defer ts.Close()
+
+	s := newServer(true)
+	defer s.Stop()
+
+	webhook := &types.Webhook{URL: ts.URL, Resources: []string{"capture"}, Events: []string{"created", "deleted"}, Secret: "s3cr3t"}
+	webhook.UUID = "webhook1"
+	s.onWebhookEvent("init", webhook.UUID, webhook)
+
+	capture := &types.Capture{GremlinQuery: "G.V().Has('Name', 'eth0')"}
+	capture.UUID = "capture1"
+
+	// neither the initial listing, the filtered events nor the other
+	// resources are sent
+	s.notify("capture", "init", capture.UUID, capture)
+	s.notify("capture", "update", capture.UUID, capture)
+	s.notify("alert", "set", "alert1", &types.Alert{})
+	s.notify("capture", "set", capture.UUID, capture)
+
+	d := waitDelivery(t, deliveries)
+	if d.event.Resource != "capture" || d.event.Event != "created" || d.event.ResourceID != "capture1" || d.event.Webhook != "webhook1" {
+		t.Errorf("Wrong event: %+v", d.event)
+	}
+	if d.header.Get("X-Skydive-Event") != "capture.created" {
+		t.Errorf("Wrong event header: %s", d.header.Get("X-Skydive-Event"))
+	}
+	if d.header.Get("X-Skydive-Delivery") != d.event.ID {
+		t.Errorf("Wrong delivery header: %s", d.header.Get("X-Skydive-Delivery"))
+	}
+	if signature := d.header.Get("X-Skydive-Signature"); signature != sign("s3cr3t", d.body) {
+		t.Errorf("Wrong signature: %s", signature)
+	}
+	if object, ok := d.event.Object.(map[string]interface{}); !ok || object["GremlinQuery"] != capture.GremlinQuery {
+		t.Errorf("Wrong object: %+v", d.event.Object)
+	}
+
+	s.notify("capture", "delete", capture.UUID, capture)
+	if d = waitDelivery(t, deliveries); d.event.Event != "deleted" {
+		t.Errorf("Expected a deleted event, got: %+v", d.event)
+	}
+
+	select {
+	case d := <-deliveries:
+		t.Errorf("Unexpected event: %+v", d.event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhookNotMaster(t *testing.T) {
+	ts, deliveries := newReceiver(t, http.StatusOK)
+	defer ts.Close()
+
+	s := newServer(false)
+	defer s.Stop()
+
+	webhook := &types.Webhook{URL: ts.URL}
+	webhook.UUID = "webhook1"
+	s.onWebhookEvent("create", webhook.UUID, webhook)
+
+	s.notify("noderule", "set", "rule1", &types.NodeRule{})
+
+	select {
+	case d := <-deliveries:
+		t.Errorf("Unexpected event: %+v", d.event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	ts, deliveries := newReceiver(t, http.StatusServiceUnavailable)
+	defer ts.Close()
+
+	s := newServer(true)
+	s.maxRetries = 1
+	defer s.Stop()
+
+	webhook := &types.Webhook{URL: ts.URL}
+	webhook.UUID = "webhook1"
+	s.onWebhookEvent("create", webhook.UUID, webhook)
+
+	s.notify("edgerule", "set", "rule1", &types.EdgeRule{})
+
+	first := waitDelivery(t, deliveries)
+	if retry := waitDelivery(t, deliveries); retry.event.ID != first.event.ID {
+		t.Errorf("Expected the same delivery, got %s and %s", first.event.ID, retry.event.ID)
+	}
+}
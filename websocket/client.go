@@ -25,12 +25,14 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 
+	"github.com/skydive-project/skydive/certificate"
 	"github.com/skydive-project/skydive/common"
 	shttp "github.com/skydive-project/skydive/http"
 	"github.com/skydive-project/skydive/logging"
@@ -57,6 +59,9 @@ type ConnStatus struct {
 	ConnectTime       time.Time
 	RemoteHost        string             `json:",omitempty"`
 	RemoteServiceType common.ServiceType `json:",omitempty"`
+	Username          string             `json:",omitempty"`
+	Compression       bool               `json:",omitempty"`
+	DroppedMessages   int64              `json:",omitempty"`
 }
 
 // Store atomatically stores the state
@@ -134,6 +139,7 @@ type Speaker interface {
 	AddEventHandler(SpeakerEventHandler)
 	GetRemoteHost() string
 	GetRemoteServiceType() common.ServiceType
+	GetUsername() string
 }
 
 // Conn is the connection object of a Speaker
@@ -141,7 +147,7 @@ type Conn struct {
 	common.RWMutex
 	ConnStatus
 	flush            chan struct{}
-	send             chan []byte
+	queue            *sendQueue
 	read             chan []byte
 	quit             chan bool
 	wg               sync.WaitGroup
@@ -176,6 +182,7 @@ type ClientOpts struct {
 	AuthOpts         *shttp.AuthenticationOpts
 	Headers          http.Header
 	QueueSize        int
+	Compression      bool
 	WriteCompression bool
 	TLSConfig        *tls.Config
 	Logger           logging.Logger
@@ -232,7 +239,8 @@ func (c *Conn) GetStatus() ConnStatus {
 	status := c.ConnStatus
 	status.State = new(ConnState)
 	*status.State = ConnState(c.State.Load())
-	return c.ConnStatus
+	status.DroppedMessages = atomic.LoadInt64(&c.queue.dropped)
+	return status
 }
 
 // SpeakerStructMessageHandler interface used to receive Struct messages.
@@ -240,7 +248,7 @@ type SpeakerStructMessageHandler interface {
 	OnStructMessage(c Speaker, m *StructMessage)
 }
 
-// SendMessage adds a message to sending queue.
+// SendMessage adds a message to the sending queue, with its priority.
 func (c *Conn) SendMessage(m Message) error {
 	if !c.IsConnected() {
 		return errors.New("Not connected")
@@ -251,18 +259,18 @@ func (c *Conn) SendMessage(m Message) error {
 		return err
 	}
 
-	c.send <- b
+	c.queue.push(b, messagePriority(m))
 
 	return nil
 }
 
-// SendRaw adds raw bytes to sending queue.
+// SendRaw adds raw bytes to the sending queue, with the normal priority.
 func (c *Conn) SendRaw(b []byte) error {
 	if !c.IsConnected() {
 		return errors.New("Not connected")
 	}
 
-	c.send <- b
+	c.queue.push(b, NormalPriority)
 
 	return nil
 }
@@ -292,6 +300,12 @@ func (c *Conn) GetRemoteServiceType() common.ServiceType {
 	return c.RemoteServiceType
 }
 
+// GetUsername returns the name of the user authenticated on an incoming
+// connection
+func (c *Conn) GetUsername() string {
+	return c.Username
+}
+
 // write sends a message directly over the wire.
 func (c *Conn) write(msg []byte) error {
 	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
@@ -308,6 +322,16 @@ func (c *Conn) write(msg []byte) error {
 	return w.Close()
 }
 
+// writeQueued sends all the queued messages, in order
+func (c *Conn) writeQueued() error {
+	for _, m := range c.queue.popAll() {
+		if err := c.write(m.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Run the main loop
 func (c *Conn) Run() {
 	c.wg.Add(2)
@@ -387,13 +411,13 @@ func (c *Conn) run() {
 			return
 		case m := <-c.read:
 			handleReceivedMessage(m)
-		case m := <-c.send:
-			if err := c.write(m); err != nil {
+		case <-c.queue.ready:
+			if err := c.writeQueued(); err != nil {
 				c.logger.Errorf("Error while sending message to %+v: %s", c, err)
 				return
 			}
 		case <-c.flush:
-			if err := flushChannel(c.send, c.write); err != nil {
+			if err := c.writeQueued(); err != nil {
 				c.logger.Errorf("Error while flushing send queue for %+v: %s", c, err)
 				return
 			}
@@ -465,7 +489,7 @@ func newConn(host string, clientType common.ServiceType, clientProtocol Protocol
 			Headers:        headers,
 			ConnectTime:    time.Now(),
 		},
-		send:             make(chan []byte, opts.QueueSize),
+		queue:            newSendQueue(opts.QueueSize),
 		read:             make(chan []byte, opts.QueueSize),
 		flush:            make(chan struct{}),
 		quit:             make(chan bool, 2),
@@ -474,15 +498,33 @@ func newConn(host string, clientType common.ServiceType, clientProtocol Protocol
 		logger:           opts.Logger,
 	}
 
-	if clientProtocol == JSONProtocol {
+	c.setProtocol(clientProtocol)
+
+	c.State.Store(common.StoppedState)
+	c.running.Store(true)
+	return c
+}
+
+// setProtocol sets the protocol used to encode the messages and the matching
+// websocket frame type
+func (c *Conn) setProtocol(protocol Protocol) {
+	c.ClientProtocol = protocol
+	if protocol == JSONProtocol {
 		c.messageType = websocket.TextMessage
 	} else {
 		c.messageType = websocket.BinaryMessage
 	}
+}
 
-	c.State.Store(common.StoppedState)
-	c.running.Store(true)
-	return c
+// compressionNegotiated returns whether the per-message deflate extension is
+// part of the given extensions header
+func compressionNegotiated(header http.Header) bool {
+	for _, ext := range strings.Split(header.Get("Sec-Websocket-Extensions"), ",") {
+		if strings.HasPrefix(strings.TrimSpace(ext), "permessage-deflate") {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *Client) scheme() string {
@@ -515,11 +557,18 @@ func (c *Client) Connect() error {
 	}
 
 	d := websocket.Dialer{
-		Proxy:           http.ProxyFromEnvironment,
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
+		Proxy:             http.ProxyFromEnvironment,
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		EnableCompression: c.Opts.Compression,
+	}
+	d.TLSClientConfig = certificate.WithServerName(c.TLSConfig, c.URL.Hostname())
+
+	// the X-Client-Protocol header is kept for the servers not supporting
+	// the subprotocol negotiation
+	if subprotocol := c.Opts.Protocol.subprotocol(); subprotocol != "" {
+		d.Subprotocols = []string{subprotocol}
 	}
-	d.TLSClientConfig = c.TLSConfig
 
 	var resp *http.Response
 	c.conn, resp, err = d.Dial(endpoint, headers)
@@ -527,12 +576,22 @@ func (c *Client) Connect() error {
 		return fmt.Errorf("Unable to create a WebSocket connection %s : %s", endpoint, err)
 	}
 
+	if subprotocol := c.conn.Subprotocol(); subprotocol != "" {
+		var protocol Protocol
+		if err := protocol.parseSubprotocol(subprotocol); err != nil {
+			c.conn.Close()
+			return fmt.Errorf("Unable to create a WebSocket connection %s : %s", endpoint, err)
+		}
+		c.setProtocol(protocol)
+	}
+	c.Compression = compressionNegotiated(resp.Header)
+
 	c.conn.SetPingHandler(nil)
 	c.conn.EnableWriteCompression(c.writeCompression)
 
 	c.State.Store(common.RunningState)
 
-	c.Opts.Logger.Infof("Connected to %s", endpoint)
+	c.Opts.Logger.Infof("Connected to %s, protocol %s, compression %t", endpoint, c.ClientProtocol.String(), c.Compression)
 
 	c.RemoteHost = resp.Header.Get("X-Host-ID")
 
@@ -24,6 +24,11 @@ type MasterEventHandler interface {
 	OnNewMaster(c Speaker)
 }
 
+// MasterSelector returns the speaker to elect as master among the connected
+// speakers of the pool, nil if none can be. The current master, if any, is
+// given so that it can be kept.
+type MasterSelector func(pool SpeakerPool, master Speaker) Speaker
+
 // MasterElection provides a mechanism based on etcd to elect a master from a
 // SpeakerPool.
 type MasterElection struct {
@@ -31,14 +36,41 @@ type MasterElection struct {
 	DefaultSpeakerEventHandler
 	pool          SpeakerPool
 	master        Speaker
+	selector      MasterSelector
 	eventHandlers []MasterEventHandler
 }
 
 func (a *MasterElection) selectMaster() {
+	if a.selector != nil {
+		a.master = a.selector(a.pool, a.master)
+		return
+	}
 	a.master = a.pool.PickConnectedSpeaker()
 	return
 }
 
+// SetMasterSelector sets the function used to elect the master. By default
+// the first connected speaker is elected.
+func (a *MasterElection) SetMasterSelector(selector MasterSelector) {
+	a.Lock()
+	a.selector = selector
+	a.Unlock()
+}
+
+// Reelect elects the master again, when the selection criteria changed for
+// instance. The listeners are notified if the master changed.
+func (a *MasterElection) Reelect() {
+	a.Lock()
+	previous := a.master
+	a.selectMaster()
+	master := a.master
+	a.Unlock()
+
+	if master != previous {
+		a.notifyNewMaster(master)
+	}
+}
+
 // GetMaster returns the current master.
 func (a *MasterElection) GetMaster() Speaker {
 	a.RLock()
@@ -57,8 +89,18 @@ func (a *MasterElection) SendMessageToMaster(m Message) {
 }
 
 // OnConnected is triggered when a new Speaker get connected. If no master
-// was elected this Speaker will be chosen as master.
+// was elected this Speaker will be chosen as master. With a selector, the
+// election is done again as the new Speaker may be the one to select.
 func (a *MasterElection) OnConnected(c Speaker) {
+	a.RLock()
+	selector := a.selector
+	a.RUnlock()
+
+	if selector != nil {
+		a.Reelect()
+		return
+	}
+
 	a.Lock()
 	if a.master == nil {
 		master := c.(*Client)
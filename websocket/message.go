@@ -22,6 +22,7 @@ import (
 	"errors"
 	fmt "fmt"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	auth "github.com/abbot/go-http-auth"
@@ -46,8 +47,17 @@ const (
 	ProtobufProtocol Protocol = "protobuf"
 	// JSONProtocol is used for JSON encoded messages
 	JSONProtocol Protocol = "json"
+
+	// ProtobufSubprotocol is the websocket subprotocol negotiated for protobuf encoded messages
+	ProtobufSubprotocol = "skydive.protobuf"
+	// JSONSubprotocol is the websocket subprotocol negotiated for JSON encoded messages
+	JSONSubprotocol = "skydive.json"
 )
 
+// subprotocols lists the websocket subprotocols supported by the server in
+// order of preference
+var subprotocols = []string{ProtobufSubprotocol, JSONSubprotocol}
+
 // DefaultRequestTimeout default timeout used for Request/Reply JSON message.
 var DefaultRequestTimeout = 10 * time.Second
 
@@ -58,7 +68,8 @@ type ProtobufObject interface {
 }
 
 type structMessageState struct {
-	value interface{}
+	value    interface{}
+	priority Priority
 
 	// keep a cached version to avoid to serialize multiple time during
 	// the call flow
@@ -78,6 +89,30 @@ func (p *Protocol) parse(s string) error {
 	return nil
 }
 
+func (p *Protocol) parseSubprotocol(s string) error {
+	switch s {
+	case JSONSubprotocol:
+		*p = JSONProtocol
+	case ProtobufSubprotocol:
+		*p = ProtobufProtocol
+	default:
+		return fmt.Errorf("subprotocol %s not supported", s)
+	}
+	return nil
+}
+
+// subprotocol returns the websocket subprotocol matching the protocol,
+// raw connections don't negotiate any
+func (p *Protocol) subprotocol() string {
+	switch *p {
+	case JSONProtocol:
+		return JSONSubprotocol
+	case ProtobufProtocol:
+		return ProtobufSubprotocol
+	}
+	return ""
+}
+
 func (p *Protocol) String() string {
 	return string(*p)
 }
@@ -161,6 +196,7 @@ func (g *StructMessage) UnmarshalJSON(b []byte) error {
 		Type      string
 		UUID      string
 		Status    int64
+		Sequence  uint64
 		Obj       json.RawMessage
 	}{}
 
@@ -172,6 +208,7 @@ func (g *StructMessage) UnmarshalJSON(b []byte) error {
 	g.Type = m.Type
 	g.UUID = m.UUID
 	g.Status = m.Status
+	g.Sequence = m.Sequence
 	g.Obj = []byte(m.Obj)
 
 	return nil
@@ -213,6 +250,16 @@ func NewStructMessage(ns string, tp string, v interface{}, uuids ...string) *Str
 	return msg
 }
 
+// Priority returns the priority of the message. Implements the PrioritizedMessage interface.
+func (g *StructMessage) Priority() Priority {
+	return g.XXX_state.priority
+}
+
+// SetPriority sets the priority used to send the message
+func (g *StructMessage) SetPriority(priority Priority) {
+	g.XXX_state.priority = priority
+}
+
 // Reply returns a reply message with the given value, type and status.
 // Basically it return a new StructMessage with the correct Namespace and UUID.
 func (g *StructMessage) Reply(v interface{}, kind string, status int) *StructMessage {
@@ -316,6 +363,7 @@ func newStructSpeakerPoolEventDispatcher(pool SpeakerPool) *structSpeakerPoolEve
 
 // StructSpeaker is a Speaker able to handle Struct Message and Request/Reply calls.
 type StructSpeaker struct {
+	lastSequence uint64 // first field to be 64-bit aligned for atomic operations
 	Speaker
 	*structSpeakerEventDispatcher
 	nsSubscribed   map[string]bool
@@ -387,12 +435,22 @@ func (s *StructSpeaker) OnMessage(c Speaker, m Message) {
 			return
 		}
 		s.structSpeakerEventDispatcher.dispatchMessage(c, &structMsg)
+
+		if structMsg.Sequence != 0 {
+			atomic.StoreUint64(&s.lastSequence, structMsg.Sequence)
+		}
 	}
 }
 
+// LastSequence returns the sequence number of the last sequenced message
+// handled by the speaker, 0 if none was received
+func (s *StructSpeaker) LastSequence() uint64 {
+	return atomic.LoadUint64(&s.lastSequence)
+}
+
 func newStructSpeaker(c Speaker, logger logging.Logger) *StructSpeaker {
 	s := &StructSpeaker{
-		Speaker: c,
+		Speaker:                      c,
 		structSpeakerEventDispatcher: newStructSpeakerEventDispatcher(),
 		nsSubscribed:                 make(map[string]bool),
 		replyChan:                    make(map[string]chan *StructMessage),
@@ -498,7 +556,7 @@ func (s *StructServer) OnDisconnected(c Speaker) {
 // NewStructServer returns a new StructServer
 func NewStructServer(server *Server) *StructServer {
 	s := &StructServer{
-		Server: server,
+		Server:                           server,
 		structSpeakerPoolEventDispatcher: newStructSpeakerPoolEventDispatcher(server),
 	}
 
@@ -0,0 +1,171 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package websocket
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Priority of a message. Each priority has its own room in the sending queue
+// of a connection and its own drop policy. The messages are always sent in
+// the order they were queued, whatever their priority, so that the events
+// of a graph element can't be reordered.
+type Priority int
+
+const (
+	// NormalPriority is used by default, for instance for the metadata updates
+	NormalPriority Priority = iota
+	// HighPriority is used for the messages that must not be lost, like the
+	// graph structural events
+	HighPriority
+	// LowPriority is used for the messages that can be dropped under
+	// congestion, like the metric updates
+	LowPriority
+)
+
+// DropPolicy defines what happens when a message is sent while the room of
+// its priority is full
+type DropPolicy int
+
+const (
+	// BlockPolicy waits for some room in the queue, nothing is lost
+	BlockPolicy DropPolicy = iota
+	// DropOldestPolicy drops the oldest queued message of the same priority
+	DropOldestPolicy
+	// DropNewestPolicy drops the message being sent
+	DropNewestPolicy
+)
+
+// DefaultDropPolicies are the drop policies used for each priority
+var DefaultDropPolicies = map[Priority]DropPolicy{
+	HighPriority:   BlockPolicy,
+	NormalPriority: BlockPolicy,
+	LowPriority:    DropOldestPolicy,
+}
+
+// PrioritizedMessage is a Message with a priority, other messages being sent
+// with the normal priority
+type PrioritizedMessage interface {
+	Message
+	Priority() Priority
+}
+
+type prioritizedRawMessage struct {
+	RawMessage
+	priority Priority
+}
+
+// Priority implements the PrioritizedMessage interface
+func (m prioritizedRawMessage) Priority() Priority {
+	return m.priority
+}
+
+// NewPrioritizedRawMessage returns a raw message sent with the given priority
+func NewPrioritizedRawMessage(b []byte, priority Priority) PrioritizedMessage {
+	return prioritizedRawMessage{RawMessage: RawMessage(b), priority: priority}
+}
+
+func messagePriority(m Message) Priority {
+	if pm, ok := m.(PrioritizedMessage); ok {
+		return pm.Priority()
+	}
+	return NormalPriority
+}
+
+type queuedMessage struct {
+	data     []byte
+	priority Priority
+}
+
+// sendQueue keeps the messages to send in order, the number of messages of
+// each priority being limited to the size of the queue
+type sendQueue struct {
+	dropped  int64 // first field to be 64-bit aligned for atomic operations
+	lock     sync.Mutex
+	room     *sync.Cond
+	messages []queuedMessage
+	counts   map[Priority]int
+	size     int
+	ready    chan struct{}
+}
+
+// push queues a message, applying the drop policy of its priority if there
+// is no room left for it
+func (q *sendQueue) push(b []byte, priority Priority) {
+	q.lock.Lock()
+	for q.counts[priority] >= q.size {
+		switch DefaultDropPolicies[priority] {
+		case DropNewestPolicy:
+			q.lock.Unlock()
+			atomic.AddInt64(&q.dropped, 1)
+			return
+		case DropOldestPolicy:
+			q.dropOldest(priority)
+		default:
+			q.room.Wait()
+		}
+	}
+	q.messages = append(q.messages, queuedMessage{data: b, priority: priority})
+	q.counts[priority]++
+	q.lock.Unlock()
+
+	// wake up the writer if not already notified
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// dropOldest removes the oldest queued message of a priority, the lock being held
+func (q *sendQueue) dropOldest(priority Priority) {
+	for i, m := range q.messages {
+		if m.priority == priority {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			q.counts[priority]--
+			atomic.AddInt64(&q.dropped, 1)
+			return
+		}
+	}
+}
+
+// popAll returns all the queued messages in order, emptying the queue
+func (q *sendQueue) popAll() []queuedMessage {
+	q.lock.Lock()
+	messages := q.messages
+	q.messages = nil
+	q.counts = make(map[Priority]int)
+	q.room.Broadcast()
+	q.lock.Unlock()
+
+	return messages
+}
+
+func newSendQueue(size int) *sendQueue {
+	if size < 1 {
+		size = 1
+	}
+
+	q := &sendQueue{
+		counts: make(map[Priority]int),
+		size:   size,
+		ready:  make(chan struct{}, 1),
+	}
+	q.room = sync.NewCond(&q.lock)
+	return q
+}
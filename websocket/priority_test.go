@@ -0,0 +1,170 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+func TestSendQueueDropPolicies(t *testing.T) {
+	q := newSendQueue(2)
+
+	q.push([]byte("low1"), LowPriority)
+	q.push([]byte("normal1"), NormalPriority)
+	q.push([]byte("low2"), LowPriority)
+	q.push([]byte("low3"), LowPriority)
+	q.push([]byte("normal2"), NormalPriority)
+
+	if q.dropped != 1 {
+		t.Errorf("Expected one dropped message, got: %d", q.dropped)
+	}
+
+	// the oldest low priority message is the one which has been dropped,
+	// the other ones being kept in order
+	var sent []string
+	for _, m := range q.popAll() {
+		sent = append(sent, string(m.data))
+	}
+	if strings.Join(sent, ",") != "normal1,low2,low3,normal2" {
+		t.Errorf("Unexpected messages: %v", sent)
+	}
+
+	// the normal priority messages are never dropped, the sender waits for
+	// some room in the queue
+	q.push([]byte("normal1"), NormalPriority)
+	q.push([]byte("normal2"), NormalPriority)
+
+	pushed := make(chan struct{})
+	go func() {
+		q.push([]byte("normal3"), NormalPriority)
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("The normal priority message should wait for some room")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if messages := q.popAll(); len(messages) != 2 {
+		t.Errorf("Expected 2 messages, got: %d", len(messages))
+	}
+	<-pushed
+
+	if q.dropped != 1 {
+		t.Errorf("No normal priority message should be dropped, got: %d", q.dropped)
+	}
+}
+
+func TestMessagePriority(t *testing.T) {
+	msg := NewStructMessage("ns", "type", nil)
+	if messagePriority(msg) != NormalPriority {
+		t.Errorf("Expected normal priority by default, got: %d", messagePriority(msg))
+	}
+
+	msg.SetPriority(HighPriority)
+	if messagePriority(msg) != HighPriority {
+		t.Errorf("Expected high priority, got: %d", messagePriority(msg))
+	}
+
+	if priority := messagePriority(NewPrioritizedRawMessage([]byte{}, LowPriority)); priority != LowPriority {
+		t.Errorf("Expected low priority, got: %d", priority)
+	}
+
+	if priority := messagePriority(RawMessage{}); priority != NormalPriority {
+		t.Errorf("Expected normal priority for raw messages, got: %d", priority)
+	}
+}
+
+func TestConnPriorities(t *testing.T) {
+	received := make(chan string, 10)
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			_, m, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(m)
+		}
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(strings.Replace(server.URL, "http", "ws", 1))
+	c := newConn(defaultHostID, common.AgentService, RawProtocol, u, nil, ClientOpts{QueueSize: 2})
+	c.State.Store(common.RunningState)
+
+	// queue the events of a node before the connection is established, so
+	// that the metric updates overflow
+	for _, m := range []struct {
+		data     string
+		priority Priority
+	}{
+		{"added", HighPriority},
+		{"metric1", LowPriority},
+		{"updated", NormalPriority},
+		{"deleted", HighPriority},
+		{"metric2", LowPriority},
+		{"metric3", LowPriority},
+	} {
+		if err := c.SendMessage(NewPrioritizedRawMessage([]byte(m.data), m.priority)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if dropped := c.GetStatus().DroppedMessages; dropped != 1 {
+		t.Errorf("Expected one dropped message, got: %d", dropped)
+	}
+
+	wsConn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.conn = wsConn
+	c.Start()
+	defer c.StopAndWait()
+
+	// the messages are sent in the order they were queued, the oldest
+	// metric update being dropped
+	for _, expected := range []string{"added", "updated", "deleted", "metric2", "metric3"} {
+		select {
+		case m := <-received:
+			if m != expected {
+				t.Fatalf("Expected message %s, got: %s", expected, m)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Message %s not received", expected)
+		}
+	}
+}
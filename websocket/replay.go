@@ -0,0 +1,156 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+// ReplayLog keeps the last sent messages stamped with a monotonic sequence
+// number so that a reconnecting speaker can resume from the last sequence it
+// handled instead of doing a full resync. The ID identifies the log, a speaker
+// can only resume from a sequence of the same log, as sequences restart with
+// a new log, when the server restarts for instance.
+type ReplayLog struct {
+	sync.RWMutex
+	ID       string
+	entries  []*StructMessage
+	first    int
+	sequence uint64
+}
+
+// Append stamps the message with the next sequence number and stores it,
+// dropping the oldest message when the log is full.
+func (r *ReplayLog) Append(msg *StructMessage) uint64 {
+	r.Lock()
+	defer r.Unlock()
+
+	r.sequence++
+	msg.Sequence = r.sequence
+
+	switch {
+	case cap(r.entries) == 0:
+	case len(r.entries) < cap(r.entries):
+		r.entries = append(r.entries, msg)
+	default:
+		r.entries[r.first] = msg
+		r.first = (r.first + 1) % len(r.entries)
+	}
+
+	return r.sequence
+}
+
+// Sequence returns the sequence number of the last appended message
+func (r *ReplayLog) Sequence() uint64 {
+	r.RLock()
+	defer r.RUnlock()
+
+	return r.sequence
+}
+
+// Since returns the messages appended after the given sequence number. It
+// returns false if some of them have already been dropped from the log or if
+// the sequence is unknown, meaning that a full resync is required.
+func (r *ReplayLog) Since(sequence uint64) ([]*StructMessage, bool) {
+	r.RLock()
+	defer r.RUnlock()
+
+	if sequence > r.sequence {
+		return nil, false
+	}
+
+	missing := int(r.sequence - sequence)
+	if missing > len(r.entries) {
+		return nil, false
+	}
+
+	msgs := make([]*StructMessage, 0, missing)
+	for i := len(r.entries) - missing; i < len(r.entries); i++ {
+		msgs = append(msgs, r.entries[(r.first+i)%len(r.entries)])
+	}
+
+	return msgs, true
+}
+
+// ReplayLogState is the state of a replay log, saved to be restored by
+// another instance, across a restart for instance
+type ReplayLogState struct {
+	ID       string
+	Sequence uint64
+	// JSON encoded messages, oldest first
+	Entries []json.RawMessage
+}
+
+// State returns the state of the log
+func (r *ReplayLog) State() (*ReplayLogState, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	state := &ReplayLogState{ID: r.ID, Sequence: r.sequence}
+	for i := range r.entries {
+		b, err := r.entries[(r.first+i)%len(r.entries)].Bytes(JSONProtocol)
+		if err != nil {
+			return nil, err
+		}
+		state.Entries = append(state.Entries, b)
+	}
+
+	return state, nil
+}
+
+// Restore replaces the content of the log by the given state so that the
+// speakers can resume from the sequences of the saved log. The most recent
+// messages are kept if the log is smaller than the saved one.
+func (r *ReplayLog) Restore(state *ReplayLogState) error {
+	entries := state.Entries
+	if len(entries) > cap(r.entries) {
+		entries = entries[len(entries)-cap(r.entries):]
+	}
+
+	msgs := make([]*StructMessage, 0, cap(r.entries))
+	for _, b := range entries {
+		msg := &StructMessage{}
+		if err := msg.UnmarshalJSON(b); err != nil {
+			return err
+		}
+
+		// the message is sent as it was received
+		msg.XXX_state.value = json.RawMessage(msg.Obj)
+		msgs = append(msgs, msg)
+	}
+
+	r.Lock()
+	r.ID, r.sequence = state.ID, state.Sequence
+	r.entries, r.first = msgs, 0
+	r.Unlock()
+
+	return nil
+}
+
+// NewReplayLog returns a new replay log keeping at most size messages
+func NewReplayLog(size int) *ReplayLog {
+	u, _ := uuid.NewV4()
+
+	return &ReplayLog{
+		ID:      u.String(),
+		entries: make([]*StructMessage, 0, size),
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestReplayLog(t *testing.T) {
+	log := NewReplayLog(3)
+
+	if _, ok := log.Since(1); ok {
+		t.Error("Shouldn't be able to resume from an unknown sequence")
+	}
+
+	for _, tp := range []string{"msg1", "msg2", "msg3", "msg4"} {
+		log.Append(NewStructMessage("ns", tp, nil))
+	}
+
+	if log.Sequence() != 4 {
+		t.Errorf("Expected sequence 4, got: %d", log.Sequence())
+	}
+
+	msgs, ok := log.Since(2)
+	if !ok {
+		t.Fatal("Should be able to resume from sequence 2")
+	}
+
+	if len(msgs) != 2 || msgs[0].Type != "msg3" || msgs[1].Type != "msg4" {
+		t.Errorf("Expected msg3 and msg4, got: %v", msgs)
+	}
+
+	if msgs[0].Sequence != 3 || msgs[1].Sequence != 4 {
+		t.Errorf("Wrong sequences, got: %d, %d", msgs[0].Sequence, msgs[1].Sequence)
+	}
+
+	if msgs, ok = log.Since(4); !ok || len(msgs) != 0 {
+		t.Errorf("Expected no message to replay, got: %v", msgs)
+	}
+
+	// msg1 has been dropped from the log
+	if _, ok = log.Since(0); ok {
+		t.Error("Shouldn't be able to resume from a dropped message")
+	}
+}
+
+func TestReplayLogRestore(t *testing.T) {
+	log := NewReplayLog(3)
+	for _, tp := range []string{"msg1", "msg2", "msg3", "msg4"} {
+		log.Append(NewStructMessage("ns", tp, map[string]string{"Type": tp}))
+	}
+
+	state, err := log.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewReplayLog(2)
+	if err := restored.Restore(state); err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.ID != log.ID || restored.Sequence() != 4 {
+		t.Errorf("Expected log %s at sequence 4, got %s at %d", log.ID, restored.ID, restored.Sequence())
+	}
+
+	msgs, ok := restored.Since(2)
+	if !ok || len(msgs) != 2 {
+		t.Fatalf("Expected msg3 and msg4, got: %v", msgs)
+	}
+
+	b, err := msgs[1].Bytes(JSONProtocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg struct {
+		Type     string
+		Sequence uint64
+		Obj      map[string]string
+	}
+	if err := json.Unmarshal(b, &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Type != "msg4" || msg.Sequence != 4 || msg.Obj["Type"] != "msg4" {
+		t.Errorf("Wrong restored message: %s", string(b))
+	}
+
+	// the restored log keeps on stamping from the saved sequence
+	if seq := restored.Append(NewStructMessage("ns", "msg5", nil)); seq != 5 {
+		t.Errorf("Expected sequence 5, got: %d", seq)
+	}
+
+	if _, ok := restored.Since(2); ok {
+		t.Error("msg3 should have been dropped from the restored log")
+	}
+}
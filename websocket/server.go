@@ -49,6 +49,7 @@ type Server struct {
 
 // ServerOpts defines server options
 type ServerOpts struct {
+	Compression      bool
 	WriteCompression bool
 	QueueSize        int
 	PingDelay        time.Duration
@@ -95,7 +96,16 @@ func (s *Server) serveMessages(w http.ResponseWriter, r *auth.AuthenticatedReque
 	header.Set("X-Host-ID", s.server.Host)
 	header.Set("X-Service-Type", s.server.ServiceType.String())
 
-	conn, err := websocket.Upgrade(w, &r.Request, header, 1024, 1024)
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		EnableCompression: s.opts.Compression,
+		Subprotocols:      subprotocols,
+		CheckOrigin:       func(r *http.Request) bool { return true },
+		Error:             func(w http.ResponseWriter, r *http.Request, status int, reason error) {},
+	}
+
+	conn, err := upgrader.Upgrade(w, &r.Request, header)
 	if err != nil {
 		s.opts.Logger.Errorf("Unable to upgrade the websocket connection for %s: %s", r.RemoteAddr, err)
 		w.Header().Set("Connection", "close")
@@ -122,8 +132,13 @@ func (s *Server) newIncomingClient(conn *websocket.Conn, r *auth.AuthenticatedRe
 		clientType = common.UnknownService
 	}
 
+	// the negotiated subprotocol takes precedence over the protocol header
 	var clientProtocol Protocol
-	if err := clientProtocol.parse(getRequestParameter(&r.Request, "X-Client-Protocol")); err != nil {
+	if subprotocol := conn.Subprotocol(); subprotocol != "" {
+		if err := clientProtocol.parseSubprotocol(subprotocol); err != nil {
+			return nil, fmt.Errorf("Protocol requested error: %s", err)
+		}
+	} else if err := clientProtocol.parse(getRequestParameter(&r.Request, "X-Client-Protocol")); err != nil {
 		return nil, fmt.Errorf("Protocol requested error: %s", err)
 	}
 
@@ -139,6 +154,8 @@ func (s *Server) newIncomingClient(conn *websocket.Conn, r *auth.AuthenticatedRe
 	wsconn := newConn(s.server.Host, clientType, clientProtocol, url, r.Header, opts)
 	wsconn.conn = conn
 	wsconn.RemoteHost = getRequestParameter(&r.Request, "X-Host-ID")
+	wsconn.Username = r.Username
+	wsconn.Compression = s.opts.Compression && compressionNegotiated(r.Header)
 
 	// NOTE(safchain): fallback to remote addr if host id not provided
 	// should be removed, connection should be refused if host id not provided
@@ -113,6 +113,7 @@ func (s *testServer) start() {
 	s.httpServer = httpServer
 
 	serverOpts := ServerOpts{
+		Compression:      true,
 		WriteCompression: true,
 		QueueSize:        100,
 		PingDelay:        2 * time.Second,
@@ -291,3 +292,55 @@ func TestSubscriptionMultiClient(t *testing.T) {
 		t.Error(err.Error())
 	}
 }
+
+func TestSubprotocolNegotiation(t *testing.T) {
+	server := newTestServer(t)
+	server.start()
+	defer server.stop()
+
+	u, _ := url.Parse(fmt.Sprintf("ws://%s:%d/%s", host, port, path))
+
+	opts := ClientOpts{
+		Protocol:         ProtobufProtocol,
+		QueueSize:        1000,
+		Compression:      true,
+		WriteCompression: true,
+	}
+
+	client := NewClient(defaultHostID, common.AgentService, u, opts)
+	client.Start()
+	defer client.Stop()
+
+	err := common.Retry(func() error {
+		if !client.IsConnected() {
+			return errors.New("Client not connected")
+		}
+
+		if protocol := client.GetClientProtocol(); protocol != ProtobufProtocol {
+			return fmt.Errorf("Expected the protobuf protocol, got: %s", protocol)
+		}
+
+		if !client.GetStatus().Compression {
+			return errors.New("Expected the compression to be negotiated")
+		}
+
+		speakers := server.wsServer.GetSpeakers()
+		if len(speakers) != 1 {
+			return fmt.Errorf("Expected one incoming speaker, got: %d", len(speakers))
+		}
+
+		if protocol := speakers[0].GetClientProtocol(); protocol != ProtobufProtocol {
+			return fmt.Errorf("Expected the protobuf protocol on the server side, got: %s", protocol)
+		}
+
+		if !speakers[0].GetStatus().Compression {
+			return errors.New("Expected the compression to be negotiated on the server side")
+		}
+
+		return nil
+	}, 5, time.Second)
+
+	if err != nil {
+		t.Error(err)
+	}
+}